@@ -4,10 +4,7 @@ package backend
 import (
 	"context"
 	"errors"
-	"strconv"
-	"strings"
 	"time"
-	"unicode"
 )
 
 // ErrNotSupported is returned when a provider does not support an operation.
@@ -37,6 +34,13 @@ type EmailReader interface {
 type EmailWriter interface {
 	MarkAsRead(ctx context.Context, folder string, uid uint32) error
 	MarkAsUnread(ctx context.Context, folder string, uid uint32) error
+	MarkFlagged(ctx context.Context, folder string, uid uint32) error
+	MarkUnflagged(ctx context.Context, folder string, uid uint32) error
+	// AddLabel and RemoveLabel attach or detach a user label (an IMAP or
+	// JMAP keyword, or a Gmail label). Current labels are read from
+	// Email.Labels.
+	AddLabel(ctx context.Context, folder string, uid uint32, label string) error
+	RemoveLabel(ctx context.Context, folder string, uid uint32, label string) error
 	DeleteEmail(ctx context.Context, folder string, uid uint32) error
 	ArchiveEmail(ctx context.Context, folder string, uid uint32) error
 	MoveEmail(ctx context.Context, uid uint32, srcFolder, dstFolder string) error
@@ -52,21 +56,44 @@ type EmailSender interface {
 	SendEmail(ctx context.Context, msg *OutgoingEmail) error
 }
 
+// SentSaver is optionally implemented by providers that keep a copy of
+// sent mail themselves rather than on an IMAP server.
+type SentSaver interface {
+	// SaveSent stores a sent RFC 822 message in the Sent folder, marked as
+	// read.
+	SaveSent(ctx context.Context, raw []byte) error
+}
+
 // EmailSearcher searches emails server-side.
 type EmailSearcher interface {
 	Search(ctx context.Context, folder string, query SearchQuery) ([]Email, error)
 }
 
-// FolderManager lists folders/mailboxes.
+// FolderManager lists and manages folders/mailboxes. Folder names are full
+// paths using the backend's hierarchy delimiter.
 type FolderManager interface {
 	FetchFolders(ctx context.Context) ([]Folder, error)
+	CreateFolder(ctx context.Context, name string) error
+	RenameFolder(ctx context.Context, oldName, newName string) error
+	DeleteFolder(ctx context.Context, name string) error
+	SubscribeFolder(ctx context.Context, name string) error
+	UnsubscribeFolder(ctx context.Context, name string) error
 }
 
-// Notifier provides real-time notifications for new email.
+// Notifier provides real-time notifications for new email. Watch returns
+// a channel of events, closed when the watch ends, and a function that
+// stops the watch; it may be called more than once, and after the watch
+// ended on its own.
 type Notifier interface {
 	Watch(ctx context.Context, folder string) (<-chan NotifyEvent, func(), error)
 }
 
+// FoldersNotifier is optionally implemented by providers that can watch
+// several folders more cheaply than with one Watch call per folder.
+type FoldersNotifier interface {
+	WatchFolders(ctx context.Context, folders []string) (<-chan NotifyEvent, func(), error)
+}
+
 // CapabilityProvider optionally reports what a backend can do.
 type CapabilityProvider interface {
 	Capabilities() Capabilities
@@ -82,6 +109,8 @@ type Email struct {
 	Body        string
 	Date        time.Time
 	IsRead      bool
+	IsFlagged   bool
+	Labels      []string
 	MessageID   string
 	InReplyTo   string
 	References  []string
@@ -106,108 +135,6 @@ type Attachment struct {
 	IsPGPEncrypted   bool
 }
 
-// SearchQuery is the parsed form of a user query string.
-type SearchQuery struct {
-	Raw        string
-	From       string
-	To         string
-	Subject    string
-	Body       string
-	Since      time.Time
-	Before     time.Time
-	LargerThan int
-	Limit      uint32
-}
-
-// ParseSearchQuery parses a compact search DSL into a SearchQuery.
-func ParseSearchQuery(s string) SearchQuery {
-	query := SearchQuery{Raw: s}
-	var bodyTerms []string
-
-	for _, term := range tokenizeSearchQuery(s) {
-		key, value, ok := strings.Cut(term, ":")
-		if !ok || value == "" {
-			bodyTerms = append(bodyTerms, term)
-			continue
-		}
-
-		switch strings.ToLower(key) {
-		case "from":
-			query.From = value
-		case "to":
-			query.To = value
-		case "subject":
-			query.Subject = value
-		case "body":
-			query.Body = value
-		case "since":
-			if t, ok := parseSearchDate(value); ok {
-				query.Since = t
-			}
-		case "before":
-			if t, ok := parseSearchDate(value); ok {
-				query.Before = t
-			}
-		case "larger":
-			if n, err := strconv.Atoi(value); err == nil && n > 0 {
-				query.LargerThan = n
-			}
-		default:
-			bodyTerms = append(bodyTerms, term)
-		}
-	}
-
-	if query.Body == "" && len(bodyTerms) > 0 {
-		query.Body = strings.Join(bodyTerms, " ")
-	}
-
-	return query
-}
-
-func tokenizeSearchQuery(s string) []string {
-	var tokens []string
-	var b strings.Builder
-	var quote rune
-
-	for _, r := range s {
-		if quote != 0 {
-			if r == quote {
-				quote = 0
-				continue
-			}
-			b.WriteRune(r)
-			continue
-		}
-		if r == '"' || r == '\'' {
-			quote = r
-			continue
-		}
-		if unicode.IsSpace(r) {
-			if b.Len() > 0 {
-				tokens = append(tokens, b.String())
-				b.Reset()
-			}
-			continue
-		}
-		b.WriteRune(r)
-	}
-
-	if b.Len() > 0 {
-		tokens = append(tokens, b.String())
-	}
-
-	return tokens
-}
-
-func parseSearchDate(value string) (time.Time, bool) {
-	for _, layout := range []string{"2006-01-02", time.RFC3339} {
-		if t, err := time.Parse(layout, value); err == nil {
-			return t, true
-		}
-	}
-	return time.Time{}, false
-}
-
 // Folder represents a mailbox/folder.
 type Folder struct {
 	Name       string
@@ -244,6 +171,7 @@ const (
 )
 
 // NotifyEvent is emitted by Watch() when something changes in a mailbox.
+// Folder is empty when the backend cannot tell which folder changed.
 type NotifyEvent struct {
 	Type      NotifyType
 	Folder    string
@@ -1,6 +1,13 @@
 package backend
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -74,3 +81,236 @@ func TestParseSearchQueryQuotedValues(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSearchQueryFlagged(t *testing.T) {
+	if q := ParseSearchQuery("flagged:yes invoice"); q.Flagged == nil || !*q.Flagged || q.Body != "invoice" {
+		t.Fatalf("flagged:yes = Flagged:%v Body:%q", q.Flagged, q.Body)
+	}
+	if q := ParseSearchQuery("flagged:no"); q.Flagged == nil || *q.Flagged {
+		t.Fatalf("flagged:no = %v", q.Flagged)
+	}
+	if q := ParseSearchQuery("flagged:maybe"); q.Flagged != nil {
+		t.Fatalf("flagged:maybe = %v, want unset", *q.Flagged)
+	}
+}
+
+// exprString renders a search expression compactly for comparison.
+func exprString(e *SearchExpr) string {
+	if e == nil {
+		return ""
+	}
+	switch e.Op {
+	case SearchAnd, SearchOr, SearchNot:
+		op := map[SearchOp]string{SearchAnd: "and", SearchOr: "or", SearchNot: "not"}[e.Op]
+		parts := make([]string, len(e.Children))
+		for i, c := range e.Children {
+			parts[i] = exprString(c)
+		}
+		return "(" + op + " " + strings.Join(parts, " ") + ")"
+	}
+	switch e.Field {
+	case SearchSince, SearchBefore:
+		return string(e.Field) + ":" + e.Time.Format("2006-01-02")
+	case SearchLarger, SearchSmaller:
+		return fmt.Sprintf("%s:%d", e.Field, e.Size)
+	case SearchFlagged, SearchRead, SearchAttachment:
+		return fmt.Sprintf("%s:%t", e.Field, e.Bool)
+	}
+	return string(e.Field) + ":" + e.Text
+}
+
+func TestParseSearchQueryExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"from:alice", "from:alice"},
+		{"from:alice OR from:bob", "(or from:alice from:bob)"},
+		{"a b OR c", "(or (and body:a body:b) body:c)"},
+		{"-from:news", "(not from:news)"},
+		{`-"weekly digest"`, "(not body:weekly digest)"},
+		{"(from:a OR from:b) is:read", "(and (or from:a from:b) read:true)"},
+		{"is:unread -(subject:x OR has:attachment)", "(and read:false (not (or subject:x attachment:true)))"},
+		{"is:flagged cc:carol smaller:2k", "(and flagged:true cc:carol smaller:2048)"},
+		{"larger:1m", "larger:1048576"},
+		{`"OR" subject:"a OR b"`, "(and body:OR subject:a OR b)"},
+		{"from:a AND from:b", "(and from:a from:b)"},
+		{"(from:a OR from:b", "(or from:a from:b)"},
+		{"from:a) from:b", "(and from:a from:b)"},
+		{"is:bogus", "body:is:bogus"},
+		{"since:tomorrow", ""},
+	}
+	for _, tt := range tests {
+		if got := exprString(ParseSearchQuery(tt.input).Expr); got != tt.want {
+			t.Errorf("ParseSearchQuery(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQueryFolderAndRelativeDates(t *testing.T) {
+	q := ParseSearchQuery("folder:Archive since:7d before:1y")
+	if q.Folder != "Archive" {
+		t.Errorf("Folder = %q, want Archive", q.Folder)
+	}
+	now := time.Now()
+	if d := now.AddDate(0, 0, -7).Sub(q.Since); d < 0 || d > time.Minute {
+		t.Errorf("since:7d = %v, want about %v", q.Since, now.AddDate(0, 0, -7))
+	}
+	if d := now.AddDate(-1, 0, 0).Sub(q.Before); d < 0 || d > time.Minute {
+		t.Errorf("before:1y = %v, want about %v", q.Before, now.AddDate(-1, 0, 0))
+	}
+}
+
+func TestParseSearchQueryFolderTerm(t *testing.T) {
+	tests := []struct {
+		input  string
+		folder string
+		expr   string
+		err    bool
+	}{
+		{"folder:Archive", "Archive", "", false},
+		{"from:a folder:Archive", "Archive", "from:a", false},
+		{`folder:"Sent Mail" is:read`, "Sent Mail", "read:true", false},
+		{"-folder:Spam", "", "", true},
+		{"from:a -folder:Spam", "", "from:a", true},
+		{"folder:A OR folder:B", "", "", true},
+		{"from:a (folder:A OR subject:x)", "", "(and from:a subject:x)", true},
+		{"folder:A folder:B", "B", "", true},
+	}
+	for _, tt := range tests {
+		q := ParseSearchQuery(tt.input)
+		if q.Folder != tt.folder {
+			t.Errorf("ParseSearchQuery(%q).Folder = %q, want %q", tt.input, q.Folder, tt.folder)
+		}
+		if got := exprString(q.Expr); got != tt.expr {
+			t.Errorf("ParseSearchQuery(%q).Expr = %s, want %s", tt.input, got, tt.expr)
+		}
+		if (q.Err != nil) != tt.err {
+			t.Errorf("ParseSearchQuery(%q).Err = %v, want error: %v", tt.input, q.Err, tt.err)
+		}
+	}
+}
+
+func TestSearchQueryExpressionFromFields(t *testing.T) {
+	yes := true
+	q := SearchQuery{From: "alice", Body: "paid", LargerThan: 10, Flagged: &yes}
+	if got, want := exprString(q.Expression()), "(and from:alice body:paid larger:10 flagged:true)"; got != want {
+		t.Errorf("Expression() = %s, want %s", got, want)
+	}
+	if (SearchQuery{}).Expression() != nil {
+		t.Error("empty query should have no expression")
+	}
+}
+
+func TestLabelsFromKeywords(t *testing.T) {
+	got := LabelsFromKeywords([]string{`\Seen`, "$Label1", "$Forwarded", "work", "$flagged", "NonJunk", "Travel"})
+	want := []string{"$Label1", "Travel", "work"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("LabelsFromKeywords = %v, want %v", got, want)
+	}
+}
+
+func TestCheckLabel(t *testing.T) {
+	for _, label := range []string{"work", "$Label1", "follow-up"} {
+		if err := CheckLabel(label); err != nil {
+			t.Errorf("CheckLabel(%q) = %v, want nil", label, err)
+		}
+	}
+	for _, label := range []string{"", "two words", `\Seen`, "$seen", "a(b", `quo"te`, "tab\there", "Ärger"} {
+		if err := CheckLabel(label); err == nil {
+			t.Errorf("CheckLabel(%q) = nil, want error", label)
+		}
+	}
+}
+
+func TestIsNetworkError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{dialErr, true},
+		{fmt.Errorf("connect: %w", dialErr), true},
+		{&net.DNSError{Err: "no such host", Name: "imap.example.com"}, true},
+		{syscall.ENETUNREACH, true},
+		{ErrNotSupported, false},
+		{errors.New("NO [NONEXISTENT] no such message"), false},
+	}
+	for _, tt := range tests {
+		if got := IsNetworkError(tt.err); got != tt.want {
+			t.Errorf("IsNetworkError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// folderNotifier watches each folder with a channel the test sends on.
+type folderNotifier struct {
+	chans   map[string]chan NotifyEvent
+	end     map[string]func() // ends a watch as if it failed
+	stopped int
+}
+
+func (n *folderNotifier) Watch(_ context.Context, folder string) (<-chan NotifyEvent, func(), error) {
+	if folder == "Unsupported" {
+		return nil, nil, ErrNotSupported
+	}
+	ch := make(chan NotifyEvent)
+	n.chans[folder] = ch
+	var once sync.Once
+	n.end[folder] = func() { once.Do(func() { close(ch) }) }
+	return ch, func() {
+		n.stopped++
+		n.end[folder]()
+	}, nil
+}
+
+func TestWatchFoldersMergesWatches(t *testing.T) {
+	n := &folderNotifier{chans: make(map[string]chan NotifyEvent), end: make(map[string]func())}
+	events, cancel, err := WatchFolders(context.Background(), n, []string{"INBOX", "Lists"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.chans["Lists"] <- NotifyEvent{Type: NotifyNewEmail, Folder: "Lists"}
+	if ev := <-events; ev.Folder != "Lists" {
+		t.Errorf("event folder = %q, want Lists", ev.Folder)
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("events not closed after cancel")
+	}
+	if n.stopped != 2 {
+		t.Errorf("stopped %d watches, want 2", n.stopped)
+	}
+}
+
+func TestWatchFoldersEndsWhenOneWatchEnds(t *testing.T) {
+	n := &folderNotifier{chans: make(map[string]chan NotifyEvent), end: make(map[string]func())}
+	events, cancel, err := WatchFolders(context.Background(), n, []string{"INBOX", "Lists"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	n.end["Lists"]()
+	if _, ok := <-events; ok {
+		t.Error("events not closed after a watch ended")
+	}
+	if n.stopped != 2 {
+		t.Errorf("stopped %d watches, want 2", n.stopped)
+	}
+}
+
+func TestWatchFoldersNotSupported(t *testing.T) {
+	n := &folderNotifier{chans: make(map[string]chan NotifyEvent), end: make(map[string]func())}
+	_, _, err := WatchFolders(context.Background(), n, []string{"INBOX", "Unsupported"})
+	if !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("err = %v, want ErrNotSupported", err)
+	}
+	if n.stopped != 1 {
+		t.Errorf("stopped %d watches after the error, want 1", n.stopped)
+	}
+}
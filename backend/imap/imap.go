@@ -1,10 +1,13 @@
 // Package imap implements the backend.Provider interface by delegating
-// to the existing fetcher and sender packages.
+// to the existing fetcher and sender packages. IMAP sessions come from the
+// fetcher's connection pool, so providers are cheap to create and close.
 package imap
 
 import (
 	"context"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/config"
@@ -12,6 +15,10 @@ import (
 	"github.com/floatpane/matcha/sender"
 )
 
+// watchStopTimeout bounds how long stopping a watch waits for its IMAP
+// connections to close.
+const watchStopTimeout = 5 * time.Second
+
 func init() {
 	backend.RegisterBackend("imap", func(account *config.Account) (backend.Provider, error) {
 		return New(account)
@@ -64,6 +71,22 @@ func (p *Provider) MarkAsUnread(_ context.Context, folder string, uid uint32) er
 	return fetcher.MarkEmailAsUnreadInMailbox(p.account, folder, uid)
 }
 
+func (p *Provider) MarkFlagged(_ context.Context, folder string, uid uint32) error {
+	return fetcher.MarkEmailAsFlaggedInMailbox(p.account, folder, uid)
+}
+
+func (p *Provider) MarkUnflagged(_ context.Context, folder string, uid uint32) error {
+	return fetcher.MarkEmailAsUnflaggedInMailbox(p.account, folder, uid)
+}
+
+func (p *Provider) AddLabel(_ context.Context, folder string, uid uint32, label string) error {
+	return fetcher.AddLabelInMailbox(p.account, folder, uid, label)
+}
+
+func (p *Provider) RemoveLabel(_ context.Context, folder string, uid uint32, label string) error {
+	return fetcher.RemoveLabelInMailbox(p.account, folder, uid, label)
+}
+
 func (p *Provider) DeleteEmail(_ context.Context, folder string, uid uint32) error {
 	return fetcher.DeleteEmailFromMailbox(p.account, folder, uid)
 }
@@ -121,9 +144,79 @@ func (p *Provider) FetchFolders(_ context.Context) ([]backend.Folder, error) {
 	return toBackendFolders(folders), nil
 }
 
-func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEvent, func(), error) {
-	// IMAP IDLE is handled by the existing IdleWatcher in main.go
-	return nil, nil, backend.ErrNotSupported
+func (p *Provider) CreateFolder(_ context.Context, name string) error {
+	return fetcher.CreateFolder(p.account, name)
+}
+
+func (p *Provider) RenameFolder(_ context.Context, oldName, newName string) error {
+	return fetcher.RenameFolder(p.account, oldName, newName)
+}
+
+func (p *Provider) DeleteFolder(_ context.Context, name string) error {
+	return fetcher.DeleteFolder(p.account, name)
+}
+
+func (p *Provider) SubscribeFolder(_ context.Context, name string) error {
+	return fetcher.SubscribeFolder(p.account, name)
+}
+
+func (p *Provider) UnsubscribeFolder(_ context.Context, name string) error {
+	return fetcher.UnsubscribeFolder(p.account, name)
+}
+
+// Watch reports new mail in folder, using IMAP IDLE.
+func (p *Provider) Watch(ctx context.Context, folder string) (<-chan backend.NotifyEvent, func(), error) {
+	return p.WatchFolders(ctx, []string{folder})
+}
+
+// WatchFolders reports new mail in any of folders. Several folders are
+// watched over one connection with IMAP NOTIFY where the server supports
+// it, and with one IDLE connection each otherwise.
+func (p *Provider) WatchFolders(ctx context.Context, folders []string) (<-chan backend.NotifyEvent, func(), error) {
+	updates := make(chan fetcher.IdleUpdate, 16)
+	w := fetcher.NewIdleWatcher(updates)
+	w.WatchFolders(p.account, folders)
+
+	ch := make(chan backend.NotifyEvent, 16)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(ch)
+		defer func() {
+			if err := w.StopAllAndWaitTimeout(watchStopTimeout); err != nil {
+				log.Printf("imap: %v", err)
+			}
+		}()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case u := <-updates:
+				ev := backend.NotifyEvent{
+					Type:      backend.NotifyNewEmail,
+					Folder:    u.FolderName,
+					AccountID: u.AccountID,
+				}
+				select {
+				case ch <- ev:
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+	return ch, cancel, nil
 }
 
 func (p *Provider) Close() error {
@@ -131,7 +224,10 @@ func (p *Provider) Close() error {
 }
 
 // Verify interface compliance at compile time.
-var _ backend.Provider = (*Provider)(nil)
+var (
+	_ backend.Provider        = (*Provider)(nil)
+	_ backend.FoldersNotifier = (*Provider)(nil)
+)
 
 // Conversion helpers
 
@@ -147,6 +243,8 @@ func toBackendEmails(emails []fetcher.Email) []backend.Email {
 			Body:        e.Body,
 			Date:        e.Date,
 			IsRead:      e.IsRead,
+			IsFlagged:   e.IsFlagged,
+			Labels:      e.Labels,
 			MessageID:   e.MessageID,
 			InReplyTo:   e.InReplyTo,
 			References:  e.References,
@@ -249,30 +249,136 @@ func (p *Provider) Search(_ context.Context, folder string, query backend.Search
 	return emails, nil
 }
 
-func buildSearchFilter(mboxID jmapclient.ID, query backend.SearchQuery) *email.FilterCondition {
-	f := &email.FilterCondition{InMailbox: mboxID}
-	if query.From != "" {
-		f.From = query.From
+// buildSearchFilter translates a query into an Email/query filter limited to
+// the mailbox. A plain conjunction of terms becomes a single condition;
+// anything else is ANDed with the mailbox under a FilterOperator.
+func buildSearchFilter(mboxID jmapclient.ID, query backend.SearchQuery) email.Filter {
+	inMailbox := &email.FilterCondition{InMailbox: mboxID}
+	expr := query.Expression()
+	if expr == nil {
+		return inMailbox
+	}
+
+	terms := []*backend.SearchExpr{expr}
+	if expr.Op == backend.SearchAnd {
+		terms = expr.Children
+	}
+	merged := *inMailbox
+	simple := true
+	for _, term := range terms {
+		if !setCondition(&merged, term) {
+			simple = false
+			break
+		}
 	}
-	if query.To != "" {
-		f.To = query.To
+	if simple {
+		return &merged
 	}
-	if query.Subject != "" {
-		f.Subject = query.Subject
+	return &email.FilterOperator{
+		Operator:   jmapclient.OperatorAND,
+		Conditions: []email.Filter{inMailbox, exprFilter(expr)},
 	}
-	if query.Body != "" {
-		f.Body = query.Body
+}
+
+// exprFilter translates a search expression into a JMAP filter.
+func exprFilter(e *backend.SearchExpr) email.Filter {
+	var op jmapclient.Operator
+	switch e.Op {
+	case backend.SearchAnd:
+		op = jmapclient.OperatorAND
+	case backend.SearchOr:
+		op = jmapclient.OperatorOR
+	case backend.SearchNot:
+		op = jmapclient.OperatorNOT
+	default:
+		cond := &email.FilterCondition{}
+		if setCondition(cond, e) {
+			return cond
+		}
+		// Only -has:attachment lands here: JMAP can only ask for
+		// messages with attachments.
+		return &email.FilterOperator{
+			Operator:   jmapclient.OperatorNOT,
+			Conditions: []email.Filter{&email.FilterCondition{HasAttachment: true}},
+		}
 	}
-	if !query.Since.IsZero() {
-		f.After = &query.Since
+	conditions := make([]email.Filter, 0, len(e.Children))
+	for _, child := range e.Children {
+		conditions = append(conditions, exprFilter(child))
 	}
-	if !query.Before.IsZero() {
-		f.Before = &query.Before
+	return &email.FilterOperator{Operator: op, Conditions: conditions}
+}
+
+// setCondition sets a term's property on cond. It reports false for
+// operators and for properties cond already has, which need their own
+// condition.
+func setCondition(cond *email.FilterCondition, e *backend.SearchExpr) bool {
+	if e.Op != backend.SearchTerm {
+		return false
+	}
+	setText := func(field *string) bool {
+		if *field != "" {
+			return false
+		}
+		*field = e.Text
+		return true
+	}
+	switch e.Field {
+	case backend.SearchFrom:
+		return setText(&cond.From)
+	case backend.SearchTo:
+		return setText(&cond.To)
+	case backend.SearchCc:
+		return setText(&cond.Cc)
+	case backend.SearchSubject:
+		return setText(&cond.Subject)
+	case backend.SearchBody:
+		return setText(&cond.Body)
+	case backend.SearchSince:
+		if cond.After != nil {
+			return false
+		}
+		t := e.Time
+		cond.After = &t
+	case backend.SearchBefore:
+		if cond.Before != nil {
+			return false
+		}
+		t := e.Time
+		cond.Before = &t
+	case backend.SearchLarger:
+		if cond.MinSize != 0 {
+			return false
+		}
+		cond.MinSize = uint64(e.Size)
+	case backend.SearchSmaller:
+		if cond.MaxSize != 0 {
+			return false
+		}
+		cond.MaxSize = uint64(e.Size)
+	case backend.SearchFlagged:
+		return setKeyword(cond, "$flagged", e.Bool)
+	case backend.SearchRead:
+		return setKeyword(cond, "$seen", e.Bool)
+	case backend.SearchAttachment:
+		if !e.Bool || cond.HasAttachment {
+			return false
+		}
+		cond.HasAttachment = true
+	}
+	return true
+}
+
+func setKeyword(cond *email.FilterCondition, keyword string, set bool) bool {
+	field := &cond.NotKeyword
+	if set {
+		field = &cond.HasKeyword
 	}
-	if query.LargerThan > 0 {
-		f.MinSize = uint64(query.LargerThan)
+	if *field != "" {
+		return false
 	}
-	return f
+	*field = keyword
+	return true
 }
 
 func searchLimit(query backend.SearchQuery) uint32 {
@@ -398,6 +504,53 @@ func (p *Provider) MarkAsUnread(_ context.Context, folder string, uid uint32) er
 	return err
 }
 
+func (p *Provider) MarkFlagged(_ context.Context, folder string, uid uint32) error {
+	return p.setKeyword(folder, uid, "$flagged", true)
+}
+
+func (p *Provider) MarkUnflagged(_ context.Context, folder string, uid uint32) error {
+	return p.setKeyword(folder, uid, "$flagged", false)
+}
+
+// AddLabel sets the label as a keyword. JMAP keywords are case-insensitive
+// and servers report them lowercased, so the label is lowercased too.
+func (p *Provider) AddLabel(_ context.Context, folder string, uid uint32, label string) error {
+	if err := backend.CheckLabel(label); err != nil {
+		return err
+	}
+	return p.setKeyword(folder, uid, strings.ToLower(label), true)
+}
+
+func (p *Provider) RemoveLabel(_ context.Context, folder string, uid uint32, label string) error {
+	if err := backend.CheckLabel(label); err != nil {
+		return err
+	}
+	return p.setKeyword(folder, uid, strings.ToLower(label), false)
+}
+
+// setKeyword adds or removes a single keyword on an email.
+func (p *Provider) setKeyword(folder string, uid uint32, keyword string, set bool) error {
+	jmapID, err := p.resolveUID(folder, uid)
+	if err != nil {
+		return err
+	}
+
+	var value any
+	if set {
+		value = true
+	}
+	req := &jmapclient.Request{}
+	req.Invoke(&email.Set{
+		Account: p.accountID,
+		Update: map[jmapclient.ID]jmapclient.Patch{
+			jmapID: {"keywords/" + keyword: value},
+		},
+	})
+
+	_, err = p.client.Do(req)
+	return err
+}
+
 func (p *Provider) DeleteEmail(_ context.Context, folder string, uid uint32) error {
 	jmapID, err := p.resolveUID(folder, uid)
 	if err != nil {
@@ -639,7 +792,174 @@ func (p *Provider) FetchFolders(_ context.Context) ([]backend.Folder, error) {
 	return folders, nil
 }
 
-func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEvent, func(), error) {
+// CreateFolder creates a mailbox. A "/" in name nests the new mailbox under
+// the named parent, which must already exist.
+func (p *Provider) CreateFolder(_ context.Context, name string) error {
+	parent, leaf := splitMailboxPath(name)
+	mbox := &mailbox.Mailbox{Name: leaf, IsSubscribed: true}
+	if parent != "" {
+		parentID, err := p.resolveMailboxID(parent)
+		if err != nil {
+			return err
+		}
+		mbox.ParentID = parentID
+	}
+
+	req := &jmapclient.Request{}
+	req.Invoke(&mailbox.Set{
+		Account: p.accountID,
+		Create:  map[jmapclient.ID]*mailbox.Mailbox{"new": mbox},
+	})
+	if err := p.doMailboxSet(req); err != nil {
+		return err
+	}
+	return p.refreshMailboxes()
+}
+
+// RenameFolder renames a mailbox. The mailbox is only reparented when
+// newName contains a "/".
+func (p *Provider) RenameFolder(_ context.Context, oldName, newName string) error {
+	id, err := p.resolveMailboxID(oldName)
+	if err != nil {
+		return err
+	}
+
+	parent, leaf := splitMailboxPath(newName)
+	patch := jmapclient.Patch{"name": leaf}
+	if parent != "" {
+		parentID, err := p.resolveMailboxID(parent)
+		if err != nil {
+			return err
+		}
+		patch["parentId"] = parentID
+	}
+
+	req := &jmapclient.Request{}
+	req.Invoke(&mailbox.Set{
+		Account: p.accountID,
+		Update:  map[jmapclient.ID]jmapclient.Patch{id: patch},
+	})
+	if err := p.doMailboxSet(req); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.mailboxes, oldName)
+	p.mu.Unlock()
+	return p.refreshMailboxes()
+}
+
+// DeleteFolder destroys a mailbox. The server refuses if the mailbox still
+// has children or messages.
+func (p *Provider) DeleteFolder(_ context.Context, name string) error {
+	id, err := p.resolveMailboxID(name)
+	if err != nil {
+		return err
+	}
+
+	req := &jmapclient.Request{}
+	req.Invoke(&mailbox.Set{
+		Account: p.accountID,
+		Destroy: []jmapclient.ID{id},
+	})
+	if err := p.doMailboxSet(req); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n, mid := range p.mailboxes {
+		if mid == id {
+			delete(p.mailboxes, n)
+		}
+	}
+	for role, mid := range p.roleToID {
+		if mid == id {
+			delete(p.roleToID, role)
+		}
+	}
+	return nil
+}
+
+func (p *Provider) SubscribeFolder(_ context.Context, name string) error {
+	return p.setSubscribed(name, true)
+}
+
+func (p *Provider) UnsubscribeFolder(_ context.Context, name string) error {
+	return p.setSubscribed(name, false)
+}
+
+func (p *Provider) setSubscribed(name string, subscribed bool) error {
+	id, err := p.resolveMailboxID(name)
+	if err != nil {
+		return err
+	}
+
+	req := &jmapclient.Request{}
+	req.Invoke(&mailbox.Set{
+		Account: p.accountID,
+		Update: map[jmapclient.ID]jmapclient.Patch{
+			id: {"isSubscribed": subscribed},
+		},
+	})
+	return p.doMailboxSet(req)
+}
+
+// doMailboxSet sends a Mailbox/set request and reports any method error or
+// per-record failure as an error.
+func (p *Provider) doMailboxSet(req *jmapclient.Request) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	for _, inv := range resp.Responses {
+		switch r := inv.Args.(type) {
+		case *jmapclient.MethodError:
+			return fmt.Errorf("jmap mailbox/set: %w", r)
+		case *mailbox.SetResponse:
+			if err := mailboxSetError(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mailboxSetError returns the first failure recorded in a Mailbox/set
+// response, or nil if every change was applied.
+func mailboxSetError(r *mailbox.SetResponse) error {
+	for _, failed := range []map[jmapclient.ID]*jmapclient.SetError{r.NotCreated, r.NotUpdated, r.NotDestroyed} {
+		for _, setErr := range failed {
+			if setErr == nil {
+				continue
+			}
+			if setErr.Description != nil {
+				return fmt.Errorf("jmap mailbox/set: %s: %s", setErr.Type, *setErr.Description)
+			}
+			return fmt.Errorf("jmap mailbox/set: %s", setErr.Type)
+		}
+	}
+	return nil
+}
+
+// splitMailboxPath splits "A/Parent/Child" into the immediate parent's name
+// and the leaf name. Mailboxes are looked up by their own name, so higher
+// ancestors are dropped.
+func splitMailboxPath(name string) (parent, leaf string) {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return "", name
+	}
+	parent, leaf = name[:i], name[i+1:]
+	if j := strings.LastIndex(parent, "/"); j >= 0 {
+		parent = parent[j+1:]
+	}
+	return parent, leaf
+}
+
+// Watch reports changes anywhere in the account: JMAP push covers the whole
+// account, so the events have no folder.
+func (p *Provider) Watch(ctx context.Context, _ string) (<-chan backend.NotifyEvent, func(), error) {
 	ch := make(chan backend.NotifyEvent, 16)
 
 	es := &push.EventSource{
@@ -648,9 +968,14 @@ func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEven
 			for _, typeState := range change.Changed {
 				for objType := range typeState {
 					if objType == "Email" || objType == "Mailbox" {
-						ch <- backend.NotifyEvent{
+						// Non-blocking: a pending event already makes the
+						// consumer look at the account again.
+						select {
+						case ch <- backend.NotifyEvent{
 							Type:      backend.NotifyNewEmail,
 							AccountID: p.account.ID,
+						}:
+						default:
 						}
 					}
 				}
@@ -664,19 +989,30 @@ func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEven
 		_ = es.Listen()
 	}()
 
+	var once sync.Once
 	cancel := func() {
-		es.Close()
+		once.Do(es.Close)
 	}
+	context.AfterFunc(ctx, cancel)
 
 	return ch, cancel, nil
 }
 
+// WatchFolders watches the whole account with a single event source, as
+// Watch does.
+func (p *Provider) WatchFolders(ctx context.Context, _ []string) (<-chan backend.NotifyEvent, func(), error) {
+	return p.Watch(ctx, "")
+}
+
 func (p *Provider) Close() error {
 	return nil
 }
 
 // Verify interface compliance at compile time.
-var _ backend.Provider = (*Provider)(nil)
+var (
+	_ backend.Provider        = (*Provider)(nil)
+	_ backend.FoldersNotifier = (*Provider)(nil)
+)
 
 // resolveUID returns the JMAP ID for the given uint32 UID. It checks the
 // in-memory cache first (fast path when FetchEmails ran on the same instance),
@@ -756,6 +1092,7 @@ func jmapEmailToBackend(eml *email.Email, uid uint32, accountID string) backend.
 		Subject:   eml.Subject,
 		Date:      safeTime(eml.ReceivedAt),
 		IsRead:    eml.Keywords["$seen"],
+		IsFlagged: eml.Keywords["$flagged"],
 		AccountID: accountID,
 	}
 	if len(eml.From) > 0 {
@@ -774,6 +1111,13 @@ func jmapEmailToBackend(eml *email.Email, uid uint32, accountID string) backend.
 		e.InReplyTo = eml.InReplyTo[0]
 	}
 	e.References = append(e.References, eml.References...)
+	keywords := make([]string, 0, len(eml.Keywords))
+	for kw, set := range eml.Keywords {
+		if set {
+			keywords = append(keywords, kw)
+		}
+	}
+	e.Labels = backend.LabelsFromKeywords(keywords)
 	return e
 }
 
@@ -1,20 +1,35 @@
 package jmap
 
 import (
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	jmapclient "git.sr.ht/~rockorager/go-jmap"
+	"git.sr.ht/~rockorager/go-jmap/mail/email"
 	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/backend/searchtest"
 )
 
+// condition returns the filter as a single condition, failing the test if
+// it needed operators.
+func condition(t *testing.T, f email.Filter) *email.FilterCondition {
+	t.Helper()
+	cond, ok := f.(*email.FilterCondition)
+	if !ok {
+		t.Fatalf("filter = %#v, want a single condition", f)
+	}
+	return cond
+}
+
 func TestBuildSearchFilter(t *testing.T) {
 	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
 	before := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
-	f := buildSearchFilter(jmapclient.ID("mailbox-id"), backend.SearchQuery{
+	f := condition(t, buildSearchFilter(jmapclient.ID("mailbox-id"), backend.SearchQuery{
 		From: "alice@example.com", To: "bob@example.com", Subject: "invoice",
 		Body: "paid", Since: since, Before: before, LargerThan: 4096,
-	})
+	}))
 
 	if f.InMailbox != "mailbox-id" || f.From != "alice@example.com" || f.To != "bob@example.com" ||
 		f.Subject != "invoice" || f.Body != "paid" || f.MinSize != 4096 {
@@ -24,3 +39,86 @@ func TestBuildSearchFilter(t *testing.T) {
 		t.Fatalf("date filters = after:%v before:%v", f.After, f.Before)
 	}
 }
+
+func TestBuildSearchFilterFlagged(t *testing.T) {
+	yes, no := true, false
+	if f := condition(t, buildSearchFilter("m", backend.SearchQuery{Flagged: &yes})); f.HasKeyword != "$flagged" || f.NotKeyword != "" {
+		t.Fatalf("flagged:yes filter = %+v", f)
+	}
+	if f := condition(t, buildSearchFilter("m", backend.SearchQuery{Flagged: &no})); f.NotKeyword != "$flagged" || f.HasKeyword != "" {
+		t.Fatalf("flagged:no filter = %+v", f)
+	}
+}
+
+func TestBuildSearchFilterOperators(t *testing.T) {
+	f := buildSearchFilter("m", backend.ParseSearchQuery("from:alice OR from:bob"))
+	op, ok := f.(*email.FilterOperator)
+	if !ok || op.Operator != jmapclient.OperatorAND || len(op.Conditions) != 2 {
+		t.Fatalf("filter = %#v, want mailbox AND expression", f)
+	}
+	if cond := condition(t, op.Conditions[0]); cond.InMailbox != "m" {
+		t.Errorf("first condition = %+v, want the mailbox", cond)
+	}
+	if or, ok := op.Conditions[1].(*email.FilterOperator); !ok || or.Operator != jmapclient.OperatorOR {
+		t.Errorf("second condition = %#v, want OR", op.Conditions[1])
+	}
+}
+
+// matchFilter evaluates a JMAP filter against a sample message the way a
+// server would, for the properties buildSearchFilter sets.
+func matchFilter(f email.Filter, m searchtest.Message) bool {
+	if op, ok := f.(*email.FilterOperator); ok {
+		matched := 0
+		for _, c := range op.Conditions {
+			if matchFilter(c, m) {
+				matched++
+			}
+		}
+		switch op.Operator {
+		case jmapclient.OperatorAND:
+			return matched == len(op.Conditions)
+		case jmapclient.OperatorOR:
+			return matched > 0
+		default:
+			return matched == 0
+		}
+	}
+
+	c := f.(*email.FilterCondition)
+	containsFold := func(haystack, needle string) bool {
+		return needle == "" || strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
+	}
+	keywords := map[string]bool{"$seen": m.Read, "$flagged": m.Flagged}
+	switch {
+	case !containsFold(m.From, c.From),
+		!containsFold(strings.Join(m.To, ", "), c.To),
+		!containsFold(strings.Join(m.Cc, ", "), c.Cc),
+		!containsFold(m.Subject, c.Subject),
+		!containsFold(m.Body, c.Body),
+		c.After != nil && m.Date.Before(*c.After),
+		c.Before != nil && !m.Date.Before(*c.Before),
+		c.MinSize > 0 && uint64(m.Size()) < c.MinSize,
+		c.MaxSize > 0 && uint64(m.Size()) >= c.MaxSize,
+		c.HasKeyword != "" && !keywords[c.HasKeyword],
+		c.NotKeyword != "" && keywords[c.NotKeyword],
+		c.HasAttachment && !m.HasAttachment:
+		return false
+	}
+	return true
+}
+
+func TestBuildSearchFilterSharedCases(t *testing.T) {
+	messages := searchtest.Messages()
+	for _, tc := range searchtest.Cases {
+		f := buildSearchFilter("m", backend.ParseSearchQuery(tc.Query))
+		var got []string
+		for _, m := range messages {
+			if matchFilter(f, m) {
+				got = append(got, m.ID)
+			}
+		}
+		if !slices.Equal(got, tc.Want) {
+			t.Errorf("%q matched %v, want %v", tc.Query, got, tc.Want)
+		}
+	}
+}
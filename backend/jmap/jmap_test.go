@@ -1,10 +1,13 @@
 package jmap
 
 import (
+	"strings"
 	"testing"
 
+	jmapclient "git.sr.ht/~rockorager/go-jmap"
 	"git.sr.ht/~rockorager/go-jmap/mail"
 	"git.sr.ht/~rockorager/go-jmap/mail/email"
+	"git.sr.ht/~rockorager/go-jmap/mail/mailbox"
 )
 
 func TestJmapEmailToBackend_ReplyTo(t *testing.T) {
@@ -140,3 +143,49 @@ func TestJmapEmailToBackend_From(t *testing.T) {
 		})
 	}
 }
+
+func TestJmapEmailToBackend_Labels(t *testing.T) {
+	eml := &email.Email{
+		Keywords: map[string]bool{"$seen": true, "$flagged": true, "work": true, "$label1": true, "stale": false},
+	}
+	result := jmapEmailToBackend(eml, 1, "test-account")
+
+	if got := strings.Join(result.Labels, ","); got != "$label1,work" {
+		t.Errorf("Labels = %q, want %q", got, "$label1,work")
+	}
+	if !result.IsRead || !result.IsFlagged {
+		t.Errorf("IsRead=%v IsFlagged=%v, want both true", result.IsRead, result.IsFlagged)
+	}
+}
+
+func TestSplitMailboxPath(t *testing.T) {
+	tests := []struct {
+		name, wantParent, wantLeaf string
+	}{
+		{"Projects", "", "Projects"},
+		{"Projects/2024", "Projects", "2024"},
+		{"Work/Projects/2024", "Projects", "2024"},
+	}
+	for _, tt := range tests {
+		parent, leaf := splitMailboxPath(tt.name)
+		if parent != tt.wantParent || leaf != tt.wantLeaf {
+			t.Errorf("splitMailboxPath(%q) = %q, %q; want %q, %q", tt.name, parent, leaf, tt.wantParent, tt.wantLeaf)
+		}
+	}
+}
+
+func TestMailboxSetError(t *testing.T) {
+	if err := mailboxSetError(&mailbox.SetResponse{}); err != nil {
+		t.Fatalf("empty response: got %v, want nil", err)
+	}
+
+	desc := "mailbox has child mailboxes"
+	err := mailboxSetError(&mailbox.SetResponse{
+		NotDestroyed: map[jmapclient.ID]*jmapclient.SetError{
+			"m1": {Type: "mailboxHasChild", Description: &desc},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "mailboxHasChild") || !strings.Contains(err.Error(), desc) {
+		t.Fatalf("got %v, want mailboxHasChild error with description", err)
+	}
+}
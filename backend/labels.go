@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// systemKeywords are IMAP/JMAP keywords with protocol-defined meaning. They
+// are tracked by dedicated Email fields or not surfaced at all, so they are
+// never shown as user labels.
+var systemKeywords = map[string]bool{
+	"$seen":          true,
+	"$flagged":       true,
+	"$answered":      true,
+	"$draft":         true,
+	"$forwarded":     true,
+	"$mdnsent":       true,
+	"$junk":          true,
+	"$notjunk":       true,
+	"$phishing":      true,
+	"$submitpending": true,
+	"$submitted":     true,
+	"junk":           true,
+	"nonjunk":        true,
+	"notjunk":        true,
+}
+
+// LabelsFromKeywords returns the user labels among a message's keywords,
+// dropping IMAP system flags ("\Seen") and well-known $-keywords. The result
+// is sorted for stable display.
+func LabelsFromKeywords(keywords []string) []string {
+	var labels []string
+	for _, kw := range keywords {
+		if kw == "" || strings.HasPrefix(kw, `\`) || systemKeywords[strings.ToLower(kw)] {
+			continue
+		}
+		labels = append(labels, kw)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// CheckLabel reports whether label can be stored as a keyword. IMAP and JMAP
+// keywords are printable ASCII atoms, so whitespace, non-ASCII characters and
+// the atom specials are rejected.
+func CheckLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("label is empty")
+	}
+	if strings.HasPrefix(label, `\`) {
+		return fmt.Errorf("label %q: system flags cannot be used as labels", label)
+	}
+	if systemKeywords[strings.ToLower(label)] {
+		return fmt.Errorf("label %q is reserved", label)
+	}
+	for _, r := range label {
+		if r <= ' ' || r > '~' || strings.ContainsRune(`(){%*"\]`, r) {
+			return fmt.Errorf("label %q: invalid character %q", label, r)
+		}
+	}
+	return nil
+}
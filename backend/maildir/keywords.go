@@ -0,0 +1,193 @@
+package maildir
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	emaildir "github.com/emersion/go-maildir"
+
+	"github.com/floatpane/matcha/backend"
+)
+
+// Labels are stored the way Dovecot stores IMAP keywords: each folder has a
+// dovecot-keywords file numbering its keywords, and keyword N is set on a
+// message by the lowercase info flag 'a'+N. That caps a folder at 26
+// keywords.
+const (
+	keywordsFile = "dovecot-keywords"
+	maxKeywords  = 26
+)
+
+// readKeywords loads the keyword table of a folder. A missing file yields an
+// empty table. Unused slots are left as "".
+func readKeywords(dir emaildir.Dir) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(string(dir), keywordsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keywords []string
+	for _, line := range strings.Split(string(data), "\n") {
+		idxStr, name, ok := strings.Cut(strings.TrimSpace(line), " ")
+		idx, err := strconv.Atoi(idxStr)
+		if !ok || err != nil || idx < 0 || idx >= maxKeywords || name == "" {
+			continue
+		}
+		for len(keywords) <= idx {
+			keywords = append(keywords, "")
+		}
+		keywords[idx] = name
+	}
+	return keywords, nil
+}
+
+// writeKeywords atomically replaces the keyword table of a folder.
+func writeKeywords(dir emaildir.Dir, keywords []string) error {
+	var b strings.Builder
+	for i, kw := range keywords {
+		if kw != "" {
+			fmt.Fprintf(&b, "%d %s\n", i, kw)
+		}
+	}
+
+	path := filepath.Join(string(dir), keywordsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// keywordIndex returns the slot of label in keywords, or -1. Keywords are
+// case-insensitive, as in IMAP.
+func keywordIndex(keywords []string, label string) int {
+	for i, kw := range keywords {
+		if kw != "" && strings.EqualFold(kw, label) {
+			return i
+		}
+	}
+	return -1
+}
+
+// assignKeyword returns the slot of label, adding it to the table (and
+// reporting the table as changed) when it is new.
+func assignKeyword(keywords []string, label string) ([]string, int, bool, error) {
+	if idx := keywordIndex(keywords, label); idx >= 0 {
+		return keywords, idx, false, nil
+	}
+	for i, kw := range keywords {
+		if kw == "" {
+			keywords[i] = label
+			return keywords, i, true, nil
+		}
+	}
+	if len(keywords) >= maxKeywords {
+		return keywords, -1, false, fmt.Errorf("maildir: folder already has %d keywords", maxKeywords)
+	}
+	return append(keywords, label), len(keywords), true, nil
+}
+
+func keywordFlag(idx int) emaildir.Flag {
+	return emaildir.Flag('a' + idx)
+}
+
+// flagKeyword returns the slot encoded by a lowercase info flag.
+func flagKeyword(fl emaildir.Flag) (int, bool) {
+	if fl < 'a' || fl > 'z' {
+		return 0, false
+	}
+	return int(fl - 'a'), true
+}
+
+func hasKeywordFlags(flags []emaildir.Flag) bool {
+	for _, fl := range flags {
+		if _, ok := flagKeyword(fl); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AddLabel records the label in the folder's keyword table and sets its
+// flag on the message.
+func (p *Provider) AddLabel(_ context.Context, folder string, uid uint32, label string) error {
+	if err := backend.CheckLabel(label); err != nil {
+		return err
+	}
+	dir := p.dirForFolder(folder)
+	keywords, err := readKeywords(dir)
+	if err != nil {
+		return err
+	}
+	keywords, idx, changed, err := assignKeyword(keywords, label)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := writeKeywords(dir, keywords); err != nil {
+			return err
+		}
+	}
+	return p.addFlag(folder, uid, keywordFlag(idx))
+}
+
+// RemoveLabel clears the label's flag on the message. The keyword table is
+// left alone since other messages may still use the slot.
+func (p *Provider) RemoveLabel(_ context.Context, folder string, uid uint32, label string) error {
+	if err := backend.CheckLabel(label); err != nil {
+		return err
+	}
+	keywords, err := readKeywords(p.dirForFolder(folder))
+	if err != nil {
+		return err
+	}
+	idx := keywordIndex(keywords, label)
+	if idx < 0 {
+		return nil
+	}
+	return p.removeFlag(folder, uid, keywordFlag(idx))
+}
+
+// remapKeywordFlags rewrites a message's keyword flags from the src folder's
+// table to the dst folder's, so labels survive a move. Keywords that no
+// longer fit in dst are dropped.
+func remapKeywordFlags(flags []emaildir.Flag, src []string, dst emaildir.Dir) ([]emaildir.Flag, error) {
+	dstKeywords, err := readKeywords(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	remapped := make([]emaildir.Flag, 0, len(flags))
+	changed := false
+	for _, fl := range flags {
+		idx, ok := flagKeyword(fl)
+		if !ok {
+			remapped = append(remapped, fl)
+			continue
+		}
+		if idx >= len(src) || src[idx] == "" {
+			continue
+		}
+		var added bool
+		var dstIdx int
+		dstKeywords, dstIdx, added, err = assignKeyword(dstKeywords, src[idx])
+		if err != nil {
+			continue
+		}
+		changed = changed || added
+		remapped = append(remapped, keywordFlag(dstIdx))
+	}
+	if changed {
+		if err := writeKeywords(dst, dstKeywords); err != nil {
+			return nil, err
+		}
+	}
+	return remapped, nil
+}
@@ -1,6 +1,7 @@
 // Package maildir implements the backend.Provider interface for local
-// Maildir mailboxes (the `mutt -f Maildir` style). It is read/edit only —
-// there is no SMTP transport, so SendEmail returns ErrNotSupported.
+// Maildir mailboxes (the `mutt -f Maildir` style). Mail is sent through the
+// account's SMTP settings or its sendmail command, and a copy is kept in the
+// Sent folder.
 //
 // Folder layout follows Maildir++:
 //   - The configured root path is "INBOX".
@@ -13,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/mail"
 	"os"
@@ -28,9 +30,13 @@ import (
 
 	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/sender"
 )
 
-const inboxFolder = "INBOX"
+const (
+	inboxFolder = "INBOX"
+	sentFolder  = "Sent"
+)
 
 var messageIDRE = regexp.MustCompile(`<[^>]+>`)
 
@@ -167,6 +173,134 @@ func (p *Provider) FetchFolders(_ context.Context) ([]backend.Folder, error) {
 	return folders, nil
 }
 
+// checkFolderName rejects names that cannot be managed as a folder: INBOX,
+// empty, relative or backslashed path segments, and, under Maildir++,
+// segments containing the "." hierarchy separator.
+func (p *Provider) checkFolderName(name string) error {
+	if strings.EqualFold(name, inboxFolder) {
+		return fmt.Errorf("maildir: cannot modify %s", inboxFolder)
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || strings.Contains(seg, `\`) || seg == "." || seg == ".." || (!p.nested && strings.Contains(seg, ".")) {
+			return fmt.Errorf("maildir: invalid folder name %q", name)
+		}
+	}
+	return nil
+}
+
+// CreateFolder creates a new Maildir folder with empty cur/new/tmp.
+func (p *Provider) CreateFolder(_ context.Context, name string) error {
+	if err := p.checkFolderName(name); err != nil {
+		return err
+	}
+	dir := p.dirForFolder(name)
+	if _, err := os.Stat(string(dir)); err == nil {
+		return fmt.Errorf("maildir: folder %q already exists", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(string(dir)), 0700); err != nil {
+		return fmt.Errorf("maildir create %q: %w", name, err)
+	}
+	if err := dir.Init(); err != nil {
+		return fmt.Errorf("maildir create %q: %w", name, err)
+	}
+	return nil
+}
+
+// RenameFolder renames a folder on disk. Subfolders move with it: under the
+// nested layout they live inside the folder's directory, under Maildir++
+// their ".Old.Child" siblings are renamed to match.
+func (p *Provider) RenameFolder(_ context.Context, oldName, newName string) error {
+	if err := p.checkFolderName(oldName); err != nil {
+		return err
+	}
+	if err := p.checkFolderName(newName); err != nil {
+		return err
+	}
+	oldDir, newDir := string(p.dirForFolder(oldName)), string(p.dirForFolder(newName))
+	if _, err := os.Stat(oldDir); err != nil {
+		return fmt.Errorf("maildir: folder %q not found", oldName)
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("maildir: folder %q already exists", newName)
+	}
+	if err := os.MkdirAll(filepath.Dir(newDir), 0700); err != nil {
+		return fmt.Errorf("maildir rename %q: %w", oldName, err)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return fmt.Errorf("maildir rename %q: %w", oldName, err)
+	}
+	if p.nested {
+		return nil
+	}
+
+	children, err := p.plusChildren(oldDir)
+	if err != nil {
+		return err
+	}
+	oldPrefix := filepath.Base(oldDir) + "."
+	newPrefix := filepath.Base(newDir) + "."
+	for _, name := range children {
+		child := newPrefix + strings.TrimPrefix(name, oldPrefix)
+		if err := os.Rename(filepath.Join(p.root, name), filepath.Join(p.root, child)); err != nil {
+			return fmt.Errorf("maildir rename %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// plusChildren returns the names of the Maildir++ directories of the
+// subfolders of the folder in dir: the ".Name.Child" siblings of its
+// ".Name" directory.
+func (p *Provider) plusChildren(dir string) ([]string, error) {
+	entries, err := os.ReadDir(p.root)
+	if err != nil {
+		return nil, fmt.Errorf("maildir read root: %w", err)
+	}
+	prefix := filepath.Base(dir) + "."
+	var children []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			children = append(children, entry.Name())
+		}
+	}
+	return children, nil
+}
+
+// DeleteFolder removes a folder, its subfolders and every message in them.
+// Under the nested layout the subfolders live inside the folder's directory;
+// under Maildir++ its ".Name.Child" siblings are removed as well.
+func (p *Provider) DeleteFolder(_ context.Context, name string) error {
+	if err := p.checkFolderName(name); err != nil {
+		return err
+	}
+	dir := string(p.dirForFolder(name))
+	if _, err := os.Stat(filepath.Join(dir, "cur")); err != nil {
+		return fmt.Errorf("maildir: folder %q not found", name)
+	}
+	if !p.nested {
+		children, err := p.plusChildren(dir)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := os.RemoveAll(filepath.Join(p.root, child)); err != nil {
+				return fmt.Errorf("maildir delete %q: %w", child, err)
+			}
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+// SubscribeFolder is not supported: every Maildir folder on disk is listed.
+func (p *Provider) SubscribeFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// UnsubscribeFolder is not supported: every Maildir folder on disk is listed.
+func (p *Provider) UnsubscribeFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
 // FetchEmails returns messages from the folder, newest first. Any messages
 // sitting in new/ are first promoted to cur/ (same semantics as mutt opening
 // a Maildir): they remain unread (no Seen flag) but become trackable.
@@ -205,9 +339,14 @@ func (p *Provider) FetchEmails(_ context.Context, folder string, limit, offset u
 	}
 	entries = entries[offset:end]
 
+	keywords, err := readKeywords(dir)
+	if err != nil {
+		return nil, fmt.Errorf("maildir keywords: %w", err)
+	}
+
 	emails := make([]backend.Email, 0, len(entries))
 	for _, e := range entries {
-		email, err := p.readHeader(e.msg)
+		email, err := p.readHeader(e.msg, keywords)
 		if err != nil {
 			continue
 		}
@@ -217,7 +356,8 @@ func (p *Provider) FetchEmails(_ context.Context, folder string, limit, offset u
 }
 
 // readHeader opens the message file and parses just enough to fill an Email.
-func (p *Provider) readHeader(msg *emaildir.Message) (backend.Email, error) {
+// keywords is the folder's keyword table, used to resolve labels.
+func (p *Provider) readHeader(msg *emaildir.Message, keywords []string) (backend.Email, error) {
 	rc, err := msg.Open()
 	if err != nil {
 		return backend.Email{}, err
@@ -231,14 +371,28 @@ func (p *Provider) readHeader(msg *emaildir.Message) (backend.Email, error) {
 
 	email := headerToEmail(&entity.Header, msg.Key(), p.account.ID)
 
-	for _, fl := range msg.Flags() {
-		if fl == emaildir.FlagSeen {
+	applyFlags(&email, msg.Flags(), keywords)
+
+	return email, nil
+}
+
+// applyFlags copies the Maildir info flags onto the email, resolving keyword
+// flags to labels through the folder's keyword table.
+func applyFlags(email *backend.Email, flags []emaildir.Flag, keywords []string) {
+	var labels []string
+	for _, fl := range flags {
+		switch fl {
+		case emaildir.FlagSeen:
 			email.IsRead = true
-			break
+		case emaildir.FlagFlagged:
+			email.IsFlagged = true
+		default:
+			if idx, ok := flagKeyword(fl); ok && idx < len(keywords) && keywords[idx] != "" {
+				labels = append(labels, keywords[idx])
+			}
 		}
 	}
-
-	return email, nil
+	email.Labels = backend.LabelsFromKeywords(labels)
 }
 
 // FetchEmailBody returns the chosen body, MIME type, and attachments.
@@ -273,21 +427,39 @@ func (p *Provider) FetchAttachment(_ context.Context, folder string, uid uint32,
 
 // MarkAsRead sets the Seen flag while preserving the others.
 func (p *Provider) MarkAsRead(_ context.Context, folder string, uid uint32) error {
+	return p.addFlag(folder, uid, emaildir.FlagSeen)
+}
+
+// MarkAsUnread removes the Seen flag while preserving the others.
+func (p *Provider) MarkAsUnread(_ context.Context, folder string, uid uint32) error {
+	return p.removeFlag(folder, uid, emaildir.FlagSeen)
+}
+
+// MarkFlagged sets the Flagged ("F") flag while preserving the others.
+func (p *Provider) MarkFlagged(_ context.Context, folder string, uid uint32) error {
+	return p.addFlag(folder, uid, emaildir.FlagFlagged)
+}
+
+// MarkUnflagged removes the Flagged flag while preserving the others.
+func (p *Provider) MarkUnflagged(_ context.Context, folder string, uid uint32) error {
+	return p.removeFlag(folder, uid, emaildir.FlagFlagged)
+}
+
+func (p *Provider) addFlag(folder string, uid uint32, flag emaildir.Flag) error {
 	msg, err := p.findMessageByUID(folder, uid)
 	if err != nil {
 		return err
 	}
 	flags := msg.Flags()
 	for _, fl := range flags {
-		if fl == emaildir.FlagSeen {
+		if fl == flag {
 			return nil
 		}
 	}
-	return msg.SetFlags(append(flags, emaildir.FlagSeen))
+	return msg.SetFlags(append(flags, flag))
 }
 
-// MarkAsUnread removes the Seen flag while preserving the others.
-func (p *Provider) MarkAsUnread(_ context.Context, folder string, uid uint32) error {
+func (p *Provider) removeFlag(folder string, uid uint32, flag emaildir.Flag) error {
 	msg, err := p.findMessageByUID(folder, uid)
 	if err != nil {
 		return err
@@ -295,12 +467,12 @@ func (p *Provider) MarkAsUnread(_ context.Context, folder string, uid uint32) er
 	flags := msg.Flags()
 	filtered := flags[:0]
 	for _, fl := range flags {
-		if fl != emaildir.FlagSeen {
+		if fl != flag {
 			filtered = append(filtered, fl)
 		}
 	}
 	if len(filtered) == len(flags) {
-		return nil // already unread
+		return nil // flag not set
 	}
 	return msg.SetFlags(filtered)
 }
@@ -322,13 +494,27 @@ func (p *Provider) ArchiveEmail(ctx context.Context, folder string, uid uint32)
 	return p.MoveEmail(ctx, uid, folder, "Archive")
 }
 
-// MoveEmail relocates a message between two Maildir folders.
+// MoveEmail relocates a message between two Maildir folders. Keyword flags
+// are renumbered for the destination folder's keyword table first.
 func (p *Provider) MoveEmail(_ context.Context, uid uint32, srcFolder, dstFolder string) error {
 	msg, err := p.findMessageByUID(srcFolder, uid)
 	if err != nil {
 		return err
 	}
 	dst := p.dirForFolder(dstFolder)
+	if hasKeywordFlags(msg.Flags()) {
+		keywords, err := readKeywords(p.dirForFolder(srcFolder))
+		if err != nil {
+			return err
+		}
+		flags, err := remapKeywordFlags(msg.Flags(), keywords, dst)
+		if err != nil {
+			return err
+		}
+		if err := msg.SetFlags(flags); err != nil {
+			return err
+		}
+	}
 	return msg.MoveTo(dst)
 }
 
@@ -365,9 +551,55 @@ func (p *Provider) MoveEmails(ctx context.Context, uids []uint32, srcFolder, dst
 	return nil
 }
 
-// SendEmail is not supported by the Maildir backend.
-func (p *Provider) SendEmail(_ context.Context, _ *backend.OutgoingEmail) error {
-	return backend.ErrNotSupported
+// SendEmail sends through the account's sendmail command or SMTP server and
+// saves a copy in the Sent folder. A failed copy is logged, since the message
+// has already left.
+func (p *Provider) SendEmail(ctx context.Context, msg *backend.OutgoingEmail) error {
+	if !p.canSend() {
+		return backend.ErrNotSupported
+	}
+	rawMsg, err := sender.SendEmail(
+		p.account, msg.To, msg.Cc, msg.Bcc,
+		msg.Subject, msg.PlainBody, msg.HTMLBody,
+		msg.Images, msg.Attachments,
+		msg.InReplyTo, msg.References,
+		msg.SignSMIME, msg.EncryptSMIME,
+		msg.SignPGP, msg.EncryptPGP,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := p.SaveSent(ctx, rawMsg); err != nil {
+		log.Printf("Failed to save sent message to Sent folder: %v", err)
+	}
+	return nil
+}
+
+// SaveSent writes raw into the Sent folder (".Sent" under Maildir++, "Sent"
+// under nested) with the Seen flag, creating the folder if needed.
+func (p *Provider) SaveSent(_ context.Context, raw []byte) error {
+	dir := p.dirForFolder(sentFolder)
+	if err := dir.Init(); err != nil {
+		return fmt.Errorf("maildir create %q: %w", sentFolder, err)
+	}
+	_, w, err := dir.Create([]emaildir.Flag{emaildir.FlagSeen})
+	if err != nil {
+		return fmt.Errorf("maildir save sent: %w", err)
+	}
+	if _, err := w.Write(raw); err != nil {
+		w.Close() //nolint:errcheck,gosec
+		return fmt.Errorf("maildir save sent: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("maildir save sent: %w", err)
+	}
+	return nil
+}
+
+// canSend reports whether the account has a transport to send with.
+func (p *Provider) canSend() bool {
+	return p.account.SendmailCommand != "" || p.account.GetSMTPServer() != ""
 }
 
 // Search filters messages in a folder by the given query, parsing headers
@@ -382,16 +614,22 @@ func (p *Provider) Search(_ context.Context, folder string, query backend.Search
 		return nil, fmt.Errorf("maildir messages: %w", err)
 	}
 
+	keywords, err := readKeywords(dir)
+	if err != nil {
+		return nil, fmt.Errorf("maildir keywords: %w", err)
+	}
+
+	expr := query.Expression()
 	results := make([]backend.Email, 0)
 	for _, m := range msgs {
 		if query.Limit > 0 && uint32(len(results)) >= query.Limit {
 			break
 		}
-		email, body, err := p.matchOpen(m)
+		email, candidate, err := p.matchOpen(m, keywords)
 		if err != nil {
 			continue
 		}
-		if !matchesQuery(email, body, query) {
+		if !matchesQuery(candidate, expr) {
 			continue
 		}
 		results = append(results, email)
@@ -399,79 +637,120 @@ func (p *Provider) Search(_ context.Context, folder string, query backend.Search
 	return results, nil
 }
 
-// matchOpen returns the email metadata and a plain-text body slice for search.
-func (p *Provider) matchOpen(msg *emaildir.Message) (backend.Email, string, error) {
+// searchCandidate is what a search term can test about a message.
+type searchCandidate struct {
+	email         backend.Email
+	cc            []string
+	body          string
+	size          int
+	hasAttachment bool
+}
+
+// matchOpen returns the email metadata and what search needs to know about
+// the message.
+func (p *Provider) matchOpen(msg *emaildir.Message, keywords []string) (backend.Email, searchCandidate, error) {
 	rc, err := msg.Open()
 	if err != nil {
-		return backend.Email{}, "", err
+		return backend.Email{}, searchCandidate{}, err
 	}
 	defer rc.Close() //nolint:errcheck
 
 	entity, err := message.Read(rc)
 	if err != nil && entity == nil {
-		return backend.Email{}, "", err
+		return backend.Email{}, searchCandidate{}, err
 	}
 	email := headerToEmail(&entity.Header, msg.Key(), p.account.ID)
 
-	for _, fl := range msg.Flags() {
-		if fl == emaildir.FlagSeen {
-			email.IsRead = true
-			break
+	applyFlags(&email, msg.Flags(), keywords)
+
+	c := searchCandidate{email: email}
+	if ccHeader := entity.Header.Get("Cc"); ccHeader != "" {
+		if addrs, err := mail.ParseAddressList(ccHeader); err == nil {
+			for _, addr := range addrs {
+				c.cc = append(c.cc, addr.Address)
+			}
 		}
 	}
-
+	// Mail with attachments is sent as multipart/mixed.
+	if mediaType, _, err := entity.Header.ContentType(); err == nil {
+		c.hasAttachment = mediaType == "multipart/mixed"
+	}
+	if info, err := os.Stat(msg.Filename()); err == nil {
+		c.size = int(info.Size())
+	}
 	// Lightweight body read: only needed if query asks for it.
-	var body string
 	if b, err := io.ReadAll(entity.Body); err == nil {
-		body = string(b)
+		c.body = string(b)
 	}
 
-	return email, body, nil
+	return email, c, nil
 }
 
-// matchesQuery applies the parsed search filters to an email + body.
-func matchesQuery(email backend.Email, body string, query backend.SearchQuery) bool {
-	containsCI := func(haystack, needle string) bool {
-		if needle == "" {
-			return true
-		}
-		return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
-	}
-	if !containsCI(email.From, query.From) {
-		return false
-	}
-	if query.To != "" {
-		match := false
-		for _, addr := range email.To {
-			if containsCI(addr, query.To) {
-				match = true
-				break
+// matchesQuery evaluates a parsed search expression against a message. A
+// nil expression matches everything.
+func matchesQuery(c searchCandidate, e *backend.SearchExpr) bool {
+	if e == nil {
+		return true
+	}
+	switch e.Op {
+	case backend.SearchAnd:
+		for _, child := range e.Children {
+			if !matchesQuery(c, child) {
+				return false
 			}
 		}
-		if !match {
-			return false
+		return true
+	case backend.SearchOr:
+		for _, child := range e.Children {
+			if matchesQuery(c, child) {
+				return true
+			}
 		}
-	}
-	if !containsCI(email.Subject, query.Subject) {
 		return false
+	case backend.SearchNot:
+		return !matchesQuery(c, e.Children[0])
 	}
-	if !containsCI(body, query.Body) {
-		return false
+
+	containsCI := func(haystack string) bool {
+		return strings.Contains(strings.ToLower(haystack), strings.ToLower(e.Text))
 	}
-	if !query.Since.IsZero() && email.Date.Before(query.Since) {
+	anyCI := func(addrs []string) bool {
+		for _, addr := range addrs {
+			if containsCI(addr) {
+				return true
+			}
+		}
 		return false
 	}
-	if !query.Before.IsZero() && email.Date.After(query.Before) {
-		return false
+	switch e.Field {
+	case backend.SearchFrom:
+		return containsCI(c.email.From)
+	case backend.SearchTo:
+		return anyCI(c.email.To)
+	case backend.SearchCc:
+		return anyCI(c.cc)
+	case backend.SearchSubject:
+		return containsCI(c.email.Subject)
+	case backend.SearchBody:
+		return containsCI(c.body)
+	case backend.SearchSince:
+		return !c.email.Date.Before(e.Time)
+	case backend.SearchBefore:
+		return c.email.Date.Before(e.Time)
+	case backend.SearchLarger:
+		return c.size > e.Size
+	case backend.SearchSmaller:
+		return c.size < e.Size
+	case backend.SearchFlagged:
+		return c.email.IsFlagged == e.Bool
+	case backend.SearchRead:
+		return c.email.IsRead == e.Bool
+	case backend.SearchAttachment:
+		return c.hasAttachment == e.Bool
 	}
 	return true
 }
 
-// Watch is not supported. Future: fsnotify on new/ to emit NotifyNewEmail.
-func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEvent, func(), error) {
-	return nil, nil, backend.ErrNotSupported
-}
-
 // Close releases any provider-held resources. None for Maildir.
 func (p *Provider) Close() error { return nil }
 
@@ -479,10 +758,10 @@ func (p *Provider) Close() error { return nil }
 func (p *Provider) Capabilities() backend.Capabilities {
 	_, hasArchive := os.Stat(filepath.Join(p.archiveDir(), "cur"))
 	return backend.Capabilities{
-		CanSend:         false,
+		CanSend:         p.canSend(),
 		CanMove:         true,
 		CanArchive:      hasArchive == nil,
-		CanPush:         false,
+		CanPush:         true,
 		CanSearchServer: true,
 		CanFetchFolders: true,
 		SupportsSMIME:   false,
@@ -683,4 +962,7 @@ func findAttachmentData(r io.Reader, targetPartID string) ([]byte, error) {
 }
 
 // Verify interface compliance at compile time.
-var _ backend.Provider = (*Provider)(nil)
+var (
+	_ backend.Provider  = (*Provider)(nil)
+	_ backend.SentSaver = (*Provider)(nil)
+)
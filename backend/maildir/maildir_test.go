@@ -7,11 +7,13 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/backend/searchtest"
 	"github.com/floatpane/matcha/config"
 )
 
@@ -252,6 +254,49 @@ func TestSendEmailNotSupported(t *testing.T) {
 	}
 }
 
+func TestSendEmailSavesSentCopy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sendmail command needs sh")
+	}
+	root := makeMaildir(t)
+	out := filepath.Join(t.TempDir(), "sent")
+	script := filepath.Join(t.TempDir(), "sendmail")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat > "+out+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(&config.Account{ID: "acct1", Email: "me@local", MaildirPath: root, SendmailCommand: script})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !p.Capabilities().CanSend {
+		t.Error("CanSend = false with a sendmail command")
+	}
+
+	err = p.SendEmail(context.Background(), &backend.OutgoingEmail{
+		To:        []string{"bob@example.com"},
+		Subject:   "hello",
+		PlainBody: "hi bob",
+	})
+	if err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Fatalf("sendmail command did not run: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, ".Sent", "cur"))
+	if err != nil {
+		t.Fatalf("read .Sent/cur: %v", err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), seenSuffix()) {
+		t.Fatalf(".Sent/cur = %v, want one message flagged S", entries)
+	}
+	emails, err := p.FetchEmails(context.Background(), "Sent", 10, 0)
+	if err != nil || len(emails) != 1 || emails[0].Subject != "hello" || !emails[0].IsRead {
+		t.Errorf("FetchEmails(Sent) = %+v, %v", emails, err)
+	}
+}
+
 func TestSearchFiltersBySubject(t *testing.T) {
 	root := makeMaildir(t)
 	t0 := time.Now()
@@ -268,6 +313,65 @@ func TestSearchFiltersBySubject(t *testing.T) {
 	}
 }
 
+// storeSample writes a searchtest message into cur/ with its flags.
+func storeSample(t *testing.T, root string, m searchtest.Message) {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\n", m.From, strings.Join(m.To, ", "))
+	if len(m.Cc) > 0 {
+		fmt.Fprintf(&b, "Cc: %s\r\n", strings.Join(m.Cc, ", "))
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\nDate: %s\r\nMessage-ID: <%s@local>\r\n", m.Subject, m.Date.Format(time.RFC1123Z), m.ID)
+	if m.HasAttachment {
+		b.WriteString("Content-Type: multipart/mixed; boundary=sep\r\n\r\n")
+		fmt.Fprintf(&b, "--sep\r\nContent-Type: text/plain\r\n\r\n%s\r\n", m.Body)
+		b.WriteString("--sep\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\nJVBERi0=\r\n--sep--\r\n")
+	} else {
+		fmt.Fprintf(&b, "Content-Type: text/plain\r\n\r\n%s\r\n", m.Body)
+	}
+
+	flags := ""
+	if m.Flagged {
+		flags += "F"
+	}
+	if m.Read {
+		flags += "S"
+	}
+	name := m.ID + strings.TrimSuffix(seenSuffix(), "S") + flags
+	if err := os.WriteFile(filepath.Join(root, "cur", name), []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+}
+
+func TestSearchSharedCases(t *testing.T) {
+	root := makeMaildir(t)
+	messages := searchtest.Messages()
+	for _, m := range messages {
+		storeSample(t, root, m)
+	}
+	p := newProvider(t, root)
+
+	for _, tc := range searchtest.Cases {
+		results, err := p.Search(context.Background(), "INBOX", backend.ParseSearchQuery(tc.Query))
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tc.Query, err)
+		}
+		matched := make(map[string]bool)
+		for _, r := range results {
+			matched[r.Subject] = true
+		}
+		var got []string
+		for _, m := range messages {
+			if matched[m.Subject] {
+				got = append(got, m.ID)
+			}
+		}
+		if !slices.Equal(got, tc.Want) {
+			t.Errorf("%q matched %v, want %v", tc.Query, got, tc.Want)
+		}
+	}
+}
+
 func TestCapabilitiesReflectsArchivePresence(t *testing.T) {
 	root := makeMaildir(t)
 	pNoArchive := newProvider(t, root)
@@ -343,3 +447,181 @@ func TestNestedLayoutListsFoldersAndFetchesInbox(t *testing.T) {
 		t.Error("CanArchive should be true when Archive subfolder exists in nested layout")
 	}
 }
+
+func TestCreateRenameDeleteFolder(t *testing.T) {
+	root := makeMaildir(t)
+	p := newProvider(t, root)
+	ctx := context.Background()
+
+	if err := p.CreateFolder(ctx, "Projects"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if err := p.CreateFolder(ctx, "Projects/2024"); err != nil {
+		t.Fatalf("CreateFolder child: %v", err)
+	}
+	if err := p.CreateFolder(ctx, "Projects"); err == nil {
+		t.Error("CreateFolder on an existing folder: want error")
+	}
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if _, err := os.Stat(filepath.Join(root, ".Projects.2024", sub)); err != nil {
+			t.Errorf("missing %s in new child folder: %v", sub, err)
+		}
+	}
+
+	if err := p.RenameFolder(ctx, "Projects", "Work"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	folders, err := p.FetchFolders(ctx)
+	if err != nil {
+		t.Fatalf("FetchFolders: %v", err)
+	}
+	var names []string
+	for _, f := range folders {
+		names = append(names, f.Name)
+	}
+	got := strings.Join(names, ",")
+	if got != "INBOX,Work,Work/2024" {
+		t.Errorf("folders after rename = %s, want INBOX,Work,Work/2024", got)
+	}
+
+	if err := p.DeleteFolder(ctx, "Work/2024"); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".Work.2024")); !os.IsNotExist(err) {
+		t.Errorf("deleted folder still on disk: %v", err)
+	}
+}
+
+func TestDeleteFolderRemovesMaildirPlusSubfolders(t *testing.T) {
+	root := makeMaildir(t)
+	p := newProvider(t, root)
+	ctx := context.Background()
+
+	for _, name := range []string{"Work", "Work/2024", "Work/2024/Q1", "Workshop"} {
+		if err := p.CreateFolder(ctx, name); err != nil {
+			t.Fatalf("CreateFolder %s: %v", name, err)
+		}
+	}
+	if err := p.DeleteFolder(ctx, "Work"); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	for _, dir := range []string{".Work", ".Work.2024", ".Work.2024.Q1"} {
+		if _, err := os.Stat(filepath.Join(root, dir)); !os.IsNotExist(err) {
+			t.Errorf("%s still on disk: %v", dir, err)
+		}
+	}
+
+	folders, err := p.FetchFolders(ctx)
+	if err != nil {
+		t.Fatalf("FetchFolders: %v", err)
+	}
+	var names []string
+	for _, f := range folders {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "INBOX,Workshop" {
+		t.Errorf("folders after delete = %s, want INBOX,Workshop", got)
+	}
+}
+
+func TestFolderManagementRejectsInvalidNames(t *testing.T) {
+	root := makeMaildir(t)
+	p := newProvider(t, root)
+	ctx := context.Background()
+
+	for _, name := range []string{"INBOX", "", "../escape", "a//b", "dotted.name"} {
+		if err := p.CreateFolder(ctx, name); err == nil {
+			t.Errorf("CreateFolder(%q): want error", name)
+		}
+	}
+	if err := p.DeleteFolder(ctx, "INBOX"); err == nil {
+		t.Error("DeleteFolder(INBOX): want error")
+	}
+	if err := p.SubscribeFolder(ctx, "Sent"); !errors.Is(err, backend.ErrNotSupported) {
+		t.Errorf("SubscribeFolder: want ErrNotSupported, got %v", err)
+	}
+}
+
+func TestMarkFlaggedTogglesFlag(t *testing.T) {
+	root := makeMaildir(t)
+	dropMessage(t, root, "1700000000.f.host", "subj", "body", time.Now())
+
+	p := newProvider(t, root)
+	ctx := context.Background()
+	emails, err := p.FetchEmails(ctx, "INBOX", 10, 0)
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("FetchEmails setup: %v / %d", err, len(emails))
+	}
+	uid := emails[0].UID
+
+	if err := p.MarkAsRead(ctx, "INBOX", uid); err != nil {
+		t.Fatalf("MarkAsRead: %v", err)
+	}
+	if err := p.MarkFlagged(ctx, "INBOX", uid); err != nil {
+		t.Fatalf("MarkFlagged: %v", err)
+	}
+	emails, _ = p.FetchEmails(ctx, "INBOX", 10, 0)
+	if !emails[0].IsFlagged || !emails[0].IsRead {
+		t.Errorf("after MarkFlagged: IsFlagged=%v IsRead=%v, want both true", emails[0].IsFlagged, emails[0].IsRead)
+	}
+
+	flagged := true
+	hits, err := p.Search(ctx, "INBOX", backend.SearchQuery{Flagged: &flagged})
+	if err != nil || len(hits) != 1 {
+		t.Errorf("Search flagged:yes = %d hits, err %v; want 1", len(hits), err)
+	}
+
+	if err := p.MarkUnflagged(ctx, "INBOX", uid); err != nil {
+		t.Fatalf("MarkUnflagged: %v", err)
+	}
+	emails, _ = p.FetchEmails(ctx, "INBOX", 10, 0)
+	if emails[0].IsFlagged || !emails[0].IsRead {
+		t.Errorf("after MarkUnflagged: IsFlagged=%v IsRead=%v, want false/true", emails[0].IsFlagged, emails[0].IsRead)
+	}
+}
+
+func TestLabelsUseDovecotKeywords(t *testing.T) {
+	root := makeMaildir(t, ".Archive")
+	dropMessage(t, root, "1700000000.l.host", "subj", "body", time.Now())
+	// Pre-existing table: slot 0 is taken by another client's keyword.
+	if err := os.WriteFile(filepath.Join(root, "dovecot-keywords"), []byte("0 $Forwarded\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newProvider(t, root)
+	ctx := context.Background()
+	emails, err := p.FetchEmails(ctx, "INBOX", 10, 0)
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("FetchEmails setup: %v / %d", err, len(emails))
+	}
+	uid := emails[0].UID
+
+	for _, label := range []string{"work", "Travel"} {
+		if err := p.AddLabel(ctx, "INBOX", uid, label); err != nil {
+			t.Fatalf("AddLabel(%q): %v", label, err)
+		}
+	}
+	table, _ := os.ReadFile(filepath.Join(root, "dovecot-keywords"))
+	if string(table) != "0 $Forwarded\n1 work\n2 Travel\n" {
+		t.Errorf("dovecot-keywords = %q", table)
+	}
+	emails, _ = p.FetchEmails(ctx, "INBOX", 10, 0)
+	if got := strings.Join(emails[0].Labels, ","); got != "Travel,work" {
+		t.Errorf("Labels = %q, want Travel,work", got)
+	}
+
+	if err := p.RemoveLabel(ctx, "INBOX", uid, "WORK"); err != nil {
+		t.Fatalf("RemoveLabel: %v", err)
+	}
+	if err := p.MoveEmail(ctx, uid, "INBOX", "Archive"); err != nil {
+		t.Fatalf("MoveEmail: %v", err)
+	}
+	archived, _ := p.FetchEmails(ctx, "Archive", 10, 0)
+	if len(archived) != 1 || strings.Join(archived[0].Labels, ",") != "Travel" {
+		t.Fatalf("archived labels = %+v, want [Travel]", archived)
+	}
+
+	if err := p.AddLabel(ctx, "INBOX", uid, "bad label"); err == nil {
+		t.Error("AddLabel with a space: want error")
+	}
+}
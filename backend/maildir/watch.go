@@ -0,0 +1,185 @@
+package maildir
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+)
+
+// pollInterval is how often a watched folder is rescanned when the
+// directories cannot be watched with inotify.
+var pollInterval = 10 * time.Second
+
+// settleDelay is how long a watch waits after a change before rescanning,
+// so that a sync tool writing many files causes one rescan.
+const settleDelay = 200 * time.Millisecond
+
+// infoSeparator separates a message's key from its flags in file names, as
+// in go-maildir.
+var infoSeparator = func() string {
+	if runtime.GOOS == "windows" {
+		return ";"
+	}
+	return ":"
+}()
+
+// dirNotifier reports changes to the entries of a set of directories.
+type dirNotifier interface {
+	Changes() <-chan struct{}
+	Close() error
+}
+
+// watchDirs returns a dirNotifier for dirs. Tests replace it to exercise
+// the polling fallback.
+var watchDirs = notifyDirs
+
+// Watch reports changes to folder as they happen on disk: messages
+// delivered (NotifyNewEmail), removed or moved away (NotifyExpunge), and
+// flags changed by another program (NotifyFlagChange). Changes are found by
+// comparing the new/ and cur/ directories with their previous contents,
+// woken by inotify on Linux and polling elsewhere.
+func (p *Provider) Watch(ctx context.Context, folder string) (<-chan backend.NotifyEvent, func(), error) {
+	if folder == "" {
+		folder = inboxFolder
+	}
+	dir := string(p.dirForFolder(folder))
+	prev, err := scanFolder(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("maildir folder %q: %w", folder, err)
+	}
+
+	var (
+		changes <-chan struct{}
+		tick    <-chan time.Time
+	)
+	notifier, err := watchDirs([]string{filepath.Join(dir, "new"), filepath.Join(dir, "cur")})
+	if err != nil {
+		log.Printf("maildir: polling %s for changes: %v", dir, err)
+		ticker := time.NewTicker(pollInterval)
+		tick = ticker.C
+		notifier = tickerNotifier{ticker}
+	} else {
+		changes = notifier.Changes()
+	}
+
+	ch := make(chan backend.NotifyEvent, 16)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(ch)
+		defer notifier.Close() //nolint:errcheck
+
+		var rescan <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-changes:
+				if rescan == nil {
+					rescan = time.After(settleDelay)
+				}
+				continue
+			case <-rescan:
+				rescan = nil
+			case <-tick:
+			}
+
+			cur, err := scanFolder(dir)
+			if err != nil {
+				log.Printf("maildir: scanning %s: %v", dir, err)
+				continue
+			}
+			for _, typ := range diffFolder(prev, cur) {
+				select {
+				case ch <- backend.NotifyEvent{Type: typ, Folder: folder, AccountID: p.account.ID}:
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+			prev = cur
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+	return ch, cancel, nil
+}
+
+// tickerNotifier lets Watch stop its polling ticker like a dirNotifier.
+type tickerNotifier struct{ *time.Ticker }
+
+func (t tickerNotifier) Changes() <-chan struct{} { return nil }
+
+func (t tickerNotifier) Close() error {
+	t.Stop()
+	return nil
+}
+
+// scanFolder returns the flags of every message in a Maildir folder, by key.
+// Messages in new/ have no flags.
+func scanFolder(dir string) (map[string]string, error) {
+	msgs := make(map[string]string)
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			key, info, _ := strings.Cut(name, infoSeparator)
+			msgs[key] = strings.TrimPrefix(info, "2,")
+		}
+	}
+	return msgs, nil
+}
+
+// diffFolder returns the kinds of change between two scans of a folder, in
+// the order new mail, expunge, flag change.
+func diffFolder(prev, cur map[string]string) []backend.NotifyType {
+	var added, removed, flagged bool
+	for key, flags := range cur {
+		old, ok := prev[key]
+		switch {
+		case !ok:
+			added = true
+		case old != flags:
+			flagged = true
+		}
+	}
+	for key := range prev {
+		if _, ok := cur[key]; !ok {
+			removed = true
+		}
+	}
+
+	var types []backend.NotifyType
+	if added {
+		types = append(types, backend.NotifyNewEmail)
+	}
+	if removed {
+		types = append(types, backend.NotifyExpunge)
+	}
+	if flagged {
+		types = append(types, backend.NotifyFlagChange)
+	}
+	return types
+}
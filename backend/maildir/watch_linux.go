@@ -0,0 +1,55 @@
+package maildir
+
+import (
+	"os"
+	"syscall"
+)
+
+// inotifyNotifier watches directories with inotify.
+type inotifyNotifier struct {
+	f       *os.File
+	changes chan struct{}
+}
+
+// notifyDirs watches dirs for files being created, removed or renamed.
+func notifyDirs(dirs []string) (dirNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	const mask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+	for _, dir := range dirs {
+		if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+			syscall.Close(fd) //nolint:errcheck,gosec
+			return nil, &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+		}
+	}
+
+	// The descriptor is non-blocking, so the File uses the runtime poller
+	// and Close interrupts a pending Read.
+	n := &inotifyNotifier{
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		changes: make(chan struct{}, 1),
+	}
+	go n.read()
+	return n, nil
+}
+
+// read turns inotify events into wake-ups until the notifier is closed. The
+// events themselves are not needed, as the watch rescans the directories.
+func (n *inotifyNotifier) read() {
+	buf := make([]byte, 4096)
+	for {
+		if _, err := n.f.Read(buf); err != nil {
+			return
+		}
+		select {
+		case n.changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *inotifyNotifier) Changes() <-chan struct{} { return n.changes }
+
+func (n *inotifyNotifier) Close() error { return n.f.Close() }
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package maildir
+
+import "errors"
+
+// notifyDirs is only implemented with inotify, so other systems poll.
+func notifyDirs([]string) (dirNotifier, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,93 @@
+package maildir
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+)
+
+// nextEvent waits for the next event from a watch.
+func nextEvent(t *testing.T, events <-chan backend.NotifyEvent) backend.NotifyEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("watch closed its channel")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return backend.NotifyEvent{}
+}
+
+func TestWatchReportsChanges(t *testing.T) {
+	root := makeMaildir(t)
+	dropMessage(t, root, "1700000000.a.host", "first", "body", time.Now())
+	p := newProvider(t, root)
+
+	events, cancel, err := p.Watch(context.Background(), "INBOX")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer cancel()
+
+	dropMessage(t, root, "1700000001.b.host", "second", "body", time.Now())
+	if ev := nextEvent(t, events); ev.Type != backend.NotifyNewEmail || ev.Folder != "INBOX" || ev.AccountID != "acct1" {
+		t.Fatalf("after delivery got %+v, want new email in INBOX for acct1", ev)
+	}
+
+	emails, err := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if err != nil || len(emails) != 2 {
+		t.Fatalf("FetchEmails: %v / %d", err, len(emails))
+	}
+	if err := p.MarkAsRead(context.Background(), "INBOX", emails[0].UID); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.Type != backend.NotifyFlagChange {
+		t.Fatalf("after marking read got %+v, want a flag change", ev)
+	}
+
+	if err := p.DeleteEmail(context.Background(), "INBOX", emails[1].UID); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.Type != backend.NotifyExpunge {
+		t.Fatalf("after deleting got %+v, want an expunge", ev)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("events not closed after cancel")
+	}
+}
+
+func TestWatchPollsWithoutInotify(t *testing.T) {
+	oldWatch, oldInterval := watchDirs, pollInterval
+	watchDirs = func([]string) (dirNotifier, error) { return nil, errors.ErrUnsupported }
+	pollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { watchDirs, pollInterval = oldWatch, oldInterval })
+
+	root := makeMaildir(t, ".Lists")
+	p := newProvider(t, root)
+	events, cancel, err := p.Watch(context.Background(), "Lists")
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer cancel()
+
+	dropMessage(t, filepath.Join(root, ".Lists"), "1700000000.c.host", "list mail", "body", time.Now())
+	if ev := nextEvent(t, events); ev.Type != backend.NotifyNewEmail || ev.Folder != "Lists" {
+		t.Fatalf("got %+v, want new email in Lists", ev)
+	}
+}
+
+func TestWatchMissingFolder(t *testing.T) {
+	p := newProvider(t, makeMaildir(t))
+	if _, _, err := p.Watch(context.Background(), "Nope"); err == nil {
+		t.Fatal("expected an error watching a folder that does not exist")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package mbox
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// flockFile takes an exclusive flock on f, waiting up to lockTimeout.
+func flockFile(f *os.File) error {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(lockRetry)
+	}
+}
@@ -0,0 +1,7 @@
+package mbox
+
+import "os"
+
+// flockFile does nothing on Windows, which has no flock; the dotlock still
+// applies.
+func flockFile(*os.File) error { return nil }
@@ -0,0 +1,249 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHeaderBytes caps how much of a message's header is kept while
+// indexing; only a few fields are read from it.
+const maxHeaderBytes = 64 * 1024
+
+// Thunderbird's X-Mozilla-Status bits.
+const (
+	mozillaRead     = 0x0001
+	mozillaFlagged  = 0x0004
+	mozillaExpunged = 0x0008
+)
+
+var fromLine = []byte("From ")
+
+// entry locates one message in an mbox file.
+type entry struct {
+	uid     uint32
+	from    int64 // offset of the "From " separator line
+	start   int64 // offset of the first header line
+	end     int64 // offset just past the message, before the separating blank line
+	read    bool
+	flagged bool
+}
+
+// index lists the messages of an mbox file in file order. It stays valid
+// while the file's size and modification time are unchanged.
+type index struct {
+	size    int64
+	modTime time.Time
+	// preamble is the length of any text before the first message, which
+	// rewrites keep.
+	preamble int64
+	entries  []entry
+}
+
+// find returns the entry with the given UID.
+func (idx *index) find(uid uint32) (entry, bool) {
+	for _, e := range idx.entries {
+		if e.uid == uid {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// indexes caches the index of every mbox file read so far, by path, so
+// paging through a large file does not rescan it.
+var indexes = struct {
+	sync.Mutex
+	m map[string]*index
+}{m: make(map[string]*index)}
+
+// loadIndex returns the index of the mbox file at path, scanning the file
+// if it changed since it was last indexed.
+func loadIndex(path string) (*index, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	if idx, ok := indexes.m[path]; ok && idx.size == info.Size() && idx.modTime.Equal(info.ModTime()) {
+		return idx, nil
+	}
+	idx, err := scanFile(path, info)
+	if err != nil {
+		return nil, err
+	}
+	indexes.m[path] = idx
+	return idx, nil
+}
+
+// forgetIndex drops the cached index of path after the file was rewritten.
+func forgetIndex(path string) {
+	indexes.Lock()
+	delete(indexes.m, path)
+	indexes.Unlock()
+}
+
+// scanFile indexes an mbox file. A message starts at a line beginning with
+// "From " at the start of the file or after a blank line, and ends at the
+// blank line before the next one. Anything before the first such line is
+// not a message, and neither are messages Thunderbird marked as expunged.
+func scanFile(path string, info os.FileInfo) (*index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	idx := &index{size: info.Size(), modTime: info.ModTime()}
+	seen := make(map[uint32]bool)
+	var (
+		r         = bufio.NewReaderSize(f, 64*1024)
+		off       int64
+		lineStart = true
+		prevBlank = true // the start of the file counts as a blank line
+		blankAt   int64  // offset of the most recent blank line
+		cur       *entry
+		inHeader  bool
+		header    []byte
+	)
+	add := func(end int64) {
+		cur.end = end
+		idx.addEntry(*cur, header, seen)
+	}
+
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 {
+			complete := chunk[len(chunk)-1] == '\n'
+			if lineStart {
+				blank := complete && len(bytes.TrimRight(chunk, "\r\n")) == 0
+				switch {
+				case prevBlank && complete && bytes.HasPrefix(chunk, fromLine):
+					if cur != nil {
+						add(blankAt)
+					} else {
+						idx.preamble = off
+					}
+					cur = &entry{from: off, start: off + int64(len(chunk))}
+					inHeader, header = true, header[:0]
+				case inHeader && blank:
+					inHeader = false
+				case inHeader && len(header) < maxHeaderBytes:
+					header = append(header, chunk...)
+				}
+				prevBlank = blank
+				if blank {
+					blankAt = off
+				}
+			} else if inHeader && len(header) < maxHeaderBytes {
+				header = append(header, chunk...)
+			}
+			lineStart = complete
+			off += int64(len(chunk))
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cur != nil {
+		end := off
+		if prevBlank && blankAt >= cur.start {
+			end = blankAt // drop the trailing separator line
+		}
+		add(end)
+	} else {
+		idx.preamble = off
+	}
+	return idx, nil
+}
+
+// addEntry fills in the UID and flags of e from its header and appends it,
+// unless the message is marked as expunged.
+func (idx *index) addEntry(e entry, header []byte, seen map[uint32]bool) {
+	tp := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(header), strings.NewReader("\r\n"))))
+	h, _ := tp.ReadMIMEHeader() // a malformed line ends the header early
+
+	if v, err := strconv.ParseUint(strings.TrimSpace(h.Get("X-Mozilla-Status")), 16, 32); err == nil {
+		if v&mozillaExpunged != 0 {
+			return
+		}
+		e.read = v&mozillaRead != 0
+		e.flagged = v&mozillaFlagged != 0
+	}
+	if strings.Contains(h.Get("Status"), "R") {
+		e.read = true
+	}
+	if strings.Contains(h.Get("X-Status"), "F") {
+		e.flagged = true
+	}
+
+	uid := messageUID(h.Get("Message-Id"), header)
+	for uid == 0 || seen[uid] {
+		uid++
+	}
+	seen[uid] = true
+	e.uid = uid
+
+	idx.entries = append(idx.entries, e)
+}
+
+// messageUID derives a stable UID from the Message-ID, or from the whole
+// header for messages without one. Offsets are not used because they change
+// whenever an earlier message is deleted.
+func messageUID(messageID string, header []byte) uint32 {
+	h := fnv.New32a()
+	if id := strings.TrimSpace(messageID); id != "" {
+		h.Write([]byte(id)) //nolint:errcheck,gosec
+	} else {
+		h.Write(header) //nolint:errcheck,gosec
+	}
+	return h.Sum32()
+}
+
+// readMessage returns the message e from f, with the ">From " quoting of
+// body lines undone.
+func readMessage(f io.ReaderAt, e entry) ([]byte, error) {
+	buf := make([]byte, e.end-e.start)
+	if _, err := f.ReadAt(buf, e.start); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return unquoteFrom(buf), nil
+}
+
+// unquoteFrom removes one ">" from lines matching ">+From ", reversing the
+// quoting mbox writers apply to body lines that would look like separators
+// (mboxrd; for mboxo files only ">From " is affected, which is the same).
+func unquoteFrom(b []byte) []byte {
+	if !bytes.Contains(b, []byte(">From ")) {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line = b[:i+1]
+		}
+		b = b[len(line):]
+		if t := bytes.TrimLeft(line, ">"); len(t) < len(line) && bytes.HasPrefix(t, fromLine) {
+			line = line[1:]
+		}
+		out = append(out, line...)
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package mbox
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long to wait for another program's lock on an mbox file, and how old
+// a dotlock must be to be taken for one left behind by a crashed program.
+const (
+	lockTimeout  = 10 * time.Second
+	lockRetry    = 100 * time.Millisecond
+	staleDotlock = 5 * time.Minute
+)
+
+// lockedFile is an mbox file locked against other programs, such as an MDA
+// delivering to it or a mail client compacting it, while it is rewritten.
+type lockedFile struct {
+	name    string      // the path the file was opened by
+	path    string      // the file itself, with symlinks resolved
+	info    os.FileInfo // its size and modification time once locked
+	f       *os.File    // open for reading, holding the flock
+	dotlock string
+}
+
+// lockFile locks the mbox file at name the ways other mail programs do: with
+// a "<file>.lock" dotlock next to it, then with flock. A symlink is followed,
+// so the file it points to is locked and later replaced.
+func lockFile(name string) (*lockedFile, error) {
+	path, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return nil, err
+	}
+	l := &lockedFile{name: name, path: path, dotlock: path + ".lock"}
+	if err := takeDotlock(l.dotlock); err != nil {
+		return nil, fmt.Errorf("mbox lock %q: %w", path, err)
+	}
+	l.f, err = os.Open(path)
+	if err != nil {
+		os.Remove(l.dotlock) //nolint:errcheck,gosec
+		return nil, err
+	}
+	if err := flockFile(l.f); err != nil {
+		l.unlock()
+		return nil, fmt.Errorf("mbox lock %q: %w", path, err)
+	}
+	if l.info, err = l.f.Stat(); err != nil {
+		l.unlock()
+		return nil, err
+	}
+	return l, nil
+}
+
+// unlock releases the locks and closes the file.
+func (l *lockedFile) unlock() {
+	l.f.Close()          //nolint:errcheck,gosec // releases the flock
+	os.Remove(l.dotlock) //nolint:errcheck,gosec
+}
+
+// unchanged reports an error if the file was replaced or written to since it
+// was locked, by a program that ignores the locks.
+func (l *lockedFile) unchanged() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, l.info) || info.Size() != l.info.Size() || !info.ModTime().Equal(l.info.ModTime()) {
+		return fmt.Errorf("mbox: %q changed while it was being rewritten", l.path)
+	}
+	return nil
+}
+
+// takeDotlock creates the dotlock file at path, waiting up to lockTimeout
+// for another program to remove its own. A dotlock older than staleDotlock
+// is removed.
+func takeDotlock(path string) error {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			return f.Close()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleDotlock {
+			os.Remove(path) //nolint:errcheck,gosec
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is held by another program", filepath.Base(path))
+		}
+		time.Sleep(lockRetry)
+	}
+}
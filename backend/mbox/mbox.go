@@ -0,0 +1,856 @@
+// Package mbox implements the backend.Provider interface for mbox files,
+// such as Thunderbird profiles and exports or Google Takeout archives.
+//
+// The configured path is either a single mbox file, shown as INBOX, or a
+// directory whose mbox files are the folders:
+//   - A file's folder name is its path below the directory, with a ".mbox"
+//     extension dropped (Takeout) and ".sbd" subdirectories mapped to the
+//     "/" hierarchy (Thunderbird). A file named "Inbox" is INBOX.
+//   - Files that do not start with a "From " line are skipped, so
+//     Thunderbird's .msf index files and other clutter are ignored.
+//
+// Each file's message offsets are indexed once and kept in memory until the
+// file changes, so FetchEmails pages through large archives without
+// rescanning them. Deletes and moves rewrite the affected files atomically,
+// holding the dotlock and flock other mail programs take on them.
+// Read and flagged state come from the Status, X-Status and X-Mozilla-Status
+// headers and cannot be changed, and there is no transport, so SendEmail
+// returns ErrNotSupported.
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message"
+	gomail "github.com/emersion/go-message/mail"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+)
+
+const (
+	inboxFolder   = "INBOX"
+	archiveFolder = "Archive"
+)
+
+var messageIDRE = regexp.MustCompile(`<[^>]+>`)
+
+// errNoInbox is returned by folderPath for INBOX when the directory has no
+// Inbox file.
+var errNoInbox = errors.New("mbox: no INBOX file")
+
+func init() {
+	backend.RegisterBackend("mbox", func(account *config.Account) (backend.Provider, error) {
+		return New(account)
+	})
+}
+
+// Provider implements backend.Provider against an mbox file or a directory
+// of mbox files.
+type Provider struct {
+	account *config.Account
+	path    string
+	dir     bool
+}
+
+// New creates a new mbox provider for the given account.
+func New(account *config.Account) (*Provider, error) {
+	path := strings.TrimSpace(account.MboxPath)
+	if path == "" {
+		return nil, fmt.Errorf("mbox path not configured")
+	}
+
+	path = os.ExpandEnv(path)
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	path = filepath.Clean(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("mbox path %q: %w", path, err)
+	}
+
+	return &Provider{account: account, path: path, dir: info.IsDir()}, nil
+}
+
+// folders maps every folder name to its mbox file.
+func (p *Provider) folders() (map[string]string, error) {
+	if !p.dir {
+		return map[string]string{inboxFolder: p.path}, nil
+	}
+
+	folders := make(map[string]string)
+	err := filepath.WalkDir(p.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == p.path {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Dotlocks taken on the files may be empty, like a new mbox.
+		if d.IsDir() || !d.Type().IsRegular() || strings.HasSuffix(d.Name(), ".lock") || !isMbox(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.path, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for i := range parts[:len(parts)-1] {
+			parts[i] = strings.TrimSuffix(parts[i], ".sbd")
+		}
+		parts[len(parts)-1] = strings.TrimSuffix(parts[len(parts)-1], ".mbox")
+		name := strings.Join(parts, "/")
+		if strings.EqualFold(name, inboxFolder) {
+			name = inboxFolder
+		}
+		folders[name] = path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mbox read %q: %w", p.path, err)
+	}
+	return folders, nil
+}
+
+// isMbox reports whether the file at path is empty or starts with a "From "
+// line.
+func isMbox(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close() //nolint:errcheck
+
+	head := make([]byte, len(fromLine))
+	n, _ := io.ReadFull(f, head)
+	return n == 0 || bytes.Equal(head[:n], fromLine)
+}
+
+// folderPath returns the mbox file of a folder. An empty name means INBOX.
+func (p *Provider) folderPath(folder string) (string, error) {
+	if folder == "" || strings.EqualFold(folder, inboxFolder) {
+		folder = inboxFolder
+	}
+	folders, err := p.folders()
+	if err != nil {
+		return "", err
+	}
+	path, ok := folders[folder]
+	switch {
+	case ok:
+		return path, nil
+	case folder == inboxFolder:
+		return "", errNoInbox
+	default:
+		return "", fmt.Errorf("mbox: folder %q not found", folder)
+	}
+}
+
+// openFolder returns the index of a folder's mbox file and the file, opened
+// for reading. The caller holds fileMu for reading until it closes f.
+func (p *Provider) openFolder(folder string) (*index, *os.File, error) {
+	path, err := p.folderPath(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx, err := loadIndex(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mbox index %q: %w", folder, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mbox open %q: %w", folder, err)
+	}
+	return idx, f, nil
+}
+
+// FetchFolders returns the mbox files found under the configured path,
+// INBOX first.
+func (p *Provider) FetchFolders(_ context.Context) ([]backend.Folder, error) {
+	folders, err := p.folders()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == inboxFolder) != (names[j] == inboxFolder) {
+			return names[i] == inboxFolder
+		}
+		return names[i] < names[j]
+	})
+
+	result := make([]backend.Folder, len(names))
+	for i, name := range names {
+		result[i] = backend.Folder{Name: name, Delimiter: "/"}
+	}
+	return result, nil
+}
+
+// CreateFolder is not supported by the mbox backend.
+func (p *Provider) CreateFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// RenameFolder is not supported by the mbox backend.
+func (p *Provider) RenameFolder(_ context.Context, _, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// DeleteFolder is not supported by the mbox backend.
+func (p *Provider) DeleteFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// SubscribeFolder is not supported: all mbox folders are always listed.
+func (p *Provider) SubscribeFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// UnsubscribeFolder is not supported: all mbox folders are always listed.
+func (p *Provider) UnsubscribeFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// FetchEmails returns a page of messages, newest first. Messages are
+// appended to an mbox as they arrive, so file order is taken as date order
+// and a page is read straight from the index.
+func (p *Provider) FetchEmails(_ context.Context, folder string, limit, offset uint32) ([]backend.Email, error) {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+
+	idx, f, err := p.openFolder(folder)
+	if errors.Is(err, errNoInbox) {
+		return []backend.Email{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	start := len(idx.entries) - int(offset)
+	if start <= 0 {
+		return []backend.Email{}, nil
+	}
+	end := 0
+	if limit > 0 && start > int(limit) {
+		end = start - int(limit)
+	}
+
+	emails := make([]backend.Email, 0, start-end)
+	for i := start - 1; i >= end; i-- {
+		email, err := p.readHeader(f, idx.entries[i])
+		if err != nil {
+			continue
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// readHeader parses just the header of message e to fill an Email.
+func (p *Provider) readHeader(f *os.File, e entry) (backend.Email, error) {
+	entity, err := message.Read(io.NewSectionReader(f, e.start, e.end-e.start))
+	if err != nil && entity == nil {
+		return backend.Email{}, err
+	}
+	email := headerToEmail(&entity.Header, e.uid, p.account.ID)
+	email.IsRead = e.read
+	email.IsFlagged = e.flagged
+	return email, nil
+}
+
+// readByUID returns the message with the given UID in folder.
+func (p *Provider) readByUID(folder string, uid uint32) ([]byte, error) {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+
+	idx, f, err := p.openFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	e, ok := idx.find(uid)
+	if !ok {
+		return nil, fmt.Errorf("mbox: message with UID %d not found in %q", uid, folder)
+	}
+	raw, err := readMessage(f, e)
+	if err != nil {
+		return nil, fmt.Errorf("mbox read: %w", err)
+	}
+	return raw, nil
+}
+
+// FetchEmailBody returns the chosen body, MIME type, and attachments.
+func (p *Provider) FetchEmailBody(_ context.Context, folder string, uid uint32) (string, string, []backend.Attachment, error) {
+	raw, err := p.readByUID(folder, uid)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return parseMessageBody(bytes.NewReader(raw))
+}
+
+// FetchAttachment returns the raw bytes of an attachment part.
+func (p *Provider) FetchAttachment(_ context.Context, folder string, uid uint32, partID, _ string) ([]byte, error) {
+	raw, err := p.readByUID(folder, uid)
+	if err != nil {
+		return nil, err
+	}
+	return findAttachmentData(bytes.NewReader(raw), partID)
+}
+
+// MarkAsRead is a no-op: changing a message's Status header would mean
+// rewriting the whole file each time a message is opened.
+func (p *Provider) MarkAsRead(_ context.Context, _ string, _ uint32) error {
+	return nil
+}
+
+// MarkAsUnread is a no-op, like MarkAsRead.
+func (p *Provider) MarkAsUnread(_ context.Context, _ string, _ uint32) error {
+	return nil
+}
+
+// MarkFlagged is not supported by the mbox backend.
+func (p *Provider) MarkFlagged(_ context.Context, _ string, _ uint32) error {
+	return backend.ErrNotSupported
+}
+
+// MarkUnflagged is not supported by the mbox backend.
+func (p *Provider) MarkUnflagged(_ context.Context, _ string, _ uint32) error {
+	return backend.ErrNotSupported
+}
+
+// AddLabel is not supported by the mbox backend.
+func (p *Provider) AddLabel(_ context.Context, _ string, _ uint32, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// RemoveLabel is not supported by the mbox backend.
+func (p *Provider) RemoveLabel(_ context.Context, _ string, _ uint32, _ string) error {
+	return backend.ErrNotSupported
+}
+
+// DeleteEmail removes a message by rewriting its mbox file.
+func (p *Provider) DeleteEmail(ctx context.Context, folder string, uid uint32) error {
+	return p.DeleteEmails(ctx, folder, []uint32{uid})
+}
+
+// DeleteEmails removes the listed messages by rewriting the folder's mbox
+// file without them, with the file locked.
+func (p *Provider) DeleteEmails(_ context.Context, folder string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	path, err := p.folderPath(folder)
+	if err != nil {
+		return err
+	}
+	l, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer l.unlock()
+
+	idx, err := loadIndex(l.path)
+	if err != nil {
+		return fmt.Errorf("mbox index %q: %w", folder, err)
+	}
+	_, kept, err := splitEntries(idx, folder, uids)
+	if err != nil {
+		return err
+	}
+	return rewriteWithout(l, idx.preamble, kept)
+}
+
+// ArchiveEmail moves the message to the Archive folder if one exists.
+func (p *Provider) ArchiveEmail(ctx context.Context, folder string, uid uint32) error {
+	return p.ArchiveEmails(ctx, folder, []uint32{uid})
+}
+
+// ArchiveEmails moves the listed messages to the Archive folder if one
+// exists.
+func (p *Provider) ArchiveEmails(ctx context.Context, folder string, uids []uint32) error {
+	if !p.hasArchive() {
+		return backend.ErrNotSupported
+	}
+	return p.MoveEmails(ctx, uids, folder, archiveFolder)
+}
+
+// hasArchive reports whether there is an Archive folder.
+func (p *Provider) hasArchive() bool {
+	_, err := p.folderPath(archiveFolder)
+	return err == nil
+}
+
+// MoveEmail relocates a message between two mbox files.
+func (p *Provider) MoveEmail(ctx context.Context, uid uint32, srcFolder, dstFolder string) error {
+	return p.MoveEmails(ctx, []uint32{uid}, srcFolder, dstFolder)
+}
+
+// MoveEmails appends the listed messages to the destination file, then
+// rewrites the source file without them, with both files locked. Both files
+// are replaced atomically, and the destination first, so an interrupted move
+// leaves a copy in both folders rather than in neither.
+func (p *Provider) MoveEmails(_ context.Context, uids []uint32, srcFolder, dstFolder string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	srcPath, err := p.folderPath(srcFolder)
+	if err != nil {
+		return err
+	}
+	dstPath, err := p.folderPath(dstFolder)
+	if err != nil {
+		return err
+	}
+	if sameFile(srcPath, dstPath) {
+		return nil
+	}
+	src, err := lockFile(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.unlock()
+	dst, err := lockFile(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.unlock()
+
+	idx, err := loadIndex(src.path)
+	if err != nil {
+		return fmt.Errorf("mbox index %q: %w", srcFolder, err)
+	}
+	moved, kept, err := splitEntries(idx, srcFolder, uids)
+	if err != nil {
+		return err
+	}
+
+	err = rewriteFile(dst, func(w *bufio.Writer) error {
+		if err := copyFile(w, dst.f); err != nil {
+			return err
+		}
+		return copyEntries(w, src.f, moved)
+	})
+	if err != nil {
+		return fmt.Errorf("mbox write %q: %w", dstFolder, err)
+	}
+	return rewriteWithout(src, idx.preamble, kept)
+}
+
+// sameFile reports whether two paths name the same file, such as through a
+// symlink.
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+// splitEntries divides the messages in idx into those listed in uids and
+// the rest, both in file order.
+func splitEntries(idx *index, folder string, uids []uint32) (listed, rest []entry, err error) {
+	want := make(map[uint32]bool, len(uids))
+	for _, uid := range uids {
+		if _, ok := idx.find(uid); !ok {
+			return nil, nil, fmt.Errorf("mbox: message with UID %d not found in %q", uid, folder)
+		}
+		want[uid] = true
+	}
+	for _, e := range idx.entries {
+		if want[e.uid] {
+			listed = append(listed, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	return listed, rest, nil
+}
+
+// rewriteWithout rewrites the locked file l to hold only its first preamble
+// bytes, the text before its first message, and kept.
+func rewriteWithout(l *lockedFile, preamble int64, kept []entry) error {
+	if err := rewriteFile(l, func(w *bufio.Writer) error {
+		if _, err := io.Copy(w, io.NewSectionReader(l.f, 0, preamble)); err != nil {
+			return err
+		}
+		return copyEntries(w, l.f, kept)
+	}); err != nil {
+		return fmt.Errorf("mbox rewrite %q: %w", l.path, err)
+	}
+	return nil
+}
+
+// SendEmail is not supported by the mbox backend.
+func (p *Provider) SendEmail(_ context.Context, _ *backend.OutgoingEmail) error {
+	return backend.ErrNotSupported
+}
+
+// Search filters messages in a folder by the given query, newest first,
+// parsing each message locally.
+func (p *Provider) Search(_ context.Context, folder string, query backend.SearchQuery) ([]backend.Email, error) {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+
+	idx, f, err := p.openFolder(folder)
+	if errors.Is(err, errNoInbox) {
+		return []backend.Email{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	expr := query.Expression()
+	results := make([]backend.Email, 0)
+	for i := len(idx.entries) - 1; i >= 0; i-- {
+		if query.Limit > 0 && uint32(len(results)) >= query.Limit {
+			break
+		}
+		email, candidate, err := p.matchOpen(f, idx.entries[i])
+		if err != nil {
+			continue
+		}
+		if !matchesQuery(candidate, expr) {
+			continue
+		}
+		results = append(results, email)
+	}
+	return results, nil
+}
+
+// searchCandidate is what a search term can test about a message.
+type searchCandidate struct {
+	email         backend.Email
+	cc            []string
+	body          string
+	size          int
+	hasAttachment bool
+}
+
+// matchOpen returns the email metadata and what search needs to know about
+// the message.
+func (p *Provider) matchOpen(f *os.File, e entry) (backend.Email, searchCandidate, error) {
+	raw, err := readMessage(f, e)
+	if err != nil {
+		return backend.Email{}, searchCandidate{}, err
+	}
+	entity, err := message.Read(bytes.NewReader(raw))
+	if err != nil && entity == nil {
+		return backend.Email{}, searchCandidate{}, err
+	}
+	email := headerToEmail(&entity.Header, e.uid, p.account.ID)
+	email.IsRead = e.read
+	email.IsFlagged = e.flagged
+
+	c := searchCandidate{email: email, size: len(raw)}
+	if ccHeader := entity.Header.Get("Cc"); ccHeader != "" {
+		if addrs, err := mail.ParseAddressList(ccHeader); err == nil {
+			for _, addr := range addrs {
+				c.cc = append(c.cc, addr.Address)
+			}
+		}
+	}
+	// Mail with attachments is sent as multipart/mixed.
+	if mediaType, _, err := entity.Header.ContentType(); err == nil {
+		c.hasAttachment = mediaType == "multipart/mixed"
+	}
+	if b, err := io.ReadAll(entity.Body); err == nil {
+		c.body = string(b)
+	}
+
+	return email, c, nil
+}
+
+// matchesQuery evaluates a parsed search expression against a message. A
+// nil expression matches everything.
+func matchesQuery(c searchCandidate, e *backend.SearchExpr) bool {
+	if e == nil {
+		return true
+	}
+	switch e.Op {
+	case backend.SearchAnd:
+		for _, child := range e.Children {
+			if !matchesQuery(c, child) {
+				return false
+			}
+		}
+		return true
+	case backend.SearchOr:
+		for _, child := range e.Children {
+			if matchesQuery(c, child) {
+				return true
+			}
+		}
+		return false
+	case backend.SearchNot:
+		return !matchesQuery(c, e.Children[0])
+	}
+
+	containsCI := func(haystack string) bool {
+		return strings.Contains(strings.ToLower(haystack), strings.ToLower(e.Text))
+	}
+	anyCI := func(addrs []string) bool {
+		for _, addr := range addrs {
+			if containsCI(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	switch e.Field {
+	case backend.SearchFrom:
+		return containsCI(c.email.From)
+	case backend.SearchTo:
+		return anyCI(c.email.To)
+	case backend.SearchCc:
+		return anyCI(c.cc)
+	case backend.SearchSubject:
+		return containsCI(c.email.Subject)
+	case backend.SearchBody:
+		return containsCI(c.body)
+	case backend.SearchSince:
+		return !c.email.Date.Before(e.Time)
+	case backend.SearchBefore:
+		return c.email.Date.Before(e.Time)
+	case backend.SearchLarger:
+		return c.size > e.Size
+	case backend.SearchSmaller:
+		return c.size < e.Size
+	case backend.SearchFlagged:
+		return c.email.IsFlagged == e.Bool
+	case backend.SearchRead:
+		return c.email.IsRead == e.Bool
+	case backend.SearchAttachment:
+		return c.hasAttachment == e.Bool
+	}
+	return true
+}
+
+// Watch is not supported: mbox archives are not expected to change.
+func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEvent, func(), error) {
+	return nil, nil, backend.ErrNotSupported
+}
+
+// Close releases any provider-held resources. None for mbox.
+func (p *Provider) Close() error { return nil }
+
+// Capabilities reports what the mbox backend can do.
+func (p *Provider) Capabilities() backend.Capabilities {
+	return backend.Capabilities{
+		CanSend:         false,
+		CanMove:         p.dir,
+		CanArchive:      p.hasArchive(),
+		CanPush:         false,
+		CanSearchServer: true,
+		CanFetchFolders: true,
+		SupportsSMIME:   false,
+	}
+}
+
+// headerToEmail converts a parsed message Header into a backend.Email.
+func headerToEmail(header *message.Header, uid uint32, accountID string) backend.Email {
+	from := header.Get("From")
+	subject := header.Get("Subject")
+	dateStr := header.Get("Date")
+	messageID := header.Get("Message-ID")
+	inReplyTo := firstMessageID(header.Get("In-Reply-To"))
+	references := messageIDList(header.Get("References"))
+
+	var to []string
+	if toHeader := header.Get("To"); toHeader != "" {
+		if addrs, err := mail.ParseAddressList(toHeader); err == nil {
+			for _, addr := range addrs {
+				to = append(to, addr.Address)
+			}
+		}
+	}
+
+	var replyTo []string
+	if replyToHeader := header.Get("Reply-To"); replyToHeader != "" {
+		if addrs, err := mail.ParseAddressList(replyToHeader); err == nil {
+			for _, addr := range addrs {
+				replyTo = append(replyTo, addr.Address)
+			}
+		}
+	}
+
+	var date time.Time
+	if dateStr != "" {
+		if parsed, err := mail.ParseDate(dateStr); err == nil {
+			date = parsed
+		}
+	}
+
+	dec := new(mime.WordDecoder)
+	if decoded, err := dec.DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	if decoded, err := dec.DecodeHeader(from); err == nil {
+		from = decoded
+	}
+
+	return backend.Email{
+		UID:        uid,
+		From:       from,
+		To:         to,
+		ReplyTo:    replyTo,
+		Subject:    subject,
+		Date:       date,
+		MessageID:  messageID,
+		InReplyTo:  inReplyTo,
+		References: references,
+		AccountID:  accountID,
+	}
+}
+
+func firstMessageID(value string) string {
+	ids := messageIDList(value)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[0]
+}
+
+func messageIDList(value string) []string {
+	matches := messageIDRE.FindAllString(value, -1)
+	if len(matches) == 0 {
+		return strings.Fields(value)
+	}
+	return matches
+}
+
+// parseMessageBody extracts the body text and attachments from a raw message.
+// Mirrors the Maildir backend's logic.
+func parseMessageBody(r io.Reader) (string, string, []backend.Attachment, error) {
+	mr, err := gomail.CreateReader(r)
+	if err != nil {
+		body, rerr := io.ReadAll(r)
+		if rerr != nil {
+			return "", "", nil, rerr
+		}
+		return string(body), "", nil, nil
+	}
+
+	var bodyText string
+	var htmlBody string
+	var attachments []backend.Attachment
+	partIdx := 0
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			break
+		}
+		partIdx++
+
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		disposition, dParams, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+
+		data, readErr := io.ReadAll(part.Body)
+		if readErr != nil {
+			continue
+		}
+
+		switch {
+		case disposition == "attachment" || (disposition == "inline" && !strings.HasPrefix(contentType, "text/")):
+			filename := dParams["filename"]
+			if filename == "" {
+				_, cp, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+				filename = cp["name"]
+			}
+			att := backend.Attachment{
+				Filename: filename,
+				PartID:   fmt.Sprintf("%d", partIdx),
+				Data:     data,
+				MIMEType: contentType,
+				Inline:   disposition == "inline",
+			}
+			if cid := part.Header.Get("Content-ID"); cid != "" {
+				att.ContentID = strings.Trim(cid, "<>")
+			}
+			attachments = append(attachments, att)
+		case contentType == "text/html":
+			htmlBody = string(data)
+		case contentType == "text/plain" && bodyText == "":
+			bodyText = string(data)
+		}
+	}
+
+	if htmlBody != "" {
+		return htmlBody, "text/html", attachments, nil
+	}
+	return bodyText, "text/plain", attachments, nil
+}
+
+// findAttachmentData walks a raw message to find attachment data by partID.
+func findAttachmentData(r io.Reader, targetPartID string) ([]byte, error) {
+	mr, err := gomail.CreateReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a multipart message")
+	}
+
+	partIdx := 0
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			break
+		}
+		partIdx++
+
+		if fmt.Sprintf("%d", partIdx) == targetPartID {
+			return io.ReadAll(part.Body)
+		}
+	}
+
+	return nil, fmt.Errorf("mbox: attachment part %s not found", targetPartID)
+}
+
+// Verify interface compliance at compile time.
+var _ backend.Provider = (*Provider)(nil)
@@ -0,0 +1,471 @@
+package mbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/backend/searchtest"
+	"github.com/floatpane/matcha/config"
+)
+
+// rawMessage builds a simple message in mbox form, "From " line first.
+func rawMessage(key, subject, body string, extraHeaders ...string) string {
+	var b strings.Builder
+	b.WriteString("From alice@example.com Mon Jan  1 00:00:00 2024\n")
+	b.WriteString("From: alice@example.com\nTo: me@local\nContent-Type: text/plain\n")
+	fmt.Fprintf(&b, "Subject: %s\nMessage-ID: <%s@local>\n", subject, key)
+	for _, h := range extraHeaders {
+		b.WriteString(h + "\n")
+	}
+	fmt.Fprintf(&b, "\n%s\n\n", body)
+	return b.String()
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newProvider(t *testing.T, path string) *Provider {
+	t.Helper()
+	p, err := New(&config.Account{ID: "acct1", Protocol: "mbox", MboxPath: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+func subjects(emails []backend.Email) []string {
+	var out []string
+	for _, e := range emails {
+		out = append(out, e.Subject)
+	}
+	return out
+}
+
+func TestNewRejectsMissingPath(t *testing.T) {
+	if _, err := New(&config.Account{ID: "x"}); err == nil {
+		t.Error("want error for empty path")
+	}
+	if _, err := New(&config.Account{ID: "x", MboxPath: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("want error for missing path")
+	}
+}
+
+func TestRegisteredAsProtocol(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.mbox")
+	writeFile(t, path, "")
+	p, err := backend.New(&config.Account{ID: "x", Protocol: "mbox", MboxPath: path})
+	if err != nil {
+		t.Fatalf("backend.New: %v", err)
+	}
+	if _, ok := p.(*Provider); !ok {
+		t.Errorf("backend.New returned %T", p)
+	}
+}
+
+func TestDirectoryFolders(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "Inbox"), rawMessage("a", "in inbox", "x"))
+	writeFile(t, filepath.Join(root, "Inbox.msf"), "// <!-- <mdb:mork:z v=\"1.4\"/> -->")
+	writeFile(t, filepath.Join(root, "Trash"), "")
+	writeFile(t, filepath.Join(root, "Lists.sbd", "golang"), rawMessage("b", "list", "y"))
+	writeFile(t, filepath.Join(root, "Takeout", "Sent.mbox"), rawMessage("c", "sent", "z"))
+	writeFile(t, filepath.Join(root, ".hidden"), rawMessage("d", "hidden", "w"))
+
+	p := newProvider(t, root)
+	folders, err := p.FetchFolders(context.Background())
+	if err != nil {
+		t.Fatalf("FetchFolders: %v", err)
+	}
+	var names []string
+	for _, f := range folders {
+		names = append(names, f.Name)
+	}
+	want := []string{"INBOX", "Lists/golang", "Takeout/Sent", "Trash"}
+	if !slices.Equal(names, want) {
+		t.Errorf("folders = %v, want %v", names, want)
+	}
+
+	emails, err := p.FetchEmails(context.Background(), "Lists/golang", 10, 0)
+	if err != nil || len(emails) != 1 || emails[0].Subject != "list" {
+		t.Errorf("FetchEmails(Lists/golang) = %v, %v", subjects(emails), err)
+	}
+}
+
+func TestSingleFileIsInbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "All mail.mbox")
+	writeFile(t, path, rawMessage("a", "only", "x"))
+
+	p := newProvider(t, path)
+	folders, err := p.FetchFolders(context.Background())
+	if err != nil || len(folders) != 1 || folders[0].Name != "INBOX" {
+		t.Fatalf("FetchFolders = %+v, %v", folders, err)
+	}
+	if p.Capabilities().CanMove {
+		t.Error("CanMove should be false for a single file")
+	}
+}
+
+func TestFetchEmailsNewestFirstWithPaging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	var b strings.Builder
+	for i := 1; i <= 5; i++ {
+		b.WriteString(rawMessage(fmt.Sprintf("m%d", i), fmt.Sprintf("msg %d", i), "body"))
+	}
+	writeFile(t, path, b.String())
+
+	p := newProvider(t, path)
+	page, err := p.FetchEmails(context.Background(), "INBOX", 2, 0)
+	if err != nil {
+		t.Fatalf("FetchEmails: %v", err)
+	}
+	if got := subjects(page); !slices.Equal(got, []string{"msg 5", "msg 4"}) {
+		t.Errorf("first page = %v", got)
+	}
+	page, _ = p.FetchEmails(context.Background(), "INBOX", 2, 4)
+	if got := subjects(page); !slices.Equal(got, []string{"msg 1"}) {
+		t.Errorf("last page = %v", got)
+	}
+	page, _ = p.FetchEmails(context.Background(), "INBOX", 2, 5)
+	if len(page) != 0 {
+		t.Errorf("past the end = %v", subjects(page))
+	}
+}
+
+func TestFlagsFromStatusHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path,
+		rawMessage("plain", "unread", "x")+
+			rawMessage("status", "read", "x", "Status: RO", "X-Status: F")+
+			rawMessage("moz", "mozilla", "x", "X-Mozilla-Status: 0005")+
+			rawMessage("gone", "expunged", "x", "X-Mozilla-Status: 0009"))
+
+	p := newProvider(t, path)
+	emails, err := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if err != nil {
+		t.Fatalf("FetchEmails: %v", err)
+	}
+	state := make(map[string][2]bool)
+	for _, e := range emails {
+		state[e.Subject] = [2]bool{e.IsRead, e.IsFlagged}
+	}
+	want := map[string][2]bool{
+		"unread":  {false, false},
+		"read":    {true, true},
+		"mozilla": {true, true},
+	}
+	if len(state) != len(want) {
+		t.Fatalf("got %v, want %v", state, want)
+	}
+	for subject, w := range want {
+		if state[subject] != w {
+			t.Errorf("%s: read, flagged = %v, want %v", subject, state[subject], w)
+		}
+	}
+}
+
+func TestFetchEmailBodyUnquotesFromLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path,
+		rawMessage("a", "first", "hello\n\n>From the top\n>>From quoted")+
+			rawMessage("b", "second", "bye"))
+
+	p := newProvider(t, path)
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if len(emails) != 2 {
+		t.Fatalf("want 2 messages, got %v", subjects(emails))
+	}
+	body, _, _, err := p.FetchEmailBody(context.Background(), "INBOX", emails[1].UID)
+	if err != nil {
+		t.Fatalf("FetchEmailBody: %v", err)
+	}
+	if want := "hello\n\nFrom the top\n>From quoted\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestFetchAttachment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path, "From a@b Mon Jan  1 00:00:00 2024\n"+
+		"From: a@b\nSubject: att\nMessage-ID: <att@local>\n"+
+		"Content-Type: multipart/mixed; boundary=sep\n\n"+
+		"--sep\nContent-Type: text/plain\n\nsee attached\n"+
+		"--sep\nContent-Type: text/plain\nContent-Disposition: attachment; filename=notes.txt\n\nnotes\n"+
+		"--sep--\n")
+
+	p := newProvider(t, path)
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if len(emails) != 1 {
+		t.Fatalf("want 1 message, got %d", len(emails))
+	}
+	_, _, atts, err := p.FetchEmailBody(context.Background(), "INBOX", emails[0].UID)
+	if err != nil || len(atts) != 1 || atts[0].Filename != "notes.txt" {
+		t.Fatalf("FetchEmailBody attachments = %+v, %v", atts, err)
+	}
+	data, err := p.FetchAttachment(context.Background(), "INBOX", emails[0].UID, atts[0].PartID, "")
+	if err != nil || strings.TrimSpace(string(data)) != "notes" {
+		t.Errorf("FetchAttachment = %q, %v", data, err)
+	}
+}
+
+func TestDeleteRewritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path,
+		rawMessage("a", "keep 1", "x")+
+			rawMessage("b", "drop", "from\n>From here")+
+			rawMessage("c", "keep 2", "quoted\n>From here"))
+
+	p := newProvider(t, path)
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	uids := make(map[string]uint32)
+	for _, e := range emails {
+		uids[e.Subject] = e.UID
+	}
+	if err := p.DeleteEmail(context.Background(), "INBOX", uids["drop"]); err != nil {
+		t.Fatalf("DeleteEmail: %v", err)
+	}
+
+	emails, _ = p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if got := subjects(emails); !slices.Equal(got, []string{"keep 2", "keep 1"}) {
+		t.Fatalf("after delete = %v", got)
+	}
+	if emails[0].UID != uids["keep 2"] {
+		t.Error("UIDs changed after the rewrite")
+	}
+	data, _ := os.ReadFile(path)
+	if want := rawMessage("a", "keep 1", "x") + rawMessage("c", "keep 2", "quoted\n>From here"); string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+	if err := p.DeleteEmail(context.Background(), "INBOX", uids["drop"]); err == nil {
+		t.Error("deleting a missing UID should fail")
+	}
+}
+
+func TestDeleteKeepsPreamble(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	const preamble = "This text is part of the file, not a message.\n\n"
+	writeFile(t, path, preamble+rawMessage("a", "drop", "x")+rawMessage("b", "keep", "y"))
+
+	p := newProvider(t, path)
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if got := subjects(emails); !slices.Equal(got, []string{"keep", "drop"}) {
+		t.Fatalf("emails = %v", got)
+	}
+	if err := p.DeleteEmail(context.Background(), "INBOX", emails[1].UID); err != nil {
+		t.Fatalf("DeleteEmail: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := preamble + rawMessage("b", "keep", "y"); string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
+
+func TestDeleteRewritesSymlinkTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real")
+	writeFile(t, target, rawMessage("a", "drop", "x")+rawMessage("b", "keep", "y"))
+	link := filepath.Join(dir, "inbox")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	p := newProvider(t, link)
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if err := p.DeleteEmail(context.Background(), "INBOX", emails[1].UID); err != nil {
+		t.Fatalf("DeleteEmail: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("inbox is no longer a symlink: %v, %v", info, err)
+	}
+	data, _ := os.ReadFile(target)
+	if want := rawMessage("b", "keep", "y"); string(data) != want {
+		t.Errorf("target = %q, want %q", data, want)
+	}
+	emails, _ = p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if got := subjects(emails); !slices.Equal(got, []string{"keep"}) {
+		t.Errorf("after delete = %v", got)
+	}
+}
+
+func TestDeleteWaitsForDotlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path, rawMessage("a", "drop", "x")+rawMessage("b", "keep", "y"))
+	p := newProvider(t, path)
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+
+	// Another program is delivering to the file.
+	writeFile(t, path+".lock", "")
+	done := make(chan error, 1)
+	go func() { done <- p.DeleteEmail(context.Background(), "INBOX", emails[1].UID) }()
+	select {
+	case err := <-done:
+		t.Fatalf("DeleteEmail returned %v while the file was locked", err)
+	case <-time.After(3 * lockRetry):
+	}
+
+	os.Remove(path + ".lock") //nolint:errcheck
+	if err := <-done; err != nil {
+		t.Fatalf("DeleteEmail: %v", err)
+	}
+	if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("dotlock left behind: %v", err)
+	}
+}
+
+func TestLockedFileNoticesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path, rawMessage("a", "one", "x"))
+	l, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.unlock()
+	if err := l.unchanged(); err != nil {
+		t.Fatalf("unchanged = %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(rawMessage("b", "two", "y")) //nolint:errcheck
+	f.Close()                                  //nolint:errcheck
+	if err := l.unchanged(); err == nil {
+		t.Error("unchanged = nil after another program appended")
+	}
+}
+
+func TestMoveAndArchive(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "Inbox"), rawMessage("a", "one", "x")+rawMessage("b", "two", "y"))
+	writeFile(t, filepath.Join(root, "Old"), strings.TrimSuffix(rawMessage("c", "old", "z"), "\n\n"))
+
+	p := newProvider(t, root)
+	if p.Capabilities().CanArchive {
+		t.Error("CanArchive should be false without an Archive file")
+	}
+	if err := p.ArchiveEmail(context.Background(), "INBOX", 1); !errors.Is(err, backend.ErrNotSupported) {
+		t.Errorf("ArchiveEmail without Archive = %v, want ErrNotSupported", err)
+	}
+
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if err := p.MoveEmail(context.Background(), emails[1].UID, "INBOX", "Old"); err != nil {
+		t.Fatalf("MoveEmail: %v", err)
+	}
+	inbox, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	old, _ := p.FetchEmails(context.Background(), "Old", 10, 0)
+	if got := subjects(inbox); !slices.Equal(got, []string{"two"}) {
+		t.Errorf("INBOX after move = %v", got)
+	}
+	if got := subjects(old); !slices.Equal(got, []string{"one", "old"}) {
+		t.Errorf("Old after move = %v", got)
+	}
+
+	writeFile(t, filepath.Join(root, "Archive"), "")
+	if err := p.ArchiveEmail(context.Background(), "INBOX", inbox[0].UID); err != nil {
+		t.Fatalf("ArchiveEmail: %v", err)
+	}
+	archived, _ := p.FetchEmails(context.Background(), "Archive", 10, 0)
+	if got := subjects(archived); !slices.Equal(got, []string{"two"}) {
+		t.Errorf("Archive = %v", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "Inbox")); len(data) != 0 {
+		t.Errorf("Inbox should be empty, got %q", data)
+	}
+}
+
+func TestIndexFollowsAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	writeFile(t, path, rawMessage("a", "one", "x"))
+
+	p := newProvider(t, path)
+	if emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0); len(emails) != 1 {
+		t.Fatalf("want 1 message, got %d", len(emails))
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(rawMessage("b", "two", "y")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close() //nolint:errcheck,gosec
+
+	emails, _ := p.FetchEmails(context.Background(), "INBOX", 10, 0)
+	if got := subjects(emails); !slices.Equal(got, []string{"two", "one"}) {
+		t.Errorf("after append = %v", got)
+	}
+}
+
+// sampleMessage renders a searchtest message in mbox form, with its flags in
+// Status and X-Status headers.
+func sampleMessage(m searchtest.Message) string {
+	var b strings.Builder
+	b.WriteString("From sample@local Mon Jan  1 00:00:00 2024\n")
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\n", m.From, strings.Join(m.To, ", "))
+	if len(m.Cc) > 0 {
+		fmt.Fprintf(&b, "Cc: %s\r\n", strings.Join(m.Cc, ", "))
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\nDate: %s\r\nMessage-ID: <%s@local>\r\n", m.Subject, m.Date.Format(time.RFC1123Z), m.ID)
+	if m.Read {
+		b.WriteString("Status: RO\r\n")
+	}
+	if m.Flagged {
+		b.WriteString("X-Status: F\r\n")
+	}
+	if m.HasAttachment {
+		b.WriteString("Content-Type: multipart/mixed; boundary=sep\r\n\r\n")
+		fmt.Fprintf(&b, "--sep\r\nContent-Type: text/plain\r\n\r\n%s\r\n", m.Body)
+		b.WriteString("--sep\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=a.pdf\r\n\r\nJVBERi0=\r\n--sep--\r\n")
+	} else {
+		fmt.Fprintf(&b, "Content-Type: text/plain\r\n\r\n%s\r\n", m.Body)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func TestSearchSharedCases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox")
+	messages := searchtest.Messages()
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString(sampleMessage(m))
+	}
+	writeFile(t, path, b.String())
+	p := newProvider(t, path)
+
+	for _, tc := range searchtest.Cases {
+		results, err := p.Search(context.Background(), "INBOX", backend.ParseSearchQuery(tc.Query))
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tc.Query, err)
+		}
+		matched := make(map[string]bool)
+		for _, r := range results {
+			matched[r.Subject] = true
+		}
+		var got []string
+		for _, m := range messages {
+			if matched[m.Subject] {
+				got = append(got, m.ID)
+			}
+		}
+		if !slices.Equal(got, tc.Want) {
+			t.Errorf("%q matched %v, want %v", tc.Query, got, tc.Want)
+		}
+	}
+}
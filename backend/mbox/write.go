@@ -0,0 +1,104 @@
+package mbox
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileMu keeps readers from opening an mbox file while it is being
+// replaced, and serializes rewrites within the process.
+var fileMu sync.RWMutex
+
+// rewriteFile replaces the locked file l with what write produces. The new
+// contents go to a temporary file in the same directory, which is synced
+// and renamed over the file, so it is never seen half-written. Nothing is
+// replaced if the file changed since it was locked.
+func rewriteFile(l *lockedFile, write func(w *bufio.Writer) error) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), "."+filepath.Base(l.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()           //nolint:errcheck,gosec
+			os.Remove(tmp.Name()) //nolint:errcheck,gosec
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(l.info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := l.unchanged(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+	forgetIndex(l.name)
+	forgetIndex(l.path)
+	return nil
+}
+
+// copyEntries writes the messages of f listed in entries, each with its
+// "From " line and followed by a blank line. The bytes are copied as they
+// are on disk, so their ">From " quoting is kept.
+func copyEntries(w *bufio.Writer, f io.ReaderAt, entries []entry) error {
+	for _, e := range entries {
+		if _, err := io.Copy(w, io.NewSectionReader(f, e.from, e.end-e.from)); err != nil {
+			return err
+		}
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, e.end-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			w.WriteByte('\n') //nolint:errcheck,gosec
+		}
+		w.WriteByte('\n') //nolint:errcheck,gosec
+	}
+	return nil
+}
+
+// copyFile writes all of f, followed by enough newlines that a message
+// appended after it starts after a blank line.
+func copyFile(w *bufio.Writer, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(f, 0, size)); err != nil {
+		return err
+	}
+
+	tail := make([]byte, min(size, 2))
+	if _, err := f.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return err
+	}
+	switch {
+	case tail[len(tail)-1] != '\n':
+		w.WriteString("\n\n") //nolint:errcheck,gosec
+	case len(tail) < 2 || tail[0] != '\n':
+		w.WriteByte('\n') //nolint:errcheck,gosec
+	}
+	return nil
+}
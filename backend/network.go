@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// IsNetworkError reports whether err means the server could not be reached,
+// as opposed to the server rejecting the operation. Callers use it to decide
+// whether an action is worth retrying once connectivity returns.
+func IsNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// Covers dial, DNS and timeout errors, including those wrapped in
+	// *url.Error by HTTP-based backends.
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH)
+}
+
+// IsTimeout reports whether err is a timeout on an established connection.
+// Unlike a failure to connect, the server may have received the request
+// and acted on it before the answer was lost.
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"context"
+	"sync"
+)
+
+// WatchFolders watches several folders of a provider. It uses the provider's
+// WatchFolders if it implements FoldersNotifier, and otherwise calls Watch
+// for each folder and merges the events. The returned function stops all
+// watches; the channel is closed once they have stopped. If one of the
+// merged watches ends on its own, the others are stopped too, so the caller
+// sees the whole watch end and can restart it.
+func WatchFolders(ctx context.Context, n Notifier, folders []string) (<-chan NotifyEvent, func(), error) {
+	if fn, ok := n.(FoldersNotifier); ok {
+		return fn.WatchFolders(ctx, folders)
+	}
+
+	var (
+		chans   []<-chan NotifyEvent
+		cancels []func()
+	)
+	stopAll := func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+	for _, folder := range folders {
+		ch, cancel, err := n.Watch(ctx, folder)
+		if err != nil {
+			stopAll()
+			return nil, nil, err
+		}
+		chans = append(chans, ch)
+		cancels = append(cancels, cancel)
+	}
+
+	out := make(chan NotifyEvent, 16)
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			stopAll()
+		})
+	}
+	var wg sync.WaitGroup
+	for _, ch := range chans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Keep draining after a stop, so no watch blocks on sending.
+			for ev := range ch {
+				select {
+				case out <- ev:
+				case <-done:
+				}
+			}
+			stop()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, stop, nil
+}
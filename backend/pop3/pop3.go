@@ -189,6 +189,22 @@ func (p *Provider) MarkAsUnread(_ context.Context, _ string, _ uint32) error {
 	return nil
 }
 
+func (p *Provider) MarkFlagged(_ context.Context, _ string, _ uint32) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) MarkUnflagged(_ context.Context, _ string, _ uint32) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) AddLabel(_ context.Context, _ string, _ uint32, _ string) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) RemoveLabel(_ context.Context, _ string, _ uint32, _ string) error {
+	return backend.ErrNotSupported
+}
+
 func (p *Provider) DeleteEmail(ctx context.Context, folder string, uid uint32) error {
 	return p.DeleteEmails(ctx, folder, []uint32{uid})
 }
@@ -257,6 +273,26 @@ func (p *Provider) FetchFolders(_ context.Context) ([]backend.Folder, error) {
 	}, nil
 }
 
+func (p *Provider) CreateFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) RenameFolder(_ context.Context, _, _ string) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) DeleteFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) SubscribeFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
+func (p *Provider) UnsubscribeFolder(_ context.Context, _ string) error {
+	return backend.ErrNotSupported
+}
+
 func (p *Provider) Watch(_ context.Context, _ string) (<-chan backend.NotifyEvent, func(), error) {
 	return nil, nil, backend.ErrNotSupported
 }
@@ -0,0 +1,517 @@
+package backend
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchQuery is the parsed form of a user query string.
+//
+// Queries built in code set the flat fields, which are ANDed together.
+// ParseSearchQuery sets Expr to the full expression and also fills the flat
+// fields from its top-level terms, for callers that only need those.
+type SearchQuery struct {
+	Raw        string
+	From       string
+	To         string
+	Subject    string
+	Body       string
+	Since      time.Time
+	Before     time.Time
+	LargerThan int
+	// Flagged restricts results to flagged (true) or unflagged (false)
+	// messages when set.
+	Flagged *bool
+	Limit   uint32
+	// Folder is the folder named by a folder: term, searched instead of
+	// the current one.
+	Folder string
+	// Expr is the parsed expression. When nil the flat fields apply.
+	Expr *SearchExpr
+	// Err is set by ParseSearchQuery when the query cannot be run as
+	// typed, such as a folder: term under - or OR. Such a query should be
+	// reported to the user instead of searched.
+	Err error
+}
+
+// ErrFolderTerm is the Err of a query with a folder: term that is not a
+// plain top-level term, or with more than one folder: term. A search runs
+// in one folder, so folder: can only pick that folder, not be combined.
+var ErrFolderTerm = errors.New("folder: must appear once, and cannot be negated or combined with OR")
+
+// SearchOp is the kind of a SearchExpr node.
+type SearchOp int
+
+const (
+	// SearchTerm tests a single field.
+	SearchTerm SearchOp = iota
+	// SearchAnd matches when all children match.
+	SearchAnd
+	// SearchOr matches when any child matches.
+	SearchOr
+	// SearchNot matches when its only child does not.
+	SearchNot
+)
+
+// SearchField is the message property a SearchTerm tests.
+type SearchField string
+
+const (
+	SearchFrom       SearchField = "from"
+	SearchTo         SearchField = "to"
+	SearchCc         SearchField = "cc"
+	SearchSubject    SearchField = "subject"
+	SearchBody       SearchField = "body"
+	SearchSince      SearchField = "since"
+	SearchBefore     SearchField = "before"
+	SearchLarger     SearchField = "larger"
+	SearchSmaller    SearchField = "smaller"
+	SearchFlagged    SearchField = "flagged"
+	SearchRead       SearchField = "read"
+	SearchAttachment SearchField = "attachment"
+
+	// searchFolder is a folder: term. ParseSearchQuery moves it to
+	// SearchQuery.Folder, so it never appears in Expr.
+	searchFolder SearchField = "folder"
+)
+
+// SearchExpr is a node of a parsed search query.
+type SearchExpr struct {
+	Op       SearchOp
+	Children []*SearchExpr
+
+	// The remaining fields describe a SearchTerm. Which value is used
+	// depends on the field.
+	Field SearchField
+	Text  string    // from, to, cc, subject, body: substring to find
+	Time  time.Time // since (on or after), before (strictly before)
+	Size  int       // larger, smaller: bytes
+	Bool  bool      // flagged, read, attachment: wanted state
+
+	// bare marks body terms that were typed without a body: prefix.
+	bare bool
+}
+
+// Expression returns the query as an expression tree, building one from the
+// flat fields when Expr is unset. It returns nil for a query that matches
+// everything.
+func (q SearchQuery) Expression() *SearchExpr {
+	if q.Expr != nil {
+		return q.Expr
+	}
+	var terms []*SearchExpr
+	for _, t := range []struct {
+		field SearchField
+		value string
+	}{
+		{SearchFrom, q.From},
+		{SearchTo, q.To},
+		{SearchSubject, q.Subject},
+		{SearchBody, q.Body},
+	} {
+		if t.value != "" {
+			terms = append(terms, &SearchExpr{Field: t.field, Text: t.value})
+		}
+	}
+	if !q.Since.IsZero() {
+		terms = append(terms, &SearchExpr{Field: SearchSince, Time: q.Since})
+	}
+	if !q.Before.IsZero() {
+		terms = append(terms, &SearchExpr{Field: SearchBefore, Time: q.Before})
+	}
+	if q.LargerThan > 0 {
+		terms = append(terms, &SearchExpr{Field: SearchLarger, Size: q.LargerThan})
+	}
+	if q.Flagged != nil {
+		terms = append(terms, &SearchExpr{Field: SearchFlagged, Bool: *q.Flagged})
+	}
+	return combineSearch(SearchAnd, terms)
+}
+
+// ParseSearchQuery parses a compact search DSL into a SearchQuery.
+//
+// Terms are ANDed; OR between terms, a leading - for negation and
+// parentheses for grouping are supported. Besides the field:value terms,
+// is:read, is:unread, is:flagged and has:attachment test message state, and
+// since: and before: also take relative dates such as 7d, 2w, 3m or 1y.
+// A folder: term picks the folder to search and must be a plain top-level
+// term; see ErrFolderTerm.
+func ParseSearchQuery(s string) SearchQuery {
+	query := SearchQuery{Raw: s}
+	p := &searchParser{tokens: tokenizeSearchQuery(s), now: time.Now()}
+
+	var parts []*SearchExpr
+	for p.pos < len(p.tokens) {
+		if e := p.parseOr(); e != nil {
+			parts = append(parts, e)
+		}
+		// parseOr only stops early at an unmatched ")"; skip it.
+		p.pos++
+	}
+	query.Expr = query.takeFolder(combineSearch(SearchAnd, parts))
+	query.fillFlat()
+	return query
+}
+
+// takeFolder moves the folder: terms out of e into q.Folder and returns the
+// rest. Only one plain top-level folder: term is accepted; anything else
+// sets q.Err.
+func (q *SearchQuery) takeFolder(e *SearchExpr) *SearchExpr {
+	if e == nil {
+		return nil
+	}
+	if e.Op == SearchTerm && e.Field == searchFolder {
+		q.Folder = e.Text
+		return nil
+	}
+	if e.Op != SearchAnd {
+		return q.dropFolder(e)
+	}
+	var kept []*SearchExpr
+	for _, c := range e.Children {
+		if c.Op == SearchTerm && c.Field == searchFolder {
+			if q.Folder != "" {
+				q.Err = ErrFolderTerm
+			}
+			q.Folder = c.Text
+			continue
+		}
+		if c = q.dropFolder(c); c != nil {
+			kept = append(kept, c)
+		}
+	}
+	return combineSearch(SearchAnd, kept)
+}
+
+// dropFolder removes the folder: terms nested in e, setting q.Err if there
+// were any.
+func (q *SearchQuery) dropFolder(e *SearchExpr) *SearchExpr {
+	if e.Op == SearchTerm {
+		if e.Field == searchFolder {
+			q.Err = ErrFolderTerm
+			return nil
+		}
+		return e
+	}
+	var kept []*SearchExpr
+	for _, c := range e.Children {
+		if c = q.dropFolder(c); c != nil {
+			kept = append(kept, c)
+		}
+	}
+	if e.Op == SearchNot {
+		if len(kept) == 0 {
+			return nil
+		}
+		return &SearchExpr{Op: SearchNot, Children: kept}
+	}
+	return combineSearch(e.Op, kept)
+}
+
+// fillFlat sets the flat fields from the top-level terms of Expr. Explicit
+// body: terms win over bare words, which are joined.
+func (q *SearchQuery) fillFlat() {
+	if q.Expr == nil {
+		return
+	}
+	top := []*SearchExpr{q.Expr}
+	if q.Expr.Op == SearchAnd {
+		top = q.Expr.Children
+	}
+
+	var bareTerms []string
+	for _, e := range top {
+		if e.Op != SearchTerm {
+			continue
+		}
+		switch e.Field {
+		case SearchFrom:
+			q.From = e.Text
+		case SearchTo:
+			q.To = e.Text
+		case SearchSubject:
+			q.Subject = e.Text
+		case SearchBody:
+			if e.bare {
+				bareTerms = append(bareTerms, e.Text)
+			} else {
+				q.Body = e.Text
+			}
+		case SearchSince:
+			q.Since = e.Time
+		case SearchBefore:
+			q.Before = e.Time
+		case SearchLarger:
+			q.LargerThan = e.Size
+		case SearchFlagged:
+			flagged := e.Bool
+			q.Flagged = &flagged
+		}
+	}
+	if q.Body == "" && len(bareTerms) > 0 {
+		q.Body = strings.Join(bareTerms, " ")
+	}
+}
+
+// combineSearch joins children under op, collapsing trivial nodes.
+func combineSearch(op SearchOp, children []*SearchExpr) *SearchExpr {
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+	return &SearchExpr{Op: op, Children: children}
+}
+
+type searchToken struct {
+	text string
+	// quoted tokens are never operators.
+	quoted bool
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+	now    time.Time
+}
+
+func (p *searchParser) peekOperator(op string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].text == op
+}
+
+// parseOr parses terms separated by OR, stopping at ")" or the end.
+func (p *searchParser) parseOr() *SearchExpr {
+	var children []*SearchExpr
+	for {
+		if e := p.parseAnd(); e != nil {
+			children = append(children, e)
+		}
+		if !p.peekOperator("OR") {
+			break
+		}
+		p.pos++
+	}
+	return combineSearch(SearchOr, children)
+}
+
+// parseAnd parses a run of terms, stopping at OR, ")" or the end.
+func (p *searchParser) parseAnd() *SearchExpr {
+	var children []*SearchExpr
+	for p.pos < len(p.tokens) && !p.peekOperator("OR") && !p.peekOperator(")") {
+		if e := p.parseUnary(); e != nil {
+			children = append(children, e)
+		}
+	}
+	return combineSearch(SearchAnd, children)
+}
+
+func (p *searchParser) parseUnary() *SearchExpr {
+	tok := p.tokens[p.pos]
+	p.pos++
+	if tok.quoted {
+		return p.term(tok.text)
+	}
+
+	switch {
+	case tok.text == "(":
+		e := p.parseOr()
+		if p.peekOperator(")") {
+			p.pos++
+		}
+		return e
+	case tok.text == "AND":
+		return nil
+	case tok.text == "-":
+		if p.pos >= len(p.tokens) || p.peekOperator(")") || p.peekOperator("OR") {
+			return nil
+		}
+		return negateSearch(p.parseUnary())
+	case strings.HasPrefix(tok.text, "-"):
+		return negateSearch(p.term(tok.text[1:]))
+	}
+	return p.term(tok.text)
+}
+
+func negateSearch(e *SearchExpr) *SearchExpr {
+	if e == nil {
+		return nil
+	}
+	return &SearchExpr{Op: SearchNot, Children: []*SearchExpr{e}}
+}
+
+// term parses a single field:value term. Unknown fields and bare words
+// search the body; malformed values are dropped.
+func (p *searchParser) term(text string) *SearchExpr {
+	key, value, ok := strings.Cut(text, ":")
+	if !ok || value == "" {
+		return &SearchExpr{Field: SearchBody, Text: text, bare: true}
+	}
+
+	switch strings.ToLower(key) {
+	case "from":
+		return &SearchExpr{Field: SearchFrom, Text: value}
+	case "to":
+		return &SearchExpr{Field: SearchTo, Text: value}
+	case "cc":
+		return &SearchExpr{Field: SearchCc, Text: value}
+	case "subject":
+		return &SearchExpr{Field: SearchSubject, Text: value}
+	case "body":
+		return &SearchExpr{Field: SearchBody, Text: value}
+	case "since", "before":
+		t, ok := parseSearchDate(value, p.now)
+		if !ok {
+			return nil
+		}
+		field := SearchSince
+		if strings.EqualFold(key, "before") {
+			field = SearchBefore
+		}
+		return &SearchExpr{Field: field, Time: t}
+	case "larger", "smaller":
+		n, ok := parseSearchSize(value)
+		if !ok {
+			return nil
+		}
+		field := SearchLarger
+		if strings.EqualFold(key, "smaller") {
+			field = SearchSmaller
+		}
+		return &SearchExpr{Field: field, Size: n}
+	case "flagged":
+		flagged, ok := parseSearchBool(value)
+		if !ok {
+			return nil
+		}
+		return &SearchExpr{Field: SearchFlagged, Bool: flagged}
+	case "is":
+		switch strings.ToLower(value) {
+		case "read":
+			return &SearchExpr{Field: SearchRead, Bool: true}
+		case "unread":
+			return &SearchExpr{Field: SearchRead, Bool: false}
+		case "flagged":
+			return &SearchExpr{Field: SearchFlagged, Bool: true}
+		}
+	case "has":
+		if strings.EqualFold(value, "attachment") {
+			return &SearchExpr{Field: SearchAttachment, Bool: true}
+		}
+	case "folder":
+		return &SearchExpr{Field: searchFolder, Text: value}
+	}
+	return &SearchExpr{Field: SearchBody, Text: text, bare: true}
+}
+
+// tokenizeSearchQuery splits a query on whitespace. Quotes group words and
+// are removed; unquoted parentheses are tokens of their own.
+func tokenizeSearchQuery(s string) []searchToken {
+	var tokens []searchToken
+	var b strings.Builder
+	var quote rune
+	quoted := false
+
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, searchToken{text: b.String(), quoted: quoted})
+			b.Reset()
+		}
+		quoted = false
+	}
+
+	for _, r := range s {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+				continue
+			}
+			b.WriteRune(r)
+			continue
+		}
+		switch {
+		case r == '"' || r == '\'':
+			// A leading "-" negates the quoted phrase.
+			if b.String() == "-" && !quoted {
+				b.Reset()
+				tokens = append(tokens, searchToken{text: "-"})
+			}
+			quote = r
+			quoted = true
+		case r == '(' || r == ')':
+			// Likewise for a group.
+			if b.String() == "-" && r == '(' && !quoted {
+				b.Reset()
+				tokens = append(tokens, searchToken{text: "-"})
+			} else {
+				flush()
+			}
+			tokens = append(tokens, searchToken{text: string(r)})
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func parseSearchBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "yes", "true", "1":
+		return true, true
+	case "no", "false", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// parseSearchDate accepts a date, an RFC 3339 timestamp, or a duration back
+// from now in days, weeks, months or years (7d, 2w, 3m, 1y).
+func parseSearchDate(value string, now time.Time) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	if len(value) < 2 {
+		return time.Time{}, false
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	switch unicode.ToLower(rune(value[len(value)-1])) {
+	case 'd':
+		return now.AddDate(0, 0, -n), true
+	case 'w':
+		return now.AddDate(0, 0, -7*n), true
+	case 'm':
+		return now.AddDate(0, -n, 0), true
+	case 'y':
+		return now.AddDate(-n, 0, 0), true
+	}
+	return time.Time{}, false
+}
+
+// parseSearchSize accepts a byte count with an optional k or m suffix.
+func parseSearchSize(value string) (int, bool) {
+	mult := 1
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		mult, value = 1024, value[:len(value)-1]
+	case "m":
+		mult, value = 1024*1024, value[:len(value)-1]
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n * mult, true
+}
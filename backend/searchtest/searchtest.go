@@ -0,0 +1,106 @@
+// Package searchtest holds the search cases every backend's query
+// translation is tested against, so IMAP, JMAP and Maildir agree on what a
+// query means.
+package searchtest
+
+import (
+	"strings"
+	"time"
+)
+
+// Message is a sample message. Backends load the messages into their own
+// store, or evaluate their translated query against them directly.
+type Message struct {
+	ID      string
+	From    string
+	To      []string
+	Cc      []string
+	Subject string
+	Body    string
+	Date    time.Time
+
+	Read          bool
+	Flagged       bool
+	HasAttachment bool
+}
+
+// Size is the size the cases assume for the message. Backends that count
+// headers too see a slightly larger size; the cases leave room for that.
+func (m Message) Size() int { return len(m.Body) }
+
+// Case is a query and the IDs of the messages it matches, in Messages order.
+type Case struct {
+	Query string
+	Want  []string
+}
+
+// Messages returns the sample messages. Some are dated relative to now so
+// relative date terms have something to match.
+func Messages() []Message {
+	now := time.Now()
+	return []Message{
+		{
+			ID:            "invoice",
+			From:          "Alice <alice@example.com>",
+			To:            []string{"bob@example.com"},
+			Cc:            []string{"carol@example.com"},
+			Subject:       "Quarterly invoice",
+			Body:          "Payment is due next week.",
+			Date:          now.AddDate(0, 0, -2),
+			Flagged:       true,
+			HasAttachment: true,
+		},
+		{
+			ID:      "lunch",
+			From:    "Bob <bob@example.com>",
+			To:      []string{"alice@example.com"},
+			Subject: "Lunch on Friday?",
+			Body:    "The ramen place again?",
+			Date:    now.AddDate(0, 0, -10),
+			Read:    true,
+		},
+		{
+			ID:            "report",
+			From:          "Carol <carol@example.org>",
+			To:            []string{"alice@example.com"},
+			Cc:            []string{"bob@example.com"},
+			Subject:       "Annual report",
+			Body:          strings.Repeat("Revenue grew in every region. ", 700),
+			Date:          time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC),
+			Read:          true,
+			HasAttachment: true,
+		},
+		{
+			ID:      "newsletter",
+			From:    "News <news@example.net>",
+			To:      []string{"alice@example.com"},
+			Subject: "Weekly digest",
+			Body:    "Top stories this week: invoice fraud on the rise.",
+			Date:    now.AddDate(0, 0, -40),
+		},
+	}
+}
+
+// Cases are the queries every backend must answer the same way.
+var Cases = []Case{
+	{Query: "from:alice", Want: []string{"invoice"}},
+	{Query: "from:alice OR from:carol", Want: []string{"invoice", "report"}},
+	{Query: "invoice", Want: []string{"newsletter"}},
+	{Query: "-from:news", Want: []string{"invoice", "lunch", "report"}},
+	{Query: "is:unread", Want: []string{"invoice", "newsletter"}},
+	{Query: "is:read", Want: []string{"lunch", "report"}},
+	{Query: "is:flagged", Want: []string{"invoice"}},
+	{Query: "flagged:no is:unread", Want: []string{"newsletter"}},
+	{Query: "has:attachment", Want: []string{"invoice", "report"}},
+	{Query: "-has:attachment", Want: []string{"lunch", "newsletter"}},
+	{Query: "cc:bob", Want: []string{"report"}},
+	{Query: "larger:10k", Want: []string{"report"}},
+	{Query: "smaller:10k", Want: []string{"invoice", "lunch", "newsletter"}},
+	{Query: "since:7d", Want: []string{"invoice"}},
+	{Query: "before:30d", Want: []string{"report", "newsletter"}},
+	{Query: "before:2025-12-31", Want: []string{"report"}},
+	{Query: `subject:"annual report"`, Want: []string{"report"}},
+	{Query: "(from:bob OR from:carol) is:read", Want: []string{"lunch", "report"}},
+	{Query: "is:unread -(from:news OR subject:digest)", Want: []string{"invoice"}},
+	{Query: "to:alice -subject:lunch since:60d", Want: []string{"newsletter"}},
+}
@@ -1,6 +1,8 @@
 package cli
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,15 +11,29 @@ import (
 	"strings"
 
 	"github.com/floatpane/matcha/internal/httpclient"
+	"github.com/floatpane/matcha/plugin"
 )
 
-// RunInstall handles `matcha install <url_or_file>`.
+// RunInstall handles `matcha install [--yes] <url_or_file>`.
 func RunInstall(args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("usage: matcha install <url_or_file>")
-	}
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "grant the plugin's permissions without asking")
+	fs.BoolVar(yes, "y", false, "shorthand for --yes")
 
-	source := args[0]
+	// The source may come before the flags.
+	var source string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		source, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if source == "" {
+		source = fs.Arg(0)
+	}
+	if source == "" {
+		return fmt.Errorf("usage: matcha install [--yes] <url_or_file>")
+	}
 	var data []byte
 	var filename string
 
@@ -60,13 +76,38 @@ func RunInstall(args []string) error {
 	if err != nil {
 		return err
 	}
+	return installPlugin(os.Stdout, os.Stdin, data, filename, pluginsDir, *yes)
+}
+
+// installPlugin asks the user to grant the permissions the plugin declares,
+// unless yes is set, and writes it to dir.
+func installPlugin(w io.Writer, stdin io.Reader, data []byte, filename, dir string, yes bool) error {
+	mf, err := plugin.ParseManifest(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if perms := mf.Summary(); len(perms) > 0 {
+		fmt.Fprintf(w, "%s asks for permission to:\n", filename)
+		for _, p := range perms {
+			fmt.Fprintf(w, "  - %s\n", p)
+		}
+		if !yes {
+			fmt.Fprint(w, "Install? [y/N] ")
+			answer, _ := bufio.NewReader(stdin).ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer != "y" && answer != "yes" {
+				return fmt.Errorf("installation cancelled")
+			}
+		}
+	}
 
-	dest := filepath.Join(pluginsDir, filename)
+	dest := filepath.Join(dir, filename)
 	if err := os.WriteFile(dest, data, 0644); err != nil { //nolint:gosec
 		return fmt.Errorf("failed to write plugin: %w", err)
 	}
 
-	fmt.Printf("Installed %s to %s\n", filename, dest)
+	fmt.Fprintf(w, "Installed %s to %s\n", filename, dest)
 	return nil
 }
 
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallPluginAsksForPermissions(t *testing.T) {
+	src := []byte("-- @permission network api.example.com\n-- @permission storage\nlocal matcha = require(\"matcha\")\n")
+
+	dir := t.TempDir()
+	var out bytes.Buffer
+	if err := installPlugin(&out, strings.NewReader("n\n"), src, "sync.lua", dir, false); err == nil {
+		t.Fatal("declined install succeeded")
+	}
+	if !strings.Contains(out.String(), "Connect to api.example.com") || !strings.Contains(out.String(), "Store data") {
+		t.Errorf("prompt did not list the permissions:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sync.lua")); err == nil {
+		t.Error("declined plugin was written")
+	}
+
+	if err := installPlugin(&out, strings.NewReader("y\n"), src, "sync.lua", dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "sync.lua")); !bytes.Equal(got, src) {
+		t.Errorf("installed %q", got)
+	}
+
+	// Plugins without permissions, and --yes, install without asking.
+	for _, tc := range []struct {
+		file string
+		src  string
+		yes  bool
+	}{
+		{"hello.lua", "local matcha = require(\"matcha\")\n", false},
+		{"sync2.lua", string(src), true},
+	} {
+		if err := installPlugin(&out, strings.NewReader(""), []byte(tc.src), tc.file, dir, tc.yes); err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+		}
+	}
+
+	if err := installPlugin(&out, strings.NewReader("y\n"), []byte("-- @permission everything\n"), "bad.lua", dir, true); err == nil {
+		t.Error("plugin with an invalid manifest was installed")
+	}
+}
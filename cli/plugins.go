@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/floatpane/matcha/plugins"
+)
+
+// RunPlugins dispatches `matcha plugins <subcommand>`.
+func RunPlugins(args []string) error {
+	if len(args) == 0 {
+		return pluginsUsage()
+	}
+	switch args[0] {
+	case "list", "ls":
+		return RunPluginsList(args[1:])
+	case "update":
+		return RunPluginsUpdate(args[1:])
+	default:
+		return pluginsUsage()
+	}
+}
+
+func pluginsUsage() error {
+	return fmt.Errorf("usage:\n  matcha plugins list [--outdated]\n  matcha plugins update [--yes] [name...]")
+}
+
+// RunPluginsList prints the installed marketplace plugins and their versions.
+func RunPluginsList(args []string) error {
+	fs := flag.NewFlagSet("plugins list", flag.ExitOnError)
+	outdated := fs.Bool("outdated", false, "only list plugins with an update available")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := plugins.FetchRegistry()
+	if err != nil {
+		return err
+	}
+	dir, err := pluginsDir()
+	if err != nil {
+		return err
+	}
+	return listPlugins(os.Stdout, entries, dir, *outdated)
+}
+
+// RunPluginsUpdate updates the named plugins, or all outdated ones.
+func RunPluginsUpdate(args []string) error {
+	fs := flag.NewFlagSet("plugins update", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "grant the plugins' permissions without asking")
+	fs.BoolVar(yes, "y", false, "shorthand for --yes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := plugins.FetchRegistry()
+	if err != nil {
+		return err
+	}
+	dir, err := pluginsDir()
+	if err != nil {
+		return err
+	}
+	return updatePlugins(os.Stdout, os.Stdin, entries, dir, fs.Args(), *yes, plugins.FetchPlugin)
+}
+
+// installedEntry is a registry plugin found in the plugins directory.
+type installedEntry struct {
+	entry   plugins.PluginEntry
+	version string // "" if unknown
+}
+
+// installedEntries returns the registry entries that are installed in dir.
+func installedEntries(entries []plugins.PluginEntry, dir string) ([]installedEntry, error) {
+	installed, err := plugins.LoadInstalled(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", plugins.InstalledFile, err)
+	}
+	var result []installedEntry
+	for _, e := range entries {
+		if version, ok := plugins.InstalledVersion(dir, e, installed); ok {
+			result = append(result, installedEntry{entry: e, version: version})
+		}
+	}
+	return result, nil
+}
+
+func listPlugins(w io.Writer, entries []plugins.PluginEntry, dir string, outdatedOnly bool) error {
+	list, err := installedEntries(entries, dir)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tINSTALLED\tLATEST\t")
+	shown := 0
+	for _, p := range list {
+		outdated := p.entry.Outdated(p.version)
+		if outdatedOnly && !outdated {
+			continue
+		}
+		version, note := p.version, ""
+		if version == "" {
+			version = "unknown"
+		}
+		if outdated {
+			note = "update available"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.entry.Name, version, p.entry.Version, note)
+		shown++
+	}
+	if shown == 0 {
+		if outdatedOnly {
+			fmt.Fprintln(w, "All plugins are up to date.")
+		} else {
+			fmt.Fprintln(w, "No marketplace plugins installed.")
+		}
+		return nil
+	}
+	return tw.Flush()
+}
+
+// updatePlugins installs the registry version of the named plugins, or of
+// every outdated plugin when names is empty.
+func updatePlugins(w io.Writer, stdin io.Reader, entries []plugins.PluginEntry, dir string, names []string, yes bool, fetch func(plugins.PluginEntry) ([]byte, error)) error {
+	list, err := installedEntries(entries, dir)
+	if err != nil {
+		return err
+	}
+	// Share one buffer between the permission prompts.
+	stdin = bufio.NewReader(stdin)
+
+	var updates []installedEntry
+	if len(names) == 0 {
+		for _, p := range list {
+			if p.entry.Outdated(p.version) {
+				updates = append(updates, p)
+			}
+		}
+		if len(updates) == 0 {
+			fmt.Fprintln(w, "All plugins are up to date.")
+			return nil
+		}
+	}
+	for _, name := range names {
+		found := false
+		for _, p := range list {
+			if p.entry.Name == name {
+				updates = append(updates, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not an installed marketplace plugin", name)
+		}
+	}
+
+	for _, p := range updates {
+		if p.version != "" && !p.entry.Outdated(p.version) {
+			fmt.Fprintf(w, "%s is up to date (%s)\n", p.entry.Name, p.version)
+			continue
+		}
+		data, err := fetch(p.entry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.entry.Name, err)
+		}
+		if err := installPlugin(w, stdin, data, p.entry.File, dir, yes); err != nil {
+			return fmt.Errorf("%s: %w", p.entry.Name, err)
+		}
+		if err := plugins.RecordInstalled(dir, p.entry); err != nil {
+			return fmt.Errorf("failed to record %s version: %w", p.entry.Name, err)
+		}
+		from := p.version
+		if from == "" {
+			from = "unknown"
+		}
+		fmt.Fprintf(w, "Updated %s %s -> %s\n", p.entry.Name, from, p.entry.Version)
+	}
+	return nil
+}
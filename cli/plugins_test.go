@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/floatpane/matcha/plugins"
+)
+
+func TestUpdatePlugins(t *testing.T) {
+	dir := t.TempDir()
+	v1 := []byte("-- hello v1\n")
+	v2 := []byte("-- hello v2\n")
+	sum := sha256.Sum256(v2)
+	hello := plugins.PluginEntry{Name: "hello", File: "hello.lua", Version: "1.1.0", SHA256: hex.EncodeToString(sum[:])}
+	other := plugins.PluginEntry{Name: "other", File: "other.lua", Version: "1.0.0"}
+	entries := []plugins.PluginEntry{hello, other}
+
+	os.WriteFile(filepath.Join(dir, "hello.lua"), v1, 0644) //nolint:errcheck
+	old := hello
+	old.Version = "1.0.0"
+	if err := plugins.RecordInstalled(dir, old); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := listPlugins(&out, entries, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "hello") || !strings.Contains(out.String(), "update available") || strings.Contains(out.String(), "other") {
+		t.Errorf("list --outdated:\n%s", out.String())
+	}
+
+	fetch := func(e plugins.PluginEntry) ([]byte, error) { return v2, e.Verify(v2) }
+	if err := updatePlugins(&out, strings.NewReader(""), entries, dir, nil, false, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "hello.lua")); !bytes.Equal(got, v2) {
+		t.Errorf("hello.lua = %q after update", got)
+	}
+
+	out.Reset()
+	if err := listPlugins(&out, entries, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "up to date") {
+		t.Errorf("list --outdated after update:\n%s", out.String())
+	}
+
+	if err := updatePlugins(&out, strings.NewReader(""), entries, dir, []string{"other"}, false, fetch); err == nil {
+		t.Error("updating a plugin that is not installed succeeded")
+	}
+}
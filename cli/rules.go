@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/rules"
+)
+
+// RunRules handles `matcha rules <test>`.
+func RunRules(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Println("Usage: matcha rules test <rule> [--folder INBOX] [--headers]")
+		return nil
+	}
+	return runRulesTest(args[1:])
+}
+
+func runRulesTest(args []string) error {
+	fs := flag.NewFlagSet("rules test", flag.ExitOnError)
+	folder := fs.String("folder", "INBOX", "cached folder to test the rule against")
+	headers := fs.Bool("headers", false, "fetch headers and sizes from the server for header and size conditions")
+	help := fs.Bool("h", false, "show help")
+
+	// The rule name may come before the flags.
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if name == "" {
+		name = fs.Arg(0)
+	}
+
+	if *help || name == "" {
+		fmt.Println("Usage: matcha rules test <rule> [flags]")
+		fmt.Println("")
+		fmt.Println("Report which cached emails a rule would match, without changing anything.")
+		fmt.Println("")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+		fmt.Println("")
+		fmt.Println("Examples:")
+		fmt.Println(`  matcha rules test CI`)
+		fmt.Println(`  matcha rules test "Big mail" --folder Archive --headers`)
+		return nil
+	}
+
+	if config.IsSecureModeEnabled() {
+		password, err := promptForPassword()
+		if err != nil {
+			return fmt.Errorf("password prompt failed: %w", err)
+		}
+		key, err := config.VerifyPassword(password)
+		if err != nil {
+			return fmt.Errorf("incorrect password")
+		}
+		config.SetSessionKey(key)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	return testRule(os.Stdout, cfg, name, *folder, *headers)
+}
+
+// testRule writes the emails in a cached folder that the named rule would
+// match. Header and size conditions only match when headers is set.
+func testRule(w io.Writer, cfg *config.Config, name, folder string, headers bool) error {
+	rule, ok := rules.Find(cfg.Rules, name)
+	if !ok {
+		return fmt.Errorf("no rule named %q", name)
+	}
+	if err := rules.Validate(rule); err != nil {
+		return err
+	}
+	cached, err := config.LoadFolderEmailCache(folder)
+	if err != nil {
+		return fmt.Errorf("no cached emails for %s: %w", folder, err)
+	}
+
+	byAccount := make(map[string][]config.CachedEmail)
+	for _, e := range cached {
+		byAccount[e.AccountID] = append(byAccount[e.AccountID], e)
+	}
+	var matched []rules.Message
+	for i := range cfg.Accounts {
+		acct := &cfg.Accounts[i]
+		msgs, err := rules.Messages(acct, folder, byAccount[acct.ID], headers)
+		if err != nil {
+			fmt.Fprintf(w, "warning: could not fetch headers for %s: %v\n", acct.Email, err)
+		}
+		for _, msg := range msgs {
+			if rules.Match(rule, msg) {
+				matched = append(matched, msg)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Rule %q: %s\n", rule.Name, rules.Describe(rule))
+	if !headers && rules.NeedsHeaders([]config.Rule{rule}) {
+		fmt.Fprintln(w, "Header and size conditions need --headers; without it they match nothing.")
+	}
+	fmt.Fprintf(w, "%d of %d cached emails in %s would match.\n", len(matched), len(cached), folder)
+	for _, msg := range matched {
+		e := msg.Email
+		account := e.AccountID
+		if msg.Account != nil {
+			account = msg.Account.Email
+		}
+		fmt.Fprintf(w, "  %s  %-30s  %s  (%s)\n", e.Date.Format("2006-01-02 15:04"), e.From, e.Subject, account)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/floatpane/matcha/config"
+)
+
+func TestTestRuleReportsCachedMatches(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	date := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	if err := config.SaveFolderEmailCache("INBOX", []config.CachedEmail{
+		{UID: 1, AccountID: "work", From: "ci@example.com", Subject: "Build failed", Date: date},
+		{UID: 2, AccountID: "work", From: "alice@example.com", Subject: "Lunch", Date: date},
+		{UID: 3, AccountID: "home", From: "ci@example.com", Subject: "Build passed", Date: date},
+	}); err != nil {
+		t.Fatalf("SaveFolderEmailCache: %v", err)
+	}
+	cfg := &config.Config{
+		Accounts: []config.Account{{ID: "work", Email: "me@work.example"}},
+		Rules: []config.Rule{{
+			Name:    "CI",
+			Match:   config.RuleMatch{From: "ci@"},
+			Actions: []config.RuleAction{{Type: "move", Folder: "CI"}, {Type: "mark_read"}},
+		}},
+	}
+
+	var out bytes.Buffer
+	if err := testRule(&out, cfg, "ci", "INBOX", false); err != nil {
+		t.Fatalf("testRule: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		`Rule "CI": move to CI, mark read`,
+		"1 of 3 cached emails in INBOX would match.",
+		"2026-03-01 09:30  ci@example.com",
+		"Build failed  (me@work.example)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Build passed") {
+		t.Errorf("mail of an unconfigured account was reported:\n%s", got)
+	}
+
+	if err := testRule(&out, cfg, "missing", "INBOX", false); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
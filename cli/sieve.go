@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/sieve"
+)
+
+// RunSieve handles `matcha sieve <list|get|put|activate>`.
+func RunSieve(args []string) error {
+	if len(args) == 0 {
+		printSieveUsage()
+		return nil
+	}
+	cmd := args[0]
+	switch cmd {
+	case "list", "get", "put", "activate":
+	default:
+		printSieveUsage()
+		return nil
+	}
+
+	fs := flag.NewFlagSet("sieve "+cmd, flag.ExitOnError)
+	accountFlag := fs.String("account", "", "account email or ID (defaults to the first account)")
+	server := fs.String("server", "", `ManageSieve server as "host:port" (defaults to the account's)`)
+	help := fs.Bool("h", false, "show help")
+
+	// Script names and files may come before the flags.
+	var pos []string
+	rest := args[1:]
+	for len(rest) > 0 && (!strings.HasPrefix(rest[0], "-") || rest[0] == "-") {
+		pos, rest = append(pos, rest[0]), rest[1:]
+	}
+	if err := fs.Parse(rest); err != nil {
+		return err
+	}
+	pos = append(pos, fs.Args()...)
+
+	want := map[string]int{"list": 0, "get": 1, "put": 1, "activate": 1}[cmd]
+	if *help || len(pos) < want {
+		printSieveUsage()
+		fmt.Println("")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+		return nil
+	}
+
+	if config.IsSecureModeEnabled() {
+		password, err := promptForPassword()
+		if err != nil {
+			return fmt.Errorf("password prompt failed: %w", err)
+		}
+		key, err := config.VerifyPassword(password)
+		if err != nil {
+			return fmt.Errorf("incorrect password")
+		}
+		config.SetSessionKey(key)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	account, err := sieveAccount(cfg, *accountFlag)
+	if err != nil {
+		return err
+	}
+	c, err := sieve.Connect(account, *server)
+	if err != nil {
+		return err
+	}
+	defer c.Logout() //nolint:errcheck
+
+	return runSieve(os.Stdout, os.Stdin, c, cmd, pos)
+}
+
+func printSieveUsage() {
+	fmt.Println("Usage: matcha sieve <command> [flags]")
+	fmt.Println("")
+	fmt.Println("Manage server-side Sieve filters over ManageSieve.")
+	fmt.Println("")
+	fmt.Println("Commands:")
+	fmt.Println("  list                  list scripts; the active one is marked with *")
+	fmt.Println("  get <name>            print a script")
+	fmt.Println("  put <name> [file|-]   upload a script from a file or stdin")
+	fmt.Println("  activate <name>       make a script the active one")
+	fmt.Println("")
+	fmt.Println("Examples:")
+	fmt.Println(`  matcha sieve list --account me@example.com`)
+	fmt.Println(`  matcha sieve get main > main.sieve`)
+	fmt.Println(`  matcha sieve put main main.sieve && matcha sieve activate main`)
+}
+
+// sieveAccount finds the account to manage by email or ID, defaulting to
+// the first one.
+func sieveAccount(cfg *config.Config, want string) (*config.Account, error) {
+	if !cfg.HasAccounts() {
+		return nil, fmt.Errorf("no accounts configured")
+	}
+	if want == "" {
+		return &cfg.Accounts[0], nil
+	}
+	for i := range cfg.Accounts {
+		acct := &cfg.Accounts[i]
+		if strings.EqualFold(acct.Email, want) || strings.EqualFold(acct.FetchEmail, want) || acct.ID == want {
+			return acct, nil
+		}
+	}
+	return nil, fmt.Errorf("no account found matching %q", want)
+}
+
+// runSieve runs one sieve command on an authenticated client.
+func runSieve(w io.Writer, stdin io.Reader, c *sieve.Client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		scripts, err := c.ListScripts()
+		if err != nil {
+			return err
+		}
+		if len(scripts) == 0 {
+			fmt.Fprintln(w, "No scripts.")
+		}
+		for _, s := range scripts {
+			mark := " "
+			if s.Active {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "%s %s\n", mark, s.Name)
+		}
+	case "get":
+		content, err := c.GetScript(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, content)
+	case "put":
+		in := stdin
+		if len(args) > 1 && args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close() //nolint:errcheck
+			in = f
+		}
+		content, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		if err := c.PutScript(args[0], string(content)); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Uploaded %s.\n", args[0])
+	case "activate":
+		if err := c.SetActive(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Activated %s.\n", args[0])
+	}
+	return nil
+}
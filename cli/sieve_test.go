@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/sieve"
+	"github.com/floatpane/matcha/sieve/sievetest"
+)
+
+func TestRunSieve(t *testing.T) {
+	srv := sievetest.NewServer(t)
+	srv.SetScript("old", "keep;\n", true)
+	acct := &config.Account{Email: sievetest.Username, Password: sievetest.Password, Insecure: true}
+	c, err := sieve.Connect(acct, srv.Addr())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Logout()
+
+	script := "require \"fileinto\";\nfileinto \"Lists\";\n"
+	file := filepath.Join(t.TempDir(), "main.sieve")
+	if err := os.WriteFile(file, []byte(script), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	run := func(cmd string, args ...string) {
+		t.Helper()
+		if err := runSieve(&out, strings.NewReader("discard;\n"), c, cmd, args); err != nil {
+			t.Fatalf("sieve %s: %v", cmd, err)
+		}
+	}
+	run("put", "main", file)
+	run("put", "spam")
+	run("activate", "main")
+	if got, _ := srv.Script("main"); got != script {
+		t.Errorf("uploaded %q, want %q", got, script)
+	}
+	if got, _ := srv.Script("spam"); got != "discard;\n" {
+		t.Errorf("script from stdin = %q", got)
+	}
+	if srv.Active() != "main" {
+		t.Errorf("active script = %q", srv.Active())
+	}
+
+	out.Reset()
+	run("list")
+	if got, want := out.String(), "* main\n  old\n  spam\n"; got != want {
+		t.Errorf("list = %q, want %q", got, want)
+	}
+	out.Reset()
+	run("get", "main")
+	if out.String() != script {
+		t.Errorf("get = %q, want %q", out.String(), script)
+	}
+
+	if err := runSieve(&out, nil, c, "activate", []string{"missing"}); err == nil {
+		t.Error("activating a missing script succeeded")
+	}
+}
+
+func TestSieveAccount(t *testing.T) {
+	cfg := &config.Config{Accounts: []config.Account{
+		{ID: "a", Email: "a@example.com"},
+		{ID: "b", Email: "b@example.com", FetchEmail: "alias@example.com"},
+	}}
+	for want, id := range map[string]string{"": "a", "B@example.com": "b", "alias@example.com": "b", "b": "b"} {
+		acct, err := sieveAccount(cfg, want)
+		if err != nil || acct.ID != id {
+			t.Errorf("sieveAccount(%q) = %v, %v; want %s", want, acct, err, id)
+		}
+	}
+	if _, err := sieveAccount(cfg, "nobody@example.com"); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+}
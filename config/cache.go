@@ -22,6 +22,8 @@ type CachedEmail struct {
 	References []string  `json:"references,omitempty"`
 	AccountID  string    `json:"account_id"`
 	IsRead     bool      `json:"is_read"`
+	IsFlagged  bool      `json:"is_flagged,omitempty"`
+	Labels     []string  `json:"labels,omitempty"`
 }
 
 // EmailCache stores cached emails for all accounts.
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -45,6 +46,9 @@ var cacheFiles = []string{
 	"contacts.json",
 	"drafts.json",
 	"folder_cache.json",
+	"outbox.json",
+	"search_index.json",
+	"journal.json",
 }
 
 var cacheDirectories = []string{
@@ -102,11 +106,24 @@ type Account struct {
 	PassCmd string `json:"pass_cmd,omitempty"`
 
 	// Multi-protocol settings
-	Protocol     string `json:"protocol,omitempty"`      // "imap" (default), "jmap", or "pop3"
+	Protocol     string `json:"protocol,omitempty"`      // "imap" (default), "jmap", "pop3", "maildir", or "mbox"
 	JMAPEndpoint string `json:"jmap_endpoint,omitempty"` // JMAP session URL (for protocol=jmap)
 	POP3Server   string `json:"pop3_server,omitempty"`   // POP3 server hostname (for protocol=pop3)
 	POP3Port     int    `json:"pop3_port,omitempty"`     // POP3 server port (for protocol=pop3)
 	MaildirPath  string `json:"maildir_path,omitempty"`  // Local Maildir root (for protocol=maildir)
+	MboxPath     string `json:"mbox_path,omitempty"`     // mbox file or directory of mbox files (for protocol=mbox)
+
+	// SendmailCommand is a sendmail-compatible command (e.g. "msmtp -a work"
+	// or "sendmail -t") that outgoing mail is piped to instead of SMTP.
+	SendmailCommand string `json:"sendmail_command,omitempty"`
+
+	// SieveServer is the ManageSieve "host[:port]" for server-side filters.
+	// If empty, the IMAP host on the default ManageSieve port is used.
+	SieveServer string `json:"sieve_server,omitempty"`
+
+	// WatchFolders lists the folders the daemon watches for new mail.
+	// If empty, only INBOX is watched.
+	WatchFolders []string `json:"watch_folders,omitempty"`
 
 	// Per-account signature (overrides global signature)
 	Signature string `json:"signature,omitempty"`
@@ -118,6 +135,44 @@ type MailingList struct {
 	Addresses []string `json:"addresses"`
 }
 
+// Rule files new mail automatically. A message matches when it meets every
+// condition set in Match; the actions then run in order.
+type Rule struct {
+	Name    string       `json:"name"`
+	Match   RuleMatch    `json:"match"`
+	Actions []RuleAction `json:"actions"`
+	// Stop keeps later rules from running on messages this rule matched.
+	Stop bool `json:"stop,omitempty"`
+}
+
+// RuleMatch holds a rule's conditions. Text conditions match
+// case-insensitively anywhere in the value; unset ones match everything.
+type RuleMatch struct {
+	From    string            `json:"from,omitempty"`
+	To      string            `json:"to,omitempty"` // Any To or Cc recipient
+	Subject string            `json:"subject,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // Header name to text
+	Account string            `json:"account,omitempty"` // Account ID, email or name
+	Larger  int64             `json:"larger,omitempty"`  // Size in bytes
+	Smaller int64             `json:"smaller,omitempty"` // Size in bytes
+	// Folder is the folder whose new mail the rule runs on, INBOX when
+	// unset. It is not a condition on its own.
+	Folder string `json:"folder,omitempty"`
+}
+
+// RuleAction is one thing a rule does to the messages it matches.
+type RuleAction struct {
+	Type   string `json:"type"`             // "move", "archive", "delete", "mark_read", "flag" or "notify"
+	Folder string `json:"folder,omitempty"` // Destination folder for "move"
+}
+
+// SavedSearch is a search query kept under a name and listed as a virtual
+// folder in the sidebar. Query uses the search box syntax.
+type SavedSearch struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
 // Config stores the user's email configuration with multiple accounts.
 type Config struct {
 	Accounts                []Account     `json:"accounts"`
@@ -132,10 +187,15 @@ type Config struct {
 	DisableSpellSuggestions bool          `json:"disable_spell_suggestions,omitempty"`
 	Theme                   string        `json:"theme,omitempty"`
 	MailingLists            []MailingList `json:"mailing_lists,omitempty"`
+	SavedSearches           []SavedSearch `json:"saved_searches,omitempty"`
+	Rules                   []Rule        `json:"rules,omitempty"`
 	DateFormat              string        `json:"date_format,omitempty"`
 	Language                string        `json:"language,omitempty"` // Language code (e.g., "en", "es", "de")
 	BodyCacheThresholdMB    int           `json:"body_cache_threshold_mb,omitempty"`
 	UndoDelaySeconds        int           `json:"undo_delay_seconds,omitempty"`
+	// SMTPSubmissionPort, when non-zero, makes the daemon accept mail for
+	// configured accounts over SMTP on 127.0.0.1 at this port.
+	SMTPSubmissionPort int `json:"smtp_submission_port,omitempty"`
 	// PluginSettings stores user-configurable values for installed plugins,
 	// keyed by plugin name then setting key. Values are JSON-native types
 	// (bool, float64, string) matching the plugin's declared schema.
@@ -324,6 +384,21 @@ func (a *Account) FormatFromHeader() string {
 	return sendAs
 }
 
+// GetWatchFolders returns the folders to watch for new mail, defaulting to
+// INBOX.
+func (a *Account) GetWatchFolders() []string {
+	var folders []string
+	for _, f := range a.WatchFolders {
+		if f = strings.TrimSpace(f); f != "" && !slices.Contains(folders, f) {
+			folders = append(folders, f)
+		}
+	}
+	if len(folders) == 0 {
+		return []string{"INBOX"}
+	}
+	return folders
+}
+
 // GetPOP3Server returns the POP3 server address for the account.
 func (a *Account) GetPOP3Server() string {
 	if a.POP3Server != "" {
@@ -424,34 +499,38 @@ func configFile() (string, error) {
 
 // secureDiskAccount includes the Password field in JSON when secure mode is active.
 type secureDiskAccount struct {
-	ID                 string `json:"id"`
-	Name               string `json:"name"`
-	Email              string `json:"email"`
-	Password           string `json:"password,omitempty"`
-	ServiceProvider    string `json:"service_provider"`
-	FetchEmail         string `json:"fetch_email,omitempty"`
-	SendAsEmail        string `json:"send_as_email,omitempty"`
-	IMAPServer         string `json:"imap_server,omitempty"`
-	IMAPPort           int    `json:"imap_port,omitempty"`
-	SMTPServer         string `json:"smtp_server,omitempty"`
-	SMTPPort           int    `json:"smtp_port,omitempty"`
-	Insecure           bool   `json:"insecure,omitempty"`
-	SMIMECert          string `json:"smime_cert,omitempty"`
-	SMIMEKey           string `json:"smime_key,omitempty"`
-	SMIMESignByDefault bool   `json:"smime_sign_by_default,omitempty"`
-	PGPPublicKey       string `json:"pgp_public_key,omitempty"`
-	PGPPrivateKey      string `json:"pgp_private_key,omitempty"`
-	PGPKeySource       string `json:"pgp_key_source,omitempty"`
-	PGPPIN             string `json:"pgp_pin,omitempty"`
-	PGPSignByDefault   bool   `json:"pgp_sign_by_default,omitempty"`
-	AuthMethod         string `json:"auth_method,omitempty"`
-	PassCmd            string `json:"pass_cmd,omitempty"`
-	Protocol           string `json:"protocol,omitempty"`
-	JMAPEndpoint       string `json:"jmap_endpoint,omitempty"`
-	POP3Server         string `json:"pop3_server,omitempty"`
-	POP3Port           int    `json:"pop3_port,omitempty"`
-	MaildirPath        string `json:"maildir_path,omitempty"`
-	CatchAll           bool   `json:"catch_all,omitempty"`
+	ID                 string   `json:"id"`
+	Name               string   `json:"name"`
+	Email              string   `json:"email"`
+	Password           string   `json:"password,omitempty"`
+	ServiceProvider    string   `json:"service_provider"`
+	FetchEmail         string   `json:"fetch_email,omitempty"`
+	SendAsEmail        string   `json:"send_as_email,omitempty"`
+	IMAPServer         string   `json:"imap_server,omitempty"`
+	IMAPPort           int      `json:"imap_port,omitempty"`
+	SMTPServer         string   `json:"smtp_server,omitempty"`
+	SMTPPort           int      `json:"smtp_port,omitempty"`
+	Insecure           bool     `json:"insecure,omitempty"`
+	SMIMECert          string   `json:"smime_cert,omitempty"`
+	SMIMEKey           string   `json:"smime_key,omitempty"`
+	SMIMESignByDefault bool     `json:"smime_sign_by_default,omitempty"`
+	PGPPublicKey       string   `json:"pgp_public_key,omitempty"`
+	PGPPrivateKey      string   `json:"pgp_private_key,omitempty"`
+	PGPKeySource       string   `json:"pgp_key_source,omitempty"`
+	PGPPIN             string   `json:"pgp_pin,omitempty"`
+	PGPSignByDefault   bool     `json:"pgp_sign_by_default,omitempty"`
+	AuthMethod         string   `json:"auth_method,omitempty"`
+	PassCmd            string   `json:"pass_cmd,omitempty"`
+	Protocol           string   `json:"protocol,omitempty"`
+	JMAPEndpoint       string   `json:"jmap_endpoint,omitempty"`
+	POP3Server         string   `json:"pop3_server,omitempty"`
+	POP3Port           int      `json:"pop3_port,omitempty"`
+	MaildirPath        string   `json:"maildir_path,omitempty"`
+	MboxPath           string   `json:"mbox_path,omitempty"`
+	SieveServer        string   `json:"sieve_server,omitempty"`
+	WatchFolders       []string `json:"watch_folders,omitempty"`
+	SendmailCommand    string   `json:"sendmail_command,omitempty"`
+	CatchAll           bool     `json:"catch_all,omitempty"`
 }
 
 type secureDiskConfig struct {
@@ -467,8 +546,11 @@ type secureDiskConfig struct {
 	DisableSpellSuggestions bool                              `json:"disable_spell_suggestions,omitempty"`
 	Theme                   string                            `json:"theme,omitempty"`
 	MailingLists            []MailingList                     `json:"mailing_lists,omitempty"`
+	SavedSearches           []SavedSearch                     `json:"saved_searches,omitempty"`
+	Rules                   []Rule                            `json:"rules,omitempty"`
 	DateFormat              string                            `json:"date_format,omitempty"`
 	Language                string                            `json:"language,omitempty"`
+	SMTPSubmissionPort      int                               `json:"smtp_submission_port,omitempty"`
 	PluginSettings          map[string]map[string]interface{} `json:"plugin_settings,omitempty"`
 }
 
@@ -518,7 +600,10 @@ func SaveConfig(config *Config) error {
 			DisableSpellSuggestions: config.DisableSpellSuggestions,
 			Theme:                   config.Theme,
 			MailingLists:            config.MailingLists,
+			SavedSearches:           config.SavedSearches,
+			Rules:                   config.Rules,
 			DateFormat:              config.DateFormat,
+			SMTPSubmissionPort:      config.SMTPSubmissionPort,
 			PluginSettings:          config.PluginSettings,
 		}
 		for _, acc := range config.Accounts {
@@ -554,6 +639,10 @@ func SaveConfig(config *Config) error {
 				POP3Server:         acc.POP3Server,
 				POP3Port:           acc.POP3Port,
 				MaildirPath:        acc.MaildirPath,
+				MboxPath:           acc.MboxPath,
+				SieveServer:        acc.SieveServer,
+				WatchFolders:       acc.WatchFolders,
+				SendmailCommand:    acc.SendmailCommand,
 				CatchAll:           acc.CatchAll,
 			})
 		}
@@ -591,34 +680,38 @@ func LoadConfig() (*Config, error) {
 	var needsMigration bool
 
 	type rawAccount struct {
-		ID                 string `json:"id"`
-		Name               string `json:"name"`
-		Email              string `json:"email"`
-		Password           string `json:"password,omitempty"`
-		ServiceProvider    string `json:"service_provider"`
-		FetchEmail         string `json:"fetch_email,omitempty"`
-		SendAsEmail        string `json:"send_as_email,omitempty"`
-		IMAPServer         string `json:"imap_server,omitempty"`
-		IMAPPort           int    `json:"imap_port,omitempty"`
-		SMTPServer         string `json:"smtp_server,omitempty"`
-		SMTPPort           int    `json:"smtp_port,omitempty"`
-		Insecure           bool   `json:"insecure,omitempty"`
-		SMIMECert          string `json:"smime_cert,omitempty"`
-		SMIMEKey           string `json:"smime_key,omitempty"`
-		SMIMESignByDefault bool   `json:"smime_sign_by_default,omitempty"`
-		PGPPublicKey       string `json:"pgp_public_key,omitempty"`
-		PGPPrivateKey      string `json:"pgp_private_key,omitempty"`
-		PGPKeySource       string `json:"pgp_key_source,omitempty"`
-		PGPPIN             string `json:"pgp_pin,omitempty"`
-		PGPSignByDefault   bool   `json:"pgp_sign_by_default,omitempty"`
-		AuthMethod         string `json:"auth_method,omitempty"`
-		PassCmd            string `json:"pass_cmd,omitempty"`
-		Protocol           string `json:"protocol,omitempty"`
-		JMAPEndpoint       string `json:"jmap_endpoint,omitempty"`
-		POP3Server         string `json:"pop3_server,omitempty"`
-		POP3Port           int    `json:"pop3_port,omitempty"`
-		MaildirPath        string `json:"maildir_path,omitempty"`
-		CatchAll           bool   `json:"catch_all,omitempty"`
+		ID                 string   `json:"id"`
+		Name               string   `json:"name"`
+		Email              string   `json:"email"`
+		Password           string   `json:"password,omitempty"`
+		ServiceProvider    string   `json:"service_provider"`
+		FetchEmail         string   `json:"fetch_email,omitempty"`
+		SendAsEmail        string   `json:"send_as_email,omitempty"`
+		IMAPServer         string   `json:"imap_server,omitempty"`
+		IMAPPort           int      `json:"imap_port,omitempty"`
+		SMTPServer         string   `json:"smtp_server,omitempty"`
+		SMTPPort           int      `json:"smtp_port,omitempty"`
+		Insecure           bool     `json:"insecure,omitempty"`
+		SMIMECert          string   `json:"smime_cert,omitempty"`
+		SMIMEKey           string   `json:"smime_key,omitempty"`
+		SMIMESignByDefault bool     `json:"smime_sign_by_default,omitempty"`
+		PGPPublicKey       string   `json:"pgp_public_key,omitempty"`
+		PGPPrivateKey      string   `json:"pgp_private_key,omitempty"`
+		PGPKeySource       string   `json:"pgp_key_source,omitempty"`
+		PGPPIN             string   `json:"pgp_pin,omitempty"`
+		PGPSignByDefault   bool     `json:"pgp_sign_by_default,omitempty"`
+		AuthMethod         string   `json:"auth_method,omitempty"`
+		PassCmd            string   `json:"pass_cmd,omitempty"`
+		Protocol           string   `json:"protocol,omitempty"`
+		JMAPEndpoint       string   `json:"jmap_endpoint,omitempty"`
+		POP3Server         string   `json:"pop3_server,omitempty"`
+		POP3Port           int      `json:"pop3_port,omitempty"`
+		MaildirPath        string   `json:"maildir_path,omitempty"`
+		MboxPath           string   `json:"mbox_path,omitempty"`
+		SieveServer        string   `json:"sieve_server,omitempty"`
+		WatchFolders       []string `json:"watch_folders,omitempty"`
+		SendmailCommand    string   `json:"sendmail_command,omitempty"`
+		CatchAll           bool     `json:"catch_all,omitempty"`
 	}
 	type diskConfig struct {
 		Accounts                []rawAccount                      `json:"accounts"`
@@ -633,10 +726,13 @@ func LoadConfig() (*Config, error) {
 		DisableSpellSuggestions bool                              `json:"disable_spell_suggestions,omitempty"`
 		Theme                   string                            `json:"theme,omitempty"`
 		MailingLists            []MailingList                     `json:"mailing_lists,omitempty"`
+		SavedSearches           []SavedSearch                     `json:"saved_searches,omitempty"`
+		Rules                   []Rule                            `json:"rules,omitempty"`
 		DateFormat              string                            `json:"date_format,omitempty"`
 		Language                string                            `json:"language,omitempty"`
 		BodyCacheThresholdMB    int                               `json:"body_cache_threshold_mb,omitempty"`
 		UndoDelaySeconds        int                               `json:"undo_delay_seconds,omitempty"`
+		SMTPSubmissionPort      int                               `json:"smtp_submission_port,omitempty"`
 		PluginSettings          map[string]map[string]interface{} `json:"plugin_settings,omitempty"`
 	}
 
@@ -677,10 +773,13 @@ func LoadConfig() (*Config, error) {
 	config.DisableSpellSuggestions = raw.DisableSpellSuggestions
 	config.Theme = raw.Theme
 	config.MailingLists = raw.MailingLists
+	config.SavedSearches = raw.SavedSearches
+	config.Rules = raw.Rules
 	config.DateFormat = raw.DateFormat
 	config.Language = raw.Language
 	config.BodyCacheThresholdMB = raw.BodyCacheThresholdMB
 	config.UndoDelaySeconds = raw.UndoDelaySeconds
+	config.SMTPSubmissionPort = raw.SMTPSubmissionPort
 	config.PluginSettings = raw.PluginSettings
 
 	for _, rawAcc := range raw.Accounts {
@@ -710,6 +809,10 @@ func LoadConfig() (*Config, error) {
 			POP3Server:         rawAcc.POP3Server,
 			POP3Port:           rawAcc.POP3Port,
 			MaildirPath:        rawAcc.MaildirPath,
+			MboxPath:           rawAcc.MboxPath,
+			SieveServer:        rawAcc.SieveServer,
+			WatchFolders:       rawAcc.WatchFolders,
+			SendmailCommand:    rawAcc.SendmailCommand,
 			CatchAll:           rawAcc.CatchAll,
 			SC:                 &SessionCache{},
 		}
@@ -49,6 +49,17 @@ func TestSaveAndLoadConfig(t *testing.T) {
 				SC:              &SessionCache{},
 			},
 		},
+		SavedSearches: []SavedSearch{
+			{Name: "CI failures", Query: "from:ci@ since:1d"},
+		},
+		Rules: []Rule{
+			{
+				Name:    "CI",
+				Match:   RuleMatch{From: "ci@example.com", Headers: map[string]string{"List-Id": "builds"}},
+				Actions: []RuleAction{{Type: "move", Folder: "CI"}, {Type: "mark_read"}},
+				Stop:    true,
+			},
+		},
 	}
 
 	// Attempt to save the configuration.
@@ -678,3 +689,16 @@ func TestPassCmd(t *testing.T) {
 		t.Errorf("Password not resolved from pass_cmd: got %q", acc.Password)
 	}
 }
+
+func TestAccountGetWatchFolders(t *testing.T) {
+	account := Account{}
+	if got := account.GetWatchFolders(); len(got) != 1 || got[0] != "INBOX" {
+		t.Fatalf("GetWatchFolders() = %q, want [INBOX]", got)
+	}
+
+	account.WatchFolders = []string{"INBOX", " Lists/go ", "", "INBOX"}
+	got := account.GetWatchFolders()
+	if len(got) != 2 || got[0] != "INBOX" || got[1] != "Lists/go" {
+		t.Fatalf("GetWatchFolders() = %q, want [INBOX Lists/go]", got)
+	}
+}
@@ -14,10 +14,31 @@ import (
 
 // CachedFolders stores folder names for a single account.
 type CachedFolders struct {
-	AccountID string         `json:"account_id"`
-	Folders   []string       `json:"folders"`
-	Unread    map[string]int `json:"unread_counts,omitempty"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	AccountID string                     `json:"account_id"`
+	Folders   []string                   `json:"folders"`
+	Unread    map[string]int             `json:"unread_counts,omitempty"`
+	Sync      map[string]FolderSyncState `json:"sync,omitempty"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// FolderSyncState is what incremental IMAP sync remembers about a folder.
+// Cached UIDs are only meaningful while UIDValidity is unchanged;
+// HighestModSeq is zero when the server lacks CONDSTORE.
+type FolderSyncState struct {
+	UIDValidity   uint32 `json:"uid_validity"`
+	UIDNext       uint32 `json:"uid_next"`
+	HighestModSeq uint64 `json:"highest_modseq,omitempty"`
+	// Synced marks folders of non-IMAP accounts, which have no UIDVALIDITY,
+	// as synced at least once.
+	Synced bool `json:"synced,omitempty"`
+	// Newest is the date of the newest email seen in a non-IMAP folder,
+	// whose UIDs do not grow with arrival. Mail dated after it is new.
+	Newest time.Time `json:"newest,omitzero"`
+}
+
+// IsZero reports whether the folder has never been synced.
+func (s FolderSyncState) IsZero() bool {
+	return s.UIDValidity == 0 && !s.Synced
 }
 
 // FolderCache stores cached folders for all accounts.
@@ -114,6 +135,48 @@ func SaveAccountFolders(accountID string, folders []string, unread map[string]in
 	return SaveFolderCache(cache)
 }
 
+// GetFolderSyncState returns the stored sync state of an account's folder,
+// or the zero state if the folder has never been synced.
+func GetFolderSyncState(accountID, folderName string) FolderSyncState {
+	cache, err := LoadFolderCache()
+	if err != nil {
+		return FolderSyncState{}
+	}
+	for _, acc := range cache.Accounts {
+		if acc.AccountID == accountID {
+			return acc.Sync[folderName]
+		}
+	}
+	return FolderSyncState{}
+}
+
+// SaveFolderSyncState stores the sync state of an account's folder, merging
+// into the existing cache.
+func SaveFolderSyncState(accountID, folderName string, state FolderSyncState) error {
+	cache, err := LoadFolderCache()
+	if err != nil {
+		cache = &FolderCache{}
+	}
+
+	idx := -1
+	for i, acc := range cache.Accounts {
+		if acc.AccountID == accountID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		cache.Accounts = append(cache.Accounts, CachedFolders{AccountID: accountID})
+		idx = len(cache.Accounts) - 1
+	}
+	if cache.Accounts[idx].Sync == nil {
+		cache.Accounts[idx].Sync = make(map[string]FolderSyncState)
+	}
+	cache.Accounts[idx].Sync[folderName] = state
+
+	return SaveFolderCache(cache)
+}
+
 func removeAccountFromFolderCache(accountID string) error {
 	cache, err := LoadFolderCache()
 	if err != nil {
@@ -222,3 +222,27 @@ func TestGetCachedFolders_NoCacheFile(t *testing.T) {
 		t.Errorf("no cache file: got %v, want nil", folders)
 	}
 }
+
+func TestFolderSyncState_SurvivesFolderListUpdate(t *testing.T) {
+	folderCacheTestSetup(t)
+
+	if got := GetFolderSyncState("acct-1", "INBOX"); got != (FolderSyncState{}) {
+		t.Fatalf("unsynced folder: got %+v, want zero state", got)
+	}
+
+	want := FolderSyncState{UIDValidity: 7, UIDNext: 120, HighestModSeq: 9001}
+	if err := SaveFolderSyncState("acct-1", "INBOX", want); err != nil {
+		t.Fatalf("SaveFolderSyncState: %v", err)
+	}
+	// Refreshing the folder list must not drop the sync state.
+	if err := SaveAccountFolders("acct-1", []string{"INBOX", "Sent"}, nil); err != nil {
+		t.Fatalf("SaveAccountFolders: %v", err)
+	}
+
+	if got := GetFolderSyncState("acct-1", "INBOX"); got != want {
+		t.Errorf("INBOX: got %+v, want %+v", got, want)
+	}
+	if got := GetFolderSyncState("acct-2", "INBOX"); got != (FolderSyncState{}) {
+		t.Errorf("other account: got %+v, want zero state", got)
+	}
+}
@@ -32,6 +32,8 @@ type GlobalKeys struct {
 	Cancel  string `json:"cancel"`
 	NavUp   string `json:"nav_up"`
 	NavDown string `json:"nav_down"`
+	Accept  string `json:"accept"`
+	Decline string `json:"decline"`
 }
 
 type InboxKeys struct {
@@ -39,12 +41,16 @@ type InboxKeys struct {
 	ToggleThreaded string `json:"toggle_threaded"`
 	Delete         string `json:"delete"`
 	Archive        string `json:"archive"`
+	ToggleFlag     string `json:"toggle_flag"`
+	Label          string `json:"label"`
 	Refresh        string `json:"refresh"`
 	Search         string `json:"search"`
+	SaveSearch     string `json:"save_search"`
 	Filter         string `json:"filter"`
 	Open           string `json:"open"`
 	NextTab        string `json:"next_tab"`
 	PrevTab        string `json:"prev_tab"`
+	RetrySends     string `json:"retry_sends"`
 }
 
 type EmailKeys struct {
@@ -116,18 +122,24 @@ func ValidateKeybinds(kb KeybindsConfig) []string {
 			"cancel":   kb.Global.Cancel,
 			"nav_up":   kb.Global.NavUp,
 			"nav_down": kb.Global.NavDown,
+			"accept":   kb.Global.Accept,
+			"decline":  kb.Global.Decline,
 		},
 		"inbox": {
 			"visual_mode":     kb.Inbox.VisualMode,
 			"toggle_threaded": kb.Inbox.ToggleThreaded,
 			keyDelete:         kb.Inbox.Delete,
 			"archive":         kb.Inbox.Archive,
+			"toggle_flag":     kb.Inbox.ToggleFlag,
+			"label":           kb.Inbox.Label,
 			"refresh":         kb.Inbox.Refresh,
 			"search":          kb.Inbox.Search,
+			"save_search":     kb.Inbox.SaveSearch,
 			"filter":          kb.Inbox.Filter,
 			"open":            kb.Inbox.Open,
 			"next_tab":        kb.Inbox.NextTab,
 			"prev_tab":        kb.Inbox.PrevTab,
+			"retry_sends":     kb.Inbox.RetrySends,
 		},
 		"email": {
 			"reply":             kb.Email.Reply,
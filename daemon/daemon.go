@@ -2,11 +2,14 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,7 +19,6 @@ import (
 	"github.com/floatpane/matcha/daemonrpc"
 	"github.com/floatpane/matcha/fetcher"
 	"github.com/floatpane/matcha/notify"
-	"github.com/floatpane/matcha/sender"
 )
 
 const inboxFolder = "INBOX"
@@ -37,10 +39,18 @@ type Daemon struct {
 
 	// Mutex for disk cache updates.
 	cacheMu sync.Mutex
-
-	// IMAP IDLE watcher for push notifications.
-	idleWatcher *fetcher.IdleWatcher
-	idleUpdates chan fetcher.IdleUpdate
+	// Serialises folder syncs so each resumes from the state the last one
+	// saved.
+	syncMu sync.Mutex
+	// Serialises syncs that look for new mail, so each message is seen
+	// as new, and filtered by the rules, once.
+	arrivalMu sync.Mutex
+
+	// Push notifications: each account's watch, and the events they
+	// deliver.
+	watches      map[string]*accountWatch
+	watchMu      sync.Mutex
+	notifyEvents chan backend.NotifyEvent
 
 	// Background sync cancellation.
 	syncCancel context.CancelFunc
@@ -52,21 +62,14 @@ type Daemon struct {
 	outboxMu sync.Mutex
 }
 
-type OutboxEntry struct {
-	ID     string
-	Params daemonrpc.SendEmailParams
-	SendAt time.Time
-}
-
 // New creates a daemon with the given config.
 func New(cfg *config.Config) *Daemon {
-	idleUpdates := make(chan fetcher.IdleUpdate, 16)
 	d := &Daemon{
 		config:        cfg,
 		providers:     make(map[string]backend.Provider),
 		subscriptions: make(map[*daemonrpc.Conn]map[string]struct{}),
-		idleWatcher:   fetcher.NewIdleWatcher(idleUpdates),
-		idleUpdates:   idleUpdates,
+		watches:       make(map[string]*accountWatch),
+		notifyEvents:  make(chan backend.NotifyEvent, 16),
 		shutdown:      make(chan struct{}),
 		done:          make(chan struct{}),
 		outbox:        make(map[string]*OutboxEntry),
@@ -99,12 +102,20 @@ func (d *Daemon) registerHandlers() {
 	d.server.Handle(daemonrpc.MethodArchiveEmails, d.handleArchiveEmails)
 	d.server.Handle(daemonrpc.MethodMoveEmails, d.handleMoveEmails)
 	d.server.Handle(daemonrpc.MethodMarkRead, d.handleMarkRead)
+	d.server.Handle(daemonrpc.MethodMarkFlagged, d.handleMarkFlagged)
+	d.server.Handle(daemonrpc.MethodSetLabel, d.handleSetLabel)
 	d.server.Handle(daemonrpc.MethodFetchFolders, d.handleFetchFolders)
+	d.server.Handle(daemonrpc.MethodCreateFolder, d.handleCreateFolder)
+	d.server.Handle(daemonrpc.MethodRenameFolder, d.handleRenameFolder)
+	d.server.Handle(daemonrpc.MethodDeleteFolder, d.handleDeleteFolder)
+	d.server.Handle(daemonrpc.MethodSetSubscribed, d.handleSetSubscribed)
 	d.server.Handle(daemonrpc.MethodRefreshFolder, d.handleRefreshFolder)
 	d.server.Handle(daemonrpc.MethodSubscribe, d.handleSubscribe)
 	d.server.Handle(daemonrpc.MethodUnsubscribe, d.handleUnsubscribe)
 	d.server.Handle(daemonrpc.MethodQueueEmail, d.handleQueueEmail)
 	d.server.Handle(daemonrpc.MethodCancelEmail, d.handleCancelEmail)
+	d.server.Handle(daemonrpc.MethodListOutbox, d.handleListOutbox)
+	d.server.Handle(daemonrpc.MethodRetryOutbox, d.handleRetryOutbox)
 }
 
 // Run starts the daemon: creates providers, starts the socket listener,
@@ -152,9 +163,9 @@ func (d *Daemon) Run() error {
 	// Initialize providers for all accounts.
 	d.initProviders()
 
-	// Start IMAP IDLE watchers for all accounts.
-	d.startIdleWatchers()
-	go d.idleEventLoop()
+	// Watch all accounts for new mail.
+	d.startWatchers()
+	go d.notifyEventLoop()
 
 	// Handle OS signals: SIGTERM/SIGINT → shutdown, SIGHUP → reload config.
 	stopSignals := udsrpc.HandleSignals(d.Shutdown, func() {
@@ -170,8 +181,15 @@ func (d *Daemon) Run() error {
 	d.syncCancel = cancel
 	go d.backgroundSync(ctx)
 
+	d.loadOutbox()
 	go d.processOutbox(ctx)
 
+	if port := d.config.SMTPSubmissionPort; port > 0 {
+		if err := d.startSubmissionServer(ctx, port); err != nil {
+			log.Printf("daemon: SMTP submission disabled: %v", err)
+		}
+	}
+
 	// Serve client connections via the shared RPC server. Canceling serveCtx
 	// closes the listener and unblocks Serve.
 	serveCtx, serveCancel := context.WithCancel(context.Background())
@@ -190,11 +208,11 @@ func (d *Daemon) Run() error {
 	for _, conn := range d.server.Clients() {
 		conn.Close() //nolint:errcheck,gosec
 	}
-	if err := d.idleWatcher.StopAllAndWaitTimeout(5 * time.Second); err != nil {
-		log.Printf("daemon: %v", err)
-	}
+	d.stopWatchers()
 	cancel()
+	flushSearchIndex()
 	d.closeProviders()
+	fetcher.ClosePool()
 
 	close(d.done)
 	return nil
@@ -220,8 +238,11 @@ func (d *Daemon) ReloadConfig() error {
 	d.config = cfg
 	d.mu.Unlock()
 
-	// Reinitialize providers for new/changed accounts.
+	// Reinitialize providers for new/changed accounts, and rewatch
+	// accounts whose watched folders changed.
 	d.initProviders()
+	d.stopStaleWatchers()
+	d.startWatchers()
 
 	// Notify clients.
 	d.broadcastEvent(daemonrpc.EventConfigReloaded, nil)
@@ -326,12 +347,7 @@ func (d *Daemon) syncAllAccounts(ctx context.Context) {
 			Folder:    inboxFolder,
 		})
 
-		p, err := d.getProvider(acct.ID)
-		if err != nil {
-			continue
-		}
-
-		emails, err := p.FetchEmails(ctx, inboxFolder, 50, 0)
+		emails, arrived, err := d.syncNewMail(ctx, &acct, inboxFolder)
 		if err != nil {
 			log.Printf("daemon: sync %s failed: %v", acct.Email, err)
 			d.broadcastToSubscribers(acct.ID, inboxFolder, daemonrpc.EventSyncError, daemonrpc.SyncErrorEvent{
@@ -342,51 +358,16 @@ func (d *Daemon) syncAllAccounts(ctx context.Context) {
 			continue
 		}
 
-		oldCached, _ := config.LoadFolderEmailCache(inboxFolder)
-		oldUIDs := make(map[uint32]struct{}, len(oldCached))
-		for _, e := range oldCached {
-			if e.AccountID == acct.ID {
-				oldUIDs[e.UID] = struct{}{}
-			}
-		}
-
-		// Cache the fetched emails to disk.
-		var cached []config.CachedEmail
-		for _, e := range emails {
-			cached = append(cached, config.CachedEmail{
-				UID:        e.UID,
-				From:       e.From,
-				To:         e.To,
-				Subject:    e.Subject,
-				Date:       e.Date,
-				MessageID:  e.MessageID,
-				InReplyTo:  e.InReplyTo,
-				References: e.References,
-				AccountID:  e.AccountID,
-				IsRead:     e.IsRead,
-			})
-		}
-		if err := d.updateFolderCache(inboxFolder, acct.ID, cached); err != nil {
-			log.Printf("daemon: cache update for INBOX failed: %v", err)
-		}
-
 		d.broadcastToSubscribers(acct.ID, inboxFolder, daemonrpc.EventSyncComplete, daemonrpc.SyncCompleteEvent{
 			AccountID:  acct.ID,
 			Folder:     inboxFolder,
 			EmailCount: len(emails),
 		})
 
-		newCount := 0
-		for _, e := range emails {
-			if _, seen := oldUIDs[e.UID]; !seen {
-				newCount++
-			}
-		}
-
 		// Send desktop notification if TUI not connected.
 		noClients := len(d.server.Clients()) == 0
 
-		if noClients && newCount > 0 {
+		if noClients && len(arrived) > 0 {
 			if !d.config.DisableNotifications {
 				go notify.Send("Matcha", fmt.Sprintf("New mail for %s", acct.FetchEmail)) //nolint:errcheck
 			}
@@ -394,94 +375,272 @@ func (d *Daemon) syncAllAccounts(ctx context.Context) {
 	}
 }
 
-// startIdleWatchers starts IMAP IDLE watchers for all accounts on INBOX.
-func (d *Daemon) startIdleWatchers() {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+// Restart policy for watches that end on their own, e.g. when the
+// connection drops: the first restart is tried after watchBaseBackoff,
+// doubling while restarts fail or end quickly, up to watchMaxBackoff.
+const (
+	watchBaseBackoff = 5 * time.Second
+	watchMaxBackoff  = 5 * time.Minute
+)
+
+// accountWatch is a running watch of an account's folders.
+type accountWatch struct {
+	folders []string
+	stop    func()
+	// failures counts the restarts before this watch that failed or ended
+	// within watchMaxBackoff.
+	failures int
+}
 
+// watchBackoff returns the delay before restarting a watch after the given
+// number of failures in a row.
+func watchBackoff(failures int) time.Duration {
+	delay := watchBaseBackoff
+	for i := 0; i < failures; i++ {
+		delay *= 2
+		if delay >= watchMaxBackoff {
+			return watchMaxBackoff
+		}
+	}
+	return delay
+}
+
+// startWatchers watches the folders of every account not watched yet for
+// new mail, through the account's provider.
+func (d *Daemon) startWatchers() {
+	type target struct {
+		acct *config.Account
+		n    backend.Notifier
+	}
+	var targets []target
+	d.mu.RLock()
 	for i := range d.config.Accounts {
 		acct := &d.config.Accounts[i]
-		// Only IMAP accounts support IDLE.
-		protocol := acct.Protocol
-		if protocol == "" {
-			protocol = "imap"
+		if p, ok := d.providers[acct.ID]; ok {
+			targets = append(targets, target{acct, p})
 		}
-		if protocol != "imap" {
-			continue
+	}
+	d.mu.RUnlock()
+
+	for _, t := range targets {
+		d.watchAccount(t.acct, t.n)
+	}
+}
+
+// watchAccount watches acct's folders with n, unless it is watched already.
+func (d *Daemon) watchAccount(acct *config.Account, n backend.Notifier) {
+	if err := d.startWatch(acct, n, 0); err != nil {
+		log.Printf("daemon: watching %s failed: %v", acct.Email, err)
+	}
+}
+
+// startWatch starts watching acct's folders with n, unless it is watched
+// already or the daemon is shutting down. failures is carried over from
+// the watch being restarted, if any.
+func (d *Daemon) startWatch(acct *config.Account, n backend.Notifier, failures int) error {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+	select {
+	case <-d.shutdown:
+		return nil
+	default:
+	}
+	if _, ok := d.watches[acct.ID]; ok {
+		return nil
+	}
+
+	folders := acct.GetWatchFolders()
+	events, stop, err := backend.WatchFolders(context.Background(), n, folders)
+	if errors.Is(err, backend.ErrNotSupported) {
+		log.Printf("daemon: no push notifications for %s, relying on periodic sync", acct.Email)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w := &accountWatch{folders: folders, stop: stop, failures: failures}
+	d.watches[acct.ID] = w
+
+	go d.drainWatch(acct, n, w, events)
+	log.Printf("daemon: watching %s for new mail in %s", acct.Email, strings.Join(folders, ", "))
+	return nil
+}
+
+// drainWatch forwards a watch's events until it closes the channel, even
+// after shutdown. A watch that closes it without being stopped has failed,
+// and is restarted.
+func (d *Daemon) drainWatch(acct *config.Account, n backend.Notifier, w *accountWatch, events <-chan backend.NotifyEvent) {
+	started := time.Now()
+	for ev := range events {
+		if ev.AccountID == "" {
+			ev.AccountID = acct.ID
 		}
-		d.idleWatcher.Watch(acct, inboxFolder)
-		log.Printf("daemon: IDLE watcher started for %s", acct.Email)
+		select {
+		case d.notifyEvents <- ev:
+		case <-d.shutdown:
+		}
+	}
+
+	// Stopping a watch removes it from d.watches first.
+	d.watchMu.Lock()
+	ended := d.watches[acct.ID] == w
+	if ended {
+		delete(d.watches, acct.ID)
 	}
+	d.watchMu.Unlock()
+	if !ended {
+		return
+	}
+
+	failures := 0
+	if time.Since(started) < watchMaxBackoff {
+		failures = w.failures + 1
+	}
+	w.stop()
+	go d.rewatch(acct.ID, n, failures)
 }
 
-// idleEventLoop listens for IDLE updates and broadcasts them as events.
-func (d *Daemon) idleEventLoop() {
+// rewatch restarts the watch of an account after it ended on its own,
+// backing off while it keeps failing. It gives up if the account is
+// removed in the meantime.
+func (d *Daemon) rewatch(accountID string, n backend.Notifier, failures int) {
 	for {
+		delay := watchBackoff(failures)
+		log.Printf("daemon: watch of %s ended, restarting in %s", accountID, delay)
 		select {
 		case <-d.shutdown:
 			return
-		case update, ok := <-d.idleUpdates:
-			if !ok {
-				return
-			}
-			log.Printf("daemon: IDLE update for %s/%s", update.AccountID, update.FolderName)
+		case <-time.After(delay):
+		}
 
-			// Desktop notification when no clients connected.
-			noClients := len(d.server.Clients()) == 0
+		acct := d.getAccount(accountID)
+		if acct == nil {
+			return
+		}
+		err := d.startWatch(acct, n, failures)
+		if err == nil {
+			return
+		}
+		log.Printf("daemon: restarting watch of %s failed: %v", acct.Email, err)
+		failures++
+	}
+}
 
-			if noClients && !d.config.DisableNotifications {
-				accountName := update.AccountID
-				if acct := d.config.GetAccountByID(update.AccountID); acct != nil {
-					accountName = acct.Email
-				}
-				go notify.Send("Matcha", fmt.Sprintf("New mail in %s (%s)", update.FolderName, accountName)) //nolint:errcheck
-			}
+// stopStaleWatchers stops the watches of accounts that were removed from
+// the config or whose watched folders changed, so startWatchers can start
+// them afresh.
+func (d *Daemon) stopStaleWatchers() {
+	d.watchMu.Lock()
+	var stale []*accountWatch
+	for id, w := range d.watches {
+		acct := d.getAccount(id)
+		if acct != nil && slices.Equal(acct.GetWatchFolders(), w.folders) {
+			continue
+		}
+		delete(d.watches, id)
+		stale = append(stale, w)
+	}
+	d.watchMu.Unlock()
 
-			// Broadcast to subscribed clients.
-			d.broadcastToSubscribers(update.AccountID, update.FolderName, daemonrpc.EventNewMail, daemonrpc.NewMailEvent{
-				AccountID: update.AccountID,
-				Folder:    update.FolderName,
-			})
+	stopAll(stale)
+}
+
+// stopWatchers stops all watches and waits for them to finish.
+func (d *Daemon) stopWatchers() {
+	d.watchMu.Lock()
+	watches := make([]*accountWatch, 0, len(d.watches))
+	for _, w := range d.watches {
+		watches = append(watches, w)
+	}
+	d.watches = make(map[string]*accountWatch)
+	d.watchMu.Unlock()
+
+	stopAll(watches)
+}
+
+// stopAll stops watches in parallel and waits for them to finish.
+func stopAll(watches []*accountWatch) {
+	var wg sync.WaitGroup
+	for _, w := range watches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.stop()
+		}()
+	}
+	wg.Wait()
+}
+
+// notifyEventLoop listens for push notifications and broadcasts them as
+// events.
+func (d *Daemon) notifyEventLoop() {
+	for {
+		select {
+		case <-d.shutdown:
+			return
+		case ev := <-d.notifyEvents:
+			if ev.Folder == "" {
+				// The backend cannot tell which folder changed.
+				go d.syncWatchedFolders(ev.AccountID)
+				continue
+			}
+			if ev.Type == backend.NotifyNewEmail {
+				log.Printf("daemon: new mail in %s/%s", ev.AccountID, ev.Folder)
+				d.announceNewMail(ev.AccountID, ev.Folder)
+			}
 
 			// Fetch and cache emails so they're fresh when TUI next connects.
-			go d.fetchAndCache(update.AccountID, update.FolderName)
+			// Expunges and flag changes only need this refresh.
+			go d.fetchAndCache(ev.AccountID, ev.Folder)
 		}
 	}
 }
 
-// fetchAndCache fetches emails for an account/folder and saves to disk cache.
-func (d *Daemon) fetchAndCache(accountID, folder string) {
+// announceNewMail tells subscribed clients about new mail in a folder, or
+// the user with a desktop notification if no client is connected.
+func (d *Daemon) announceNewMail(accountID, folder string) {
+	noClients := len(d.server.Clients()) == 0
+
+	if noClients && !d.config.DisableNotifications {
+		accountName := accountID
+		if acct := d.getAccount(accountID); acct != nil {
+			accountName = acct.Email
+		}
+		go notify.Send("Matcha", fmt.Sprintf("New mail in %s (%s)", folder, accountName)) //nolint:errcheck
+	}
+
+	d.broadcastToSubscribers(accountID, folder, daemonrpc.EventNewMail, daemonrpc.NewMailEvent{
+		AccountID: accountID,
+		Folder:    folder,
+	})
+}
+
+// syncWatchedFolders syncs each of an account's watched folders, and
+// announces those that received new mail.
+func (d *Daemon) syncWatchedFolders(accountID string) {
 	acct := d.getAccount(accountID)
 	if acct == nil {
 		return
 	}
-
-	emails, err := fetcher.FetchFolderEmails(acct, folder, 50, 0)
-	if err != nil {
-		log.Printf("daemon: cache fetch for %s/%s failed: %v", accountID, folder, err)
-		return
+	for _, folder := range acct.GetWatchFolders() {
+		if d.fetchAndCache(accountID, folder) > 0 {
+			d.announceNewMail(accountID, folder)
+		}
 	}
+}
 
-	// Convert to cache format and save.
-	var cached []config.CachedEmail
-	for _, e := range emails {
-		cached = append(cached, config.CachedEmail{
-			UID:        e.UID,
-			From:       e.From,
-			To:         e.To,
-			Subject:    e.Subject,
-			Date:       e.Date,
-			MessageID:  e.MessageID,
-			InReplyTo:  e.InReplyTo,
-			References: e.References,
-			AccountID:  e.AccountID,
-			IsRead:     e.IsRead,
-		})
+// fetchAndCache syncs an account/folder into the disk cache, and returns
+// the number of new messages.
+func (d *Daemon) fetchAndCache(accountID, folder string) int {
+	acct := d.getAccount(accountID)
+	if acct == nil {
+		return 0
 	}
 
-	if err := d.updateFolderCache(folder, accountID, cached); err != nil {
-		log.Printf("daemon: cache update for %s failed: %v", folder, err)
-		return
+	cached, arrived, err := d.syncNewMail(context.Background(), acct, folder)
+	if err != nil {
+		log.Printf("daemon: cache sync for %s/%s failed: %v", accountID, folder, err)
+		return 0
 	}
 
 	log.Printf("daemon: cached %d emails for %s/%s", len(cached), accountID, folder)
@@ -490,8 +649,9 @@ func (d *Daemon) fetchAndCache(accountID, folder string) {
 	d.broadcastToSubscribers(accountID, folder, daemonrpc.EventSyncComplete, daemonrpc.SyncCompleteEvent{
 		AccountID:  accountID,
 		Folder:     folder,
-		EmailCount: len(emails),
+		EmailCount: len(cached),
 	})
+	return len(arrived)
 }
 
 // updateFolderCache safely merges new emails for a specific account into the existing folder cache.
@@ -521,68 +681,3 @@ func (d *Daemon) updateFolderCache(folderName, accountID string, newEmails []con
 	// Save merged cache
 	return config.SaveFolderEmailCache(folderName, merged)
 }
-
-func (d *Daemon) processOutbox(ctx context.Context) {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			d.outboxMu.Lock()
-			for id, entry := range d.outbox {
-				if time.Now().After(entry.SendAt) {
-					delete(d.outbox, id)
-					go d.sendOutboxEntry(entry)
-				}
-			}
-			d.outboxMu.Unlock()
-		}
-	}
-}
-
-func (d *Daemon) sendOutboxEntry(entry *OutboxEntry) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("daemon: panic sending outbox entry %s: %v", entry.ID, r)
-		}
-	}()
-
-	acct := d.getAccount(entry.Params.AccountID)
-	if acct == nil {
-		log.Printf("daemon: outbox send failed, no account for %s", entry.Params.AccountID)
-		return
-	}
-
-	rawMsg, err := sender.SendEmail(
-		acct,
-		entry.Params.To,
-		entry.Params.Cc,
-		entry.Params.Bcc,
-		entry.Params.Subject,
-		entry.Params.Body,
-		entry.Params.HTMLBody,
-		entry.Params.Images,
-		entry.Params.Attachments,
-		entry.Params.InReplyTo,
-		entry.Params.References,
-		entry.Params.SignSMIME,
-		entry.Params.EncryptSMIME,
-		entry.Params.SignPGP,
-		entry.Params.EncryptPGP,
-	)
-	if err != nil {
-		log.Printf("daemon: outbox send failed for %s: %v", entry.ID, err)
-		return
-	}
-
-	if acct.ServiceProvider != "gmail" {
-		if err := fetcher.AppendToSentMailbox(acct, rawMsg); err != nil {
-			log.Printf("daemon: append to sent failed for %s: %v", entry.ID, err)
-		}
-	}
-
-	log.Printf("daemon: outbox sent email %s", entry.ID)
-}
@@ -6,9 +6,11 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/daemonrpc"
 )
@@ -206,3 +208,260 @@ func TestDaemon_BroadcastEvent(t *testing.T) {
 		t.Errorf("type = %q, want NewMail", msg.Event.Type)
 	}
 }
+
+// stubNotifier watches each folder with a channel the test sends on.
+type stubNotifier struct {
+	folders []string
+	chans   map[string]chan backend.NotifyEvent
+	end     map[string]func() // ends a watch as if its connection dropped
+}
+
+func newStubNotifier() *stubNotifier {
+	return &stubNotifier{chans: make(map[string]chan backend.NotifyEvent), end: make(map[string]func())}
+}
+
+func (n *stubNotifier) Watch(_ context.Context, folder string) (<-chan backend.NotifyEvent, func(), error) {
+	n.folders = append(n.folders, folder)
+	ch := make(chan backend.NotifyEvent)
+	n.chans[folder] = ch
+	var once sync.Once
+	n.end[folder] = func() { once.Do(func() { close(ch) }) }
+	return ch, n.end[folder], nil
+}
+
+func TestDaemon_WatchesConfiguredFolders(t *testing.T) {
+	d := New(&config.Config{})
+	conn := serveDaemon(t, d)
+	go d.notifyEventLoop()
+	t.Cleanup(d.Shutdown)
+
+	params, _ := json.Marshal(daemonrpc.SubscribeParams{AccountID: "acc1", Folder: "Lists"})
+	roundTrip(t, conn, &daemonrpc.Request{ID: 1, Method: daemonrpc.MethodSubscribe, Params: params})
+
+	n := newStubNotifier()
+	t.Cleanup(d.stopWatchers)
+	acct := &config.Account{ID: "acc1", Email: "a@example.com", WatchFolders: []string{"INBOX", "Lists"}}
+	d.watchAccount(acct, n)
+	d.watchAccount(acct, n) // already watched
+	if len(n.folders) != 2 || n.folders[0] != "INBOX" || n.folders[1] != "Lists" {
+		t.Fatalf("watched %q, want [INBOX Lists]", n.folders)
+	}
+
+	// A flag change only refreshes the cache; new mail is announced.
+	n.chans["Lists"] <- backend.NotifyEvent{Type: backend.NotifyFlagChange, Folder: "Lists"}
+	n.chans["Lists"] <- backend.NotifyEvent{Type: backend.NotifyNewEmail, Folder: "Lists"}
+	msg, err := conn.ReceiveMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event == nil || msg.Event.Type != daemonrpc.EventNewMail {
+		t.Fatalf("got %+v, want a NewMail event", msg)
+	}
+	var ev daemonrpc.NewMailEvent
+	if err := json.Unmarshal(msg.Event.Data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.AccountID != "acc1" || ev.Folder != "Lists" {
+		t.Errorf("event = %+v, want acc1/Lists", ev)
+	}
+}
+
+// watched returns the running watch of an account, if any.
+func watched(d *Daemon, accountID string) *accountWatch {
+	d.watchMu.Lock()
+	defer d.watchMu.Unlock()
+	return d.watches[accountID]
+}
+
+func TestDaemon_WatchThatEndsIsForgotten(t *testing.T) {
+	acct := config.Account{ID: "acc1", Email: "a@example.com", WatchFolders: []string{"INBOX", "Lists"}}
+	d := New(&config.Config{Accounts: []config.Account{acct}})
+	t.Cleanup(d.Shutdown)
+
+	n := newStubNotifier()
+	d.watchAccount(&acct, n)
+	if watched(d, "acc1") == nil {
+		t.Fatal("account not watched")
+	}
+
+	// One folder's watch ending ends the account's watch, which is
+	// removed so it can be restarted.
+	n.end["Lists"]()
+	deadline := time.Now().Add(2 * time.Second)
+	for watched(d, "acc1") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("ended watch still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemon_StopStaleWatchers(t *testing.T) {
+	accts := []config.Account{
+		{ID: "same", Email: "a@example.com", WatchFolders: []string{"INBOX"}},
+		{ID: "changed", Email: "b@example.com", WatchFolders: []string{"INBOX"}},
+		{ID: "removed", Email: "c@example.com"},
+	}
+	d := New(&config.Config{Accounts: accts})
+	t.Cleanup(d.stopWatchers)
+	notifiers := make(map[string]*stubNotifier)
+	for i := range accts {
+		notifiers[accts[i].ID] = newStubNotifier()
+		d.watchAccount(&accts[i], notifiers[accts[i].ID])
+	}
+
+	d.mu.Lock()
+	d.config = &config.Config{Accounts: []config.Account{
+		accts[0],
+		{ID: "changed", Email: "b@example.com", WatchFolders: []string{"INBOX", "Lists"}},
+	}}
+	d.mu.Unlock()
+	d.stopStaleWatchers()
+
+	if watched(d, "same") == nil {
+		t.Error("unchanged account no longer watched")
+	}
+	for _, id := range []string{"changed", "removed"} {
+		if watched(d, id) != nil {
+			t.Errorf("%s still watched", id)
+		}
+		if _, ok := <-notifiers[id].chans["INBOX"]; ok {
+			t.Errorf("%s watch not stopped", id)
+		}
+	}
+}
+
+func TestWatchBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 5 * time.Second},
+		{1, 10 * time.Second},
+		{3, 40 * time.Second},
+		{5, 160 * time.Second},
+		{6, 5 * time.Minute},
+		{20, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := watchBackoff(tt.failures); got != tt.want {
+			t.Errorf("watchBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDaemon_OutboxPersistsAcrossRestart(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	d := New(&config.Config{})
+	params, _ := json.Marshal(daemonrpc.QueueEmailParams{
+		Email: daemonrpc.SendEmailParams{
+			AccountID: "acc1",
+			To:        []string{"bob@example.com"},
+			Subject:   "hello",
+			Body:      "body",
+		},
+		DelaySeconds: 60,
+	})
+	res, err := d.handleQueueEmail(context.Background(), nil, params)
+	if err != nil {
+		t.Fatalf("handleQueueEmail: %v", err)
+	}
+	jobID := res.(daemonrpc.QueueEmailResult).JobID
+
+	restarted := New(&config.Config{})
+	restarted.loadOutbox()
+
+	entry, ok := restarted.outbox[jobID]
+	if !ok {
+		t.Fatalf("job %s not restored after restart", jobID)
+	}
+	if entry.Params.Subject != "hello" || entry.Params.Body != "body" {
+		t.Errorf("restored params = %+v", entry.Params)
+	}
+
+	cancelParams, _ := json.Marshal(daemonrpc.CancelEmailParams{JobID: jobID})
+	if _, err := restarted.handleCancelEmail(context.Background(), nil, cancelParams); err != nil {
+		t.Fatalf("handleCancelEmail: %v", err)
+	}
+
+	again := New(&config.Config{})
+	again.loadOutbox()
+	if len(again.outbox) != 0 {
+		t.Errorf("outbox has %d entries after cancel, want 0", len(again.outbox))
+	}
+}
+
+func TestDaemon_OutboxRetriesFailedSend(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	d := New(&config.Config{})
+	entry := &OutboxEntry{
+		ID:      "job1",
+		Params:  daemonrpc.SendEmailParams{AccountID: "missing", Subject: "hi"},
+		SendAt:  time.Now(),
+		sending: true,
+	}
+	d.outbox[entry.ID] = entry
+
+	// The account does not exist, so the send fails and is rescheduled.
+	d.sendOutboxEntry(entry)
+
+	res, err := d.handleListOutbox(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("handleListOutbox: %v", err)
+	}
+	infos := res.([]daemonrpc.OutboxEntryInfo)
+	if len(infos) != 1 {
+		t.Fatalf("got %d outbox entries, want 1", len(infos))
+	}
+	info := infos[0]
+	if info.Attempts != 1 || info.LastError == "" || info.Failed || info.Sending {
+		t.Errorf("unexpected entry after failure: %+v", info)
+	}
+	if !info.SendAt.After(time.Now().Add(outboxBaseBackoff / 2)) {
+		t.Errorf("send_at = %s, want backoff applied", info.SendAt)
+	}
+
+	d.outboxMu.Lock()
+	entry.Attempts = outboxMaxAttempts - 1
+	entry.sending = true
+	d.outboxMu.Unlock()
+	d.sendOutboxEntry(entry)
+	if !entry.Failed {
+		t.Fatal("expected entry to be marked failed after max attempts")
+	}
+
+	params, _ := json.Marshal(daemonrpc.RetryOutboxParams{JobID: "job1"})
+	if _, err := d.handleRetryOutbox(context.Background(), nil, params); err != nil {
+		t.Fatalf("handleRetryOutbox: %v", err)
+	}
+	if entry.Failed || entry.Attempts != 0 || entry.SendAt.After(time.Now()) {
+		t.Errorf("entry not reset for retry: %+v", entry)
+	}
+
+	params, _ = json.Marshal(daemonrpc.RetryOutboxParams{JobID: "nope"})
+	if _, err := d.handleRetryOutbox(context.Background(), nil, params); err == nil {
+		t.Error("expected error retrying unknown job")
+	}
+}
@@ -8,8 +8,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/daemonrpc"
-	"github.com/google/uuid"
 )
 
 // Per-handler timeouts. fetchTimeout covers reads against the upstream IMAP
@@ -39,6 +39,19 @@ func parseError(err error) error {
 	return &daemonrpc.Error{Code: daemonrpc.ErrCodeParse, Message: err.Error()}
 }
 
+// mutateError tags failures to reach the server with the offline code so
+// clients can journal the action and replay it later, and timeouts with the
+// timeout code, as the server may have applied those.
+func mutateError(err error) error {
+	if backend.IsTimeout(err) {
+		return &daemonrpc.Error{Code: daemonrpc.ErrCodeTimeout, Message: err.Error()}
+	}
+	if backend.IsNetworkError(err) {
+		return &daemonrpc.Error{Code: daemonrpc.ErrCodeOffline, Message: err.Error()}
+	}
+	return err
+}
+
 func (d *Daemon) handlePing(_ context.Context, _ *daemonrpc.Conn, _ json.RawMessage) (any, error) {
 	return daemonrpc.PingResult{Pong: true}, nil
 }
@@ -125,6 +138,7 @@ func (d *Daemon) handleFetchEmailBody(ctx context.Context, _ *daemonrpc.Conn, pa
 	if err != nil {
 		return nil, err
 	}
+	go indexBody(args.AccountID, args.Folder, args.UID, body, mimeType, len(attachments) > 0)
 
 	// Convert backend.Attachment to daemonrpc.AttachmentInfo for wire transfer.
 	var attInfos []daemonrpc.AttachmentInfo
@@ -159,8 +173,9 @@ func (d *Daemon) handleDeleteEmails(ctx context.Context, _ *daemonrpc.Conn, para
 	defer cancel()
 
 	if err := p.DeleteEmails(ctx, args.Folder, args.UIDs); err != nil {
-		return nil, err
+		return nil, mutateError(err)
 	}
+	unindex(args.AccountID, args.Folder, args.UIDs)
 	return true, nil
 }
 
@@ -179,8 +194,9 @@ func (d *Daemon) handleArchiveEmails(ctx context.Context, _ *daemonrpc.Conn, par
 	defer cancel()
 
 	if err := p.ArchiveEmails(ctx, args.Folder, args.UIDs); err != nil {
-		return nil, err
+		return nil, mutateError(err)
 	}
+	unindex(args.AccountID, args.Folder, args.UIDs)
 	return true, nil
 }
 
@@ -199,8 +215,9 @@ func (d *Daemon) handleMoveEmails(ctx context.Context, _ *daemonrpc.Conn, params
 	defer cancel()
 
 	if err := p.MoveEmails(ctx, args.UIDs, args.SourceFolder, args.DestFolder); err != nil {
-		return nil, err
+		return nil, mutateError(err)
 	}
+	unindex(args.AccountID, args.SourceFolder, args.UIDs)
 	return true, nil
 }
 
@@ -225,6 +242,9 @@ func (d *Daemon) handleMarkRead(ctx context.Context, _ *daemonrpc.Conn, params j
 		} else {
 			err = p.MarkAsUnread(ctx, args.Folder, uid)
 		}
+		if backend.IsNetworkError(err) {
+			return nil, mutateError(err)
+		}
 		if err != nil {
 			log.Printf("daemon: mark read=%v %d failed: %v", args.Read, uid, err)
 		}
@@ -232,6 +252,60 @@ func (d *Daemon) handleMarkRead(ctx context.Context, _ *daemonrpc.Conn, params j
 	return true, nil
 }
 
+func (d *Daemon) handleMarkFlagged(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.MarkFlaggedParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	p, err := d.getProvider(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mutateTimeout)
+	defer cancel()
+
+	for _, uid := range args.UIDs {
+		if args.Flagged {
+			err = p.MarkFlagged(ctx, args.Folder, uid)
+		} else {
+			err = p.MarkUnflagged(ctx, args.Folder, uid)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return true, nil
+}
+
+func (d *Daemon) handleSetLabel(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.SetLabelParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	p, err := d.getProvider(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mutateTimeout)
+	defer cancel()
+
+	for _, uid := range args.UIDs {
+		if args.Add {
+			err = p.AddLabel(ctx, args.Folder, uid, args.Label)
+		} else {
+			err = p.RemoveLabel(ctx, args.Folder, uid, args.Label)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return true, nil
+}
+
 func (d *Daemon) handleFetchFolders(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
 	args, err := decodeParams[daemonrpc.FetchFoldersParams](params)
 	if err != nil {
@@ -253,6 +327,91 @@ func (d *Daemon) handleFetchFolders(ctx context.Context, _ *daemonrpc.Conn, para
 	return folders, nil
 }
 
+func (d *Daemon) handleCreateFolder(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.CreateFolderParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	p, err := d.getProvider(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mutateTimeout)
+	defer cancel()
+
+	if err := p.CreateFolder(ctx, args.Folder); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (d *Daemon) handleRenameFolder(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.RenameFolderParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	p, err := d.getProvider(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mutateTimeout)
+	defer cancel()
+
+	if err := p.RenameFolder(ctx, args.Folder, args.NewName); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (d *Daemon) handleDeleteFolder(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.DeleteFolderParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	p, err := d.getProvider(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mutateTimeout)
+	defer cancel()
+
+	if err := p.DeleteFolder(ctx, args.Folder); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func (d *Daemon) handleSetSubscribed(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.SetSubscribedParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	p, err := d.getProvider(args.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mutateTimeout)
+	defer cancel()
+
+	if args.Subscribed {
+		err = p.SubscribeFolder(ctx, args.Folder)
+	} else {
+		err = p.UnsubscribeFolder(ctx, args.Folder)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
 func (d *Daemon) handleRefreshFolder(ctx context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
 	args, err := decodeParams[daemonrpc.RefreshFolderParams](params)
 	if err != nil {
@@ -346,17 +505,7 @@ func (d *Daemon) handleQueueEmail(_ context.Context, _ *daemonrpc.Conn, params j
 		return nil, parseError(err)
 	}
 
-	id := uuid.New().String()
-	entry := &OutboxEntry{
-		ID:     id,
-		Params: args.Email,
-		SendAt: time.Now().Add(time.Duration(args.DelaySeconds) * time.Second),
-	}
-
-	d.outboxMu.Lock()
-	d.outbox[id] = entry
-	d.outboxMu.Unlock()
-
+	id := d.queueOutboxEntry(args.Email, time.Duration(args.DelaySeconds)*time.Second)
 	log.Printf("daemon: queued email %s, sending in %ds", id, args.DelaySeconds)
 
 	return daemonrpc.QueueEmailResult{JobID: id}, nil
@@ -369,9 +518,14 @@ func (d *Daemon) handleCancelEmail(_ context.Context, _ *daemonrpc.Conn, params
 	}
 
 	d.outboxMu.Lock()
-	_, exists := d.outbox[args.JobID]
+	entry, exists := d.outbox[args.JobID]
+	if exists && entry.sending {
+		d.outboxMu.Unlock()
+		return nil, fmt.Errorf("job %s is already being sent", args.JobID)
+	}
 	if exists {
 		delete(d.outbox, args.JobID)
+		d.saveOutboxLocked()
 	}
 	d.outboxMu.Unlock()
 
@@ -382,3 +536,41 @@ func (d *Daemon) handleCancelEmail(_ context.Context, _ *daemonrpc.Conn, params
 	log.Printf("daemon: cancelled email %s", args.JobID)
 	return true, nil
 }
+
+func (d *Daemon) handleListOutbox(_ context.Context, _ *daemonrpc.Conn, _ json.RawMessage) (any, error) {
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+
+	entries := d.sortedOutboxLocked()
+	infos := make([]daemonrpc.OutboxEntryInfo, 0, len(entries))
+	for _, entry := range entries {
+		infos = append(infos, entry.info())
+	}
+	return infos, nil
+}
+
+func (d *Daemon) handleRetryOutbox(_ context.Context, _ *daemonrpc.Conn, params json.RawMessage) (any, error) {
+	args, err := decodeParams[daemonrpc.RetryOutboxParams](params)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+
+	entry, exists := d.outbox[args.JobID]
+	if !exists {
+		return nil, fmt.Errorf("job %s not found", args.JobID)
+	}
+	if entry.sending {
+		return nil, fmt.Errorf("job %s is already being sent", args.JobID)
+	}
+
+	entry.Failed = false
+	entry.Attempts = 0
+	entry.SendAt = time.Now()
+	d.saveOutboxLocked()
+
+	log.Printf("daemon: retrying email %s", args.JobID)
+	return true, nil
+}
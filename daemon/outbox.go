@@ -0,0 +1,296 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/floatpane/matcha/fetcher"
+	"github.com/floatpane/matcha/sender"
+	"github.com/google/uuid"
+)
+
+// Outbox retry policy. A failed send is retried after outboxBaseBackoff,
+// doubling on each further failure up to outboxMaxBackoff. After
+// outboxMaxAttempts failures the entry is marked failed and stays in the
+// outbox until a client asks for it to be retried or cancels it.
+const (
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = time.Hour
+)
+
+// OutboxEntry is a queued email waiting to be sent. Entries are persisted to
+// the cache directory so queued mail survives daemon restarts.
+type OutboxEntry struct {
+	ID     string                    `json:"id"`
+	Params daemonrpc.SendEmailParams `json:"params"`
+	// Raw is a message submitted over SMTP. It is relayed as it is to the
+	// recipients in Params, which only describes it otherwise.
+	Raw       []byte    `json:"raw,omitempty"`
+	SendAt    time.Time `json:"send_at"`
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Failed    bool      `json:"failed,omitempty"`
+
+	// sending is set while a send goroutine owns the entry.
+	sending bool
+}
+
+// info converts the entry to its wire representation, without the message
+// body or attachments.
+func (e *OutboxEntry) info() daemonrpc.OutboxEntryInfo {
+	return daemonrpc.OutboxEntryInfo{
+		JobID:     e.ID,
+		AccountID: e.Params.AccountID,
+		To:        e.Params.To,
+		Subject:   e.Params.Subject,
+		SendAt:    e.SendAt,
+		Attempts:  e.Attempts,
+		LastError: e.LastError,
+		Failed:    e.Failed,
+		Sending:   e.sending,
+	}
+}
+
+// outboxBackoff returns the delay before the next attempt after the given
+// number of failed attempts.
+func outboxBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	delay := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return delay
+}
+
+// outboxFile returns the full path to the persisted outbox.
+func outboxFile() (string, error) {
+	dir, err := config.GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "outbox.json"), nil
+}
+
+// loadOutboxEntries reads the persisted outbox. A missing file yields no
+// entries.
+func loadOutboxEntries() ([]*OutboxEntry, error) {
+	path, err := outboxFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := config.SecureReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*OutboxEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// saveOutboxEntries writes the outbox to disk, encrypting it when secure mode
+// is enabled.
+func saveOutboxEntries(entries []*OutboxEntry) error {
+	path, err := outboxFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return config.SecureWriteFile(path, data, 0600)
+}
+
+// queueOutboxEntry adds params to the outbox to be sent after delay and
+// returns the new job ID.
+func (d *Daemon) queueOutboxEntry(params daemonrpc.SendEmailParams, delay time.Duration) string {
+	return d.addOutboxEntry(&OutboxEntry{Params: params, SendAt: time.Now().Add(delay)})
+}
+
+// queueRawOutboxEntry adds a complete message to the outbox to be sent
+// straight away to the recipients in params, and returns the new job ID.
+func (d *Daemon) queueRawOutboxEntry(params daemonrpc.SendEmailParams, raw []byte) string {
+	return d.addOutboxEntry(&OutboxEntry{Params: params, Raw: raw, SendAt: time.Now()})
+}
+
+func (d *Daemon) addOutboxEntry(entry *OutboxEntry) string {
+	entry.ID = uuid.New().String()
+
+	d.outboxMu.Lock()
+	d.outbox[entry.ID] = entry
+	d.saveOutboxLocked()
+	d.outboxMu.Unlock()
+
+	return entry.ID
+}
+
+// loadOutbox restores entries persisted by a previous daemon run.
+func (d *Daemon) loadOutbox() {
+	entries, err := loadOutboxEntries()
+	if err != nil {
+		log.Printf("daemon: failed to load outbox: %v", err)
+		return
+	}
+
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+	for _, entry := range entries {
+		if entry == nil || entry.ID == "" {
+			continue
+		}
+		d.outbox[entry.ID] = entry
+	}
+	if len(d.outbox) > 0 {
+		log.Printf("daemon: restored %d outbox entries", len(d.outbox))
+	}
+}
+
+// sortedOutboxLocked returns the outbox entries ordered by send time.
+// outboxMu must be held.
+func (d *Daemon) sortedOutboxLocked() []*OutboxEntry {
+	entries := make([]*OutboxEntry, 0, len(d.outbox))
+	for _, entry := range d.outbox {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].SendAt.Before(entries[j].SendAt)
+	})
+	return entries
+}
+
+// saveOutboxLocked persists the current outbox. outboxMu must be held.
+func (d *Daemon) saveOutboxLocked() {
+	if err := saveOutboxEntries(d.sortedOutboxLocked()); err != nil {
+		log.Printf("daemon: failed to persist outbox: %v", err)
+	}
+}
+
+func (d *Daemon) processOutbox(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			d.outboxMu.Lock()
+			for _, entry := range d.outbox {
+				if entry.sending || entry.Failed || now.Before(entry.SendAt) {
+					continue
+				}
+				entry.sending = true
+				go d.sendOutboxEntry(entry)
+			}
+			d.outboxMu.Unlock()
+		}
+	}
+}
+
+func (d *Daemon) sendOutboxEntry(entry *OutboxEntry) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("daemon: panic sending outbox entry %s: %v", entry.ID, r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+		d.finishOutboxEntry(entry, err)
+	}()
+
+	err = d.deliverOutboxEntry(entry)
+}
+
+// deliverOutboxEntry sends the entry, building the message from its params
+// unless it was submitted complete, and appends it to the Sent mailbox. A
+// failed Sent append is logged but does not count as a failed send, since the
+// message has already left.
+func (d *Daemon) deliverOutboxEntry(entry *OutboxEntry) error {
+	acct := d.getAccount(entry.Params.AccountID)
+	if acct == nil {
+		return fmt.Errorf("no account for %s", entry.Params.AccountID)
+	}
+
+	rawMsg := entry.Raw
+	var err error
+	if rawMsg != nil {
+		err = sender.SendRaw(acct, entry.Params.To, entry.Params.Cc, entry.Params.Bcc, rawMsg)
+	} else {
+		rawMsg, err = sender.SendEmailWithHeaders(
+			acct,
+			entry.Params.To,
+			entry.Params.Cc,
+			entry.Params.Bcc,
+			entry.Params.Subject,
+			entry.Params.Body,
+			entry.Params.HTMLBody,
+			entry.Params.Images,
+			entry.Params.Attachments,
+			entry.Params.InReplyTo,
+			entry.Params.References,
+			entry.Params.Headers,
+			entry.Params.SignSMIME,
+			entry.Params.EncryptSMIME,
+			entry.Params.SignPGP,
+			entry.Params.EncryptPGP,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	if acct.ServiceProvider != "gmail" {
+		if err := fetcher.AppendToSentMailbox(acct, rawMsg); err != nil {
+			log.Printf("daemon: append to sent failed for %s: %v", entry.ID, err)
+		}
+	}
+	return nil
+}
+
+// finishOutboxEntry records the outcome of a send attempt. Successful entries
+// are removed; failed ones are rescheduled with backoff, or marked failed once
+// they run out of attempts.
+func (d *Daemon) finishOutboxEntry(entry *OutboxEntry, err error) {
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+
+	entry.sending = false
+	if err == nil {
+		delete(d.outbox, entry.ID)
+		log.Printf("daemon: outbox sent email %s", entry.ID)
+	} else {
+		entry.Attempts++
+		entry.LastError = err.Error()
+		if entry.Attempts >= outboxMaxAttempts {
+			entry.Failed = true
+			log.Printf("daemon: outbox send failed for %s, giving up after %d attempts: %v", entry.ID, entry.Attempts, err)
+		} else {
+			delay := outboxBackoff(entry.Attempts)
+			entry.SendAt = time.Now().Add(delay)
+			log.Printf("daemon: outbox send failed for %s (attempt %d), retrying in %s: %v", entry.ID, entry.Attempts, delay, err)
+		}
+	}
+	d.saveOutboxLocked()
+}
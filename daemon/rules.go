@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/notify"
+	"github.com/floatpane/matcha/rules"
+)
+
+// syncNewMail syncs a folder like syncFolder and runs the configured rules
+// over the emails that arrived since the last sync. It returns the folder's
+// cached emails after the rules ran, and the emails that arrived. Nothing
+// arrives on a folder's first sync, or after its UIDVALIDITY changed, so
+// rules never act on, and notifications never announce, mail that was there
+// before the daemon first saw it.
+func (d *Daemon) syncNewMail(ctx context.Context, acct *config.Account, folder string) ([]config.CachedEmail, []config.CachedEmail, error) {
+	d.arrivalMu.Lock()
+	defer d.arrivalMu.Unlock()
+
+	before := config.GetFolderSyncState(acct.ID, folder)
+	first := before.IsZero()
+	if before.UIDValidity == 0 && before.Newest.IsZero() {
+		// A non-IMAP folder without a high-water mark is new, or was
+		// last synced by a version that kept none.
+		existing, _ := config.LoadFolderEmailCache(folder)
+		first = first || slices.ContainsFunc(existing, func(e config.CachedEmail) bool { return e.AccountID == acct.ID })
+	}
+
+	cached, err := d.syncFolder(ctx, acct, folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	if first || before.UIDValidity != config.GetFolderSyncState(acct.ID, folder).UIDValidity {
+		return cached, nil, nil
+	}
+	var arrived []config.CachedEmail
+	for _, e := range cached {
+		if arrivedSince(before, e) {
+			arrived = append(arrived, e)
+		}
+	}
+	if !d.applyRules(ctx, acct, folder, arrived) {
+		return cached, arrived, nil
+	}
+
+	// Sync again so the cache reflects what the rules moved and flagged.
+	resynced, err := d.syncFolder(ctx, acct, folder)
+	if err != nil {
+		log.Printf("daemon: resync of %s/%s after rules failed: %v", acct.ID, folder, err)
+		return cached, arrived, nil
+	}
+	return resynced, arrived, nil
+}
+
+// arrivedSince reports whether e arrived after the sync that left state.
+// Being missing from the cache is not enough: older mail is fetched into it
+// when newer mail is expunged. IMAP mail arrived if its UID is at least the
+// folder's UIDNEXT then; other backends' UIDs do not grow with arrival, so
+// their mail arrived if it is dated after the newest email seen then.
+func arrivedSince(state config.FolderSyncState, e config.CachedEmail) bool {
+	if state.UIDValidity != 0 {
+		return e.UID >= state.UIDNext
+	}
+	return e.Date.After(state.Newest)
+}
+
+// applyRules runs the configured rules over emails in folder and reports
+// whether they changed anything on the server.
+func (d *Daemon) applyRules(ctx context.Context, acct *config.Account, folder string, emails []config.CachedEmail) bool {
+	d.mu.RLock()
+	ruleSet := rules.ForFolder(d.config.Rules, folder)
+	quiet := d.config.DisableNotifications
+	d.mu.RUnlock()
+	if len(ruleSet) == 0 || len(emails) == 0 {
+		return false
+	}
+
+	msgs, err := rules.Messages(acct, folder, emails, rules.NeedsHeaders(ruleSet))
+	if err != nil {
+		// Header and size conditions just don't match.
+		log.Printf("daemon: rules: fetching headers for %s/%s: %v", acct.ID, folder, err)
+	}
+	plan := rules.Evaluate(ruleSet, folder, msgs)
+	if !quiet {
+		for _, n := range plan.Notices {
+			go notify.Send("Matcha", fmt.Sprintf("%s: %s", n.Rule, n.Email.Subject)) //nolint:errcheck
+		}
+	}
+	if plan.Empty() {
+		return false
+	}
+
+	p, err := d.getProvider(acct.ID)
+	if err != nil {
+		log.Printf("daemon: rules: %v", err)
+		return false
+	}
+	if err := plan.Apply(ctx, p); err != nil {
+		log.Printf("daemon: rules for %s/%s: %v", acct.ID, folder, err)
+	}
+	return true
+}
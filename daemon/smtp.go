@@ -0,0 +1,395 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/emersion/go-message/charset" // decode non-UTF-8 submissions
+	"github.com/emersion/go-message/mail"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/daemonrpc"
+)
+
+// Limits for the local SMTP submission listener.
+const (
+	submissionMaxSize     = 50 << 20 // bytes per message
+	submissionMaxRcpts    = 100
+	submissionIdleTimeout = 5 * time.Minute
+)
+
+// SubmissionTokenFile is the file in the config directory holding the
+// password SMTP clients must give to the submission listener.
+const SubmissionTokenFile = "smtp_token"
+
+// startSubmissionServer listens for SMTP submissions on the loopback
+// interface. Clients must authenticate with AUTH PLAIN using the token in
+// SubmissionTokenFile, which only the user can read, so other users on the
+// machine cannot send as the user's accounts.
+func (d *Daemon) startSubmissionServer(ctx context.Context, port int) error {
+	token, err := submissionToken()
+	if err != nil {
+		return fmt.Errorf("token: %w", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	l, err := net.Listen("tcp", addr) //nolint:noctx
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	log.Printf("daemon: SMTP submission listening on %s", addr)
+	go d.serveSubmission(ctx, l, token)
+	return nil
+}
+
+// submissionToken returns the submission password from the config
+// directory, creating a random one on first use.
+func submissionToken() (string, error) {
+	dir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, SubmissionTokenFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// serveSubmission accepts SMTP connections on l until ctx is canceled.
+// Clients must authenticate with token.
+func (d *Daemon) serveSubmission(ctx context.Context, l net.Listener, token string) {
+	go func() {
+		<-ctx.Done()
+		l.Close() //nolint:errcheck,gosec
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("daemon: SMTP accept failed: %v", err)
+			continue
+		}
+		if !isLoopbackAddr(conn.RemoteAddr()) {
+			log.Printf("daemon: rejected SMTP connection from %s", conn.RemoteAddr())
+			conn.Close() //nolint:errcheck,gosec
+			continue
+		}
+		go d.handleSubmissionConn(conn, token)
+	}
+}
+
+func isLoopbackAddr(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// submissionSession holds the state of one SMTP connection.
+type submissionSession struct {
+	authenticated bool
+	accountID     string
+	rcpts         []string
+}
+
+// reset clears the envelope; authentication lasts for the connection.
+func (s *submissionSession) reset() {
+	s.accountID = ""
+	s.rcpts = nil
+}
+
+func (d *Daemon) handleSubmissionConn(conn net.Conn, token string) {
+	defer conn.Close() //nolint:errcheck
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("daemon: panic in SMTP session: %v", r)
+		}
+	}()
+
+	tc := textproto.NewConn(conn)
+	reply := func(format string, args ...any) bool {
+		return tc.PrintfLine(format, args...) == nil
+	}
+
+	var sess submissionSession
+	if !reply("220 localhost matcha ESMTP ready") {
+		return
+	}
+
+	for {
+		conn.SetDeadline(time.Now().Add(submissionIdleTimeout)) //nolint:errcheck,gosec
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		arg = strings.TrimSpace(arg)
+
+		var ok bool
+		switch verb {
+		case "EHLO":
+			ok = reply("250-localhost") &&
+				reply("250-8BITMIME") &&
+				reply("250-AUTH PLAIN") &&
+				reply("250 SIZE %d", submissionMaxSize)
+		case "HELO":
+			ok = reply("250 localhost")
+		case "AUTH":
+			ok = submissionAuth(&sess, tc, arg, token, reply)
+		case "MAIL":
+			if !sess.authenticated {
+				ok = reply("530 5.7.0 Authentication required")
+				break
+			}
+			ok = d.submissionMail(&sess, arg, reply)
+		case "RCPT":
+			ok = submissionRcpt(&sess, arg, reply)
+		case "DATA":
+			ok = d.submissionData(&sess, tc, reply)
+		case "RSET":
+			sess.reset()
+			ok = reply("250 2.0.0 OK")
+		case "NOOP":
+			ok = reply("250 2.0.0 OK")
+		case "VRFY":
+			ok = reply("252 2.5.0 Cannot verify user")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			ok = reply("502 5.5.2 Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// submissionAuth handles AUTH PLAIN (RFC 4616). Any user name is accepted;
+// the password must be the submission token.
+func submissionAuth(sess *submissionSession, tc *textproto.Conn, arg, token string, reply func(string, ...any) bool) bool {
+	if sess.authenticated {
+		return reply("503 5.5.1 Already authenticated")
+	}
+	mech, resp, _ := strings.Cut(arg, " ")
+	if !strings.EqualFold(mech, "PLAIN") {
+		return reply("504 5.5.4 Unrecognized authentication type")
+	}
+	if resp == "" {
+		if !reply("334 ") {
+			return false
+		}
+		line, err := tc.ReadLine()
+		if err != nil {
+			return false
+		}
+		resp = line
+	}
+	if resp == "*" {
+		return reply("501 5.0.0 Authentication cancelled")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(resp))
+	if err != nil {
+		return reply("501 5.5.2 Cannot decode response")
+	}
+	parts := strings.Split(string(decoded), "\x00")
+	if len(parts) != 3 {
+		return reply("501 5.5.2 Malformed PLAIN response")
+	}
+	if subtle.ConstantTimeCompare([]byte(parts[2]), []byte(token)) != 1 {
+		return reply("535 5.7.8 Authentication credentials invalid")
+	}
+	sess.authenticated = true
+	return reply("235 2.7.0 Authentication successful")
+}
+
+// submissionMail maps the envelope sender to a configured account.
+func (d *Daemon) submissionMail(sess *submissionSession, arg string, reply func(string, ...any) bool) bool {
+	if sess.accountID != "" {
+		return reply("503 5.5.1 Sender already specified")
+	}
+	from, ok := parseSMTPPath(arg, "FROM:")
+	if !ok {
+		return reply("501 5.5.4 Syntax: MAIL FROM:<address>")
+	}
+
+	d.mu.RLock()
+	acct := d.config.GetAccountByEmail(from)
+	var accountID string
+	if acct != nil {
+		accountID = acct.ID
+	}
+	d.mu.RUnlock()
+
+	if accountID == "" {
+		return reply("550 5.7.1 No matcha account for <%s>", from)
+	}
+	sess.accountID = accountID
+	return reply("250 2.1.0 OK")
+}
+
+func submissionRcpt(sess *submissionSession, arg string, reply func(string, ...any) bool) bool {
+	if sess.accountID == "" {
+		return reply("503 5.5.1 Need MAIL before RCPT")
+	}
+	rcpt, ok := parseSMTPPath(arg, "TO:")
+	if !ok || rcpt == "" {
+		return reply("501 5.5.4 Syntax: RCPT TO:<address>")
+	}
+	if len(sess.rcpts) >= submissionMaxRcpts {
+		return reply("452 4.5.3 Too many recipients")
+	}
+	sess.rcpts = append(sess.rcpts, rcpt)
+	return reply("250 2.1.5 OK")
+}
+
+// submissionData reads the message and queues it in the outbox for
+// immediate delivery. The message is relayed as it was submitted, so its
+// Message-ID and threading headers survive.
+func (d *Daemon) submissionData(sess *submissionSession, tc *textproto.Conn, reply func(string, ...any) bool) bool {
+	if sess.accountID == "" || len(sess.rcpts) == 0 {
+		return reply("503 5.5.1 Need MAIL and RCPT before DATA")
+	}
+	if !reply("354 End data with <CR><LF>.<CR><LF>") {
+		return false
+	}
+
+	dr := tc.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dr, submissionMaxSize+1))
+	if err != nil {
+		return false
+	}
+	defer sess.reset()
+	if len(raw) > submissionMaxSize {
+		// Drain the rest of the message so the connection stays in sync.
+		if _, err := io.Copy(io.Discard, dr); err != nil {
+			return false
+		}
+		return reply("552 5.3.4 Message too big")
+	}
+
+	// The dot reader hands lines back with bare LF endings.
+	raw = bytes.ReplaceAll(raw, []byte("\n"), []byte("\r\n"))
+	params, err := parseSubmittedMessage(raw, sess.rcpts)
+	if err != nil {
+		return reply("554 5.6.0 Could not parse message: %v", err)
+	}
+	params.AccountID = sess.accountID
+
+	id := d.queueRawOutboxEntry(params, raw)
+	log.Printf("daemon: queued SMTP submission %s for %d recipients", id, len(sess.rcpts))
+	return reply("250 2.0.0 OK queued as %s", id)
+}
+
+// parseSMTPPath extracts the address from a MAIL FROM or RCPT TO argument,
+// ignoring any ESMTP parameters after it.
+func parseSMTPPath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return "", false
+		}
+		return rest[1:end], true
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// parseSubmittedMessage reads the envelope of a raw RFC 5322 message for the
+// outbox: its subject and recipients. Envelope recipients missing from To
+// and Cc become Bcc recipients. The message itself is sent unchanged.
+func parseSubmittedMessage(raw []byte, rcpts []string) (daemonrpc.SendEmailParams, error) {
+	var params daemonrpc.SendEmailParams
+
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return params, err
+	}
+	defer mr.Close() //nolint:errcheck
+
+	params.Subject, _ = mr.Header.Subject()
+	params.To = headerAddresses(mr.Header, "To")
+	params.Cc = headerAddresses(mr.Header, "Cc")
+
+	visible := make(map[string]bool, len(params.To)+len(params.Cc))
+	for _, addr := range append(append([]string{}, params.To...), params.Cc...) {
+		visible[strings.ToLower(addr)] = true
+	}
+	params.To, params.Cc = onlyRecipients(params.To, rcpts), onlyRecipients(params.Cc, rcpts)
+	for _, rcpt := range rcpts {
+		if !visible[strings.ToLower(rcpt)] {
+			params.Bcc = append(params.Bcc, rcpt)
+		}
+	}
+	return params, nil
+}
+
+// onlyRecipients returns the addresses in addrs that are also envelope
+// recipients. SMTP clients such as git send-email may leave addresses in
+// the headers out of the envelope, and those must not receive the message.
+func onlyRecipients(addrs, rcpts []string) []string {
+	var out []string
+	for _, addr := range addrs {
+		for _, rcpt := range rcpts {
+			if strings.EqualFold(addr, rcpt) {
+				out = append(out, addr)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func headerAddresses(h mail.Header, key string) []string {
+	list, err := h.AddressList(key)
+	if err != nil {
+		return nil
+	}
+	addrs := make([]string, 0, len(list))
+	for _, addr := range list {
+		addrs = append(addrs, addr.Address)
+	}
+	return addrs
+}
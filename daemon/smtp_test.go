@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/floatpane/matcha/config"
+)
+
+// serveSubmissionForTest starts the SMTP submission listener on an ephemeral
+// loopback port and returns its address and the credentials to submit with.
+func serveSubmissionForTest(t *testing.T, d *Daemon) (string, smtp.Auth) {
+	t.Helper()
+	token, err := submissionToken()
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.serveSubmission(ctx, l, token)
+	t.Cleanup(cancel)
+	return l.Addr().String(), smtp.PlainAuth("", "alice@example.com", token, "127.0.0.1")
+}
+
+func TestSubmission_QueuesMessage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	d := New(&config.Config{Accounts: []config.Account{
+		{ID: "acc1", Email: "alice@example.com"},
+	}})
+	addr, auth := serveSubmissionForTest(t, d)
+
+	msg := strings.Join([]string{
+		"From: Alice <alice@example.com>",
+		"To: Bob <bob@example.com>",
+		"Cc: carol@example.com",
+		"Subject: [PATCH] fix the thing",
+		"Message-ID: <patch1@example.com>",
+		"In-Reply-To: <cover@example.com>",
+		"References: <root@example.com> <cover@example.com>",
+		"",
+		"--- a/x.go",
+		"+++ b/x.go",
+		"",
+	}, "\r\n")
+	rcpts := []string{"bob@example.com", "carol@example.com", "dave@example.com"}
+	if err := smtp.SendMail(addr, auth, "alice@example.com", rcpts, []byte(msg)); err != nil {
+		t.Fatalf("SendMail: %v", err)
+	}
+
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+	if len(d.outbox) != 1 {
+		t.Fatalf("outbox has %d entries, want 1", len(d.outbox))
+	}
+	for _, entry := range d.outbox {
+		p := entry.Params
+		if p.AccountID != "acc1" {
+			t.Errorf("account = %q, want acc1", p.AccountID)
+		}
+		if p.Subject != "[PATCH] fix the thing" {
+			t.Errorf("subject = %q", p.Subject)
+		}
+		if len(p.To) != 1 || p.To[0] != "bob@example.com" {
+			t.Errorf("to = %v", p.To)
+		}
+		if len(p.Cc) != 1 || p.Cc[0] != "carol@example.com" {
+			t.Errorf("cc = %v", p.Cc)
+		}
+		if len(p.Bcc) != 1 || p.Bcc[0] != "dave@example.com" {
+			t.Errorf("bcc = %v", p.Bcc)
+		}
+		// The message is relayed as submitted, threading headers included.
+		if string(entry.Raw) != msg {
+			t.Errorf("raw = %q, want the submitted message %q", entry.Raw, msg)
+		}
+		if p.Body != "" || p.HTMLBody != "" {
+			t.Errorf("params carry a rebuilt body: %q, %q", p.Body, p.HTMLBody)
+		}
+	}
+}
+
+func TestSubmission_RejectsUnknownSender(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	d := New(&config.Config{Accounts: []config.Account{
+		{ID: "acc1", Email: "alice@example.com"},
+	}})
+	addr, auth := serveSubmissionForTest(t, d)
+
+	err := smtp.SendMail(addr, auth, "mallory@example.com", []string{"bob@example.com"}, []byte("Subject: hi\r\n\r\nhi\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("SendMail err = %v, want 550 rejection", err)
+	}
+
+	d.outboxMu.Lock()
+	defer d.outboxMu.Unlock()
+	if len(d.outbox) != 0 {
+		t.Errorf("outbox has %d entries, want 0", len(d.outbox))
+	}
+}
+
+func TestSubmission_RequiresAuth(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	d := New(&config.Config{Accounts: []config.Account{
+		{ID: "acc1", Email: "alice@example.com"},
+	}})
+	addr, _ := serveSubmissionForTest(t, d)
+	msg := []byte("Subject: hi\r\n\r\nhi\r\n")
+
+	err := smtp.SendMail(addr, nil, "alice@example.com", []string{"bob@example.com"}, msg)
+	if err == nil || !strings.Contains(err.Error(), "530") {
+		t.Errorf("SendMail without AUTH err = %v, want 530 rejection", err)
+	}
+	wrong := smtp.PlainAuth("", "alice@example.com", "guess", "127.0.0.1")
+	err = smtp.SendMail(addr, wrong, "alice@example.com", []string{"bob@example.com"}, msg)
+	if err == nil || !strings.Contains(err.Error(), "535") {
+		t.Errorf("SendMail with a wrong token err = %v, want 535 rejection", err)
+	}
+
+	d.outboxMu.Lock()
+	if len(d.outbox) != 0 {
+		t.Errorf("outbox has %d entries, want 0", len(d.outbox))
+	}
+	d.outboxMu.Unlock()
+
+	info, err := os.Stat(filepath.Join(home, ".config", "matcha", SubmissionTokenFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestParseSMTPPath(t *testing.T) {
+	tests := []struct {
+		arg, prefix, want string
+		ok                bool
+	}{
+		{"FROM:<a@example.com>", "FROM:", "a@example.com", true},
+		{"from: <a@example.com> SIZE=100 BODY=8BITMIME", "FROM:", "a@example.com", true},
+		{"TO:b@example.com", "TO:", "b@example.com", true},
+		{"FROM:<>", "FROM:", "", true},
+		{"TO:<broken", "TO:", "", false},
+		{"FROM:<a@example.com>", "TO:", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSMTPPath(tt.arg, tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseSMTPPath(%q, %q) = %q, %v; want %q, %v", tt.arg, tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
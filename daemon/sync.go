@@ -0,0 +1,270 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/floatpane/matcha/fetcher"
+	"github.com/floatpane/matcha/searchindex"
+)
+
+// syncWindow is how many of a folder's newest emails the daemon keeps cached
+// per account.
+const syncWindow = 50
+
+// indexFlushDelay is how long the search index waits after a body is added
+// before it is written, so reading through a folder rewrites it once.
+const indexFlushDelay = 5 * time.Second
+
+// indexFlush holds the timer of the pending search index write.
+var indexFlush struct {
+	sync.Mutex
+	timer *time.Timer
+}
+
+// syncFolder brings the account's part of a folder's disk cache up to date
+// and returns it. IMAP folders are synced incrementally from the stored
+// UIDVALIDITY/HIGHESTMODSEQ; other backends are re-fetched.
+func (d *Daemon) syncFolder(ctx context.Context, acct *config.Account, folder string) ([]config.CachedEmail, error) {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	if acct.Protocol != "" && acct.Protocol != "imap" {
+		p, err := d.getProvider(acct.ID)
+		if err != nil {
+			return nil, err
+		}
+		emails, err := p.FetchEmails(ctx, folder, syncWindow, 0)
+		if err != nil {
+			return nil, err
+		}
+		cached := make([]config.CachedEmail, 0, len(emails))
+		for _, e := range emails {
+			cached = append(cached, cachedFromBackend(e))
+		}
+		if err := d.updateFolderCache(folder, acct.ID, cached); err != nil {
+			return nil, err
+		}
+		state := config.FolderSyncState{Synced: true, Newest: config.GetFolderSyncState(acct.ID, folder).Newest}
+		for _, e := range cached {
+			if e.Date.After(state.Newest) {
+				state.Newest = e.Date
+			}
+		}
+		if err := config.SaveFolderSyncState(acct.ID, folder, state); err != nil {
+			return nil, err
+		}
+		indexFolder(acct.ID, folder, cached, nil, false)
+		d.emailsUpdated(acct.ID, folder)
+		return cached, nil
+	}
+
+	var known []config.CachedEmail
+	existing, _ := config.LoadFolderEmailCache(folder)
+	for _, e := range existing {
+		if e.AccountID == acct.ID {
+			known = append(known, e)
+		}
+	}
+	knownUIDs := make([]uint32, len(known))
+	for i, e := range known {
+		knownUIDs[i] = e.UID
+	}
+
+	state := config.GetFolderSyncState(acct.ID, folder)
+	res, err := fetcher.SyncMailboxEmails(acct, folder, state, knownUIDs, syncWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := applySync(known, res, syncWindow)
+	if err := d.updateFolderCache(folder, acct.ID, cached); err != nil {
+		return nil, err
+	}
+	// Only remember the new state once the cache matches it.
+	if err := config.SaveFolderSyncState(acct.ID, folder, res.State); err != nil {
+		return nil, err
+	}
+	reset := state.UIDValidity != 0 && state.UIDValidity != res.State.UIDValidity
+	indexFolder(acct.ID, folder, cached, res.Vanished, reset)
+	if res.Full || len(res.Emails) > 0 || len(res.Updates) > 0 || len(res.Vanished) > 0 {
+		d.emailsUpdated(acct.ID, folder)
+	}
+	return cached, nil
+}
+
+// emailsUpdated tells subscribers that a folder's cached emails changed, so
+// views derived from them, like saved searches, can be refreshed.
+func (d *Daemon) emailsUpdated(accountID, folder string) {
+	d.broadcastToSubscribers(accountID, folder, daemonrpc.EventEmailsUpdated, daemonrpc.EmailsUpdatedEvent{
+		AccountID: accountID,
+		Folder:    folder,
+	})
+}
+
+// indexFolder brings the search index in line with a synced folder: vanished
+// emails are dropped, new ones added, and bodies the TUI has cached since the
+// last sync indexed. reset drops the folder first, for a UIDVALIDITY change.
+// Indexing is best effort; failures only cost search results.
+func indexFolder(accountID, folder string, cached []config.CachedEmail, vanished []uint32, reset bool) {
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("search index: %v", err)
+		return
+	}
+	if reset {
+		ix.RemoveFolder(accountID, folder)
+	}
+	ix.Remove(accountID, folder, vanished)
+	ix.AddEmails(folder, cached)
+
+	if bodies, err := config.LoadEmailBodyCache(folder); err == nil {
+		for _, b := range bodies.Bodies {
+			if b.AccountID == accountID && !ix.HasBody(accountID, folder, b.UID) {
+				ix.AddBody(accountID, folder, b.UID, b.Body, b.BodyMIMEType, len(b.Attachments) > 0)
+			}
+		}
+	}
+	if err := ix.Flush(); err != nil {
+		log.Printf("search index: %v", err)
+	}
+}
+
+// applySync folds a sync result into an account's cached emails for a
+// folder, keeping the newest limit by UID.
+func applySync(known []config.CachedEmail, res *fetcher.SyncResult, limit int) []config.CachedEmail {
+	var out []config.CachedEmail
+	if !res.Full {
+		vanished := make(map[uint32]bool, len(res.Vanished))
+		for _, uid := range res.Vanished {
+			vanished[uid] = true
+		}
+		updates := make(map[uint32]fetcher.FlagUpdate, len(res.Updates))
+		for _, u := range res.Updates {
+			updates[u.UID] = u
+		}
+		for _, e := range known {
+			if vanished[e.UID] {
+				continue
+			}
+			if u, ok := updates[e.UID]; ok {
+				e.IsRead = u.IsRead
+				e.IsFlagged = u.IsFlagged
+				e.Labels = u.Labels
+			}
+			out = append(out, e)
+		}
+	}
+
+	seen := make(map[uint32]bool, len(out))
+	for _, e := range out {
+		seen[e.UID] = true
+	}
+	for _, e := range res.Emails {
+		if !seen[e.UID] {
+			out = append(out, cachedFromFetcher(e))
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].UID > out[j].UID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func cachedFromFetcher(e fetcher.Email) config.CachedEmail {
+	return config.CachedEmail{
+		UID:        e.UID,
+		From:       e.From,
+		To:         e.To,
+		Subject:    e.Subject,
+		Date:       e.Date,
+		MessageID:  e.MessageID,
+		InReplyTo:  e.InReplyTo,
+		References: e.References,
+		AccountID:  e.AccountID,
+		IsRead:     e.IsRead,
+		IsFlagged:  e.IsFlagged,
+		Labels:     e.Labels,
+	}
+}
+
+func cachedFromBackend(e backend.Email) config.CachedEmail {
+	return config.CachedEmail{
+		UID:        e.UID,
+		From:       e.From,
+		To:         e.To,
+		Subject:    e.Subject,
+		Date:       e.Date,
+		MessageID:  e.MessageID,
+		InReplyTo:  e.InReplyTo,
+		References: e.References,
+		AccountID:  e.AccountID,
+		IsRead:     e.IsRead,
+		IsFlagged:  e.IsFlagged,
+		Labels:     e.Labels,
+	}
+}
+
+// indexBody adds a fetched body to the search index and schedules a write.
+// It runs off the request path, as tokenizing a long body takes a while.
+func indexBody(accountID, folder string, uid uint32, body, mimeType string, hasAttachment bool) {
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("search index: %v", err)
+		return
+	}
+	ix.AddBody(accountID, folder, uid, body, mimeType, hasAttachment)
+
+	indexFlush.Lock()
+	defer indexFlush.Unlock()
+	if indexFlush.timer == nil {
+		indexFlush.timer = time.AfterFunc(indexFlushDelay, flushSearchIndex)
+	}
+}
+
+// flushSearchIndex writes the search index if a write is pending.
+func flushSearchIndex() {
+	indexFlush.Lock()
+	pending := indexFlush.timer != nil
+	if pending {
+		indexFlush.timer.Stop()
+		indexFlush.timer = nil
+	}
+	indexFlush.Unlock()
+	if !pending {
+		return
+	}
+
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("search index: %v", err)
+		return
+	}
+	if err := ix.Flush(); err != nil {
+		log.Printf("search index: %v", err)
+	}
+}
+
+// unindex drops emails that were deleted or moved out of folder. Moved emails
+// are indexed under their new folder when it is next synced.
+func unindex(accountID, folder string, uids []uint32) {
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("search index: %v", err)
+		return
+	}
+	ix.Remove(accountID, folder, uids)
+	if err := ix.Flush(); err != nil {
+		log.Printf("search index: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/fetcher"
+)
+
+func TestApplySync(t *testing.T) {
+	known := []config.CachedEmail{
+		{UID: 10, Subject: "ten"},
+		{UID: 9, Subject: "nine"},
+		{UID: 8, Subject: "eight", IsRead: true},
+	}
+
+	t.Run("delta", func(t *testing.T) {
+		res := &fetcher.SyncResult{
+			Emails:   []fetcher.Email{{UID: 12, Subject: "twelve"}, {UID: 11, Subject: "eleven"}},
+			Updates:  []fetcher.FlagUpdate{{UID: 9, IsRead: true, IsFlagged: true, Labels: []string{"todo"}}},
+			Vanished: []uint32{8},
+		}
+		got := applySync(known, res, 3)
+
+		var uids []uint32
+		for _, e := range got {
+			uids = append(uids, e.UID)
+		}
+		if !reflect.DeepEqual(uids, []uint32{12, 11, 10}) {
+			t.Fatalf("uids = %v, want [12 11 10]", uids)
+		}
+
+		got = applySync(known, res, syncWindow)
+		nine := got[3]
+		if nine.UID != 9 || !nine.IsRead || !nine.IsFlagged || !reflect.DeepEqual(nine.Labels, []string{"todo"}) {
+			t.Errorf("uid 9 after update = %+v", nine)
+		}
+		for _, e := range got {
+			if e.UID == 8 {
+				t.Error("expunged uid 8 still cached")
+			}
+		}
+	})
+
+	t.Run("full resync replaces cache", func(t *testing.T) {
+		res := &fetcher.SyncResult{
+			Full:   true,
+			Emails: []fetcher.Email{{UID: 1, Subject: "renumbered"}},
+		}
+		got := applySync(known, res, syncWindow)
+		if len(got) != 1 || got[0].UID != 1 || got[0].Subject != "renumbered" {
+			t.Errorf("got %+v, want only the renumbered email", got)
+		}
+	})
+}
+
+// windowProvider serves the newest emails of a folder whose messages the
+// test adds and expunges, and records the deletes rules make.
+type windowProvider struct {
+	backend.Provider
+	emails  []backend.Email // oldest first
+	deleted []uint32
+}
+
+func (p *windowProvider) FetchEmails(_ context.Context, _ string, limit, _ uint32) ([]backend.Email, error) {
+	var out []backend.Email
+	for i := len(p.emails) - 1; i >= 0 && len(out) < int(limit); i-- {
+		out = append(out, p.emails[i])
+	}
+	return out, nil
+}
+
+func (p *windowProvider) DeleteEmails(_ context.Context, _ string, uids []uint32) error {
+	p.deleted = append(p.deleted, uids...)
+	return nil
+}
+
+func (p *windowProvider) add(uid uint32) {
+	p.emails = append(p.emails, backend.Email{
+		UID:       uid,
+		From:      "alice@example.com",
+		Subject:   fmt.Sprintf("message %d", uid),
+		Date:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(uid) * time.Hour),
+		AccountID: "acc1",
+	})
+}
+
+func TestSyncNewMail_BackfillIsNotNewMail(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	acct := config.Account{ID: "acc1", Email: "me@example.com", Protocol: "maildir"}
+	d := New(&config.Config{
+		Accounts: []config.Account{acct},
+		Rules: []config.Rule{{
+			Name:    "delete alice",
+			Match:   config.RuleMatch{From: "alice"},
+			Actions: []config.RuleAction{{Type: "delete"}},
+		}},
+		DisableNotifications: true,
+	})
+	p := &windowProvider{}
+	for uid := uint32(1); uid <= syncWindow+1; uid++ {
+		p.add(uid)
+	}
+	d.providers[acct.ID] = p
+
+	// The first sync only learns what is there.
+	if _, arrived, err := d.syncNewMail(context.Background(), &acct, "INBOX"); err != nil || len(arrived) != 0 {
+		t.Fatalf("first sync: arrived %d, err %v; want nothing", len(arrived), err)
+	}
+
+	// Another client expunges the newest message, so the oldest one is
+	// fetched into the window.
+	p.emails = p.emails[:len(p.emails)-1]
+	cached, arrived, err := d.syncNewMail(context.Background(), &acct, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != syncWindow || cached[len(cached)-1].UID != 1 {
+		t.Fatalf("cache after expunge does not reach back to UID 1: %d emails", len(cached))
+	}
+	if len(arrived) != 0 || len(p.deleted) != 0 {
+		t.Fatalf("backfilled mail treated as new: arrived %d, deleted %v", len(arrived), p.deleted)
+	}
+
+	// Mail that does arrive is still filed.
+	p.add(syncWindow + 2)
+	if _, arrived, err := d.syncNewMail(context.Background(), &acct, "INBOX"); err != nil || len(arrived) != 1 {
+		t.Fatalf("new mail: arrived %d, err %v; want 1", len(arrived), err)
+	}
+	if !reflect.DeepEqual(p.deleted, []uint32{syncWindow + 2}) {
+		t.Errorf("deleted %v, want only the new message", p.deleted)
+	}
+}
+
+func TestArrivedSince(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	imapState := config.FolderSyncState{UIDValidity: 7, UIDNext: 20}
+	otherState := config.FolderSyncState{Synced: true, Newest: at}
+	tests := []struct {
+		name  string
+		state config.FolderSyncState
+		email config.CachedEmail
+		want  bool
+	}{
+		{"imap uid at uidnext", imapState, config.CachedEmail{UID: 20}, true},
+		{"imap backfilled uid", imapState, config.CachedEmail{UID: 3, Date: at.Add(time.Hour)}, false},
+		{"newer than mark", otherState, config.CachedEmail{UID: 1, Date: at.Add(time.Minute)}, true},
+		{"older than mark", otherState, config.CachedEmail{UID: 99, Date: at.Add(-time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		if got := arrivedSince(tt.state, tt.email); got != tt.want {
+			t.Errorf("%s: arrivedSince = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package daemonclient
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/google/uuid"
+)
+
+// journalRetryInterval is how often queued actions are replayed while any
+// are pending.
+const journalRetryInterval = 30 * time.Second
+
+// JournalOp is the kind of action recorded in the offline journal.
+type JournalOp string
+
+const (
+	JournalDelete   JournalOp = "delete"
+	JournalArchive  JournalOp = "archive"
+	JournalMove     JournalOp = "move"
+	JournalMarkRead JournalOp = "mark_read"
+)
+
+// JournalEntry is an action taken while the account's server was
+// unreachable. It has already been applied to the folder cache and is
+// replayed to the server once it can be reached again.
+type JournalEntry struct {
+	ID         string    `json:"id"`
+	Op         JournalOp `json:"op"`
+	AccountID  string    `json:"account_id"`
+	Folder     string    `json:"folder"`
+	DestFolder string    `json:"dest_folder,omitempty"`
+	UIDs       []uint32  `json:"uids"`
+	Read       bool      `json:"read,omitempty"`
+	QueuedAt   time.Time `json:"queued_at"`
+}
+
+// journal queues actions that failed because the server was unreachable and
+// replays them in order. Actions for an account with pending entries are
+// queued behind them so the server sees them in the order they were taken.
+type journal struct {
+	// mu guards entries and accounts. It is never held while talking to
+	// the server.
+	mu      sync.Mutex
+	entries []JournalEntry
+	// accounts serialises the sends of each account, so a new action cannot
+	// overtake a replay of the ones queued before it.
+	accounts map[string]*sync.Mutex
+	// send performs an entry against the server.
+	send func(JournalEntry) error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newJournal loads the persisted journal and starts replaying it in the
+// background.
+func newJournal(send func(JournalEntry) error) *journal {
+	entries, err := loadJournalEntries()
+	if err != nil {
+		log.Printf("journal: load failed: %v", err)
+	}
+	j := &journal{
+		entries: entries,
+		send:    send,
+		stop:    make(chan struct{}),
+	}
+	go j.loop()
+	return j
+}
+
+func (j *journal) loop() {
+	ticker := time.NewTicker(journalRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.replay()
+		}
+	}
+}
+
+func (j *journal) close() {
+	j.stopOnce.Do(func() { close(j.stop) })
+}
+
+// do performs an action, journaling it instead when the server cannot be
+// reached. A journaled action counts as done: it is applied to the folder
+// cache straight away and nil is returned.
+func (j *journal) do(e JournalEntry) error {
+	unlock := j.lockAccount(e.AccountID)
+	defer unlock()
+
+	if j.pending(e.AccountID) {
+		j.replayAccount(e.AccountID)
+	}
+	if !j.pending(e.AccountID) {
+		err := j.send(e)
+		if !isOffline(err) || mayHaveApplied(e, err) {
+			return err
+		}
+	}
+
+	e.ID = uuid.New().String()
+	e.QueuedAt = time.Now()
+	j.mu.Lock()
+	j.entries = append(j.entries, e)
+	j.saveLocked()
+	j.mu.Unlock()
+	if err := applyJournalEntry(e); err != nil {
+		log.Printf("journal: cache update for %s failed: %v", e.Folder, err)
+	}
+	return nil
+}
+
+// lockAccount takes the send lock of an account and returns its release.
+func (j *journal) lockAccount(accountID string) func() {
+	j.mu.Lock()
+	if j.accounts == nil {
+		j.accounts = make(map[string]*sync.Mutex)
+	}
+	l, ok := j.accounts[accountID]
+	if !ok {
+		l = &sync.Mutex{}
+		j.accounts[accountID] = l
+	}
+	j.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// pending reports whether the account has queued actions.
+func (j *journal) pending(accountID string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.AccountID == accountID {
+			return true
+		}
+	}
+	return false
+}
+
+// replay sends the queued actions of every account.
+func (j *journal) replay() {
+	j.mu.Lock()
+	var accounts []string
+	seen := make(map[string]bool)
+	for _, e := range j.entries {
+		if !seen[e.AccountID] {
+			seen[e.AccountID] = true
+			accounts = append(accounts, e.AccountID)
+		}
+	}
+	j.mu.Unlock()
+
+	for _, id := range accounts {
+		unlock := j.lockAccount(id)
+		j.replayAccount(id)
+		unlock()
+	}
+}
+
+// replayAccount sends an account's queued actions in order, with the
+// account's send lock held. Once the server turns out to be unreachable,
+// the remaining entries are kept for the next round.
+func (j *journal) replayAccount(accountID string) {
+	j.mu.Lock()
+	var queued []JournalEntry
+	for _, e := range j.entries {
+		if e.AccountID == accountID {
+			queued = append(queued, e)
+		}
+	}
+	j.mu.Unlock()
+
+	// done holds the entries to remove; an entry mapped to a non-empty
+	// one is replaced by it instead.
+	done := make(map[string]JournalEntry)
+	for _, e := range queued {
+		err := j.send(e)
+		if err == nil {
+			done[e.ID] = JournalEntry{}
+			continue
+		}
+		if isOffline(err) {
+			if mayHaveApplied(e, err) {
+				log.Printf("journal: dropping %s of %v in %s, which timed out and may have been applied: %v", e.Op, e.UIDs, e.Folder, err)
+				done[e.ID] = JournalEntry{}
+			}
+			break
+		}
+		rest, ok := j.resolveConflict(e, err)
+		done[e.ID] = rest
+		if ok {
+			break
+		}
+	}
+	if len(done) == 0 {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	kept := j.entries[:0]
+	for _, e := range j.entries {
+		rest, ok := done[e.ID]
+		switch {
+		case !ok:
+			kept = append(kept, e)
+		case len(rest.UIDs) > 0:
+			kept = append(kept, rest)
+		}
+	}
+	j.entries = kept
+	j.saveLocked()
+}
+
+// saveLocked persists the journal. j.mu must be held.
+func (j *journal) saveLocked() {
+	if err := saveJournalEntries(j.entries); err != nil {
+		log.Printf("journal: save failed: %v", err)
+	}
+}
+
+// resolveConflict handles an entry the server rejected, typically because a
+// message was expunged or moved by another client in the meantime. A batch
+// is rejected as a whole, so the messages are retried one by one and the
+// ones that still fail are dropped. It returns the messages that could not
+// be tried because the server went away again.
+func (j *journal) resolveConflict(e JournalEntry, err error) (JournalEntry, bool) {
+	if len(e.UIDs) <= 1 {
+		log.Printf("journal: dropping %s of %v in %s: %v", e.Op, e.UIDs, e.Folder, err)
+		return JournalEntry{}, false
+	}
+
+	var retry []uint32
+	for i, uid := range e.UIDs {
+		single := e
+		single.UIDs = []uint32{uid}
+		err := j.send(single)
+		switch {
+		case err == nil:
+		case isOffline(err):
+			if mayHaveApplied(single, err) {
+				log.Printf("journal: dropping %s of %d in %s, which timed out and may have been applied: %v", e.Op, uid, e.Folder, err)
+			} else {
+				retry = append(retry, uid)
+			}
+			retry = append(retry, e.UIDs[i+1:]...)
+			if len(retry) == 0 {
+				return JournalEntry{}, false
+			}
+			e.UIDs = retry
+			return e, true
+		default:
+			log.Printf("journal: dropping %s of %d in %s: %v", e.Op, uid, e.Folder, err)
+		}
+	}
+	return JournalEntry{}, false
+}
+
+// isOffline reports whether err means the server could not be reached,
+// either directly or as reported by the daemon. Timeouts count, but see
+// mayHaveApplied.
+func isOffline(err error) bool {
+	var rpcErr *daemonrpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == daemonrpc.ErrCodeOffline || rpcErr.Code == daemonrpc.ErrCodeTimeout
+	}
+	return backend.IsNetworkError(err)
+}
+
+// mayHaveApplied reports whether e failed in a way that leaves open whether
+// the server applied it: it timed out after the request went out. Replaying
+// such an entry is only safe when doing it twice does no harm, as for
+// marking messages read; a second move or delete could hit other messages
+// or fail the whole batch.
+func mayHaveApplied(e JournalEntry, err error) bool {
+	if e.Op == JournalMarkRead {
+		return false
+	}
+	var rpcErr *daemonrpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == daemonrpc.ErrCodeTimeout
+	}
+	return backend.IsTimeout(err)
+}
+
+// applyJournalEntry applies a queued action to the folder's email cache so
+// it shows up as done before the server has seen it.
+func applyJournalEntry(e JournalEntry) error {
+	emails, err := config.LoadFolderEmailCache(e.Folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	uids := make(map[uint32]bool, len(e.UIDs))
+	for _, uid := range e.UIDs {
+		uids[uid] = true
+	}
+	out := emails[:0]
+	for _, email := range emails {
+		if email.AccountID == e.AccountID && uids[email.UID] {
+			if e.Op != JournalMarkRead {
+				continue
+			}
+			email.IsRead = e.Read
+		}
+		out = append(out, email)
+	}
+	return config.SaveFolderEmailCache(e.Folder, out)
+}
+
+// journalFile returns the full path to the persisted journal.
+func journalFile() (string, error) {
+	dir, err := config.GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "journal.json"), nil
+}
+
+// loadJournalEntries reads the persisted journal. A missing file yields no
+// entries.
+func loadJournalEntries() ([]JournalEntry, error) {
+	path, err := journalFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := config.SecureReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []JournalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// saveJournalEntries writes the journal to disk, encrypting it when secure
+// mode is enabled.
+func saveJournalEntries(entries []JournalEntry) error {
+	path, err := journalFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return config.SecureWriteFile(path, data, 0600)
+}
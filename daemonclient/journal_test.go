@@ -0,0 +1,167 @@
+package daemonclient
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/daemonrpc"
+)
+
+var errUnreachable = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+// testJournal returns a journal whose sends go to send, without the
+// background replay loop.
+func testJournal(t *testing.T, send func(JournalEntry) error) *journal {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return &journal{send: send, stop: make(chan struct{})}
+}
+
+func TestJournal_QueuesWhileOfflineAndReplaysInOrder(t *testing.T) {
+	online := false
+	var sent []JournalEntry
+	j := testJournal(t, func(e JournalEntry) error {
+		if !online {
+			return errUnreachable
+		}
+		sent = append(sent, e)
+		return nil
+	})
+
+	folder := "journal-offline"
+	if err := config.SaveFolderEmailCache(folder, []config.CachedEmail{
+		{UID: 1, AccountID: "acc1"},
+		{UID: 2, AccountID: "acc1"},
+		{UID: 2, AccountID: "acc2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.do(JournalEntry{Op: JournalMarkRead, AccountID: "acc1", Folder: folder, UIDs: []uint32{1}, Read: true}); err != nil {
+		t.Fatalf("MarkRead while offline: %v", err)
+	}
+	if err := j.do(JournalEntry{Op: JournalDelete, AccountID: "acc1", Folder: folder, UIDs: []uint32{2}}); err != nil {
+		t.Fatalf("Delete while offline: %v", err)
+	}
+
+	cached, err := config.LoadFolderEmailCache(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []config.CachedEmail{
+		{UID: 1, AccountID: "acc1", IsRead: true},
+		{UID: 2, AccountID: "acc2"},
+	}
+	if !reflect.DeepEqual(cached, want) {
+		t.Errorf("cache after offline actions = %+v, want %+v", cached, want)
+	}
+
+	// The journal survives a restart.
+	entries, err := loadJournalEntries()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("persisted entries = %d (%v), want 2", len(entries), err)
+	}
+
+	online = true
+	j.replay()
+	if len(j.entries) != 0 {
+		t.Errorf("%d entries left after replay", len(j.entries))
+	}
+	if len(sent) != 2 || sent[0].Op != JournalMarkRead || sent[1].Op != JournalDelete {
+		t.Errorf("replayed %+v, want mark_read then delete", sent)
+	}
+}
+
+func TestJournal_QueuesBehindPendingEntries(t *testing.T) {
+	calls := 0
+	j := testJournal(t, func(e JournalEntry) error {
+		calls++
+		return &daemonrpc.Error{Code: daemonrpc.ErrCodeOffline, Message: "unreachable"}
+	})
+
+	j.do(JournalEntry{Op: JournalArchive, AccountID: "acc1", Folder: "journal-pending", UIDs: []uint32{1}}) //nolint:errcheck
+	calls = 0
+	j.do(JournalEntry{Op: JournalArchive, AccountID: "acc1", Folder: "journal-pending", UIDs: []uint32{2}}) //nolint:errcheck
+
+	// Only the pending entry is retried; the new one is not sent ahead of it.
+	if calls != 1 {
+		t.Errorf("sends = %d, want 1", calls)
+	}
+	if len(j.entries) != 2 {
+		t.Errorf("entries = %d, want 2", len(j.entries))
+	}
+}
+
+func TestJournal_DropsMessagesThatNoLongerExist(t *testing.T) {
+	gone := errors.New("no such message")
+	var sent [][]uint32
+	j := testJournal(t, func(e JournalEntry) error {
+		if len(e.UIDs) > 1 {
+			return gone
+		}
+		if e.UIDs[0] == 2 {
+			return gone
+		}
+		sent = append(sent, e.UIDs)
+		return nil
+	})
+	j.entries = []JournalEntry{{Op: JournalMove, AccountID: "acc1", Folder: "INBOX", DestFolder: "Archive", UIDs: []uint32{1, 2, 3}}}
+
+	j.replay()
+
+	if len(j.entries) != 0 {
+		t.Errorf("entries = %+v, want none", j.entries)
+	}
+	if !reflect.DeepEqual(sent, [][]uint32{{1}, {3}}) {
+		t.Errorf("moved %v, want [[1] [3]]", sent)
+	}
+}
+
+func TestJournal_ReturnsRejections(t *testing.T) {
+	rejected := errors.New("permission denied")
+	j := testJournal(t, func(JournalEntry) error { return rejected })
+
+	err := j.do(JournalEntry{Op: JournalDelete, AccountID: "acc1", Folder: "INBOX", UIDs: []uint32{1}})
+	if !errors.Is(err, rejected) {
+		t.Errorf("err = %v, want %v", err, rejected)
+	}
+	if len(j.entries) != 0 {
+		t.Errorf("rejected action was journaled")
+	}
+}
+
+func TestJournal_TimeoutsAreNotReplayedForMoves(t *testing.T) {
+	timedOut := &daemonrpc.Error{Code: daemonrpc.ErrCodeTimeout, Message: "i/o timeout"}
+	var sent []JournalOp
+	j := testJournal(t, func(e JournalEntry) error {
+		sent = append(sent, e.Op)
+		return timedOut
+	})
+
+	// A move that timed out may have happened, so it is reported rather
+	// than queued; marking read is safe to repeat and is queued.
+	if err := j.do(JournalEntry{Op: JournalMove, AccountID: "acc1", Folder: "INBOX", DestFolder: "Archive", UIDs: []uint32{1}}); !errors.Is(err, timedOut) {
+		t.Errorf("move err = %v, want %v", err, timedOut)
+	}
+	if err := j.do(JournalEntry{Op: JournalMarkRead, AccountID: "acc1", Folder: "INBOX", UIDs: []uint32{2}, Read: true}); err != nil {
+		t.Errorf("mark read err = %v, want it queued", err)
+	}
+	if len(j.entries) != 1 || j.entries[0].Op != JournalMarkRead {
+		t.Fatalf("entries = %+v, want only the mark_read", j.entries)
+	}
+
+	// A queued delete that times out on replay is dropped, not retried.
+	j.entries = []JournalEntry{{ID: "1", Op: JournalDelete, AccountID: "acc2", Folder: "INBOX", UIDs: []uint32{3}}}
+	sent = nil
+	j.replay()
+	if len(j.entries) != 0 {
+		t.Errorf("entries after replay = %+v, want none", j.entries)
+	}
+	if len(sent) != 1 {
+		t.Errorf("sends = %v, want one", sent)
+	}
+}
@@ -11,10 +11,12 @@ import (
 	"github.com/floatpane/matcha/backend"
 	_ "github.com/floatpane/matcha/backend/jmap"    // register jmap backend for directService
 	_ "github.com/floatpane/matcha/backend/maildir" // register maildir backend for directService
+	_ "github.com/floatpane/matcha/backend/mbox"    // register mbox backend for directService
 	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/daemonrpc"
 	"github.com/floatpane/matcha/fetcher"
 	"github.com/floatpane/matcha/internal/loglevel"
+	"github.com/floatpane/matcha/searchindex"
 	"github.com/floatpane/matcha/sender"
 )
 
@@ -30,9 +32,23 @@ type Service interface {
 	MoveEmails(accountID string, uids []uint32, src, dst string) error
 	MarkRead(accountID, folder string, uids []uint32) error
 	MarkUnread(accountID, folder string, uids []uint32) error
-	QueueEmail(accountID string, to, cc, bcc []string, subject, body, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, signSMIME, encryptSMIME, signPGP, encryptPGP bool, delaySeconds int) (string, error)
+	MarkFlagged(accountID, folder string, uids []uint32) error
+	MarkUnflagged(accountID, folder string, uids []uint32) error
+	AddLabel(accountID, folder string, uids []uint32, label string) error
+	RemoveLabel(accountID, folder string, uids []uint32, label string) error
+	QueueEmail(accountID string, to, cc, bcc []string, subject, body, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, headers map[string]string, signSMIME, encryptSMIME, signPGP, encryptPGP bool, delaySeconds int) (string, error)
 	CancelEmail(jobID string) error
+	// ListOutbox returns queued sends, including ones that failed and are
+	// waiting for a retry.
+	ListOutbox() ([]daemonrpc.OutboxEntryInfo, error)
+	RetryOutbox(jobID string) error
 	FetchFolders(accountID string) ([]backend.Folder, error)
+	CreateFolder(accountID, folder string) error
+	RenameFolder(accountID, folder, newName string) error
+	DeleteFolder(accountID, folder string) error
+	// SetFolderSubscribed toggles the server-side subscription of a folder.
+	// Unlike Subscribe, it does not affect which folders push events.
+	SetFolderSubscribed(accountID, folder string, subscribed bool) error
 	RefreshFolder(accountID, folder string) error
 	Subscribe(accountID, folder string) error
 	Unsubscribe(accountID, folder string) error
@@ -84,7 +100,9 @@ func tryConnect() *daemonService {
 		client.Close() //nolint:errcheck,gosec
 		return nil
 	}
-	return &daemonService{client: client}
+	s := &daemonService{client: client}
+	s.journal = newJournal(s.sendJournaled)
+	return s
 }
 
 func autoStartDaemon() error {
@@ -104,7 +122,8 @@ func autoStartDaemon() error {
 
 // daemonService routes all operations through the daemon socket.
 type daemonService struct {
-	client *Client
+	client  *Client
+	journal *journal
 }
 
 func (s *daemonService) FetchEmails(accountID, folder string, limit, offset uint32) ([]backend.Email, error) {
@@ -142,49 +161,97 @@ func (s *daemonService) FetchEmailBody(accountID, folder string, uid uint32) (st
 }
 
 func (s *daemonService) DeleteEmails(accountID, folder string, uids []uint32) error {
-	return s.client.Call(daemonrpc.MethodDeleteEmails, daemonrpc.DeleteEmailsParams{
-		AccountID: accountID,
-		Folder:    folder,
-		UIDs:      uids,
-	}, nil)
+	return s.journal.do(JournalEntry{Op: JournalDelete, AccountID: accountID, Folder: folder, UIDs: uids})
 }
 
 func (s *daemonService) ArchiveEmails(accountID, folder string, uids []uint32) error {
-	return s.client.Call(daemonrpc.MethodArchiveEmails, daemonrpc.ArchiveEmailsParams{
+	return s.journal.do(JournalEntry{Op: JournalArchive, AccountID: accountID, Folder: folder, UIDs: uids})
+}
+
+func (s *daemonService) MoveEmails(accountID string, uids []uint32, src, dst string) error {
+	return s.journal.do(JournalEntry{Op: JournalMove, AccountID: accountID, Folder: src, DestFolder: dst, UIDs: uids})
+}
+
+func (s *daemonService) MarkRead(accountID, folder string, uids []uint32) error {
+	return s.journal.do(JournalEntry{Op: JournalMarkRead, AccountID: accountID, Folder: folder, UIDs: uids, Read: true})
+}
+
+func (s *daemonService) MarkUnread(accountID, folder string, uids []uint32) error {
+	return s.journal.do(JournalEntry{Op: JournalMarkRead, AccountID: accountID, Folder: folder, UIDs: uids, Read: false})
+}
+
+// sendJournaled performs a journaled action through the daemon.
+func (s *daemonService) sendJournaled(e JournalEntry) error {
+	switch e.Op {
+	case JournalDelete:
+		return s.client.Call(daemonrpc.MethodDeleteEmails, daemonrpc.DeleteEmailsParams{
+			AccountID: e.AccountID,
+			Folder:    e.Folder,
+			UIDs:      e.UIDs,
+		}, nil)
+	case JournalArchive:
+		return s.client.Call(daemonrpc.MethodArchiveEmails, daemonrpc.ArchiveEmailsParams{
+			AccountID: e.AccountID,
+			Folder:    e.Folder,
+			UIDs:      e.UIDs,
+		}, nil)
+	case JournalMove:
+		return s.client.Call(daemonrpc.MethodMoveEmails, daemonrpc.MoveEmailsParams{
+			AccountID:    e.AccountID,
+			UIDs:         e.UIDs,
+			SourceFolder: e.Folder,
+			DestFolder:   e.DestFolder,
+		}, nil)
+	case JournalMarkRead:
+		return s.client.Call(daemonrpc.MethodMarkRead, daemonrpc.MarkReadParams{
+			AccountID: e.AccountID,
+			Folder:    e.Folder,
+			UIDs:      e.UIDs,
+			Read:      e.Read,
+		}, nil)
+	}
+	return fmt.Errorf("unknown journal op %q", e.Op)
+}
+
+func (s *daemonService) MarkFlagged(accountID, folder string, uids []uint32) error {
+	return s.client.Call(daemonrpc.MethodMarkFlagged, daemonrpc.MarkFlaggedParams{
 		AccountID: accountID,
 		Folder:    folder,
 		UIDs:      uids,
+		Flagged:   true,
 	}, nil)
 }
 
-func (s *daemonService) MoveEmails(accountID string, uids []uint32, src, dst string) error {
-	return s.client.Call(daemonrpc.MethodMoveEmails, daemonrpc.MoveEmailsParams{
-		AccountID:    accountID,
-		UIDs:         uids,
-		SourceFolder: src,
-		DestFolder:   dst,
+func (s *daemonService) MarkUnflagged(accountID, folder string, uids []uint32) error {
+	return s.client.Call(daemonrpc.MethodMarkFlagged, daemonrpc.MarkFlaggedParams{
+		AccountID: accountID,
+		Folder:    folder,
+		UIDs:      uids,
+		Flagged:   false,
 	}, nil)
 }
 
-func (s *daemonService) MarkRead(accountID, folder string, uids []uint32) error {
-	return s.client.Call(daemonrpc.MethodMarkRead, daemonrpc.MarkReadParams{
+func (s *daemonService) AddLabel(accountID, folder string, uids []uint32, label string) error {
+	return s.client.Call(daemonrpc.MethodSetLabel, daemonrpc.SetLabelParams{
 		AccountID: accountID,
 		Folder:    folder,
 		UIDs:      uids,
-		Read:      true,
+		Label:     label,
+		Add:       true,
 	}, nil)
 }
 
-func (s *daemonService) MarkUnread(accountID, folder string, uids []uint32) error {
-	return s.client.Call(daemonrpc.MethodMarkRead, daemonrpc.MarkReadParams{
+func (s *daemonService) RemoveLabel(accountID, folder string, uids []uint32, label string) error {
+	return s.client.Call(daemonrpc.MethodSetLabel, daemonrpc.SetLabelParams{
 		AccountID: accountID,
 		Folder:    folder,
 		UIDs:      uids,
-		Read:      false,
+		Label:     label,
+		Add:       false,
 	}, nil)
 }
 
-func (s *daemonService) QueueEmail(accountID string, to, cc, bcc []string, subject, body, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, signSMIME, encryptSMIME, signPGP, encryptPGP bool, delaySeconds int) (string, error) {
+func (s *daemonService) QueueEmail(accountID string, to, cc, bcc []string, subject, body, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, headers map[string]string, signSMIME, encryptSMIME, signPGP, encryptPGP bool, delaySeconds int) (string, error) {
 	var result daemonrpc.QueueEmailResult
 	err := s.client.Call(daemonrpc.MethodQueueEmail, daemonrpc.QueueEmailParams{
 		Email: daemonrpc.SendEmailParams{
@@ -199,6 +266,7 @@ func (s *daemonService) QueueEmail(accountID string, to, cc, bcc []string, subje
 			Attachments:  attachments,
 			InReplyTo:    inReplyTo,
 			References:   references,
+			Headers:      headers,
 			SignSMIME:    signSMIME,
 			EncryptSMIME: encryptSMIME,
 			SignPGP:      signPGP,
@@ -215,6 +283,18 @@ func (s *daemonService) CancelEmail(jobID string) error {
 	}, nil)
 }
 
+func (s *daemonService) ListOutbox() ([]daemonrpc.OutboxEntryInfo, error) {
+	var entries []daemonrpc.OutboxEntryInfo
+	err := s.client.Call(daemonrpc.MethodListOutbox, nil, &entries)
+	return entries, err
+}
+
+func (s *daemonService) RetryOutbox(jobID string) error {
+	return s.client.Call(daemonrpc.MethodRetryOutbox, daemonrpc.RetryOutboxParams{
+		JobID: jobID,
+	}, nil)
+}
+
 func (s *daemonService) FetchFolders(accountID string) ([]backend.Folder, error) {
 	var folders []backend.Folder
 	err := s.client.Call(daemonrpc.MethodFetchFolders, daemonrpc.FetchFoldersParams{
@@ -223,6 +303,36 @@ func (s *daemonService) FetchFolders(accountID string) ([]backend.Folder, error)
 	return folders, err
 }
 
+func (s *daemonService) CreateFolder(accountID, folder string) error {
+	return s.client.Call(daemonrpc.MethodCreateFolder, daemonrpc.CreateFolderParams{
+		AccountID: accountID,
+		Folder:    folder,
+	}, nil)
+}
+
+func (s *daemonService) RenameFolder(accountID, folder, newName string) error {
+	return s.client.Call(daemonrpc.MethodRenameFolder, daemonrpc.RenameFolderParams{
+		AccountID: accountID,
+		Folder:    folder,
+		NewName:   newName,
+	}, nil)
+}
+
+func (s *daemonService) DeleteFolder(accountID, folder string) error {
+	return s.client.Call(daemonrpc.MethodDeleteFolder, daemonrpc.DeleteFolderParams{
+		AccountID: accountID,
+		Folder:    folder,
+	}, nil)
+}
+
+func (s *daemonService) SetFolderSubscribed(accountID, folder string, subscribed bool) error {
+	return s.client.Call(daemonrpc.MethodSetSubscribed, daemonrpc.SetSubscribedParams{
+		AccountID:  accountID,
+		Folder:     folder,
+		Subscribed: subscribed,
+	}, nil)
+}
+
 func (s *daemonService) RefreshFolder(accountID, folder string) error {
 	return s.client.Call(daemonrpc.MethodRefreshFolder, daemonrpc.RefreshFolderParams{
 		AccountID: accountID,
@@ -255,6 +365,7 @@ func (s *daemonService) Events() <-chan *daemonrpc.Event {
 func (s *daemonService) IsDaemon() bool { return true }
 
 func (s *daemonService) Close() error {
+	s.journal.close()
 	return s.client.Close()
 }
 
@@ -264,6 +375,7 @@ type directService struct {
 	cfg       *config.Config
 	providers map[string]backend.Provider
 	events    chan *daemonrpc.Event
+	journal   *journal
 }
 
 func newDirectService(cfg *config.Config) *directService {
@@ -273,6 +385,7 @@ func newDirectService(cfg *config.Config) *directService {
 		events:    make(chan *daemonrpc.Event, 64),
 	}
 	s.initProviders()
+	s.journal = newJournal(s.sendJournaled)
 	return s
 }
 
@@ -316,49 +429,113 @@ func (s *directService) FetchEmailBody(accountID, folder string, uid uint32) (st
 }
 
 func (s *directService) DeleteEmails(accountID, folder string, uids []uint32) error {
-	p, err := s.getProvider(accountID)
+	return s.journal.do(JournalEntry{Op: JournalDelete, AccountID: accountID, Folder: folder, UIDs: uids})
+}
+
+func (s *directService) ArchiveEmails(accountID, folder string, uids []uint32) error {
+	return s.journal.do(JournalEntry{Op: JournalArchive, AccountID: accountID, Folder: folder, UIDs: uids})
+}
+
+func (s *directService) MoveEmails(accountID string, uids []uint32, src, dst string) error {
+	return s.journal.do(JournalEntry{Op: JournalMove, AccountID: accountID, Folder: src, DestFolder: dst, UIDs: uids})
+}
+
+func (s *directService) MarkRead(accountID, folder string, uids []uint32) error {
+	return s.journal.do(JournalEntry{Op: JournalMarkRead, AccountID: accountID, Folder: folder, UIDs: uids, Read: true})
+}
+
+func (s *directService) MarkUnread(accountID, folder string, uids []uint32) error {
+	return s.journal.do(JournalEntry{Op: JournalMarkRead, AccountID: accountID, Folder: folder, UIDs: uids, Read: false})
+}
+
+// sendJournaled performs a journaled action against the account's provider.
+func (s *directService) sendJournaled(e JournalEntry) error {
+	p, err := s.getProvider(e.AccountID)
 	if err != nil {
 		return err
 	}
-	return p.DeleteEmails(context.Background(), folder, uids)
+	ctx := context.Background()
+	switch e.Op {
+	case JournalDelete:
+		err = p.DeleteEmails(ctx, e.Folder, e.UIDs)
+	case JournalArchive:
+		err = p.ArchiveEmails(ctx, e.Folder, e.UIDs)
+	case JournalMove:
+		err = p.MoveEmails(ctx, e.UIDs, e.Folder, e.DestFolder)
+	case JournalMarkRead:
+		for _, uid := range e.UIDs {
+			if e.Read {
+				err = p.MarkAsRead(ctx, e.Folder, uid)
+			} else {
+				err = p.MarkAsUnread(ctx, e.Folder, uid)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown journal op %q", e.Op)
+	}
+	if err != nil {
+		return err
+	}
+	// Without a daemon the TUI maintains the search index.
+	if ix, err := searchindex.Open(); err == nil {
+		ix.Remove(e.AccountID, e.Folder, e.UIDs)
+		if err := ix.Flush(); err != nil {
+			log.Printf("direct service: search index: %v", err)
+		}
+	}
+	return nil
 }
 
-func (s *directService) ArchiveEmails(accountID, folder string, uids []uint32) error {
+func (s *directService) MarkFlagged(accountID, folder string, uids []uint32) error {
 	p, err := s.getProvider(accountID)
 	if err != nil {
 		return err
 	}
-	return p.ArchiveEmails(context.Background(), folder, uids)
+	for _, uid := range uids {
+		if err := p.MarkFlagged(context.Background(), folder, uid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *directService) MoveEmails(accountID string, uids []uint32, src, dst string) error {
+func (s *directService) MarkUnflagged(accountID, folder string, uids []uint32) error {
 	p, err := s.getProvider(accountID)
 	if err != nil {
 		return err
 	}
-	return p.MoveEmails(context.Background(), uids, src, dst)
+	for _, uid := range uids {
+		if err := p.MarkUnflagged(context.Background(), folder, uid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *directService) MarkRead(accountID, folder string, uids []uint32) error {
+func (s *directService) AddLabel(accountID, folder string, uids []uint32, label string) error {
 	p, err := s.getProvider(accountID)
 	if err != nil {
 		return err
 	}
 	for _, uid := range uids {
-		if err := p.MarkAsRead(context.Background(), folder, uid); err != nil {
+		if err := p.AddLabel(context.Background(), folder, uid, label); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *directService) MarkUnread(accountID, folder string, uids []uint32) error {
+func (s *directService) RemoveLabel(accountID, folder string, uids []uint32, label string) error {
 	p, err := s.getProvider(accountID)
 	if err != nil {
 		return err
 	}
 	for _, uid := range uids {
-		if err := p.MarkAsUnread(context.Background(), folder, uid); err != nil {
+		if err := p.RemoveLabel(context.Background(), folder, uid, label); err != nil {
 			return err
 		}
 	}
@@ -373,6 +550,41 @@ func (s *directService) FetchFolders(accountID string) ([]backend.Folder, error)
 	return p.FetchFolders(context.Background())
 }
 
+func (s *directService) CreateFolder(accountID, folder string) error {
+	p, err := s.getProvider(accountID)
+	if err != nil {
+		return err
+	}
+	return p.CreateFolder(context.Background(), folder)
+}
+
+func (s *directService) RenameFolder(accountID, folder, newName string) error {
+	p, err := s.getProvider(accountID)
+	if err != nil {
+		return err
+	}
+	return p.RenameFolder(context.Background(), folder, newName)
+}
+
+func (s *directService) DeleteFolder(accountID, folder string) error {
+	p, err := s.getProvider(accountID)
+	if err != nil {
+		return err
+	}
+	return p.DeleteFolder(context.Background(), folder)
+}
+
+func (s *directService) SetFolderSubscribed(accountID, folder string, subscribed bool) error {
+	p, err := s.getProvider(accountID)
+	if err != nil {
+		return err
+	}
+	if subscribed {
+		return p.SubscribeFolder(context.Background(), folder)
+	}
+	return p.UnsubscribeFolder(context.Background(), folder)
+}
+
 func (s *directService) RefreshFolder(_, _ string) error {
 	// In direct mode, caller handles refresh via their own fetcher calls.
 	return nil
@@ -404,6 +616,7 @@ func (s *directService) Events() <-chan *daemonrpc.Event {
 func (s *directService) IsDaemon() bool { return false }
 
 func (s *directService) Close() error {
+	s.journal.close()
 	for _, p := range s.providers {
 		p.Close() //nolint:errcheck,gosec
 	}
@@ -411,13 +624,13 @@ func (s *directService) Close() error {
 	return nil
 }
 
-func (s *directService) QueueEmail(accountID string, to, cc, bcc []string, subject, body, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, signSMIME, encryptSMIME, signPGP, encryptPGP bool, _ int) (string, error) {
+func (s *directService) QueueEmail(accountID string, to, cc, bcc []string, subject, body, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, headers map[string]string, signSMIME, encryptSMIME, signPGP, encryptPGP bool, _ int) (string, error) {
 	acct := s.cfg.GetAccountByID(accountID)
 	if acct == nil {
 		return "", fmt.Errorf("no account for %s", accountID)
 	}
 
-	rawMsg, err := sender.SendEmail(
+	rawMsg, err := sender.SendEmailWithHeaders(
 		acct,
 		to,
 		cc,
@@ -429,6 +642,7 @@ func (s *directService) QueueEmail(accountID string, to, cc, bcc []string, subje
 		attachments,
 		inReplyTo,
 		references,
+		headers,
 		signSMIME,
 		encryptSMIME,
 		signPGP,
@@ -450,3 +664,12 @@ func (s *directService) QueueEmail(accountID string, to, cc, bcc []string, subje
 func (s *directService) CancelEmail(_ string) error {
 	return nil
 }
+
+// ListOutbox returns nothing in direct mode: QueueEmail sends immediately.
+func (s *directService) ListOutbox() ([]daemonrpc.OutboxEntryInfo, error) {
+	return nil, nil
+}
+
+func (s *directService) RetryOutbox(jobID string) error {
+	return fmt.Errorf("job %s not found", jobID)
+}
@@ -1,6 +1,10 @@
 package daemonrpc
 
-import udsrpc "github.com/floatpane/go-uds-jsonrpc"
+import (
+	"time"
+
+	udsrpc "github.com/floatpane/go-uds-jsonrpc"
+)
 
 // Wire-level message types and the discriminating decoder live in the shared
 // go-uds-jsonrpc library. They are aliased here so matcha code keeps using the
@@ -25,6 +29,12 @@ const (
 	ErrCodeInvalidParams = udsrpc.ErrCodeInvalidParams
 	ErrCodeNotFound      = udsrpc.ErrCodeNotFound
 	ErrCodeInternal      = udsrpc.ErrCodeInternal
+	// ErrCodeOffline means the account's server could not be reached, so
+	// the client may queue the request and retry it later.
+	ErrCodeOffline = -32001
+	// ErrCodeTimeout means the request to the account's server timed out,
+	// so the server may or may not have applied it.
+	ErrCodeTimeout = -32002
 )
 
 // RPC method names.
@@ -40,7 +50,13 @@ const (
 	MethodArchiveEmails   = "ArchiveEmails"
 	MethodMoveEmails      = "MoveEmails"
 	MethodMarkRead        = "MarkRead"
+	MethodMarkFlagged     = "MarkFlagged"
+	MethodSetLabel        = "SetLabel"
 	MethodFetchFolders    = "FetchFolders"
+	MethodCreateFolder    = "CreateFolder"
+	MethodRenameFolder    = "RenameFolder"
+	MethodDeleteFolder    = "DeleteFolder"
+	MethodSetSubscribed   = "SetFolderSubscribed"
 	MethodRefreshFolder   = "RefreshFolder"
 	MethodSubscribe       = "Subscribe"
 	MethodUnsubscribe     = "Unsubscribe"
@@ -50,6 +66,8 @@ const (
 	MethodExportContacts  = "ExportContacts"
 	MethodQueueEmail      = "QueueEmail"
 	MethodCancelEmail     = "CancelEmail"
+	MethodListOutbox      = "ListOutbox"
+	MethodRetryOutbox     = "RetryOutbox"
 )
 
 // Event type names.
@@ -108,6 +126,23 @@ type CancelEmailParams struct {
 	JobID string `json:"job_id"`
 }
 
+type RetryOutboxParams struct {
+	JobID string `json:"job_id"`
+}
+
+// OutboxEntryInfo describes a queued email without its body or attachments.
+type OutboxEntryInfo struct {
+	JobID     string    `json:"job_id"`
+	AccountID string    `json:"account_id"`
+	To        []string  `json:"to"`
+	Subject   string    `json:"subject"`
+	SendAt    time.Time `json:"send_at"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	Failed    bool      `json:"failed,omitempty"`
+	Sending   bool      `json:"sending,omitempty"`
+}
+
 type FetchEmailBodyResult struct {
 	Body         string           `json:"body"`
 	BodyMIMEType string           `json:"body_mime_type,omitempty"`
@@ -135,6 +170,7 @@ type SendEmailParams struct {
 	Attachments  map[string][]byte `json:"attachments,omitempty"`
 	InReplyTo    string            `json:"in_reply_to,omitempty"`
 	References   []string          `json:"references,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
 	SignSMIME    bool              `json:"sign_smime,omitempty"`
 	EncryptSMIME bool              `json:"encrypt_smime,omitempty"`
 	SignPGP      bool              `json:"sign_pgp,omitempty"`
@@ -167,10 +203,49 @@ type MarkReadParams struct {
 	Read      bool     `json:"read"`
 }
 
+type MarkFlaggedParams struct {
+	AccountID string   `json:"account_id"`
+	Folder    string   `json:"folder"`
+	UIDs      []uint32 `json:"uids"`
+	Flagged   bool     `json:"flagged"`
+}
+
+type SetLabelParams struct {
+	AccountID string   `json:"account_id"`
+	Folder    string   `json:"folder"`
+	UIDs      []uint32 `json:"uids"`
+	Label     string   `json:"label"`
+	Add       bool     `json:"add"`
+}
+
 type FetchFoldersParams struct {
 	AccountID string `json:"account_id"`
 }
 
+type CreateFolderParams struct {
+	AccountID string `json:"account_id"`
+	Folder    string `json:"folder"`
+}
+
+type RenameFolderParams struct {
+	AccountID string `json:"account_id"`
+	Folder    string `json:"folder"`
+	NewName   string `json:"new_name"`
+}
+
+type DeleteFolderParams struct {
+	AccountID string `json:"account_id"`
+	Folder    string `json:"folder"`
+}
+
+// SetSubscribedParams toggles a folder's server-side subscription. It is
+// unrelated to SubscribeParams, which subscribes a client to folder events.
+type SetSubscribedParams struct {
+	AccountID  string `json:"account_id"`
+	Folder     string `json:"folder"`
+	Subscribed bool   `json:"subscribed"`
+}
+
 type RefreshFolderParams struct {
 	AccountID string `json:"account_id"`
 	Folder    string `json:"folder"`
@@ -226,6 +301,13 @@ type SyncCompleteEvent struct {
 	EmailCount int    `json:"email_count"`
 }
 
+// EmailsUpdatedEvent reports that a sync changed a folder's cached emails:
+// new mail arrived, messages vanished or flags changed.
+type EmailsUpdatedEvent struct {
+	AccountID string `json:"account_id"`
+	Folder    string `json:"folder"`
+}
+
 type SyncErrorEvent struct {
 	AccountID string `json:"account_id"`
 	Folder    string `json:"folder"`
@@ -4,14 +4,15 @@ import (
 	"github.com/floatpane/matcha/backend"
 	_ "github.com/floatpane/matcha/backend/jmap"    // register jmap backend
 	_ "github.com/floatpane/matcha/backend/maildir" // register maildir backend
+	_ "github.com/floatpane/matcha/backend/mbox"    // register mbox backend
 	"github.com/floatpane/matcha/config"
 )
 
 // hasBackendProvider reports whether the account is served by a non-IMAP
-// backend (currently only "maildir" and "jmap") and should be routed through
+// backend (currently "maildir", "mbox" and "jmap") and should be routed through
 // the backend.Provider abstraction instead of the legacy IMAP code path.
 func hasBackendProvider(account *config.Account) bool {
-	return account != nil && (account.Protocol == "maildir" || account.Protocol == "jmap")
+	return account != nil && (account.Protocol == "maildir" || account.Protocol == "mbox" || account.Protocol == "jmap")
 }
 
 // newBackendProvider builds the backend.Provider for the account. Callers
@@ -45,6 +46,8 @@ func backendEmailsToFetcher(in []backend.Email) []Email {
 			Body:        e.Body,
 			Date:        e.Date,
 			IsRead:      e.IsRead,
+			IsFlagged:   e.IsFlagged,
+			Labels:      e.Labels,
 			MessageID:   e.MessageID,
 			InReplyTo:   e.InReplyTo,
 			References:  e.References,
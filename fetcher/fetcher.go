@@ -14,6 +14,7 @@ import (
 	"log"
 	"mime"
 	"mime/quotedprintable"
+	"net"
 	"net/textproto"
 	"os"
 	"regexp"
@@ -28,6 +29,7 @@ import (
 	"github.com/emersion/go-imap/v2/imapclient"
 	"github.com/emersion/go-message/mail"
 	"github.com/emersion/go-pgpmail"
+	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/internal/loglevel"
 	"go.mozilla.org/pkcs7"
@@ -108,6 +110,8 @@ type Email struct {
 	BodyMIMEType string // mimeTextHTML or mimeTextPlain; empty when unknown (legacy cache rows). Lets the renderer skip markdown→HTML for already-HTML bodies.
 	Date         time.Time
 	IsRead       bool
+	IsFlagged    bool
+	Labels       []string
 	MessageID    string
 	InReplyTo    string
 	References   []string
@@ -139,6 +143,10 @@ func hasSeenFlag(flags []imap.Flag) bool {
 	return slices.Contains(flags, imap.FlagSeen)
 }
 
+func hasFlaggedFlag(flags []imap.Flag) bool {
+	return slices.Contains(flags, imap.FlagFlagged)
+}
+
 // normalizeGmailAddress canonicalizes a Gmail address by stripping the "+tag"
 // subaddress and removing dots from the local part. Gmail treats
 // "u.s.e.r+tag@gmail.com" and "user@gmail.com" as the same mailbox.
@@ -379,11 +387,20 @@ func connectWithHandler(account *config.Account, handler *imapclient.UnilateralD
 	})
 }
 
-func connect(account *config.Account) (*imapclient.Client, error) {
-	return connectWithOptions(account, nil)
+// connect returns a pooled, authenticated session for account. Closing it
+// returns it to the pool.
+func connect(account *config.Account) (*session, error) {
+	return defaultPool.Get(account)
 }
 
 func connectWithOptions(account *config.Account, extraOpts *imapclient.Options) (*imapclient.Client, error) {
+	return connectWrapped(account, extraOpts, nil)
+}
+
+// connectWrapped is connectWithOptions with wrap, if not nil, applied to the
+// connection beneath the client. Connections that use STARTTLS are not
+// wrapped, as imapclient sets up their TLS layer itself.
+func connectWrapped(account *config.Account, extraOpts *imapclient.Options, wrap func(net.Conn) net.Conn) (*imapclient.Client, error) {
 	imapServer := account.GetIMAPServer()
 	imapPort := account.GetIMAPPort()
 
@@ -422,6 +439,15 @@ func connectWithOptions(account *config.Account, extraOpts *imapclient.Options)
 		if err != nil {
 			return nil, err
 		}
+	} else if wrap != nil {
+		// As imapclient.DialTLS does, but with the connection wrapped.
+		tlsConfig := options.TLSConfig.Clone()
+		tlsConfig.NextProtos = []string{"imap"}
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		c = imapclient.New(wrap(conn), options)
 	} else {
 		// Otherwise default to implicit TLS (port 993)
 		c, err = imapclient.DialTLS(addr, options)
@@ -516,11 +542,23 @@ func FetchMailboxEmails(account *config.Account, mailbox string, limit, offset u
 	}
 	defer c.Close() //nolint:errcheck
 
-	selectData, err := c.Select(mailbox, nil).Wait()
+	selectData, err := c.selectMailbox(mailbox, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	emails, err := fetchSelectedEmails(c.Client, account, mailbox, selectData, limit, offset)
 	if err != nil {
 		return nil, err
 	}
+	addGmailLabels(c, account, mailbox, emails)
+	return emails, nil
+}
 
+// fetchSelectedEmails pages backwards through the selected mailbox until it
+// has limit emails addressed to the account, skipping the newest offset
+// messages.
+func fetchSelectedEmails(c *imapclient.Client, account *config.Account, mailbox string, selectData *imap.SelectData, limit, offset uint32) ([]Email, error) {
 	if selectData.NumMessages == 0 {
 		return []Email{}, nil
 	}
@@ -533,25 +571,7 @@ func FetchMailboxEmails(account *config.Account, mailbox string, limit, offset u
 	}
 	cursor := selectData.NumMessages - offset
 
-	// Determine if we should filter
-	fetchEmail := strings.ToLower(strings.TrimSpace(account.FetchEmail))
-	if fetchEmail == "" {
-		fetchEmail = strings.ToLower(strings.TrimSpace(account.Email))
-	}
-	// Resolve the sent mailbox name dynamically so localized names (e.g.
-	// "Verzonden items" on Dutch Exchange) are recognized as the Sent folder.
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
-	if err != nil {
-		sentMailbox = getSentMailbox(account)
-	}
-	isSentMailbox := mailbox == sentMailbox
-
-	// Delivery header section for matching auto-forwarded emails
-	deliveryHeaderSection := &imap.FetchItemBodySection{
-		Specifier:    imap.PartSpecifierHeader,
-		HeaderFields: []string{"Delivered-To", "X-Forwarded-To", "X-Original-To", "References"},
-		Peek:         true,
-	}
+	m := newEnvelopeMatcher(c, account, mailbox)
 
 	// Loop until we have enough emails or run out of messages
 	for len(allEmails) < int(limit) && cursor > 0 {
@@ -565,14 +585,7 @@ func FetchMailboxEmails(account *config.Account, mailbox string, limit, offset u
 		var seqset imap.SeqSet
 		seqset.AddRange(from, cursor)
 
-		fetchCmd := c.Fetch(seqset, &imap.FetchOptions{
-			Envelope:    true,
-			UID:         true,
-			Flags:       true,
-			BodySection: []*imap.FetchItemBodySection{deliveryHeaderSection},
-		})
-
-		batchMsgs, err := fetchCmd.Collect()
+		batchMsgs, err := c.Fetch(seqset, m.fetchOptions()).Collect()
 		if err != nil {
 			return nil, err
 		}
@@ -580,72 +593,9 @@ func FetchMailboxEmails(account *config.Account, mailbox string, limit, offset u
 		// Filter messages in this batch
 		var batchEmails []Email
 		for _, msg := range batchMsgs {
-			if msg.Envelope == nil {
-				continue
-			}
-
-			var fromAddr string
-			if len(msg.Envelope.From) > 0 {
-				fromAddr = formatAddress(msg.Envelope.From[0])
-			}
-
-			var toAddrList []string
-			for _, addr := range msg.Envelope.To {
-				toAddrList = append(toAddrList, addr.Addr())
+			if email, ok := m.email(msg); ok {
+				batchEmails = append(batchEmails, email)
 			}
-			for _, addr := range msg.Envelope.Cc {
-				toAddrList = append(toAddrList, addr.Addr())
-			}
-
-			var replyToAddrList []string
-			for _, addr := range msg.Envelope.ReplyTo {
-				replyToAddrList = append(replyToAddrList, addr.Addr())
-			}
-
-			matched := false
-			switch {
-			case account.CatchAll:
-				matched = true
-			case isSentMailbox:
-				var senderEmail string
-				if len(msg.Envelope.From) > 0 {
-					senderEmail = msg.Envelope.From[0].Addr()
-				}
-				if addressMatches(senderEmail, fetchEmail, account) {
-					matched = true
-				}
-			default:
-				for _, r := range toAddrList {
-					if addressMatches(r, fetchEmail, account) {
-						matched = true
-						break
-					}
-				}
-				// Check delivery headers for auto-forwarded emails
-				if !matched {
-					headerData := msg.FindBodySection(deliveryHeaderSection)
-					matched = deliveryHeadersMatch(headerData, fetchEmail, account)
-				}
-			}
-
-			if !matched {
-				continue
-			}
-
-			headerData := msg.FindBodySection(deliveryHeaderSection)
-			batchEmails = append(batchEmails, Email{
-				UID:        uint32(msg.UID),
-				From:       fromAddr,
-				To:         toAddrList,
-				ReplyTo:    replyToAddrList,
-				Subject:    decodeHeader(msg.Envelope.Subject),
-				Date:       msg.Envelope.Date,
-				IsRead:     hasSeenFlag(msg.Flags),
-				MessageID:  msg.Envelope.MessageID,
-				InReplyTo:  firstEnvelopeInReplyTo(msg.Envelope.InReplyTo),
-				References: headerMessageIDs(headerData, "References"),
-				AccountID:  account.ID,
-			})
 		}
 
 		// Sort batch Newest -> Oldest by UID desc
@@ -665,6 +615,124 @@ func FetchMailboxEmails(account *config.Account, mailbox string, limit, offset u
 	return allEmails, nil
 }
 
+// envelopeMatcher turns fetched envelopes into Emails, keeping only the
+// messages that belong to the account: mail it sent in the Sent folder,
+// mail addressed (or forwarded) to it elsewhere.
+type envelopeMatcher struct {
+	account       *config.Account
+	fetchEmail    string
+	isSentMailbox bool
+	// Delivery header section for matching auto-forwarded emails
+	deliveryHeaderSection *imap.FetchItemBodySection
+}
+
+func newEnvelopeMatcher(c *imapclient.Client, account *config.Account, mailbox string) *envelopeMatcher {
+	// Determine if we should filter
+	fetchEmail := strings.ToLower(strings.TrimSpace(account.FetchEmail))
+	if fetchEmail == "" {
+		fetchEmail = strings.ToLower(strings.TrimSpace(account.Email))
+	}
+	// Resolve the sent mailbox name dynamically so localized names (e.g.
+	// "Verzonden items" on Dutch Exchange) are recognized as the Sent folder.
+	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	if err != nil {
+		sentMailbox = getSentMailbox(account)
+	}
+
+	return &envelopeMatcher{
+		account:       account,
+		fetchEmail:    fetchEmail,
+		isSentMailbox: mailbox == sentMailbox,
+		deliveryHeaderSection: &imap.FetchItemBodySection{
+			Specifier:    imap.PartSpecifierHeader,
+			HeaderFields: []string{"Delivered-To", "X-Forwarded-To", "X-Original-To", "References"},
+			Peek:         true,
+		},
+	}
+}
+
+// fetchOptions returns the FETCH items email needs.
+func (m *envelopeMatcher) fetchOptions() *imap.FetchOptions {
+	return &imap.FetchOptions{
+		Envelope:    true,
+		UID:         true,
+		Flags:       true,
+		BodySection: []*imap.FetchItemBodySection{m.deliveryHeaderSection},
+	}
+}
+
+func (m *envelopeMatcher) email(msg *imapclient.FetchMessageBuffer) (Email, bool) {
+	if msg.Envelope == nil {
+		return Email{}, false
+	}
+	account := m.account
+
+	var fromAddr string
+	if len(msg.Envelope.From) > 0 {
+		fromAddr = formatAddress(msg.Envelope.From[0])
+	}
+
+	var toAddrList []string
+	for _, addr := range msg.Envelope.To {
+		toAddrList = append(toAddrList, addr.Addr())
+	}
+	for _, addr := range msg.Envelope.Cc {
+		toAddrList = append(toAddrList, addr.Addr())
+	}
+
+	var replyToAddrList []string
+	for _, addr := range msg.Envelope.ReplyTo {
+		replyToAddrList = append(replyToAddrList, addr.Addr())
+	}
+
+	matched := false
+	switch {
+	case account.CatchAll:
+		matched = true
+	case m.isSentMailbox:
+		var senderEmail string
+		if len(msg.Envelope.From) > 0 {
+			senderEmail = msg.Envelope.From[0].Addr()
+		}
+		if addressMatches(senderEmail, m.fetchEmail, account) {
+			matched = true
+		}
+	default:
+		for _, r := range toAddrList {
+			if addressMatches(r, m.fetchEmail, account) {
+				matched = true
+				break
+			}
+		}
+		// Check delivery headers for auto-forwarded emails
+		if !matched {
+			headerData := msg.FindBodySection(m.deliveryHeaderSection)
+			matched = deliveryHeadersMatch(headerData, m.fetchEmail, account)
+		}
+	}
+
+	if !matched {
+		return Email{}, false
+	}
+
+	headerData := msg.FindBodySection(m.deliveryHeaderSection)
+	return Email{
+		UID:        uint32(msg.UID),
+		From:       fromAddr,
+		To:         toAddrList,
+		ReplyTo:    replyToAddrList,
+		Subject:    decodeHeader(msg.Envelope.Subject),
+		Date:       msg.Envelope.Date,
+		IsRead:     hasSeenFlag(msg.Flags),
+		IsFlagged:  hasFlaggedFlag(msg.Flags),
+		Labels:     flagLabels(msg.Flags),
+		MessageID:  msg.Envelope.MessageID,
+		InReplyTo:  firstEnvelopeInReplyTo(msg.Envelope.InReplyTo),
+		References: headerMessageIDs(headerData, "References"),
+		AccountID:  account.ID,
+	}, true
+}
+
 // FetchEmailBodyFromMailbox returns the chosen body, its MIME type
 // (mimeTextHTML or mimeTextPlain; empty if it could not be resolved), the
 // parsed attachments, and any error. The MIME type lets the renderer
@@ -689,7 +757,7 @@ func FetchEmailBodyFromMailbox(account *config.Account, mailbox string, uid uint
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return "", "", nil, err
 	}
 
@@ -1270,7 +1338,7 @@ func FetchAttachmentFromMailbox(account *config.Account, mailbox string, uid uin
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return nil, err
 	}
 
@@ -1321,7 +1389,7 @@ func moveEmail(account *config.Account, uid uint32, sourceMailbox, destMailbox s
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(sourceMailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(sourceMailbox); err != nil {
 		return err
 	}
 
@@ -1346,7 +1414,7 @@ func MarkEmailAsReadInMailbox(account *config.Account, mailbox string, uid uint3
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return err
 	}
 
@@ -1374,7 +1442,7 @@ func MarkEmailAsUnreadInMailbox(account *config.Account, mailbox string, uid uin
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return err
 	}
 
@@ -1386,6 +1454,52 @@ func MarkEmailAsUnreadInMailbox(account *config.Account, mailbox string, uid uin
 	}, nil).Close()
 }
 
+// MarkEmailAsFlaggedInMailbox sets the \Flagged flag on a message.
+func MarkEmailAsFlaggedInMailbox(account *config.Account, mailbox string, uid uint32) error {
+	if hasBackendProvider(account) {
+		p, err := newBackendProvider(account)
+		if err != nil {
+			return err
+		}
+		defer p.Close() //nolint:errcheck
+		return p.MarkFlagged(context.Background(), mailbox, uid)
+	}
+	return storeFlag(account, mailbox, uid, imap.StoreFlagsAdd, imap.FlagFlagged)
+}
+
+// MarkEmailAsUnflaggedInMailbox clears the \Flagged flag on a message.
+func MarkEmailAsUnflaggedInMailbox(account *config.Account, mailbox string, uid uint32) error {
+	if hasBackendProvider(account) {
+		p, err := newBackendProvider(account)
+		if err != nil {
+			return err
+		}
+		defer p.Close() //nolint:errcheck
+		return p.MarkUnflagged(context.Background(), mailbox, uid)
+	}
+	return storeFlag(account, mailbox, uid, imap.StoreFlagsDel, imap.FlagFlagged)
+}
+
+// storeFlag adds or removes a single flag on a message over IMAP.
+func storeFlag(account *config.Account, mailbox string, uid uint32, op imap.StoreFlagsOp, flag imap.Flag) error {
+	c, err := connect(account)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	if err := c.useMailbox(mailbox); err != nil {
+		return err
+	}
+
+	uidSet := imap.UIDSetNum(imap.UID(uid))
+	return c.Store(uidSet, &imap.StoreFlags{
+		Op:     op,
+		Silent: true,
+		Flags:  []imap.Flag{flag},
+	}, nil).Close()
+}
+
 func DeleteEmailFromMailbox(account *config.Account, mailbox string, uid uint32) error {
 	if hasBackendProvider(account) {
 		p, err := newBackendProvider(account)
@@ -1402,7 +1516,7 @@ func DeleteEmailFromMailbox(account *config.Account, mailbox string, uid uint32)
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return err
 	}
 
@@ -1438,7 +1552,7 @@ func ArchiveEmailFromMailbox(account *config.Account, mailbox string, uid uint32
 	switch account.ServiceProvider {
 	case config.ProviderGmail:
 		// For Gmail, find the mailbox with the \All attribute
-		archiveMailbox, err = getMailboxByAttr(c, imap.MailboxAttrAll)
+		archiveMailbox, err = getMailboxByAttr(c.Client, imap.MailboxAttrAll)
 		if err != nil {
 			// Fallback to hardcoded path if attribute lookup fails
 			archiveMailbox = "[Gmail]/All Mail"
@@ -1447,7 +1561,7 @@ func ArchiveEmailFromMailbox(account *config.Account, mailbox string, uid uint32
 		archiveMailbox = defaultArchiveMailbox
 	}
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return err
 	}
 
@@ -1479,7 +1593,7 @@ func DeleteEmailsFromMailbox(account *config.Account, mailbox string, uids []uin
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return err
 	}
 
@@ -1519,7 +1633,7 @@ func ArchiveEmailsFromMailbox(account *config.Account, mailbox string, uids []ui
 	var archiveMailbox string
 	switch account.ServiceProvider {
 	case config.ProviderGmail:
-		archiveMailbox, err = getMailboxByAttr(c, imap.MailboxAttrAll)
+		archiveMailbox, err = getMailboxByAttr(c.Client, imap.MailboxAttrAll)
 		if err != nil {
 			archiveMailbox = "[Gmail]/All Mail"
 		}
@@ -1527,7 +1641,7 @@ func ArchiveEmailsFromMailbox(account *config.Account, mailbox string, uids []ui
 		archiveMailbox = defaultArchiveMailbox
 	}
 
-	if _, err := c.Select(mailbox, nil).Wait(); err != nil {
+	if err := c.useMailbox(mailbox); err != nil {
 		return err
 	}
 
@@ -1557,7 +1671,7 @@ func MoveEmailsToFolder(account *config.Account, uids []uint32, sourceFolder, de
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(sourceFolder, nil).Wait(); err != nil {
+	if err := c.useMailbox(sourceFolder); err != nil {
 		return err
 	}
 
@@ -1579,7 +1693,7 @@ func FetchSentEmails(account *config.Account, limit, offset uint32) ([]Email, er
 	}
 	defer c.Close() //nolint:errcheck
 
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	sentMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrSent)
 	if err != nil {
 		sentMailbox = getSentMailbox(account)
 	}
@@ -1598,7 +1712,7 @@ func FetchSentEmailBody(account *config.Account, uid uint32) (string, string, []
 	}
 	defer c.Close() //nolint:errcheck
 
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	sentMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrSent)
 	if err != nil {
 		sentMailbox = getSentMailbox(account)
 	}
@@ -1617,7 +1731,7 @@ func FetchSentAttachment(account *config.Account, uid uint32, partID string, enc
 	}
 	defer c.Close() //nolint:errcheck
 
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	sentMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrSent)
 	if err != nil {
 		sentMailbox = getSentMailbox(account)
 	}
@@ -1636,7 +1750,7 @@ func DeleteSentEmail(account *config.Account, uid uint32) error {
 	}
 	defer c.Close() //nolint:errcheck
 
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	sentMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrSent)
 	if err != nil {
 		sentMailbox = getSentMailbox(account)
 	}
@@ -1655,7 +1769,7 @@ func ArchiveSentEmail(account *config.Account, uid uint32) error {
 	}
 	defer c.Close() //nolint:errcheck
 
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	sentMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrSent)
 	if err != nil {
 		sentMailbox = getSentMailbox(account)
 	}
@@ -1663,15 +1777,29 @@ func ArchiveSentEmail(account *config.Account, uid uint32) error {
 	return ArchiveEmailFromMailbox(account, sentMailbox, uid)
 }
 
-// AppendToSentMailbox appends a raw RFC822 message to the Sent mailbox via IMAP APPEND.
+// AppendToSentMailbox appends a raw RFC822 message to the Sent mailbox via IMAP APPEND,
+// or through the backend provider for accounts that have one.
 func AppendToSentMailbox(account *config.Account, rawMsg []byte) error {
+	if hasBackendProvider(account) {
+		p, err := newBackendProvider(account)
+		if err != nil {
+			return err
+		}
+		defer p.Close() //nolint:errcheck
+		saver, ok := p.(backend.SentSaver)
+		if !ok {
+			return backend.ErrNotSupported
+		}
+		return saver.SaveSent(context.Background(), rawMsg)
+	}
+
 	c, err := connect(account)
 	if err != nil {
 		return err
 	}
 	defer c.Close() //nolint:errcheck
 
-	sentMailbox, err := getMailboxByAttr(c, imap.MailboxAttrSent)
+	sentMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrSent)
 	if err != nil {
 		sentMailbox = getSentMailbox(account)
 	}
@@ -1724,7 +1852,7 @@ func FetchTrashEmails(account *config.Account, limit, offset uint32) ([]Email, e
 	defer c.Close() //nolint:errcheck
 
 	// Try to find trash by attribute first
-	trashMailbox, err := getMailboxByAttr(c, imap.MailboxAttrTrash)
+	trashMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrTrash)
 	if err != nil {
 		// Fallback to hardcoded path
 		trashMailbox = getTrashMailbox(account)
@@ -1743,13 +1871,13 @@ func FetchArchiveEmails(account *config.Account, limit, offset uint32) ([]Email,
 	defer c.Close() //nolint:errcheck
 
 	// Try to find archive by attribute first (Gmail uses \All)
-	archiveMailbox, err := getMailboxByAttr(c, imap.MailboxAttrAll)
+	archiveMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrAll)
 	if err != nil {
 		// Fallback to hardcoded path
 		archiveMailbox = getArchiveMailbox(account)
 	}
 
-	selectData, err := c.Select(archiveMailbox, nil).Wait()
+	selectData, err := c.selectMailbox(archiveMailbox, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1851,6 +1979,8 @@ func FetchArchiveEmails(account *config.Account, limit, offset uint32) ([]Email,
 			Subject:    decodeHeader(msg.Envelope.Subject),
 			Date:       msg.Envelope.Date,
 			IsRead:     hasSeenFlag(msg.Flags),
+			IsFlagged:  hasFlaggedFlag(msg.Flags),
+			Labels:     flagLabels(msg.Flags),
 			MessageID:  msg.Envelope.MessageID,
 			InReplyTo:  firstEnvelopeInReplyTo(msg.Envelope.InReplyTo),
 			References: headerMessageIDs(headerData, "References"),
@@ -1874,7 +2004,7 @@ func FetchTrashEmailBody(account *config.Account, uid uint32) (string, string, [
 	}
 	defer c.Close() //nolint:errcheck
 
-	trashMailbox, err := getMailboxByAttr(c, imap.MailboxAttrTrash)
+	trashMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrTrash)
 	if err != nil {
 		trashMailbox = getTrashMailbox(account)
 	}
@@ -1890,7 +2020,7 @@ func FetchArchiveEmailBody(account *config.Account, uid uint32) (string, string,
 	}
 	defer c.Close() //nolint:errcheck
 
-	archiveMailbox, err := getMailboxByAttr(c, imap.MailboxAttrAll)
+	archiveMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrAll)
 	if err != nil {
 		archiveMailbox = getArchiveMailbox(account)
 	}
@@ -1906,7 +2036,7 @@ func FetchTrashAttachment(account *config.Account, uid uint32, partID string, en
 	}
 	defer c.Close() //nolint:errcheck
 
-	trashMailbox, err := getMailboxByAttr(c, imap.MailboxAttrTrash)
+	trashMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrTrash)
 	if err != nil {
 		trashMailbox = getTrashMailbox(account)
 	}
@@ -1922,7 +2052,7 @@ func FetchArchiveAttachment(account *config.Account, uid uint32, partID string,
 	}
 	defer c.Close() //nolint:errcheck
 
-	archiveMailbox, err := getMailboxByAttr(c, imap.MailboxAttrAll)
+	archiveMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrAll)
 	if err != nil {
 		archiveMailbox = getArchiveMailbox(account)
 	}
@@ -1938,7 +2068,7 @@ func DeleteTrashEmail(account *config.Account, uid uint32) error {
 	}
 	defer c.Close() //nolint:errcheck
 
-	trashMailbox, err := getMailboxByAttr(c, imap.MailboxAttrTrash)
+	trashMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrTrash)
 	if err != nil {
 		trashMailbox = getTrashMailbox(account)
 	}
@@ -1954,7 +2084,7 @@ func DeleteArchiveEmail(account *config.Account, uid uint32) error {
 	}
 	defer c.Close() //nolint:errcheck
 
-	archiveMailbox, err := getMailboxByAttr(c, imap.MailboxAttrAll)
+	archiveMailbox, err := getMailboxByAttr(c.Client, imap.MailboxAttrAll)
 	if err != nil {
 		archiveMailbox = getArchiveMailbox(account)
 	}
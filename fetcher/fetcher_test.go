@@ -195,3 +195,17 @@ func TestFetchEmailsWithCustomServer(t *testing.T) {
 
 	t.Logf("Fetched %d emails from custom server %s", len(emails), customAccount.IMAPServer)
 }
+
+func TestParseHeaderDecodesValues(t *testing.T) {
+	raw := "List-Id: CI <ci.example.com>\r\nSubject: =?UTF-8?Q?Build_f=C3=A4iled?=\r\nX-Spam: yes\r\n\r\n"
+	h := parseHeader([]byte(raw))
+	if got := h.Get("list-id"); got != "CI <ci.example.com>" {
+		t.Errorf("List-Id = %q", got)
+	}
+	if got := h.Get("Subject"); got != "Build fäiled" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := parseHeader([]byte("not a header")).Get("Subject"); got != "" {
+		t.Errorf("malformed header gave Subject %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package fetcher
+
+import (
+	"context"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+)
+
+// CreateFolder creates a new mailbox. Hierarchical names use the server's
+// delimiter, e.g. "Projects/2024".
+func CreateFolder(account *config.Account, name string) error {
+	return manageFolder(account,
+		func(ctx context.Context, p backend.Provider) error { return p.CreateFolder(ctx, name) },
+		func(c *imapclient.Client) error { return c.Create(name, nil).Wait() },
+	)
+}
+
+// RenameFolder renames a mailbox. On IMAP, child mailboxes move with it.
+func RenameFolder(account *config.Account, oldName, newName string) error {
+	return manageFolder(account,
+		func(ctx context.Context, p backend.Provider) error { return p.RenameFolder(ctx, oldName, newName) },
+		func(c *imapclient.Client) error { return c.Rename(oldName, newName, nil).Wait() },
+	)
+}
+
+// DeleteFolder deletes a mailbox and the messages in it.
+func DeleteFolder(account *config.Account, name string) error {
+	return manageFolder(account,
+		func(ctx context.Context, p backend.Provider) error { return p.DeleteFolder(ctx, name) },
+		func(c *imapclient.Client) error { return c.Delete(name).Wait() },
+	)
+}
+
+// SubscribeFolder adds a mailbox to the account's subscription list.
+func SubscribeFolder(account *config.Account, name string) error {
+	return manageFolder(account,
+		func(ctx context.Context, p backend.Provider) error { return p.SubscribeFolder(ctx, name) },
+		func(c *imapclient.Client) error { return c.Subscribe(name).Wait() },
+	)
+}
+
+// UnsubscribeFolder removes a mailbox from the account's subscription list.
+func UnsubscribeFolder(account *config.Account, name string) error {
+	return manageFolder(account,
+		func(ctx context.Context, p backend.Provider) error { return p.UnsubscribeFolder(ctx, name) },
+		func(c *imapclient.Client) error { return c.Unsubscribe(name).Wait() },
+	)
+}
+
+// manageFolder runs a folder operation through the account's backend
+// provider, or over a pooled IMAP session for IMAP accounts.
+func manageFolder(account *config.Account, viaBackend func(context.Context, backend.Provider) error, viaIMAP func(*imapclient.Client) error) error {
+	if hasBackendProvider(account) {
+		p, err := newBackendProvider(account)
+		if err != nil {
+			return err
+		}
+		defer p.Close() //nolint:errcheck
+		return viaBackend(context.Background(), p)
+	}
+
+	c, err := connect(account)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	// Renaming or deleting the selected mailbox changes the selection.
+	c.selected = ""
+	return viaIMAP(c.Client)
+}
@@ -0,0 +1,146 @@
+package fetcher
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/floatpane/matcha/config"
+)
+
+// gmailLabelsTag tags the X-GM-LABELS fetch.
+const gmailLabelsTag = "G1"
+
+// gmailLabelsTimeout is how long to wait for the labels of a page of emails.
+const gmailLabelsTimeout = 30 * time.Second
+
+// fetchGmailLabels asks for the labels of the messages with the given UIDs
+// in the selected mailbox. imapclient cannot parse Gmail's X-GM-LABELS
+// fetch item, so the fetch is sent through c and its responses are kept
+// from imapclient. It must be called while imapclient has no command in
+// progress.
+func fetchGmailLabels(c *wireConn, uids []uint32) (map[uint32][]string, error) {
+	set := make([]imap.UID, len(uids))
+	for i, uid := range uids {
+		set[i] = imap.UID(uid)
+	}
+	labels := make(map[uint32][]string)
+	cmd := &wireCommand{
+		tag: gmailLabelsTag,
+		claim: func(line []byte) bool {
+			return bytes.Contains(line, []byte("X-GM-LABELS"))
+		},
+		handle: func(resp string) {
+			if uid, l, ok := parseGmailLabels(resp); ok {
+				labels[uid] = l
+			}
+		},
+	}
+	status, err := c.command(cmd, fmt.Sprintf("UID FETCH %s (UID X-GM-LABELS)", imap.UIDSetNum(set...)), gmailLabelsTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("X-GM-LABELS: %w", err)
+	}
+	if !strings.HasPrefix(status, "OK") {
+		return nil, fmt.Errorf("X-GM-LABELS: %s", status)
+	}
+	return labels, nil
+}
+
+// parseGmailLabels reads the UID and user labels from a FETCH response.
+// System labels such as \Inbox and \Important are left out.
+func parseGmailLabels(resp string) (uid uint32, labels []string, ok bool) {
+	tokens := imapTokens(resp)
+	var haveUID, haveLabels bool
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].quoted {
+			continue
+		}
+		switch strings.ToUpper(tokens[i].text) {
+		case "UID":
+			if i+1 < len(tokens) {
+				n, err := strconv.ParseUint(tokens[i+1].text, 10, 32)
+				uid, haveUID = uint32(n), err == nil
+			}
+		case "X-GM-LABELS":
+			if i+1 >= len(tokens) || tokens[i+1].text != "(" || tokens[i+1].quoted {
+				continue
+			}
+			haveLabels = true
+			for i += 2; i < len(tokens) && (tokens[i].quoted || tokens[i].text != ")"); i++ {
+				if label := tokens[i].text; !strings.HasPrefix(label, `\`) {
+					labels = append(labels, label)
+				}
+			}
+		}
+	}
+	return uid, labels, haveUID && haveLabels
+}
+
+// imapToken is a parenthesis, atom or quoted string of an IMAP response.
+type imapToken struct {
+	text   string
+	quoted bool
+}
+
+// imapTokens splits an IMAP response into tokens, unquoting quoted strings.
+func imapTokens(s string) []imapToken {
+	var tokens []imapToken
+	for i := 0; i < len(s); {
+		switch ch := s[i]; {
+		case ch == ' ' || ch == '\r' || ch == '\n':
+			i++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, imapToken{text: string(ch)})
+			i++
+		case ch == '"':
+			var b strings.Builder
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			tokens = append(tokens, imapToken{text: b.String(), quoted: true})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" ()\"\r\n", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, imapToken{text: s[start:i]})
+		}
+	}
+	return tokens
+}
+
+// addGmailLabels fills in the labels of emails fetched from mailbox, which
+// must be selected on s, when the account is on Gmail: Gmail keeps labels
+// as X-GM-LABELS rather than as keywords. Failures are logged and leave the
+// emails as they are.
+func addGmailLabels(s *session, account *config.Account, mailbox string, emails []Email) {
+	if !isGmail(account) || len(emails) == 0 {
+		return
+	}
+	if s.wire == nil {
+		log.Printf("fetcher: Gmail labels for %s: X-GM-LABELS is not available over STARTTLS", mailbox)
+		return
+	}
+	uids := make([]uint32, len(emails))
+	for i, e := range emails {
+		uids[i] = e.UID
+	}
+	labels, err := fetchGmailLabels(s.wire, uids)
+	if err != nil {
+		log.Printf("fetcher: Gmail labels for %s: %v", mailbox, err)
+		return
+	}
+	for i := range emails {
+		if l, ok := labels[emails[i].UID]; ok {
+			emails[i].Labels = l
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestFetchGmailLabels(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+
+	wc := newWireConn(client, nil)
+	stream := "* 1 FETCH (FLAGS (\\Seen))\r\n" +
+		"* 2 FETCH (X-GM-LABELS (\\Inbox \"Work\" {6}\r\nCaf\xc3\xa9s) UID 12)\r\n" +
+		"* 3 FETCH (UID 13 X-GM-LABELS ())\r\n" +
+		"* 4 FETCH (BODY[] {12}\r\nG1 OK fake\r\n)\r\n" +
+		"G1 OK Success\r\n"
+	sent := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(server).ReadString('\n')
+		sent <- line
+		server.Write([]byte(stream)) //nolint:errcheck
+		server.Close()               //nolint:errcheck
+	}()
+	passed := make(chan string, 1)
+	go func() {
+		b, _ := io.ReadAll(wc)
+		passed <- string(b)
+	}()
+
+	labels, err := fetchGmailLabels(wc, []uint32{12, 13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-sent; cmd != "G1 UID FETCH 12:13 (UID X-GM-LABELS)\r\n" {
+		t.Errorf("sent %q", cmd)
+	}
+	wantLabels := map[uint32][]string{12: {"Work", "Cafés"}, 13: nil}
+	if !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("labels = %v, want %v", labels, wantLabels)
+	}
+	want := "* 1 FETCH (FLAGS (\\Seen))\r\n" +
+		"* 4 FETCH (BODY[] {12}\r\nG1 OK fake\r\n)\r\n"
+	if got := <-passed; got != want {
+		t.Errorf("passed through:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestParseGmailLabels(t *testing.T) {
+	tests := []struct {
+		resp   string
+		uid    uint32
+		labels []string
+		ok     bool
+	}{
+		{`* 1 FETCH (UID 7 X-GM-LABELS ("\\Important" "a \"b\"" c))`, 7, []string{`a "b"`, "c"}, true},
+		{`* 1 FETCH (X-GM-LABELS (x))`, 0, []string{"x"}, false},
+		{`* 1 FETCH (UID 7)`, 7, nil, false},
+	}
+	for _, tt := range tests {
+		uid, labels, ok := parseGmailLabels(tt.resp)
+		if uid != tt.uid || !reflect.DeepEqual(labels, tt.labels) || ok != tt.ok {
+			t.Errorf("parseGmailLabels(%q) = %d, %q, %v; want %d, %q, %v", tt.resp, uid, labels, ok, tt.uid, tt.labels, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package fetcher
+
+import (
+	"bytes"
+	"net/mail"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/floatpane/matcha/config"
+)
+
+// MessageHeader is a message's full header and its size in bytes.
+type MessageHeader struct {
+	Size   int64
+	Header mail.Header
+}
+
+// FetchMessageHeaders fetches the full headers and sizes of messages in a
+// mailbox, keyed by UID. Header values are decoded. It is only supported for
+// IMAP accounts; for other backends it returns no headers.
+func FetchMessageHeaders(account *config.Account, mailbox string, uids []uint32) (map[uint32]MessageHeader, error) {
+	if len(uids) == 0 || hasBackendProvider(account) {
+		return nil, nil
+	}
+
+	c, err := connect(account)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close() //nolint:errcheck
+
+	if _, err := c.selectMailbox(mailbox, &imap.SelectOptions{ReadOnly: true}); err != nil {
+		return nil, err
+	}
+
+	section := &imap.FetchItemBodySection{Specifier: imap.PartSpecifierHeader, Peek: true}
+	msgs, err := c.Fetch(uidsToUIDSet(uids), &imap.FetchOptions{
+		UID:         true,
+		RFC822Size:  true,
+		BodySection: []*imap.FetchItemBodySection{section},
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[uint32]MessageHeader, len(msgs))
+	for _, msg := range msgs {
+		headers[uint32(msg.UID)] = MessageHeader{
+			Size:   msg.RFC822Size,
+			Header: parseHeader(msg.FindBodySection(section)),
+		}
+	}
+	return headers, nil
+}
+
+// parseHeader parses a raw header block, decoding encoded words in values.
+func parseHeader(data []byte) mail.Header {
+	msg, err := mail.ReadMessage(bytes.NewReader(append(data, "\r\n"...)))
+	if err != nil {
+		return mail.Header{}
+	}
+	for key, values := range msg.Header {
+		for i, v := range values {
+			values[i] = decodeHeader(v)
+		}
+		msg.Header[key] = values
+	}
+	return msg.Header
+}
@@ -28,10 +28,12 @@ type IdleWatcher struct {
 // ErrStopTimeout is returned when IDLE watcher goroutines do not stop before the timeout.
 var ErrStopTimeout = errors.New("idle watcher: stop timed out")
 
-// accountIdle manages a single IDLE connection for one account.
+// accountIdle watches the folders of one account: over a single connection
+// with IMAP NOTIFY when there are several and the server supports it, and
+// with one IDLE connection per folder otherwise.
 type accountIdle struct {
 	account *config.Account
-	folder  string
+	folders []string
 	notify  chan<- IdleUpdate
 	stop    chan struct{}
 	done    chan struct{}
@@ -47,6 +49,12 @@ func NewIdleWatcher(notify chan<- IdleUpdate) *IdleWatcher {
 
 // Watch starts (or restarts) an IDLE connection for the given account and folder.
 func (w *IdleWatcher) Watch(account *config.Account, folder string) {
+	w.WatchFolders(account, []string{folder})
+}
+
+// WatchFolders starts (or restarts) watching several folders of an account,
+// replacing any folders watched for it before.
+func (w *IdleWatcher) WatchFolders(account *config.Account, folders []string) {
 	// IDLE is an IMAP-only concept; non-IMAP backends (maildir, etc.) have
 	// no remote socket to keep open. Skip silently rather than spinning the
 	// reconnect loop forever.
@@ -66,7 +74,7 @@ func (w *IdleWatcher) Watch(account *config.Account, folder string) {
 
 	a := &accountIdle{
 		account: account,
-		folder:  folder,
+		folders: folders,
 		notify:  w.notify,
 		stop:    make(chan struct{}),
 		done:    make(chan struct{}),
@@ -145,16 +153,45 @@ func (w *IdleWatcher) StopAllAndWaitTimeout(d time.Duration) error {
 func (a *accountIdle) run() {
 	defer close(a.done)
 
+	if len(a.folders) == 1 {
+		a.retry(func() error { return a.idleOnce(a.folders[0]) })
+		return
+	}
+
+	err := a.retry(a.notifyOnce)
+	if !errors.Is(err, errNotifyUnsupported) {
+		return
+	}
+	log.Printf("IDLE for account %s: %v, using one connection per folder", a.account.ID, err)
+
+	var wg sync.WaitGroup
+	for _, folder := range a.folders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.retry(func() error { return a.idleOnce(folder) })
+		}()
+	}
+	wg.Wait()
+}
+
+// retry runs once until it returns nil, which it does when the watcher is
+// stopped, reconnecting with backoff after errors. It gives up on errors
+// that retrying cannot fix, and returns them.
+func (a *accountIdle) retry(once func() error) error {
 	initialBackoff := 5 * time.Second
 	maxBackoff := 2 * time.Minute
 	backoff := initialBackoff
 
 	for {
 		start := time.Now()
-		err := a.idleOnce()
+		err := once()
 		if err == nil {
 			// Clean exit (stop was closed)
-			return
+			return nil
+		}
+		if errors.Is(err, errNotifyUnsupported) {
+			return err
 		}
 
 		// Reset backoff if we had a successful IDLE session (ran for
@@ -166,14 +203,14 @@ func (a *accountIdle) run() {
 		// Check if we were told to stop
 		select {
 		case <-a.stop:
-			return
+			return nil
 		default:
 		}
 
 		// Don't retry on authentication errors — they won't resolve by retrying
 		if strings.Contains(err.Error(), "authentication error") || strings.Contains(err.Error(), "XOAUTH2 authentication failed") {
 			log.Printf("IDLE stopped for account %s: %v", a.account.ID, err)
-			return
+			return err
 		}
 
 		log.Printf("IDLE error for account %s: %v (reconnecting in %v)", a.account.ID, err, backoff)
@@ -181,7 +218,7 @@ func (a *accountIdle) run() {
 		// Wait with backoff before reconnecting
 		select {
 		case <-a.stop:
-			return
+			return nil
 		case <-time.After(backoff):
 		}
 
@@ -192,9 +229,9 @@ func (a *accountIdle) run() {
 	}
 }
 
-// idleOnce connects, selects the mailbox, and runs IDLE until an error or stop.
+// idleOnce connects, selects the folder, and runs IDLE until an error or stop.
 // Returns nil if stopped cleanly.
-func (a *accountIdle) idleOnce() error {
+func (a *accountIdle) idleOnce(folder string) error {
 	mailboxUpdates := make(chan uint32, 32)
 	c, err := connectWithHandler(a.account, &imapclient.UnilateralDataHandler{
 		Mailbox: func(data *imapclient.UnilateralDataMailbox) {
@@ -218,7 +255,7 @@ func (a *accountIdle) idleOnce() error {
 	defer c.Close() //nolint:errcheck
 
 	// Select the mailbox in read-only mode
-	selectData, err := c.Select(a.folder, nil).Wait()
+	selectData, err := c.Select(folder, nil).Wait()
 	if err != nil {
 		return err
 	}
@@ -242,7 +279,7 @@ func (a *accountIdle) idleOnce() error {
 				select {
 				case a.notify <- IdleUpdate{
 					AccountID:  a.account.ID,
-					FolderName: a.folder,
+					FolderName: folder,
 				}:
 				case <-a.stop:
 					idleCmd.Close() //nolint:errcheck,gosec
@@ -70,3 +70,38 @@ func TestIdleWatcher_StopAllAndWaitTimeout_ReturnsOnSlowExit(t *testing.T) {
 		t.Fatal("synthetic watcher did not exit during cleanup")
 	}
 }
+
+func TestIdleWatcherWatchesFolders(t *testing.T) {
+	account, _, selects := startPoolIMAPServer(t, 3)
+
+	updates := make(chan IdleUpdate, 8)
+	w := NewIdleWatcher(updates)
+	w.WatchFolders(account, []string{"INBOX", defaultArchiveMailbox})
+	t.Cleanup(w.StopAllAndWait)
+
+	// The test server has no NOTIFY, so each folder gets its own IDLE
+	// connection.
+	deadline := time.Now().Add(5 * time.Second)
+	for selects.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher selected %d folders, want 2", selects.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for uid := uint32(1); uid <= 3; uid++ {
+		time.Sleep(100 * time.Millisecond) // let IDLE start
+		if err := ArchiveEmailFromMailbox(account, "INBOX", uid); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case u := <-updates:
+			if u.AccountID != account.ID || u.FolderName != defaultArchiveMailbox {
+				t.Errorf("update = %+v, want %s in %s", u, account.ID, defaultArchiveMailbox)
+			}
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	t.Fatal("no update for mail arriving in the archive")
+}
@@ -0,0 +1,144 @@
+package fetcher
+
+import (
+	"context"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+)
+
+// flagLabels returns the user labels (IMAP keywords) among a message's flags.
+func flagLabels(flags []imap.Flag) []string {
+	keywords := make([]string, len(flags))
+	for i, f := range flags {
+		keywords[i] = string(f)
+	}
+	return backend.LabelsFromKeywords(keywords)
+}
+
+// isGmail reports whether the account talks to Gmail, where labels are
+// mailboxes rather than keywords.
+func isGmail(account *config.Account) bool {
+	return strings.EqualFold(account.ServiceProvider, "gmail")
+}
+
+// AddLabelInMailbox attaches a label to a message. On IMAP the label is
+// stored as a keyword. Gmail exposes labels as mailboxes, so there the
+// message is copied into the label's mailbox instead, creating it on first
+// use.
+func AddLabelInMailbox(account *config.Account, mailbox string, uid uint32, label string) error {
+	if err := backend.CheckLabel(label); err != nil {
+		return err
+	}
+	if hasBackendProvider(account) {
+		p, err := newBackendProvider(account)
+		if err != nil {
+			return err
+		}
+		defer p.Close() //nolint:errcheck
+		return p.AddLabel(context.Background(), mailbox, uid, label)
+	}
+	if isGmail(account) {
+		return addGmailLabel(account, mailbox, uid, label)
+	}
+	return storeFlag(account, mailbox, uid, imap.StoreFlagsAdd, imap.Flag(label))
+}
+
+// RemoveLabelInMailbox detaches a label from a message. On Gmail the message
+// is expunged from the label's mailbox, which drops the label without
+// touching the other copies or other messages marked \Deleted there.
+func RemoveLabelInMailbox(account *config.Account, mailbox string, uid uint32, label string) error {
+	if err := backend.CheckLabel(label); err != nil {
+		return err
+	}
+	if hasBackendProvider(account) {
+		p, err := newBackendProvider(account)
+		if err != nil {
+			return err
+		}
+		defer p.Close() //nolint:errcheck
+		return p.RemoveLabel(context.Background(), mailbox, uid, label)
+	}
+	if isGmail(account) {
+		return removeGmailLabel(account, mailbox, uid, label)
+	}
+	return storeFlag(account, mailbox, uid, imap.StoreFlagsDel, imap.Flag(label))
+}
+
+func addGmailLabel(account *config.Account, mailbox string, uid uint32, label string) error {
+	c, err := connect(account)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	if err := ensureMailbox(c.Client, label); err != nil {
+		return err
+	}
+	if err := c.useMailbox(mailbox); err != nil {
+		return err
+	}
+	_, err = c.Copy(imap.UIDSetNum(imap.UID(uid)), label).Wait()
+	return err
+}
+
+func removeGmailLabel(account *config.Account, mailbox string, uid uint32, label string) error {
+	c, err := connect(account)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	// The message has a different UID in the label's mailbox, so find it
+	// there by Message-ID.
+	if err := c.useMailbox(mailbox); err != nil {
+		return err
+	}
+	msgs, err := c.Fetch(imap.UIDSetNum(imap.UID(uid)), &imap.FetchOptions{Envelope: true}).Collect()
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 || msgs[0].Envelope == nil || msgs[0].Envelope.MessageID == "" {
+		return nil
+	}
+
+	if err := c.useMailbox(label); err != nil {
+		return err
+	}
+	searchData, err := c.UIDSearch(&imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "Message-ID", Value: msgs[0].Envelope.MessageID}},
+	}, nil).Wait()
+	if err != nil {
+		return err
+	}
+	uids := searchData.AllUIDs()
+	if len(uids) == 0 {
+		return nil
+	}
+
+	if err := c.Store(imap.UIDSetNum(uids...), &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}, nil).Close(); err != nil {
+		return err
+	}
+	// Only expunge these messages; others may be marked \Deleted on
+	// purpose. Gmail supports UIDPLUS.
+	return c.UIDExpunge(imap.UIDSetNum(uids...)).Close()
+}
+
+// ensureMailbox creates name unless the server already lists it.
+func ensureMailbox(c *imapclient.Client, name string) error {
+	mailboxes, err := c.List("", name, nil).Collect()
+	if err != nil {
+		return err
+	}
+	if len(mailboxes) > 0 {
+		return nil
+	}
+	return c.Create(name, nil).Wait()
+}
@@ -0,0 +1,206 @@
+package fetcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// notifyTag tags the NOTIFY command.
+const notifyTag = "N1"
+
+// notifyTimeout is how long to wait for the server to accept NOTIFY.
+const notifyTimeout = 30 * time.Second
+
+// errNotifyUnsupported is returned when NOTIFY cannot be used to watch an
+// account's folders, so that one IDLE connection per folder is used instead.
+var errNotifyUnsupported = errors.New("NOTIFY not supported")
+
+// parseStatus parses the rest of a STATUS response after "* STATUS ". A
+// mailbox name sent as a literal is not supported.
+func parseStatus(s string) (mailbox string, messages, uidNext uint32, ok bool) {
+	s = strings.TrimRight(s, "\r\n")
+	if strings.HasPrefix(s, `"`) {
+		var b strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return "", 0, 0, false
+		}
+		mailbox, s = b.String(), s[i+1:]
+	} else {
+		var found bool
+		mailbox, s, found = strings.Cut(s, " ")
+		if !found || strings.HasPrefix(mailbox, "{") {
+			return "", 0, 0, false
+		}
+	}
+
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return "", 0, 0, false
+	}
+	fields := strings.Fields(s[1 : len(s)-1])
+	for i := 0; i+1 < len(fields); i += 2 {
+		n, err := strconv.ParseUint(fields[i+1], 10, 32)
+		if err != nil {
+			continue
+		}
+		switch strings.ToUpper(fields[i]) {
+		case "MESSAGES":
+			messages = uint32(n)
+		case "UIDNEXT":
+			uidNext = uint32(n)
+		}
+	}
+	return mailbox, messages, uidNext, true
+}
+
+// notifySet asks the server to report new and expunged messages in folders,
+// starting with the current status of each. It must be called while
+// imapclient has no command in progress.
+func notifySet(c *wireConn, folders []string) error {
+	names := make([]string, len(folders))
+	for i, folder := range folders {
+		names[i] = quoteMailbox(folder)
+	}
+	cmd := fmt.Sprintf("NOTIFY SET STATUS (mailboxes (%s) (MessageNew MessageExpunge))", strings.Join(names, " "))
+	status, err := c.command(&wireCommand{tag: notifyTag}, cmd, notifyTimeout)
+	if err != nil {
+		return fmt.Errorf("NOTIFY: %w", err)
+	}
+	if !strings.HasPrefix(status, "OK") {
+		return fmt.Errorf("%w: %s", errNotifyUnsupported, status)
+	}
+	return nil
+}
+
+// statusObserver returns a wireConn observer that calls status for each
+// STATUS response.
+func statusObserver(status func(mailbox string, messages, uidNext uint32)) func(line []byte) {
+	return func(line []byte) {
+		if rest, ok := bytes.CutPrefix(line, []byte("* STATUS ")); ok {
+			if mailbox, messages, uidNext, ok := parseStatus(string(rest)); ok {
+				status(mailbox, messages, uidNext)
+			}
+		}
+	}
+}
+
+// quoteMailbox quotes an ASCII mailbox name.
+func quoteMailbox(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// asciiMailbox reports whether name can be sent as a quoted string without
+// encoding it in modified UTF-7.
+func asciiMailbox(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// sameMailbox compares mailbox names, treating INBOX case-insensitively.
+func sameMailbox(a, b string) bool {
+	return a == b || strings.EqualFold(a, "INBOX") && strings.EqualFold(b, "INBOX")
+}
+
+// notifyOnce watches all of the account's folders over one connection with
+// NOTIFY, until an error or stop. It returns nil if stopped cleanly, and an
+// error wrapping errNotifyUnsupported if NOTIFY cannot be used.
+func (a *accountIdle) notifyOnce() error {
+	for _, folder := range a.folders {
+		if !asciiMailbox(folder) {
+			return fmt.Errorf("%w for folder name %q", errNotifyUnsupported, folder)
+		}
+	}
+
+	type counts struct{ messages, uidNext uint32 }
+	last := make(map[string]counts) // used only on the reading goroutine
+	changed := make(chan string, 32)
+	status := func(mailbox string, messages, uidNext uint32) {
+		for _, folder := range a.folders {
+			if !sameMailbox(mailbox, folder) {
+				continue
+			}
+			prev, seen := last[folder]
+			last[folder] = counts{messages, uidNext}
+			if !seen {
+				return
+			}
+			if uidNext > prev.uidNext || uidNext == 0 && messages > prev.messages {
+				// Non-blocking for the same reason as in idleOnce.
+				select {
+				case changed <- folder:
+				default:
+				}
+			}
+			return
+		}
+	}
+
+	var wc *wireConn
+	c, err := connectWrapped(a.account, nil, func(conn net.Conn) net.Conn {
+		wc = newWireConn(conn, statusObserver(status))
+		return wc
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	if wc == nil || !c.Caps().Has(imap.CapNotify) {
+		return errNotifyUnsupported
+	}
+	if err := notifySet(wc, a.folders); err != nil {
+		return err
+	}
+
+	// NOTIFY responses arrive at any time, but IDLE keeps the connection
+	// from being logged out for inactivity.
+	idleCmd, err := c.Idle()
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-a.stop:
+			idleCmd.Close() //nolint:errcheck,gosec
+			idleCmd.Wait()  //nolint:errcheck,gosec
+			return nil
+
+		case folder := <-changed:
+			select {
+			case a.notify <- IdleUpdate{
+				AccountID:  a.account.ID,
+				FolderName: folder,
+			}:
+			case <-a.stop:
+				idleCmd.Close() //nolint:errcheck,gosec
+				idleCmd.Wait()  //nolint:errcheck,gosec
+				return nil
+			}
+
+		case <-c.Closed():
+			if err := idleCmd.Close(); err != nil {
+				return err
+			}
+			return idleCmd.Wait()
+		}
+	}
+}
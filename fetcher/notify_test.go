@@ -0,0 +1,101 @@
+package fetcher
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestNotifySet(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+
+	type status struct {
+		mailbox           string
+		messages, uidNext uint32
+	}
+	var got []status
+	wc := newWireConn(client, statusObserver(func(mailbox string, messages, uidNext uint32) {
+		got = append(got, status{mailbox, messages, uidNext})
+	}))
+
+	stream := "* STATUS INBOX (MESSAGES 3 UIDNEXT 4)\r\n" +
+		"* 1 FETCH (BODY[] {12}\r\nN1 OK fake\r\n)\r\n" +
+		"N1 OK NOTIFY completed\r\n" +
+		"* STATUS \"Sent \\\"Mail\\\"\" (UIDNEXT 9 MESSAGES 8)\r\n"
+	sent := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(server).ReadString('\n')
+		sent <- line
+		server.Write([]byte(stream)) //nolint:errcheck
+		server.Close()               //nolint:errcheck
+	}()
+	passed := make(chan string, 1)
+	go func() {
+		b, _ := io.ReadAll(wc)
+		passed <- string(b)
+	}()
+
+	if err := notifySet(wc, []string{"INBOX", `Sent "Mail"`}); err != nil {
+		t.Errorf("notifySet = %v, want nil", err)
+	}
+	if cmd := <-sent; cmd != `N1 NOTIFY SET STATUS (mailboxes ("INBOX" "Sent \"Mail\"") (MessageNew MessageExpunge))`+"\r\n" {
+		t.Errorf("sent %q", cmd)
+	}
+	want := "* STATUS INBOX (MESSAGES 3 UIDNEXT 4)\r\n" +
+		"* 1 FETCH (BODY[] {12}\r\nN1 OK fake\r\n)\r\n" +
+		"* STATUS \"Sent \\\"Mail\\\"\" (UIDNEXT 9 MESSAGES 8)\r\n"
+	if got := <-passed; got != want {
+		t.Errorf("passed through:\n%q\nwant:\n%q", got, want)
+	}
+
+	wantStatus := []status{{"INBOX", 3, 4}, {`Sent "Mail"`, 8, 9}}
+	if len(got) != len(wantStatus) {
+		t.Fatalf("status responses = %+v, want %+v", got, wantStatus)
+	}
+	for i := range got {
+		if got[i] != wantStatus[i] {
+			t.Errorf("status %d = %+v, want %+v", i, got[i], wantStatus[i])
+		}
+	}
+}
+
+func TestNotifySetRejected(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+
+	wc := newWireConn(client, nil)
+	go func() {
+		bufio.NewReader(server).ReadString('\n')           //nolint:errcheck
+		server.Write([]byte("N1 BAD Unknown command\r\n")) //nolint:errcheck
+		server.Close()                                     //nolint:errcheck
+	}()
+	go io.ReadAll(wc) //nolint:errcheck
+
+	if err := notifySet(wc, []string{"INBOX"}); !errors.Is(err, errNotifyUnsupported) {
+		t.Errorf("notifySet = %v, want errNotifyUnsupported", err)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		in                string
+		mailbox           string
+		messages, uidNext uint32
+		ok                bool
+	}{
+		{"INBOX (MESSAGES 12 UIDNEXT 40)\r\n", "INBOX", 12, 40, true},
+		{`"Archive 2024" (UIDNEXT 7)`, "Archive 2024", 0, 7, true},
+		{"{5}", "", 0, 0, false},
+		{"INBOX", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		mailbox, messages, uidNext, ok := parseStatus(tt.in)
+		if mailbox != tt.mailbox || messages != tt.messages || uidNext != tt.uidNext || ok != tt.ok {
+			t.Errorf("parseStatus(%q) = %q, %d, %d, %v; want %q, %d, %d, %v",
+				tt.in, mailbox, messages, uidNext, ok, tt.mailbox, tt.messages, tt.uidNext, tt.ok)
+		}
+	}
+}
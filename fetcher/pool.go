@@ -0,0 +1,292 @@
+package fetcher
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/floatpane/matcha/config"
+)
+
+const (
+	// PoolMaxIdle is how many idle sessions are kept per account.
+	PoolMaxIdle = 2
+	// PoolIdleTimeout is how long an unused session is kept before it is
+	// logged out. Servers must allow at least 30 minutes (RFC 9051), so
+	// this stays well clear of their autologout timers.
+	PoolIdleTimeout = 5 * time.Minute
+	// PoolHealthCheckAfter is how long a session may sit idle before it is
+	// checked with NOOP on its next use.
+	PoolHealthCheckAfter = 30 * time.Second
+)
+
+// Pool keeps authenticated IMAP sessions so that consecutive operations on
+// an account reuse one connection instead of dialing and logging in each
+// time. Sessions are handed out to one caller at a time; concurrent callers
+// get separate sessions.
+type Pool struct {
+	dial        func(*config.Account) (*imapclient.Client, *wireConn, error)
+	maxIdle     int
+	idleTimeout time.Duration
+	checkAfter  time.Duration
+
+	mu     sync.Mutex
+	idle   map[string][]*session // most recently used last
+	reaper *time.Timer
+	closed bool
+}
+
+// NewPool returns a pool that dials accounts with their configured server
+// settings.
+func NewPool() *Pool {
+	return newPool(dialSession)
+}
+
+func newPool(dial func(*config.Account) (*imapclient.Client, *wireConn, error)) *Pool {
+	return &Pool{
+		dial:        dial,
+		maxIdle:     PoolMaxIdle,
+		idleTimeout: PoolIdleTimeout,
+		checkAfter:  PoolHealthCheckAfter,
+		idle:        make(map[string][]*session),
+	}
+}
+
+// defaultPool serves every IMAP operation in this package, for the TUI,
+// backend/imap.Provider and the daemon alike.
+var defaultPool = NewPool()
+
+// ClosePool logs out of the idle pooled sessions. Call it on exit.
+func ClosePool() {
+	defaultPool.Close()
+}
+
+// dialSession connects and logs in to account for the pool. The connection
+// is wrapped in a wireConn so that commands imapclient does not support can
+// be sent on the session; STARTTLS connections cannot be wrapped and get
+// none.
+func dialSession(account *config.Account) (*imapclient.Client, *wireConn, error) {
+	var wc *wireConn
+	c, err := connectWrapped(account, nil, func(conn net.Conn) net.Conn {
+		wc = newWireConn(conn, nil)
+		return wc
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Gmail sends labels with non-ASCII names in UTF-8 rather than modified
+	// UTF-7 once UTF8=ACCEPT is enabled, which must be done before a
+	// mailbox is selected.
+	if isGmail(account) && c.Caps().Has(imap.CapUTF8Accept) {
+		if _, err := c.Enable(imap.CapUTF8Accept).Wait(); err != nil {
+			c.Close() //nolint:errcheck,gosec
+			return nil, nil, err
+		}
+	}
+	return c, wc, nil
+}
+
+// session is a pooled IMAP connection. It embeds the client, so it is used
+// like one; Close returns it to the pool instead of disconnecting.
+type session struct {
+	*imapclient.Client
+	pool     *Pool
+	key      string
+	lastUsed time.Time
+	// selected is the mailbox this session last selected read-write, or ""
+	// if that is unknown.
+	selected string
+	// wire sends commands imapclient does not support. It is nil for
+	// STARTTLS connections.
+	wire *wireConn
+}
+
+func poolKey(account *config.Account) string {
+	return fmt.Sprintf("%s|%s|%s:%d", account.ID, account.Email, account.GetIMAPServer(), account.GetIMAPPort())
+}
+
+// Get returns an authenticated session for account, reusing an idle one
+// when it is still healthy.
+func (p *Pool) Get(account *config.Account) (*session, error) {
+	key := poolKey(account)
+	for {
+		s := p.takeIdle(key)
+		if s == nil {
+			break
+		}
+		if p.healthy(s) {
+			return s, nil
+		}
+		s.Client.Close() //nolint:errcheck,gosec
+	}
+
+	c, wire, err := p.dial(account)
+	if err != nil {
+		return nil, err
+	}
+	return &session{Client: c, pool: p, key: key, wire: wire}, nil
+}
+
+// takeIdle removes and returns the most recently used idle session for key.
+func (p *Pool) takeIdle(key string) *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := p.idle[key]
+	if len(list) == 0 {
+		return nil
+	}
+	s := list[len(list)-1]
+	p.idle[key] = list[:len(list)-1]
+	return s
+}
+
+// healthy reports whether an idle session can be reused, sending a NOOP if
+// it has been idle for a while.
+func (p *Pool) healthy(s *session) bool {
+	select {
+	case <-s.Client.Closed():
+		return false
+	default:
+	}
+	idle := time.Since(s.lastUsed)
+	if idle > p.idleTimeout {
+		return false
+	}
+	if idle > p.checkAfter {
+		if err := s.Noop().Wait(); err != nil {
+			log.Printf("imap: pooled session failed health check: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
+// put returns a session to the pool, or logs it out if the pool is full or
+// closed.
+func (p *Pool) put(s *session) {
+	select {
+	case <-s.Client.Closed():
+		return
+	default:
+	}
+
+	s.lastUsed = time.Now()
+	p.mu.Lock()
+	if p.closed || len(p.idle[s.key]) >= p.maxIdle {
+		p.mu.Unlock()
+		go logout(s.Client)
+		return
+	}
+	p.idle[s.key] = append(p.idle[s.key], s)
+	if p.reaper == nil {
+		p.reaper = time.AfterFunc(p.idleTimeout, p.reap)
+	}
+	p.mu.Unlock()
+}
+
+// reap logs out sessions that have been idle longer than the idle timeout.
+func (p *Pool) reap() {
+	var expired []*session
+	p.mu.Lock()
+	p.reaper = nil
+	next := time.Duration(0)
+	for key, list := range p.idle {
+		kept := list[:0]
+		for _, s := range list {
+			age := time.Since(s.lastUsed)
+			if age >= p.idleTimeout {
+				expired = append(expired, s)
+				continue
+			}
+			kept = append(kept, s)
+			if wait := p.idleTimeout - age; next == 0 || wait < next {
+				next = wait
+			}
+		}
+		if len(kept) == 0 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = kept
+		}
+	}
+	if next > 0 && !p.closed {
+		p.reaper = time.AfterFunc(next, p.reap)
+	}
+	p.mu.Unlock()
+
+	for _, s := range expired {
+		logout(s.Client)
+	}
+}
+
+// Close logs out of all idle sessions. Sessions in use are logged out when
+// they are returned.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	if p.reaper != nil {
+		p.reaper.Stop()
+		p.reaper = nil
+	}
+	idle := p.idle
+	p.idle = make(map[string][]*session)
+	p.mu.Unlock()
+
+	for _, list := range idle {
+		for _, s := range list {
+			logout(s.Client)
+		}
+	}
+}
+
+// idleCount returns the number of idle sessions across all accounts.
+func (p *Pool) idleCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, list := range p.idle {
+		n += len(list)
+	}
+	return n
+}
+
+func logout(c *imapclient.Client) {
+	c.Logout().Wait() //nolint:errcheck,gosec
+	c.Close()         //nolint:errcheck,gosec
+}
+
+// Close returns the session to its pool.
+func (s *session) Close() error {
+	s.pool.put(s)
+	return nil
+}
+
+// selectMailbox selects mailbox and returns the server's data about it.
+// options may be nil.
+func (s *session) selectMailbox(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	s.selected = ""
+	data, err := s.Select(mailbox, options).Wait()
+	if err != nil {
+		return nil, err
+	}
+	if options == nil || !options.ReadOnly {
+		s.selected = mailbox
+	}
+	return data, nil
+}
+
+// useMailbox makes mailbox the selected mailbox, skipping the SELECT if the
+// session already has it selected read-write.
+func (s *session) useMailbox(mailbox string) error {
+	if s.selected == mailbox {
+		if mbox := s.Mailbox(); mbox != nil && mbox.Name == mailbox {
+			return nil
+		}
+	}
+	_, err := s.selectMailbox(mailbox, nil)
+	return err
+}
@@ -0,0 +1,194 @@
+package fetcher
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+	"github.com/floatpane/matcha/config"
+)
+
+// countingSession counts the LOGIN and SELECT commands a client sends.
+type countingSession struct {
+	imapserver.SessionIMAP4rev2
+	logins, selects *atomic.Int32
+}
+
+func (s *countingSession) Login(username, password string) error {
+	s.logins.Add(1)
+	return s.SessionIMAP4rev2.Login(username, password)
+}
+
+func (s *countingSession) Select(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	s.selects.Add(1)
+	return s.SessionIMAP4rev2.Select(mailbox, options)
+}
+
+type literal struct{ *strings.Reader }
+
+func (l literal) Size() int64 { return int64(l.Len()) }
+
+// startPoolIMAPServer serves an in-memory mailbox with n messages in INBOX
+// over TLS, and installs a fresh default pool for the test.
+func startPoolIMAPServer(t *testing.T, n int) (*config.Account, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+
+	user := imapmemserver.NewUser("user@example.com", "secret")
+	for _, name := range []string{"INBOX", defaultArchiveMailbox} {
+		if err := user.Create(name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		msg := "From: a@example.com\r\nTo: user@example.com\r\nSubject: test\r\n\r\nhello\r\n"
+		if _, err := user.Append("INBOX", literal{strings.NewReader(msg)}, &imap.AppendOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mem := imapmemserver.New()
+	mem.AddUser(user)
+
+	var logins, selects atomic.Int32
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := mem.NewSession().(imapserver.SessionIMAP4rev2)
+			return &countingSession{SessionIMAP4rev2: sess, logins: &logins, selects: &selects}, nil, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{newTestTLSCertificate(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener) //nolint:errcheck
+	t.Cleanup(func() { server.Close() })
+
+	old := defaultPool
+	defaultPool = NewPool()
+	t.Cleanup(func() {
+		defaultPool.Close()
+		defaultPool = old
+	})
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return &config.Account{
+		ID:              "pool-test",
+		Email:           "user@example.com",
+		Password:        "secret",
+		ServiceProvider: config.ProviderCustom,
+		IMAPServer:      "127.0.0.1",
+		IMAPPort:        addr.Port,
+		Insecure:        true,
+		SC:              &config.SessionCache{},
+	}, &logins, &selects
+}
+
+func TestPoolReusesSessions(t *testing.T) {
+	account, logins, selects := startPoolIMAPServer(t, 10)
+
+	for uid := uint32(1); uid <= 10; uid++ {
+		if err := ArchiveEmailFromMailbox(account, "INBOX", uid); err != nil {
+			t.Fatalf("archive %d: %v", uid, err)
+		}
+	}
+	if got := logins.Load(); got != 1 {
+		t.Errorf("archiving ten messages logged in %d times, want 1", got)
+	}
+	if got := selects.Load(); got != 1 {
+		t.Errorf("archiving ten messages selected INBOX %d times, want 1", got)
+	}
+
+	emails, err := FetchMailboxEmails(account, defaultArchiveMailbox, 50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 10 {
+		t.Errorf("archive has %d emails, want 10", len(emails))
+	}
+	if got := logins.Load(); got != 1 {
+		t.Errorf("logged in %d times after fetching, want 1", got)
+	}
+}
+
+func TestPoolReplacesDeadSessions(t *testing.T) {
+	account, logins, _ := startPoolIMAPServer(t, 1)
+
+	mark := func() {
+		t.Helper()
+		if err := MarkEmailAsReadInMailbox(account, "INBOX", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mark()
+
+	// A session whose connection dropped is not handed out again.
+	s := defaultPool.takeIdle(poolKey(account))
+	s.Client.Close() //nolint:errcheck
+	defaultPool.put(s)
+	mark()
+	if got := logins.Load(); got != 2 {
+		t.Errorf("logins after a dropped connection = %d, want 2", got)
+	}
+
+	// Sessions idle past the health check threshold are checked with NOOP
+	// and reused.
+	defaultPool.checkAfter = 0
+	mark()
+	if got := logins.Load(); got != 2 {
+		t.Errorf("logins after a health check = %d, want 2", got)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	account, logins, _ := startPoolIMAPServer(t, 1)
+	defaultPool.idleTimeout = 20 * time.Millisecond
+
+	if err := MarkEmailAsReadInMailbox(account, "INBOX", 1); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for defaultPool.idleCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := defaultPool.idleCount(); n != 0 {
+		t.Fatalf("%d sessions still idle after the idle timeout", n)
+	}
+
+	if err := MarkEmailAsReadInMailbox(account, "INBOX", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := logins.Load(); got != 2 {
+		t.Errorf("logins after the idle timeout = %d, want 2", got)
+	}
+}
+
+func TestPoolConcurrentSessions(t *testing.T) {
+	account, logins, _ := startPoolIMAPServer(t, 0)
+
+	var sessions []*session
+	for i := 0; i < PoolMaxIdle+1; i++ {
+		s, err := defaultPool.Get(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, s)
+	}
+	if got := int(logins.Load()); got != PoolMaxIdle+1 {
+		t.Errorf("sessions in use at once = %d logins, want %d", got, PoolMaxIdle+1)
+	}
+	for _, s := range sessions {
+		s.Close() //nolint:errcheck
+	}
+	if n := defaultPool.idleCount(); n != PoolMaxIdle {
+		t.Errorf("pool keeps %d idle sessions, want %d", n, PoolMaxIdle)
+	}
+}
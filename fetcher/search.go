@@ -31,7 +31,7 @@ func SearchMailbox(account *config.Account, folder string, query backend.SearchQ
 	}
 	defer c.Close() //nolint:errcheck
 
-	if _, err := c.Select(folder, nil).Wait(); err != nil {
+	if err := c.useMailbox(folder); err != nil {
 		return nil, err
 	}
 
@@ -85,6 +85,8 @@ func SearchMailbox(account *config.Account, folder string, query backend.SearchQ
 			Subject:   decodeHeader(msg.Envelope.Subject),
 			Date:      msg.Envelope.Date,
 			IsRead:    hasSeenFlag(msg.Flags),
+			IsFlagged: hasFlaggedFlag(msg.Flags),
+			Labels:    flagLabels(msg.Flags),
 			MessageID: msg.Envelope.MessageID,
 			AccountID: account.ID,
 		}
@@ -111,28 +113,85 @@ func SearchMailbox(account *config.Account, folder string, query backend.SearchQ
 
 func buildSearchCriteria(query backend.SearchQuery) *imap.SearchCriteria {
 	criteria := &imap.SearchCriteria{}
-	if query.From != "" {
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "From", Value: query.From})
+	if expr := query.Expression(); expr != nil {
+		andCriteria(criteria, exprCriteria(expr))
 	}
-	if query.To != "" {
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "To", Value: query.To})
-	}
-	if query.Subject != "" {
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "Subject", Value: query.Subject})
-	}
-	if query.Body != "" {
-		criteria.Body = []string{query.Body}
+	return criteria
+}
+
+// exprCriteria translates a search expression into IMAP SEARCH criteria.
+func exprCriteria(e *backend.SearchExpr) *imap.SearchCriteria {
+	c := &imap.SearchCriteria{}
+	switch e.Op {
+	case backend.SearchAnd:
+		for _, child := range e.Children {
+			andCriteria(c, exprCriteria(child))
+		}
+		return c
+	case backend.SearchOr:
+		// IMAP OR takes two keys; longer chains nest.
+		acc := exprCriteria(e.Children[0])
+		for _, child := range e.Children[1:] {
+			acc = &imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{*acc, *exprCriteria(child)}}}
+		}
+		return acc
+	case backend.SearchNot:
+		c.Not = append(c.Not, *exprCriteria(e.Children[0]))
+		return c
 	}
-	if !query.Since.IsZero() {
-		criteria.Since = query.Since
+
+	switch e.Field {
+	case backend.SearchFrom:
+		c.Header = append(c.Header, imap.SearchCriteriaHeaderField{Key: "From", Value: e.Text})
+	case backend.SearchTo:
+		c.Header = append(c.Header, imap.SearchCriteriaHeaderField{Key: "To", Value: e.Text})
+	case backend.SearchCc:
+		c.Header = append(c.Header, imap.SearchCriteriaHeaderField{Key: "Cc", Value: e.Text})
+	case backend.SearchSubject:
+		c.Header = append(c.Header, imap.SearchCriteriaHeaderField{Key: "Subject", Value: e.Text})
+	case backend.SearchBody:
+		c.Body = append(c.Body, e.Text)
+	case backend.SearchSince:
+		c.Since = e.Time
+	case backend.SearchBefore:
+		c.Before = e.Time
+	case backend.SearchLarger:
+		c.Larger = int64(e.Size)
+	case backend.SearchSmaller:
+		c.Smaller = int64(e.Size)
+	case backend.SearchFlagged:
+		flagCriteria(c, imap.FlagFlagged, e.Bool)
+	case backend.SearchRead:
+		flagCriteria(c, imap.FlagSeen, e.Bool)
+	case backend.SearchAttachment:
+		// IMAP has no attachment key; mail with attachments is sent as
+		// multipart/mixed.
+		mixed := imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{{Key: "Content-Type", Value: "multipart/mixed"}}}
+		if e.Bool {
+			andCriteria(c, &mixed)
+		} else {
+			c.Not = append(c.Not, mixed)
+		}
 	}
-	if !query.Before.IsZero() {
-		criteria.Before = query.Before
+	return c
+}
+
+func flagCriteria(c *imap.SearchCriteria, flag imap.Flag, set bool) {
+	if set {
+		c.Flag = append(c.Flag, flag)
+	} else {
+		c.NotFlag = append(c.NotFlag, flag)
 	}
-	if query.LargerThan > 0 {
-		criteria.Larger = int64(query.LargerThan)
+}
+
+// andCriteria merges other into c. SearchCriteria.And treats a missing
+// SMALLER as zero and would drop c's, so it is carried over.
+func andCriteria(c, other *imap.SearchCriteria) {
+	smaller := c.Smaller
+	c.And(other)
+	if other.Smaller == 0 {
+		c.Smaller = smaller
 	}
-	return criteria
 }
 
 func searchLimit(query backend.SearchQuery) uint32 {
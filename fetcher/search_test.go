@@ -1,10 +1,14 @@
 package fetcher
 
 import (
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/emersion/go-imap/v2"
 	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/backend/searchtest"
 )
 
 func TestBuildSearchCriteria(t *testing.T) {
@@ -25,3 +29,108 @@ func TestBuildSearchCriteria(t *testing.T) {
 		t.Fatal("unexpected search limit")
 	}
 }
+
+func TestBuildSearchCriteriaFlagged(t *testing.T) {
+	yes, no := true, false
+	if c := buildSearchCriteria(backend.SearchQuery{Flagged: &yes}); len(c.Flag) != 1 || c.Flag[0] != imap.FlagFlagged {
+		t.Fatalf("flagged:yes criteria = %+v", c)
+	}
+	if c := buildSearchCriteria(backend.SearchQuery{Flagged: &no}); len(c.NotFlag) != 1 || c.NotFlag[0] != imap.FlagFlagged {
+		t.Fatalf("flagged:no criteria = %+v", c)
+	}
+}
+
+// matchCriteria evaluates IMAP SEARCH criteria against a sample message the
+// way a server would, for the keys buildSearchCriteria produces.
+func matchCriteria(c *imap.SearchCriteria, m searchtest.Message) bool {
+	containsFold := func(haystack, needle string) bool {
+		return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
+	}
+	day := func(t time.Time) time.Time { return t.UTC().Truncate(24 * time.Hour) }
+
+	for _, h := range c.Header {
+		var value string
+		switch h.Key {
+		case "From":
+			value = m.From
+		case "To":
+			value = strings.Join(m.To, ", ")
+		case "Cc":
+			value = strings.Join(m.Cc, ", ")
+		case "Subject":
+			value = m.Subject
+		case "Content-Type":
+			value = "text/plain"
+			if m.HasAttachment {
+				value = "multipart/mixed"
+			}
+		}
+		if !containsFold(value, h.Value) {
+			return false
+		}
+	}
+	for _, b := range c.Body {
+		if !containsFold(m.Body, b) {
+			return false
+		}
+	}
+	if !c.Since.IsZero() && day(m.Date).Before(day(c.Since)) {
+		return false
+	}
+	if !c.Before.IsZero() && !day(m.Date).Before(day(c.Before)) {
+		return false
+	}
+	if c.Larger > 0 && int64(m.Size()) <= c.Larger {
+		return false
+	}
+	if c.Smaller > 0 && int64(m.Size()) >= c.Smaller {
+		return false
+	}
+	hasFlag := func(f imap.Flag) bool {
+		return (f == imap.FlagSeen && m.Read) || (f == imap.FlagFlagged && m.Flagged)
+	}
+	for _, f := range c.Flag {
+		if !hasFlag(f) {
+			return false
+		}
+	}
+	for _, f := range c.NotFlag {
+		if hasFlag(f) {
+			return false
+		}
+	}
+	for i := range c.Not {
+		if matchCriteria(&c.Not[i], m) {
+			return false
+		}
+	}
+	for _, or := range c.Or {
+		if !matchCriteria(&or[0], m) && !matchCriteria(&or[1], m) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBuildSearchCriteriaSharedCases(t *testing.T) {
+	messages := searchtest.Messages()
+	for _, tc := range searchtest.Cases {
+		criteria := buildSearchCriteria(backend.ParseSearchQuery(tc.Query))
+		var got []string
+		for _, m := range messages {
+			if matchCriteria(criteria, m) {
+				got = append(got, m.ID)
+			}
+		}
+		if !slices.Equal(got, tc.Want) {
+			t.Errorf("%q matched %v, want %v", tc.Query, got, tc.Want)
+		}
+	}
+}
+
+func TestBuildSearchCriteriaKeepsSmallerAcrossTerms(t *testing.T) {
+	c := buildSearchCriteria(backend.ParseSearchQuery("smaller:100 from:alice"))
+	if c.Smaller != 100 {
+		t.Errorf("Smaller = %d, want 100", c.Smaller)
+	}
+}
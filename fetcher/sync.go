@@ -0,0 +1,226 @@
+package fetcher
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/floatpane/matcha/config"
+)
+
+// FlagUpdate is the new flag state of a cached message that changed on the
+// server since the last sync.
+type FlagUpdate struct {
+	UID       uint32
+	IsRead    bool
+	IsFlagged bool
+	Labels    []string
+}
+
+// SyncResult is what SyncMailboxEmails found on the server.
+type SyncResult struct {
+	// Full is set when the previous state could not be resumed from, e.g.
+	// after a UIDVALIDITY change. Emails then replaces the cached emails
+	// outright and Updates and Vanished are empty.
+	Full bool
+	// Emails are the new messages, newest first, followed by older ones
+	// fetched to refill the window after cached messages were expunged.
+	Emails []Email
+	// Updates are flag changes on cached messages.
+	Updates []FlagUpdate
+	// Vanished are cached UIDs that have been expunged.
+	Vanished []uint32
+	// State is the folder state to resume from next time.
+	State config.FolderSyncState
+}
+
+// SyncMailboxEmails brings a cached copy of a mailbox up to date. state is
+// the value State had after the previous sync and known the UIDs currently
+// cached for the account.
+//
+// When the UIDVALIDITY is unchanged and the server supports CONDSTORE, only
+// the delta is fetched: envelopes of messages above the old UIDNEXT, flags
+// of cached messages changed since the old HIGHESTMODSEQ, and a UID SEARCH
+// over the cached range to spot expunges. go-imap cannot parse QRESYNC's
+// VANISHED responses, hence the search. When expunges leave fewer than limit
+// emails, the newest messages below the cached range are fetched to make up
+// the difference. Otherwise the newest limit emails are fetched as
+// FetchMailboxEmails would.
+func SyncMailboxEmails(account *config.Account, mailbox string, state config.FolderSyncState, known []uint32, limit uint32) (*SyncResult, error) {
+	if hasBackendProvider(account) {
+		emails, err := FetchMailboxEmails(account, mailbox, limit, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &SyncResult{Full: true, Emails: emails}, nil
+	}
+
+	c, err := connect(account)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close() //nolint:errcheck
+
+	condStore := c.Caps().Has(imap.CapCondStore)
+	selectData, err := c.selectMailbox(mailbox, &imap.SelectOptions{CondStore: condStore})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{State: config.FolderSyncState{
+		UIDValidity:   selectData.UIDValidity,
+		UIDNext:       uint32(selectData.UIDNext),
+		HighestModSeq: selectData.HighestModSeq,
+	}}
+	if !condStore {
+		res.State.HighestModSeq = 0
+	}
+
+	if !canResumeSync(state, res.State, known) {
+		res.Full = true
+		res.Emails, err = fetchSelectedEmails(c.Client, account, mailbox, selectData, limit, 0)
+		if err != nil {
+			return nil, err
+		}
+		addGmailLabels(c, account, mailbox, res.Emails)
+		return res, nil
+	}
+
+	window := imap.UIDSet{imap.UIDRange{
+		Start: imap.UID(slices.Min(known)),
+		Stop:  imap.UID(slices.Max(known)),
+	}}
+
+	// Flag changes on cached messages.
+	if res.State.HighestModSeq > state.HighestModSeq {
+		msgs, err := c.Fetch(window, &imap.FetchOptions{
+			UID:          true,
+			Flags:        true,
+			ChangedSince: state.HighestModSeq,
+		}).Collect()
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			if !slices.Contains(known, uint32(msg.UID)) {
+				continue
+			}
+			res.Updates = append(res.Updates, FlagUpdate{
+				UID:       uint32(msg.UID),
+				IsRead:    hasSeenFlag(msg.Flags),
+				IsFlagged: hasFlaggedFlag(msg.Flags),
+				Labels:    flagLabels(msg.Flags),
+			})
+		}
+	}
+
+	// Expunged messages.
+	searchData, err := c.UIDSearch(&imap.SearchCriteria{UID: []imap.UIDSet{window}}, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[uint32]bool)
+	for _, uid := range searchData.AllUIDs() {
+		present[uint32(uid)] = true
+	}
+	for _, uid := range known {
+		if !present[uid] {
+			res.Vanished = append(res.Vanished, uid)
+		}
+	}
+
+	// New messages.
+	var m *envelopeMatcher
+	if res.State.UIDNext > state.UIDNext {
+		m = newEnvelopeMatcher(c.Client, account, mailbox)
+		newSet := imap.UIDSet{imap.UIDRange{Start: imap.UID(state.UIDNext), Stop: 0}}
+		msgs, err := c.Fetch(newSet, m.fetchOptions()).Collect()
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			// "n:*" always matches the last message, even below n.
+			if uint32(msg.UID) < state.UIDNext {
+				continue
+			}
+			if email, ok := m.email(msg); ok {
+				res.Emails = append(res.Emails, email)
+			}
+		}
+		sort.Slice(res.Emails, func(i, j int) bool {
+			return res.Emails[i].UID > res.Emails[j].UID
+		})
+		if len(res.Emails) > int(limit) {
+			res.Emails = res.Emails[:limit]
+		}
+	}
+
+	// Older messages, to refill the window after expunges.
+	kept := len(known) - len(res.Vanished) + len(res.Emails)
+	if len(res.Vanished) > 0 && kept < int(limit) && slices.Min(known) > 1 {
+		if m == nil {
+			m = newEnvelopeMatcher(c.Client, account, mailbox)
+		}
+		older, err := fetchEmailsBelow(c.Client, m, slices.Min(known), int(limit)-kept)
+		if err != nil {
+			return nil, err
+		}
+		res.Emails = append(res.Emails, older...)
+	}
+
+	if len(res.Emails) > 0 {
+		addGmailLabels(c, account, mailbox, res.Emails)
+	}
+	return res, nil
+}
+
+// fetchEmailsBelow returns up to n of the newest emails in the selected
+// mailbox with a UID below uid, newest first.
+func fetchEmailsBelow(c *imapclient.Client, m *envelopeMatcher, uid uint32, n int) ([]Email, error) {
+	below := imap.UIDSet{imap.UIDRange{Start: 1, Stop: imap.UID(uid - 1)}}
+	searchData, err := c.UIDSearch(&imap.SearchCriteria{UID: []imap.UIDSet{below}}, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+	uids := searchData.AllUIDs()
+	slices.Sort(uids)
+
+	// Messages that are not the account's are skipped, so keep going down
+	// until there are enough.
+	var emails []Email
+	for len(emails) < n && len(uids) > 0 {
+		batch := uids[max(0, len(uids)-n):]
+		uids = uids[:len(uids)-len(batch)]
+		msgs, err := c.Fetch(imap.UIDSetNum(batch...), m.fetchOptions()).Collect()
+		if err != nil {
+			return nil, err
+		}
+		var batchEmails []Email
+		for _, msg := range msgs {
+			if email, ok := m.email(msg); ok {
+				batchEmails = append(batchEmails, email)
+			}
+		}
+		sort.Slice(batchEmails, func(i, j int) bool {
+			return batchEmails[i].UID > batchEmails[j].UID
+		})
+		emails = append(emails, batchEmails...)
+	}
+	if len(emails) > n {
+		emails = emails[:n]
+	}
+	return emails, nil
+}
+
+// canResumeSync reports whether a delta sync from prev is possible: the UIDs
+// are still valid, both sides have a mod-sequence, and there is a cached
+// range to check against.
+func canResumeSync(prev, cur config.FolderSyncState, known []uint32) bool {
+	return prev.UIDValidity != 0 &&
+		prev.UIDValidity == cur.UIDValidity &&
+		prev.UIDNext != 0 &&
+		prev.HighestModSeq != 0 &&
+		cur.HighestModSeq != 0 &&
+		len(known) > 0
+}
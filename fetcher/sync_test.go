@@ -0,0 +1,221 @@
+package fetcher
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/floatpane/matcha/config"
+)
+
+// startSyncIMAPServer serves a single CONDSTORE-capable mailbox. respond is
+// called with the upper-cased command (without tag) and returns the untagged
+// lines to send before the tagged OK. Every command seen is recorded.
+func startSyncIMAPServer(t *testing.T, respond func(cmd string) []string) (*config.Account, func() []string) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{newTestTLSCertificate(t)},
+	})
+	if err != nil {
+		t.Fatalf("starting test IMAP server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var mu sync.Mutex
+	var commands []string
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		writer := bufio.NewWriter(conn)
+		write := func(line string) {
+			fmt.Fprintf(writer, "%s\r\n", line) //nolint:errcheck
+		}
+		write("* OK matcha test server")
+		writer.Flush() //nolint:errcheck
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			cmd = strings.ToUpper(cmd)
+			mu.Lock()
+			commands = append(commands, cmd)
+			mu.Unlock()
+
+			switch {
+			case strings.HasPrefix(cmd, "CAPABILITY"):
+				write("* CAPABILITY IMAP4rev1 AUTH=PLAIN CONDSTORE")
+			case strings.HasPrefix(cmd, "LOGOUT"):
+				write("* BYE logging out")
+				write(tag + " OK LOGOUT completed")
+				writer.Flush() //nolint:errcheck
+				return
+			default:
+				for _, l := range respond(cmd) {
+					write(l)
+				}
+			}
+			write(tag + " OK completed")
+			writer.Flush() //nolint:errcheck
+		}
+	}()
+
+	host, portText, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	account := &config.Account{
+		ID:              "test-account",
+		Email:           "user@example.com",
+		Password:        "password",
+		ServiceProvider: "custom",
+		IMAPServer:      host,
+		IMAPPort:        port,
+		Insecure:        true,
+		CatchAll:        true,
+		SC:              &config.SessionCache{},
+	}
+	return account, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), commands...)
+	}
+}
+
+func TestSyncMailboxEmailsFetchesOnlyDelta(t *testing.T) {
+	account, commands := startSyncIMAPServer(t, func(cmd string) []string {
+		switch {
+		case strings.HasPrefix(cmd, "SELECT"):
+			return []string{
+				"* 3 EXISTS",
+				"* OK [UIDVALIDITY 7] UIDs valid",
+				"* OK [UIDNEXT 13] Predicted next UID",
+				"* OK [HIGHESTMODSEQ 105] Highest",
+			}
+		case strings.HasPrefix(cmd, "UID FETCH 8:10"):
+			return []string{`* 1 FETCH (UID 9 FLAGS (\Seen \Flagged todo) MODSEQ (104))`}
+		case strings.HasPrefix(cmd, "UID SEARCH"):
+			return []string{"* SEARCH 9 10"}
+		case strings.HasPrefix(cmd, "UID FETCH 11:*"):
+			return []string{`* 3 FETCH (UID 12 FLAGS () ENVELOPE (NIL "Hello" NIL NIL NIL NIL NIL NIL NIL "<m12@example.com>"))`}
+		}
+		return nil
+	})
+
+	prev := config.FolderSyncState{UIDValidity: 7, UIDNext: 11, HighestModSeq: 100}
+	res, err := SyncMailboxEmails(account, "INBOX", prev, []uint32{8, 9, 10}, 50)
+	if err != nil {
+		t.Fatalf("SyncMailboxEmails: %v", err)
+	}
+
+	if res.Full {
+		t.Fatal("expected a delta sync, got a full resync")
+	}
+	wantState := config.FolderSyncState{UIDValidity: 7, UIDNext: 13, HighestModSeq: 105}
+	if res.State != wantState {
+		t.Errorf("state = %+v, want %+v", res.State, wantState)
+	}
+	wantUpdates := []FlagUpdate{{UID: 9, IsRead: true, IsFlagged: true, Labels: []string{"todo"}}}
+	if !reflect.DeepEqual(res.Updates, wantUpdates) {
+		t.Errorf("updates = %+v, want %+v", res.Updates, wantUpdates)
+	}
+	if !reflect.DeepEqual(res.Vanished, []uint32{8}) {
+		t.Errorf("vanished = %v, want [8]", res.Vanished)
+	}
+	if len(res.Emails) != 1 || res.Emails[0].UID != 12 || res.Emails[0].Subject != "Hello" {
+		t.Errorf("new emails = %+v, want UID 12 \"Hello\"", res.Emails)
+	}
+
+	var sawChangedSince bool
+	for _, cmd := range commands() {
+		if strings.Contains(cmd, "CHANGEDSINCE 100") {
+			sawChangedSince = true
+		}
+	}
+	if !sawChangedSince {
+		t.Errorf("no CHANGEDSINCE fetch in %q", commands())
+	}
+}
+
+func TestSyncMailboxEmailsBackfillsAfterExpunges(t *testing.T) {
+	account, commands := startSyncIMAPServer(t, func(cmd string) []string {
+		switch {
+		case strings.HasPrefix(cmd, "SELECT"):
+			return []string{
+				"* 4 EXISTS",
+				"* OK [UIDVALIDITY 7] UIDs valid",
+				"* OK [UIDNEXT 11] Predicted next UID",
+				"* OK [HIGHESTMODSEQ 100] Highest",
+			}
+		case strings.HasPrefix(cmd, "UID SEARCH UID 8:10"):
+			return []string{"* SEARCH 10"}
+		case strings.HasPrefix(cmd, "UID SEARCH UID 1:7"):
+			return []string{"* SEARCH 3 5 7"}
+		case strings.HasPrefix(cmd, "UID FETCH 5,7"):
+			return []string{
+				`* 2 FETCH (UID 5 FLAGS () ENVELOPE (NIL "Five" NIL NIL NIL NIL NIL NIL NIL "<m5@example.com>"))`,
+				`* 3 FETCH (UID 7 FLAGS (\Seen) ENVELOPE (NIL "Seven" NIL NIL NIL NIL NIL NIL NIL "<m7@example.com>"))`,
+			}
+		}
+		return nil
+	})
+
+	prev := config.FolderSyncState{UIDValidity: 7, UIDNext: 11, HighestModSeq: 100}
+	res, err := SyncMailboxEmails(account, "INBOX", prev, []uint32{8, 9, 10}, 3)
+	if err != nil {
+		t.Fatalf("SyncMailboxEmails: %v", err)
+	}
+	if !reflect.DeepEqual(res.Vanished, []uint32{8, 9}) {
+		t.Errorf("vanished = %v, want [8 9]", res.Vanished)
+	}
+	var uids []uint32
+	for _, e := range res.Emails {
+		uids = append(uids, e.UID)
+	}
+	if !reflect.DeepEqual(uids, []uint32{7, 5}) {
+		t.Errorf("backfilled UIDs = %v, want [7 5]; commands %q", uids, commands())
+	}
+}
+
+func TestSyncMailboxEmailsResyncsOnUIDValidityChange(t *testing.T) {
+	account, commands := startSyncIMAPServer(t, func(cmd string) []string {
+		if strings.HasPrefix(cmd, "SELECT") {
+			return []string{
+				"* 0 EXISTS",
+				"* OK [UIDVALIDITY 8] UIDs valid",
+				"* OK [UIDNEXT 1] Predicted next UID",
+				"* OK [HIGHESTMODSEQ 1] Highest",
+			}
+		}
+		return nil
+	})
+
+	prev := config.FolderSyncState{UIDValidity: 7, UIDNext: 11, HighestModSeq: 100}
+	res, err := SyncMailboxEmails(account, "INBOX", prev, []uint32{8, 9, 10}, 50)
+	if err != nil {
+		t.Fatalf("SyncMailboxEmails: %v", err)
+	}
+	if !res.Full {
+		t.Fatal("expected a full resync after UIDVALIDITY changed")
+	}
+	if res.State.UIDValidity != 8 {
+		t.Errorf("state UIDValidity = %d, want 8", res.State.UIDValidity)
+	}
+	for _, cmd := range commands() {
+		if strings.Contains(cmd, "CHANGEDSINCE") || strings.HasPrefix(cmd, "UID SEARCH") {
+			t.Errorf("unexpected delta command %q after UIDVALIDITY change", cmd)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wireConn sits between imapclient and the network connection, so that
+// commands imapclient has no support for, such as NOTIFY and Gmail's
+// X-GM-LABELS fetch, can be sent on its session. The completion of such a
+// command, and the untagged responses it claims, are removed from what
+// imapclient reads; everything else is passed on.
+type wireConn struct {
+	net.Conn
+	r *bufio.Reader
+	// observe, if not nil, is called on the reading goroutine with the
+	// first line of each untagged response passed on to imapclient.
+	observe func(line []byte)
+
+	mu  sync.Mutex
+	cmd *wireCommand // the command in progress, if any
+
+	pending []byte // read but not yet returned to imapclient
+	literal int    // bytes of a literal still to pass through
+	cont    bool   // the next line continues a line that ended in a literal
+}
+
+// wireCommand is a command sent with wireConn.command. imapclient numbers
+// its own commands T1, T2, ..., so tags that start with another letter
+// never collide with them.
+type wireCommand struct {
+	tag string
+	// claim, if not nil, reports whether the untagged response starting
+	// with line answers the command. Claimed responses are read in full,
+	// with literals inlined as quoted strings, and given to handle on the
+	// reading goroutine instead of to imapclient.
+	claim  func(line []byte) bool
+	handle func(resp string)
+
+	done chan string
+}
+
+func newWireConn(conn net.Conn, observe func(line []byte)) *wireConn {
+	return &wireConn{
+		Conn:    conn,
+		r:       bufio.NewReader(conn),
+		observe: observe,
+	}
+}
+
+// command sends line tagged with cmd.tag and waits for its completion,
+// which it returns without the tag, e.g. "OK Success" or "BAD Unknown
+// command". It must be called while imapclient has no command in progress.
+// If the server does not answer within timeout the connection is closed,
+// as its state is no longer known.
+func (c *wireConn) command(cmd *wireCommand, line string, timeout time.Duration) (string, error) {
+	cmd.done = make(chan string, 1)
+	c.mu.Lock()
+	c.cmd = cmd
+	c.mu.Unlock()
+
+	if _, err := c.Conn.Write([]byte(cmd.tag + " " + line + "\r\n")); err != nil {
+		return "", err
+	}
+	select {
+	case status := <-cmd.done:
+		return status, nil
+	case <-time.After(timeout):
+		c.Conn.Close() //nolint:errcheck,gosec
+		return "", errors.New("timed out")
+	}
+}
+
+func (c *wireConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.literal > 0 {
+			if len(p) > c.literal {
+				p = p[:c.literal]
+			}
+			n, err := c.r.Read(p)
+			c.literal -= n
+			c.cont = true
+			return n, err
+		}
+		line, err := c.r.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		drop, err := c.filter(line)
+		if err != nil {
+			return 0, err
+		}
+		if !drop {
+			c.pending = line
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// filter looks at a line from the server before it is passed on, and
+// reports whether to drop it.
+func (c *wireConn) filter(line []byte) (bool, error) {
+	cont := c.cont
+	c.cont = false
+	c.literal = literalSize(line)
+	if cont {
+		return false, nil
+	}
+
+	c.mu.Lock()
+	cmd := c.cmd
+	c.mu.Unlock()
+
+	if cmd != nil {
+		if rest, ok := bytes.CutPrefix(line, []byte(cmd.tag+" ")); ok {
+			c.mu.Lock()
+			c.cmd = nil
+			c.mu.Unlock()
+			cmd.done <- strings.TrimSpace(string(rest))
+			return true, nil
+		}
+		if cmd.claim != nil && bytes.HasPrefix(line, []byte("* ")) && cmd.claim(line) {
+			c.literal = 0
+			resp, err := c.readResponse(line)
+			if err != nil {
+				return true, err
+			}
+			cmd.handle(resp)
+			return true, nil
+		}
+	}
+	if c.observe != nil && bytes.HasPrefix(line, []byte("* ")) {
+		c.observe(line)
+	}
+	return false, nil
+}
+
+// readResponse reads the rest of the response starting with line. Literals
+// are inlined as quoted strings.
+func (c *wireConn) readResponse(line []byte) (string, error) {
+	var b strings.Builder
+	for {
+		n := literalSize(line)
+		if n == 0 {
+			b.Write(line)
+			return b.String(), nil
+		}
+		b.Write(line[:bytes.LastIndexByte(line, '{')])
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return "", err
+		}
+		b.WriteString(quoteMailbox(string(lit)))
+
+		var err error
+		if line, err = c.r.ReadBytes('\n'); err != nil {
+			return "", err
+		}
+	}
+}
+
+// literalSize returns the size of the literal announced at the end of line,
+// or 0.
+func literalSize(line []byte) int {
+	line = bytes.TrimRight(line, "\r\n")
+	if !bytes.HasSuffix(line, []byte("}")) {
+		return 0
+	}
+	i := bytes.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(string(line[i+1:len(line)-1]), "+"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
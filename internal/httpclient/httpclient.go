@@ -13,6 +13,9 @@ import (
 const (
 	// PluginCallTimeout bounds Lua-driven plugin HTTP calls (plugin/http.go).
 	PluginCallTimeout = 10 * time.Second
+	// PluginAsyncCallTimeout bounds matcha.http_async calls (plugin/http.go).
+	// They run off the UI goroutine, so slow APIs such as AI models get longer.
+	PluginAsyncCallTimeout = 2 * time.Minute
 	// RegistryFetchTimeout bounds plugin registry / plugin file fetches (plugins/embed.go).
 	RegistryFetchTimeout = 10 * time.Second
 	// RemoteImageTimeout bounds inline image fetches (view/html.go).
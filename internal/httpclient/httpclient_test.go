@@ -15,6 +15,7 @@ func TestTimeoutConstants(t *testing.T) {
 		min  time.Duration
 	}{
 		{"PluginCallTimeout", PluginCallTimeout, time.Second},
+		{"PluginAsyncCallTimeout", PluginAsyncCallTimeout, PluginCallTimeout},
 		{"RegistryFetchTimeout", RegistryFetchTimeout, time.Second},
 		{"RemoteImageTimeout", RemoteImageTimeout, time.Second},
 		{"InstallTimeout", InstallTimeout, time.Second},
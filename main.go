@@ -20,6 +20,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -31,6 +32,7 @@ import (
 	_ "github.com/floatpane/matcha/backend/imap"
 	_ "github.com/floatpane/matcha/backend/jmap"
 	_ "github.com/floatpane/matcha/backend/maildir"
+	_ "github.com/floatpane/matcha/backend/mbox"
 	_ "github.com/floatpane/matcha/backend/pop3"
 	matchaCli "github.com/floatpane/matcha/cli"
 	"github.com/floatpane/matcha/clib"
@@ -47,6 +49,7 @@ import (
 	"github.com/floatpane/matcha/internal/loglevel"
 	"github.com/floatpane/matcha/notify"
 	"github.com/floatpane/matcha/plugin"
+	"github.com/floatpane/matcha/searchindex"
 	"github.com/floatpane/matcha/sender"
 	"github.com/floatpane/matcha/theme"
 	"github.com/floatpane/matcha/tui"
@@ -70,8 +73,22 @@ var (
 
 	// httpClient is used for all outbound HTTP requests (update checks, asset downloads).
 	httpClient = httpclient.NewWithRedirectCap(httpclient.UpdateCheckTimeout, 5)
+
+	// indexLocally is set when no daemon is running, in which case the TUI
+	// keeps the search index up to date itself.
+	indexLocally atomic.Bool
+
+	// indexFlush holds the timer of the pending search index write.
+	indexFlush struct {
+		sync.Mutex
+		timer *time.Timer
+	}
 )
 
+// indexFlushDelay is how long the TUI waits after indexing a body before
+// writing the search index.
+const indexFlushDelay = 5 * time.Second
+
 const (
 	goosDarwin        = "darwin"
 	goosLinux         = "linux"
@@ -135,6 +152,8 @@ type mainModel struct {
 	service daemonclient.Service
 	// Plugin prompt waiting for user input
 	pendingPrompt *plugin.PendingPrompt
+	// pluginTimerAt is when the scheduled pluginTimerMsg fires; zero if none is scheduled.
+	pluginTimerAt time.Time
 	// mailto: URL parsed from os.Args
 	mailtoURL *url.URL
 	// Optional in-app log panel.
@@ -151,6 +170,29 @@ type logEntryMsg struct {
 	entry logging.Entry
 }
 
+// pluginTimerMsg fires when a plugin timer set with matcha.after or matcha.every is due.
+type pluginTimerMsg struct {
+	at time.Time
+}
+
+// pluginHTTPDoneMsg carries the response to a plugin's matcha.http_async request.
+type pluginHTTPDoneMsg struct {
+	req  *plugin.HTTPRequest
+	resp plugin.HTTPResponse
+}
+
+// pluginExternalCallMsg carries a request from an external plugin, or notice
+// that one exited.
+type pluginExternalCallMsg struct {
+	call plugin.ExternalCall
+}
+
+// pluginMailboxDoneMsg carries the result of a mailbox op queued by a plugin.
+type pluginMailboxDoneMsg struct {
+	op     plugin.MailboxOp
+	result plugin.MailboxResult
+}
+
 func newInitialModel(cfg *config.Config, mailtoURL *url.URL) *mainModel {
 	idleUpdates := make(chan fetcher.IdleUpdate, 16)
 	initialModel := &mainModel{
@@ -250,10 +292,13 @@ func (m *mainModel) getProvider(acct *config.Account) backend.Provider {
 }
 
 func (m *mainModel) Init() tea.Cmd {
-	cmds := []tea.Cmd{m.current.Init(), checkForUpdatesCmd(), checkForV1RCCmd()}
+	cmds := []tea.Cmd{m.current.Init(), checkForUpdatesCmd(), checkForV1RCCmd(), m.pluginTimerCmd()}
 	if m.showLogPanel && m.logCh != nil {
 		cmds = append(cmds, waitForLogEntry(m.logCh))
 	}
+	if m.plugins != nil {
+		cmds = append(cmds, waitForPluginCall(m.plugins.ExternalCalls()))
+	}
 	return tea.Batch(cmds...)
 }
 
@@ -264,6 +309,12 @@ func waitForLogEntry(ch <-chan logging.Entry) tea.Cmd {
 	}
 }
 
+func waitForPluginCall(ch <-chan plugin.ExternalCall) tea.Cmd {
+	return func() tea.Msg {
+		return pluginExternalCallMsg{call: <-ch}
+	}
+}
+
 func unreadBadgeCount(emailsByAcct, folderEmails map[string][]fetcher.Email) int {
 	count := 0
 	seen := make(map[string]struct{})
@@ -329,11 +380,11 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 	if keyMsg, ok := msg.(tea.KeyPressMsg); ok && keyMsg.String() == config.Keybinds.Global.Cancel {
 		switch current := m.current.(type) {
 		case *tui.Inbox:
-			searchWasActive = current.IsSearchActive()
+			searchWasActive = current.IsSearchActive() || current.IsLabelPickerOpen()
 			filterWasActive = current.IsFilterActive()
 		case *tui.FolderInbox:
 			if inbox := current.GetInbox(); inbox != nil {
-				searchWasActive = inbox.IsSearchActive()
+				searchWasActive = inbox.IsSearchActive() || inbox.IsLabelPickerOpen()
 				filterWasActive = inbox.IsFilterActive()
 			}
 			splitWasOpen = current.HasSplitPreview()
@@ -349,10 +400,11 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 			m.plugins.CallComposerHook(plugin.HookComposerUpdated, composer.GetBody(), composer.GetSubject(), composer.GetTo(), composer.GetCc(), composer.GetBcc())
 			m.syncPluginStatus()
 			m.applyPluginFields(composer)
+			cmds = append(cmds, m.pluginFlagCmds()...)
 		}
 
-		// Check plugin key bindings for the current view, but not while the search overlay is open
-		if m.plugins != nil && !m.isSearchOverlayOpen() {
+		// Check plugin key bindings for the current view, but not while an inbox overlay is open
+		if m.plugins != nil && !m.isInboxOverlayOpen() {
 			if bindingCmd := m.handlePluginKeyBinding(keyMsg); bindingCmd != nil {
 				cmds = append(cmds, bindingCmd)
 			}
@@ -505,12 +557,16 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 				account.FetchEmail = account.Email
 			}
 
-			// Find and update the existing account, preserving S/MIME settings
+			// Find and update the existing account, preserving S/MIME, Sieve, watch, sendmail and mbox settings
 			for i, acc := range m.config.Accounts {
 				if acc.ID == existingID {
 					account.SMIMECert = acc.SMIMECert
 					account.SMIMEKey = acc.SMIMEKey
 					account.SMIMESignByDefault = acc.SMIMESignByDefault
+					account.SieveServer = acc.SieveServer
+					account.WatchFolders = acc.WatchFolders
+					account.SendmailCommand = acc.SendmailCommand
+					account.MboxPath = acc.MboxPath
 					if account.Password == "" {
 						account.Password = acc.Password
 					}
@@ -615,6 +671,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		m.folderInbox.SetDetailedDates(m.config.EnableDetailedDates)
 		m.folderInbox.SetDefaultThreaded(m.config.EnableThreaded)
 		m.folderInbox.SetDisableImages(m.config.DisableImages)
+		m.folderInbox.SetSavedSearches(m.config.SavedSearches)
 		// Use cached INBOX emails for instant display (memory first, then disk)
 		if cached, ok := m.folderEmails[folderInbox]; ok && len(cached) > 0 {
 			m.folderInbox.SetEmails(cached, m.config.Accounts)
@@ -633,6 +690,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		if m.service == nil {
 			m.service = daemonclient.NewService(m.config)
 		}
+		indexLocally.Store(!m.service.IsDaemon())
 		if m.service.IsDaemon() {
 			// Subscribe to INBOX updates if using daemon.
 			for _, acct := range m.config.Accounts {
@@ -652,7 +710,10 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 			listenForIdleUpdates(m.idleUpdates),
 		}
 		if m.service.IsDaemon() {
-			batchCmds = append(batchCmds, listenForDaemonEvents(m.service.Events()))
+			batchCmds = append(batchCmds,
+				listenForDaemonEvents(m.service.Events()),
+				failedSendsCmd(m.service),
+			)
 		}
 		return m, tea.Batch(batchCmds...)
 
@@ -809,7 +870,50 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 			}
 			m.pendingPrompt = nil
 		}
-		return m, nil
+		return m, tea.Batch(append(m.pluginFlagCmds(), m.pluginNotifyCmd())...)
+
+	case pluginTimerMsg:
+		if msg.at.Equal(m.pluginTimerAt) {
+			m.pluginTimerAt = time.Time{}
+		}
+		if m.plugins == nil {
+			return m, nil
+		}
+		m.plugins.RunTimers(time.Now())
+		m.syncPluginStatus()
+		if composer, ok := m.current.(*tui.Composer); ok {
+			m.applyPluginFields(composer)
+		}
+		return m, tea.Batch(append(m.pluginFlagCmds(), m.pluginNotifyCmd())...)
+
+	case pluginHTTPDoneMsg:
+		m.plugins.ResolveHTTP(msg.req, msg.resp)
+		m.syncPluginStatus()
+		if composer, ok := m.current.(*tui.Composer); ok {
+			m.applyPluginFields(composer)
+		}
+		return m, tea.Batch(append(m.pluginFlagCmds(), m.pluginNotifyCmd())...)
+
+	case pluginExternalCallMsg:
+		m.plugins.HandleExternalCall(msg.call)
+		m.syncPluginStatus()
+		m.syncPluginKeyBindings()
+		if composer, ok := m.current.(*tui.Composer); ok {
+			m.applyPluginFields(composer)
+		}
+		cmds := append(m.pluginFlagCmds(), m.pluginNotifyCmd(), waitForPluginCall(m.plugins.ExternalCalls()))
+		return m, tea.Batch(cmds...)
+
+	case pluginMailboxDoneMsg:
+		if msg.result.Err == nil {
+			switch msg.op.Kind {
+			case plugin.MailboxMove, plugin.MailboxArchive, plugin.MailboxDelete:
+				m.removePluginMailboxEmail(msg.op)
+			}
+		}
+		m.plugins.ResolveMailboxOp(msg.op, msg.result)
+		m.syncPluginStatus()
+		return m, tea.Batch(append(m.pluginFlagCmds(), m.pluginNotifyCmd())...)
 
 	case tui.PluginPromptCancelMsg:
 		if composer, ok := m.current.(*tui.Composer); ok {
@@ -825,7 +929,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		// Call plugin hooks for received emails
 		if m.plugins != nil {
 			for _, email := range msg.Emails {
-				t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, msg.FolderName)
+				t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, msg.FolderName, email.Labels)
 				m.plugins.CallHook(plugin.HookEmailReceived, t)
 			}
 		}
@@ -1000,6 +1104,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 				if err != nil {
 					loglevel.Debugf("error caching email body fails (disk full, permission denied) for UID: %d: %v", msg.UID, err)
 				}
+				indexEmailBody(folderName, msg.AccountID, msg.UID, msg.Body, msg.BodyMIMEType, len(msg.Attachments) > 0)
 			}()
 		}
 		// Forward to FolderInbox for rendering
@@ -1009,6 +1114,48 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		}
 		return m, nil
 
+	case tui.CreateFolderMsg:
+		if m.config == nil || m.config.GetAccountByID(msg.AccountID) == nil {
+			return m, nil
+		}
+		return m, m.createFolderCmd(msg)
+
+	case tui.FolderCreatedMsg:
+		if msg.Err != nil {
+			log.Printf("Create folder failed: %v", msg.Err)
+			if m.folderInbox != nil {
+				m.previousModel = m.folderInbox
+			}
+			m.current = tui.NewStatus(fmt.Sprintf("Error: %v", msg.Err))
+			return m, tea.Tick(2*time.Second, func(t time.Time) tea.Msg {
+				return tui.RestoreViewMsg{}
+			})
+		}
+		if m.folderInbox != nil {
+			m.folderInbox.AddFolder(msg.Name)
+		}
+		if len(msg.UIDs) == 0 {
+			return m, nil
+		}
+		// Hand off to the regular move flow so the move gets the same undo
+		// grace period as a move into an existing folder.
+		return m, func() tea.Msg {
+			if len(msg.UIDs) > 1 {
+				return tui.BatchMoveEmailsMsg{
+					UIDs:         msg.UIDs,
+					AccountID:    msg.AccountID,
+					SourceFolder: msg.SourceFolder,
+					DestFolder:   msg.Name,
+				}
+			}
+			return tui.MoveEmailToFolderMsg{
+				UID:          msg.UIDs[0],
+				AccountID:    msg.AccountID,
+				SourceFolder: msg.SourceFolder,
+				DestFolder:   msg.Name,
+			}
+		}
+
 	case tui.EmailMovedMsg:
 		if msg.Err != nil {
 			log.Printf("Move failed: %v", msg.Err)
@@ -1086,15 +1233,42 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 					cmds = append(cmds, fetchFolderEmailsCmd(m.config, ev.Folder))
 				}
 			}
+			// The outbox sends no events; recount its failures as the
+			// daemon syncs.
+			cmds = append(cmds, failedSendsCmd(m.service))
+		case daemonrpc.EventEmailsUpdated:
+			var ev daemonrpc.EmailsUpdatedEvent
+			if err := json.Unmarshal(msg.Event.Data, &ev); err == nil {
+				// A saved search draws on its folder in every account.
+				if m.folderInbox != nil && m.folderInbox.GetCurrentFolder() == ev.Folder {
+					cmds = append(cmds, m.folderInbox.RefreshSavedSearch())
+				}
+			}
 		}
 		return m, tea.Batch(cmds...)
 
+	case tui.FailedSendsMsg:
+		if m.folderInbox != nil {
+			m.folderInbox.GetInbox().SetFailedSends(msg.Count)
+		}
+		return m, nil
+
+	case tui.RetryFailedSendsMsg:
+		if m.service == nil {
+			return m, nil
+		}
+		return m, retryFailedSendsCmd(m.service)
+
 	case tui.RequestRefreshMsg:
 		// Folder-based refresh: clear folder cache and refetch
 		if msg.FolderName != "" && m.config != nil {
 			delete(m.folderEmails, msg.FolderName)
 			if m.folderInbox != nil {
 				m.folderInbox.SetRefreshing(true)
+				return m, tea.Batch(
+					fetchFolderEmailsCmd(m.config, msg.FolderName),
+					m.folderInbox.RefreshSavedSearch(),
+				)
 			}
 			return m, fetchFolderEmailsCmd(m.config, msg.FolderName)
 		}
@@ -1176,10 +1350,48 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 
 	case tui.SearchRequestedMsg:
 		folderName := msg.FolderName
+		if msg.Query.Folder != "" {
+			folderName = msg.Query.Folder
+		}
 		if folderName == "" {
 			folderName = folderInbox
 		}
-		return m, m.searchEmailsCmd(msg.Query, folderName, msg.AccountID)
+		return m, tea.Batch(
+			localSearchCmd(msg.Query, folderName, msg.AccountID),
+			m.searchEmailsCmd(msg.Query, folderName, msg.AccountID),
+		)
+
+	case tui.SavedSearchRequestedMsg:
+		return m, m.savedSearchCmd(msg)
+
+	case tui.SavedSearchResultsMsg:
+		if m.folderInbox != nil {
+			m.folderInbox.Update(msg)
+		}
+		return m, nil
+
+	case tui.SaveSearchMsg:
+		if m.config == nil {
+			return m, nil
+		}
+		saved := config.SavedSearch{Name: msg.Name, Query: msg.Query}
+		replaced := false
+		for i, s := range m.config.SavedSearches {
+			if s.Name == msg.Name {
+				m.config.SavedSearches[i] = saved
+				replaced = true
+			}
+		}
+		if !replaced {
+			m.config.SavedSearches = append(m.config.SavedSearches, saved)
+		}
+		if err := config.SaveConfig(m.config); err != nil {
+			log.Printf("could not save config: %v", err)
+		}
+		if m.folderInbox != nil {
+			m.folderInbox.SetSavedSearches(m.config.SavedSearches)
+		}
+		return m, nil
 
 	case tui.EmailsAppendedMsg:
 		if m.emailsByAcct == nil {
@@ -1465,7 +1677,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		}
 		suppressRead := false
 		if m.plugins != nil {
-			t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, folderName)
+			t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, folderName, email.Labels)
 			m.plugins.CallHook(plugin.HookEmailViewed, t)
 			suppressRead = m.plugins.TakeAutoReadSuppressed()
 		}
@@ -1478,7 +1690,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 				m.markEmailAsReadInStores(msg.UID, msg.AccountID)
 				account := m.config.GetAccountByID(msg.AccountID)
 				if account != nil {
-					cmd = markEmailAsReadCmd(account, msg.UID, msg.AccountID, folderName)
+					cmd = m.markEmailAsReadCmd(account, msg.UID, msg.AccountID, folderName)
 				}
 			}
 			// Fetch body
@@ -1569,6 +1781,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		if err != nil {
 			loglevel.Debugf("error caching email body fails (disk full, permission denied) for UID: %d: %v", msg.UID, err)
 		}
+		go indexEmailBody(folderForCache, msg.AccountID, msg.UID, msg.Body, msg.BodyMIMEType, len(msg.Attachments) > 0)
 
 		email := m.getEmailByUIDAndAccount(msg.UID, msg.AccountID)
 		if email == nil {
@@ -1590,7 +1803,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 			}
 			account := m.config.GetAccountByID(msg.AccountID)
 			if account != nil {
-				markReadCmd = markEmailAsReadCmd(account, msg.UID, msg.AccountID, folderName)
+				markReadCmd = m.markEmailAsReadCmd(account, msg.UID, msg.AccountID, folderName)
 			}
 		}
 
@@ -1857,7 +2070,34 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 
 	case tui.SendEmailMsg:
 		if m.plugins != nil {
-			m.plugins.CallSendHook(plugin.HookEmailSendBefore, msg.To, msg.Cc, msg.Subject, msg.AccountID)
+			outgoing := &plugin.OutgoingEmail{
+				AccountID:    msg.AccountID,
+				To:           msg.To,
+				Cc:           msg.Cc,
+				Bcc:          msg.Bcc,
+				Subject:      msg.Subject,
+				Body:         msg.Body,
+				Headers:      msg.Headers,
+				SignSMIME:    msg.SignSMIME,
+				EncryptSMIME: msg.EncryptSMIME,
+				SignPGP:      msg.SignPGP,
+			}
+			for _, path := range msg.AttachmentPaths {
+				outgoing.Attachments = append(outgoing.Attachments, filepath.Base(path))
+			}
+			verdict := m.plugins.CallSendHook(plugin.HookEmailSendBefore, outgoing)
+			if verdict.Cancel {
+				text := "Send cancelled by plugin " + verdict.Plugin
+				if verdict.Reason != "" {
+					text += ": " + verdict.Reason
+				}
+				return m, m.showSendBlocked(text)
+			}
+			msg.To, msg.Cc, msg.Bcc = outgoing.To, outgoing.Cc, outgoing.Bcc
+			msg.Subject, msg.Body, msg.Headers = outgoing.Subject, outgoing.Body, outgoing.Headers
+			if err := sender.CheckExtraHeaders(msg.Headers); err != nil {
+				return m, m.showSendBlocked(fmt.Sprintf("Send cancelled: %v", err))
+			}
 		}
 
 		m.previousModel = m.current
@@ -1879,6 +2119,7 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		// Ensure the service is initialized even when composing without visiting inbox.
 		if m.service == nil && m.config != nil {
 			m.service = daemonclient.NewService(m.config)
+			indexLocally.Store(!m.service.IsDaemon())
 		}
 
 		noticeText := "Sending email..."
@@ -2126,6 +2367,50 @@ func (m *mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 		m.syncUnreadBadge()
 		return m, nil
 
+	case tui.FlagEmailsMsg:
+		if m.config == nil || m.config.GetAccountByID(msg.AccountID) == nil {
+			return m, nil
+		}
+		folderName := folderInbox
+		if m.folderInbox != nil {
+			folderName = m.folderInbox.GetCurrentFolder()
+		}
+		m.setEmailsFlaggedInStores(msg.UIDs, msg.AccountID, msg.Flagged)
+		return m, m.flagEmailsCmd(msg.UIDs, msg.AccountID, folderName, msg.Flagged)
+
+	case tui.EmailsFlaggedMsg:
+		if msg.Err != nil {
+			// Roll back the optimistic update so the inbox matches the server.
+			log.Printf("Error changing flag: %v", msg.Err)
+			m.setEmailsFlaggedInStores(msg.UIDs, msg.AccountID, !msg.Flagged)
+			if m.folderInbox != nil {
+				m.folderInbox.GetInbox().SetEmailsFlagged(msg.UIDs, msg.AccountID, !msg.Flagged)
+			}
+		}
+		return m, nil
+
+	case tui.LabelEmailsMsg:
+		if m.config == nil || m.config.GetAccountByID(msg.AccountID) == nil {
+			return m, nil
+		}
+		folderName := folderInbox
+		if m.folderInbox != nil {
+			folderName = m.folderInbox.GetCurrentFolder()
+		}
+		m.setEmailsLabelInStores(msg.UIDs, msg.AccountID, msg.Label, msg.Add)
+		return m, m.labelEmailsCmd(msg.UIDs, msg.AccountID, folderName, msg.Label, msg.Add)
+
+	case tui.EmailsLabeledMsg:
+		if msg.Err != nil {
+			// Roll back the optimistic update so the inbox matches the server.
+			log.Printf("Error changing label %q: %v", msg.Label, msg.Err)
+			m.setEmailsLabelInStores(msg.UIDs, msg.AccountID, msg.Label, !msg.Add)
+			if m.folderInbox != nil {
+				m.folderInbox.GetInbox().SetEmailsLabel(msg.UIDs, msg.AccountID, msg.Label, !msg.Add)
+			}
+		}
+		return m, nil
+
 	case tui.EmailActionDoneMsg:
 		if msg.Err != nil {
 			log.Printf("Action failed: %v", msg.Err)
@@ -2655,6 +2940,60 @@ func (m *mainModel) markEmailAsUnreadInStores(uid uint32, accountID string) {
 	}
 }
 
+func (m *mainModel) setEmailsFlaggedInStores(uids []uint32, accountID string, flagged bool) {
+	for i := range m.emails {
+		if m.emails[i].AccountID == accountID && slices.Contains(uids, m.emails[i].UID) {
+			m.emails[i].IsFlagged = flagged
+		}
+	}
+	if emails, ok := m.emailsByAcct[accountID]; ok {
+		for i := range emails {
+			if slices.Contains(uids, emails[i].UID) {
+				emails[i].IsFlagged = flagged
+			}
+		}
+	}
+	for folderName, folderEmails := range m.folderEmails {
+		changed := false
+		for i := range folderEmails {
+			if folderEmails[i].AccountID == accountID && slices.Contains(uids, folderEmails[i].UID) {
+				folderEmails[i].IsFlagged = flagged
+				changed = true
+			}
+		}
+		if changed {
+			go saveFolderEmailsToCache(folderName, folderEmails)
+		}
+	}
+}
+
+func (m *mainModel) setEmailsLabelInStores(uids []uint32, accountID, label string, add bool) {
+	for i := range m.emails {
+		if m.emails[i].AccountID == accountID && slices.Contains(uids, m.emails[i].UID) {
+			m.emails[i].Labels = tui.WithLabel(m.emails[i].Labels, label, add)
+		}
+	}
+	if emails, ok := m.emailsByAcct[accountID]; ok {
+		for i := range emails {
+			if slices.Contains(uids, emails[i].UID) {
+				emails[i].Labels = tui.WithLabel(emails[i].Labels, label, add)
+			}
+		}
+	}
+	for folderName, folderEmails := range m.folderEmails {
+		changed := false
+		for i := range folderEmails {
+			if folderEmails[i].AccountID == accountID && slices.Contains(uids, folderEmails[i].UID) {
+				folderEmails[i].Labels = tui.WithLabel(folderEmails[i].Labels, label, add)
+				changed = true
+			}
+		}
+		if changed {
+			go saveFolderEmailsToCache(folderName, folderEmails)
+		}
+	}
+}
+
 func (m *mainModel) removeEmailFromStores(uid uint32, accountID string) {
 	var filtered []fetcher.Email
 	for _, e := range m.emails {
@@ -2710,16 +3049,25 @@ func (m *mainModel) decrementFolderUnreadForRemoved(folderName, accountID string
 	}
 }
 
-// pluginFlagCmds drains pending flag ops from plugins and returns the corresponding tea.Cmds.
+// pluginFlagCmds drains pending flag, label and mailbox ops and HTTP requests from plugins and returns the corresponding tea.Cmds,
+// along with a tick for any plugin timer that is not yet scheduled.
 func (m *mainModel) pluginFlagCmds() []tea.Cmd {
 	if m.plugins == nil {
 		return nil
 	}
-	ops := m.plugins.TakePendingFlagOps()
-	if len(ops) == 0 {
-		return nil
-	}
 	var cmds []tea.Cmd
+	for _, op := range m.plugins.TakePendingLabelOps() {
+		if m.config.GetAccountByID(op.AccountID) == nil {
+			continue
+		}
+		uids := []uint32{op.UID}
+		m.setEmailsLabelInStores(uids, op.AccountID, op.Label, op.Add)
+		if m.folderInbox != nil {
+			m.folderInbox.GetInbox().SetEmailsLabel(uids, op.AccountID, op.Label, op.Add)
+		}
+		cmds = append(cmds, m.labelEmailsCmd(uids, op.AccountID, op.Folder, op.Label, op.Add))
+	}
+	ops := m.plugins.TakePendingFlagOps()
 	for _, op := range ops {
 		account := m.config.GetAccountByID(op.AccountID)
 		if account == nil {
@@ -2727,26 +3075,138 @@ func (m *mainModel) pluginFlagCmds() []tea.Cmd {
 		}
 		if op.Read {
 			m.markEmailAsReadInStores(op.UID, op.AccountID)
-			cmds = append(cmds, markEmailAsReadCmd(account, op.UID, op.AccountID, op.Folder))
+			cmds = append(cmds, m.markEmailAsReadCmd(account, op.UID, op.AccountID, op.Folder))
 		} else {
 			m.markEmailAsUnreadInStores(op.UID, op.AccountID)
-			cmds = append(cmds, markEmailAsUnreadCmd(account, op.UID, op.AccountID, op.Folder))
+			cmds = append(cmds, m.markEmailAsUnreadCmd(account, op.UID, op.AccountID, op.Folder))
+		}
+	}
+	for _, op := range m.plugins.TakePendingMailboxOps() {
+		cmds = append(cmds, m.pluginMailboxCmd(op))
+	}
+	for _, req := range m.plugins.TakePendingHTTP() {
+		cmds = append(cmds, func() tea.Msg {
+			return pluginHTTPDoneMsg{req: req, resp: req.Do()}
+		})
+	}
+	return append(cmds, m.pluginTimerCmd())
+}
+
+// pluginTimerCmd schedules a pluginTimerMsg for the next plugin timer, unless
+// one is already scheduled for that time or earlier.
+func (m *mainModel) pluginTimerCmd() tea.Cmd {
+	if m.plugins == nil {
+		return nil
+	}
+	due, ok := m.plugins.NextTimer()
+	if !ok || (!m.pluginTimerAt.IsZero() && !due.Before(m.pluginTimerAt)) {
+		return nil
+	}
+	m.pluginTimerAt = due
+	return tea.Tick(time.Until(due), func(time.Time) tea.Msg {
+		return pluginTimerMsg{at: due}
+	})
+}
+
+// pluginMailboxCmd runs a mailbox op queued by a plugin and reports the
+// result back so it can be handed to the plugin's callback.
+func (m *mainModel) pluginMailboxCmd(op plugin.MailboxOp) tea.Cmd {
+	if op.Kind == plugin.MailboxSearch {
+		query := backend.ParseSearchQuery(op.Query)
+		folderName := query.Folder
+		if folderName == "" {
+			folderName = folderInbox
+		}
+		search := m.searchEmailsCmd(query, folderName, op.AccountID)
+		return func() tea.Msg {
+			done := pluginMailboxDoneMsg{op: op}
+			res, _ := search().(tui.SearchResultsMsg)
+			done.result.Err = res.Err
+			for _, e := range res.Emails {
+				done.result.Emails = append(done.result.Emails, plugin.MailboxEmail{
+					UID: e.UID, From: e.From, To: e.To, Subject: e.Subject, Date: e.Date,
+					IsRead: e.IsRead, AccountID: e.AccountID, Folder: folderName, Labels: e.Labels,
+				})
+			}
+			return done
+		}
+	}
+
+	return func() tea.Msg {
+		done := pluginMailboxDoneMsg{op: op}
+		if m.service == nil {
+			done.result.Err = fmt.Errorf("service not initialized")
+			return done
+		}
+		uids := []uint32{op.UID}
+		switch op.Kind {
+		case plugin.MailboxMove:
+			done.result.Err = m.service.MoveEmails(op.AccountID, uids, op.Folder, op.Dest)
+		case plugin.MailboxArchive:
+			done.result.Err = m.service.ArchiveEmails(op.AccountID, op.Folder, uids)
+		case plugin.MailboxDelete:
+			done.result.Err = m.service.DeleteEmails(op.AccountID, op.Folder, uids)
+		case plugin.MailboxFetchBody:
+			body, mimeType, attachments, err := m.service.FetchEmailBody(op.AccountID, op.Folder, op.UID)
+			done.result.Body, done.result.MIMEType, done.result.Err = body, mimeType, err
+			for _, a := range attachments {
+				done.result.Attachments = append(done.result.Attachments, a.Filename)
+			}
+		case plugin.MailboxFolders:
+			folders, err := m.service.FetchFolders(op.AccountID)
+			done.result.Err = err
+			for _, f := range folders {
+				done.result.Folders = append(done.result.Folders, f.Name)
+			}
+		}
+		return done
+	}
+}
+
+// removePluginMailboxEmail drops an email a plugin moved, archived or
+// deleted from the views, if it is in the folder being shown.
+func (m *mainModel) removePluginMailboxEmail(op plugin.MailboxOp) {
+	if m.folderInbox == nil || m.folderInbox.GetCurrentFolder() != op.Folder {
+		return
+	}
+	m.folderInbox.GetInbox().RemoveEmail(op.UID, op.AccountID)
+	m.decrementFolderUnreadForRemoved(op.Folder, op.AccountID, []uint32{op.UID})
+	m.removeEmailFromStores(op.UID, op.AccountID)
+	if emails, ok := m.folderEmails[op.Folder]; ok {
+		var filtered []fetcher.Email
+		for _, e := range emails {
+			if e.UID != op.UID || e.AccountID != op.AccountID {
+				filtered = append(filtered, e)
+			}
 		}
+		m.folderEmails[op.Folder] = filtered
+		go saveFolderEmailsToCache(op.Folder, filtered)
 	}
-	return cmds
+}
+
+// showSendBlocked shows why a send was stopped, then returns to the composer
+// with the message intact.
+func (m *mainModel) showSendBlocked(text string) tea.Cmd {
+	m.previousModel = m.current
+	m.current = tui.NewStatus(text)
+	return tea.Tick(3*time.Second, func(t time.Time) tea.Msg {
+		return tui.RestoreViewMsg{}
+	})
 }
 
 // pluginNotifyCmd checks for a pending plugin notification and returns a command if one exists.
+// It also schedules the next plugin timer, since the hook that notified may have set one.
 func (m *mainModel) pluginNotifyCmd() tea.Cmd {
 	if m.plugins == nil {
 		return nil
 	}
+	timerCmd := m.pluginTimerCmd()
 	if n, ok := m.plugins.TakePendingNotification(); ok {
-		return func() tea.Msg {
+		return tea.Batch(func() tea.Msg {
 			return tui.PluginNotifyMsg{Message: n.Message, Duration: n.Duration}
-		}
+		}, timerCmd)
 	}
-	return nil
+	return timerCmd
 }
 
 func (m *mainModel) syncPluginStatus() {
@@ -2791,21 +3251,21 @@ func (m *mainModel) handlePluginKeyBinding(msg tea.KeyPressMsg) tea.Cmd {
 		switch v := m.current.(type) {
 		case *tui.Inbox:
 			if email := v.GetSelectedEmail(); email != nil {
-				t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, "")
+				t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, "", email.Labels)
 				m.plugins.CallKeyBinding(binding, t)
 			} else {
 				m.plugins.CallKeyBinding(binding)
 			}
 		case *tui.FolderInbox:
 			if email := v.GetInbox().GetSelectedEmail(); email != nil {
-				t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, v.GetCurrentFolder())
+				t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, v.GetCurrentFolder(), email.Labels)
 				m.plugins.CallKeyBinding(binding, t)
 			} else {
 				m.plugins.CallKeyBinding(binding)
 			}
 		case *tui.EmailView:
 			email := v.GetEmail()
-			t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, "")
+			t := m.plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, "", email.Labels)
 			m.plugins.CallKeyBinding(binding, t)
 		case *tui.Composer:
 			L := m.plugins.LuaState()
@@ -2832,12 +3292,13 @@ func (m *mainModel) handlePluginKeyBinding(msg tea.KeyPressMsg) tea.Cmd {
 	return nil
 }
 
-func (m *mainModel) isSearchOverlayOpen() bool {
+func (m *mainModel) isInboxOverlayOpen() bool {
 	switch v := m.current.(type) {
 	case *tui.Inbox:
-		return v.IsSearchOverlayOpen()
+		return v.IsSearchOverlayOpen() || v.IsLabelPickerOpen()
 	case *tui.FolderInbox:
-		return v.GetInbox().IsSearchOverlayOpen()
+		inbox := v.GetInbox()
+		return inbox.IsSearchOverlayOpen() || inbox.IsLabelPickerOpen()
 	}
 	return false
 }
@@ -2902,8 +3363,77 @@ func flattenAndSort(emailsByAccount map[string][]fetcher.Email) []fetcher.Email
 	return allEmails
 }
 
+// localSearch runs the query against the local search index, which covers
+// every cached email of every account, online or not.
+func localSearch(query backend.SearchQuery, folderName, accountID string) []fetcher.Email {
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("Error opening search index: %v", err)
+		return nil
+	}
+	return docsToEmails(ix.Search(query, folderName, accountID))
+}
+
+// localSearchCmd reports local index hits ahead of the server search so the
+// overlay has something to show straight away.
+func localSearchCmd(query backend.SearchQuery, folderName, accountID string) tea.Cmd {
+	return func() tea.Msg {
+		if query.Err != nil {
+			return nil
+		}
+		emails := localSearch(query, folderName, accountID)
+		if len(emails) == 0 {
+			return nil
+		}
+		return tui.SearchResultsMsg{Query: query, Emails: emails, Local: true}
+	}
+}
+
+func docsToEmails(docs []searchindex.Doc) []fetcher.Email {
+	emails := make([]fetcher.Email, 0, len(docs))
+	for _, d := range docs {
+		emails = append(emails, fetcher.Email{
+			UID:        d.UID,
+			From:       d.From,
+			To:         d.To,
+			Subject:    d.Subject,
+			Date:       d.Date,
+			MessageID:  d.MessageID,
+			InReplyTo:  d.InReplyTo,
+			References: d.References,
+			AccountID:  d.AccountID,
+			IsRead:     d.IsRead,
+			IsFlagged:  d.IsFlagged,
+			Labels:     d.Labels,
+		})
+	}
+	return emails
+}
+
+// mergeSearchResults adds local hits the server did not return, e.g. for
+// accounts that could not be reached.
+func mergeSearchResults(server, local []fetcher.Email) []fetcher.Email {
+	type key struct {
+		accountID string
+		uid       uint32
+	}
+	seen := make(map[key]bool, len(server))
+	for _, e := range server {
+		seen[key{e.AccountID, e.UID}] = true
+	}
+	for _, e := range local {
+		if !seen[key{e.AccountID, e.UID}] {
+			server = append(server, e)
+		}
+	}
+	return server
+}
+
 func (m *mainModel) searchEmailsCmd(query backend.SearchQuery, folderName, accountID string) tea.Cmd {
 	return func() tea.Msg {
+		if query.Err != nil {
+			return tui.SearchResultsMsg{Query: query, Err: query.Err}
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), httpclient.IMAPSearchTimeout)
 		defer cancel()
 
@@ -2939,22 +3469,34 @@ func (m *mainModel) searchEmailsCmd(query backend.SearchQuery, folderName, accou
 			succeeded = true
 			results = append(results, backendEmailsToFetcher(emails)...)
 		}
-		if !succeeded && firstErr != nil {
+		local := localSearch(query, folderName, accountID)
+		if !succeeded && firstErr != nil && len(local) == 0 {
 			return tui.SearchResultsMsg{Query: query, Err: firstErr}
 		}
+		results = mergeSearchResults(results, local)
 		sortFetcherEmails(results)
 
 		return tui.SearchResultsMsg{Query: query, Emails: results}
 	}
 }
 
+// savedSearchCmd runs a saved search across all accounts through the
+// regular search path.
+func (m *mainModel) savedSearchCmd(msg tui.SavedSearchRequestedMsg) tea.Cmd {
+	search := m.searchEmailsCmd(msg.Query, msg.FolderName, "")
+	return func() tea.Msg {
+		res, _ := search().(tui.SearchResultsMsg)
+		return tui.SavedSearchResultsMsg{Name: msg.Name, Emails: res.Emails, Err: res.Err}
+	}
+}
+
 func backendEmailsToFetcher(emails []backend.Email) []fetcher.Email {
 	result := make([]fetcher.Email, len(emails))
 	for i, e := range emails {
 		result[i] = fetcher.Email{
 			UID: e.UID, From: e.From, To: e.To, ReplyTo: e.ReplyTo,
-			Subject: e.Subject, Body: e.Body, Date: e.Date, IsRead: e.IsRead,
-			MessageID: e.MessageID, References: e.References, AccountID: e.AccountID,
+			Subject: e.Subject, Body: e.Body, Date: e.Date, IsRead: e.IsRead, IsFlagged: e.IsFlagged,
+			Labels: e.Labels, MessageID: e.MessageID, References: e.References, AccountID: e.AccountID,
 		}
 	}
 	return result
@@ -3023,6 +3565,8 @@ func emailsToCache(emails []fetcher.Email) []config.CachedEmail {
 			References: email.References,
 			AccountID:  email.AccountID,
 			IsRead:     email.IsRead,
+			IsFlagged:  email.IsFlagged,
+			Labels:     email.Labels,
 		})
 	}
 	return cached
@@ -3042,6 +3586,8 @@ func cacheToEmails(cached []config.CachedEmail) []fetcher.Email {
 			References: c.References,
 			AccountID:  c.AccountID,
 			IsRead:     c.IsRead,
+			IsFlagged:  c.IsFlagged,
+			Labels:     c.Labels,
 		})
 	}
 	return emails
@@ -3052,6 +3598,62 @@ func saveFolderEmailsToCache(folderName string, emails []fetcher.Email) {
 	if err := config.SaveFolderEmailCache(folderName, cached); err != nil {
 		log.Printf("Error saving folder email cache for %s: %v", folderName, err)
 	}
+	if !indexLocally.Load() {
+		return
+	}
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("Error opening search index: %v", err)
+		return
+	}
+	ix.AddEmails(folderName, cached)
+	if err := ix.Flush(); err != nil {
+		log.Printf("Error saving search index: %v", err)
+	}
+}
+
+// indexEmailBody adds a fetched body to the search index when the TUI is
+// the one maintaining it. The index is written after indexFlushDelay, so
+// reading through a folder rewrites it once rather than per email.
+func indexEmailBody(folderName, accountID string, uid uint32, body, mimeType string, hasAttachment bool) {
+	if !indexLocally.Load() {
+		return
+	}
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("Error opening search index: %v", err)
+		return
+	}
+	ix.AddBody(accountID, folderName, uid, body, mimeType, hasAttachment)
+
+	indexFlush.Lock()
+	defer indexFlush.Unlock()
+	if indexFlush.timer == nil {
+		indexFlush.timer = time.AfterFunc(indexFlushDelay, flushSearchIndex)
+	}
+}
+
+// flushSearchIndex writes the search index if a write is pending.
+func flushSearchIndex() {
+	indexFlush.Lock()
+	pending := indexFlush.timer != nil
+	if pending {
+		indexFlush.timer.Stop()
+		indexFlush.timer = nil
+	}
+	indexFlush.Unlock()
+	if !pending {
+		return
+	}
+
+	ix, err := searchindex.Open()
+	if err != nil {
+		log.Printf("Error opening search index: %v", err)
+		return
+	}
+	if err := ix.Flush(); err != nil {
+		log.Printf("Error saving search index: %v", err)
+	}
 }
 
 func loadFolderEmailsFromCache(folderName string) []fetcher.Email {
@@ -3153,7 +3755,7 @@ func (m *mainModel) sendEmailCmd(account *config.Account, msg tui.SendEmailMsg)
 		}
 
 		delaySeconds := m.config.GetUndoDelaySeconds()
-		jobID, err := m.service.QueueEmail(account.ID, recipients, cc, bcc, msg.Subject, body, string(htmlBody), images, attachments, msg.InReplyTo, msg.References, msg.SignSMIME, msg.EncryptSMIME, msg.SignPGP, false, delaySeconds)
+		jobID, err := m.service.QueueEmail(account.ID, recipients, cc, bcc, msg.Subject, body, string(htmlBody), images, attachments, msg.InReplyTo, msg.References, msg.Headers, msg.SignSMIME, msg.EncryptSMIME, msg.SignPGP, false, delaySeconds)
 
 		if err != nil {
 			log.Printf("Failed to queue email: %v", err)
@@ -3301,6 +3903,48 @@ func listenForDaemonEvents(ch <-chan *daemonrpc.Event) tea.Cmd {
 	}
 }
 
+// failedSendsCmd counts the emails in the daemon's outbox that gave up
+// sending.
+func failedSendsCmd(svc daemonclient.Service) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := svc.ListOutbox()
+		if err != nil {
+			log.Printf("Error listing outbox: %v", err)
+			return nil
+		}
+		n := 0
+		for _, e := range entries {
+			if e.Failed {
+				n++
+			}
+		}
+		return tui.FailedSendsMsg{Count: n}
+	}
+}
+
+// retryFailedSendsCmd asks the daemon to send the emails it gave up on
+// again, and recounts the ones still failed.
+func retryFailedSendsCmd(svc daemonclient.Service) tea.Cmd {
+	return func() tea.Msg {
+		entries, err := svc.ListOutbox()
+		if err != nil {
+			log.Printf("Error listing outbox: %v", err)
+			return nil
+		}
+		n := 0
+		for _, e := range entries {
+			if !e.Failed {
+				continue
+			}
+			if err := svc.RetryOutbox(e.JobID); err != nil {
+				log.Printf("Error retrying email %s: %v", e.JobID, err)
+				n++
+			}
+		}
+		return tui.FailedSendsMsg{Count: n}
+	}
+}
+
 // --- Folder-based command functions ---
 
 func fetchFoldersCmd(cfg *config.Config) tea.Cmd {
@@ -3453,16 +4097,28 @@ func fetchPreviewBodyCmd(cfg *config.Config, uid uint32, accountID string, folde
 	}
 }
 
-func markEmailAsReadCmd(account *config.Account, uid uint32, accountID string, folderName string) tea.Cmd {
+// markEmailAsReadCmd goes through the service when there is one so the
+// change is journaled while offline.
+func (m *mainModel) markEmailAsReadCmd(account *config.Account, uid uint32, accountID string, folderName string) tea.Cmd {
 	return func() tea.Msg {
-		err := fetcher.MarkEmailAsReadInMailbox(account, folderName, uid)
+		var err error
+		if m.service != nil {
+			err = m.service.MarkRead(accountID, folderName, []uint32{uid})
+		} else {
+			err = fetcher.MarkEmailAsReadInMailbox(account, folderName, uid)
+		}
 		return tui.EmailMarkedReadMsg{UID: uid, AccountID: accountID, Err: err}
 	}
 }
 
-func markEmailAsUnreadCmd(account *config.Account, uid uint32, accountID string, folderName string) tea.Cmd {
+func (m *mainModel) markEmailAsUnreadCmd(account *config.Account, uid uint32, accountID string, folderName string) tea.Cmd {
 	return func() tea.Msg {
-		err := fetcher.MarkEmailAsUnreadInMailbox(account, folderName, uid)
+		var err error
+		if m.service != nil {
+			err = m.service.MarkUnread(accountID, folderName, []uint32{uid})
+		} else {
+			err = fetcher.MarkEmailAsUnreadInMailbox(account, folderName, uid)
+		}
 		return tui.EmailMarkedUnreadMsg{UID: uid, AccountID: accountID, Err: err}
 	}
 }
@@ -3529,6 +4185,53 @@ func (m *mainModel) batchArchiveEmailsCmd(uids []uint32, accountID, folderName s
 	}
 }
 
+func (m *mainModel) createFolderCmd(msg tui.CreateFolderMsg) tea.Cmd {
+	return func() tea.Msg {
+		done := tui.FolderCreatedMsg{
+			AccountID:    msg.AccountID,
+			Name:         msg.Name,
+			UIDs:         msg.UIDs,
+			SourceFolder: msg.SourceFolder,
+		}
+		if m.service == nil {
+			done.Err = fmt.Errorf("service not initialized")
+			return done
+		}
+		done.Err = m.service.CreateFolder(msg.AccountID, msg.Name)
+		return done
+	}
+}
+
+func (m *mainModel) flagEmailsCmd(uids []uint32, accountID, folderName string, flagged bool) tea.Cmd {
+	return func() tea.Msg {
+		done := tui.EmailsFlaggedMsg{UIDs: uids, AccountID: accountID, Flagged: flagged}
+		switch {
+		case m.service == nil:
+			done.Err = fmt.Errorf("service not initialized")
+		case flagged:
+			done.Err = m.service.MarkFlagged(accountID, folderName, uids)
+		default:
+			done.Err = m.service.MarkUnflagged(accountID, folderName, uids)
+		}
+		return done
+	}
+}
+
+func (m *mainModel) labelEmailsCmd(uids []uint32, accountID, folderName, label string, add bool) tea.Cmd {
+	return func() tea.Msg {
+		done := tui.EmailsLabeledMsg{UIDs: uids, AccountID: accountID, Label: label, Add: add}
+		switch {
+		case m.service == nil:
+			done.Err = fmt.Errorf("service not initialized")
+		case add:
+			done.Err = m.service.AddLabel(accountID, folderName, uids, label)
+		default:
+			done.Err = m.service.RemoveLabel(accountID, folderName, uids, label)
+		}
+		return done
+	}
+}
+
 func (m *mainModel) batchMoveEmailsCmd(uids []uint32, accountID, sourceFolder, destFolder string, count int) tea.Cmd {
 	return func() tea.Msg {
 		if m.service == nil {
@@ -4362,6 +5065,7 @@ func parseGlobalFlags(args []string) ([]string, loglevel.Level, bool) {
 }
 
 func exit(code int) {
+	fetcher.ClosePool()
 	fetcher.CloseDebugFiles()
 	os.Exit(code)
 }
@@ -4426,6 +5130,15 @@ func main() { //nolint:gocyclo
 		exit(0)
 	}
 
+	// Plugins CLI subcommand: matcha plugins <list|update> [flags]
+	if len(os.Args) > 1 && os.Args[1] == "plugins" {
+		if err := matchaCli.RunPlugins(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "plugins: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
 	// Config CLI subcommand: matcha config [plugin_name]
 	if len(os.Args) > 1 && os.Args[1] == "config" {
 		if err := matchaCli.RunConfig(os.Args[2:]); err != nil {
@@ -4453,6 +5166,24 @@ func main() { //nolint:gocyclo
 		}
 	}
 
+	// Rules CLI subcommand: matcha rules test <rule> [--folder X]
+	if len(os.Args) > 1 && os.Args[1] == "rules" {
+		if err := matchaCli.RunRules(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "rules failed: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	// Sieve CLI subcommand: matcha sieve <list|get|put|activate> [flags]
+	if len(os.Args) > 1 && os.Args[1] == "sieve" {
+		if err := matchaCli.RunSieve(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "sieve failed: %v\n", err)
+			exit(1)
+		}
+		exit(0)
+	}
+
 	// Dict CLI subcommand: matcha dict <add|remove|list> [lang]
 	if len(os.Args) > 1 && os.Args[1] == "dict" {
 		if err := matchaCli.RunDict(os.Args[2:]); err != nil {
@@ -4563,7 +5294,7 @@ func main() { //nolint:gocyclo
 		if initialModel.folderInbox != nil {
 			folder = initialModel.folderInbox.GetCurrentFolder()
 		}
-		t := plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, folder)
+		t := plugins.EmailToTable(email.UID, email.From, email.To, email.Subject, email.Date, email.IsRead, email.AccountID, folder, email.Labels)
 		return plugins.CallBodyRenderHook(t, body, email.Body)
 	}
 	plugins.CallHook(plugin.HookStartup)
@@ -4591,12 +5322,15 @@ func main() { //nolint:gocyclo
 
 	if _, err := p.Run(); err != nil {
 		plugins.Close()
+		flushSearchIndex()
 		fmt.Printf("Alas, there's been an error: %v", err)
 		exit(1)
 	}
 
 	plugins.CallHook(plugin.HookShutdown)
 	plugins.Close()
+	flushSearchIndex()
+	fetcher.ClosePool()
 	fetcher.CloseDebugFiles()
 }
 
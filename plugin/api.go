@@ -4,14 +4,35 @@ import (
 	"log"
 
 	"charm.land/lipgloss/v2"
+	"github.com/floatpane/matcha/backend"
 	lua "github.com/yuin/gopher-lua"
 )
 
-// registerAPI registers the "matcha" module into the Lua VM.
-func (m *Manager) registerAPI() {
-	L := m.state
+// gatedFuncs maps the matcha functions that need a permission to it.
+var gatedFuncs = map[string]string{
+	"http":              PermNetwork,
+	"http_async":        PermNetwork,
+	"store_set":         PermStorage,
+	"store_get":         PermStorage,
+	"store_delete":      PermStorage,
+	"store_keys":        PermStorage,
+	"set_compose_field": PermCompose,
+	"mark_read":         PermMailbox,
+	"mark_unread":       PermMailbox,
+	"add_label":         PermMailbox,
+	"remove_label":      PermMailbox,
+	"move":              PermMailbox,
+	"archive":           PermMailbox,
+	"delete":            PermMailbox,
+	"fetch_body":        PermMailbox,
+	"folders":           PermMailbox,
+	"search":            PermMailbox,
+}
 
-	mod := L.RegisterModule("matcha", map[string]lua.LGFunction{
+// registerAPI registers the "matcha" module into a Lua VM. Functions that
+// need a permission the manifest does not grant raise an error instead.
+func (m *Manager) registerAPI(L *lua.LState, mf Manifest) {
+	funcs := map[string]lua.LGFunction{
 		"on":                 m.luaOn,
 		"log":                m.luaLog,
 		"notify":             m.luaNotify,
@@ -19,6 +40,7 @@ func (m *Manager) registerAPI() {
 		"set_compose_field":  m.luaSetComposeField,
 		"bind_key":           m.luaBindKey,
 		"http":               m.luaHTTP,
+		"http_async":         m.luaHTTPAsync,
 		"prompt":             m.luaPrompt,
 		"store_set":          m.luaStoreSet,
 		"store_get":          m.luaStoreGet,
@@ -29,17 +51,42 @@ func (m *Manager) registerAPI() {
 		"get_setting":        m.luaGetSetting,
 		"mark_read":          m.luaMarkRead,
 		"mark_unread":        m.luaMarkUnread,
+		"add_label":          m.luaAddLabel,
+		"remove_label":       m.luaRemoveLabel,
 		"suppress_auto_read": m.luaSuppressAutoRead,
-	})
+		"move":               m.luaMove,
+		"archive":            m.luaArchive,
+		"delete":             m.luaDelete,
+		"fetch_body":         m.luaFetchBody,
+		"folders":            m.luaFolders,
+		"search":             m.luaSearch,
+		"after":              m.luaAfter,
+		"every":              m.luaEvery,
+	}
+	for name, perm := range gatedFuncs {
+		if !mf.Has(perm) {
+			funcs[name] = denied(name, perm)
+		}
+	}
+	mod := L.RegisterModule("matcha", funcs)
+	m.registerTimerType(L)
 
 	L.SetField(mod, "_VERSION", lua.LString("0.1.0"))
 }
 
+// denied stands in for a matcha function the plugin has no permission for.
+func denied(name, perm string) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.RaiseError("matcha.%s needs the %q permission; declare it with \"-- @permission %s\" at the top of the plugin", name, perm, perm)
+		return 0
+	}
+}
+
 // matcha.on(event, callback) — register a hook callback.
 func (m *Manager) luaOn(L *lua.LState) int { //nolint:gocritic
 	event := L.CheckString(1)
 	fn := L.CheckFunction(2)
-	m.registerHook(event, fn)
+	m.registerHook(L, event, fn)
 	return 0
 }
 
@@ -83,6 +130,7 @@ func (m *Manager) luaBindKey(L *lua.LState) int { //nolint:gocritic
 			Description: description,
 			Fn:          fn,
 			Plugin:      m.currentPlugin,
+			vm:          m.vmFor(L),
 		})
 	default:
 		L.ArgError(2, "invalid area: must be \"inbox\", \"email_view\", or \"composer\"")
@@ -176,6 +224,31 @@ func (m *Manager) luaMarkUnread(L *lua.LState) int { //nolint:gocritic
 	return 0
 }
 
+// matcha.add_label(uid, account_id, folder, label) — queue adding a label
+// (IMAP/JMAP keyword, or Gmail label) to the given email.
+func (m *Manager) luaAddLabel(L *lua.LState) int { //nolint:gocritic
+	m.queueLabelOp(L, true)
+	return 0
+}
+
+// matcha.remove_label(uid, account_id, folder, label) — queue removing a label from the given email.
+func (m *Manager) luaRemoveLabel(L *lua.LState) int { //nolint:gocritic
+	m.queueLabelOp(L, false)
+	return 0
+}
+
+func (m *Manager) queueLabelOp(L *lua.LState, add bool) { //nolint:gocritic
+	uid := uint32(L.CheckInt(1))
+	accountID := L.CheckString(2)
+	folder := L.CheckString(3)
+	label := L.CheckString(4)
+	if err := backend.CheckLabel(label); err != nil {
+		L.ArgError(4, err.Error())
+		return
+	}
+	m.pendingLabelOps = append(m.pendingLabelOps, LabelOp{UID: uid, AccountID: accountID, Folder: folder, Label: label, Add: add})
+}
+
 // matcha.suppress_auto_read() — prevent the currently viewed email from being
 // automatically marked as read. Must be called inside an email_viewed callback.
 func (m *Manager) luaSuppressAutoRead(L *lua.LState) int { //nolint:gocritic
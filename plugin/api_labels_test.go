@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLuaLabelOpsQueued(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+
+	err := m.state.DoString(`
+		local matcha = require("matcha")
+		matcha.add_label(42, "acc1", "INBOX", "$Label1")
+		matcha.remove_label(42, "acc1", "INBOX", "work")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := m.TakePendingLabelOps()
+	want := []LabelOp{
+		{UID: 42, AccountID: "acc1", Folder: "INBOX", Label: "$Label1", Add: true},
+		{UID: 42, AccountID: "acc1", Folder: "INBOX", Label: "work", Add: false},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("got %d ops, want %d: %+v", len(ops), len(want), ops)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Errorf("op %d = %+v, want %+v", i, ops[i], want[i])
+		}
+	}
+	if again := m.TakePendingLabelOps(); again != nil {
+		t.Errorf("ops not cleared: %+v", again)
+	}
+}
+
+func TestLuaAddLabelRejectsInvalidLabel(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+
+	err := m.state.DoString(`require("matcha").add_label(1, "acc1", "INBOX", "two words")`)
+	if err == nil || !strings.Contains(err.Error(), "invalid character") {
+		t.Fatalf("expected invalid label error, got %v", err)
+	}
+	if ops := m.TakePendingLabelOps(); ops != nil {
+		t.Errorf("invalid label should not be queued: %+v", ops)
+	}
+}
@@ -72,10 +72,12 @@ func TestLuaStorePluginsAreIsolated(t *testing.T) {
 	defer m.Close()
 
 	pluginA := writePlugin(t, t.TempDir(), "a.lua", `
+		-- @permission storage
 		local matcha = require("matcha")
 		matcha.store_set("shared", "a")
 	`)
 	pluginB := writePlugin(t, t.TempDir(), "b.lua", `
+		-- @permission storage
 		local matcha = require("matcha")
 		matcha.store_set("shared", "b")
 	`)
@@ -115,12 +117,14 @@ func TestLuaStoreHookUsesRegisteredPluginContext(t *testing.T) {
 	defer m.Close()
 
 	pluginA := writePlugin(t, t.TempDir(), "a.lua", `
+		-- @permission storage
 		local matcha = require("matcha")
 		matcha.on("startup", function()
 			matcha.store_set("hook", "a")
 		end)
 	`)
 	pluginB := writePlugin(t, t.TempDir(), "b.lua", `
+		-- @permission storage
 		local matcha = require("matcha")
 		matcha.on("startup", function()
 			matcha.store_set("hook", "b")
@@ -142,12 +146,14 @@ func TestLuaStoreKeyBindingUsesRegisteredPluginContext(t *testing.T) {
 	defer m.Close()
 
 	pluginA := writePlugin(t, t.TempDir(), "a.lua", `
+		-- @permission storage
 		local matcha = require("matcha")
 		matcha.bind_key("ctrl+a", "inbox", "A", function()
 			matcha.store_set("binding", "a")
 		end)
 	`)
 	pluginB := writePlugin(t, t.TempDir(), "b.lua", `
+		-- @permission storage
 		local matcha = require("matcha")
 		matcha.bind_key("ctrl+b", "inbox", "B", function()
 			matcha.store_set("binding", "b")
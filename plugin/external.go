@@ -0,0 +1,435 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/floatpane/matcha/pluginrpc"
+)
+
+// ExternalSuffix is the file name suffix of external plugin registrations in
+// the plugins directory.
+const ExternalSuffix = ".plugin.json"
+
+// externalQueueSize is how many messages may wait to be written to an
+// external plugin before further ones are dropped.
+const externalQueueSize = 256
+
+// externalStopTimeout is how long Close waits for an external plugin to exit
+// after its stdin is closed before killing it.
+const externalStopTimeout = 2 * time.Second
+
+// ExternalSpec is the contents of a <name>.plugin.json file, which registers
+// an executable as a plugin. A relative Command containing a path separator
+// is resolved against the plugins directory; otherwise it is looked up in
+// PATH.
+type ExternalSpec struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// externalPlugin is a plugin running as a separate process that speaks the
+// pluginrpc protocol on its stdin and stdout.
+type externalPlugin struct {
+	name  string
+	cmd   *exec.Cmd
+	conn  *pluginrpc.Conn
+	out   chan any // messages for the writer goroutine
+	done  chan struct{}
+	hooks map[string]bool
+	// exited is set by the orchestrator once the process has gone away.
+	exited bool
+}
+
+// ExternalCall is a request from an external plugin, or notice that one
+// exited. The Manager reads them on a background goroutine and delivers them
+// on ExternalCalls; the orchestrator passes each to HandleExternalCall.
+type ExternalCall struct {
+	plugin *externalPlugin
+	req    *daemonrpc.Request // nil when the plugin exited
+}
+
+// loadExternal starts the executable registered by spec file path.
+func (m *Manager) loadExternal(name, path string) {
+	if _, ok := m.vms[name]; ok || m.external(name) != nil {
+		log.Printf("plugin %q: load error: a plugin with this name is already loaded", name)
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("plugin %q: load error: %v", name, err)
+		return
+	}
+	var spec ExternalSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		log.Printf("plugin %q: load error: %v", name, err)
+		return
+	}
+	if spec.Command == "" {
+		log.Printf("plugin %q: load error: no command", name)
+		return
+	}
+	command := spec.Command
+	if !filepath.IsAbs(command) && strings.ContainsRune(command, filepath.Separator) {
+		command = filepath.Join(filepath.Dir(path), command)
+	}
+
+	if err := m.startExternal(name, exec.Command(command, spec.Args...)); err != nil { //nolint:gosec
+		log.Printf("plugin %q: load error: %v", name, err)
+		return
+	}
+	log.Printf("plugin %q: started %s", name, command)
+}
+
+// startExternal runs cmd as the external plugin name.
+func (m *Manager) startExternal(name string, cmd *exec.Cmd) error {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = &pluginLogWriter{name: name}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p := &externalPlugin{
+		name:  name,
+		cmd:   cmd,
+		conn:  pluginrpc.NewConn(stdout, stdin),
+		out:   make(chan any, externalQueueSize),
+		done:  make(chan struct{}),
+		hooks: make(map[string]bool),
+	}
+	m.externals = append(m.externals, p)
+
+	// Writer: keeps slow plugins from blocking the orchestrator.
+	go func() {
+		for msg := range p.out {
+			if err := p.conn.Send(msg); err != nil {
+				break
+			}
+		}
+		stdin.Close() //nolint:errcheck,gosec
+	}()
+
+	// Reader: hands requests to the orchestrator.
+	calls, stop := m.externalCalls, m.stop
+	deliver := func(c ExternalCall) bool {
+		select {
+		case calls <- c:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	go func() {
+		for {
+			msg, err := p.conn.Receive()
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("plugin %q: %v", name, err)
+				}
+				break
+			}
+			if msg.Request != nil && !deliver(ExternalCall{plugin: p, req: msg.Request}) {
+				break
+			}
+		}
+		err := cmd.Wait()
+		log.Printf("plugin %q: exited: %v", name, err)
+		close(p.done)
+		deliver(ExternalCall{plugin: p})
+	}()
+	return nil
+}
+
+// pluginLogWriter sends an external plugin's stderr to the log.
+type pluginLogWriter struct {
+	name string
+}
+
+func (w *pluginLogWriter) Write(b []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		log.Printf("[plugin %s] %s", w.name, line)
+	}
+	return len(b), nil
+}
+
+// external returns the running external plugin with the given name.
+func (m *Manager) external(name string) *externalPlugin {
+	for _, p := range m.externals {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// send queues a message for an external plugin without blocking.
+func (p *externalPlugin) send(msg any) {
+	if p.exited {
+		return
+	}
+	select {
+	case p.out <- msg:
+	default:
+		log.Printf("plugin %q: not keeping up, dropped a message", p.name)
+	}
+}
+
+// finish marks p as exited and closes its queue, which ends the writer
+// goroutine and closes the plugin's stdin. Like send, it is only called on
+// the orchestrator's goroutine.
+func (p *externalPlugin) finish() {
+	if !p.exited {
+		p.exited = true
+		close(p.out)
+	}
+}
+
+// sendEvent queues an event for an external plugin.
+func (p *externalPlugin) sendEvent(typ string, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("plugin %q: %v", p.name, err)
+		return
+	}
+	p.send(&daemonrpc.Event{Type: typ, Data: b})
+}
+
+// ExternalCalls delivers requests from external plugins. The orchestrator
+// must receive from it and pass each call to HandleExternalCall.
+func (m *Manager) ExternalCalls() <-chan ExternalCall {
+	return m.externalCalls
+}
+
+// ExternalPlugins returns the names of the running external plugins.
+func (m *Manager) ExternalPlugins() []string {
+	var names []string
+	for _, p := range m.externals {
+		if !p.exited {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// HandleExternalCall carries out a request from an external plugin and
+// sends the response.
+func (m *Manager) HandleExternalCall(c ExternalCall) {
+	p := c.plugin
+	if c.req == nil {
+		p.finish()
+		m.removeBindings(func(b KeyBinding) bool { return b.ext == p })
+		return
+	}
+
+	result, err := m.externalCall(p, c.req.Method, c.req.Params)
+	if err != nil {
+		p.send(&daemonrpc.Response{ID: c.req.ID, Error: err})
+		return
+	}
+	b, _ := json.Marshal(result)
+	p.send(&daemonrpc.Response{ID: c.req.ID, Result: b})
+}
+
+// externalCall runs one matcha API method for an external plugin.
+func (m *Manager) externalCall(p *externalPlugin, method string, raw json.RawMessage) (any, *daemonrpc.Error) {
+	decode := func(v any) *daemonrpc.Error {
+		if err := json.Unmarshal(raw, v); err != nil {
+			return &daemonrpc.Error{Code: pluginrpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+	invalid := func(format string, args ...any) *daemonrpc.Error {
+		return &daemonrpc.Error{Code: pluginrpc.ErrCodeInvalidParams, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch method {
+	case pluginrpc.MethodOn:
+		var params pluginrpc.OnParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		p.hooks[params.Event] = true
+
+	case pluginrpc.MethodLog:
+		var params pluginrpc.LogParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		log.Printf("[plugin %s] %s", p.name, params.Message)
+
+	case pluginrpc.MethodNotify:
+		var params pluginrpc.NotifyParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		m.pendingNotification = params.Message
+		m.pendingDuration = params.Seconds
+
+	case pluginrpc.MethodSetStatus:
+		var params pluginrpc.SetStatusParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		m.statuses[params.Area] = params.Text
+
+	case pluginrpc.MethodSetComposeField:
+		var params pluginrpc.SetComposeFieldParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		switch params.Field {
+		case "to", "cc", "bcc", "subject", "body":
+			m.pendingFields[params.Field] = params.Value
+		default:
+			return nil, invalid("invalid field %q: must be \"to\", \"cc\", \"bcc\", \"subject\", or \"body\"", params.Field)
+		}
+
+	case pluginrpc.MethodBindKey:
+		var params pluginrpc.BindKeyParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		switch params.Area {
+		case StatusInbox, StatusEmailView, StatusComposer:
+		default:
+			return nil, invalid("invalid area %q: must be \"inbox\", \"email_view\", or \"composer\"", params.Area)
+		}
+		m.bindings = append(m.bindings, KeyBinding{
+			Key:         params.Key,
+			Area:        params.Area,
+			Description: params.Description,
+			Plugin:      p.name,
+			ext:         p,
+			extID:       params.ID,
+		})
+
+	default:
+		return nil, &daemonrpc.Error{Code: pluginrpc.ErrCodeNotFound, Message: "unknown method " + method}
+	}
+	return struct{}{}, nil
+}
+
+// callExternalHooks sends a hook event to the external plugins subscribed
+// to it.
+func (m *Manager) callExternalHooks(event string, args ...lua.LValue) {
+	if !m.externalHook(event) {
+		return
+	}
+	data := &pluginrpc.HookEvent{Event: event, Args: luaArgsToJSON(args)}
+	for _, p := range m.externals {
+		if p.hooks[event] && !p.exited {
+			p.sendEvent(pluginrpc.EventHook, data)
+		}
+	}
+}
+
+// externalHook reports whether any external plugin subscribed to event.
+func (m *Manager) externalHook(event string) bool {
+	for _, p := range m.externals {
+		if p.hooks[event] && !p.exited {
+			return true
+		}
+	}
+	return false
+}
+
+// removeBindings drops the key bindings for which drop returns true.
+func (m *Manager) removeBindings(drop func(KeyBinding) bool) {
+	kept := m.bindings[:0]
+	for _, b := range m.bindings {
+		if !drop(b) {
+			kept = append(kept, b)
+		}
+	}
+	m.bindings = kept
+}
+
+// closeExternals closes the external plugins' stdin, which asks them to
+// exit, and kills those still running after externalStopTimeout.
+func (m *Manager) closeExternals() {
+	select {
+	case <-m.stop:
+		return
+	default:
+		close(m.stop)
+	}
+	for _, p := range m.externals {
+		p.finish()
+	}
+	deadline := time.After(externalStopTimeout)
+	for _, p := range m.externals {
+		select {
+		case <-p.done:
+		case <-deadline:
+			p.cmd.Process.Kill() //nolint:errcheck,gosec
+		}
+	}
+	m.externals = nil
+}
+
+// luaArgsToJSON converts callback arguments to JSON for external plugins.
+func luaArgsToJSON(args []lua.LValue) []json.RawMessage {
+	out := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		b, err := json.Marshal(luaToGo(arg))
+		if err != nil {
+			b = []byte("null")
+		}
+		out[i] = b
+	}
+	return out
+}
+
+// luaToGo converts a Lua value to the Go value that encodes to the same JSON.
+// Tables with only consecutive integer keys from 1 become slices, and other
+// tables maps with string keys. Empty tables become null, which decodes into
+// either.
+func luaToGo(v lua.LValue) any {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.Len(); n > 0 {
+			list := make([]any, 0, n)
+			count := 0
+			v.ForEach(func(lua.LValue, lua.LValue) { count++ })
+			if count == n {
+				for i := 1; i <= n; i++ {
+					list = append(list, luaToGo(v.RawGetInt(i)))
+				}
+				return list
+			}
+		}
+		obj := make(map[string]any)
+		v.ForEach(func(k, val lua.LValue) {
+			obj[k.String()] = luaToGo(val)
+		})
+		if len(obj) == 0 {
+			return nil
+		}
+		return obj
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/floatpane/matcha/pluginsdk"
+)
+
+// TestExternalHelperProcess is the external plugin started by
+// TestExternalPlugin. It does nothing when run as a normal test.
+func TestExternalHelperProcess(t *testing.T) {
+	if os.Getenv("MATCHA_TEST_EXTERNAL_PLUGIN") != "1" {
+		t.Skip("helper process")
+	}
+	p := pluginsdk.New()
+	p.On(pluginsdk.HookEmailReceived, func(ev pluginsdk.Event) { //nolint:errcheck
+		var email pluginsdk.Email
+		ev.Decode(0, &email)              //nolint:errcheck
+		p.Notify("got "+email.Subject, 0) //nolint:errcheck
+	})
+	p.SetStatus(pluginsdk.AreaInbox, "ready")                            //nolint:errcheck
+	p.BindKey("x", pluginsdk.AreaInbox, "press", func(pluginsdk.Event) { //nolint:errcheck
+		p.SetStatus(pluginsdk.AreaInbox, "pressed") //nolint:errcheck
+	})
+	p.Run() //nolint:errcheck
+	os.Exit(0)
+}
+
+func TestExternalPlugin(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExternalHelperProcess$")
+	cmd.Env = append(os.Environ(), "MATCHA_TEST_EXTERNAL_PLUGIN=1")
+	if err := m.startExternal("ext", cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	// handleUntil runs the orchestrator's side until done reports true.
+	handleUntil := func(what string, done func() bool) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for !done() {
+			select {
+			case c := <-m.ExternalCalls():
+				m.HandleExternalCall(c)
+			case <-timeout:
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	handleUntil("setup", func() bool { return len(m.Bindings(StatusInbox)) == 1 })
+	if got := m.StatusText(StatusInbox); got != "ready" {
+		t.Errorf("inbox status = %q, want %q", got, "ready")
+	}
+	if b := m.Bindings(StatusInbox)[0]; b.Key != "x" || b.Plugin != "ext" {
+		t.Errorf("binding = %+v", b)
+	}
+	if got := m.ExternalPlugins(); len(got) != 1 || got[0] != "ext" {
+		t.Errorf("ExternalPlugins() = %v", got)
+	}
+
+	email := m.state.NewTable()
+	email.RawSetString("subject", lua.LString("hi"))
+	m.CallHook(HookEmailReceived, email)
+	handleUntil("notification", func() bool { return m.pendingNotification != "" })
+	if m.pendingNotification != "got hi" {
+		t.Errorf("notification = %q, want %q", m.pendingNotification, "got hi")
+	}
+
+	m.CallKeyBinding(m.Bindings(StatusInbox)[0], m.state.NewTable())
+	handleUntil("key binding", func() bool { return m.StatusText(StatusInbox) == "pressed" })
+
+	cmd.Process.Kill() //nolint:errcheck
+	handleUntil("exit", func() bool { return len(m.ExternalPlugins()) == 0 })
+	if len(m.Bindings(StatusInbox)) != 0 {
+		t.Errorf("bindings of an exited plugin were kept: %+v", m.Bindings(StatusInbox))
+	}
+	// The writer goroutine stops once the queue is closed.
+	for range m.externals[0].out {
+	}
+}
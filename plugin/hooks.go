@@ -1,10 +1,14 @@
 package plugin
 
 import (
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	lua "github.com/yuin/gopher-lua"
+
+	"github.com/floatpane/matcha/pluginrpc"
 )
 
 // Hook event names.
@@ -30,95 +34,252 @@ const (
 type registeredHook struct {
 	fn     *lua.LFunction
 	plugin string
+	vm     *pluginVM
 }
 
 // registerHook adds a callback for the given event.
-func (m *Manager) registerHook(event string, fn *lua.LFunction) {
-	m.hooks[event] = append(m.hooks[event], registeredHook{fn: fn, plugin: m.currentPlugin})
+func (m *Manager) registerHook(L *lua.LState, event string, fn *lua.LFunction) {
+	m.hooks[event] = append(m.hooks[event], registeredHook{fn: fn, plugin: m.currentPlugin, vm: m.vmFor(L)})
 }
 
-// CallHook invokes all callbacks registered for the given event.
+// CallHook invokes all callbacks registered for the given event, and sends
+// the event to the external plugins subscribed to it. The recipients of an
+// email table are left out for plugins without the mailbox permission.
 func (m *Manager) CallHook(event string, args ...lua.LValue) {
+	m.callExternalHooks(event, args...)
 	callbacks, ok := m.hooks[event]
 	if !ok {
 		return
 	}
 
-	previousPlugin := m.currentPlugin
-	defer func() {
-		m.currentPlugin = previousPlugin
-	}()
-
 	for _, hook := range callbacks {
-		m.currentPlugin = hook.plugin
-		if err := m.state.CallByParam(lua.P{
-			Fn:      hook.fn,
-			NRet:    0,
-			Protect: true,
-		}, args...); err != nil {
-			log.Printf("plugin hook %q error: %v", event, err)
+		m.callHook(event, hook, withholdEmailFields(hook.vm.manifest, copyArgs(hook.vm.L, args))...)
+	}
+}
+
+// Fields left out of the tables given to plugins without the permission
+// that covers them: the recipients of received mail need mailbox, and the
+// body and recipients of the message being written need compose.
+var (
+	mailboxFields = []string{"to"}
+	composeFields = []string{"body", "to", "cc", "bcc"}
+)
+
+// withhold clears keys in every table among args, unless the manifest grants
+// perm. args must be the plugin's own copy.
+func withhold(mf Manifest, perm string, args []lua.LValue, keys []string) []lua.LValue {
+	if mf.Has(perm) {
+		return args
+	}
+	for _, v := range args {
+		if t, ok := v.(*lua.LTable); ok {
+			for _, k := range keys {
+				t.RawSetString(k, lua.LNil)
+			}
 		}
 	}
+	return args
 }
 
-// CallSendHook calls a hook with email send metadata.
-func (m *Manager) CallSendHook(event string, to, cc, subject, accountID string) {
-	callbacks, ok := m.hooks[event]
-	if !ok || len(callbacks) == 0 {
-		return
+// withholdEmailFields withholds the mailbox fields of email tables.
+func withholdEmailFields(mf Manifest, args []lua.LValue) []lua.LValue {
+	return withhold(mf, PermMailbox, args, mailboxFields)
+}
+
+// copyArgs returns a deep copy of hook arguments made in L, so that each
+// plugin VM gets tables of its own and a callback that changes them cannot
+// affect the plugins called after it.
+func copyArgs(L *lua.LState, args []lua.LValue) []lua.LValue {
+	out := make([]lua.LValue, len(args))
+	seen := make(map[*lua.LTable]*lua.LTable)
+	for i, v := range args {
+		out[i] = copyValue(L, v, seen)
 	}
+	return out
+}
 
-	L := m.state
+func copyValue(L *lua.LState, v lua.LValue, seen map[*lua.LTable]*lua.LTable) lua.LValue {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return v
+	}
+	if c, ok := seen[t]; ok {
+		return c
+	}
+	c := L.NewTable()
+	seen[t] = c
+	t.ForEach(func(k, v lua.LValue) {
+		c.RawSet(copyValue(L, k, seen), copyValue(L, v, seen))
+	})
+	return c
+}
+
+// callHook runs one hook callback in its plugin's VM and returns its first
+// result. ok is false when the callback failed or its plugin is disabled.
+func (m *Manager) callHook(event string, hook registeredHook, args ...lua.LValue) (lua.LValue, bool) {
+	ret, err := m.call(hook.vm, hook.plugin, hook.fn, args...)
+	if err != nil {
+		if !errors.Is(err, errPluginDisabled) {
+			log.Printf("plugin %q hook %q error: %v", hook.plugin, event, err)
+		}
+		return lua.LNil, false
+	}
+	return ret, true
+}
+
+// OutgoingEmail is a message about to be sent, as email_send_before
+// callbacks see it. Callbacks may change the recipients, subject, body and
+// headers; the rest is for information. Plugins without the compose
+// permission see no body or recipients.
+type OutgoingEmail struct {
+	AccountID string
+	To        string // comma-separated, as typed in the composer
+	Cc        string
+	Bcc       string
+	Subject   string
+	// Body is the text as written, before the signature and any quoted
+	// reply are appended.
+	Body         string
+	Attachments  []string // file names
+	Headers      map[string]string
+	SignSMIME    bool
+	EncryptSMIME bool
+	SignPGP      bool
+}
+
+// SendVerdict is the outcome of the email_send_before callbacks.
+type SendVerdict struct {
+	Cancel bool
+	Reason string
+	Plugin string // the plugin that cancelled the send
+}
+
+// CallSendHook runs the email_send_before callbacks on email. A callback
+// may return a table: {cancel = true, reason = "..."} stops the send, and
+// any of to, cc, bcc, subject, body and headers replace those fields of the
+// message. Changes are applied to email in place, so later callbacks see
+// them. The first cancel wins and skips the remaining callbacks.
+func (m *Manager) CallSendHook(event string, email *OutgoingEmail) SendVerdict {
+	for _, hook := range m.hooks[event] {
+		args := []lua.LValue{outgoingEmailTable(hook.vm.L, email)}
+		ret, ok := m.callHook(event, hook, withhold(hook.vm.manifest, PermCompose, args, composeFields)...)
+		if !ok {
+			continue
+		}
+		t, ok := ret.(*lua.LTable)
+		if !ok {
+			continue
+		}
+		if !hook.vm.manifest.Compose {
+			log.Printf("plugin %q: ignoring %s result: the plugin lacks the %q permission", hook.plugin, event, PermCompose)
+			continue
+		}
+		if lua.LVAsBool(t.RawGetString("cancel")) {
+			reason := ""
+			if s, ok := t.RawGetString("reason").(lua.LString); ok {
+				reason = string(s)
+			}
+			return SendVerdict{Cancel: true, Reason: reason, Plugin: hook.plugin}
+		}
+		applySendChanges(t, email)
+	}
+
+	// External plugins only see the final message; they cannot change it.
+	if m.externalHook(event) {
+		m.callExternalHooks(event, outgoingEmailTable(m.state, email))
+	}
+	return SendVerdict{}
+}
+
+func outgoingEmailTable(L *lua.LState, email *OutgoingEmail) *lua.LTable {
 	t := L.NewTable()
-	t.RawSetString("to", lua.LString(to))
-	t.RawSetString("cc", lua.LString(cc))
-	t.RawSetString("subject", lua.LString(subject))
-	t.RawSetString("account_id", lua.LString(accountID))
+	t.RawSetString("to", lua.LString(email.To))
+	t.RawSetString("cc", lua.LString(email.Cc))
+	t.RawSetString("bcc", lua.LString(email.Bcc))
+	t.RawSetString("subject", lua.LString(email.Subject))
+	t.RawSetString("body", lua.LString(email.Body))
+	t.RawSetString("account_id", lua.LString(email.AccountID))
+	t.RawSetString("sign_smime", lua.LBool(email.SignSMIME))
+	t.RawSetString("encrypt_smime", lua.LBool(email.EncryptSMIME))
+	t.RawSetString("sign_pgp", lua.LBool(email.SignPGP))
 
-	previousPlugin := m.currentPlugin
-	defer func() {
-		m.currentPlugin = previousPlugin
-	}()
-	for _, hook := range callbacks {
-		m.currentPlugin = hook.plugin
-		if err := L.CallByParam(lua.P{
-			Fn:      hook.fn,
-			NRet:    0,
-			Protect: true,
-		}, t); err != nil {
-			log.Printf("plugin hook %q error: %v", event, err)
+	attachments := L.NewTable()
+	for i, name := range email.Attachments {
+		attachments.RawSetInt(i+1, lua.LString(name))
+	}
+	t.RawSetString("attachments", attachments)
+
+	headers := L.NewTable()
+	for k, v := range email.Headers {
+		headers.RawSetString(k, lua.LString(v))
+	}
+	t.RawSetString("headers", headers)
+	return t
+}
+
+// applySendChanges copies the fields a callback returned onto email.
+// Recipients may be a string or a list of addresses. In headers, a string
+// value sets a header and false removes one.
+func applySendChanges(t *lua.LTable, email *OutgoingEmail) {
+	for key, field := range map[string]*string{"to": &email.To, "cc": &email.Cc, "bcc": &email.Bcc} {
+		switch v := t.RawGetString(key).(type) {
+		case lua.LString:
+			*field = string(v)
+		case *lua.LTable:
+			var addrs []string
+			v.ForEach(func(_, addr lua.LValue) {
+				if s, ok := addr.(lua.LString); ok && s != "" {
+					addrs = append(addrs, string(s))
+				}
+			})
+			*field = strings.Join(addrs, ", ")
 		}
 	}
+	if s, ok := t.RawGetString("subject").(lua.LString); ok {
+		email.Subject = string(s)
+	}
+	if s, ok := t.RawGetString("body").(lua.LString); ok {
+		email.Body = string(s)
+	}
+	if headers, ok := t.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(k, v lua.LValue) {
+			name, ok := k.(lua.LString)
+			if !ok {
+				return
+			}
+			switch v := v.(type) {
+			case lua.LString:
+				if email.Headers == nil {
+					email.Headers = make(map[string]string)
+				}
+				email.Headers[string(name)] = string(v)
+			case lua.LBool:
+				if !bool(v) {
+					delete(email.Headers, string(name))
+				}
+			}
+		})
+	}
 }
 
 // CallFolderHook calls a hook with a folder name.
 func (m *Manager) CallFolderHook(event string, folderName string) {
+	m.callExternalHooks(event, lua.LString(folderName))
 	callbacks, ok := m.hooks[event]
 	if !ok {
 		return
 	}
 
-	previousPlugin := m.currentPlugin
-	defer func() {
-		m.currentPlugin = previousPlugin
-	}()
-
 	for _, hook := range callbacks {
-		m.currentPlugin = hook.plugin
-		if err := m.state.CallByParam(lua.P{
-			Fn:      hook.fn,
-			NRet:    0,
-			Protect: true,
-		}, lua.LString(folderName)); err != nil {
-			log.Printf("plugin hook %q error: %v", event, err)
-		}
+		m.callHook(event, hook, lua.LString(folderName))
 	}
 }
 
-// CallComposerHook calls a hook with composer state info.
+// CallComposerHook calls a hook with composer state info. Plugins without
+// the compose permission get only the subject and the body length.
 func (m *Manager) CallComposerHook(event string, body, subject, to, cc, bcc string) {
-	callbacks, ok := m.hooks[event]
-	if !ok || len(callbacks) == 0 {
+	callbacks := m.hooks[event]
+	if len(callbacks) == 0 && !m.externalHook(event) {
 		return
 	}
 
@@ -131,19 +292,10 @@ func (m *Manager) CallComposerHook(event string, body, subject, to, cc, bcc stri
 	t.RawSetString("cc", lua.LString(cc))
 	t.RawSetString("bcc", lua.LString(bcc))
 
-	previousPlugin := m.currentPlugin
-	defer func() {
-		m.currentPlugin = previousPlugin
-	}()
+	m.callExternalHooks(event, t)
 	for _, hook := range callbacks {
-		m.currentPlugin = hook.plugin
-		if err := L.CallByParam(lua.P{
-			Fn:      hook.fn,
-			NRet:    0,
-			Protect: true,
-		}, t); err != nil {
-			log.Printf("plugin hook %q error: %v", event, err)
-		}
+		args := copyArgs(hook.vm.L, []lua.LValue{t})
+		m.callHook(event, hook, withhold(hook.vm.manifest, PermCompose, args, composeFields)...)
 	}
 }
 
@@ -158,30 +310,25 @@ func (m *Manager) CallComposerHook(event string, body, subject, to, cc, bcc stri
 // it unchanged. Non-string returns are ignored. Multiple callbacks chain in
 // registration order; each subsequent callback sees the previous callback's
 // rendered output, but always the same raw source.
+//
+// Plugins without the mailbox permission get nil for rendered and raw, and
+// their return value is ignored.
 func (m *Manager) CallBodyRenderHook(email *lua.LTable, rendered, raw string) string {
 	callbacks, ok := m.hooks[HookEmailBodyRender]
 	if !ok {
 		return rendered
 	}
 
-	L := m.state
-	previousPlugin := m.currentPlugin
-	defer func() {
-		m.currentPlugin = previousPlugin
-	}()
-
 	for _, hook := range callbacks {
-		m.currentPlugin = hook.plugin
-		if err := L.CallByParam(lua.P{
-			Fn:      hook.fn,
-			NRet:    1,
-			Protect: true,
-		}, email, lua.LString(rendered), lua.LString(raw)); err != nil {
-			log.Printf("plugin hook %q error: %v", HookEmailBodyRender, err)
+		args := withholdEmailFields(hook.vm.manifest, copyArgs(hook.vm.L, []lua.LValue{email}))
+		if !hook.vm.manifest.Mailbox {
+			m.callHook(HookEmailBodyRender, hook, args[0], lua.LNil, lua.LNil)
+			continue
+		}
+		ret, ok := m.callHook(HookEmailBodyRender, hook, args[0], lua.LString(rendered), lua.LString(raw))
+		if !ok {
 			continue
 		}
-		ret := L.Get(-1)
-		L.Pop(1)
 		if s, ok := ret.(lua.LString); ok {
 			rendered = string(s)
 		}
@@ -190,24 +337,25 @@ func (m *Manager) CallBodyRenderHook(email *lua.LTable, rendered, raw string) st
 }
 
 // CallKeyBinding invokes a plugin key binding callback with the given arguments.
+// For an external plugin it sends the key event instead.
 func (m *Manager) CallKeyBinding(binding KeyBinding, args ...lua.LValue) {
-	previousPlugin := m.currentPlugin
-	m.currentPlugin = binding.Plugin
-	defer func() {
-		m.currentPlugin = previousPlugin
-	}()
-
-	if err := m.state.CallByParam(lua.P{
-		Fn:      binding.Fn,
-		NRet:    0,
-		Protect: true,
-	}, args...); err != nil {
+	if binding.ext != nil {
+		binding.ext.sendEvent(pluginrpc.EventKey, &pluginrpc.KeyEvent{ID: binding.extID, Args: luaArgsToJSON(args)})
+		return
+	}
+	args = copyArgs(binding.vm.L, args)
+	if binding.Area == StatusComposer {
+		args = withhold(binding.vm.manifest, PermCompose, args, composeFields)
+	} else {
+		args = withholdEmailFields(binding.vm.manifest, args)
+	}
+	if _, err := m.call(binding.vm, binding.Plugin, binding.Fn, args...); err != nil && !errors.Is(err, errPluginDisabled) {
 		log.Printf("plugin keybinding %q error: %v", binding.Key, err)
 	}
 }
 
 // EmailToTable converts email fields into a Lua table.
-func (m *Manager) EmailToTable(uid uint32, from string, to []string, subject string, date time.Time, isRead bool, accountID string, folder string) *lua.LTable {
+func (m *Manager) EmailToTable(uid uint32, from string, to []string, subject string, date time.Time, isRead bool, accountID string, folder string, labels []string) *lua.LTable {
 	L := m.state
 
 	t := L.NewTable()
@@ -225,5 +373,11 @@ func (m *Manager) EmailToTable(uid uint32, from string, to []string, subject str
 	}
 	t.RawSetString("to", toTable)
 
+	labelsTable := L.NewTable()
+	for i, label := range labels {
+		labelsTable.RawSetInt(i+1, lua.LString(label))
+	}
+	t.RawSetString("labels", labelsTable)
+
 	return t
 }
@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendHookModifiesEmail(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("footer", writePlugin(t, t.TempDir(), "footer.lua", `
+		-- @permission compose
+		local matcha = require("matcha")
+		matcha.on("email_send_before", function(email)
+			return {
+				subject = "[ext] " .. email.subject,
+				body = email.body .. "\n--\nsent from matcha",
+				bcc = { "archive@example.com", "audit@example.com" },
+				headers = { ["X-Mailer"] = "matcha", ["X-Drop"] = false },
+			}
+		end)
+	`))
+	m.loadPlugin("inspect", writePlugin(t, t.TempDir(), "inspect.lua", `
+		-- @permission compose
+		local matcha = require("matcha")
+		matcha.on("email_send_before", function(email)
+			if email.headers["X-Mailer"] ~= "matcha" or email.attachments[1] ~= "report.pdf" or not email.sign_pgp then
+				return { cancel = true, reason = "unexpected send table" }
+			end
+			return { to = email.to .. ", cc-me@example.com" }
+		end)
+	`))
+
+	email := &OutgoingEmail{
+		To:          "bob@example.com",
+		Subject:     "Report",
+		Body:        "Attached.",
+		Attachments: []string{"report.pdf"},
+		Headers:     map[string]string{"X-Drop": "1"},
+		SignPGP:     true,
+	}
+	if verdict := m.CallSendHook(HookEmailSendBefore, email); verdict.Cancel {
+		t.Fatalf("send cancelled: %q", verdict.Reason)
+	}
+
+	if email.Subject != "[ext] Report" {
+		t.Errorf("subject = %q", email.Subject)
+	}
+	if email.Body != "Attached.\n--\nsent from matcha" {
+		t.Errorf("body = %q", email.Body)
+	}
+	if email.To != "bob@example.com, cc-me@example.com" {
+		t.Errorf("to = %q", email.To)
+	}
+	if email.Bcc != "archive@example.com, audit@example.com" {
+		t.Errorf("bcc = %q", email.Bcc)
+	}
+	if len(email.Headers) != 1 || email.Headers["X-Mailer"] != "matcha" {
+		t.Errorf("headers = %v", email.Headers)
+	}
+}
+
+func TestSendHookCancel(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("guard", writePlugin(t, t.TempDir(), "guard.lua", `
+		-- @permission compose
+		local matcha = require("matcha")
+		matcha.on("email_send_before", function(email)
+			if email.body == "" then
+				return { cancel = true, reason = "empty body" }
+			end
+		end)
+	`))
+	m.loadPlugin("later", writePlugin(t, t.TempDir(), "later.lua", `
+		-- @permission compose
+		local matcha = require("matcha")
+		matcha.on("email_send_before", function(email)
+			return { subject = "changed" }
+		end)
+	`))
+
+	email := &OutgoingEmail{To: "bob@example.com", Subject: "Hi"}
+	verdict := m.CallSendHook(HookEmailSendBefore, email)
+	if !verdict.Cancel || verdict.Reason != "empty body" || verdict.Plugin != "guard" {
+		t.Fatalf("verdict = %+v", verdict)
+	}
+	if email.Subject != "Hi" {
+		t.Errorf("callbacks after the cancel still ran: subject = %q", email.Subject)
+	}
+
+	email.Body = "Hello"
+	if verdict := m.CallSendHook(HookEmailSendBefore, email); verdict.Cancel {
+		t.Fatalf("send with a body cancelled: %+v", verdict)
+	}
+	if email.Subject != "changed" {
+		t.Errorf("subject = %q", email.Subject)
+	}
+}
+
+func TestHookTablesArePerPlugin(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("clobber", writePlugin(t, t.TempDir(), "clobber.lua", `
+		local matcha = require("matcha")
+		matcha.on("email_received", function(email)
+			email.subject = "clobbered"
+			email.labels[1] = "clobbered"
+		end)
+	`))
+	m.loadPlugin("observe", writePlugin(t, t.TempDir(), "observe.lua", `
+		-- @permission storage
+		local matcha = require("matcha")
+		matcha.on("email_received", function(email)
+			matcha.store_set("seen", email.subject .. "/" .. email.labels[1])
+		end)
+	`))
+
+	email := m.EmailToTable(1, "alice@example.com", nil, "Hello", time.Now(), false, "acct", "INBOX", []string{"work"})
+	m.CallHook(HookEmailReceived, email)
+
+	assertStoredValue(t, "observe", "seen", "Hello/work")
+	if s := email.RawGetString("subject").String(); s != "Hello" {
+		t.Errorf("caller's table changed: subject = %q", s)
+	}
+}
+
+func TestBodyRenderWithholdsBodyWithoutMailbox(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("nosy", writePlugin(t, t.TempDir(), "nosy.lua", `
+		-- @permission storage
+		local matcha = require("matcha")
+		matcha.on("email_body_render", function(email, rendered, raw)
+			matcha.store_set("seen", tostring(rendered) .. "/" .. tostring(raw) .. "/" .. tostring(email.to))
+			return "replaced"
+		end)
+	`))
+	m.loadPlugin("reader", writePlugin(t, t.TempDir(), "reader.lua", `
+		-- @permission storage
+		-- @permission mailbox
+		local matcha = require("matcha")
+		matcha.on("email_body_render", function(email, rendered, raw)
+			matcha.store_set("seen", raw .. "/" .. email.to[1])
+			return rendered .. "!"
+		end)
+	`))
+
+	email := m.EmailToTable(1, "alice@example.com", []string{"bob@example.com"}, "Hello", time.Now(), false, "acct", "INBOX", nil)
+	if got := m.CallBodyRenderHook(email, "Hi Bob", "<p>Hi Bob</p>"); got != "Hi Bob!" {
+		t.Errorf("rendered = %q", got)
+	}
+	assertStoredValue(t, "nosy", "seen", "nil/nil/nil")
+	assertStoredValue(t, "reader", "seen", "<p>Hi Bob</p>/bob@example.com")
+}
+
+func TestComposerHookWithholdsDraftWithoutCompose(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("counter", writePlugin(t, t.TempDir(), "counter.lua", `
+		-- @permission storage
+		local matcha = require("matcha")
+		matcha.on("composer_updated", function(state)
+			matcha.store_set("seen", state.subject .. "/" .. state.body_len .. "/" .. tostring(state.body) .. "/" .. tostring(state.to))
+		end)
+	`))
+
+	m.CallComposerHook(HookComposerUpdated, "secret", "Hi", "bob@example.com", "", "")
+	assertStoredValue(t, "counter", "seen", "Hi/6/nil/nil")
+}
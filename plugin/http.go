@@ -1,10 +1,14 @@
 package plugin
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	lua "github.com/yuin/gopher-lua"
 
@@ -13,7 +17,59 @@ import (
 
 const httpMaxBodySize = 1 << 20 // 1 MB
 
-var httpClient = httpclient.New(httpclient.PluginCallTimeout)
+// MaxConcurrentHTTP is how many matcha.http_async requests a plugin may have
+// in flight at once. Further requests wait until one finishes.
+const MaxConcurrentHTTP = 4
+
+// httpMaxRedirects is how many redirects a plugin request follows.
+const httpMaxRedirects = 10
+
+var (
+	httpClient      = newPluginHTTPClient(httpclient.PluginCallTimeout)
+	httpAsyncClient = newPluginHTTPClient(httpclient.PluginAsyncCallTimeout)
+)
+
+// manifestKey is the request context key holding the manifest of the
+// plugin that made the request.
+type manifestKey struct{}
+
+// newPluginHTTPClient returns a client for plugin requests. Every redirect
+// is checked against the requesting plugin's network permission, so an
+// allowed host cannot send a plugin on to one it may not reach.
+func newPluginHTTPClient(timeout time.Duration) *http.Client {
+	client := httpclient.New(timeout)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= httpMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", httpMaxRedirects)
+		}
+		mf, _ := req.Context().Value(manifestKey{}).(Manifest)
+		if !mf.AllowsHost(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to host %s is not in the plugin's network permission", req.URL.Hostname())
+		}
+		return nil
+	}
+	return client
+}
+
+// HTTPRequest is a request queued by matcha.http_async. The orchestrator
+// runs it with Do on a worker goroutine and hands the response back with
+// ResolveHTTP.
+type HTTPRequest struct {
+	req      *http.Request
+	cancel   context.CancelFunc
+	started  bool
+	callback *lua.LFunction
+	plugin   string
+	vm       *pluginVM
+}
+
+// HTTPResponse is the outcome of an HTTPRequest.
+type HTTPResponse struct {
+	Status  int
+	Body    string
+	Headers map[string]string // lower-cased names
+	Err     error
+}
 
 // luaHTTP implements matcha.http(options) — make an HTTP request.
 //
@@ -26,30 +82,79 @@ var httpClient = httpclient.New(httpclient.PluginCallTimeout)
 // Returns (response_table, nil) on success or (nil, error_string) on failure.
 // response_table has fields: status (number), body (string), headers (table).
 func (m *Manager) luaHTTP(L *lua.LState) int { //nolint:gocritic
+	req, errMsg := m.newHTTPRequest(L, context.Background())
+	if req == nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(errMsg))
+		return 2
+	}
+
+	// Waiting on the network does not count against the plugin's budget.
+	defer m.pauseBudget(L)()
+
+	resp := doHTTP(httpClient, req)
+	if resp.Err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(resp.Err.Error()))
+		return 2
+	}
+	L.Push(httpResponseTable(L, resp))
+	L.Push(lua.LNil)
+	return 2
+}
+
+// luaHTTPAsync implements matcha.http_async(options, callback) — make an HTTP
+// request without blocking the UI. options is the same as for matcha.http.
+// callback(response, err) runs once the request finishes, with the same
+// values matcha.http returns. It is not called if the plugin is disabled in
+// the meantime.
+func (m *Manager) luaHTTPAsync(L *lua.LState) int { //nolint:gocritic
+	fn := L.CheckFunction(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, errMsg := m.newHTTPRequest(L, ctx)
+	if req == nil {
+		cancel()
+		L.Push(lua.LString(errMsg))
+		return 1
+	}
+
+	m.httpRequests = append(m.httpRequests, &HTTPRequest{
+		req:      req,
+		cancel:   cancel,
+		callback: fn,
+		plugin:   m.currentPlugin,
+		vm:       m.vmFor(L),
+	})
+	return 0
+}
+
+// newHTTPRequest builds a request from the options table at argument 1. On
+// failure it returns nil and a message for the plugin.
+func (m *Manager) newHTTPRequest(L *lua.LState, ctx context.Context) (*http.Request, string) {
 	opts := L.CheckTable(1)
 
 	// URL (required).
 	urlVal := opts.RawGetString("url")
 	if urlVal == lua.LNil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("missing required field: url"))
-		return 2
+		return nil, "missing required field: url"
 	}
 	rawURL := urlVal.String()
 
 	// URL format validation.
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("invalid URL: " + err.Error()))
-		return 2
+		return nil, "invalid URL: " + err.Error()
 	}
 
 	// Scheme validation.
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("unsupported URL scheme: only http and https are allowed"))
-		return 2
+		return nil, "unsupported URL scheme: only http and https are allowed"
+	}
+
+	manifest := m.vmFor(L).manifest
+	if !manifest.AllowsHost(parsedURL.Hostname()) {
+		return nil, "host " + parsedURL.Hostname() + " is not in the plugin's network permission"
 	}
 
 	// Method (optional, default GET).
@@ -64,11 +169,10 @@ func (m *Manager) luaHTTP(L *lua.LState) int { //nolint:gocritic
 		bodyReader = strings.NewReader(v.String())
 	}
 
-	req, err := http.NewRequest(method, rawURL, bodyReader) //nolint:noctx
+	ctx = context.WithValue(ctx, manifestKey{}, manifest)
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bodyReader)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return nil, err.Error()
 	}
 
 	// Headers (optional).
@@ -79,36 +183,110 @@ func (m *Manager) luaHTTP(L *lua.LState) int { //nolint:gocritic
 			})
 		}
 	}
+	return req, ""
+}
 
-	resp, err := httpClient.Do(req)
+// doHTTP sends req and reads up to httpMaxBodySize of the response.
+func doHTTP(client *http.Client, req *http.Request) HTTPResponse {
+	resp, err := client.Do(req)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return HTTPResponse{Err: err}
 	}
 	defer resp.Body.Close() //nolint:errcheck
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBodySize))
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return HTTPResponse{Err: err}
 	}
 
-	// Build response table.
-	result := L.NewTable()
-	result.RawSetString("status", lua.LNumber(resp.StatusCode))
-	result.RawSetString("body", lua.LString(string(body)))
-
-	headers := L.NewTable()
+	headers := make(map[string]string, len(resp.Header))
 	for k, vals := range resp.Header {
 		if len(vals) > 0 {
-			headers.RawSetString(strings.ToLower(k), lua.LString(vals[0]))
+			headers[strings.ToLower(k)] = vals[0]
 		}
 	}
+	return HTTPResponse{Status: resp.StatusCode, Body: string(body), Headers: headers}
+}
+
+// httpResponseTable converts a response to the table passed to plugins.
+func httpResponseTable(L *lua.LState, resp HTTPResponse) *lua.LTable {
+	result := L.NewTable()
+	result.RawSetString("status", lua.LNumber(resp.Status))
+	result.RawSetString("body", lua.LString(resp.Body))
+
+	headers := L.NewTable()
+	for k, v := range resp.Headers {
+		headers.RawSetString(k, lua.LString(v))
+	}
 	result.RawSetString("headers", headers)
+	return result
+}
 
-	L.Push(result)
-	L.Push(lua.LNil)
-	return 2
+// Do performs the request. It is safe to call from any goroutine.
+func (r *HTTPRequest) Do() HTTPResponse {
+	return doHTTP(httpAsyncClient, r.req)
+}
+
+// TakePendingHTTP returns the queued matcha.http_async requests that can
+// start now without exceeding any plugin's MaxConcurrentHTTP, and marks
+// them as started.
+func (m *Manager) TakePendingHTTP() []*HTTPRequest {
+	inFlight := make(map[*pluginVM]int)
+	for _, r := range m.httpRequests {
+		if r.started {
+			inFlight[r.vm]++
+		}
+	}
+	var start []*HTTPRequest
+	for _, r := range m.httpRequests {
+		if !r.started && inFlight[r.vm] < MaxConcurrentHTTP {
+			r.started = true
+			inFlight[r.vm]++
+			start = append(start, r)
+		}
+	}
+	return start
+}
+
+// ResolveHTTP calls the callback of a finished matcha.http_async request.
+func (m *Manager) ResolveHTTP(r *HTTPRequest, resp HTTPResponse) {
+	for i, pending := range m.httpRequests {
+		if pending == r {
+			m.httpRequests = append(m.httpRequests[:i], m.httpRequests[i+1:]...)
+			break
+		}
+	}
+	if r.req.Context().Err() != nil {
+		// Cancelled because the plugin was disabled or matcha is exiting.
+		return
+	}
+	r.cancel()
+
+	var args []lua.LValue
+	if resp.Err != nil {
+		args = []lua.LValue{lua.LNil, lua.LString(resp.Err.Error())}
+	} else {
+		args = []lua.LValue{httpResponseTable(r.vm.L, resp), lua.LNil}
+	}
+	if _, err := m.call(r.vm, r.plugin, r.callback, args...); err != nil {
+		log.Printf("plugin %q: http_async callback error: %v", r.plugin, err)
+	}
+}
+
+// cancelHTTP cancels a plugin's matcha.http_async requests, both queued and
+// in flight.
+func (m *Manager) cancelHTTP(vm *pluginVM) {
+	kept := m.httpRequests[:0]
+	for _, r := range m.httpRequests {
+		if r.vm != vm {
+			kept = append(kept, r)
+			continue
+		}
+		r.cancel()
+		if r.started {
+			// Stays listed until the orchestrator resolves it.
+			kept = append(kept, r)
+		}
+	}
+	m.httpRequests = kept
 }
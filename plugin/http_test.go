@@ -194,3 +194,127 @@ func TestHTTPBodyTruncation(t *testing.T) {
 		t.Errorf("expected body to be capped at %d, got %d", httpMaxBodySize, int(n))
 	}
 }
+
+func TestHTTPAsync(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("n")))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("fetcher", writePlugin(t, t.TempDir(), "fetcher.lua", `
+		-- @permission network 127.0.0.1
+		local matcha = require("matcha")
+		bodies = {}
+		for i = 1, 6 do
+			matcha.http_async({ url = "`+srv.URL+`?n=" .. i }, function(res, err)
+				table.insert(bodies, res.body)
+			end)
+		end
+		bad = matcha.http_async({ url = "https://example.com" }, function() end)
+	`))
+	L := m.vms["fetcher"].L
+	if bad := L.GetGlobal("bad"); bad == lua.LNil {
+		t.Error("http_async to an undeclared host returned no error")
+	}
+
+	first := m.TakePendingHTTP()
+	if len(first) != MaxConcurrentHTTP {
+		t.Fatalf("started %d requests, want %d", len(first), MaxConcurrentHTTP)
+	}
+	if len(m.TakePendingHTTP()) != 0 {
+		t.Fatal("started more requests while the first ones are in flight")
+	}
+	for _, r := range first {
+		m.ResolveHTTP(r, r.Do())
+	}
+	for _, r := range m.TakePendingHTTP() {
+		m.ResolveHTTP(r, r.Do())
+	}
+
+	bodies := L.GetGlobal("bodies").(*lua.LTable)
+	if bodies.Len() != 6 {
+		t.Errorf("%d callbacks ran, want 6", bodies.Len())
+	}
+	if body := bodies.RawGetInt(1).String(); body != "1" {
+		t.Errorf("first callback got body %q, want \"1\"", body)
+	}
+}
+
+func TestHTTPAsyncCancelledWhenPluginDisabled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("slow", writePlugin(t, t.TempDir(), "slow.lua", `
+		-- @permission network 127.0.0.1
+		local matcha = require("matcha")
+		called = false
+		matcha.http_async({ url = "`+srv.URL+`" }, function() called = true end)
+	`))
+	reqs := m.TakePendingHTTP()
+	if len(reqs) != 1 {
+		t.Fatalf("started %d requests, want 1", len(reqs))
+	}
+
+	done := make(chan HTTPResponse)
+	go func() { done <- reqs[0].Do() }()
+
+	vm := m.vms["slow"]
+	vm.overruns = MaxBudgetOverruns - 1
+	m.overBudget(vm)
+
+	resp := <-done
+	if resp.Err == nil {
+		t.Error("request was not cancelled")
+	}
+	m.ResolveHTTP(reqs[0], resp)
+	if vm.L.GetGlobal("called") != lua.LFalse {
+		t.Error("callback of a disabled plugin ran")
+	}
+}
+
+func TestHTTPRedirectOffAllowlistRejected(t *testing.T) {
+	reached := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer target.Close()
+	// The redirect names the target by "localhost", which the plugin may not reach.
+	offList := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, offList, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("redirect", writePlugin(t, t.TempDir(), "redirect.lua", `
+		-- @permission network 127.0.0.1
+		local matcha = require("matcha")
+		res, err = matcha.http({ url = "`+srv.URL+`" })
+	`))
+	L := m.vms["redirect"].L
+	if res := L.GetGlobal("res"); res != lua.LNil {
+		t.Errorf("expected nil response, got %v", res)
+	}
+	if errVal := L.GetGlobal("err"); !strings.Contains(errVal.String(), "localhost") {
+		t.Errorf("expected an error naming the redirect host, got %v", errVal)
+	}
+	if reached {
+		t.Error("request followed a redirect off the allowlist")
+	}
+}
@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"log"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Mailbox operation kinds.
+const (
+	MailboxMove      = "move"
+	MailboxArchive   = "archive"
+	MailboxDelete    = "delete"
+	MailboxFetchBody = "fetch_body"
+	MailboxFolders   = "folders"
+	MailboxSearch    = "search"
+)
+
+// MailboxOp is a mailbox operation queued by a plugin via matcha.move,
+// matcha.archive, matcha.delete, matcha.fetch_body, matcha.folders or
+// matcha.search. The orchestrator runs it and hands the outcome back with
+// ResolveMailboxOp.
+type MailboxOp struct {
+	Kind      string
+	UID       uint32
+	AccountID string // empty for a search across all accounts
+	Folder    string
+	Dest      string // target folder of a move
+	Query     string // search query
+	callback  *lua.LFunction
+	plugin    string
+	vm        *pluginVM
+}
+
+// MailboxEmail is an email returned to a plugin by matcha.search.
+type MailboxEmail struct {
+	UID       uint32
+	From      string
+	To        []string
+	Subject   string
+	Date      time.Time
+	IsRead    bool
+	AccountID string
+	Folder    string
+	Labels    []string
+}
+
+// MailboxResult is the outcome of a MailboxOp. Only the fields for the
+// op's kind are set.
+type MailboxResult struct {
+	Body        string
+	MIMEType    string
+	Attachments []string // file names
+	Folders     []string
+	Emails      []MailboxEmail
+	Err         error
+}
+
+// matcha.move(uid, account_id, folder, dest [, callback]) — queue moving an
+// email to another folder. callback(err) runs when the move finishes.
+func (m *Manager) luaMove(L *lua.LState) int { //nolint:gocritic
+	m.pendingMailboxOps = append(m.pendingMailboxOps, MailboxOp{
+		Kind:      MailboxMove,
+		UID:       uint32(L.CheckInt(1)),
+		AccountID: L.CheckString(2),
+		Folder:    L.CheckString(3),
+		Dest:      L.CheckString(4),
+		callback:  L.OptFunction(5, nil),
+		plugin:    m.currentPlugin,
+		vm:        m.vmFor(L),
+	})
+	return 0
+}
+
+// matcha.archive(uid, account_id, folder [, callback]) — queue archiving an
+// email. callback(err) runs when the archive finishes.
+func (m *Manager) luaArchive(L *lua.LState) int { //nolint:gocritic
+	m.queueMailboxOp(L, MailboxArchive)
+	return 0
+}
+
+// matcha.delete(uid, account_id, folder [, callback]) — queue deleting an
+// email. callback(err) runs when the delete finishes.
+func (m *Manager) luaDelete(L *lua.LState) int { //nolint:gocritic
+	m.queueMailboxOp(L, MailboxDelete)
+	return 0
+}
+
+func (m *Manager) queueMailboxOp(L *lua.LState, kind string) { //nolint:gocritic
+	m.pendingMailboxOps = append(m.pendingMailboxOps, MailboxOp{
+		Kind:      kind,
+		UID:       uint32(L.CheckInt(1)),
+		AccountID: L.CheckString(2),
+		Folder:    L.CheckString(3),
+		callback:  L.OptFunction(4, nil),
+		plugin:    m.currentPlugin,
+		vm:        m.vmFor(L),
+	})
+}
+
+// matcha.fetch_body(uid, account_id, folder, callback) — fetch an email's
+// body. callback(body, err) receives a table with body, mime_type and
+// attachments (a list of file names).
+func (m *Manager) luaFetchBody(L *lua.LState) int { //nolint:gocritic
+	m.pendingMailboxOps = append(m.pendingMailboxOps, MailboxOp{
+		Kind:      MailboxFetchBody,
+		UID:       uint32(L.CheckInt(1)),
+		AccountID: L.CheckString(2),
+		Folder:    L.CheckString(3),
+		callback:  L.CheckFunction(4),
+		plugin:    m.currentPlugin,
+		vm:        m.vmFor(L),
+	})
+	return 0
+}
+
+// matcha.folders(account_id, callback) — list an account's folders.
+// callback(folders, err) receives a list of folder names.
+func (m *Manager) luaFolders(L *lua.LState) int { //nolint:gocritic
+	m.pendingMailboxOps = append(m.pendingMailboxOps, MailboxOp{
+		Kind:      MailboxFolders,
+		AccountID: L.CheckString(1),
+		callback:  L.CheckFunction(2),
+		plugin:    m.currentPlugin,
+		vm:        m.vmFor(L),
+	})
+	return 0
+}
+
+// matcha.search(query, callback [, account_id]) — search using the same
+// query syntax as the search bar, across all accounts unless account_id is
+// given. callback(emails, err) receives a list of email tables.
+func (m *Manager) luaSearch(L *lua.LState) int { //nolint:gocritic
+	m.pendingMailboxOps = append(m.pendingMailboxOps, MailboxOp{
+		Kind:      MailboxSearch,
+		Query:     L.CheckString(1),
+		callback:  L.CheckFunction(2),
+		AccountID: L.OptString(3, ""),
+		plugin:    m.currentPlugin,
+		vm:        m.vmFor(L),
+	})
+	return 0
+}
+
+// TakePendingMailboxOps returns and clears all pending mailbox operations.
+func (m *Manager) TakePendingMailboxOps() []MailboxOp {
+	if len(m.pendingMailboxOps) == 0 {
+		return nil
+	}
+	ops := m.pendingMailboxOps
+	m.pendingMailboxOps = nil
+	return ops
+}
+
+// ResolveMailboxOp calls the op's callback with its result. Errors are
+// passed to Lua as strings, with nil in place of the value.
+func (m *Manager) ResolveMailboxOp(op MailboxOp, res MailboxResult) {
+	if op.callback == nil {
+		return
+	}
+	var errValue lua.LValue = lua.LNil
+	if res.Err != nil {
+		errValue = lua.LString(res.Err.Error())
+	}
+
+	var args []lua.LValue
+	switch op.Kind {
+	case MailboxMove, MailboxArchive, MailboxDelete:
+		args = []lua.LValue{errValue}
+	default:
+		var value lua.LValue = lua.LNil
+		if res.Err == nil {
+			value = m.mailboxResultValue(op.Kind, res)
+		}
+		args = []lua.LValue{value, errValue}
+	}
+
+	if _, err := m.call(op.vm, op.plugin, op.callback, args...); err != nil {
+		log.Printf("plugin %s callback error: %v", op.Kind, err)
+	}
+}
+
+func (m *Manager) mailboxResultValue(kind string, res MailboxResult) lua.LValue {
+	L := m.state
+	switch kind {
+	case MailboxFetchBody:
+		t := L.NewTable()
+		t.RawSetString("body", lua.LString(res.Body))
+		t.RawSetString("mime_type", lua.LString(res.MIMEType))
+		attachments := L.NewTable()
+		for i, name := range res.Attachments {
+			attachments.RawSetInt(i+1, lua.LString(name))
+		}
+		t.RawSetString("attachments", attachments)
+		return t
+	case MailboxFolders:
+		t := L.NewTable()
+		for i, name := range res.Folders {
+			t.RawSetInt(i+1, lua.LString(name))
+		}
+		return t
+	case MailboxSearch:
+		t := L.NewTable()
+		for i, e := range res.Emails {
+			t.RawSetInt(i+1, m.EmailToTable(e.UID, e.From, e.To, e.Subject, e.Date, e.IsRead, e.AccountID, e.Folder, e.Labels))
+		}
+		return t
+	}
+	return lua.LNil
+}
@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLuaMailboxOpsQueued(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+
+	err := m.state.DoString(`
+		local matcha = require("matcha")
+		matcha.move(1, "acc1", "INBOX", "Lists")
+		matcha.archive(2, "acc1", "INBOX")
+		matcha.delete(3, "acc1", "Spam", function() end)
+		matcha.fetch_body(4, "acc1", "INBOX", function() end)
+		matcha.folders("acc1", function() end)
+		matcha.search("from:alice", function() end, "acc2")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := m.TakePendingMailboxOps()
+	want := []MailboxOp{
+		{Kind: MailboxMove, UID: 1, AccountID: "acc1", Folder: "INBOX", Dest: "Lists"},
+		{Kind: MailboxArchive, UID: 2, AccountID: "acc1", Folder: "INBOX"},
+		{Kind: MailboxDelete, UID: 3, AccountID: "acc1", Folder: "Spam"},
+		{Kind: MailboxFetchBody, UID: 4, AccountID: "acc1", Folder: "INBOX"},
+		{Kind: MailboxFolders, AccountID: "acc1"},
+		{Kind: MailboxSearch, AccountID: "acc2", Query: "from:alice"},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("got %d ops, want %d: %+v", len(ops), len(want), ops)
+	}
+	for i := range want {
+		got := ops[i]
+		got.callback, got.vm = nil, nil
+		if got != want[i] {
+			t.Errorf("op %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if ops[0].callback != nil || ops[2].callback == nil {
+		t.Error("optional callbacks not recorded")
+	}
+	if again := m.TakePendingMailboxOps(); again != nil {
+		t.Errorf("ops not cleared: %+v", again)
+	}
+
+	if err := m.state.DoString(`require("matcha").fetch_body(1, "acc1", "INBOX")`); err == nil {
+		t.Error("fetch_body without a callback should fail")
+	}
+}
+
+func TestResolveMailboxOp(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+
+	err := m.state.DoString(`
+		local matcha = require("matcha")
+		results = {}
+		matcha.fetch_body(7, "acc1", "INBOX", function(msg, err)
+			results.body = msg.body
+			results.mime = msg.mime_type
+			results.attachment = msg.attachments[1]
+			-- Ops queued from a callback are picked up on the next drain.
+			matcha.archive(7, "acc1", "INBOX")
+		end)
+		matcha.search("is:unread", function(emails, err)
+			results.subject = emails[1].subject
+			results.folder = emails[1].folder
+		end)
+		matcha.move(7, "acc1", "INBOX", "Gone", function(err)
+			results.move_err = err
+		end)
+		matcha.folders("acc1", function(folders, err)
+			results.folders = folders
+			results.folders_err = err
+		end)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := m.TakePendingMailboxOps()
+	m.ResolveMailboxOp(ops[0], MailboxResult{Body: "<p>hi</p>", MIMEType: "text/html", Attachments: []string{"a.pdf"}})
+	m.ResolveMailboxOp(ops[1], MailboxResult{Emails: []MailboxEmail{{UID: 9, Subject: "Hello", Date: time.Now(), Folder: "INBOX"}}})
+	m.ResolveMailboxOp(ops[2], MailboxResult{Err: errors.New("no such folder")})
+	m.ResolveMailboxOp(ops[3], MailboxResult{Err: errors.New("offline")})
+
+	for expr, want := range map[string]string{
+		"results.body":          "<p>hi</p>",
+		"results.mime":          "text/html",
+		"results.attachment":    "a.pdf",
+		"results.subject":       "Hello",
+		"results.folder":        "INBOX",
+		"results.move_err":      "no such folder",
+		"results.folders_err":   "offline",
+		"type(results.folders)": "nil",
+	} {
+		if err := m.state.DoString("value = tostring(" + expr + ")"); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.state.GetGlobal("value").String(); got != want {
+			t.Errorf("%s = %q, want %q", expr, got, want)
+		}
+	}
+
+	chained := m.TakePendingMailboxOps()
+	if len(chained) != 1 || chained[0].Kind != MailboxArchive {
+		t.Errorf("chained ops = %+v", chained)
+	}
+}
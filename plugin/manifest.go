@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Permissions a plugin can declare in its manifest.
+const (
+	// PermNetwork allows matcha.http requests to the listed hosts.
+	PermNetwork = "network"
+	// PermStorage allows the matcha.store_* functions.
+	PermStorage = "storage"
+	// PermCompose allows reading the body and recipients of the message
+	// being composed or sent, and changing it.
+	PermCompose = "compose"
+	// PermMailbox allows reading email bodies and recipients, searching,
+	// and changing flags, labels and folders.
+	PermMailbox = "mailbox"
+)
+
+// Manifest is the set of permissions a plugin declares in the comment
+// header at the top of its file, one per line:
+//
+//	-- @permission network api.example.com *.example.org
+//	-- @permission storage
+//	-- @permission compose
+//	-- @permission mailbox
+//
+// A plugin without a manifest can still register hooks and key bindings,
+// show notifications and statuses, and declare settings.
+type Manifest struct {
+	// Hosts are the host names matcha.http may reach. "*.example.com"
+	// matches any subdomain of example.com and "*" matches every host.
+	Hosts   []string
+	Storage bool
+	Compose bool
+	Mailbox bool
+}
+
+// fullAccess is the manifest of the host VM, which runs no plugin.
+var fullAccess = Manifest{Hosts: []string{"*"}, Storage: true, Compose: true, Mailbox: true}
+
+// ParseManifest reads the manifest from the leading comment block of a
+// plugin's source.
+func ParseManifest(src []byte) (Manifest, error) {
+	var mf Manifest
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#!") {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "--"))
+		if len(fields) == 0 || fields[0] != "@permission" {
+			continue
+		}
+		if len(fields) < 2 {
+			return Manifest{}, fmt.Errorf("manifest: @permission needs a name")
+		}
+		name, args := fields[1], fields[2:]
+		switch name {
+		case PermNetwork:
+			if len(args) == 0 {
+				return Manifest{}, fmt.Errorf("manifest: the %s permission needs at least one host", name)
+			}
+			for _, host := range args {
+				mf.Hosts = append(mf.Hosts, strings.ToLower(host))
+			}
+			continue
+		case PermStorage:
+			mf.Storage = true
+		case PermCompose:
+			mf.Compose = true
+		case PermMailbox:
+			mf.Mailbox = true
+		default:
+			return Manifest{}, fmt.Errorf("manifest: unknown permission %q", name)
+		}
+		if len(args) > 0 {
+			return Manifest{}, fmt.Errorf("manifest: the %s permission takes no arguments", name)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Manifest{}, err
+	}
+	return mf, nil
+}
+
+// Has reports whether the manifest grants a permission. For PermNetwork it
+// reports whether any host is allowed.
+func (mf Manifest) Has(perm string) bool {
+	switch perm {
+	case PermNetwork:
+		return len(mf.Hosts) > 0
+	case PermStorage:
+		return mf.Storage
+	case PermCompose:
+		return mf.Compose
+	case PermMailbox:
+		return mf.Mailbox
+	}
+	return false
+}
+
+// AllowsHost reports whether matcha.http may reach host.
+func (mf Manifest) AllowsHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range mf.Hosts {
+		switch {
+		case h == "*" || h == host:
+			return true
+		case strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// Summary describes the permissions for a consent prompt, one per line.
+// It is empty when the manifest grants nothing.
+func (mf Manifest) Summary() []string {
+	var lines []string
+	if len(mf.Hosts) > 0 {
+		if mf.AllowsHost("*") {
+			lines = append(lines, "Connect to any website")
+		} else {
+			lines = append(lines, "Connect to "+strings.Join(mf.Hosts, ", "))
+		}
+	}
+	if mf.Storage {
+		lines = append(lines, "Store data on this computer")
+	}
+	if mf.Compose {
+		lines = append(lines, "Read, change, block or redirect the emails you write")
+	}
+	if mf.Mailbox {
+		lines = append(lines, "Read email bodies and recipients, search your mail, and mark, label, move or delete emails")
+	}
+	return lines
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	mf, err := ParseManifest([]byte(`#!/usr/bin/env lua
+-- webhook.lua
+-- Posts new mail to a webhook.
+--
+-- @permission network hooks.example.com *.example.org
+-- @permission storage
+--   @permission   mailbox
+
+local matcha = require("matcha")
+-- @permission compose
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Manifest{Hosts: []string{"hooks.example.com", "*.example.org"}, Storage: true, Mailbox: true}
+	if !reflect.DeepEqual(mf, want) {
+		t.Errorf("manifest = %+v, want %+v", mf, want)
+	}
+
+	for _, src := range []string{
+		"-- @permission camera",
+		"-- @permission network",
+		"-- @permission storage everything",
+		"-- @permission",
+	} {
+		if _, err := ParseManifest([]byte(src)); err == nil {
+			t.Errorf("ParseManifest(%q) succeeded", src)
+		}
+	}
+
+	if mf, err := ParseManifest([]byte("local matcha = require(\"matcha\")\n")); err != nil || len(mf.Summary()) != 0 {
+		t.Errorf("plugin without a manifest = %+v, %v", mf, err)
+	}
+}
+
+func TestManifestAllowsHost(t *testing.T) {
+	mf := Manifest{Hosts: []string{"api.example.com", "*.example.org"}}
+	for host, want := range map[string]bool{
+		"api.example.com":  true,
+		"API.example.com":  true,
+		"example.com":      false,
+		"a.b.example.org":  true,
+		"example.org":      false,
+		"evil-example.org": false,
+	} {
+		if got := mf.AllowsHost(host); got != want {
+			t.Errorf("AllowsHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if !(Manifest{Hosts: []string{"*"}}).AllowsHost("anything.test") {
+		t.Error(`"*" does not allow every host`)
+	}
+}
+
+func TestUndeclaredPermissionsAreDenied(t *testing.T) {
+	setTestHome(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok")) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("sneaky", writePlugin(t, t.TempDir(), "sneaky.lua", `
+		-- @permission network api.example.com
+		local matcha = require("matcha")
+		results = {}
+		results.store = pcall(matcha.store_set, "k", "v")
+		results.mark = pcall(matcha.mark_read, 1, "acc", "INBOX")
+		results.compose = pcall(matcha.set_compose_field, "to", "eve@example.com")
+		local res, err = matcha.http({ url = "`+srv.URL+`" })
+		results.http = res == nil and err ~= nil
+		matcha.on("email_send_before", function(email)
+			return { cancel = true, reason = "blocked" }
+		end)
+	`))
+	if len(m.Plugins()) != 1 {
+		t.Fatal("plugin did not load")
+	}
+
+	results := m.vms["sneaky"].L.GetGlobal("results")
+	for _, key := range []string{"store", "mark", "compose"} {
+		if m.vms["sneaky"].L.GetField(results, key).String() != "false" {
+			t.Errorf("matcha call needing %s permission succeeded", key)
+		}
+	}
+	if m.vms["sneaky"].L.GetField(results, "http").String() != "true" {
+		t.Error("request to an undeclared host succeeded")
+	}
+	if len(m.TakePendingFlagOps()) != 0 || len(m.TakePendingFields()) != 0 {
+		t.Error("denied calls were queued")
+	}
+	if verdict := m.CallSendHook(HookEmailSendBefore, &OutgoingEmail{}); verdict.Cancel {
+		t.Error("plugin without compose permission cancelled a send")
+	}
+}
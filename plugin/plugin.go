@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -16,6 +17,11 @@ type KeyBinding struct {
 	Description string
 	Fn          *lua.LFunction
 	Plugin      string
+	vm          *pluginVM
+	// ext and extID identify the binding of an external plugin, which has
+	// no Fn.
+	ext   *externalPlugin
+	extID string
 }
 
 // FlagOp is a pending flag change queued by a plugin via matcha.mark_read / matcha.mark_unread.
@@ -26,17 +32,37 @@ type FlagOp struct {
 	Read      bool // true = mark read, false = mark unread
 }
 
-// Manager manages the Lua VM and loaded plugins.
+// LabelOp is a pending label change queued by a plugin via matcha.add_label / matcha.remove_label.
+type LabelOp struct {
+	UID       uint32
+	AccountID string
+	Folder    string
+	Label     string
+	Add       bool // true = add the label, false = remove it
+}
+
+// Manager manages the plugins and the Lua VMs they run in.
+//
+// Each plugin gets its own Lua state, so plugins cannot read or overwrite
+// each other's globals, and every call into a plugin runs under a time
+// budget and a memory limit (see DefaultCallBudget and DefaultMemoryLimit).
 //
-// Manager is not safe for concurrent use. The Lua VM itself is single-
-// threaded, and all hook callbacks, key-binding invocations, and API calls
-// must be dispatched from the same goroutine that owns the Manager (the
-// orchestrator). Mutable Manager state (hooks, stores, bindings,
+// Manager is not safe for concurrent use. The Lua VMs are single-threaded,
+// and all hook callbacks, key-binding invocations, and API calls must be
+// dispatched from the same goroutine that owns the Manager (the
+// orchestrator). Mutable Manager state (hooks, stores, bindings, timers,
 // currentPlugin, pending* fields) is therefore unprotected by design; callers
 // that need to drive plugin events from multiple goroutines must serialize
 // access externally.
 type Manager struct {
-	state         *lua.LState
+	// state is the host Lua state. No plugin runs in it; it is used to
+	// build the tables passed to callbacks.
+	state *lua.LState
+	// vms holds each plugin's Lua state by plugin name. The host state is
+	// registered under "".
+	vms           map[string]*pluginVM
+	budget        time.Duration
+	memoryLimit   uint64
 	hooks         map[string][]registeredHook
 	plugins       []string
 	currentPlugin string
@@ -54,6 +80,20 @@ type Manager struct {
 	pendingPrompt *PendingPrompt
 	// pendingFlagOps queues flag changes (read/unread) requested by plugins.
 	pendingFlagOps []FlagOp
+	// pendingLabelOps queues label changes requested by plugins.
+	pendingLabelOps []LabelOp
+	// pendingMailboxOps queues moves, deletes, fetches and searches requested by plugins.
+	pendingMailboxOps []MailboxOp
+	// timers holds the callbacks scheduled by matcha.after and matcha.every, by id.
+	timers      map[int]*pluginTimer
+	nextTimerID int
+	// httpRequests holds matcha.http_async requests that are queued or in flight.
+	httpRequests []*HTTPRequest
+	// externals are the plugins running as separate processes. Their
+	// requests arrive on externalCalls; stop is closed by Close.
+	externals     []*externalPlugin
+	externalCalls chan ExternalCall
+	stop          chan struct{}
 	// suppressAutoRead is set by matcha.suppress_auto_read() inside email_viewed callbacks.
 	suppressAutoRead bool
 
@@ -63,38 +103,25 @@ type Manager struct {
 	pluginValues map[string]map[string]interface{}
 }
 
-// NewManager creates a new plugin manager with a Lua VM.
+// NewManager creates a new plugin manager with a host Lua VM.
 func NewManager() *Manager {
 	m := &Manager{
+		vms:           make(map[string]*pluginVM),
+		budget:        DefaultCallBudget,
+		memoryLimit:   DefaultMemoryLimit,
 		hooks:         make(map[string][]registeredHook),
 		statuses:      make(map[string]string),
 		pendingFields: make(map[string]string),
+		timers:        make(map[int]*pluginTimer),
+		externalCalls: make(chan ExternalCall),
+		stop:          make(chan struct{}),
 		pluginSchemas: make(map[string][]SettingDef),
 		pluginValues:  make(map[string]map[string]interface{}),
 	}
 
-	L := lua.NewState(lua.Options{
-		SkipOpenLibs: true,
-	})
-
-	// Open only safe standard libraries (no os, io, debug)
-	for _, lib := range []struct {
-		name string
-		fn   lua.LGFunction
-	}{
-		{lua.LoadLibName, lua.OpenPackage},
-		{lua.BaseLibName, lua.OpenBase},
-		{lua.TabLibName, lua.OpenTable},
-		{lua.StringLibName, lua.OpenString},
-		{lua.MathLibName, lua.OpenMath},
-	} {
-		L.Push(L.NewFunction(lib.fn))
-		L.Push(lua.LString(lib.name))
-		L.Call(1, 0)
-	}
-
-	m.state = L
-	m.registerAPI()
+	host := m.newVM("", fullAccess)
+	m.vms[""] = host
+	m.state = host.L
 
 	return m
 }
@@ -125,21 +152,44 @@ func (m *Manager) LoadPlugins() {
 			// Single-file plugin
 			name := strings.TrimSuffix(entry.Name(), ".lua")
 			m.loadPlugin(name, path)
+		} else if strings.HasSuffix(entry.Name(), ExternalSuffix) {
+			// External plugin: an executable speaking pluginrpc
+			name := strings.TrimSuffix(entry.Name(), ExternalSuffix)
+			m.loadExternal(name, path)
 		}
 	}
 }
 
 func (m *Manager) loadPlugin(name, path string) {
+	if _, ok := m.vms[name]; ok || name == "" {
+		log.Printf("plugin %q: load error: a plugin with this name is already loaded", name)
+		return
+	}
+
 	previousPlugin := m.currentPlugin
 	m.currentPlugin = name
 	defer func() {
 		m.currentPlugin = previousPlugin
 	}()
 
-	if err := m.state.DoFile(path); err != nil {
+	src, err := os.ReadFile(path)
+	if err != nil {
 		log.Printf("plugin %q: load error: %v", name, err)
 		return
 	}
+	mf, err := ParseManifest(src)
+	if err != nil {
+		log.Printf("plugin %q: load error: %v", name, err)
+		return
+	}
+
+	vm := m.newVM(name, mf)
+	m.vms[name] = vm
+	if err := m.withBudget(vm, func() error { return vm.L.DoFile(path) }); err != nil {
+		log.Printf("plugin %q: load error: %v", name, err)
+		m.stopPending(vm)
+		return
+	}
 	m.plugins = append(m.plugins, name)
 	log.Printf("plugin %q: loaded", name)
 }
@@ -179,11 +229,11 @@ func (m *Manager) TakePendingFields() map[string]string {
 	return fields
 }
 
-// Bindings returns all plugin-registered key bindings for the given view area.
+// Bindings returns the key bindings of enabled plugins for the given view area.
 func (m *Manager) Bindings(area string) []KeyBinding {
 	var result []KeyBinding
 	for _, b := range m.bindings {
-		if b.Area == area {
+		if b.Area == area && m.DisabledReason(b.Plugin) == "" {
 			result = append(result, b)
 		}
 	}
@@ -205,6 +255,16 @@ func (m *Manager) TakePendingFlagOps() []FlagOp {
 	return ops
 }
 
+// TakePendingLabelOps returns and clears all pending label operations.
+func (m *Manager) TakePendingLabelOps() []LabelOp {
+	if len(m.pendingLabelOps) == 0 {
+		return nil
+	}
+	ops := m.pendingLabelOps
+	m.pendingLabelOps = nil
+	return ops
+}
+
 // TakeAutoReadSuppressed returns true (and resets the flag) if a plugin
 // called matcha.suppress_auto_read() during the current email_viewed callback.
 func (m *Manager) TakeAutoReadSuppressed() bool {
@@ -213,14 +273,17 @@ func (m *Manager) TakeAutoReadSuppressed() bool {
 	return v
 }
 
-// LuaState returns the Lua VM state for building tables.
+// LuaState returns the host Lua state for building tables.
 func (m *Manager) LuaState() *lua.LState {
 	return m.state
 }
 
-// Close shuts down the Lua VM.
+// Close stops the external plugins, cancels all timers and HTTP requests,
+// and shuts down the Lua VMs.
 func (m *Manager) Close() {
-	if m.state != nil {
-		m.state.Close()
+	m.closeExternals()
+	for _, vm := range m.vms {
+		m.stopPending(vm)
+		vm.L.Close()
 	}
 }
@@ -10,6 +10,8 @@ import (
 type PendingPrompt struct {
 	Placeholder string
 	callback    *lua.LFunction
+	plugin      string
+	vm          *pluginVM
 }
 
 // luaPrompt implements matcha.prompt(placeholder, callback).
@@ -22,6 +24,8 @@ func (m *Manager) luaPrompt(L *lua.LState) int { //nolint:gocritic
 	m.pendingPrompt = &PendingPrompt{
 		Placeholder: placeholder,
 		callback:    fn,
+		plugin:      m.currentPlugin,
+		vm:          m.vmFor(L),
 	}
 	return 0
 }
@@ -41,11 +45,7 @@ func (m *Manager) ResolvePrompt(prompt *PendingPrompt, input string) {
 	if prompt == nil || prompt.callback == nil {
 		return
 	}
-	if err := m.state.CallByParam(lua.P{
-		Fn:      prompt.callback,
-		NRet:    0,
-		Protect: true,
-	}, lua.LString(input)); err != nil {
+	if _, err := m.call(prompt.vm, prompt.plugin, prompt.callback, lua.LString(input)); err != nil {
 		log.Printf("plugin prompt callback error: %v", err)
 	}
 }
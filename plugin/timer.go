@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// MinTimerInterval is the shortest interval matcha.every accepts; shorter
+// ones are raised to it.
+const MinTimerInterval = time.Second
+
+// timerTypeName is the Lua metatable name of timer handles.
+const timerTypeName = "matcha.timer"
+
+// pluginTimer is a callback scheduled by matcha.after or matcha.every.
+type pluginTimer struct {
+	id       int
+	due      time.Time
+	interval time.Duration // 0 for one-shot timers
+	fn       *lua.LFunction
+	plugin   string
+	vm       *pluginVM
+}
+
+// registerTimerType adds the metatable for timer handles to a Lua VM.
+func (m *Manager) registerTimerType(L *lua.LState) {
+	mt := L.NewTypeMetatable(timerTypeName)
+	L.SetField(mt, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"cancel": m.luaTimerCancel,
+	}))
+}
+
+// matcha.after(seconds, fn) — call fn once after the given delay.
+// Returns a handle whose cancel() method stops the timer.
+func (m *Manager) luaAfter(L *lua.LState) int { //nolint:gocritic
+	return m.addTimer(L, false)
+}
+
+// matcha.every(seconds, fn) — call fn repeatedly at the given interval.
+// Returns a handle whose cancel() method stops the timer.
+func (m *Manager) luaEvery(L *lua.LState) int { //nolint:gocritic
+	return m.addTimer(L, true)
+}
+
+func (m *Manager) addTimer(L *lua.LState, repeat bool) int {
+	seconds := float64(L.CheckNumber(1))
+	fn := L.CheckFunction(2)
+	if seconds < 0 {
+		L.ArgError(1, "delay must not be negative")
+		return 0
+	}
+
+	d := time.Duration(seconds * float64(time.Second))
+	t := &pluginTimer{
+		due:    time.Now().Add(d),
+		fn:     fn,
+		plugin: m.currentPlugin,
+		vm:     m.vmFor(L),
+	}
+	if repeat {
+		t.interval = max(d, MinTimerInterval)
+		t.due = time.Now().Add(t.interval)
+	}
+	m.nextTimerID++
+	t.id = m.nextTimerID
+	m.timers[t.id] = t
+
+	ud := L.NewUserData()
+	ud.Value = t.id
+	L.SetMetatable(ud, L.GetTypeMetatable(timerTypeName))
+	L.Push(ud)
+	return 1
+}
+
+// handle:cancel() — stop a timer. Cancelling a timer that already fired or
+// was cancelled does nothing.
+func (m *Manager) luaTimerCancel(L *lua.LState) int { //nolint:gocritic
+	ud := L.CheckUserData(1)
+	id, ok := ud.Value.(int)
+	if !ok {
+		L.ArgError(1, "timer handle expected")
+		return 0
+	}
+	delete(m.timers, id)
+	return 0
+}
+
+// NextTimer returns when the earliest plugin timer is due.
+func (m *Manager) NextTimer() (time.Time, bool) {
+	var next time.Time
+	for _, t := range m.timers {
+		if next.IsZero() || t.due.Before(next) {
+			next = t.due
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// RunTimers calls the callbacks of the timers due at now, in the order they
+// fell due. Repeating timers are scheduled again; one-shot timers are
+// removed.
+func (m *Manager) RunTimers(now time.Time) {
+	var due []*pluginTimer
+	for _, t := range m.timers {
+		if !t.due.After(now) {
+			due = append(due, t)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].due.Equal(due[j].due) {
+			return due[i].id < due[j].id
+		}
+		return due[i].due.Before(due[j].due)
+	})
+
+	for _, t := range due {
+		// An earlier callback may have cancelled this timer.
+		if _, ok := m.timers[t.id]; !ok {
+			continue
+		}
+		if t.interval > 0 {
+			t.due = now.Add(t.interval)
+		} else {
+			delete(m.timers, t.id)
+		}
+		if _, err := m.call(t.vm, t.plugin, t.fn); err != nil {
+			log.Printf("plugin %q: timer error: %v", t.plugin, err)
+		}
+	}
+}
+
+// clearTimers cancels all timers of a plugin.
+func (m *Manager) clearTimers(vm *pluginVM) {
+	for id, t := range m.timers {
+		if t.vm == vm {
+			delete(m.timers, id)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimers(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("clock", writePlugin(t, t.TempDir(), "clock.lua", `
+		local matcha = require("matcha")
+		ticks, once, cancelled = 0, 0, 0
+		local ticker
+		ticker = matcha.every(2, function()
+			ticks = ticks + 1
+			if ticks == 3 then ticker:cancel() end
+		end)
+		matcha.after(1, function() once = once + 1 end)
+		matcha.after(1, function() cancelled = cancelled + 1 end):cancel()
+	`))
+	L := m.vms["clock"].L
+
+	due, ok := m.NextTimer()
+	if !ok || time.Until(due) > time.Second {
+		t.Fatalf("NextTimer() = %v, %v", due, ok)
+	}
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		m.RunTimers(now.Add(time.Duration(i) * 2 * time.Second))
+	}
+	if got := L.GetGlobal("ticks").String(); got != "3" {
+		t.Errorf("repeating timer ran %s times, want 3", got)
+	}
+	if got := L.GetGlobal("once").String(); got != "1" {
+		t.Errorf("one-shot timer ran %s times, want 1", got)
+	}
+	if got := L.GetGlobal("cancelled").String(); got != "0" {
+		t.Error("cancelled timer ran")
+	}
+	if _, ok := m.NextTimer(); ok {
+		t.Error("timers left after all were cancelled or fired")
+	}
+}
+
+func TestTimersClearedWhenPluginDisabled(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+	m.SetCallBudget(20 * time.Millisecond)
+
+	m.loadPlugin("spin", writePlugin(t, t.TempDir(), "spin.lua", `
+		local matcha = require("matcha")
+		matcha.every(1, function()
+			while true do end
+		end)
+	`))
+
+	now := time.Now()
+	for i := 1; i <= MaxBudgetOverruns; i++ {
+		m.RunTimers(now.Add(time.Duration(i) * time.Minute))
+	}
+	if m.DisabledReason("spin") == "" {
+		t.Fatal("runaway timer did not disable the plugin")
+	}
+	if _, ok := m.NextTimer(); ok {
+		t.Error("disabled plugin still has timers")
+	}
+
+	m.loadPlugin("broken", writePlugin(t, t.TempDir(), "broken.lua", `
+		local matcha = require("matcha")
+		matcha.after(1, function() end)
+		error("failed to load")
+	`))
+	if _, ok := m.NextTimer(); ok {
+		t.Error("plugin that failed to load left a timer")
+	}
+}
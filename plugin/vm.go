@@ -0,0 +1,301 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/metrics"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// DefaultCallBudget is how long a single call into a plugin — loading it,
+// or running one hook, key binding or callback — may execute Lua before it
+// is stopped. Time spent waiting on matcha.http does not count.
+const DefaultCallBudget = time.Second
+
+// MaxBudgetOverruns is how many times a plugin may exceed its budget before
+// it is disabled for the rest of the session.
+const MaxBudgetOverruns = 3
+
+// DefaultMemoryLimit is how much a single call into a plugin may grow the
+// heap before it is stopped. A plugin that goes over it is disabled at once.
+const DefaultMemoryLimit = 256 << 20
+
+// memoryCheckInterval is how often the heap is sampled during a call.
+const memoryCheckInterval = 10 * time.Millisecond
+
+// Limits on each plugin's Lua stack, which bound runaway recursion. They do
+// not limit the memory held in tables and strings; DefaultMemoryLimit does.
+const (
+	vmCallStackSize   = 200
+	vmRegistrySize    = 1024 * 4
+	vmRegistryMaxSize = 1024 * 64
+)
+
+// errPluginDisabled is returned for calls into a plugin that was disabled.
+var errPluginDisabled = errors.New("plugin is disabled")
+
+// pluginVM is the Lua state a plugin runs in. Every plugin gets its own, so
+// plugins cannot see or overwrite each other's globals.
+type pluginVM struct {
+	name     string
+	L        *lua.LState
+	manifest Manifest
+
+	// timer cancels the running call when its budget runs out; deadline is
+	// when it fires. Both are only set while a call is running.
+	timer    *time.Timer
+	deadline time.Time
+
+	overruns int
+	disabled bool
+	reason   string
+}
+
+// DisabledPlugin is a plugin that was switched off for the session.
+type DisabledPlugin struct {
+	Name   string
+	Reason string
+}
+
+// newVM creates a Lua state with the safe standard libraries and the
+// matcha module, limited to what the manifest grants.
+func (m *Manager) newVM(name string, mf Manifest) *pluginVM {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:        true,
+		CallStackSize:       vmCallStackSize,
+		RegistrySize:        vmRegistrySize,
+		RegistryMaxSize:     vmRegistryMaxSize,
+		MinimizeStackMemory: true,
+	})
+
+	// Open only safe standard libraries (no os, io, debug)
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.LoadLibName, lua.OpenPackage},
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	m.registerAPI(L, mf)
+
+	return &pluginVM{name: name, L: L, manifest: mf}
+}
+
+// vmFor returns the VM that owns a Lua state.
+func (m *Manager) vmFor(L *lua.LState) *pluginVM {
+	for _, vm := range m.vms {
+		if vm.L == L {
+			return vm
+		}
+	}
+	return m.vms[""]
+}
+
+// call runs fn, a function created in vm, under vm's budget with
+// currentPlugin set to plugin, and returns fn's first result.
+func (m *Manager) call(vm *pluginVM, plugin string, fn *lua.LFunction, args ...lua.LValue) (lua.LValue, error) {
+	if vm.disabled {
+		return lua.LNil, errPluginDisabled
+	}
+
+	previousPlugin := m.currentPlugin
+	m.currentPlugin = plugin
+	defer func() {
+		m.currentPlugin = previousPlugin
+	}()
+
+	var ret lua.LValue = lua.LNil
+	err := m.withBudget(vm, func() error {
+		if err := vm.L.CallByParam(lua.P{
+			Fn:      fn,
+			NRet:    1,
+			Protect: true,
+		}, args...); err != nil {
+			return err
+		}
+		ret = vm.L.Get(-1)
+		vm.L.Pop(1)
+		return nil
+	})
+	return ret, err
+}
+
+// withBudget runs f with a context on the plugin's state that is cancelled
+// once the budget runs out, which makes the Lua VM raise an error at its
+// next instruction.
+func (m *Manager) withBudget(vm *pluginVM, f func() error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vm.deadline = time.Now().Add(m.budget)
+	vm.timer = time.AfterFunc(m.budget, cancel)
+	vm.L.SetContext(ctx)
+	stopWatching := m.watchMemory(cancel)
+	err := f()
+	overMemory := stopWatching()
+	vm.timer.Stop()
+	vm.timer = nil
+	vm.L.RemoveContext()
+
+	if overMemory {
+		m.overMemory(vm)
+		return fmt.Errorf("used more than %d MB of memory", m.memoryLimit>>20)
+	}
+	if ctx.Err() != nil {
+		m.overBudget(vm)
+		return fmt.Errorf("exceeded its %v budget", m.budget)
+	}
+	return err
+}
+
+// overBudget records an overrun and disables the plugin once it has had
+// too many.
+func (m *Manager) overBudget(vm *pluginVM) {
+	vm.overruns++
+	log.Printf("plugin %q: exceeded its %v budget (%d/%d)", vm.name, m.budget, vm.overruns, MaxBudgetOverruns)
+	if vm.overruns < MaxBudgetOverruns || vm.name == "" {
+		return
+	}
+	m.disable(vm, fmt.Sprintf("ran longer than %v %d times", m.budget, vm.overruns))
+}
+
+// overMemory disables a plugin whose call went over the memory limit.
+func (m *Manager) overMemory(vm *pluginVM) {
+	log.Printf("plugin %q: used more than %d MB of memory", vm.name, m.memoryLimit>>20)
+	if vm.name == "" {
+		return
+	}
+	m.disable(vm, fmt.Sprintf("used more than %d MB of memory", m.memoryLimit>>20))
+}
+
+// disable switches a plugin off for the session and tells the user why.
+func (m *Manager) disable(vm *pluginVM, reason string) {
+	vm.disabled = true
+	vm.reason = reason
+	m.stopPending(vm)
+	log.Printf("plugin %q: disabled: %s", vm.name, vm.reason)
+	m.pendingNotification = fmt.Sprintf("Plugin %s disabled: %s", vm.name, vm.reason)
+	m.pendingDuration = 5
+}
+
+// watchMemory samples the heap while a call runs and calls cancel once it
+// has grown by more than the memory limit since the call started. The
+// returned function stops sampling and reports whether the limit was hit.
+//
+// Lua gives no hook into its allocations, so the whole process heap is
+// measured; the orchestrator is blocked in the call meanwhile, so growth
+// past the limit is the plugin's. Garbage is collected before deciding, so
+// a call that only churns through short-lived strings is not stopped.
+func (m *Manager) watchMemory(cancel context.CancelFunc) func() bool {
+	limit := m.memoryLimit
+	start := heapBytes()
+	stop := make(chan struct{})
+	over := make(chan bool, 1)
+	go func() {
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				over <- false
+				return
+			case <-ticker.C:
+				if heapBytes() <= start+limit {
+					continue
+				}
+				runtime.GC()
+				if heapBytes() > start+limit {
+					cancel()
+					over <- true
+					return
+				}
+			}
+		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-over
+	}
+}
+
+// heapBytes returns the memory held by heap objects, including garbage not
+// yet collected.
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// pauseBudget stops the budget clock of the call running in L while it
+// waits on I/O, and returns a function that starts it again.
+func (m *Manager) pauseBudget(L *lua.LState) func() {
+	vm := m.vmFor(L)
+	if vm == nil || vm.timer == nil || !vm.timer.Stop() {
+		return func() {}
+	}
+	remaining := time.Until(vm.deadline)
+	return func() {
+		vm.deadline = time.Now().Add(remaining)
+		vm.timer.Reset(remaining)
+	}
+}
+
+// stopPending cancels a plugin's timers and matcha.http_async requests, so
+// none of its callbacks run again.
+func (m *Manager) stopPending(vm *pluginVM) {
+	m.clearTimers(vm)
+	m.cancelHTTP(vm)
+}
+
+// SetCallBudget changes how long each call into a plugin may run.
+func (m *Manager) SetCallBudget(d time.Duration) {
+	m.budget = d
+}
+
+// SetMemoryLimit changes how many bytes each call into a plugin may grow the
+// heap by.
+func (m *Manager) SetMemoryLimit(n uint64) {
+	m.memoryLimit = n
+}
+
+// Disabled returns the plugins that were disabled for exceeding their
+// budget or memory limit, in load order.
+func (m *Manager) Disabled() []DisabledPlugin {
+	var result []DisabledPlugin
+	for _, name := range m.plugins {
+		if vm := m.vms[name]; vm.disabled {
+			result = append(result, DisabledPlugin{Name: name, Reason: vm.reason})
+		}
+	}
+	return result
+}
+
+// DisabledReason returns why a plugin was disabled, or "" if it is enabled.
+func (m *Manager) DisabledReason(plugin string) string {
+	if vm, ok := m.vms[plugin]; ok && vm.disabled {
+		return vm.reason
+	}
+	return ""
+}
+
+// Enable turns a disabled plugin back on and clears its overrun count. Timers
+// and requests cancelled when it was disabled are not restored.
+func (m *Manager) Enable(plugin string) {
+	if vm, ok := m.vms[plugin]; ok {
+		vm.disabled = false
+		vm.reason = ""
+		vm.overruns = 0
+	}
+}
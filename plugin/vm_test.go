@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPluginGlobalsAreIsolated(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+
+	m.loadPlugin("plugin_a", writePlugin(t, t.TempDir(), "a.lua", `
+		-- @permission storage
+		local matcha = require("matcha")
+		counter = 1
+		matcha.on("startup", function()
+			matcha.store_set("counter", tostring(counter))
+		end)
+	`))
+	m.loadPlugin("plugin_b", writePlugin(t, t.TempDir(), "b.lua", `
+		-- @permission storage
+		local matcha = require("matcha")
+		counter = "clobbered"
+		string.upper = nil
+		matcha.on("startup", function()
+			matcha.store_set("counter", tostring(counter))
+		end)
+	`))
+	m.CallHook(HookStartup)
+
+	assertStoredValue(t, "plugin_a", "counter", "1")
+	assertStoredValue(t, "plugin_b", "counter", "clobbered")
+	if err := m.vms["plugin_a"].L.DoString(`assert(string.upper("x") == "X")`); err != nil {
+		t.Errorf("plugin_b changed plugin_a's string library: %v", err)
+	}
+}
+
+func TestPluginBudgetDisablesRunawayPlugin(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+	m.SetCallBudget(20 * time.Millisecond)
+
+	m.loadPlugin("spin", writePlugin(t, t.TempDir(), "spin.lua", `
+		local matcha = require("matcha")
+		matcha.on("folder_changed", function()
+			while true do end
+		end)
+		matcha.bind_key("x", "inbox", "spin", function() end)
+	`))
+	m.loadPlugin("calm", writePlugin(t, t.TempDir(), "calm.lua", `
+		local matcha = require("matcha")
+		calls = 0
+		matcha.on("folder_changed", function() calls = calls + 1 end)
+	`))
+
+	for i := 0; i < MaxBudgetOverruns; i++ {
+		if reason := m.DisabledReason("spin"); reason != "" {
+			t.Fatalf("disabled after %d overruns: %s", i, reason)
+		}
+		m.CallFolderHook(HookFolderChanged, "INBOX")
+	}
+
+	if m.DisabledReason("spin") == "" {
+		t.Fatal("runaway plugin was not disabled")
+	}
+	if d := m.Disabled(); len(d) != 1 || d[0].Name != "spin" {
+		t.Errorf("Disabled() = %+v", d)
+	}
+	if n, ok := m.TakePendingNotification(); !ok || n.Message == "" {
+		t.Error("disabling a plugin did not notify")
+	}
+	if len(m.Bindings("inbox")) != 0 {
+		t.Error("a disabled plugin's key bindings are still listed")
+	}
+
+	// The disabled plugin is skipped; the other one keeps running.
+	m.CallFolderHook(HookFolderChanged, "INBOX")
+	if m.vms["spin"].overruns != MaxBudgetOverruns {
+		t.Errorf("disabled plugin still ran: %d overruns", m.vms["spin"].overruns)
+	}
+	if calls := m.vms["calm"].L.GetGlobal("calls").String(); calls != "4" {
+		t.Errorf("other plugin ran %s times, want 4", calls)
+	}
+
+	m.Enable("spin")
+	if m.DisabledReason("spin") != "" || len(m.Bindings("inbox")) != 1 {
+		t.Error("Enable did not turn the plugin back on")
+	}
+}
+
+func TestPluginMemoryLimitDisablesPlugin(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestManager()
+	defer m.Close()
+	m.SetCallBudget(30 * time.Second)
+	m.SetMemoryLimit(16 << 20)
+
+	m.loadPlugin("hog", writePlugin(t, t.TempDir(), "hog.lua", `
+		local matcha = require("matcha")
+		hoard = {}
+		matcha.on("folder_changed", function()
+			local i = 0
+			while true do
+				i = i + 1
+				hoard[i] = string.rep("x", 1024) .. i
+			end
+		end)
+	`))
+
+	start := time.Now()
+	m.CallFolderHook(HookFolderChanged, "INBOX")
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("the call ran for %v before it was stopped", d)
+	}
+	if reason := m.DisabledReason("hog"); reason != "used more than 16 MB of memory" {
+		t.Errorf("DisabledReason = %q", reason)
+	}
+}
+
+func TestPluginBudgetStopsRunawayLoad(t *testing.T) {
+	m := newTestManager()
+	defer m.Close()
+	m.SetCallBudget(20 * time.Millisecond)
+
+	m.loadPlugin("spin", writePlugin(t, t.TempDir(), "spin.lua", `while true do end`))
+	if len(m.Plugins()) != 0 {
+		t.Errorf("plugin that never finished loading was registered: %v", m.Plugins())
+	}
+}
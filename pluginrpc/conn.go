@@ -0,0 +1,67 @@
+package pluginrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/floatpane/matcha/daemonrpc"
+)
+
+// maxLineSize caps a single message, so a misbehaving peer cannot make the
+// other side buffer without limit.
+const maxLineSize = 4 << 20
+
+// Conn reads and writes newline-delimited JSON-RPC messages on a pair of
+// streams, such as a process's stdin and stdout. Send is safe for concurrent
+// use; Receive must be called from one goroutine.
+type Conn struct {
+	sc *bufio.Scanner
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewConn returns a Conn that reads from r and writes to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &Conn{sc: sc, w: w}
+}
+
+// Send writes one message.
+func (c *Conn) Send(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.w.Write(append(b, '\n'))
+	return err
+}
+
+// SendEvent writes an event with data encoded as JSON.
+func (c *Conn) SendEvent(typ string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.Send(&daemonrpc.Event{Type: typ, Data: b})
+}
+
+// Receive reads the next message. It returns io.EOF once the other side
+// closes its end.
+func (c *Conn) Receive() (daemonrpc.Message, error) {
+	for c.sc.Scan() {
+		line := c.sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		return daemonrpc.DecodeMessage(append(json.RawMessage(nil), line...))
+	}
+	if err := c.sc.Err(); err != nil {
+		return daemonrpc.Message{}, err
+	}
+	return daemonrpc.Message{}, io.EOF
+}
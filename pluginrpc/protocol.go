@@ -0,0 +1,109 @@
+// Package pluginrpc defines the protocol between matcha and plugins that run
+// as separate processes. Messages are the daemonrpc JSON-RPC types, written
+// one per line on the plugin's stdin and stdout.
+//
+// matcha sends events: EventHook when a hook fires that the plugin subscribed
+// to, and EventKey when one of its key bindings is pressed. The plugin sends
+// requests for the matcha API (MethodOn, MethodNotify, ...) and matcha
+// answers each one with a response.
+package pluginrpc
+
+import (
+	"encoding/json"
+
+	"github.com/floatpane/matcha/daemonrpc"
+)
+
+// Methods plugins call on matcha. They mirror the Lua matcha module.
+const (
+	MethodOn              = "on"
+	MethodLog             = "log"
+	MethodNotify          = "notify"
+	MethodSetStatus       = "set_status"
+	MethodSetComposeField = "set_compose_field"
+	MethodBindKey         = "bind_key"
+)
+
+// Events matcha sends to plugins.
+const (
+	EventHook = "hook"
+	EventKey  = "key"
+)
+
+// Error codes, shared with the daemon protocol.
+const (
+	ErrCodeNotFound      = daemonrpc.ErrCodeNotFound
+	ErrCodeInvalidParams = daemonrpc.ErrCodeInvalidParams
+)
+
+// OnParams subscribes the plugin to a hook event, like matcha.on.
+type OnParams struct {
+	Event string `json:"event"`
+}
+
+type LogParams struct {
+	Message string `json:"message"`
+}
+
+type NotifyParams struct {
+	Message string  `json:"message"`
+	Seconds float64 `json:"seconds,omitempty"` // 0 means the default of 2
+}
+
+type SetStatusParams struct {
+	Area string `json:"area"`
+	Text string `json:"text"`
+}
+
+type SetComposeFieldParams struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// BindKeyParams registers a key binding. ID is chosen by the plugin and
+// comes back in the KeyEvent when the key is pressed.
+type BindKeyParams struct {
+	ID          string `json:"id"`
+	Key         string `json:"key"`
+	Area        string `json:"area"`
+	Description string `json:"description"`
+}
+
+// HookEvent is the data of an EventHook event. Args holds the arguments a
+// Lua callback would get, converted to JSON: Lua tables become objects, or
+// arrays when they are lists.
+type HookEvent struct {
+	Event string            `json:"event"`
+	Args  []json.RawMessage `json:"args,omitempty"`
+}
+
+// KeyEvent is the data of an EventKey event.
+type KeyEvent struct {
+	ID   string            `json:"id"`
+	Args []json.RawMessage `json:"args,omitempty"`
+}
+
+// Email is the object passed with email_received and email_viewed hooks, and
+// with inbox and email_view key bindings.
+type Email struct {
+	UID       uint32   `json:"uid"`
+	From      string   `json:"from"`
+	To        []string `json:"to"`
+	Subject   string   `json:"subject"`
+	Date      string   `json:"date"` // RFC 3339
+	IsRead    bool     `json:"is_read"`
+	AccountID string   `json:"account_id"`
+	Folder    string   `json:"folder"`
+	Labels    []string `json:"labels"`
+}
+
+// Composer is the object passed with composer_updated hooks and composer key
+// bindings.
+type Composer struct {
+	Body    string `json:"body"`
+	BodyLen int    `json:"body_len"`
+	Subject string `json:"subject"`
+	To      string `json:"to"`
+	Cc      string `json:"cc"`
+	Bcc     string `json:"bcc"`
+}
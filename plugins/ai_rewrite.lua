@@ -4,6 +4,11 @@
 --
 -- Configuration: Set the API_URL, API_KEY, and MODEL variables below.
 -- Works with any OpenAI-compatible API (OpenAI, Ollama, llama.cpp, etc).
+-- If you point API_URL at another server, add its host to the network
+-- permission below.
+--
+-- @permission network localhost
+-- @permission compose
 
 local matcha        = require("matcha")
 
@@ -54,39 +59,44 @@ matcha.bind_key("ctrl+r", "composer", "ai rewrite", function(state)
             headers["Authorization"] = "Bearer " .. API_KEY
         end
 
-        matcha.notify("Rewriting...", 10)
+        matcha.notify("Rewriting...", 2)
 
-        local res, err = matcha.http({
+        -- http_async keeps the composer responsive while the model answers.
+        local err = matcha.http_async({
             url = API_URL,
             method = "POST",
             headers = headers,
             body = payload,
-        })
+        }, function(res, err)
+            if err then
+                matcha.notify("AI error: " .. err, 3)
+                return
+            end
+
+            if res.status ~= 200 then
+                matcha.notify("AI returned status " .. res.status, 3)
+                return
+            end
+
+            -- Extract content from OpenAI-compatible response.
+            -- Response format: {"choices":[{"message":{"content":"..."}}]}
+            local content = res.body:match('"content"%s*:%s*"(.-)"')
+            if not content then
+                matcha.notify("Could not parse AI response", 3)
+                return
+            end
+
+            -- Unescape JSON string
+            content = content:gsub('\\n', '\n')
+            content = content:gsub('\\"', '"')
+            content = content:gsub('\\\\', '\\')
+
+            matcha.set_compose_field("body", content)
+            matcha.notify("Email rewritten", 2)
+        end)
 
         if err then
             matcha.notify("AI error: " .. err, 3)
-            return
-        end
-
-        if res.status ~= 200 then
-            matcha.notify("AI returned status " .. res.status, 3)
-            return
         end
-
-        -- Extract content from OpenAI-compatible response.
-        -- Response format: {"choices":[{"message":{"content":"..."}}]}
-        local content = res.body:match('"content"%s*:%s*"(.-)"')
-        if not content then
-            matcha.notify("Could not parse AI response", 3)
-            return
-        end
-
-        -- Unescape JSON string
-        content = content:gsub('\\n', '\n')
-        content = content:gsub('\\"', '"')
-        content = content:gsub('\\\\', '\\')
-
-        matcha.set_compose_field("body", content)
-        matcha.notify("Email rewritten", 2)
     end)
 end)
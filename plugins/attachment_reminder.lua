@@ -1,6 +1,8 @@
 -- attachment_reminder.lua
 -- Warns if your email body mentions an attachment but you might have
 -- forgotten to attach it. Checks common phrases before sending.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
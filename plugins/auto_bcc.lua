@@ -1,6 +1,8 @@
 -- auto_bcc.lua
 -- Automatically adds a BCC address to every email you compose.
 -- Change the address below to your own archive/backup address.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
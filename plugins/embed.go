@@ -1,10 +1,13 @@
 package plugins
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/floatpane/matcha/internal/httpclient"
 )
@@ -19,6 +22,20 @@ type PluginEntry struct {
 	Description string `json:"description"`
 	File        string `json:"file"`
 	URL         string `json:"url,omitempty"`
+	Version     string `json:"version"`
+	SHA256      string `json:"sha256"` // hex digest of the plugin file
+}
+
+// Verify checks data against the entry's SHA-256 checksum.
+func (e PluginEntry) Verify(data []byte) error {
+	if e.SHA256 == "" {
+		return fmt.Errorf("registry entry for %s has no checksum", e.Name)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != strings.ToLower(e.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", e.File, e.SHA256, got)
+	}
+	return nil
 }
 
 // FetchRegistry fetches the plugin registry from GitHub.
@@ -46,8 +63,9 @@ func FetchRegistry() ([]PluginEntry, error) {
 	return entries, nil
 }
 
-// FetchPlugin downloads a plugin file. If the entry has a URL, it downloads
-// from there; otherwise it falls back to the default repo location.
+// FetchPlugin downloads a plugin file and verifies its checksum. If the entry
+// has a URL, it downloads from there; otherwise it falls back to the default
+// repo location.
 func FetchPlugin(entry PluginEntry) ([]byte, error) {
 	url := entry.URL
 	if url == "" {
@@ -65,5 +83,12 @@ func FetchPlugin(entry PluginEntry) ([]byte, error) {
 		return nil, fmt.Errorf("plugin download returned status %d", resp.StatusCode)
 	}
 
-	return io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin: %w", err)
+	}
+	if err := entry.Verify(data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
@@ -1,5 +1,8 @@
 -- empty_body_guard.lua
--- Warns before sending an email with an empty body.
+-- Warns while composing, and stops the send, when an email has an empty
+-- body and no attachments.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
@@ -8,3 +11,9 @@ matcha.on("composer_updated", function(state)
         matcha.set_status("composer", "Email body is empty")
     end
 end)
+
+matcha.on("email_send_before", function(email)
+    if email.body:match("^%s*$") and #email.attachments == 0 then
+        return { cancel = true, reason = "the email body is empty" }
+    end
+end)
@@ -0,0 +1,17 @@
+-- github_highlighter.lua
+-- Highlights every "GitHub" mention in displayed email bodies in bold
+-- purple.
+--
+-- @permission mailbox
+
+local matcha = require("matcha")
+
+matcha.on("email_body_render", function(email, rendered, raw)
+    local highlighted, count = rendered:gsub("GitHub", function(m)
+        return matcha.style(m, { color = "#a371f7", bold = true })
+    end)
+    if count == 0 then
+        return nil
+    end
+    return highlighted
+end)
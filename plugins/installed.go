@@ -0,0 +1,112 @@
+package plugins
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// InstalledFile is the name of the file in the plugins directory that records
+// which registry version of each plugin is installed.
+const InstalledFile = "installed.json"
+
+// InstalledPlugin records a plugin installed from the registry.
+type InstalledPlugin struct {
+	File    string `json:"file"`
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+// LoadInstalled reads the installed versions recorded in dir, keyed by
+// plugin name. A missing file means nothing is recorded.
+func LoadInstalled(dir string) (map[string]InstalledPlugin, error) {
+	installed := make(map[string]InstalledPlugin)
+	data, err := os.ReadFile(filepath.Join(dir, InstalledFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return installed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &installed); err != nil {
+		return nil, err
+	}
+	return installed, nil
+}
+
+// RecordInstalled records that entry's version was installed to dir.
+func RecordInstalled(dir string, entry PluginEntry) error {
+	installed, err := LoadInstalled(dir)
+	if err != nil {
+		return err
+	}
+	installed[entry.Name] = InstalledPlugin{File: entry.File, Version: entry.Version, SHA256: entry.SHA256}
+	data, err := json.MarshalIndent(installed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, InstalledFile), append(data, '\n'), 0600)
+}
+
+// InstalledVersion returns the version of entry's plugin installed in dir
+// and whether the plugin file exists. The version comes from the record
+// written by RecordInstalled; for a plugin installed some other way it is
+// entry.Version if the file matches the registry checksum, and "" otherwise.
+func InstalledVersion(dir string, entry PluginEntry, installed map[string]InstalledPlugin) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, entry.File))
+	if err != nil {
+		return "", false
+	}
+	if rec, ok := installed[entry.Name]; ok {
+		return rec.Version, true
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) == strings.ToLower(entry.SHA256) {
+		return entry.Version, true
+	}
+	return "", true
+}
+
+// Outdated reports whether an installed version is older than the
+// registry's. A plugin of unknown version is outdated: with no record of
+// what was installed and a file that does not match the registry, it is
+// most likely an older release, installed before versions were recorded.
+func (e PluginEntry) Outdated(installedVersion string) bool {
+	return installedVersion == "" || CompareVersions(installedVersion, e.Version) < 0
+}
+
+// CompareVersions compares dotted version numbers such as "1.2.0", returning
+// -1, 0 or 1. A leading "v" is ignored, missing parts count as 0, and parts
+// that are not numbers are compared as strings.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		x, y := "0", "0"
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errx := strconv.Atoi(x)
+		ny, erry := strconv.Atoi(y)
+		switch {
+		case errx == nil && erry == nil:
+			if nx != ny {
+				if nx < ny {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
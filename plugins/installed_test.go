@@ -0,0 +1,106 @@
+package plugins
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0", "1.0.0", 0},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"2.0.0", "1.9.9", 1},
+		{"1.0.0-beta", "1.0.0-rc", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestInstalledVersion(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("-- hello\n")
+	sum := sha256.Sum256(data)
+	entry := PluginEntry{Name: "hello", File: "hello.lua", Version: "1.1.0", SHA256: hex.EncodeToString(sum[:])}
+
+	if err := entry.Verify(data); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := entry.Verify([]byte("-- tampered\n")); err == nil {
+		t.Error("Verify accepted data that does not match the checksum")
+	}
+	if err := (PluginEntry{Name: "x"}).Verify(data); err == nil {
+		t.Error("Verify accepted an entry without a checksum")
+	}
+
+	installed, err := LoadInstalled(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := InstalledVersion(dir, entry, installed); ok {
+		t.Error("missing plugin reported as installed")
+	}
+
+	// A file matching the registry is at the registry's version; one that
+	// does not is of unknown version, and outdated.
+	os.WriteFile(filepath.Join(dir, "hello.lua"), data, 0644) //nolint:errcheck
+	if v, ok := InstalledVersion(dir, entry, installed); !ok || v != "1.1.0" {
+		t.Errorf("InstalledVersion = %q, %v; want 1.1.0", v, ok)
+	}
+	os.WriteFile(filepath.Join(dir, "hello.lua"), []byte("-- edited\n"), 0644) //nolint:errcheck
+	if v, ok := InstalledVersion(dir, entry, installed); !ok || v != "" || !entry.Outdated(v) {
+		t.Errorf("InstalledVersion of an edited file = %q, %v", v, ok)
+	}
+
+	old := entry
+	old.Version = "1.0.0"
+	if err := RecordInstalled(dir, old); err != nil {
+		t.Fatal(err)
+	}
+	installed, err = LoadInstalled(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := InstalledVersion(dir, entry, installed)
+	if v != "1.0.0" || !entry.Outdated(v) {
+		t.Errorf("recorded version = %q, outdated %v; want 1.0.0, true", v, entry.Outdated(v))
+	}
+}
+
+func TestRegistryChecksums(t *testing.T) {
+	data, err := os.ReadFile("registry.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []PluginEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.URL != "" {
+			continue
+		}
+		src, err := os.ReadFile(e.File)
+		if err != nil {
+			t.Errorf("%s: %v", e.Name, err)
+			continue
+		}
+		if e.Version == "" {
+			t.Errorf("%s: no version", e.Name)
+		}
+		if err := e.Verify(src); err != nil {
+			t.Errorf("%v; update registry.json and bump the version", err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+-- link_summary.lua
+-- Prepends a numbered list of the links in an email to its displayed body.
+-- The links are read from the raw source, so they are found in HTML mail
+-- too.
+--
+-- @permission mailbox
+
+local matcha = require("matcha")
+
+matcha.on("email_body_render", function(email, rendered, raw)
+    local urls = {}
+    local seen = {}
+    for url in raw:gmatch("https?://[%w%-_%.~%?=&/%%#:+@!$,;]+") do
+        url = url:gsub("[%.,;:!]+$", "")
+        if not seen[url] then
+            seen[url] = true
+            urls[#urls + 1] = url
+        end
+    end
+    if #urls == 0 then
+        return nil
+    end
+
+    local lines = { matcha.style("Links (" .. #urls .. ")", { bold = true }) }
+    for i, url in ipairs(urls) do
+        lines[#lines + 1] = string.format("%2d. %s", i, url)
+    end
+    return table.concat(lines, "\n") .. "\n\n" .. rendered
+end)
@@ -1,11 +1,46 @@
 -- quick_label.lua
--- Demonstrates custom keyboard shortcuts with matcha.bind_key().
--- Press ctrl+i in the inbox to show the selected email's subject.
+-- Toggle a label on the selected email with a single key. The label is stored
+-- on the server (IMAP keyword, JMAP keyword or Gmail label), so it shows up
+-- in other clients too.
+--
+-- @permission mailbox
 
 local matcha = require("matcha")
 
-matcha.bind_key("ctrl+i", "inbox", "info", function(email)
-    if email then
-        matcha.notify(email.from .. ": " .. email.subject, 3)
+local cfg = matcha.settings({
+    label = {
+        type        = "string",
+        default     = "todo",
+        label       = "Label",
+        description = "Label to add or remove.",
+    },
+    key = {
+        type        = "string",
+        default     = "ctrl+i",
+        label       = "Toggle key",
+        description = "Key to press in the inbox to toggle the label. Takes effect after restart.",
+    },
+})
+
+local function has_label(email, label)
+    for _, l in ipairs(email.labels or {}) do
+        if l:lower() == label:lower() then
+            return true
+        end
+    end
+    return false
+end
+
+local function toggle(email)
+    if not email then return end
+    local folder = email.folder ~= "" and email.folder or "INBOX"
+    if has_label(email, cfg.label) then
+        matcha.remove_label(email.uid, email.account_id, folder, cfg.label)
+        matcha.notify("Removed label " .. cfg.label)
+    else
+        matcha.add_label(email.uid, email.account_id, folder, cfg.label)
+        matcha.notify("Added label " .. cfg.label)
     end
-end)
+end
+
+matcha.bind_key(cfg.key, "inbox", "Toggle label", toggle)
@@ -1,6 +1,8 @@
 -- reading_time.lua
 -- Estimates reading time based on word count while composing.
 -- Assumes ~200 words per minute average reading speed.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
@@ -1,5 +1,7 @@
 -- recipient_counter.lua
 -- Shows the number of recipients in the composer status bar.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
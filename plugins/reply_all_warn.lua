@@ -1,5 +1,7 @@
 -- reply_all_warn.lua
 -- Warns when sending to many recipients (possible accidental reply-all).
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
@@ -1,5 +1,7 @@
 -- self_email_warn.lua
 -- Notifies you when you receive an email you sent to yourself.
+--
+-- @permission mailbox
 
 local matcha = require("matcha")
 
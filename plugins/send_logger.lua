@@ -1,5 +1,7 @@
 -- send_logger.lua
 -- Logs every email you send for personal record-keeping.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
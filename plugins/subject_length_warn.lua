@@ -3,6 +3,8 @@
 -- Most email clients truncate subjects beyond ~60 characters.
 --
 -- Thresholds are configurable in Settings → Plugins.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
@@ -24,6 +26,11 @@ local cfg = matcha.settings({
         label = "Hard limit (chars)",
         description = "Warn that the subject is too long above this length.",
     },
+    block = {
+        type = "boolean",
+        default = false,
+        label = "Block sending above the hard limit",
+    },
 })
 
 matcha.on("composer_updated", function(state)
@@ -37,3 +44,12 @@ matcha.on("composer_updated", function(state)
         matcha.set_status("composer", "Subject may truncate (" .. len .. " chars)")
     end
 end)
+
+matcha.on("email_send_before", function(email)
+    if cfg.enabled and cfg.block and #email.subject > cfg.hard_limit then
+        return {
+            cancel = true,
+            reason = "subject is longer than " .. cfg.hard_limit .. " chars",
+        }
+    end
+end)
@@ -1,5 +1,7 @@
 -- toggle_read.lua
 -- Toggle read/unread on the selected email. Keybind is configurable.
+--
+-- @permission mailbox
 
 local matcha = require("matcha")
 
@@ -1,12 +1,16 @@
 -- weather_status.lua
 -- Fetches current weather and displays it in the inbox status bar.
 -- Uses the free wttr.in API (no API key required).
+-- The weather is refreshed every REFRESH_MINUTES.
+--
+-- @permission network wttr.in
 
 local matcha = require("matcha")
 
 local CITY = "London"
+local REFRESH_MINUTES = 30
 
-matcha.on("startup", function()
+local function refresh()
     local res, err = matcha.http({
         url = "https://wttr.in/" .. CITY .. "?format=%t+%C",
     })
@@ -19,4 +23,7 @@ matcha.on("startup", function()
     if res.status == 200 then
         matcha.set_status("inbox", res.body)
     end
-end)
+end
+
+matcha.on("startup", refresh)
+matcha.every(REFRESH_MINUTES * 60, refresh)
@@ -1,9 +1,11 @@
 -- webhook_notify.lua
 -- Posts a JSON payload to a webhook URL when an email is received.
+--
+-- @permission network example.com
 
 local matcha = require("matcha")
 
-local WEBHOOK_URL = "https://example.com/webhook"
+local WEBHOOK_URL = "https://example.com/webhook" -- also update the network permission above
 
 matcha.on("email_received", function(email)
     local payload = '{"from":"' .. email.from .. '","subject":"' .. email.subject .. '"}'
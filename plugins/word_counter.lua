@@ -1,5 +1,7 @@
 -- word_counter.lua
 -- Shows a live word count in the composer help bar.
+--
+-- @permission compose
 
 local matcha = require("matcha")
 
@@ -0,0 +1,54 @@
+// Command example is a matcha plugin written with pluginsdk. It counts the
+// mail received since matcha started in the inbox status bar, and binds "N"
+// in the inbox to show who sent the selected email.
+//
+// Build it and register it in ~/.config/matcha/plugins/example.plugin.json:
+//
+//	go build -o ~/.config/matcha/plugins/example ./pluginsdk/example
+//	echo '{"command": "./example"}' > ~/.config/matcha/plugins/example.plugin.json
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/floatpane/matcha/pluginsdk"
+)
+
+func main() {
+	p := pluginsdk.New()
+	if err := setup(p); err != nil {
+		log.Fatal(err)
+	}
+	if err := p.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// setup registers the plugin's hooks and key bindings.
+func setup(p *pluginsdk.Plugin) error {
+	var (
+		mu       sync.Mutex
+		received int
+	)
+
+	if err := p.On(pluginsdk.HookEmailReceived, func(pluginsdk.Event) {
+		mu.Lock()
+		received++
+		n := received
+		mu.Unlock()
+		p.SetStatus(pluginsdk.AreaInbox, fmt.Sprintf("%d new", n)) //nolint:errcheck,gosec
+	}); err != nil {
+		return err
+	}
+
+	return p.BindKey("N", pluginsdk.AreaInbox, "show sender", func(ev pluginsdk.Event) {
+		var email pluginsdk.Email
+		if err := ev.Decode(0, &email); err != nil {
+			p.Log("example: " + err.Error()) //nolint:errcheck,gosec
+			return
+		}
+		p.Notify("From "+email.From, 3) //nolint:errcheck,gosec
+	})
+}
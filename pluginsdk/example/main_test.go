@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/floatpane/matcha/pluginrpc"
+	"github.com/floatpane/matcha/pluginsdk"
+)
+
+func TestExample(t *testing.T) {
+	pr, hw := io.Pipe()
+	hr, pw := io.Pipe()
+	defer hr.Close()
+	host := pluginrpc.NewConn(hr, hw)
+	p := pluginsdk.NewWithConn(pr, pw)
+
+	// answer replies to the next request and returns it.
+	answer := func() *daemonrpc.Request {
+		t.Helper()
+		msg, err := host.Receive()
+		if err != nil || msg.Request == nil {
+			t.Fatalf("Receive: %+v, %v", msg, err)
+		}
+		if err := host.Send(&daemonrpc.Response{ID: msg.Request.ID, Result: json.RawMessage("{}")}); err != nil {
+			t.Fatal(err)
+		}
+		return msg.Request
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- setup(p) }()
+	answer()
+	bind := answer()
+	if err := <-errc; err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	var key pluginrpc.BindKeyParams
+	json.Unmarshal(bind.Params, &key) //nolint:errcheck
+
+	email, _ := json.Marshal(pluginsdk.Email{From: "ada@example.com"})
+	args := []json.RawMessage{email}
+	for range 2 {
+		host.SendEvent(pluginrpc.EventHook, pluginrpc.HookEvent{Event: pluginsdk.HookEmailReceived, Args: args}) //nolint:errcheck
+	}
+	var status pluginrpc.SetStatusParams
+	answer()
+	json.Unmarshal(answer().Params, &status) //nolint:errcheck
+	if status.Text != "2 new" {
+		t.Errorf("status = %q, want %q", status.Text, "2 new")
+	}
+
+	host.SendEvent(pluginrpc.EventKey, pluginrpc.KeyEvent{ID: key.ID, Args: args}) //nolint:errcheck
+	var notify pluginrpc.NotifyParams
+	json.Unmarshal(answer().Params, &notify) //nolint:errcheck
+	if notify.Message != "From ada@example.com" {
+		t.Errorf("notification = %q", notify.Message)
+	}
+
+	hw.Close()
+	if err := p.Run(); err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
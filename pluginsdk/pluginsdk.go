@@ -0,0 +1,289 @@
+// Package pluginsdk is for writing matcha plugins in Go. Such a plugin is a
+// separate program that matcha starts and talks to over stdin and stdout
+// (see the pluginrpc package), so it can use any Go library.
+//
+// A minimal plugin:
+//
+//	func main() {
+//		p := pluginsdk.New()
+//		p.On("email_received", func(ev pluginsdk.Event) {
+//			var email pluginsdk.Email
+//			if ev.Decode(0, &email) == nil {
+//				p.Notify("Mail from "+email.From, 3)
+//			}
+//		})
+//		if err := p.Run(); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// Register it by writing ~/.config/matcha/plugins/<name>.plugin.json:
+//
+//	{"command": "/path/to/plugin"}
+package pluginsdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/floatpane/matcha/pluginrpc"
+)
+
+// Hook event names, the same as for Lua plugins.
+const (
+	HookStartup         = "startup"
+	HookShutdown        = "shutdown"
+	HookEmailReceived   = "email_received"
+	HookEmailSendBefore = "email_send_before"
+	HookEmailSendAfter  = "email_send_after"
+	HookEmailViewed     = "email_viewed"
+	HookFolderChanged   = "folder_changed"
+	HookComposerUpdated = "composer_updated"
+)
+
+// View areas for SetStatus and BindKey.
+const (
+	AreaInbox     = "inbox"
+	AreaEmailView = "email_view"
+	AreaComposer  = "composer"
+)
+
+// Email and Composer are the objects passed with hooks and key presses.
+type (
+	Email    = pluginrpc.Email
+	Composer = pluginrpc.Composer
+)
+
+// ErrClosed is returned by calls made after matcha closed the connection.
+var ErrClosed = errors.New("pluginsdk: connection closed")
+
+// Event is a hook that fired or a key binding that was pressed. Args are
+// the arguments a Lua callback would get, as JSON.
+type Event struct {
+	Name string // hook event name, or the key for key bindings
+	Args []json.RawMessage
+}
+
+// Decode unmarshals argument i into v.
+func (e Event) Decode(i int, v any) error {
+	if i >= len(e.Args) {
+		return fmt.Errorf("pluginsdk: %s has no argument %d", e.Name, i)
+	}
+	return json.Unmarshal(e.Args[i], v)
+}
+
+// Plugin is the connection to matcha. Its methods are safe for concurrent
+// use. Handlers run one at a time, in the order events arrive, on a
+// goroutine of their own, so they may call back into matcha.
+type Plugin struct {
+	conn *pluginrpc.Conn
+
+	mu       sync.Mutex
+	nextID   uint64
+	pending  map[uint64]chan *daemonrpc.Response
+	hooks    map[string][]func(Event)
+	keys     map[string]func(Event)
+	keyNames map[string]string
+	closed   bool
+
+	// events queued for dispatch; unbounded so that read never blocks
+	// while a handler waits for a response.
+	events []*daemonrpc.Event
+	cond   *sync.Cond
+	done   chan struct{}
+	err    error
+}
+
+// New connects to matcha over the process's stdin and stdout.
+func New() *Plugin {
+	return NewWithConn(os.Stdin, os.Stdout)
+}
+
+// NewWithConn connects over the given streams. Tests use it with pipes.
+func NewWithConn(r io.Reader, w io.Writer) *Plugin {
+	p := &Plugin{
+		conn:     pluginrpc.NewConn(r, w),
+		pending:  make(map[uint64]chan *daemonrpc.Response),
+		hooks:    make(map[string][]func(Event)),
+		keys:     make(map[string]func(Event)),
+		keyNames: make(map[string]string),
+		done:     make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go p.read()
+	go p.dispatch()
+	return p
+}
+
+// Run blocks until matcha closes the connection, which it does when it
+// exits, and all handlers have returned.
+func (p *Plugin) Run() error {
+	<-p.done
+	return p.err
+}
+
+// On calls fn whenever the hook event fires.
+func (p *Plugin) On(event string, fn func(Event)) error {
+	p.mu.Lock()
+	first := len(p.hooks[event]) == 0
+	p.hooks[event] = append(p.hooks[event], fn)
+	p.mu.Unlock()
+	if !first {
+		return nil
+	}
+	return p.call(pluginrpc.MethodOn, pluginrpc.OnParams{Event: event})
+}
+
+// BindKey calls fn when key is pressed in the view area. The event's first
+// argument is the selected Email, or the Composer state.
+func (p *Plugin) BindKey(key, area, description string, fn func(Event)) error {
+	p.mu.Lock()
+	id := strconv.Itoa(len(p.keys) + 1)
+	p.keys[id] = fn
+	p.keyNames[id] = key
+	p.mu.Unlock()
+	return p.call(pluginrpc.MethodBindKey, pluginrpc.BindKeyParams{ID: id, Key: key, Area: area, Description: description})
+}
+
+// Log writes a message to matcha's log.
+func (p *Plugin) Log(message string) error {
+	return p.call(pluginrpc.MethodLog, pluginrpc.LogParams{Message: message})
+}
+
+// Notify shows a notification for the given number of seconds; 0 means the
+// default of 2.
+func (p *Plugin) Notify(message string, seconds float64) error {
+	return p.call(pluginrpc.MethodNotify, pluginrpc.NotifyParams{Message: message, Seconds: seconds})
+}
+
+// SetStatus sets the plugin status text of a view area. An empty text
+// clears it.
+func (p *Plugin) SetStatus(area, text string) error {
+	return p.call(pluginrpc.MethodSetStatus, pluginrpc.SetStatusParams{Area: area, Text: text})
+}
+
+// SetComposeField sets "to", "cc", "bcc", "subject" or "body" of the open
+// composer.
+func (p *Plugin) SetComposeField(field, value string) error {
+	return p.call(pluginrpc.MethodSetComposeField, pluginrpc.SetComposeFieldParams{Field: field, Value: value})
+}
+
+// call sends a request and waits for matcha's response.
+func (p *Plugin) call(method string, params any) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.nextID++
+	id := p.nextID
+	ch := make(chan *daemonrpc.Response, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	if err := p.conn.Send(&daemonrpc.Request{ID: id, Method: method, Params: b}); err != nil {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		return ErrClosed
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("matcha: %s: %s", method, resp.Error.Message)
+	}
+	return nil
+}
+
+// read receives messages until the connection closes.
+func (p *Plugin) read() {
+	for {
+		msg, err := p.conn.Receive()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				p.err = err
+			}
+			p.mu.Lock()
+			p.closed = true
+			for id, ch := range p.pending {
+				close(ch)
+				delete(p.pending, id)
+			}
+			p.cond.Signal()
+			p.mu.Unlock()
+			return
+		}
+		switch {
+		case msg.Response != nil:
+			p.mu.Lock()
+			ch, ok := p.pending[msg.Response.ID]
+			delete(p.pending, msg.Response.ID)
+			p.mu.Unlock()
+			if ok {
+				ch <- msg.Response
+			}
+		case msg.Event != nil:
+			p.mu.Lock()
+			p.events = append(p.events, msg.Event)
+			p.cond.Signal()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// dispatch runs the handlers for events in order.
+func (p *Plugin) dispatch() {
+	defer close(p.done)
+	for {
+		p.mu.Lock()
+		for len(p.events) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.events) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		ev := p.events[0]
+		p.events = p.events[1:]
+		p.mu.Unlock()
+
+		switch ev.Type {
+		case pluginrpc.EventHook:
+			var data pluginrpc.HookEvent
+			if json.Unmarshal(ev.Data, &data) != nil {
+				continue
+			}
+			p.mu.Lock()
+			handlers := p.hooks[data.Event]
+			p.mu.Unlock()
+			for _, fn := range handlers {
+				fn(Event{Name: data.Event, Args: data.Args})
+			}
+		case pluginrpc.EventKey:
+			var data pluginrpc.KeyEvent
+			if json.Unmarshal(ev.Data, &data) != nil {
+				continue
+			}
+			p.mu.Lock()
+			fn, name := p.keys[data.ID], p.keyNames[data.ID]
+			p.mu.Unlock()
+			if fn != nil {
+				fn(Event{Name: name, Args: data.Args})
+			}
+		}
+	}
+}
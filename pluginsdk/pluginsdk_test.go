@@ -0,0 +1,126 @@
+package pluginsdk
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/floatpane/matcha/daemonrpc"
+	"github.com/floatpane/matcha/pluginrpc"
+)
+
+// host is the matcha side of a connection to a Plugin.
+type host struct {
+	t    *testing.T
+	conn *pluginrpc.Conn
+	w    *io.PipeWriter
+}
+
+func newHost(t *testing.T) (*host, *Plugin) {
+	t.Helper()
+	pr, hw := io.Pipe() // host -> plugin
+	hr, pw := io.Pipe() // plugin -> host
+	t.Cleanup(func() { hw.Close(); hr.Close() })
+	return &host{t: t, conn: pluginrpc.NewConn(hr, hw), w: hw}, NewWithConn(pr, pw)
+}
+
+// expect reads the next request, checks its method and answers it.
+func (h *host) expect(method string, params any, rpcErr *daemonrpc.Error) {
+	h.t.Helper()
+	msg, err := h.conn.Receive()
+	if err != nil {
+		h.t.Fatalf("Receive: %v", err)
+	}
+	req := msg.Request
+	if req == nil || req.Method != method {
+		h.t.Fatalf("got %+v, want a %s request", msg, method)
+	}
+	if params != nil {
+		if err := json.Unmarshal(req.Params, params); err != nil {
+			h.t.Fatal(err)
+		}
+	}
+	resp := &daemonrpc.Response{ID: req.ID, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result = json.RawMessage("{}")
+	}
+	if err := h.conn.Send(resp); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func TestPluginCalls(t *testing.T) {
+	h, p := newHost(t)
+
+	errc := make(chan error, 1)
+	go func() { errc <- p.Notify("hello", 3) }()
+	var notify pluginrpc.NotifyParams
+	h.expect(pluginrpc.MethodNotify, &notify, nil)
+	if err := <-errc; err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if notify.Message != "hello" || notify.Seconds != 3 {
+		t.Errorf("notify params = %+v", notify)
+	}
+
+	go func() { errc <- p.SetComposeField("cc", "x@example.com") }()
+	h.expect(pluginrpc.MethodSetComposeField, nil, &daemonrpc.Error{Code: pluginrpc.ErrCodeInvalidParams, Message: "bad field"})
+	if err := <-errc; err == nil {
+		t.Error("SetComposeField: want the host's error")
+	}
+}
+
+func TestPluginEvents(t *testing.T) {
+	h, p := newHost(t)
+
+	got := make(chan Event, 2)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.On(HookEmailReceived, func(ev Event) {
+			// Calling back from a handler must not deadlock.
+			if err := p.SetStatus(AreaInbox, "seen"); err != nil {
+				t.Errorf("SetStatus: %v", err)
+			}
+			got <- ev
+		})
+	}()
+	var on pluginrpc.OnParams
+	h.expect(pluginrpc.MethodOn, &on, nil)
+	if err := <-errc; err != nil || on.Event != HookEmailReceived {
+		t.Fatalf("On: %v, params %+v", err, on)
+	}
+
+	go func() { errc <- p.BindKey("N", AreaInbox, "test", func(ev Event) { got <- ev }) }()
+	var bind pluginrpc.BindKeyParams
+	h.expect(pluginrpc.MethodBindKey, &bind, nil)
+	if err := <-errc; err != nil {
+		t.Fatalf("BindKey: %v", err)
+	}
+
+	email, _ := json.Marshal(Email{UID: 7, From: "a@example.com"})
+	if err := h.conn.SendEvent(pluginrpc.EventHook, pluginrpc.HookEvent{Event: HookEmailReceived, Args: []json.RawMessage{email}}); err != nil {
+		t.Fatal(err)
+	}
+	h.expect(pluginrpc.MethodSetStatus, nil, nil)
+	ev := <-got
+	var decoded Email
+	if err := ev.Decode(0, &decoded); err != nil || decoded.UID != 7 {
+		t.Errorf("hook event %q: decoded %+v, %v", ev.Name, decoded, err)
+	}
+
+	if err := h.conn.SendEvent(pluginrpc.EventKey, pluginrpc.KeyEvent{ID: bind.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-got; ev.Name != "N" {
+		t.Errorf("key event name = %q, want %q", ev.Name, "N")
+	}
+
+	h.w.Close()
+	if err := p.Run(); err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	if err := p.Log("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Log after close = %v, want ErrClosed", err)
+	}
+}
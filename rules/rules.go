@@ -0,0 +1,318 @@
+// Package rules evaluates the declarative mail filtering rules from
+// config.Config against new mail and applies their actions through a
+// backend.EmailWriter.
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/fetcher"
+)
+
+// Action types.
+const (
+	ActionMove     = "move"
+	ActionArchive  = "archive"
+	ActionDelete   = "delete"
+	ActionMarkRead = "mark_read"
+	ActionFlag     = "flag"
+	ActionNotify   = "notify"
+)
+
+// Message is a message rules are matched against.
+type Message struct {
+	Email   config.CachedEmail
+	Account *config.Account
+	// Size and Header are only set when they were fetched. Size and header
+	// conditions never match without them.
+	Size   int64
+	Header mail.Header
+}
+
+// Messages wraps an account's cached emails in a folder for matching. With
+// headers set, their sizes and full headers are fetched from the server
+// first; on failure the messages are returned without them, with the error.
+func Messages(acct *config.Account, folder string, emails []config.CachedEmail, headers bool) ([]Message, error) {
+	msgs := make([]Message, len(emails))
+	uids := make([]uint32, len(emails))
+	for i, e := range emails {
+		msgs[i] = Message{Email: e, Account: acct}
+		uids[i] = e.UID
+	}
+	if !headers {
+		return msgs, nil
+	}
+	fetched, err := fetcher.FetchMessageHeaders(acct, folder, uids)
+	if err != nil {
+		return msgs, err
+	}
+	for i := range msgs {
+		if h, ok := fetched[msgs[i].Email.UID]; ok {
+			msgs[i].Size, msgs[i].Header = h.Size, h.Header
+		}
+	}
+	return msgs, nil
+}
+
+// Validate reports whether a rule can be run. A rule needs a name, at least
+// one condition, and known actions.
+func Validate(r config.Rule) error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("rule has no name")
+	}
+	m := r.Match
+	if m.From == "" && m.To == "" && m.Subject == "" && len(m.Headers) == 0 && m.Account == "" && m.Larger == 0 && m.Smaller == 0 {
+		return fmt.Errorf("rule %q has no conditions", r.Name)
+	}
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("rule %q has no actions", r.Name)
+	}
+	for _, a := range r.Actions {
+		switch a.Type {
+		case ActionMove:
+			if a.Folder == "" {
+				return fmt.Errorf("rule %q: move needs a folder", r.Name)
+			}
+		case ActionArchive, ActionDelete, ActionMarkRead, ActionFlag, ActionNotify:
+		default:
+			return fmt.Errorf("rule %q: unknown action %q", r.Name, a.Type)
+		}
+	}
+	return nil
+}
+
+// Find returns the rule with the given name, compared case-insensitively.
+func Find(rules []config.Rule, name string) (config.Rule, bool) {
+	for _, r := range rules {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+	}
+	return config.Rule{}, false
+}
+
+// NeedsHeaders reports whether any rule has a size or header condition, so
+// the caller knows to fetch them.
+func NeedsHeaders(rules []config.Rule) bool {
+	for _, r := range rules {
+		if len(r.Match.Headers) > 0 || r.Match.Larger > 0 || r.Match.Smaller > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ForFolder returns the rules that run on new mail in folder: those naming
+// it, and for INBOX those naming no folder. Running every rule in every
+// synced folder would have rules re-fire on what they archived or moved.
+func ForFolder(rules []config.Rule, folder string) []config.Rule {
+	var out []config.Rule
+	for _, r := range rules {
+		want := r.Match.Folder
+		if want == "" {
+			want = "INBOX"
+		}
+		if strings.EqualFold(want, folder) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Match reports whether a message meets all of a rule's conditions.
+func Match(r config.Rule, msg Message) bool {
+	m := r.Match
+	e := msg.Email
+	if m.From != "" && !contains(e.From, m.From) {
+		return false
+	}
+	if m.To != "" && !containsAny(e.To, m.To) {
+		return false
+	}
+	if m.Subject != "" && !contains(e.Subject, m.Subject) {
+		return false
+	}
+	if m.Account != "" && !accountMatches(msg.Account, e.AccountID, m.Account) {
+		return false
+	}
+	if m.Larger > 0 || m.Smaller > 0 {
+		if msg.Size == 0 {
+			return false
+		}
+		if m.Larger > 0 && msg.Size <= m.Larger {
+			return false
+		}
+		if m.Smaller > 0 && msg.Size >= m.Smaller {
+			return false
+		}
+	}
+	for name, text := range m.Headers {
+		if msg.Header == nil || !containsAny(msg.Header[textproto.CanonicalMIMEHeaderKey(name)], text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Describe summarises a rule's actions, e.g. "move to CI, mark read".
+func Describe(r config.Rule) string {
+	parts := make([]string, 0, len(r.Actions))
+	for _, a := range r.Actions {
+		if a.Type == ActionMove {
+			parts = append(parts, "move to "+a.Folder)
+			continue
+		}
+		parts = append(parts, strings.ReplaceAll(a.Type, "_", " "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Notice is a notification a rule asked for.
+type Notice struct {
+	Rule  string
+	Email config.CachedEmail
+}
+
+// Plan is what a set of rules does to a batch of messages in one folder.
+type Plan struct {
+	Folder  string
+	Read    []uint32
+	Flag    []uint32
+	Move    map[string][]uint32
+	Archive []uint32
+	Delete  []uint32
+	Notices []Notice
+}
+
+// Evaluate runs rules, in order, over messages in folder. A message stops
+// being considered once a rule moves, archives or deletes it, or once a
+// matching rule has Stop set. Invalid rules are skipped.
+func Evaluate(rules []config.Rule, folder string, msgs []Message) *Plan {
+	plan := &Plan{Folder: folder, Move: make(map[string][]uint32)}
+	for _, msg := range msgs {
+		uid := msg.Email.UID
+		read, flagged := msg.Email.IsRead, msg.Email.IsFlagged
+	matching:
+		for _, r := range rules {
+			if Validate(r) != nil || !Match(r, msg) {
+				continue
+			}
+			for _, a := range r.Actions {
+				switch a.Type {
+				case ActionMarkRead:
+					if !read {
+						read = true
+						plan.Read = append(plan.Read, uid)
+					}
+				case ActionFlag:
+					if !flagged {
+						flagged = true
+						plan.Flag = append(plan.Flag, uid)
+					}
+				case ActionNotify:
+					plan.Notices = append(plan.Notices, Notice{Rule: r.Name, Email: msg.Email})
+				case ActionMove:
+					if strings.EqualFold(a.Folder, folder) {
+						continue
+					}
+					plan.Move[a.Folder] = append(plan.Move[a.Folder], uid)
+					break matching
+				case ActionArchive:
+					plan.Archive = append(plan.Archive, uid)
+					break matching
+				case ActionDelete:
+					plan.Delete = append(plan.Delete, uid)
+					break matching
+				}
+			}
+			if r.Stop {
+				break
+			}
+		}
+	}
+	return plan
+}
+
+// Removed returns the UIDs the plan takes out of the folder.
+func (p *Plan) Removed() []uint32 {
+	var uids []uint32
+	for _, moved := range p.Move {
+		uids = append(uids, moved...)
+	}
+	uids = append(uids, p.Archive...)
+	return append(uids, p.Delete...)
+}
+
+// Empty reports whether the plan changes nothing.
+func (p *Plan) Empty() bool {
+	return len(p.Read) == 0 && len(p.Flag) == 0 && len(p.Removed()) == 0
+}
+
+// Apply carries out the plan. Flags are set before messages are moved, so
+// they travel with them. It keeps going after a failure and returns all
+// errors joined.
+func (p *Plan) Apply(ctx context.Context, w backend.EmailWriter) error {
+	var errs []error
+	for _, uid := range p.Read {
+		if err := w.MarkAsRead(ctx, p.Folder, uid); err != nil {
+			errs = append(errs, fmt.Errorf("mark %d read: %w", uid, err))
+		}
+	}
+	for _, uid := range p.Flag {
+		if err := w.MarkFlagged(ctx, p.Folder, uid); err != nil {
+			errs = append(errs, fmt.Errorf("flag %d: %w", uid, err))
+		}
+	}
+	folders := make([]string, 0, len(p.Move))
+	for folder := range p.Move {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		if err := w.MoveEmails(ctx, p.Move[folder], p.Folder, folder); err != nil {
+			errs = append(errs, fmt.Errorf("move to %s: %w", folder, err))
+		}
+	}
+	if len(p.Archive) > 0 {
+		if err := w.ArchiveEmails(ctx, p.Folder, p.Archive); err != nil {
+			errs = append(errs, fmt.Errorf("archive: %w", err))
+		}
+	}
+	if len(p.Delete) > 0 {
+		if err := w.DeleteEmails(ctx, p.Folder, p.Delete); err != nil {
+			errs = append(errs, fmt.Errorf("delete: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contains(value, text string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(text))
+}
+
+func containsAny(values []string, text string) bool {
+	for _, v := range values {
+		if contains(v, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func accountMatches(acct *config.Account, accountID, want string) bool {
+	if strings.EqualFold(accountID, want) {
+		return true
+	}
+	if acct == nil {
+		return false
+	}
+	return strings.EqualFold(acct.Email, want) || strings.EqualFold(acct.FetchEmail, want) || strings.EqualFold(acct.Name, want)
+}
@@ -0,0 +1,212 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+)
+
+func testMessages() []Message {
+	work := &config.Account{ID: "work", Email: "me@work.example"}
+	return []Message{
+		{
+			Email:   config.CachedEmail{UID: 1, AccountID: "work", From: "CI <ci@example.com>", To: []string{"me@work.example"}, Subject: "Build failed"},
+			Account: work,
+			Size:    2_000,
+			Header:  mail.Header{"List-Id": {"Builds <builds.example.com>"}},
+		},
+		{
+			Email:   config.CachedEmail{UID: 2, AccountID: "work", From: "Alice <alice@example.com>", To: []string{"team@work.example"}, Subject: "Slides", IsRead: true},
+			Account: work,
+			Size:    12_000_000,
+		},
+		{
+			Email: config.CachedEmail{UID: 3, AccountID: "home", From: "ci@example.com", Subject: "Build passed"},
+		},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		match config.RuleMatch
+		want  []uint32
+	}{
+		{"from is case-insensitive", config.RuleMatch{From: "CI@EXAMPLE"}, []uint32{1, 3}},
+		{"all conditions must hold", config.RuleMatch{From: "ci@", Subject: "failed"}, []uint32{1}},
+		{"to", config.RuleMatch{To: "team@"}, []uint32{2}},
+		{"account by email", config.RuleMatch{Account: "me@work.example"}, []uint32{1, 2}},
+		{"account by id", config.RuleMatch{Account: "home"}, []uint32{3}},
+		{"header", config.RuleMatch{Headers: map[string]string{"list-id": "builds.example"}}, []uint32{1}},
+		{"larger needs a size", config.RuleMatch{Larger: 1_000}, []uint32{1, 2}},
+		{"smaller", config.RuleMatch{Smaller: 10_000}, []uint32{1}},
+	}
+	for _, tt := range tests {
+		rule := config.Rule{Name: tt.name, Match: tt.match}
+		var got []uint32
+		for _, msg := range testMessages() {
+			if Match(rule, msg) {
+				got = append(got, msg.Email.UID)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matched %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		rule config.Rule
+		err  string
+	}{
+		{config.Rule{Name: "ok", Match: config.RuleMatch{From: "a"}, Actions: []config.RuleAction{{Type: ActionDelete}}}, ""},
+		{config.Rule{Match: config.RuleMatch{From: "a"}, Actions: []config.RuleAction{{Type: ActionDelete}}}, "no name"},
+		{config.Rule{Name: "all", Actions: []config.RuleAction{{Type: ActionDelete}}}, "no conditions"},
+		{config.Rule{Name: "idle", Match: config.RuleMatch{From: "a"}}, "no actions"},
+		{config.Rule{Name: "move", Match: config.RuleMatch{From: "a"}, Actions: []config.RuleAction{{Type: ActionMove}}}, "needs a folder"},
+		{config.Rule{Name: "odd", Match: config.RuleMatch{From: "a"}, Actions: []config.RuleAction{{Type: "forward"}}}, "unknown action"},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.rule)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.rule.Name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.rule.Name, err, tt.err)
+		}
+	}
+}
+
+func TestForFolder(t *testing.T) {
+	ruleSet := []config.Rule{
+		{Name: "inbox"},
+		{Name: "lists", Match: config.RuleMatch{Folder: "Lists"}},
+	}
+	names := func(rs []config.Rule) []string {
+		var out []string
+		for _, r := range rs {
+			out = append(out, r.Name)
+		}
+		return out
+	}
+	if got := names(ForFolder(ruleSet, "INBOX")); !reflect.DeepEqual(got, []string{"inbox"}) {
+		t.Errorf("INBOX rules = %v, want [inbox]", got)
+	}
+	if got := names(ForFolder(ruleSet, "lists")); !reflect.DeepEqual(got, []string{"lists"}) {
+		t.Errorf("Lists rules = %v, want [lists]", got)
+	}
+	if got := ForFolder(ruleSet, "Archive"); len(got) != 0 {
+		t.Errorf("Archive rules = %v, want none", names(got))
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ruleSet := []config.Rule{
+		{
+			Name:    "CI",
+			Match:   config.RuleMatch{From: "ci@"},
+			Actions: []config.RuleAction{{Type: ActionMarkRead}, {Type: ActionMove, Folder: "CI"}},
+		},
+		// Never sees the CI mail: it was moved by the rule above.
+		{Name: "Builds", Match: config.RuleMatch{Subject: "build"}, Actions: []config.RuleAction{{Type: ActionDelete}}},
+		{Name: "Big", Match: config.RuleMatch{Larger: 10_000_000}, Actions: []config.RuleAction{{Type: ActionFlag}, {Type: ActionNotify}}, Stop: true},
+		{Name: "After stop", Match: config.RuleMatch{From: "alice"}, Actions: []config.RuleAction{{Type: ActionArchive}}},
+		// Invalid rules are skipped rather than matching everything.
+		{Name: "Everything", Actions: []config.RuleAction{{Type: ActionDelete}}},
+	}
+	plan := Evaluate(ruleSet, "INBOX", testMessages())
+
+	if !reflect.DeepEqual(plan.Read, []uint32{1, 3}) {
+		t.Errorf("Read = %v", plan.Read)
+	}
+	if !reflect.DeepEqual(plan.Move, map[string][]uint32{"CI": {1, 3}}) {
+		t.Errorf("Move = %v", plan.Move)
+	}
+	if !reflect.DeepEqual(plan.Flag, []uint32{2}) {
+		t.Errorf("Flag = %v", plan.Flag)
+	}
+	if len(plan.Delete) != 0 || len(plan.Archive) != 0 {
+		t.Errorf("Delete = %v, Archive = %v, want none", plan.Delete, plan.Archive)
+	}
+	if len(plan.Notices) != 1 || plan.Notices[0].Rule != "Big" || plan.Notices[0].Email.UID != 2 {
+		t.Errorf("Notices = %+v", plan.Notices)
+	}
+
+	// Moving mail into the folder it is already in does nothing.
+	if plan := Evaluate(ruleSet[:1], "ci", testMessages()); len(plan.Removed()) != 0 {
+		t.Errorf("move into the same folder removed %v", plan.Removed())
+	}
+}
+
+// recordingWriter is a backend.EmailWriter that records the calls it gets.
+type recordingWriter struct {
+	backend.EmailWriter
+	calls []string
+	fail  string
+}
+
+func (w *recordingWriter) record(call string) error {
+	w.calls = append(w.calls, call)
+	if call == w.fail {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (w *recordingWriter) MarkAsRead(_ context.Context, folder string, uid uint32) error {
+	return w.record(fmt.Sprintf("read %s %d", folder, uid))
+}
+
+func (w *recordingWriter) MarkFlagged(_ context.Context, folder string, uid uint32) error {
+	return w.record(fmt.Sprintf("flag %s %d", folder, uid))
+}
+
+func (w *recordingWriter) MoveEmails(_ context.Context, uids []uint32, src, dst string) error {
+	return w.record(fmt.Sprintf("move %s %v %s", src, uids, dst))
+}
+
+func (w *recordingWriter) ArchiveEmails(_ context.Context, folder string, uids []uint32) error {
+	return w.record(fmt.Sprintf("archive %s %v", folder, uids))
+}
+
+func (w *recordingWriter) DeleteEmails(_ context.Context, folder string, uids []uint32) error {
+	return w.record(fmt.Sprintf("delete %s %v", folder, uids))
+}
+
+func TestPlanApply(t *testing.T) {
+	plan := &Plan{
+		Folder:  "INBOX",
+		Read:    []uint32{1},
+		Flag:    []uint32{2},
+		Move:    map[string][]uint32{"Lists": {4}, "CI": {1, 3}},
+		Archive: []uint32{5},
+		Delete:  []uint32{6},
+	}
+	w := &recordingWriter{fail: "move INBOX [1 3] CI"}
+	err := plan.Apply(context.Background(), w)
+	if err == nil || !strings.Contains(err.Error(), "move to CI") {
+		t.Errorf("Apply error = %v, want the failed move", err)
+	}
+	want := []string{
+		"read INBOX 1",
+		"flag INBOX 2",
+		"move INBOX [1 3] CI",
+		"move INBOX [4] Lists",
+		"archive INBOX [5]",
+		"delete INBOX [6]",
+	}
+	if !reflect.DeepEqual(w.calls, want) {
+		t.Errorf("calls = %q, want %q", w.calls, want)
+	}
+}
@@ -0,0 +1,487 @@
+// Package searchindex is a local full-text index over cached email headers
+// and bodies. It lets search work offline and across all accounts at once.
+//
+// The index lives in a single file in the cache directory, encrypted like
+// the other caches when secure mode is on. It is written by one process at a
+// time: the daemon when it is running, the TUI otherwise. Readers pick up
+// the writer's changes the next time they search.
+package searchindex
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+)
+
+// indexVersion is bumped when the tokenizer or file layout changes, which
+// discards indexes written by older versions.
+const indexVersion = 2
+
+// defaultLimit caps results when the query does not set a limit.
+const defaultLimit = 100
+
+// Term prefixes keep the fields apart in the shared term table.
+const (
+	fieldFrom    = "f:"
+	fieldTo      = "t:"
+	fieldSubject = "s:"
+	fieldBody    = "b:"
+)
+
+// Doc is an indexed email.
+type Doc struct {
+	AccountID  string    `json:"account_id"`
+	Folder     string    `json:"folder"`
+	UID        uint32    `json:"uid"`
+	From       string    `json:"from"`
+	To         []string  `json:"to,omitempty"`
+	Subject    string    `json:"subject"`
+	Date       time.Time `json:"date"`
+	MessageID  string    `json:"message_id,omitempty"`
+	InReplyTo  string    `json:"in_reply_to,omitempty"`
+	References []string  `json:"references,omitempty"`
+	IsRead     bool      `json:"is_read,omitempty"`
+	IsFlagged  bool      `json:"is_flagged,omitempty"`
+	Labels     []string  `json:"labels,omitempty"`
+	// Size is the length of the indexed body, zero until it is indexed.
+	Size    int  `json:"size,omitempty"`
+	HasBody bool `json:"has_body,omitempty"`
+	// HasAttachment is only known once the body is indexed.
+	HasAttachment bool `json:"has_attachment,omitempty"`
+}
+
+func docKey(accountID, folder string, uid uint32) string {
+	return accountID + "\x00" + folder + "\x00" + strconv.FormatUint(uint64(uid), 10)
+}
+
+// indexFile is the on-disk form of the index. Postings may reference
+// removed documents until the next compaction.
+type indexFile struct {
+	Version int                 `json:"version"`
+	NextID  uint32              `json:"next_id"`
+	Docs    map[uint32]*Doc     `json:"docs"`
+	Terms   map[string][]uint32 `json:"terms"`
+}
+
+// Index is an inverted index from field-prefixed terms to documents.
+type Index struct {
+	mu sync.Mutex
+
+	file indexFile
+	keys map[string]uint32
+	// sorted is the term table in order, for prefix lookups. nil when it
+	// needs rebuilding.
+	sorted []string
+	stale  int
+	dirty  bool
+
+	path    string
+	modTime time.Time
+}
+
+var (
+	defaultIndex   *Index
+	defaultIndexMu sync.Mutex
+)
+
+// Open returns the process-wide index, loading it on first use and
+// reloading it when another process has saved a newer version.
+func Open() (*Index, error) {
+	defaultIndexMu.Lock()
+	defer defaultIndexMu.Unlock()
+
+	if defaultIndex == nil {
+		path, err := indexPath()
+		if err != nil {
+			return nil, err
+		}
+		defaultIndex = newIndex(path)
+	}
+	if err := defaultIndex.reload(); err != nil {
+		return nil, err
+	}
+	return defaultIndex, nil
+}
+
+func indexPath() (string, error) {
+	dir, err := config.GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "search_index.json"), nil
+}
+
+func newIndex(path string) *Index {
+	ix := &Index{path: path}
+	ix.reset()
+	return ix
+}
+
+func (ix *Index) reset() {
+	ix.file = indexFile{
+		Version: indexVersion,
+		Docs:    make(map[uint32]*Doc),
+		Terms:   make(map[string][]uint32),
+	}
+	ix.keys = make(map[string]uint32)
+	ix.sorted = nil
+	ix.stale = 0
+}
+
+// reload reads the file if it changed since it was last read or written.
+// Unsaved changes are never discarded.
+func (ix *Index) reload() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.dirty {
+		return nil
+	}
+	info, err := os.Stat(ix.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.ModTime().Equal(ix.modTime) {
+		return nil
+	}
+
+	data, err := config.SecureReadFile(ix.path)
+	if err != nil {
+		return err
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != indexVersion {
+		// Unreadable or outdated: start over, the caches repopulate it.
+		ix.reset()
+		ix.modTime = info.ModTime()
+		return nil //nolint:nilerr
+	}
+
+	ix.reset()
+	if file.Docs != nil {
+		ix.file.Docs = file.Docs
+	}
+	if file.Terms != nil {
+		ix.file.Terms = file.Terms
+	}
+	ix.file.NextID = file.NextID
+	for id, doc := range ix.file.Docs {
+		ix.keys[docKey(doc.AccountID, doc.Folder, doc.UID)] = id
+	}
+	ix.modTime = info.ModTime()
+	return nil
+}
+
+// Flush writes pending changes to disk, compacting postings first when
+// enough documents have been removed.
+func (ix *Index) Flush() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if !ix.dirty {
+		return nil
+	}
+	if ix.stale > len(ix.file.Docs)/4 {
+		ix.compact()
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(ix.file)
+	if err != nil {
+		return err
+	}
+	if err := config.SecureWriteFile(ix.path, data, 0600); err != nil {
+		return err
+	}
+	ix.dirty = false
+	if info, err := os.Stat(ix.path); err == nil {
+		ix.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// compact drops postings of removed documents.
+func (ix *Index) compact() {
+	for term, ids := range ix.file.Terms {
+		kept := ids[:0]
+		for _, id := range ids {
+			if _, ok := ix.file.Docs[id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ix.file.Terms, term)
+		} else {
+			ix.file.Terms[term] = kept
+		}
+	}
+	ix.sorted = nil
+	ix.stale = 0
+}
+
+// AddEmails indexes the headers of a folder's emails. Emails already in the
+// index only have their flags and labels refreshed; their headers cannot
+// change under the same UID.
+func (ix *Index) AddEmails(folder string, emails []config.CachedEmail) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, e := range emails {
+		if id, ok := ix.keys[docKey(e.AccountID, folder, e.UID)]; ok {
+			doc := ix.file.Docs[id]
+			if doc.IsRead != e.IsRead || doc.IsFlagged != e.IsFlagged || !slices.Equal(doc.Labels, e.Labels) {
+				doc.IsRead, doc.IsFlagged, doc.Labels = e.IsRead, e.IsFlagged, e.Labels
+				ix.dirty = true
+			}
+			continue
+		}
+
+		id := ix.file.NextID
+		ix.file.NextID++
+		ix.file.Docs[id] = &Doc{
+			AccountID:  e.AccountID,
+			Folder:     folder,
+			UID:        e.UID,
+			From:       e.From,
+			To:         e.To,
+			Subject:    e.Subject,
+			Date:       e.Date,
+			MessageID:  e.MessageID,
+			InReplyTo:  e.InReplyTo,
+			References: e.References,
+			IsRead:     e.IsRead,
+			IsFlagged:  e.IsFlagged,
+			Labels:     e.Labels,
+		}
+		ix.keys[docKey(e.AccountID, folder, e.UID)] = id
+
+		ix.post(id, fieldFrom, tokenize(e.From))
+		ix.post(id, fieldTo, tokenize(strings.Join(e.To, " ")))
+		ix.post(id, fieldSubject, tokenize(e.Subject))
+		ix.dirty = true
+	}
+}
+
+// AddBody indexes the body of an email whose headers are already indexed.
+// Bodies of unknown emails, or ones indexed before, are ignored.
+func (ix *Index) AddBody(accountID, folder string, uid uint32, body, mimeType string, hasAttachment bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	id, ok := ix.keys[docKey(accountID, folder, uid)]
+	if !ok {
+		return
+	}
+	doc := ix.file.Docs[id]
+	if doc.HasBody {
+		return
+	}
+	text := body
+	if mimeType == "text/html" || (mimeType == "" && looksLikeHTML(body)) {
+		text = htmlText(body)
+	}
+	ix.post(id, fieldBody, tokenize(text))
+	doc.HasBody = true
+	doc.HasAttachment = hasAttachment
+	doc.Size = len(body)
+	ix.dirty = true
+}
+
+// HasBody reports whether the email's body has been indexed.
+func (ix *Index) HasBody(accountID, folder string, uid uint32) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	id, ok := ix.keys[docKey(accountID, folder, uid)]
+	return ok && ix.file.Docs[id].HasBody
+}
+
+// Remove drops emails from the index, e.g. after they were deleted or moved.
+func (ix *Index) Remove(accountID, folder string, uids []uint32) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, uid := range uids {
+		key := docKey(accountID, folder, uid)
+		if id, ok := ix.keys[key]; ok {
+			delete(ix.keys, key)
+			delete(ix.file.Docs, id)
+			ix.stale++
+			ix.dirty = true
+		}
+	}
+}
+
+// RemoveFolder drops every email of an account's folder, e.g. after its
+// UIDVALIDITY changed.
+func (ix *Index) RemoveFolder(accountID, folder string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for id, doc := range ix.file.Docs {
+		if doc.AccountID == accountID && doc.Folder == folder {
+			delete(ix.keys, docKey(doc.AccountID, doc.Folder, doc.UID))
+			delete(ix.file.Docs, id)
+			ix.stale++
+			ix.dirty = true
+		}
+	}
+}
+
+// post adds id to the postings of each token under the field prefix.
+func (ix *Index) post(id uint32, field string, tokens []string) {
+	for _, tok := range tokens {
+		term := field + tok
+		ids, ok := ix.file.Terms[term]
+		if !ok {
+			ix.sorted = nil
+		}
+		// Tokens repeat within a field; skip the repeats.
+		if n := len(ids); n == 0 || ids[n-1] != id {
+			ix.file.Terms[term] = append(ids, id)
+		}
+	}
+}
+
+// Search returns the emails in folder matching the query, newest first.
+// accountID restricts results to one account; empty searches all of them.
+//
+// Words match by prefix. From, To and Subject words must appear in that
+// header; body words may appear in the subject or body. Cc is not cached
+// separately, so cc: words match the recipients. Size and attachment terms
+// only match emails whose body has been indexed.
+func (ix *Index) Search(query backend.SearchQuery, folder, accountID string) []Doc {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	match := ix.compile(query.Expression())
+	var results []Doc
+	for id, doc := range ix.file.Docs {
+		if doc.Folder != folder || (accountID != "" && doc.AccountID != accountID) {
+			continue
+		}
+		if match(id, doc) {
+			results = append(results, *doc)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Date.After(results[j].Date)
+	})
+	limit := int(query.Limit)
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matcher reports whether a document matches part of a query.
+type matcher func(id uint32, doc *Doc) bool
+
+// compile turns a search expression into a matcher. Word terms are looked
+// up in the term table once, up front.
+func (ix *Index) compile(e *backend.SearchExpr) matcher {
+	if e == nil {
+		return func(uint32, *Doc) bool { return true }
+	}
+	switch e.Op {
+	case backend.SearchAnd, backend.SearchOr:
+		children := make([]matcher, len(e.Children))
+		for i, child := range e.Children {
+			children[i] = ix.compile(child)
+		}
+		want := e.Op == backend.SearchOr
+		return func(id uint32, doc *Doc) bool {
+			for _, child := range children {
+				if child(id, doc) == want {
+					return want
+				}
+			}
+			return !want
+		}
+	case backend.SearchNot:
+		child := ix.compile(e.Children[0])
+		return func(id uint32, doc *Doc) bool { return !child(id, doc) }
+	}
+
+	switch e.Field {
+	case backend.SearchFrom:
+		return ix.words(e.Text, fieldFrom)
+	case backend.SearchTo, backend.SearchCc:
+		return ix.words(e.Text, fieldTo)
+	case backend.SearchSubject:
+		return ix.words(e.Text, fieldSubject)
+	case backend.SearchBody:
+		return ix.words(e.Text, fieldSubject, fieldBody)
+	case backend.SearchSince:
+		return func(_ uint32, doc *Doc) bool { return !doc.Date.Before(e.Time) }
+	case backend.SearchBefore:
+		return func(_ uint32, doc *Doc) bool { return doc.Date.Before(e.Time) }
+	case backend.SearchLarger:
+		return func(_ uint32, doc *Doc) bool { return doc.HasBody && doc.Size > e.Size }
+	case backend.SearchSmaller:
+		return func(_ uint32, doc *Doc) bool { return doc.HasBody && doc.Size < e.Size }
+	case backend.SearchFlagged:
+		return func(_ uint32, doc *Doc) bool { return doc.IsFlagged == e.Bool }
+	case backend.SearchRead:
+		return func(_ uint32, doc *Doc) bool { return doc.IsRead == e.Bool }
+	case backend.SearchAttachment:
+		return func(_ uint32, doc *Doc) bool { return doc.HasBody && doc.HasAttachment == e.Bool }
+	}
+	return func(uint32, *Doc) bool { return true }
+}
+
+// words matches documents containing every word of text, by prefix, in any
+// of the fields.
+func (ix *Index) words(text string, fields ...string) matcher {
+	var sets []map[uint32]bool
+	for _, tok := range tokenize(text) {
+		set := make(map[uint32]bool)
+		for _, field := range fields {
+			for _, id := range ix.prefixPostings(field + tok) {
+				set[id] = true
+			}
+		}
+		sets = append(sets, set)
+	}
+	return func(id uint32, _ *Doc) bool {
+		for _, set := range sets {
+			if !set[id] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// prefixPostings returns the postings of every term starting with prefix.
+func (ix *Index) prefixPostings(prefix string) []uint32 {
+	if ix.sorted == nil {
+		ix.sorted = make([]string, 0, len(ix.file.Terms))
+		for term := range ix.file.Terms {
+			ix.sorted = append(ix.sorted, term)
+		}
+		sort.Strings(ix.sorted)
+	}
+
+	var ids []uint32
+	for i := sort.SearchStrings(ix.sorted, prefix); i < len(ix.sorted) && strings.HasPrefix(ix.sorted[i], prefix); i++ {
+		ids = append(ids, ix.file.Terms[ix.sorted[i]]...)
+	}
+	return ids
+}
@@ -0,0 +1,120 @@
+package searchindex
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+)
+
+func testEmails() []config.CachedEmail {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 9, 0, 0, 0, time.UTC) }
+	return []config.CachedEmail{
+		{UID: 1, AccountID: "work", From: "Alice <alice@example.com>", To: []string{"me@example.com"}, Subject: "Quarterly invoice", Date: day(1)},
+		{UID: 2, AccountID: "work", From: "Bob <bob@example.com>", To: []string{"me@example.com"}, Subject: "Lunch?", Date: day(2), IsFlagged: true},
+		{UID: 7, AccountID: "home", From: "Alice <alice@example.org>", To: []string{"me@example.org"}, Subject: "Holiday photos", Date: day(3)},
+	}
+}
+
+func searchUIDs(ix *Index, raw, folder, accountID string) []uint32 {
+	var uids []uint32
+	for _, doc := range ix.Search(backend.ParseSearchQuery(raw), folder, accountID) {
+		uids = append(uids, doc.UID)
+	}
+	return uids
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := newIndex(filepath.Join(t.TempDir(), "index.json"))
+	ix.AddEmails("INBOX", testEmails())
+	ix.AddBody("work", "INBOX", 2, "<html><style>p { color: red }</style><p>Shall we try the new ramen place?</p></html>", "text/html", false)
+	ix.AddBody("home", "INBOX", 7, "Pictures from the beach attached.", "text/plain", true)
+
+	tests := []struct {
+		name, query, account string
+		want                 []uint32
+	}{
+		{"from across accounts", "from:alice", "", []uint32{7, 1}},
+		{"from in one account", "from:alice", "work", []uint32{1}},
+		{"subject prefix", "subject:invo", "", []uint32{1}},
+		{"body text", "ramen", "", []uint32{2}},
+		{"free text matches subject", "holiday", "", []uint32{7}},
+		{"style contents are not indexed", "color", "", nil},
+		{"all words must match", "beach ramen", "", nil},
+		{"flagged", "flagged:yes", "", []uint32{2}},
+		{"since", "since:2026-03-02", "", []uint32{7, 2}},
+		{"larger", "larger:40 body:the", "", []uint32{2}},
+		{"or", "from:bob OR subject:holiday", "", []uint32{7, 2}},
+		{"negation", "-from:alice", "", []uint32{2}},
+		{"attachment", "has:attachment", "", []uint32{7}},
+		{"unread", "is:unread -is:flagged", "", []uint32{7, 1}},
+	}
+	for _, tt := range tests {
+		got := searchUIDs(ix, tt.query, "INBOX", tt.account)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %q = %v, want %v", tt.name, tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: %q = %v, want %v", tt.name, tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+
+	if got := searchUIDs(ix, "from:alice", "Archive", ""); len(got) != 0 {
+		t.Errorf("other folder returned %v", got)
+	}
+}
+
+func TestIndexRemoveAndPersist(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "index.json")
+
+	ix := newIndex(path)
+	ix.AddEmails("INBOX", testEmails())
+	ix.AddBody("work", "INBOX", 1, "Payment due in 30 days", "text/plain", false)
+	ix.Remove("work", "INBOX", []uint32{2})
+	ix.RemoveFolder("home", "INBOX")
+	if err := ix.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	loaded := newIndex(path)
+	if err := loaded.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := searchUIDs(loaded, "", "INBOX", ""); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("after reload = %v, want [1]", got)
+	}
+	if got := searchUIDs(loaded, "payment", "INBOX", ""); len(got) != 1 {
+		t.Errorf("body search after reload = %v, want [1]", got)
+	}
+	if !loaded.HasBody("work", "INBOX", 1) {
+		t.Error("HasBody lost across reload")
+	}
+
+	// Flag changes on known emails are picked up without re-indexing.
+	emails := testEmails()[:1]
+	emails[0].IsFlagged = true
+	loaded.AddEmails("INBOX", emails)
+	if got := searchUIDs(loaded, "flagged:yes", "INBOX", ""); len(got) != 1 {
+		t.Errorf("flagged after update = %v, want [1]", got)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Re: Re: Q3 invoice #42 — a café")
+	want := []string{"re", "q3", "invoice", "42", "café"}
+	if len(got) != len(want) {
+		t.Fatalf("tokenize = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("tokenize = %q, want %q", got, want)
+		}
+	}
+}
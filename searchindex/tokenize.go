@@ -0,0 +1,75 @@
+package searchindex
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Tokens outside these bounds are noise (single letters) or not worth
+// indexing (base64 blobs, long URLs).
+const (
+	minTokenLen = 2
+	maxTokenLen = 40
+)
+
+// tokenize splits text into lowercase words of letters and digits. Each
+// word is returned once.
+func tokenize(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if n := len([]rune(word)); n < minTokenLen || n > maxTokenLen || seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+func looksLikeHTML(body string) bool {
+	head := strings.ToLower(body)
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return strings.Contains(head, "<html") || strings.Contains(head, "<body") || strings.Contains(head, "<div") || strings.Contains(head, "<p")
+}
+
+// htmlText returns the text of an HTML body: tags and the contents of
+// <style> and <script> are dropped and entities decoded.
+func htmlText(body string) string {
+	var b strings.Builder
+	lower := strings.ToLower(body)
+	for i := 0; i < len(body); {
+		if body[i] != '<' {
+			next := strings.IndexByte(body[i:], '<')
+			if next < 0 {
+				next = len(body) - i
+			}
+			b.WriteString(body[i : i+next])
+			i += next
+			continue
+		}
+
+		end := strings.IndexByte(body[i:], '>')
+		if end < 0 {
+			break
+		}
+		tag := lower[i : i+end+1]
+		i += end + 1
+		for _, skip := range []string{"style", "script"} {
+			if strings.HasPrefix(tag, "<"+skip) {
+				if close := strings.Index(lower[i:], "</"+skip); close >= 0 {
+					i += close
+				} else {
+					i = len(body)
+				}
+			}
+		}
+		b.WriteByte(' ')
+	}
+	return html.UnescapeString(b.String())
+}
@@ -3,7 +3,6 @@ package sender
 import (
 	"bytes"
 	"crypto/rand"
-	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
@@ -18,6 +17,7 @@ import (
 	"net/textproto"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,7 +26,6 @@ import (
 	"github.com/emersion/go-pgpmail"
 	"github.com/floatpane/matcha/clib"
 	"github.com/floatpane/matcha/config"
-	"github.com/floatpane/matcha/internal/loglevel"
 	"github.com/floatpane/matcha/pgp"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
@@ -212,17 +211,47 @@ func writeQuotedPrintable(w io.Writer, body string) error {
 	return nil
 }
 
+// reservedHeaders are the top-level headers SendEmail writes itself; extra
+// headers may not replace them.
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Subject": true, "Date": true,
+	"Message-Id": true, "Mime-Version": true, "In-Reply-To": true, "References": true,
+	"Content-Type": true, "Content-Transfer-Encoding": true, "Content-Disposition": true,
+}
+
+// CheckExtraHeaders reports whether headers can be added to an outgoing
+// message: names must be valid header field names that SendEmail does not
+// write itself, and values must be a single line.
+func CheckExtraHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) >= 0 {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("header %q cannot be set", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %q has a line break in its value", name)
+		}
+	}
+	return nil
+}
+
 // SendEmail constructs a multipart message with plain text, HTML, embedded images, and attachments.
-func SendEmail(account *config.Account, to, cc, bcc []string, subject, plainBody, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, signSMIME bool, encryptSMIME bool, signPGP bool, encryptPGP bool) ([]byte, error) { //nolint:gocyclo
-	smtpServer := account.GetSMTPServer()
-	smtpPort := account.GetSMTPPort()
+func SendEmail(account *config.Account, to, cc, bcc []string, subject, plainBody, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, signSMIME bool, encryptSMIME bool, signPGP bool, encryptPGP bool) ([]byte, error) {
+	return SendEmailWithHeaders(account, to, cc, bcc, subject, plainBody, htmlBody, images, attachments, inReplyTo, references, nil, signSMIME, encryptSMIME, signPGP, encryptPGP)
+}
 
-	if smtpServer == "" {
-		return nil, fmt.Errorf("unsupported or missing service_provider: %s", account.ServiceProvider)
+// SendEmailWithHeaders is SendEmail with extra top-level headers, which must
+// pass CheckExtraHeaders.
+func SendEmailWithHeaders(account *config.Account, to, cc, bcc []string, subject, plainBody, htmlBody string, images map[string][]byte, attachments map[string][]byte, inReplyTo string, references []string, extraHeaders map[string]string, signSMIME bool, encryptSMIME bool, signPGP bool, encryptPGP bool) ([]byte, error) { //nolint:gocyclo
+	if err := CheckExtraHeaders(extraHeaders); err != nil {
+		return nil, err
 	}
 
-	plainAuth := smtp.PlainAuth("", account.Email, account.Password, smtpServer)
-	loginAuthFallback := &loginAuth{username: account.Email, password: account.Password}
+	if err := checkTransport(account); err != nil {
+		return nil, err
+	}
 
 	fromHeader := account.FormatFromHeader()
 
@@ -257,6 +286,14 @@ func SendEmail(account *config.Account, to, cc, bcc []string, subject, plainBody
 			fmt.Fprintf(&msg, "%s: %s\r\n", k, v)
 		}
 	}
+	extraNames := make([]string, 0, len(extraHeaders))
+	for k := range extraHeaders {
+		extraNames = append(extraNames, k)
+	}
+	sort.Strings(extraNames)
+	for _, k := range extraNames {
+		fmt.Fprintf(&msg, "%s: %s\r\n", textproto.CanonicalMIMEHeaderKey(k), mime.QEncoding.Encode("utf-8", extraHeaders[k]))
+	}
 
 	var payloadToEncrypt []byte
 	var innerBodyBytes []byte
@@ -677,117 +714,12 @@ func SendEmail(account *config.Account, to, cc, bcc []string, subject, plainBody
 		msg.Write(encrypted)
 	}
 
-	// Combine all recipients for the envelope
-	allRecipients := append([]string{}, to...)
-	allRecipients = append(allRecipients, cc...)
-	allRecipients = append(allRecipients, bcc...)
-
-	addr := fmt.Sprintf("%s:%d", smtpServer, smtpPort)
-
-	tlsConfig := &tls.Config{
-		ServerName:         smtpServer,
-		InsecureSkipVerify: account.Insecure, //nolint:gosec
-		MinVersion:         tls.VersionTLS12,
-		ClientSessionCache: account.GetClientSessionCache(),
-		VerifyConnection: func(cs tls.ConnectionState) error {
-			loglevel.Debugf("SMTP TLS connection resumed: %t", cs.DidResume)
-			return nil
-		},
-	}
-
-	var c *smtp.Client
-
-	// Port 465 uses implicit TLS (the connection starts with TLS).
-	// All other ports use plain TCP with optional STARTTLS upgrade.
-	if smtpPort == 465 {
-		conn, err := tls.Dial("tcp", addr, tlsConfig) //nolint:noctx
-		if err != nil {
-			return nil, err
-		}
-		c, err = smtp.NewClient(conn, smtpServer)
-		if err != nil {
-			conn.Close() //nolint:errcheck,gosec
-			return nil, err
-		}
-	} else {
-		var err error
-		c, err = smtp.Dial(addr)
-		if err != nil {
-			return nil, err
-		}
-	}
-	defer c.Close() //nolint:errcheck
-
-	if err = c.Hello(smtpHelloHostname()); err != nil {
+	if err = deliver(account, to, cc, bcc, msg.Bytes()); err != nil {
 		return nil, err
 	}
 
-	// Trigger STARTTLS if supported (not needed for implicit TLS on port 465)
-	if smtpPort != 465 {
-		if ok, _ := c.Extension("STARTTLS"); ok {
-			if err = c.StartTLS(tlsConfig); err != nil {
-				return nil, err
-			}
-		}
-	}
-
-	// Authenticate using the best available mechanism.
-	// c.Extension("AUTH") returns the list of supported mechanisms.
-	if ok, mechs := c.Extension("AUTH"); ok {
-		mechList := strings.ToUpper(mechs)
-
-		switch {
-		case account.IsOAuth2():
-			// Use XOAUTH2 for OAuth2-enabled accounts
-			token, tokenErr := config.GetOAuth2Token(account.Email)
-			if tokenErr != nil {
-				return nil, fmt.Errorf("oauth2: %w", tokenErr)
-			}
-			err = c.Auth(&xoauth2Auth{username: account.Email, token: token})
-		case strings.Contains(mechList, "PLAIN"):
-			err = c.Auth(plainAuth)
-		case strings.Contains(mechList, "LOGIN"):
-			err = c.Auth(loginAuthFallback)
-		default:
-			// Fall back to PLAIN and let the server decide
-			err = c.Auth(plainAuth)
-		}
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Send Envelope
-	if err = c.Mail(extractBareEmail(account.GetSendAsEmail())); err != nil {
-		return nil, err
-	}
-	for _, r := range allRecipients {
-		if err = c.Rcpt(r); err != nil {
-			return nil, err
-		}
-	}
-
-	// Write Data
-	w, err := c.Data()
-	if err != nil {
-		return nil, err
-	}
-	_, err = w.Write(msg.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	err = w.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	rawMsg := make([]byte, len(msg.Bytes()))
+	rawMsg := make([]byte, msg.Len())
 	copy(rawMsg, msg.Bytes())
-
-	if err := c.Quit(); err != nil {
-		return nil, err
-	}
-
 	return rawMsg, nil
 }
 
@@ -796,16 +728,10 @@ func SendEmail(account *config.Account, to, cc, bcc []string, subject, plainBody
 // - multipart/alternative with text/plain + text/calendar; method=REPLY
 // - text/calendar part must NOT be Content-Disposition: attachment
 func SendCalendarReply(account *config.Account, to []string, subject, plainBody string, icsData []byte, inReplyTo string, references []string) ([]byte, error) { //nolint:gocyclo
-	smtpServer := account.GetSMTPServer()
-	smtpPort := account.GetSMTPPort()
-
-	if smtpServer == "" {
-		return nil, fmt.Errorf("unsupported or missing service_provider: %s", account.ServiceProvider)
+	if err := checkTransport(account); err != nil {
+		return nil, err
 	}
 
-	plainAuth := smtp.PlainAuth("", account.Email, account.Password, smtpServer)
-	loginAuthFallback := &loginAuth{username: account.Email, password: account.Password}
-
 	fromHeader := account.FormatFromHeader()
 
 	var msg bytes.Buffer
@@ -902,103 +828,12 @@ func SendCalendarReply(account *config.Account, to []string, subject, plainBody
 		return nil, err
 	}
 
-	// Send via SMTP
-	addr := fmt.Sprintf("%s:%d", smtpServer, smtpPort)
-
-	tlsConfig := &tls.Config{
-		ServerName:         smtpServer,
-		InsecureSkipVerify: account.Insecure, //nolint:gosec
-		MinVersion:         tls.VersionTLS12,
-		ClientSessionCache: account.GetClientSessionCache(),
-		VerifyConnection: func(cs tls.ConnectionState) error {
-			loglevel.Debugf("SMTP TLS connection resumed: %t", cs.DidResume)
-			return nil
-		},
-	}
-
-	var c *smtp.Client
-
-	if smtpPort == 465 {
-		conn, err := tls.Dial("tcp", addr, tlsConfig) //nolint:noctx
-		if err != nil {
-			return nil, err
-		}
-		c, err = smtp.NewClient(conn, smtpServer)
-		if err != nil {
-			conn.Close() //nolint:errcheck,gosec
-			return nil, err
-		}
-	} else {
-		var err error
-		c, err = smtp.Dial(addr)
-		if err != nil {
-			return nil, err
-		}
-	}
-	defer c.Close() //nolint:errcheck
-
-	if err = c.Hello(smtpHelloHostname()); err != nil {
-		return nil, err
-	}
-
-	if smtpPort != 465 {
-		if ok, _ := c.Extension("STARTTLS"); ok {
-			if err = c.StartTLS(tlsConfig); err != nil {
-				return nil, err
-			}
-		}
-	}
-
-	if ok, mechs := c.Extension("AUTH"); ok {
-		mechList := strings.ToUpper(mechs)
-		switch {
-		case account.IsOAuth2():
-			token, tokenErr := config.GetOAuth2Token(account.Email)
-			if tokenErr != nil {
-				return nil, fmt.Errorf("oauth2: %w", tokenErr)
-			}
-			err = c.Auth(&xoauth2Auth{username: account.Email, token: token})
-		case strings.Contains(mechList, "PLAIN"):
-			err = c.Auth(plainAuth)
-		case strings.Contains(mechList, "LOGIN"):
-			err = c.Auth(loginAuthFallback)
-		default:
-			err = c.Auth(plainAuth)
-		}
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	if err = c.Mail(extractBareEmail(account.GetSendAsEmail())); err != nil {
-		return nil, err
-	}
-	for _, r := range to {
-		if err = c.Rcpt(r); err != nil {
-			return nil, err
-		}
-	}
-
-	w, err := c.Data()
-	if err != nil {
-		return nil, err
-	}
-	_, err = w.Write(msg.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	err = w.Close()
-	if err != nil {
+	if err := deliver(account, to, nil, nil, msg.Bytes()); err != nil {
 		return nil, err
 	}
 
-	rawMsg := make([]byte, len(msg.Bytes()))
+	rawMsg := make([]byte, msg.Len())
 	copy(rawMsg, msg.Bytes())
-
-	if err := c.Quit(); err != nil {
-		return nil, err
-	}
-
 	return rawMsg, nil
 }
 
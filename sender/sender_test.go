@@ -3,6 +3,9 @@ package sender
 import (
 	"errors"
 	"io"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -173,3 +176,130 @@ func TestExtractBareEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckExtraHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr string
+	}{
+		{name: "none", headers: nil},
+		{name: "custom headers", headers: map[string]string{"X-Priority": "1", "Organization": "Acme Café"}},
+		{name: "reserved in any case", headers: map[string]string{"subject": "hi"}, wantErr: "cannot be set"},
+		{name: "content headers", headers: map[string]string{"Content-Type": "text/html"}, wantErr: "cannot be set"},
+		{name: "space in name", headers: map[string]string{"X Bad": "1"}, wantErr: "invalid header name"},
+		{name: "colon in name", headers: map[string]string{"X-Bad:": "1"}, wantErr: "invalid header name"},
+		{name: "injected line", headers: map[string]string{"X-Note": "a\r\nBcc: someone@example.com"}, wantErr: "line break"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckExtraHeaders(tt.headers)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeSendmail writes a script that records its arguments and stdin in dir.
+func fakeSendmail(t *testing.T) (script, dir string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("sendmail command needs sh")
+	}
+	dir = t.TempDir()
+	script = filepath.Join(dir, "sendmail")
+	body := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + dir + "/args\ncat > " + dir + "/msg\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script, dir
+}
+
+func TestSendmailPassesRecipientsAsArguments(t *testing.T) {
+	script, dir := fakeSendmail(t)
+	msg := []byte("Subject: hi\r\n\r\nbody\r\n")
+	err := sendmail(script, []string{"Bob <bob@example.com>"}, []string{"carol@example.com"}, []string{"dave@example.com"}, msg)
+	if err != nil {
+		t.Fatalf("sendmail: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if got, want := string(args), "--\nbob@example.com\ncarol@example.com\ndave@example.com\n"; got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "msg"))
+	if string(got) != string(msg) {
+		t.Errorf("stdin = %q, want %q", got, msg)
+	}
+}
+
+func TestSendmailReadsRecipientsFromHeadersWithT(t *testing.T) {
+	script, dir := fakeSendmail(t)
+	msg := []byte("To: bob@example.com\r\nSubject: hi\r\n\r\nbody\r\n")
+	if err := sendmail(script+" -t", []string{"bob@example.com"}, nil, []string{"dave@example.com"}, msg); err != nil {
+		t.Fatalf("sendmail: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if string(args) != "-t\n" {
+		t.Errorf("args = %q, want only -t", args)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "msg"))
+	if !strings.HasPrefix(string(got), "Bcc: dave@example.com\r\n") {
+		t.Errorf("stdin = %q, want a Bcc header first", got)
+	}
+}
+
+func TestSendmailRejectsOptionLikeRecipients(t *testing.T) {
+	script, dir := fakeSendmail(t)
+	err := sendmail(script, []string{"bob@example.com", "-oQ/tmp/x@example.com"}, nil, nil, []byte("Subject: hi\r\n\r\n"))
+	if err == nil {
+		t.Fatal("sendmail accepted a recipient starting with -")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "args")); err == nil {
+		t.Error("sendmail command ran")
+	}
+}
+
+func TestReadsRecipients(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"sendmail -t", true},
+		{"sendmail -ti", true},
+		{"sendmail -oi -t", true},
+		{"/usr/sbin/sendmail -it -f me@example.com", true},
+		{"msmtp --read-recipients", true},
+		{"msmtp -a work -t", true},
+		{"sendmail -i", false},
+		{"sendmail -oi", false},
+		{"msmtp -a tester", false},
+		{"sendmail -f tom@example.com", false},
+		{"sendmail -ftom@example.com", false},
+		{"msmtp --tls-trust-file=/etc/ssl/cert.pem", false},
+		{"sendmail -- -t", false},
+	}
+	for _, tt := range tests {
+		if got := readsRecipients(tt.command); got != tt.want {
+			t.Errorf("readsRecipients(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestSendmailReportsFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sendmail command needs sh")
+	}
+	err := sendmail("echo 'no route' >&2; exit 75", nil, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "no route") {
+		t.Fatalf("sendmail error = %v, want stderr in the error", err)
+	}
+}
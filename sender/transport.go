@@ -0,0 +1,233 @@
+package sender
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"os/exec"
+	"strings"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/internal/loglevel"
+)
+
+// checkTransport reports an error if account has no way to send mail.
+func checkTransport(account *config.Account) error {
+	if account.SendmailCommand == "" && account.GetSMTPServer() == "" {
+		return fmt.Errorf("unsupported or missing service_provider: %s", account.ServiceProvider)
+	}
+	return nil
+}
+
+// SendRaw sends a message that is already complete, such as one submitted
+// over SMTP, without changing it. to, cc and bcc are its envelope
+// recipients.
+func SendRaw(account *config.Account, to, cc, bcc []string, msg []byte) error {
+	if err := checkTransport(account); err != nil {
+		return err
+	}
+	return deliver(account, to, cc, bcc, msg)
+}
+
+// deliver hands a finished message to the account's transport: its
+// sendmail command if one is configured, and its SMTP server otherwise.
+func deliver(account *config.Account, to, cc, bcc []string, msg []byte) error {
+	if account.SendmailCommand != "" {
+		return sendmail(account.SendmailCommand, to, cc, bcc, msg)
+	}
+
+	recipients := append([]string{}, to...)
+	recipients = append(recipients, cc...)
+	recipients = append(recipients, bcc...)
+	return sendSMTP(account, recipients, msg)
+}
+
+// sendmail pipes msg to a sendmail-compatible command, such as msmtp or
+// "sendmail -i", run through the shell. The recipients are appended as
+// arguments after "--", unless the command reads them from the headers;
+// then Bcc recipients are passed in a Bcc header, which -t removes.
+func sendmail(command string, to, cc, bcc []string, msg []byte) error {
+	var stdin bytes.Buffer
+	if readsRecipients(command) {
+		if len(bcc) > 0 {
+			fmt.Fprintf(&stdin, "Bcc: %s\r\n", strings.Join(bcc, ", "))
+		}
+	} else {
+		recipients := append([]string{}, to...)
+		recipients = append(recipients, cc...)
+		recipients = append(recipients, bcc...)
+		command += " --"
+		for _, r := range recipients {
+			addr := extractBareEmail(r)
+			// An address sendmail could take for an option is refused
+			// rather than passed on, even after "--".
+			if strings.HasPrefix(addr, "-") {
+				return fmt.Errorf("sendmail: invalid recipient address %q", addr)
+			}
+			command += " " + shellQuote(addr)
+		}
+	}
+	stdin.Write(msg)
+
+	cmd := exec.Command("sh", "-c", command) //nolint:gosec,noctx
+	cmd.Stdin = &stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return fmt.Errorf("sendmail: %w: %s", err, detail)
+		}
+		return fmt.Errorf("sendmail: %w", err)
+	}
+	return nil
+}
+
+// sendmailArgOptions are the single-letter options of sendmail and msmtp
+// that take an argument, such as -f from or -oi, so the letters of that
+// argument are not read as options.
+const sendmailArgOptions = "aBbCdFfhLNOopqRrVX"
+
+// readsRecipients reports whether a sendmail command reads the recipients
+// from the message headers: with -t, also combined with other options as in
+// "sendmail -ti", or msmtp's --read-recipients.
+func readsRecipients(command string) bool {
+	fields := strings.Fields(command)
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "--":
+			return false
+		case f == "--read-recipients":
+			return true
+		case strings.HasPrefix(f, "--") || !strings.HasPrefix(f, "-"):
+			continue
+		}
+		for j, c := range f[1:] {
+			if c == 't' {
+				return true
+			}
+			if strings.ContainsRune(sendmailArgOptions, c) {
+				if j == len(f)-2 {
+					i++ // the argument is the next field
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sendSMTP sends msg to recipients through the account's SMTP server.
+func sendSMTP(account *config.Account, recipients []string, msg []byte) error {
+	smtpServer := account.GetSMTPServer()
+	smtpPort := account.GetSMTPPort()
+
+	plainAuth := smtp.PlainAuth("", account.Email, account.Password, smtpServer)
+	loginAuthFallback := &loginAuth{username: account.Email, password: account.Password}
+
+	addr := fmt.Sprintf("%s:%d", smtpServer, smtpPort)
+
+	tlsConfig := &tls.Config{
+		ServerName:         smtpServer,
+		InsecureSkipVerify: account.Insecure, //nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+		ClientSessionCache: account.GetClientSessionCache(),
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			loglevel.Debugf("SMTP TLS connection resumed: %t", cs.DidResume)
+			return nil
+		},
+	}
+
+	var c *smtp.Client
+
+	// Port 465 uses implicit TLS (the connection starts with TLS).
+	// All other ports use plain TCP with optional STARTTLS upgrade.
+	if smtpPort == 465 {
+		conn, err := tls.Dial("tcp", addr, tlsConfig) //nolint:noctx
+		if err != nil {
+			return err
+		}
+		c, err = smtp.NewClient(conn, smtpServer)
+		if err != nil {
+			conn.Close() //nolint:errcheck,gosec
+			return err
+		}
+	} else {
+		var err error
+		c, err = smtp.Dial(addr)
+		if err != nil {
+			return err
+		}
+	}
+	defer c.Close() //nolint:errcheck
+
+	if err := c.Hello(smtpHelloHostname()); err != nil {
+		return err
+	}
+
+	// Trigger STARTTLS if supported (not needed for implicit TLS on port 465)
+	if smtpPort != 465 {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Authenticate using the best available mechanism.
+	// c.Extension("AUTH") returns the list of supported mechanisms.
+	if ok, mechs := c.Extension("AUTH"); ok {
+		mechList := strings.ToUpper(mechs)
+
+		var err error
+		switch {
+		case account.IsOAuth2():
+			// Use XOAUTH2 for OAuth2-enabled accounts
+			token, tokenErr := config.GetOAuth2Token(account.Email)
+			if tokenErr != nil {
+				return fmt.Errorf("oauth2: %w", tokenErr)
+			}
+			err = c.Auth(&xoauth2Auth{username: account.Email, token: token})
+		case strings.Contains(mechList, "PLAIN"):
+			err = c.Auth(plainAuth)
+		case strings.Contains(mechList, "LOGIN"):
+			err = c.Auth(loginAuthFallback)
+		default:
+			// Fall back to PLAIN and let the server decide
+			err = c.Auth(plainAuth)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Send Envelope
+	if err := c.Mail(extractBareEmail(account.GetSendAsEmail())); err != nil {
+		return err
+	}
+	for _, r := range recipients {
+		if err := c.Rcpt(r); err != nil {
+			return err
+		}
+	}
+
+	// Write Data
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
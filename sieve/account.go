@@ -0,0 +1,82 @@
+package sieve
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/floatpane/matcha/config"
+)
+
+// Addr returns the ManageSieve "host:port" for an account: its SieveServer
+// if set, otherwise its IMAP host on DefaultPort.
+func Addr(account *config.Account) (string, error) {
+	server := strings.TrimSpace(account.SieveServer)
+	if server == "" {
+		server = account.GetIMAPServer()
+	}
+	if server == "" {
+		return "", fmt.Errorf("no ManageSieve server for %s: set sieve_server on the account", account.Email)
+	}
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server, nil
+	}
+	return net.JoinHostPort(server, strconv.Itoa(DefaultPort)), nil
+}
+
+// Connect opens an authenticated session for an account. addr overrides
+// the account's server when non-empty. The connection is upgraded with
+// STARTTLS when the server offers it; credentials are never sent in the
+// clear unless the account is marked insecure.
+func Connect(account *config.Account, addr string) (*Client, error) {
+	if account.Protocol != "" && account.Protocol != "imap" {
+		return nil, fmt.Errorf("ManageSieve is not available for %s accounts", account.Protocol)
+	}
+	if addr == "" {
+		var err error
+		if addr, err = Addr(account); err != nil {
+			return nil, err
+		}
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Dial(addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.HasCapability("STARTTLS") {
+		err = c.StartTLS(&tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: account.Insecure, //nolint:gosec
+			MinVersion:         tls.VersionTLS12,
+		})
+	} else if !account.Insecure {
+		err = errors.New("server does not offer STARTTLS; refusing to log in without TLS")
+	}
+	if err != nil {
+		c.Close() //nolint:errcheck,gosec
+		return nil, err
+	}
+
+	if account.IsOAuth2() {
+		token, terr := config.GetOAuth2Token(account.Email)
+		if terr != nil {
+			c.Close() //nolint:errcheck,gosec
+			return nil, fmt.Errorf("oauth2: %w", terr)
+		}
+		err = c.AuthenticateOAuth2(account.Email, token)
+	} else {
+		err = c.Authenticate(account.Email, account.Password)
+	}
+	if err != nil {
+		c.Close() //nolint:errcheck,gosec
+		return nil, fmt.Errorf("authentication error: %w", err)
+	}
+	return c, nil
+}
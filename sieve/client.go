@@ -0,0 +1,359 @@
+// Package sieve is a ManageSieve (RFC 5804) client for listing, fetching,
+// uploading and activating server-side Sieve filtering scripts, with helpers
+// for the vacation auto-reply block matcha manages inside a script.
+package sieve
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the registered ManageSieve port.
+const DefaultPort = 4190
+
+// DefaultScriptName is the script matcha creates when none is active.
+const DefaultScriptName = "matcha"
+
+// Script is a script stored on the server.
+type Script struct {
+	Name   string
+	Active bool
+}
+
+// Error is a NO or BYE response from the server.
+type Error struct {
+	// Code is the response code, e.g. "NONEXISTENT" or "QUOTA/MAXSCRIPTS".
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = "command failed"
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("sieve: %s (%s)", msg, e.Code)
+	}
+	return "sieve: " + msg
+}
+
+// Client is a connection to a ManageSieve server. It is not safe for
+// concurrent use.
+type Client struct {
+	conn net.Conn
+	host string
+	r    reader
+	w    *bufio.Writer
+	caps map[string]string
+	tls  bool
+}
+
+// Dial connects to addr. With a non-nil tlsConfig the connection uses
+// implicit TLS; otherwise call StartTLS before authenticating.
+func Dial(addr string, tlsConfig *tls.Config) (*Client, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := NewClient(conn, host)
+	if err != nil {
+		conn.Close() //nolint:errcheck,gosec
+		return nil, err
+	}
+	c.tls = tlsConfig != nil
+	return c, nil
+}
+
+// NewClient wraps an established connection and reads the server's
+// capability greeting.
+func NewClient(conn net.Conn, host string) (*Client, error) {
+	c := &Client{conn: conn, host: host}
+	c.reset()
+	if err := c.readCapabilities(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) reset() {
+	c.r = reader{bufio.NewReader(c.conn)}
+	c.w = bufio.NewWriter(c.conn)
+}
+
+// Capabilities returns the capabilities the server last advertised, keyed
+// by upper-case name, e.g. "SIEVE" or "SASL".
+func (c *Client) Capabilities() map[string]string {
+	return c.caps
+}
+
+// HasCapability reports whether the server advertised name.
+func (c *Client) HasCapability(name string) bool {
+	_, ok := c.caps[strings.ToUpper(name)]
+	return ok
+}
+
+// SupportsAuth reports whether the server offers a SASL mechanism.
+func (c *Client) SupportsAuth(mech string) bool {
+	for _, m := range strings.Fields(c.caps["SASL"]) {
+		if strings.EqualFold(m, mech) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsExtension reports whether the server's Sieve implementation has
+// an extension such as "vacation".
+func (c *Client) SupportsExtension(ext string) bool {
+	for _, e := range strings.Fields(c.caps["SIEVE"]) {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTLS reports whether the connection is encrypted.
+func (c *Client) IsTLS() bool {
+	return c.tls
+}
+
+// StartTLS upgrades the connection to TLS and re-reads the capabilities,
+// which the server resends afterwards.
+func (c *Client) StartTLS(config *tls.Config) error {
+	if _, err := c.cmd("STARTTLS"); err != nil {
+		return err
+	}
+	if config == nil {
+		config = &tls.Config{ServerName: c.host, MinVersion: tls.VersionTLS12}
+	}
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.tls = true
+	c.reset()
+	return c.readCapabilities()
+}
+
+// Authenticate logs in with SASL PLAIN.
+func (c *Client) Authenticate(username, password string) error {
+	ir := base64.StdEncoding.EncodeToString([]byte("\x00" + username + "\x00" + password))
+	return c.authenticate("PLAIN", ir)
+}
+
+// AuthenticateOAuth2 logs in with SASL XOAUTH2 and a bearer token.
+func (c *Client) AuthenticateOAuth2(username, token string) error {
+	ir := base64.StdEncoding.EncodeToString([]byte("user=" + username + "\x01auth=Bearer " + token + "\x01\x01"))
+	return c.authenticate("XOAUTH2", ir)
+}
+
+func (c *Client) authenticate(mech, ir string) error {
+	if _, err := c.cmd("AUTHENTICATE", quote(mech), quote(ir)); err != nil {
+		return err
+	}
+	// Servers may send new capabilities after a successful login; a fresh
+	// CAPABILITY keeps the cache accurate either way.
+	return c.refreshCapabilities()
+}
+
+// ListScripts returns the scripts on the server.
+func (c *Client) ListScripts() ([]Script, error) {
+	lines, err := c.cmd("LISTSCRIPTS")
+	if err != nil {
+		return nil, err
+	}
+	scripts := make([]Script, 0, len(lines))
+	for _, toks := range lines {
+		if len(toks) == 0 || toks[0].atom {
+			continue
+		}
+		s := Script{Name: toks[0].value}
+		s.Active = len(toks) > 1 && toks[1].atom && strings.EqualFold(toks[1].value, "ACTIVE")
+		scripts = append(scripts, s)
+	}
+	return scripts, nil
+}
+
+// ActiveScript returns the name of the active script, or "" when none is.
+func (c *Client) ActiveScript() (string, error) {
+	scripts, err := c.ListScripts()
+	if err != nil {
+		return "", err
+	}
+	for _, s := range scripts {
+		if s.Active {
+			return s.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// ReadActive returns the name and content of the active script. With no
+// active script it returns DefaultScriptName and no content, so writing it
+// back creates and activates a new script.
+func (c *Client) ReadActive() (string, string, error) {
+	name, err := c.ActiveScript()
+	if err != nil {
+		return "", "", err
+	}
+	if name == "" {
+		return DefaultScriptName, "", nil
+	}
+	content, err := c.GetScript(name)
+	if err != nil {
+		return "", "", err
+	}
+	return name, content, nil
+}
+
+// WriteActive uploads a script and makes it the active one.
+func (c *Client) WriteActive(name, content string) error {
+	if err := c.PutScript(name, content); err != nil {
+		return err
+	}
+	return c.SetActive(name)
+}
+
+// GetScript returns the content of a script.
+func (c *Client) GetScript(name string) (string, error) {
+	lines, err := c.cmd("GETSCRIPT", quote(name))
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 || len(lines[0]) == 0 {
+		return "", errors.New("sieve: empty GETSCRIPT response")
+	}
+	return lines[0][0].value, nil
+}
+
+// PutScript uploads a script, replacing any script with the same name. The
+// server checks the script and rejects it with an Error when it is invalid.
+func (c *Client) PutScript(name, content string) error {
+	_, err := c.cmd("PUTSCRIPT", quote(name), literal(content))
+	return err
+}
+
+// CheckScript asks the server to validate a script without storing it.
+func (c *Client) CheckScript(content string) error {
+	_, err := c.cmd("CHECKSCRIPT", literal(content))
+	return err
+}
+
+// SetActive makes the named script the active one. An empty name
+// deactivates all scripts.
+func (c *Client) SetActive(name string) error {
+	_, err := c.cmd("SETACTIVE", quote(name))
+	return err
+}
+
+// DeleteScript removes a script. The active script cannot be deleted.
+func (c *Client) DeleteScript(name string) error {
+	_, err := c.cmd("DELETESCRIPT", quote(name))
+	return err
+}
+
+// Logout ends the session and closes the connection.
+func (c *Client) Logout() error {
+	_, err := c.cmd("LOGOUT")
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close closes the connection without logging out.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) refreshCapabilities() error {
+	if _, err := c.w.WriteString("CAPABILITY\r\n"); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	return c.readCapabilities()
+}
+
+// readCapabilities reads capability lines up to and including the OK that
+// ends them.
+func (c *Client) readCapabilities() error {
+	caps := make(map[string]string)
+	lines, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	for _, toks := range lines {
+		if len(toks) == 0 {
+			continue
+		}
+		value := ""
+		if len(toks) > 1 {
+			value = toks[1].value
+		}
+		caps[strings.ToUpper(toks[0].value)] = value
+	}
+	c.caps = caps
+	return nil
+}
+
+// cmd sends a command and returns the data lines of its response.
+func (c *Client) cmd(name string, args ...string) ([][]token, error) {
+	if _, err := c.w.WriteString(strings.Join(append([]string{name}, args...), " ") + "\r\n"); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.readResponse()
+}
+
+// readResponse reads data lines until an OK, NO or BYE line. NO and BYE are
+// returned as *Error.
+func (c *Client) readResponse() ([][]token, error) {
+	var lines [][]token
+	for {
+		toks, err := c.r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(toks) == 0 || !toks[0].atom {
+			lines = append(lines, toks)
+			continue
+		}
+		switch strings.ToUpper(toks[0].value) {
+		case "OK":
+			return lines, nil
+		case "NO", "BYE":
+			e := &Error{}
+			for _, t := range toks[1:] {
+				if t.code {
+					e.Code = t.value
+				} else if !t.atom {
+					e.Message = t.value
+				}
+			}
+			return nil, e
+		default:
+			lines = append(lines, toks)
+		}
+	}
+}
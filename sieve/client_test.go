@@ -0,0 +1,188 @@
+package sieve
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/sieve/sievetest"
+)
+
+func dialFake(t *testing.T, s *sievetest.Server) *Client {
+	t.Helper()
+	c, err := Dial(s.Addr(), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientGreeting(t *testing.T) {
+	c := dialFake(t, sievetest.NewServer(t))
+	if got := c.Capabilities()["IMPLEMENTATION"]; got != "sievetest" {
+		t.Errorf("IMPLEMENTATION = %q", got)
+	}
+	if !c.SupportsAuth("plain") || c.SupportsAuth("XOAUTH2") {
+		t.Errorf("SASL = %q", c.Capabilities()["SASL"])
+	}
+	if !c.SupportsExtension("vacation") {
+		t.Error("vacation extension not reported")
+	}
+	if c.HasCapability("STARTTLS") || c.IsTLS() {
+		t.Error("test server connection reported as TLS-capable")
+	}
+}
+
+func TestClientAuthenticate(t *testing.T) {
+	s := sievetest.NewServer(t)
+
+	c := dialFake(t, s)
+	err := c.Authenticate(sievetest.Username, "wrong")
+	var serr *Error
+	if !errors.As(err, &serr) || serr.Message != "authentication failed" {
+		t.Fatalf("Authenticate with a wrong password = %v", err)
+	}
+
+	c = dialFake(t, s)
+	if err := c.Authenticate(sievetest.Username, sievetest.Password); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got := c.Capabilities()["OWNER"]; got != sievetest.Username {
+		t.Errorf("capabilities not refreshed after login: OWNER = %q", got)
+	}
+}
+
+func TestClientScripts(t *testing.T) {
+	s := sievetest.NewServer(t)
+	c := dialFake(t, s)
+	if err := c.Authenticate(sievetest.Username, sievetest.Password); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "require \"fileinto\";\r\nif header :contains \"subject\" \"\\\"quoted\\\"\" {\r\n  fileinto \"Lists\";\r\n}\r\n"
+	if err := c.PutScript("main", content); err != nil {
+		t.Fatalf("PutScript: %v", err)
+	}
+	if err := c.PutScript("my \"other\" script", "keep;"); err != nil {
+		t.Fatalf("PutScript with a quoted name: %v", err)
+	}
+	if got, _ := s.Script("main"); got != content {
+		t.Errorf("server stored %q, want %q", got, content)
+	}
+
+	if err := c.SetActive("main"); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	if got := s.Active(); got != "main" {
+		t.Errorf("server's active script = %q", got)
+	}
+	scripts, err := c.ListScripts()
+	if err != nil {
+		t.Fatalf("ListScripts: %v", err)
+	}
+	want := []Script{{Name: "main", Active: true}, {Name: `my "other" script`}}
+	if !reflect.DeepEqual(scripts, want) {
+		t.Errorf("ListScripts = %+v, want %+v", scripts, want)
+	}
+	if active, err := c.ActiveScript(); err != nil || active != "main" {
+		t.Errorf("ActiveScript = %q, %v", active, err)
+	}
+
+	got, err := c.GetScript("main")
+	if err != nil {
+		t.Fatalf("GetScript: %v", err)
+	}
+	if got != content {
+		t.Errorf("GetScript = %q, want %q", got, content)
+	}
+
+	var serr *Error
+	if _, err := c.GetScript("missing"); !errors.As(err, &serr) || serr.Code != "NONEXISTENT" {
+		t.Errorf("GetScript(missing) = %v, want NONEXISTENT", err)
+	}
+	if err := c.PutScript("main", "invalid;"); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("PutScript(invalid) = %v, want the server's error", err)
+	}
+	if err := c.DeleteScript("main"); !errors.As(err, &serr) || serr.Code != "ACTIVE" {
+		t.Errorf("DeleteScript(active) = %v, want ACTIVE", err)
+	}
+	if err := c.DeleteScript(`my "other" script`); err != nil {
+		t.Errorf("DeleteScript: %v", err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Errorf("Logout: %v", err)
+	}
+}
+
+func TestClientActiveScript(t *testing.T) {
+	s := sievetest.NewServer(t)
+	c := dialFake(t, s)
+	if err := c.Authenticate(sievetest.Username, sievetest.Password); err != nil {
+		t.Fatal(err)
+	}
+
+	name, content, err := c.ReadActive()
+	if err != nil || name != DefaultScriptName || content != "" {
+		t.Fatalf("ReadActive with no scripts = %q, %q, %v", name, content, err)
+	}
+	if err := c.WriteActive(name, "keep;\n"); err != nil {
+		t.Fatalf("WriteActive: %v", err)
+	}
+	if s.Active() != DefaultScriptName {
+		t.Errorf("active script = %q", s.Active())
+	}
+
+	s.SetScript("roundcube", "discard;\n", true)
+	name, content, err = c.ReadActive()
+	if err != nil || name != "roundcube" || content != "discard;\n" {
+		t.Errorf("ReadActive = %q, %q, %v", name, content, err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	s := sievetest.NewServer(t)
+	acct := &config.Account{Email: sievetest.Username, Password: sievetest.Password}
+
+	// The test server has no STARTTLS, so a normal account refuses to log in.
+	if _, err := Connect(acct, s.Addr()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Connect without TLS = %v, want a refusal", err)
+	}
+
+	acct.Insecure = true
+	c, err := Connect(acct, s.Addr())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer c.Logout()
+	if _, err := c.ListScripts(); err != nil {
+		t.Errorf("ListScripts after Connect: %v", err)
+	}
+
+	jmap := &config.Account{Protocol: "jmap"}
+	if _, err := Connect(jmap, s.Addr()); err == nil {
+		t.Error("Connect allowed a JMAP account")
+	}
+}
+
+func TestAddr(t *testing.T) {
+	tests := []struct {
+		acct config.Account
+		want string
+	}{
+		{config.Account{ServiceProvider: config.ProviderCustom, IMAPServer: "mail.example.com"}, "mail.example.com:4190"},
+		{config.Account{ServiceProvider: config.ProviderCustom, IMAPServer: "mail.example.com", SieveServer: "sieve.example.com"}, "sieve.example.com:4190"},
+		{config.Account{SieveServer: "sieve.example.com:2000"}, "sieve.example.com:2000"},
+	}
+	for _, tt := range tests {
+		got, err := Addr(&tt.acct)
+		if err != nil || got != tt.want {
+			t.Errorf("Addr(%+v) = %q, %v; want %q", tt.acct, got, err, tt.want)
+		}
+	}
+	if _, err := Addr(&config.Account{Email: "me@example.com"}); err == nil {
+		t.Error("Addr with no server succeeded")
+	}
+}
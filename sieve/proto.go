@@ -0,0 +1,134 @@
+package sieve
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// token is an atom, a string (quoted or literal) or a parenthesised
+// response code on a protocol line.
+type token struct {
+	atom  bool
+	code  bool
+	value string
+}
+
+// reader reads protocol lines, inlining literals into string tokens.
+type reader struct {
+	*bufio.Reader
+}
+
+// maxLiteral bounds the literals the reader accepts; Sieve scripts are
+// small and servers cap them far lower.
+const maxLiteral = 1 << 20
+
+// readLine reads one logical line: physical lines joined by the literals
+// that end them.
+func (r reader) readLine() ([]token, error) {
+	var toks []token
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		rest, literal, err := tokenizeLine(line, &toks)
+		if err != nil {
+			return nil, err
+		}
+		if literal < 0 {
+			return toks, nil
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("sieve: data after literal size: %q", rest)
+		}
+		buf := make([]byte, literal)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		toks = append(toks, token{value: string(buf)})
+	}
+}
+
+// tokenizeLine appends the tokens of a physical line. When the line ends
+// with a literal size it returns the size, otherwise -1.
+func tokenizeLine(line string, toks *[]token) (string, int, error) {
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return "", -1, nil
+		}
+		switch c := line[0]; {
+		case c == '(':
+			end := strings.IndexByte(line, ')')
+			if end < 0 {
+				return "", 0, fmt.Errorf("sieve: unterminated response code %q", line)
+			}
+			*toks = append(*toks, token{code: true, value: line[1:end]})
+			line = line[end+1:]
+		case c == '"':
+			value, n, err := unquote(line)
+			if err != nil {
+				return "", 0, err
+			}
+			*toks = append(*toks, token{value: value})
+			line = line[n:]
+		case c == '{':
+			end := strings.IndexByte(line, '}')
+			if end < 0 {
+				return "", 0, fmt.Errorf("sieve: bad literal %q", line)
+			}
+			size, err := strconv.Atoi(strings.TrimSuffix(line[1:end], "+"))
+			if err != nil || size < 0 || size > maxLiteral {
+				return "", 0, fmt.Errorf("sieve: bad literal size %q", line[:end+1])
+			}
+			return strings.TrimSpace(line[end+1:]), size, nil
+		default:
+			end := strings.IndexAny(line, " (")
+			if end < 0 {
+				end = len(line)
+			}
+			*toks = append(*toks, token{atom: true, value: line[:end]})
+			line = line[end:]
+		}
+	}
+}
+
+// unquote reads the quoted string at the start of s and returns it with the
+// number of bytes consumed.
+func unquote(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, fmt.Errorf("sieve: unterminated string %q", s)
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("sieve: unterminated string %q", s)
+}
+
+// quote renders s as a quoted string, or as a non-synchronizing literal
+// when it cannot be quoted.
+func quote(s string) string {
+	if strings.ContainsAny(s, "\r\n") || len(s) > 1024 {
+		return literal(s)
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// literal renders s as a non-synchronizing literal, which every ManageSieve
+// server accepts from clients.
+func literal(s string) string {
+	return "{" + strconv.Itoa(len(s)) + "+}\r\n" + s
+}
@@ -0,0 +1,242 @@
+// Package sievetest provides an in-process ManageSieve server for tests. It
+// keeps its scripts in memory and speaks enough of RFC 5804 for matcha's
+// client: SASL PLAIN login, CAPABILITY and the script commands.
+package sievetest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Default credentials the server accepts.
+const (
+	Username = "me@example.com"
+	Password = "secret"
+)
+
+// Server is a fake ManageSieve server. Scripts containing "invalid" are
+// rejected as if they failed to compile.
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	scripts map[string]string
+	active  string
+}
+
+// NewServer starts a server on a loopback port. It is closed when the test
+// ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{ln: ln, scripts: make(map[string]string)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+// Addr returns the server's "host:port".
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// SetScript stores a script, making it active when active is set.
+func (s *Server) SetScript(name, content string, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[name] = content
+	if active {
+		s.active = name
+	}
+}
+
+// Script returns a stored script.
+func (s *Server) Script(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.scripts[name]
+	return content, ok
+}
+
+// Active returns the name of the active script.
+func (s *Server) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := false
+
+	writeCaps := func() {
+		fmt.Fprint(w, "\"IMPLEMENTATION\" \"sievetest\"\r\n\"SASL\" \"PLAIN\"\r\n\"SIEVE\" \"fileinto vacation\"\r\n")
+		if authed {
+			fmt.Fprintf(w, "\"OWNER\" %s\r\n", quote(Username))
+		}
+		fmt.Fprint(w, "\"VERSION\" \"1.0\"\r\nOK\r\n")
+	}
+	writeCaps()
+	w.Flush()
+
+	for {
+		words, err := readCommand(r)
+		if err != nil || len(words) == 0 {
+			return
+		}
+		cmd, args := strings.ToUpper(words[0]), words[1:]
+
+		s.mu.Lock()
+		switch {
+		case cmd == "CAPABILITY":
+			writeCaps()
+		case cmd == "LOGOUT":
+			fmt.Fprint(w, "OK \"bye\"\r\n")
+			w.Flush()
+			s.mu.Unlock()
+			return
+		case cmd == "AUTHENTICATE":
+			want := base64.StdEncoding.EncodeToString([]byte("\x00" + Username + "\x00" + Password))
+			if len(args) == 2 && strings.EqualFold(args[0], "PLAIN") && args[1] == want {
+				authed = true
+				fmt.Fprint(w, "OK\r\n")
+			} else {
+				fmt.Fprint(w, "NO \"authentication failed\"\r\n")
+			}
+		case !authed:
+			fmt.Fprint(w, "NO \"log in first\"\r\n")
+		case cmd == "LISTSCRIPTS":
+			names := make([]string, 0, len(s.scripts))
+			for name := range s.scripts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprint(w, quote(name))
+				if name == s.active {
+					fmt.Fprint(w, " ACTIVE")
+				}
+				fmt.Fprint(w, "\r\n")
+			}
+			fmt.Fprint(w, "OK\r\n")
+		case cmd == "GETSCRIPT" && len(args) == 1:
+			content, ok := s.scripts[args[0]]
+			if !ok {
+				fmt.Fprint(w, "NO (NONEXISTENT) \"no such script\"\r\n")
+				break
+			}
+			fmt.Fprintf(w, "{%d}\r\n%s\r\nOK\r\n", len(content), content)
+		case (cmd == "PUTSCRIPT" && len(args) == 2) || (cmd == "CHECKSCRIPT" && len(args) == 1):
+			if strings.Contains(args[len(args)-1], "invalid") {
+				fmt.Fprint(w, "NO \"line 1: syntax error\"\r\n")
+				break
+			}
+			if cmd == "PUTSCRIPT" {
+				s.scripts[args[0]] = args[1]
+			}
+			fmt.Fprint(w, "OK\r\n")
+		case cmd == "SETACTIVE" && len(args) == 1:
+			if _, ok := s.scripts[args[0]]; !ok && args[0] != "" {
+				fmt.Fprint(w, "NO (NONEXISTENT) \"no such script\"\r\n")
+				break
+			}
+			s.active = args[0]
+			fmt.Fprint(w, "OK\r\n")
+		case cmd == "DELETESCRIPT" && len(args) == 1:
+			switch _, ok := s.scripts[args[0]]; {
+			case !ok:
+				fmt.Fprint(w, "NO (NONEXISTENT) \"no such script\"\r\n")
+			case args[0] == s.active:
+				fmt.Fprint(w, "NO (ACTIVE) \"script is active\"\r\n")
+			default:
+				delete(s.scripts, args[0])
+				fmt.Fprint(w, "OK\r\n")
+			}
+		default:
+			fmt.Fprint(w, "NO \"unknown command\"\r\n")
+		}
+		s.mu.Unlock()
+		w.Flush()
+	}
+}
+
+// readCommand reads one command: atoms, quoted strings and literals, which
+// may continue the command over several lines.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var words []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		for {
+			line = strings.TrimLeft(line, " ")
+			if line == "" {
+				return words, nil
+			}
+			switch line[0] {
+			case '"':
+				var b strings.Builder
+				i := 1
+				for ; i < len(line) && line[i] != '"'; i++ {
+					if line[i] == '\\' && i+1 < len(line) {
+						i++
+					}
+					b.WriteByte(line[i])
+				}
+				words = append(words, b.String())
+				line = line[min(i+1, len(line)):]
+				continue
+			case '{':
+				end := strings.IndexByte(line, '}')
+				size, err := strconv.Atoi(strings.TrimSuffix(line[1:max(end, 1)], "+"))
+				if end < 0 || err != nil {
+					return nil, fmt.Errorf("bad literal %q", line)
+				}
+				buf := make([]byte, size)
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return nil, err
+				}
+				words = append(words, string(buf))
+			default:
+				end := strings.IndexByte(line, ' ')
+				if end < 0 {
+					end = len(line)
+				}
+				words = append(words, line[:end])
+				line = line[end:]
+				continue
+			}
+			// A literal ends its line; the command continues on the next.
+			break
+		}
+	}
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
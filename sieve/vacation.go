@@ -0,0 +1,221 @@
+package sieve
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Markers around the parts of a script that matcha manages. Everything else
+// in the script is left as the user wrote it.
+const (
+	vacationRequire = `require "vacation"; # matcha:vacation`
+	vacationBegin   = "# matcha vacation begin"
+	vacationEnd     = "# matcha vacation end"
+	disabledPrefix  = "# "
+)
+
+// DefaultVacationDays is how often, in days, the same sender gets the
+// auto-reply when Days is unset.
+const DefaultVacationDays = 7
+
+// Vacation is the auto-reply matcha manages inside a Sieve script.
+type Vacation struct {
+	Enabled bool
+	Subject string
+	Body    string
+	Days    int
+}
+
+// ParseVacation reads the managed vacation block from a script. A script
+// without one yields a disabled zero Vacation. A disabled block is kept in
+// the script, commented out, so its text survives being switched off.
+func ParseVacation(script string) Vacation {
+	lines := strings.Split(normalizeNewlines(script), "\n")
+	begin, end := findBlock(lines)
+	if begin < 0 {
+		return Vacation{}
+	}
+	body := lines[begin+1 : end]
+	v := Vacation{Enabled: true}
+	if strings.TrimSpace(lines[begin]) != vacationBegin {
+		v.Enabled = false
+		uncommented := make([]string, len(body))
+		for i, l := range body {
+			if strings.HasPrefix(l, disabledPrefix) {
+				uncommented[i] = l[len(disabledPrefix):]
+			} else {
+				uncommented[i] = strings.TrimPrefix(l, "#")
+			}
+		}
+		body = uncommented
+	}
+	parseVacationCommand(strings.Join(body, "\n"), &v)
+	return v
+}
+
+// SetVacation returns script with its managed vacation block replaced by v.
+// An enabled vacation also gets the require it needs at the top of the
+// script. A disabled one with no text is removed entirely.
+func SetVacation(script string, v Vacation) string {
+	lines := strings.Split(normalizeNewlines(script), "\n")
+	if begin, end := findBlock(lines); begin >= 0 {
+		lines = append(lines[:begin:begin], lines[end+1:]...)
+	}
+	kept := lines[:0]
+	for _, l := range lines {
+		if strings.TrimSpace(l) != vacationRequire {
+			kept = append(kept, l)
+		}
+	}
+	lines = kept
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if !v.Enabled && v.Subject == "" && v.Body == "" {
+		return joinScript(lines)
+	}
+
+	block := []string{vacationBegin}
+	command := strings.Split(vacationCommand(v), "\n")
+	if v.Enabled {
+		block = append(block, command...)
+	} else {
+		block[0] += " (disabled)"
+		for _, l := range command {
+			block = append(block, disabledPrefix+l)
+		}
+	}
+	block = append(block, vacationEnd)
+
+	at := afterRequires(lines)
+	out := make([]string, 0, len(lines)+len(block)+1)
+	if v.Enabled {
+		out = append(out, vacationRequire)
+	}
+	out = append(out, lines[:at]...)
+	out = append(out, block...)
+	out = append(out, lines[at:]...)
+	return joinScript(out)
+}
+
+// findBlock returns the indexes of the managed block's begin and end lines,
+// or -1, -1.
+func findBlock(lines []string) (int, int) {
+	begin := -1
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		switch {
+		case begin < 0 && strings.HasPrefix(l, vacationBegin):
+			begin = i
+		case begin >= 0 && l == vacationEnd:
+			return begin, i
+		}
+	}
+	return -1, -1
+}
+
+// afterRequires returns the index of the first line after the require
+// commands, comments and blank lines that start a script. Sieve only allows
+// require before any other command.
+func afterRequires(lines []string) int {
+	at := 0
+	inRequire := false
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		switch {
+		case inRequire:
+		case t == "" || strings.HasPrefix(t, "#"):
+			continue
+		case strings.HasPrefix(t, "require"):
+			inRequire = true
+		default:
+			return at
+		}
+		if strings.Contains(t, ";") {
+			inRequire = false
+			at = i + 1
+		}
+	}
+	return at
+}
+
+func vacationCommand(v Vacation) string {
+	days := v.Days
+	if days <= 0 {
+		days = DefaultVacationDays
+	}
+	cmd := "vacation :days " + strconv.Itoa(days)
+	if v.Subject != "" {
+		cmd += " :subject " + sieveString(v.Subject)
+	}
+	return cmd + " " + sieveString(v.Body) + ";"
+}
+
+// sieveString renders s as a Sieve quoted string, which may span lines.
+func sieveString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(normalizeNewlines(s)) + `"`
+}
+
+// parseVacationCommand fills v from the vacation command matcha writes.
+func parseVacationCommand(cmd string, v *Vacation) {
+	cmd = strings.TrimSpace(cmd)
+	cmd = strings.TrimPrefix(cmd, "vacation")
+	for {
+		cmd = strings.TrimLeft(cmd, " \t\n")
+		switch {
+		case strings.HasPrefix(cmd, ":days"):
+			cmd = strings.TrimLeft(cmd[len(":days"):], " \t\n")
+			n := 0
+			for n < len(cmd) && cmd[n] >= '0' && cmd[n] <= '9' {
+				n++
+			}
+			v.Days, _ = strconv.Atoi(cmd[:n])
+			cmd = cmd[n:]
+		case strings.HasPrefix(cmd, ":subject"):
+			s, rest, ok := readSieveString(strings.TrimLeft(cmd[len(":subject"):], " \t\n"))
+			if !ok {
+				return
+			}
+			v.Subject, cmd = s, rest
+		case strings.HasPrefix(cmd, `"`):
+			v.Body, _, _ = readSieveString(cmd)
+			return
+		default:
+			return
+		}
+	}
+}
+
+// readSieveString reads the quoted string at the start of s.
+func readSieveString(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", s, false
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+func joinScript(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
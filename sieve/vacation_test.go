@@ -0,0 +1,72 @@
+package sieve
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetVacation(t *testing.T) {
+	script := "# my filters\nrequire [\"fileinto\",\n  \"envelope\"];\n\nif header :contains \"list-id\" \"go\" {\n  fileinto \"Go\";\n}\n"
+	v := Vacation{Enabled: true, Subject: `Away "for now"`, Body: "I'm out until Monday.\nC:\\ is not a path.", Days: 3}
+
+	got := SetVacation(script, v)
+	want := `require "vacation"; # matcha:vacation
+# my filters
+require ["fileinto",
+  "envelope"];
+# matcha vacation begin
+vacation :days 3 :subject "Away \"for now\"" "I'm out until Monday.
+C:\\ is not a path.";
+# matcha vacation end
+
+if header :contains "list-id" "go" {
+  fileinto "Go";
+}
+`
+	if got != want {
+		t.Fatalf("SetVacation =\n%s\nwant\n%s", got, want)
+	}
+	if parsed := ParseVacation(got); parsed != v {
+		t.Errorf("ParseVacation = %+v, want %+v", parsed, v)
+	}
+
+	// Updating replaces the block rather than adding another.
+	v.Days = 0
+	updated := SetVacation(got, v)
+	if n := strings.Count(updated, vacationBegin); n != 1 {
+		t.Errorf("%d vacation blocks after an update", n)
+	}
+	if n := strings.Count(updated, vacationRequire); n != 1 {
+		t.Errorf("%d vacation requires after an update", n)
+	}
+	if parsed := ParseVacation(updated); parsed.Days != DefaultVacationDays {
+		t.Errorf("Days = %d, want the default", parsed.Days)
+	}
+
+	// Disabling keeps the text but drops the require and the command.
+	v.Enabled = false
+	disabled := SetVacation(updated, v)
+	if strings.Contains(disabled, vacationRequire) || strings.Contains(disabled, "\nvacation ") {
+		t.Errorf("disabled script still runs vacation:\n%s", disabled)
+	}
+	parsed := ParseVacation(disabled)
+	if parsed.Enabled || parsed.Subject != v.Subject || parsed.Body != v.Body {
+		t.Errorf("ParseVacation(disabled) = %+v", parsed)
+	}
+
+	// Removing it entirely gives back the original script.
+	if got := SetVacation(disabled, Vacation{}); got != script {
+		t.Errorf("removing vacation =\n%s\nwant\n%s", got, script)
+	}
+}
+
+func TestSetVacationEmptyScript(t *testing.T) {
+	got := SetVacation("", Vacation{Enabled: true, Body: "Away"})
+	want := "require \"vacation\"; # matcha:vacation\n# matcha vacation begin\nvacation :days 7 \"Away\";\n# matcha vacation end\n"
+	if got != want {
+		t.Errorf("SetVacation = %q, want %q", got, want)
+	}
+	if v := ParseVacation("keep;\n"); v != (Vacation{}) {
+		t.Errorf("ParseVacation without a block = %+v", v)
+	}
+}
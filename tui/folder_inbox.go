@@ -3,14 +3,17 @@ package tui
 import (
 	"fmt"
 	"maps"
+	"slices"
 	"sort"
 	"strings"
 
 	"charm.land/bubbles/v2/key"
 	"charm.land/bubbles/v2/list"
+	"charm.land/bubbles/v2/textinput"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	overlay "github.com/floatpane/bubble-overlay"
+	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/fetcher"
 )
@@ -88,6 +91,11 @@ type FolderInbox struct {
 	currentFolder   string
 	inbox           *Inbox
 	accounts        []config.Account
+	// savedSearches are listed beneath the folders; activeFolderIdx values
+	// past the folders select them. activeSearch names the one shown, if
+	// any. currentFolder stays a real folder, the one its results live in.
+	savedSearches   []config.SavedSearch
+	activeSearch    string
 	width           int
 	height          int
 	isLoadingEmails bool
@@ -99,6 +107,10 @@ type FolderInbox struct {
 	moveUIDs         []uint32 // Batch: multiple UIDs
 	moveAccountID    string
 	moveSourceFolder string
+	// creatingFolder is set while the overlay prompts for the name of a new
+	// folder to move the emails into.
+	creatingFolder bool
+	newFolderInput textinput.Model
 
 	// Image rendering preference, propagated from config.
 	disableImages bool
@@ -207,9 +219,9 @@ func (m *FolderInbox) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocycl
 			break
 		}
 
-		// Don't intercept keys while the inbox search overlay is active.
-		// Otherwise folder-level bindings like "m" (move) would shadow text input.
-		if m.inbox.searchOverlay != nil {
+		// Don't intercept keys while the inbox search or label overlay is
+		// active. Otherwise folder-level bindings like "m" (move) would shadow text input.
+		if m.inbox.searchOverlay != nil || m.inbox.labelPicker != nil {
 			break
 		}
 
@@ -240,14 +252,14 @@ func (m *FolderInbox) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocycl
 			}
 		case kb.Folder.NextFolder:
 			m.activeFolderIdx++
-			if m.activeFolderIdx >= len(m.folders) {
+			if m.activeFolderIdx >= len(m.folders)+len(m.savedSearches) {
 				m.activeFolderIdx = 0
 			}
 			return m, m.switchFolder()
 		case kb.Folder.PrevFolder:
 			m.activeFolderIdx--
 			if m.activeFolderIdx < 0 {
-				m.activeFolderIdx = len(m.folders) - 1
+				m.activeFolderIdx = len(m.folders) + len(m.savedSearches) - 1
 			}
 			return m, m.switchFolder()
 		case kb.Global.Cancel:
@@ -342,6 +354,36 @@ func (m *FolderInbox) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocycl
 		m.inbox.updateList()
 		return m, nil
 
+	case ApplySearchResultsMsg:
+		// A search run by hand replaces the saved search being shown.
+		if m.activeSearch != "" {
+			m.activeSearch = ""
+			m.selectCurrentFolder()
+		}
+		// Results of a folder: search are shown in that folder, so actions
+		// on them address the mailbox they came from.
+		if msg.Query.Folder == "" || strings.EqualFold(msg.Query.Folder, m.currentFolder) {
+			break
+		}
+		for i, f := range m.folders {
+			if strings.EqualFold(f, msg.Query.Folder) {
+				m.activeFolderIdx = i
+				switchCmd := m.switchFolder()
+				_, cmd := m.inbox.Update(msg)
+				return m, tea.Batch(switchCmd, cmd)
+			}
+		}
+
+	case SavedSearchResultsMsg:
+		// Ignore results for a saved search the user has navigated away
+		// from, and keep the last results when the search failed outright.
+		if msg.Name != m.activeSearch || (msg.Err != nil && len(msg.Emails) == 0) {
+			return m, nil
+		}
+		m.inbox.searchResults = dedupeEmailsForAccounts(msg.Emails, m.accounts)
+		m.inbox.updateList()
+		return m, nil
+
 	case EmailMovedMsg:
 		if msg.Err != nil {
 			// Error handled by main model
@@ -394,6 +436,12 @@ func (m *FolderInbox) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocycl
 	var cmd tea.Cmd
 	_, cmd = m.inbox.Update(msg)
 
+	// Cancelling the search leaves the saved search for its folder.
+	if m.activeSearch != "" && !m.inbox.searchActive {
+		m.activeSearch = ""
+		m.selectCurrentFolder()
+	}
+
 	// Intercept FetchMoreEmailsMsg from inbox and convert to folder-aware version
 	if cmd != nil {
 		wrappedCmd := m.wrapInboxCmd(cmd)
@@ -427,8 +475,14 @@ func (m *FolderInbox) wrapInboxCmd(cmd tea.Cmd) tea.Cmd {
 }
 
 func (m *FolderInbox) updateMoveOverlay(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.creatingFolder {
+		return m.updateNewFolderInput(msg)
+	}
+
 	kb := config.Keybinds
 	if msg, ok := msg.(tea.KeyPressMsg); ok {
+		// The last row of the overlay is the "new folder" entry.
+		rows := len(m.moveFolderChoices()) + 1
 		switch msg.String() {
 		case kb.Global.Cancel:
 			m.movingEmail = false
@@ -436,57 +490,98 @@ func (m *FolderInbox) updateMoveOverlay(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "up", kb.Global.NavUp:
 			m.moveTargetIdx--
 			if m.moveTargetIdx < 0 {
-				m.moveTargetIdx = len(m.moveFolderChoices()) - 1
+				m.moveTargetIdx = rows - 1
 			}
 			return m, nil
 		case keyDown, kb.Global.NavDown:
 			m.moveTargetIdx++
-			choices := m.moveFolderChoices()
-			if m.moveTargetIdx >= len(choices) {
+			if m.moveTargetIdx >= rows {
 				m.moveTargetIdx = 0
 			}
 			return m, nil
 		case keyEnter:
 			choices := m.moveFolderChoices()
-			if len(choices) > 0 && m.moveTargetIdx < len(choices) {
-				destFolder := choices[m.moveTargetIdx]
-				m.movingEmail = false
-
-				if len(m.moveUIDs) > 1 {
-					// Batch move
-					uids := m.moveUIDs
-					m.moveUIDs = nil
-
-					// Exit visual mode in inbox
-					m.inbox.visualMode = false
-					m.inbox.selectedUIDs = make(map[uint32]string)
-					m.inbox.selectionOrder = []uint32{}
-					m.inbox.updateListTitle()
-
-					return m, func() tea.Msg {
+			if m.moveTargetIdx == len(choices) {
+				m.creatingFolder = true
+				m.newFolderInput = textinput.New()
+				m.newFolderInput.Placeholder = t("folder_inbox.new_folder_placeholder")
+				m.newFolderInput.Prompt = "> "
+				m.newFolderInput.CharLimit = 256
+				m.newFolderInput.SetStyles(ThemedTextInputStyles())
+				return m, m.newFolderInput.Focus()
+			}
+			if m.moveTargetIdx < len(choices) {
+				return m, m.finishMove(func(uids []uint32) tea.Msg {
+					if len(uids) > 1 {
 						return BatchMoveEmailsMsg{
 							UIDs:         uids,
 							AccountID:    m.moveAccountID,
 							SourceFolder: m.moveSourceFolder,
-							DestFolder:   destFolder,
+							DestFolder:   choices[m.moveTargetIdx],
 						}
 					}
-				}
-				// Single move
-				return m, func() tea.Msg {
 					return MoveEmailToFolderMsg{
-						UID:          m.moveUID,
+						UID:          uids[0],
 						AccountID:    m.moveAccountID,
 						SourceFolder: m.moveSourceFolder,
-						DestFolder:   destFolder,
+						DestFolder:   choices[m.moveTargetIdx],
 					}
-				}
+				})
 			}
 		}
 	}
 	return m, nil
 }
 
+// updateNewFolderInput handles input while the overlay prompts for a new
+// folder name. Cancel returns to the folder list.
+func (m *FolderInbox) updateNewFolderInput(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyPressMsg); ok {
+		switch msg.String() {
+		case config.Keybinds.Global.Cancel:
+			m.creatingFolder = false
+			return m, nil
+		case keyEnter:
+			name := strings.TrimSpace(m.newFolderInput.Value())
+			if name == "" {
+				return m, nil
+			}
+			m.creatingFolder = false
+			return m, m.finishMove(func(uids []uint32) tea.Msg {
+				return CreateFolderMsg{
+					AccountID:    m.moveAccountID,
+					Name:         name,
+					UIDs:         uids,
+					SourceFolder: m.moveSourceFolder,
+				}
+			})
+		}
+	}
+
+	var cmd tea.Cmd
+	m.newFolderInput, cmd = m.newFolderInput.Update(msg)
+	return m, cmd
+}
+
+// finishMove closes the move overlay, leaves visual mode after a batch
+// selection and returns a command emitting the message built for the UIDs
+// being moved.
+func (m *FolderInbox) finishMove(build func(uids []uint32) tea.Msg) tea.Cmd {
+	m.movingEmail = false
+	uids := m.moveUIDs
+	if len(uids) > 1 {
+		m.moveUIDs = nil
+
+		// Exit visual mode in inbox
+		m.inbox.visualMode = false
+		m.inbox.selectedUIDs = make(map[uint32]string)
+		m.inbox.selectionOrder = []uint32{}
+		m.inbox.updateListTitle()
+	}
+	msg := build(uids)
+	return func() tea.Msg { return msg }
+}
+
 // moveFolderChoices returns all folders except the current one.
 func (m *FolderInbox) moveFolderChoices() []string {
 	var choices []string
@@ -499,7 +594,16 @@ func (m *FolderInbox) moveFolderChoices() []string {
 }
 
 func (m *FolderInbox) switchFolder() tea.Cmd {
+	if i := m.activeFolderIdx - len(m.folders); i >= 0 && i < len(m.savedSearches) {
+		return m.openSavedSearch(m.savedSearches[i])
+	}
 	if m.activeFolderIdx >= 0 && m.activeFolderIdx < len(m.folders) {
+		if m.activeSearch != "" {
+			m.activeSearch = ""
+			m.inbox.searchActive = false
+			m.inbox.searchQuery = ""
+			m.inbox.searchResults = nil
+		}
 		prevFolder := m.currentFolder
 		m.currentFolder = m.folders[m.activeFolderIdx]
 		m.isLoadingEmails = true
@@ -514,6 +618,62 @@ func (m *FolderInbox) switchFolder() tea.Cmd {
 	return nil
 }
 
+// openSavedSearch shows a saved search in the inbox pane. Its results come
+// from one folder, across all accounts: the query's folder: term or INBOX.
+// That folder becomes the current one, so actions on the results address
+// the mailbox the messages live in.
+func (m *FolderInbox) openSavedSearch(s config.SavedSearch) tea.Cmd {
+	query := backend.ParseSearchQuery(s.Query)
+	folder := keyINBOX
+	if query.Folder != "" {
+		folder = query.Folder
+		for _, f := range m.folders {
+			if strings.EqualFold(f, query.Folder) {
+				folder = f
+				break
+			}
+		}
+	}
+
+	var cmds []tea.Cmd
+	if folder != m.currentFolder {
+		prevFolder := m.currentFolder
+		m.currentFolder = folder
+		m.inbox.SetFolderName(folder)
+		m.inbox.SetEmails(nil, m.accounts)
+		cmds = append(cmds, func() tea.Msg {
+			return SwitchFolderMsg{FolderName: folder, PreviousFolder: prevFolder}
+		})
+	}
+
+	m.activeSearch = s.Name
+	m.inbox.searchOverlay = nil
+	m.inbox.searchActive = true
+	m.inbox.searchQuery = s.Name
+	m.inbox.searchResults = nil
+	m.inbox.visualMode = false
+	m.inbox.selectedUIDs = make(map[uint32]string)
+	m.inbox.selectionOrder = []uint32{}
+	m.inbox.updateList()
+
+	name := s.Name
+	cmds = append(cmds, func() tea.Msg {
+		return SavedSearchRequestedMsg{Name: name, Query: query, FolderName: folder}
+	})
+	return tea.Batch(cmds...)
+}
+
+// selectCurrentFolder points the sidebar selection back at currentFolder.
+func (m *FolderInbox) selectCurrentFolder() {
+	m.activeFolderIdx = 0
+	for i, f := range m.folders {
+		if f == m.currentFolder {
+			m.activeFolderIdx = i
+			return
+		}
+	}
+}
+
 func (m *FolderInbox) View() tea.View {
 	// Render sidebar
 	sidebar := m.renderSidebar()
@@ -582,6 +742,20 @@ func (m *FolderInbox) renderSidebar() string {
 		}
 	}
 
+	if len(m.savedSearches) > 0 {
+		b.WriteString("\n\n")
+		b.WriteString(sidebarTitleStyle.Render(t("folder_inbox.saved_searches_title")))
+		for i, search := range m.savedSearches {
+			b.WriteString("\n")
+			name := m.formatFolderName(search.Name)
+			if len(m.folders)+i == m.activeFolderIdx {
+				b.WriteString(activeFolderStyle.Width(sidebarWidth - 4).Render(name))
+			} else {
+				b.WriteString(folderStyle.Render(name))
+			}
+		}
+	}
+
 	sidebarHeight := m.height
 	if sidebarHeight < 1 {
 		sidebarHeight = 20
@@ -605,9 +779,6 @@ func (m *FolderInbox) formatFolderName(name string) string {
 
 func (m *FolderInbox) renderWithMoveOverlay(content string) string {
 	choices := m.moveFolderChoices()
-	if len(choices) == 0 {
-		return content
-	}
 
 	var b strings.Builder
 	title := t("folder_inbox.move_to_folder")
@@ -619,20 +790,30 @@ func (m *FolderInbox) renderWithMoveOverlay(content string) string {
 	b.WriteString(moveOverlayTitleStyle.Render(title))
 	b.WriteString("\n")
 
-	for i, folder := range choices {
-		displayName := m.formatFolderName(folder)
-		if i == m.moveTargetIdx {
-			b.WriteString(moveSelectedItemStyle.Render("> " + displayName))
-		} else {
-			b.WriteString(moveItemStyle.Render("  " + displayName))
-		}
-		if i < len(choices)-1 {
+	if m.creatingFolder {
+		b.WriteString(m.newFolderInput.View())
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render(t("folder_inbox.new_folder_help")))
+	} else {
+		for i, folder := range choices {
+			displayName := m.formatFolderName(folder)
+			if i == m.moveTargetIdx {
+				b.WriteString(moveSelectedItemStyle.Render("> " + displayName))
+			} else {
+				b.WriteString(moveItemStyle.Render("  " + displayName))
+			}
 			b.WriteString("\n")
 		}
-	}
+		newFolder := t("folder_inbox.new_folder")
+		if m.moveTargetIdx == len(choices) {
+			b.WriteString(moveSelectedItemStyle.Render("> " + newFolder))
+		} else {
+			b.WriteString(moveItemStyle.Render("  " + newFolder))
+		}
 
-	b.WriteString("\n\n")
-	b.WriteString(helpStyle.Render(t("folder_inbox.help")))
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render(t("folder_inbox.help")))
+	}
 
 	box := moveOverlayStyle.Render(b.String())
 
@@ -642,9 +823,23 @@ func (m *FolderInbox) renderWithMoveOverlay(content string) string {
 	return overlay.Center(content, box, m.width, m.height)
 }
 
+// AddFolder adds a newly created folder to the folder list.
+func (m *FolderInbox) AddFolder(name string) {
+	for _, f := range m.folders {
+		if f == name {
+			return
+		}
+	}
+	m.SetFolders(append(slices.Clone(m.folders), name))
+}
+
 // SetFolders updates the folder list.
 func (m *FolderInbox) SetFolders(folders []string) {
 	m.folders = sortFolders(folders)
+	if m.activeSearch != "" {
+		m.selectSavedSearch()
+		return
+	}
 	// Keep current folder if it still exists (search sorted list)
 	found := false
 	for i, f := range m.folders {
@@ -660,6 +855,46 @@ func (m *FolderInbox) SetFolders(folders []string) {
 	}
 }
 
+// SetSavedSearches updates the saved searches listed beneath the folders.
+// The saved search being shown is left when it is no longer in the list.
+func (m *FolderInbox) SetSavedSearches(searches []config.SavedSearch) {
+	m.savedSearches = slices.Clone(searches)
+	if m.activeSearch == "" {
+		return
+	}
+	if !m.selectSavedSearch() {
+		m.activeSearch = ""
+		m.inbox.searchActive = false
+		m.inbox.searchQuery = ""
+		m.inbox.searchResults = nil
+		m.inbox.updateList()
+		m.selectCurrentFolder()
+	}
+}
+
+// selectSavedSearch points the sidebar selection at the active saved
+// search and reports whether it is still listed.
+func (m *FolderInbox) selectSavedSearch() bool {
+	for i, s := range m.savedSearches {
+		if s.Name == m.activeSearch {
+			m.activeFolderIdx = len(m.folders) + i
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshSavedSearch re-runs the saved search being shown, if any.
+func (m *FolderInbox) RefreshSavedSearch() tea.Cmd {
+	for _, s := range m.savedSearches {
+		if s.Name == m.activeSearch {
+			msg := SavedSearchRequestedMsg{Name: s.Name, Query: backend.ParseSearchQuery(s.Query), FolderName: m.currentFolder}
+			return func() tea.Msg { return msg }
+		}
+	}
+	return nil
+}
+
 func (m *FolderInbox) SetUnreadCounts(counts map[string]int) {
 	m.unread = counts
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	tea "charm.land/bubbletea/v2"
+	"github.com/floatpane/matcha/backend"
 	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/fetcher"
 )
@@ -122,3 +123,180 @@ func TestSearchOverlayKeysNotIntercepted(t *testing.T) {
 		t.Fatalf("search input should contain typed character, got %q", got)
 	}
 }
+
+// TestSearchOverlayShowsLocalResultsFirst checks that hits from the local
+// search index can be applied before the server answers, and that they do
+// not replace the server's results when they arrive late.
+func TestSearchOverlayShowsLocalResultsFirst(t *testing.T) {
+	o := NewSearchOverlay(80, 24)
+	o.input.SetValue("from:alice")
+	enter := tea.KeyPressMsg{Code: tea.KeyEnter}
+
+	if cmd := o.Update(enter, MailboxInbox, ""); cmd == nil {
+		t.Fatal("Enter should request a search")
+	}
+	if o.Update(enter, MailboxInbox, "") != nil {
+		t.Fatal("Enter must do nothing while no results are in")
+	}
+
+	local := []fetcher.Email{{UID: 1, AccountID: "account-1", Subject: "cached"}}
+	o.Update(SearchResultsMsg{Emails: local, Local: true}, MailboxInbox, "")
+	if !o.loading || !o.done || len(o.results) != 1 {
+		t.Fatalf("after local results: loading=%v done=%v results=%d", o.loading, o.done, len(o.results))
+	}
+	cmd := o.Update(enter, MailboxInbox, "")
+	if cmd == nil {
+		t.Fatal("Enter should apply local results while the server search runs")
+	}
+	if applied, ok := cmd().(ApplySearchResultsMsg); !ok || len(applied.Emails) != 1 {
+		t.Fatalf("Enter produced %#v, want ApplySearchResultsMsg with the local hit", cmd())
+	}
+
+	server := []fetcher.Email{{UID: 1, AccountID: "account-1"}, {UID: 2, AccountID: "account-1"}}
+	o.Update(SearchResultsMsg{Emails: server}, MailboxInbox, "")
+	o.Update(SearchResultsMsg{Emails: local, Local: true}, MailboxInbox, "")
+	if o.loading || len(o.results) != 2 {
+		t.Fatalf("late local results replaced the server's: loading=%v results=%d", o.loading, len(o.results))
+	}
+}
+
+// TestFolderInboxSavedSearch walks into a saved search listed beneath the
+// folders: it switches to the query's folder so actions address it, shows
+// only results for the active search, and cancelling returns to the folder.
+func TestFolderInboxSavedSearch(t *testing.T) {
+	accounts := []config.Account{
+		{ID: "account-1", Email: "host.example.com", FetchEmail: "first@example.com"},
+	}
+	fi := NewFolderInbox([]string{keyINBOX, "Archive"}, accounts)
+	model, _ := fi.Update(tea.WindowSizeMsg{Width: 200, Height: 60})
+	fi = model.(*FolderInbox)
+	fi.SetSavedSearches([]config.SavedSearch{{Name: "CI", Query: "from:ci@ folder:archive"}})
+
+	next := tea.KeyPressMsg{Code: tea.KeyTab}
+	fi.Update(next)
+	_, cmd := fi.Update(next)
+	if fi.activeSearch != "CI" || fi.GetCurrentFolder() != "Archive" {
+		t.Fatalf("activeSearch=%q folder=%q, want CI in Archive", fi.activeSearch, fi.GetCurrentFolder())
+	}
+	var req *SavedSearchRequestedMsg
+	for _, msg := range collectMsgs(cmd) {
+		if r, ok := msg.(SavedSearchRequestedMsg); ok {
+			req = &r
+		}
+	}
+	if req == nil || req.Name != "CI" || req.FolderName != "Archive" || req.Query.From != "ci@" {
+		t.Fatalf("expected a SavedSearchRequestedMsg for CI in Archive, got %+v", req)
+	}
+
+	hits := []fetcher.Email{
+		{UID: 1, AccountID: "account-1", MessageID: "<1@ci>"},
+		{UID: 2, AccountID: "account-1", MessageID: "<2@ci>"},
+	}
+	fi.Update(SavedSearchResultsMsg{Name: "Other", Emails: hits[:1]})
+	fi.Update(SavedSearchResultsMsg{Name: "CI", Emails: hits})
+	if got := len(fi.inbox.searchResults); got != 2 {
+		t.Fatalf("search results = %d, want 2", got)
+	}
+	if fi.RefreshSavedSearch() == nil {
+		t.Fatal("RefreshSavedSearch should re-run the active search")
+	}
+
+	fi.Update(tea.KeyPressMsg{Code: tea.KeyEscape})
+	if fi.activeSearch != "" || fi.inbox.searchActive {
+		t.Fatal("cancel should leave the saved search")
+	}
+	if fi.activeFolderIdx != 1 || fi.GetCurrentFolder() != "Archive" {
+		t.Fatalf("after cancel idx=%d folder=%q, want Archive selected", fi.activeFolderIdx, fi.GetCurrentFolder())
+	}
+	if fi.RefreshSavedSearch() != nil {
+		t.Fatal("RefreshSavedSearch should do nothing without an active search")
+	}
+}
+
+func TestSearchOverlaySavesQuery(t *testing.T) {
+	o := NewSearchOverlay(80, 24)
+	o.Update(SearchResultsMsg{Query: backend.ParseSearchQuery("from:ci@ since:1d")}, MailboxInbox, "")
+
+	o.Update(tea.KeyPressMsg{Code: 's', Mod: tea.ModCtrl}, MailboxInbox, "")
+	if !o.naming {
+		t.Fatal("ctrl+s should prompt for a name")
+	}
+	for _, r := range "CI" {
+		o.Update(tea.KeyPressMsg{Code: r, Text: string(r)}, MailboxInbox, "")
+	}
+	cmd := o.Update(tea.KeyPressMsg{Code: tea.KeyEnter}, MailboxInbox, "")
+	if cmd == nil {
+		t.Fatal("Enter should save the search")
+	}
+	msg, ok := cmd().(SaveSearchMsg)
+	if !ok || msg.Name != "CI" || msg.Query != "from:ci@ since:1d" {
+		t.Fatalf("got %#v, want SaveSearchMsg for CI", cmd())
+	}
+	if o.naming {
+		t.Fatal("saving should close the name prompt")
+	}
+}
+
+func TestSearchOverlaySaveKeyIsRebindable(t *testing.T) {
+	saved := config.Keybinds
+	t.Cleanup(func() { config.Keybinds = saved })
+	config.Keybinds.Inbox.SaveSearch = "ctrl+k"
+
+	o := NewSearchOverlay(80, 24)
+	o.Update(SearchResultsMsg{Query: backend.ParseSearchQuery("from:ci@")}, MailboxInbox, "")
+	o.Update(tea.KeyPressMsg{Code: 's', Mod: tea.ModCtrl}, MailboxInbox, "")
+	if o.naming {
+		t.Fatal("ctrl+s should no longer save once save_search is rebound")
+	}
+	o.Update(tea.KeyPressMsg{Code: 'k', Mod: tea.ModCtrl}, MailboxInbox, "")
+	if !o.naming {
+		t.Fatal("ctrl+k should prompt for a name")
+	}
+}
+
+func TestMoveOverlayCreatesNewFolder(t *testing.T) {
+	accounts := []config.Account{
+		{ID: "account-1", Email: "host.example.com", FetchEmail: "first@example.com"},
+	}
+	fi := NewFolderInbox([]string{keyINBOX, "Archive"}, accounts)
+	model, _ := fi.Update(tea.WindowSizeMsg{Width: 200, Height: 60})
+	fi = model.(*FolderInbox)
+	fi.SetEmails([]fetcher.Email{
+		{UID: 7, AccountID: "account-1", Subject: "first"},
+	}, accounts)
+
+	model, _ = fi.Update(tea.KeyPressMsg{Code: 'm', Text: "m"})
+	fi = model.(*FolderInbox)
+	if !fi.movingEmail {
+		t.Fatal("pressing 'm' should open the move overlay")
+	}
+
+	// Choices are [Archive, + New folder]; select the last row.
+	model, _ = fi.Update(tea.KeyPressMsg{Code: tea.KeyUp})
+	fi = model.(*FolderInbox)
+	model, _ = fi.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	fi = model.(*FolderInbox)
+	if !fi.creatingFolder {
+		t.Fatal("enter on the new folder row should prompt for a name")
+	}
+
+	for _, r := range "Receipts" {
+		model, _ = fi.Update(tea.KeyPressMsg{Code: r, Text: string(r)})
+		fi = model.(*FolderInbox)
+	}
+	model, cmd := fi.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	fi = model.(*FolderInbox)
+	if fi.movingEmail || fi.creatingFolder {
+		t.Fatal("submitting a folder name should close the overlay")
+	}
+	if cmd == nil {
+		t.Fatal("expected a CreateFolderMsg command")
+	}
+	msg, ok := cmd().(CreateFolderMsg)
+	if !ok {
+		t.Fatalf("expected CreateFolderMsg, got %T", cmd())
+	}
+	if msg.Name != "Receipts" || msg.AccountID != "account-1" || len(msg.UIDs) != 1 || msg.UIDs[0] != 7 || msg.SourceFolder != keyINBOX {
+		t.Errorf("unexpected CreateFolderMsg: %+v", msg)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net/mail"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"charm.land/bubbles/v2/list"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
+	overlay "github.com/floatpane/bubble-overlay"
 	threading "github.com/floatpane/jwz-go"
 	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/fetcher"
@@ -28,6 +30,7 @@ var (
 
 var unreadEmailStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("42")).Bold(true)
 var readEmailStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+var flaggedEmailStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
 var visualSelectedStyle lipgloss.Style
 var selectedDateStyle lipgloss.Style
 
@@ -39,6 +42,8 @@ type item struct {
 	accountEmail  string
 	date          time.Time
 	isRead        bool
+	isFlagged     bool
+	labels        []string
 	threadKey     string
 	threadCount   int
 	threadRoot    bool
@@ -98,6 +103,12 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 		statusIcon = "▴"
 	}
 	styledIcon := statusStyle.Render(statusIcon)
+	if i.isFlagged {
+		styledIcon += " " + flaggedEmailStyle.Render("\uf024")
+	}
+	if len(i.labels) > 0 {
+		styledIcon += " " + renderLabelChips(i.labels)
+	}
 	styledSender := statusStyle.Render(sender)
 	separator := " · "
 
@@ -332,8 +343,10 @@ type Inbox struct {
 	noMoreByAccount    map[string]bool // Per-account: true when pagination returns 0 results
 	extraShortHelpKeys []key.Binding
 	pluginStatus       string // Persistent status text set by plugins
+	failedSends        int    // Emails the daemon gave up sending
 	pluginKeyBindings  []PluginKeyBinding
 	searchOverlay      *SearchOverlay
+	labelPicker        *labelPicker
 	searchActive       bool
 	searchQuery        string
 	searchResults      []fetcher.Email
@@ -471,9 +484,14 @@ func (m *Inbox) updateList() {
 			key.NewBinding(key.WithKeys(m.toggleThreadedKey()), key.WithHelp(m.toggleThreadedKey(), "threaded")),
 			key.NewBinding(key.WithKeys("d"), key.WithHelp("\uf014 d", t("inbox.delete"))),
 			key.NewBinding(key.WithKeys("a"), key.WithHelp("\uea98 a", t("inbox.archive"))),
+			key.NewBinding(key.WithKeys(toggleFlagKey()), key.WithHelp("\uf024 "+toggleFlagKey(), t("inbox.flag"))),
+			key.NewBinding(key.WithKeys(labelKey()), key.WithHelp(labelKey(), t("inbox.label"))),
 			key.NewBinding(key.WithKeys("r"), key.WithHelp("\ue348 r", t("inbox.refresh"))),
 			key.NewBinding(key.WithKeys(searchKey()), key.WithHelp(searchKey(), t("inbox.search"))),
 		}
+		if m.failedSends > 0 {
+			bindings = append(bindings, key.NewBinding(key.WithKeys(retrySendsKey()), key.WithHelp(retrySendsKey(), "retry sends")))
+		}
 		if len(m.tabs) > 1 {
 			bindings = append(bindings,
 				key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("←/h", "prev tab")),
@@ -747,6 +765,8 @@ func (m *Inbox) itemForEmail(email fetcher.Email, index int, showAccountLabel bo
 		accountEmail:  accountEmail,
 		date:          email.Date,
 		isRead:        email.IsRead,
+		isFlagged:     email.IsFlagged,
+		labels:        email.Labels,
 	}
 }
 
@@ -782,6 +802,9 @@ func (m *Inbox) getTitle() string {
 	if m.pluginStatus != "" {
 		title += " (" + m.pluginStatus + ")"
 	}
+	if m.failedSends > 0 {
+		title += fmt.Sprintf(" (%d failed to send, %s to retry)", m.failedSends, retrySendsKey())
+	}
 	return title
 }
 
@@ -846,6 +869,20 @@ func (m *Inbox) toggleThreaded() {
 	_ = config.SetFolderThreaded(key, next)
 }
 
+func toggleFlagKey() string {
+	if config.Keybinds.Inbox.ToggleFlag != "" {
+		return config.Keybinds.Inbox.ToggleFlag
+	}
+	return "s"
+}
+
+func retrySendsKey() string {
+	if config.Keybinds.Inbox.RetrySends != "" {
+		return config.Keybinds.Inbox.RetrySends
+	}
+	return "R"
+}
+
 func (m *Inbox) toggleThreadedKey() string {
 	if config.Keybinds.Inbox.ToggleThreaded != "" {
 		return config.Keybinds.Inbox.ToggleThreaded
@@ -864,12 +901,18 @@ func (m *Inbox) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 	case tea.KeyPressMsg:
 		if m.searchOverlay != nil {
 			if msg.String() == config.Keybinds.Global.Cancel {
+				if m.searchOverlay.cancelNaming() {
+					return m, nil
+				}
 				m.searchOverlay = nil
 				return m, nil
 			}
 			cmd := m.searchOverlay.Update(msg, m.mailbox, m.currentAccountID)
 			return m, cmd
 		}
+		if m.labelPicker != nil {
+			return m, m.updateLabelPicker(msg)
+		}
 		if m.list.FilterState() == list.Filtering {
 			// Don't allow visual mode while filtering
 			if m.visualMode {
@@ -1020,6 +1063,45 @@ func (m *Inbox) Update(msg tea.Msg) (tea.Model, tea.Cmd) { //nolint:gocyclo
 					return ArchiveEmailMsg{UID: selectedItem.uid, AccountID: selectedItem.accountID, Mailbox: m.mailbox}
 				}
 			}
+		case toggleFlagKey():
+			if m.visualMode && len(m.selectedUIDs) > 0 {
+				// Batch flag: flag the selection unless it is all flagged already
+				uids := make([]uint32, len(m.selectionOrder))
+				copy(uids, m.selectionOrder)
+				accountID := ""
+				for _, aid := range m.selectedUIDs {
+					accountID = aid
+					break
+				}
+				flagged := !m.allFlagged(uids, accountID)
+
+				// Exit visual mode
+				m.visualMode = false
+				m.selectedUIDs = make(map[uint32]string)
+				m.selectionOrder = []uint32{}
+				m.updateListTitle()
+
+				m.SetEmailsFlagged(uids, accountID, flagged)
+				return m, func() tea.Msg {
+					return FlagEmailsMsg{UIDs: uids, AccountID: accountID, Mailbox: m.mailbox, Flagged: flagged}
+				}
+			}
+			// Single flag toggle
+			selectedItem, ok := m.list.SelectedItem().(item)
+			if ok && selectedItem.uid != 0 {
+				flagged := !selectedItem.isFlagged
+				m.SetEmailsFlagged([]uint32{selectedItem.uid}, selectedItem.accountID, flagged)
+				return m, func() tea.Msg {
+					return FlagEmailsMsg{UIDs: []uint32{selectedItem.uid}, AccountID: selectedItem.accountID, Mailbox: m.mailbox, Flagged: flagged}
+				}
+			}
+		case labelKey():
+			m.openLabelPicker()
+			return m, nil
+		case retrySendsKey():
+			if m.failedSends > 0 {
+				return m, func() tea.Msg { return RetryFailedSendsMsg{} }
+			}
 		case kb.Inbox.Refresh:
 			m.isRefreshing = true
 			m.list.Title = m.getTitle()
@@ -1283,6 +1365,9 @@ func (m *Inbox) View() tea.View {
 
 	b.WriteString(helpView)
 
+	if m.labelPicker != nil {
+		return tea.NewView(overlay.Center(b.String(), m.renderLabelPicker(), m.width, m.height))
+	}
 	return tea.NewView(b.String())
 }
 
@@ -1387,6 +1472,33 @@ func (m *Inbox) MarkEmailAsUnread(uid uint32, accountID string) {
 	m.updateList()
 }
 
+// SetEmailsFlagged sets the flagged state of the given emails in all stores.
+func (m *Inbox) SetEmailsFlagged(uids []uint32, accountID string, flagged bool) {
+	for i := range m.allEmails {
+		if m.allEmails[i].AccountID == accountID && slices.Contains(uids, m.allEmails[i].UID) {
+			m.allEmails[i].IsFlagged = flagged
+		}
+	}
+	if emails, ok := m.emailsByAccount[accountID]; ok {
+		for i := range emails {
+			if slices.Contains(uids, emails[i].UID) {
+				emails[i].IsFlagged = flagged
+			}
+		}
+	}
+	m.updateList()
+}
+
+// allFlagged reports whether every one of the given emails is flagged.
+func (m *Inbox) allFlagged(uids []uint32, accountID string) bool {
+	for _, e := range m.allEmails {
+		if e.AccountID == accountID && slices.Contains(uids, e.UID) && !e.IsFlagged {
+			return false
+		}
+	}
+	return true
+}
+
 // updateVisualSelection updates the selected UIDs based on anchor and current index
 func (m *Inbox) updateVisualSelection() {
 	if !m.visualMode {
@@ -1516,6 +1628,13 @@ func (m *Inbox) SetPluginStatus(status string) {
 	m.list.Title = m.getTitle()
 }
 
+// SetFailedSends sets the number of emails the daemon gave up sending,
+// shown in the title with the key that retries them.
+func (m *Inbox) SetFailedSends(n int) {
+	m.failedSends = n
+	m.list.Title = m.getTitle()
+}
+
 // SetPluginKeyBindings sets the plugin-registered key bindings for display in the help bar.
 func (m *Inbox) SetPluginKeyBindings(bindings []PluginKeyBinding) {
 	m.pluginKeyBindings = bindings
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -614,3 +615,117 @@ func TestThreadedStatusBarCountsActualEmails(t *testing.T) {
 		t.Fatalf("expected totalEmailCount=4 after expand, got %d", inbox.totalEmailCount)
 	}
 }
+
+func TestInboxToggleFlag(t *testing.T) {
+	accounts := []config.Account{{ID: "account-1", Email: "test1@example.com"}}
+	emails := []fetcher.Email{
+		{UID: 1, From: "a@example.com", Subject: "Email 1", Date: time.Now(), AccountID: "account-1"},
+	}
+	inbox := NewInbox(emails, accounts)
+
+	_, cmd := inbox.Update(tea.KeyPressMsg{Code: 's', Text: "s"})
+	msgs := collectMsgs(cmd)
+	if len(msgs) != 1 {
+		t.Fatalf("expected one message, got %v", msgs)
+	}
+	flagMsg, ok := msgs[0].(FlagEmailsMsg)
+	if !ok {
+		t.Fatalf("expected FlagEmailsMsg, got %T", msgs[0])
+	}
+	if !flagMsg.Flagged || len(flagMsg.UIDs) != 1 || flagMsg.UIDs[0] != 1 || flagMsg.AccountID != "account-1" {
+		t.Errorf("unexpected FlagEmailsMsg: %+v", flagMsg)
+	}
+	if selected, _ := inbox.list.SelectedItem().(item); !selected.isFlagged {
+		t.Error("selected item should show as flagged")
+	}
+
+	_, cmd = inbox.Update(tea.KeyPressMsg{Code: 's', Text: "s"})
+	msgs = collectMsgs(cmd)
+	if len(msgs) != 1 || msgs[0].(FlagEmailsMsg).Flagged {
+		t.Errorf("second press should unflag, got %v", msgs)
+	}
+}
+
+func TestInboxLabelPicker(t *testing.T) {
+	accounts := []config.Account{{ID: "account-1", Email: "test1@example.com"}}
+	emails := []fetcher.Email{
+		{UID: 1, From: "a@example.com", Subject: "Email 1", Date: time.Now(), AccountID: "account-1"},
+		{UID: 2, From: "b@example.com", Subject: "Email 2", Date: time.Now().Add(-time.Hour), AccountID: "account-1", Labels: []string{"work"}},
+	}
+	inbox := NewInbox(emails, accounts)
+
+	inbox.Update(tea.KeyPressMsg{Code: 'L', Text: "L"})
+	if !inbox.IsLabelPickerOpen() {
+		t.Fatal("pressing 'L' should open the label picker")
+	}
+	if got := inbox.labelPicker.labels; len(got) != 1 || got[0] != "work" {
+		t.Fatalf("picker labels = %v, want [work]", got)
+	}
+
+	// Toggle the existing "work" label on.
+	_, cmd := inbox.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	msgs := collectMsgs(cmd)
+	if len(msgs) != 1 {
+		t.Fatalf("expected one message, got %v", msgs)
+	}
+	labelMsg, ok := msgs[0].(LabelEmailsMsg)
+	if !ok || !labelMsg.Add || labelMsg.Label != "work" || len(labelMsg.UIDs) != 1 || labelMsg.UIDs[0] != 1 {
+		t.Fatalf("unexpected message %#v", msgs[0])
+	}
+	if selected, _ := inbox.list.SelectedItem().(item); len(selected.labels) != 1 {
+		t.Errorf("selected item labels = %v, want [work]", selected.labels)
+	}
+
+	// Create a new label from the last row.
+	inbox.Update(tea.KeyPressMsg{Code: 'j', Text: "j"})
+	inbox.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	for _, r := range "urgent" {
+		inbox.Update(tea.KeyPressMsg{Code: r, Text: string(r)})
+	}
+	_, cmd = inbox.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	msgs = collectMsgs(cmd)
+	if len(msgs) != 1 || msgs[0].(LabelEmailsMsg).Label != "urgent" || !msgs[0].(LabelEmailsMsg).Add {
+		t.Fatalf("expected urgent label to be added, got %v", msgs)
+	}
+	if selected, _ := inbox.list.SelectedItem().(item); strings.Join(selected.labels, ",") != "urgent,work" {
+		t.Errorf("selected item labels = %v, want [urgent work]", selected.labels)
+	}
+
+	inbox.Update(tea.KeyPressMsg{Code: tea.KeyEscape})
+	if inbox.IsLabelPickerOpen() {
+		t.Error("esc should close the label picker")
+	}
+}
+
+func TestInboxRetryFailedSends(t *testing.T) {
+	accounts := []config.Account{{ID: "account-1", Email: "test1@example.com"}}
+	emails := []fetcher.Email{
+		{UID: 1, From: "a@example.com", Subject: "Email 1", Date: time.Now(), AccountID: "account-1"},
+	}
+	inbox := NewInbox(emails, accounts)
+
+	_, cmd := inbox.Update(tea.KeyPressMsg{Code: 'R', Text: "R"})
+	for _, msg := range collectMsgs(cmd) {
+		if _, ok := msg.(RetryFailedSendsMsg); ok {
+			t.Error("retry key should do nothing without failed sends")
+		}
+	}
+
+	inbox.SetFailedSends(2)
+	if !strings.Contains(inbox.list.Title, "2 failed to send") {
+		t.Errorf("title %q should show the failed sends", inbox.list.Title)
+	}
+	_, cmd = inbox.Update(tea.KeyPressMsg{Code: 'R', Text: "R"})
+	msgs := collectMsgs(cmd)
+	if len(msgs) != 1 {
+		t.Fatalf("expected one message, got %v", msgs)
+	}
+	if _, ok := msgs[0].(RetryFailedSendsMsg); !ok {
+		t.Fatalf("expected RetryFailedSendsMsg, got %T", msgs[0])
+	}
+
+	inbox.SetFailedSends(0)
+	if strings.Contains(inbox.list.Title, "failed to send") {
+		t.Errorf("title %q should not show failed sends", inbox.list.Title)
+	}
+}
@@ -0,0 +1,314 @@
+package tui
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+
+	"charm.land/bubbles/v2/textinput"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/theme"
+)
+
+// labelChipColors is the palette label chips are drawn from. A label always
+// hashes to the same colour so it is recognisable across rows.
+var labelChipColors = []string{"33", "35", "41", "99", "166", "170", "203", "214"}
+
+// Inbox rows show at most maxRowLabels chips, each cut to maxChipWidth cells.
+const (
+	maxRowLabels = 3
+	maxChipWidth = 12
+)
+
+func labelChipStyle(label string) lipgloss.Style {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(label))) //nolint:errcheck,gosec
+	color := labelChipColors[h.Sum32()%uint32(len(labelChipColors))]
+	return lipgloss.NewStyle().
+		Background(lipgloss.Color(color)).
+		Foreground(lipgloss.Color("#000000")).
+		Padding(0, 1)
+}
+
+// renderLabelChip renders a single label as a coloured chip.
+func renderLabelChip(label string) string {
+	return labelChipStyle(label).Render(label)
+}
+
+// renderLabelChips renders the chips shown in an inbox row.
+func renderLabelChips(labels []string) string {
+	chips := make([]string, 0, maxRowLabels+1)
+	for i, label := range labels {
+		if i == maxRowLabels {
+			chips = append(chips, readEmailStyle.Render(fmt.Sprintf("+%d", len(labels)-maxRowLabels)))
+			break
+		}
+		if lipgloss.Width(label) > maxChipWidth {
+			runes := []rune(label)
+			for lipgloss.Width(string(runes)) > maxChipWidth-1 && len(runes) > 0 {
+				runes = runes[:len(runes)-1]
+			}
+			label = string(runes) + "…"
+		}
+		chips = append(chips, renderLabelChip(label))
+	}
+	return strings.Join(chips, " ")
+}
+
+func labelKey() string {
+	if config.Keybinds.Inbox.Label != "" {
+		return config.Keybinds.Inbox.Label
+	}
+	return "L"
+}
+
+// labelPicker is the state of the label overlay. Labels are toggled on the
+// emails the picker was opened for; the overlay stays open until cancelled
+// so several labels can be changed in one go.
+type labelPicker struct {
+	uids      []uint32
+	accountID string
+	labels    []string
+	cursor    int
+	creating  bool
+	input     textinput.Model
+	err       string
+}
+
+// openLabelPicker opens the overlay for the visual selection, or the
+// highlighted email.
+func (m *Inbox) openLabelPicker() {
+	var uids []uint32
+	var accountID string
+	if m.visualMode && len(m.selectedUIDs) > 0 {
+		uids = make([]uint32, len(m.selectionOrder))
+		copy(uids, m.selectionOrder)
+		for _, aid := range m.selectedUIDs {
+			accountID = aid
+			break
+		}
+
+		// Exit visual mode
+		m.visualMode = false
+		m.selectedUIDs = make(map[uint32]string)
+		m.selectionOrder = []uint32{}
+		m.updateListTitle()
+	} else {
+		selectedItem, ok := m.list.SelectedItem().(item)
+		if !ok || selectedItem.uid == 0 {
+			return
+		}
+		uids = []uint32{selectedItem.uid}
+		accountID = selectedItem.accountID
+	}
+
+	m.labelPicker = &labelPicker{
+		uids:      uids,
+		accountID: accountID,
+		labels:    m.knownLabels(accountID),
+	}
+}
+
+// knownLabels returns every label used by the account's loaded emails.
+func (m *Inbox) knownLabels(accountID string) []string {
+	seen := make(map[string]bool)
+	var labels []string
+	for _, e := range m.allEmails {
+		if e.AccountID != accountID {
+			continue
+		}
+		for _, label := range e.Labels {
+			if !seen[strings.ToLower(label)] {
+				seen[strings.ToLower(label)] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return strings.ToLower(labels[i]) < strings.ToLower(labels[j])
+	})
+	return labels
+}
+
+func (m *Inbox) updateLabelPicker(msg tea.KeyPressMsg) tea.Cmd {
+	p := m.labelPicker
+	kb := config.Keybinds
+
+	if p.creating {
+		switch msg.String() {
+		case kb.Global.Cancel:
+			p.creating = false
+			p.err = ""
+			return nil
+		case keyEnter:
+			label := strings.TrimSpace(p.input.Value())
+			if err := backend.CheckLabel(label); err != nil {
+				p.err = err.Error()
+				return nil
+			}
+			p.creating = false
+			p.err = ""
+			idx := labelIndex(p.labels, label)
+			if idx < 0 {
+				p.labels = append(p.labels, label)
+				idx = len(p.labels) - 1
+			}
+			p.cursor = idx
+			return m.setLabel(p.labels[idx], true)
+		}
+		var cmd tea.Cmd
+		p.input, cmd = p.input.Update(msg)
+		return cmd
+	}
+
+	// The last row of the overlay is the "new label" entry.
+	rows := len(p.labels) + 1
+	switch msg.String() {
+	case kb.Global.Cancel:
+		m.labelPicker = nil
+	case "up", kb.Global.NavUp:
+		p.cursor--
+		if p.cursor < 0 {
+			p.cursor = rows - 1
+		}
+	case keyDown, kb.Global.NavDown:
+		p.cursor++
+		if p.cursor >= rows {
+			p.cursor = 0
+		}
+	case keyEnter:
+		if p.cursor == len(p.labels) {
+			p.creating = true
+			p.input = textinput.New()
+			p.input.Placeholder = t("inbox.new_label_placeholder")
+			p.input.Prompt = "> "
+			p.input.CharLimit = 64
+			p.input.SetStyles(ThemedTextInputStyles())
+			return p.input.Focus()
+		}
+		label := p.labels[p.cursor]
+		return m.setLabel(label, !m.allLabeled(p.uids, p.accountID, label))
+	}
+	return nil
+}
+
+// setLabel applies a label change from the picker to the local copies and
+// returns the command asking for it on the server.
+func (m *Inbox) setLabel(label string, add bool) tea.Cmd {
+	p := m.labelPicker
+	uids := append([]uint32(nil), p.uids...)
+	accountID := p.accountID
+	m.SetEmailsLabel(uids, accountID, label, add)
+	return func() tea.Msg {
+		return LabelEmailsMsg{UIDs: uids, AccountID: accountID, Mailbox: m.mailbox, Label: label, Add: add}
+	}
+}
+
+// SetEmailsLabel adds or removes a label on the given emails in all stores.
+func (m *Inbox) SetEmailsLabel(uids []uint32, accountID, label string, add bool) {
+	for i := range m.allEmails {
+		if m.allEmails[i].AccountID == accountID && slices.Contains(uids, m.allEmails[i].UID) {
+			m.allEmails[i].Labels = WithLabel(m.allEmails[i].Labels, label, add)
+		}
+	}
+	if emails, ok := m.emailsByAccount[accountID]; ok {
+		for i := range emails {
+			if slices.Contains(uids, emails[i].UID) {
+				emails[i].Labels = WithLabel(emails[i].Labels, label, add)
+			}
+		}
+	}
+	m.updateList()
+}
+
+// labelIndex returns the position of label in labels, or -1. Labels compare
+// case-insensitively, as IMAP keywords do.
+func labelIndex(labels []string, label string) int {
+	return slices.IndexFunc(labels, func(l string) bool { return strings.EqualFold(l, label) })
+}
+
+// WithLabel returns a copy of labels with label added or removed, kept
+// sorted.
+func WithLabel(labels []string, label string, add bool) []string {
+	out := make([]string, 0, len(labels)+1)
+	for _, l := range labels {
+		if !strings.EqualFold(l, label) {
+			out = append(out, l)
+		}
+	}
+	if add {
+		out = append(out, label)
+		sort.Strings(out)
+	}
+	return out
+}
+
+// allLabeled reports whether every one of the given emails has the label.
+func (m *Inbox) allLabeled(uids []uint32, accountID, label string) bool {
+	for _, e := range m.allEmails {
+		if e.AccountID == accountID && slices.Contains(uids, e.UID) && labelIndex(e.Labels, label) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Inbox) renderLabelPicker() string {
+	p := m.labelPicker
+
+	var b strings.Builder
+	title := t("inbox.labels_title")
+	if len(p.uids) > 1 {
+		title = tn("inbox.labels_multiple", len(p.uids), map[string]interface{}{
+			keyCount: len(p.uids),
+		})
+	}
+	b.WriteString(moveOverlayTitleStyle.Render(title))
+	b.WriteString("\n")
+
+	if p.creating {
+		b.WriteString(p.input.View())
+		if p.err != "" {
+			b.WriteString("\n")
+			b.WriteString(lipgloss.NewStyle().Foreground(theme.ActiveTheme.Danger).Render(p.err))
+		}
+		b.WriteString("\n\n")
+		b.WriteString(helpStyle.Render(t("inbox.new_label_help")))
+		return moveOverlayStyle.Render(b.String())
+	}
+
+	for i, label := range p.labels {
+		check := "[ ] "
+		if m.allLabeled(p.uids, p.accountID, label) {
+			check = "[x] "
+		}
+		cursor := "  "
+		style := moveItemStyle
+		if i == p.cursor {
+			cursor = "> "
+			style = moveSelectedItemStyle
+		}
+		b.WriteString(style.Render(cursor+check) + renderLabelChip(label))
+		b.WriteString("\n")
+	}
+	newLabel := t("inbox.new_label")
+	if p.cursor == len(p.labels) {
+		b.WriteString(moveSelectedItemStyle.Render("> " + newLabel))
+	} else {
+		b.WriteString(moveItemStyle.Render("  " + newLabel))
+	}
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render(t("inbox.labels_help")))
+
+	return moveOverlayStyle.Render(b.String())
+}
+
+// IsLabelPickerOpen reports whether the label overlay is showing.
+func (m *Inbox) IsLabelPickerOpen() bool {
+	return m != nil && m.labelPicker != nil
+}
@@ -9,6 +9,7 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/plugin"
 	"github.com/floatpane/matcha/plugins"
 	"github.com/floatpane/matcha/theme"
 )
@@ -29,6 +30,9 @@ var (
 	mpInstalledStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("35"))
 
+	mpUpdateStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214"))
+
 	mpSelectedStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("42")).
 			Bold(true)
@@ -54,15 +58,26 @@ type RegistryFetchedMsg struct {
 	Err     error
 }
 
-// PluginInstalledMsg signals that a plugin was installed from the marketplace.
+// PluginFetchedMsg signals that a plugin which asks for permissions was
+// downloaded and is waiting for the user to approve them.
+type PluginFetchedMsg struct {
+	Entry       plugins.PluginEntry
+	Data        []byte
+	Permissions []string
+}
+
+// PluginInstalledMsg signals that a plugin was installed or updated from the
+// marketplace.
 type PluginInstalledMsg struct {
-	Name string
-	Err  error
+	Name    string
+	Version string
+	Err     error
 }
 
 type Marketplace struct {
 	entries    []plugins.PluginEntry
 	installed  map[string]bool
+	versions   map[string]string // installed version by name; "" if unknown
 	cursor     int
 	offset     int // scroll offset
 	width      int
@@ -71,6 +86,10 @@ type Marketplace struct {
 	errMsg     string
 	status     string // transient status message
 	standalone bool   // true when launched via `matcha marketplace` (not from main menu)
+
+	// pending is a downloaded plugin whose permissions are being shown
+	// for approval.
+	pending *PluginFetchedMsg
 }
 
 func NewMarketplace(standalone bool) Marketplace {
@@ -103,15 +122,29 @@ func (m Marketplace) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.entries = msg.Entries
+		m.versions = installedVersions(msg.Entries)
 		m.state = marketplaceReady
 		return m, nil
 
+	case PluginFetchedMsg:
+		m.pending = &msg
+		m.status = ""
+		return m, nil
+
 	case PluginInstalledMsg:
 		if msg.Err != nil {
 			m.status = fmt.Sprintf("Failed to install %s: %v", msg.Name, msg.Err)
 		} else {
-			m.status = fmt.Sprintf("Installed %s", msg.Name)
+			if m.installed[msg.Name] {
+				m.status = fmt.Sprintf("Updated %s to %s", msg.Name, msg.Version)
+			} else {
+				m.status = fmt.Sprintf("Installed %s", msg.Name)
+			}
 			m.installed[msg.Name] = true
+			if m.versions == nil {
+				m.versions = make(map[string]string)
+			}
+			m.versions[msg.Name] = msg.Version
 		}
 		return m, nil
 
@@ -127,6 +160,22 @@ func (m Marketplace) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		if m.pending != nil {
+			switch msg.String() {
+			case acceptKey():
+				pending := m.pending
+				m.pending = nil
+				m.status = fmt.Sprintf("Installing %s...", pending.Entry.Name)
+				return m, writePlugin(pending.Entry, pending.Data)
+			case declineKey(), "q", kb.Global.Cancel:
+				m.status = fmt.Sprintf("Did not install %s", m.pending.Entry.Name)
+				m.pending = nil
+			case kb.Global.Quit:
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "q", kb.Global.Cancel:
 			if m.standalone {
@@ -153,11 +202,15 @@ func (m Marketplace) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case keyEnter:
 			if m.cursor < len(m.entries) {
 				entry := m.entries[m.cursor]
-				if m.installed[entry.Name] {
+				switch {
+				case m.outdated(entry):
+					m.status = fmt.Sprintf("Updating %s...", entry.Name)
+				case m.installed[entry.Name]:
 					m.status = fmt.Sprintf("%s is already installed", entry.Name)
 					return m, nil
+				default:
+					m.status = fmt.Sprintf("Installing %s...", entry.Name)
 				}
-				m.status = fmt.Sprintf("Installing %s...", entry.Name)
 				return m, installPlugin(entry)
 			}
 		}
@@ -165,6 +218,26 @@ func (m Marketplace) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func acceptKey() string {
+	if config.Keybinds.Global.Accept != "" {
+		return config.Keybinds.Global.Accept
+	}
+	return "y"
+}
+
+func declineKey() string {
+	if config.Keybinds.Global.Decline != "" {
+		return config.Keybinds.Global.Decline
+	}
+	return "n"
+}
+
+// outdated reports whether an installed plugin has a newer version in the
+// registry.
+func (m Marketplace) outdated(entry plugins.PluginEntry) bool {
+	return m.installed[entry.Name] && entry.Outdated(m.versions[entry.Name])
+}
+
 func (m Marketplace) visibleRows() int {
 	// Each entry takes 2 lines (name + description), plus header/footer
 	available := m.height - 8 // header + footer + padding
@@ -174,6 +247,8 @@ func (m Marketplace) visibleRows() int {
 	return available / 2
 }
 
+// installPlugin downloads a plugin and installs it, or asks for approval
+// first when it declares permissions.
 func installPlugin(entry plugins.PluginEntry) tea.Cmd {
 	return func() tea.Msg {
 		data, err := plugins.FetchPlugin(entry)
@@ -181,6 +256,21 @@ func installPlugin(entry plugins.PluginEntry) tea.Cmd {
 			return PluginInstalledMsg{Name: entry.Name, Err: err}
 		}
 
+		mf, err := plugin.ParseManifest(data)
+		if err != nil {
+			return PluginInstalledMsg{Name: entry.Name, Err: err}
+		}
+		if perms := mf.Summary(); len(perms) > 0 {
+			return PluginFetchedMsg{Entry: entry, Data: data, Permissions: perms}
+		}
+		return writePlugin(entry, data)()
+	}
+}
+
+// writePlugin saves a downloaded plugin to the plugins directory and records
+// its version.
+func writePlugin(entry plugins.PluginEntry, data []byte) tea.Cmd {
+	return func() tea.Msg {
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return PluginInstalledMsg{Name: entry.Name, Err: err}
@@ -195,8 +285,11 @@ func installPlugin(entry plugins.PluginEntry) tea.Cmd {
 		if err := os.WriteFile(dest, data, 0644); err != nil {
 			return PluginInstalledMsg{Name: entry.Name, Err: err}
 		}
+		if err := plugins.RecordInstalled(dir, entry); err != nil {
+			return PluginInstalledMsg{Name: entry.Name, Err: err}
+		}
 
-		return PluginInstalledMsg{Name: entry.Name}
+		return PluginInstalledMsg{Name: entry.Name, Version: entry.Version}
 	}
 }
 
@@ -220,6 +313,27 @@ func installedPlugins() map[string]bool {
 	return installed
 }
 
+// installedVersions returns the installed version of each registry plugin
+// found in the plugins directory.
+func installedVersions(entries []plugins.PluginEntry) map[string]string {
+	versions := make(map[string]string)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return versions
+	}
+	dir := filepath.Join(home, ".config", "matcha", "plugins")
+	installed, err := plugins.LoadInstalled(dir)
+	if err != nil {
+		return versions
+	}
+	for _, e := range entries {
+		if v, ok := plugins.InstalledVersion(dir, e, installed); ok {
+			versions[e.Name] = v
+		}
+	}
+	return versions
+}
+
 func (m Marketplace) View() tea.View {
 	var b strings.Builder
 
@@ -237,6 +351,14 @@ func (m Marketplace) View() tea.View {
 		b.WriteString(errStyle.Render(fmt.Sprintf("  Error: %s", m.errMsg)))
 		b.WriteString("\n")
 	case marketplaceReady:
+		if m.pending != nil {
+			fmt.Fprintf(&b, "  %s asks for permission to:\n\n", mpSelectedStyle.Render(m.pending.Entry.Title))
+			for _, p := range m.pending.Permissions {
+				fmt.Fprintf(&b, "    • %s\n", p)
+			}
+			break
+		}
+
 		visible := m.visibleRows()
 		end := m.offset + visible
 		if end > len(m.entries) {
@@ -253,7 +375,14 @@ func (m Marketplace) View() tea.View {
 			}
 
 			name := nameStyle.Render(entry.Title)
-			if m.installed[entry.Name] {
+			switch {
+			case m.outdated(entry):
+				from := m.versions[entry.Name]
+				if from == "" {
+					from = "unknown"
+				}
+				name += " " + mpUpdateStyle.Render(fmt.Sprintf("[update %s → %s]", from, entry.Version))
+			case m.installed[entry.Name]:
 				name += " " + mpInstalledStyle.Render("[installed]")
 			}
 
@@ -272,7 +401,10 @@ func (m Marketplace) View() tea.View {
 	}
 
 	mainContent := b.String()
-	help := helpStyle.Render("↑/↓ navigate • enter install • q back")
+	help := helpStyle.Render("↑/↓ navigate • enter install/update • q back")
+	if m.pending != nil {
+		help = helpStyle.Render(acceptKey() + " install • " + declineKey() + " cancel")
+	}
 
 	if m.height > 0 {
 		currentHeight := lipgloss.Height(DocStyle.Render(mainContent + "\n" + help))
@@ -0,0 +1,108 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/plugins"
+)
+
+func TestMarketplaceAsksBeforeGrantingPermissions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	entry := plugins.PluginEntry{Name: "sync", Title: "Sync", File: "sync.lua"}
+	data := []byte("-- @permission storage\n")
+	fetched := PluginFetchedMsg{Entry: entry, Data: data, Permissions: []string{"Store data on this computer"}}
+
+	m := NewMarketplace(true)
+	model, _ := m.Update(RegistryFetchedMsg{Entries: []plugins.PluginEntry{entry}})
+	model, _ = model.Update(fetched)
+	if view := model.View().Content; !strings.Contains(view, "Store data on this computer") {
+		t.Fatalf("permissions not shown:\n%s", view)
+	}
+
+	model, cmd := model.Update(tea.KeyPressMsg{Code: 'n', Text: "n"})
+	if cmd != nil || model.(Marketplace).pending != nil {
+		t.Fatal("declining still installs the plugin")
+	}
+
+	model, _ = model.Update(fetched)
+	model, cmd = model.Update(tea.KeyPressMsg{Code: 'y', Text: "y"})
+	if cmd == nil {
+		t.Fatal("approving did not install the plugin")
+	}
+	if msg, ok := cmd().(PluginInstalledMsg); !ok || msg.Err != nil {
+		t.Fatalf("install = %+v", msg)
+	}
+	if got, err := os.ReadFile(filepath.Join(home, ".config", "matcha", "plugins", "sync.lua")); err != nil || string(got) != string(data) {
+		t.Errorf("installed %q, %v", got, err)
+	}
+}
+
+func TestMarketplaceConsentUsesConfiguredKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	saved := config.Keybinds
+	t.Cleanup(func() { config.Keybinds = saved })
+	config.Keybinds.Global.Accept = "a"
+	config.Keybinds.Global.Decline = "x"
+
+	entry := plugins.PluginEntry{Name: "sync", Title: "Sync", File: "sync.lua"}
+	fetched := PluginFetchedMsg{Entry: entry, Data: []byte("-- @permission storage\n"), Permissions: []string{"Store data on this computer"}}
+
+	m := NewMarketplace(true)
+	model, _ := m.Update(RegistryFetchedMsg{Entries: []plugins.PluginEntry{entry}})
+	model, _ = model.Update(fetched)
+	if view := model.View().Content; !strings.Contains(view, "a install • x cancel") {
+		t.Fatalf("help does not show the configured keys:\n%s", view)
+	}
+
+	model, cmd := model.Update(tea.KeyPressMsg{Code: 'y', Text: "y"})
+	if cmd != nil || model.(Marketplace).pending == nil {
+		t.Fatal("y still approves with accept remapped")
+	}
+	model, cmd = model.Update(tea.KeyPressMsg{Code: 'x', Text: "x"})
+	if cmd != nil || model.(Marketplace).pending != nil {
+		t.Fatal("the decline key did not cancel")
+	}
+
+	model, _ = model.Update(fetched)
+	if _, cmd = model.Update(tea.KeyPressMsg{Code: 'a', Text: "a"}); cmd == nil {
+		t.Fatal("the accept key did not install the plugin")
+	}
+}
+
+func TestMarketplaceShowsUpdates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".config", "matcha", "plugins")
+	os.MkdirAll(dir, 0750)                                                  //nolint:errcheck
+	os.WriteFile(filepath.Join(dir, "hello.lua"), []byte("-- old\n"), 0644) //nolint:errcheck
+
+	entry := plugins.PluginEntry{Name: "hello", Title: "Hello", File: "hello.lua", Version: "1.1.0"}
+	old := entry
+	old.Version = "1.0.0"
+	if err := plugins.RecordInstalled(dir, old); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMarketplace(true)
+	model, _ := m.Update(RegistryFetchedMsg{Entries: []plugins.PluginEntry{entry}})
+	if view := model.View().Content; !strings.Contains(view, "[update 1.0.0 → 1.1.0]") {
+		t.Fatalf("update badge not shown:\n%s", view)
+	}
+
+	model, cmd := model.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	if cmd == nil || !strings.Contains(model.(Marketplace).status, "Updating hello") {
+		t.Fatalf("enter on an outdated plugin did not update it (status %q)", model.(Marketplace).status)
+	}
+
+	model, _ = model.Update(PluginInstalledMsg{Name: "hello", Version: "1.1.0"})
+	if view := model.View().Content; !strings.Contains(view, "[installed]") {
+		t.Errorf("badge after update:\n%s", view)
+	}
+}
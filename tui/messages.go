@@ -34,13 +34,14 @@ type SendEmailMsg struct {
 	AttachmentPaths []string
 	InReplyTo       string
 	References      []string
-	AccountID       string // ID of the account to send from
-	FromOverride    string // Custom From address (used when account is catch-all)
-	QuotedText      string // Hidden quoted text appended when sending
-	Signature       string // Signature to append to email body
-	SignSMIME       bool   // Whether to sign the email using S/MIME
-	EncryptSMIME    bool   // Whether to encrypt the email using S/MIME
-	SignPGP         bool   // Whether to sign the email using PGP
+	AccountID       string            // ID of the account to send from
+	FromOverride    string            // Custom From address (used when account is catch-all)
+	QuotedText      string            // Hidden quoted text appended when sending
+	Signature       string            // Signature to append to email body
+	SignSMIME       bool              // Whether to sign the email using S/MIME
+	EncryptSMIME    bool              // Whether to encrypt the email using S/MIME
+	SignPGP         bool              // Whether to sign the email using PGP
+	Headers         map[string]string // Extra headers set by plugins
 }
 
 type EmailQueuedMsg struct {
@@ -136,6 +137,9 @@ type SearchResultsMsg struct {
 	Query  backend.SearchQuery
 	Emails []fetcher.Email
 	Err    error
+	// Local results come from the on-disk search index and arrive ahead of
+	// the server's.
+	Local bool
 }
 
 type ApplySearchResultsMsg struct {
@@ -143,6 +147,27 @@ type ApplySearchResultsMsg struct {
 	Emails []fetcher.Email
 }
 
+// SaveSearchMsg asks for a search query to be kept under a name.
+type SaveSearchMsg struct {
+	Name  string
+	Query string
+}
+
+// SavedSearchRequestedMsg asks for a saved search to be run across all
+// accounts, in the folder the sidebar switched to for it.
+type SavedSearchRequestedMsg struct {
+	Name       string
+	Query      backend.SearchQuery
+	FolderName string
+}
+
+// SavedSearchResultsMsg carries the results of a saved search.
+type SavedSearchResultsMsg struct {
+	Name   string
+	Emails []fetcher.Email
+	Err    error
+}
+
 type GoToInboxMsg struct{}
 
 type GoToSentInboxMsg struct{}
@@ -230,6 +255,42 @@ type BatchArchiveEmailsMsg struct {
 	Mailbox   MailboxKind
 }
 
+// FlagEmailsMsg signals that emails should be flagged or unflagged on the
+// server. The inbox has already updated its own copy.
+type FlagEmailsMsg struct {
+	UIDs      []uint32
+	AccountID string
+	Mailbox   MailboxKind
+	Flagged   bool
+}
+
+// EmailsFlaggedMsg signals that a flag change finished.
+type EmailsFlaggedMsg struct {
+	UIDs      []uint32
+	AccountID string
+	Flagged   bool
+	Err       error
+}
+
+// LabelEmailsMsg signals that a label should be added to or removed from
+// emails on the server. The inbox has already updated its own copy.
+type LabelEmailsMsg struct {
+	UIDs      []uint32
+	AccountID string
+	Mailbox   MailboxKind
+	Label     string
+	Add       bool
+}
+
+// EmailsLabeledMsg signals that a label change finished.
+type EmailsLabeledMsg struct {
+	UIDs      []uint32
+	AccountID string
+	Label     string
+	Add       bool
+	Err       error
+}
+
 type BatchMoveEmailsMsg struct {
 	UIDs         []uint32
 	AccountID    string
@@ -488,6 +549,24 @@ type MoveEmailToFolderMsg struct {
 	DestFolder   string
 }
 
+// CreateFolderMsg signals that a folder should be created and the listed
+// emails moved into it.
+type CreateFolderMsg struct {
+	AccountID    string
+	Name         string
+	UIDs         []uint32
+	SourceFolder string
+}
+
+// FolderCreatedMsg signals that a folder was created for a pending move.
+type FolderCreatedMsg struct {
+	AccountID    string
+	Name         string
+	UIDs         []uint32
+	SourceFolder string
+	Err          error
+}
+
 // EmailMovedMsg signals that an email was moved to a folder.
 type EmailMovedMsg struct {
 	UID          uint32
@@ -552,6 +631,16 @@ type DaemonEventMsg struct {
 	Event *daemonrpc.Event
 }
 
+// FailedSendsMsg reports how many emails in the daemon's outbox gave up
+// sending.
+type FailedSendsMsg struct {
+	Count int
+}
+
+// RetryFailedSendsMsg signals that the user wants the daemon to retry the
+// emails it gave up sending.
+type RetryFailedSendsMsg struct{}
+
 // --- Plugin Messages ---
 
 // PluginNotifyMsg signals that a plugin wants to show a notification.
@@ -593,6 +682,22 @@ type SecureModeDisabledMsg struct {
 	Err error
 }
 
+// SieveLoadedMsg carries an account's active Sieve script, fetched for the
+// filters settings screen.
+type SieveLoadedMsg struct {
+	AccountID string
+	Name      string
+	Script    string
+	Err       error
+}
+
+// SieveSavedMsg signals that the filters settings screen uploaded and
+// activated an account's Sieve script.
+type SieveSavedMsg struct {
+	AccountID string
+	Err       error
+}
+
 // SendRSVPMsg signals that user wants to send RSVP to calendar invite
 type SendRSVPMsg struct {
 	OriginalICS []byte
@@ -8,6 +8,7 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	"github.com/floatpane/matcha/backend"
+	"github.com/floatpane/matcha/config"
 	"github.com/floatpane/matcha/fetcher"
 	"github.com/floatpane/matcha/theme"
 )
@@ -20,6 +21,20 @@ type SearchOverlay struct {
 	done    bool
 	err     string
 	width   int
+
+	// naming is set while nameInput prompts for the name to save the
+	// query under; saved is the name it was last saved as.
+	naming    bool
+	nameInput textinput.Model
+	saved     string
+}
+
+// saveSearchKey saves the searched query once results are in.
+func saveSearchKey() string {
+	if config.Keybinds.Inbox.SaveSearch != "" {
+		return config.Keybinds.Inbox.SaveSearch
+	}
+	return "ctrl+s"
 }
 
 func NewSearchOverlay(width, height int) *SearchOverlay {
@@ -43,6 +58,13 @@ func (o *SearchOverlay) Update(msg tea.Msg, mailbox MailboxKind, accountID strin
 		o.width = msg.Width
 		return nil
 	case SearchResultsMsg:
+		if msg.Local {
+			// Shown until the server answers; ignored if it already has.
+			if o.loading {
+				o.done, o.query, o.results = true, msg.Query, msg.Emails
+			}
+			return nil
+		}
 		o.loading, o.done, o.err = false, msg.Err == nil, ""
 		o.query = msg.Query
 		if msg.Err != nil {
@@ -52,8 +74,21 @@ func (o *SearchOverlay) Update(msg tea.Msg, mailbox MailboxKind, accountID strin
 		o.results = msg.Emails
 		return nil
 	case tea.KeyPressMsg:
+		if o.naming {
+			return o.updateName(msg)
+		}
+		if msg.String() == saveSearchKey() && o.done && o.query.Raw != "" {
+			o.naming = true
+			o.nameInput = textinput.New()
+			o.nameInput.Placeholder = "Name"
+			o.nameInput.Prompt = "Save as: "
+			o.nameInput.CharLimit = 64
+			o.nameInput.SetStyles(ThemedTextInputStyles())
+			o.input.Blur()
+			return o.nameInput.Focus()
+		}
 		if msg.String() == keyEnter {
-			if o.loading {
+			if o.loading && !o.done {
 				return nil
 			}
 			if o.done {
@@ -65,8 +100,12 @@ func (o *SearchOverlay) Update(msg tea.Msg, mailbox MailboxKind, accountID strin
 			if raw == "" {
 				return nil
 			}
-			o.loading, o.done, o.err, o.results = true, false, "", nil
 			query := backend.ParseSearchQuery(raw)
+			if query.Err != nil {
+				o.loading, o.done, o.err, o.results, o.saved = false, false, query.Err.Error(), nil, ""
+				return nil
+			}
+			o.loading, o.done, o.err, o.results, o.saved = true, false, "", nil, ""
 			return func() tea.Msg { return SearchRequestedMsg{Query: query, Mailbox: mailbox, AccountID: accountID} }
 		}
 	}
@@ -76,6 +115,33 @@ func (o *SearchOverlay) Update(msg tea.Msg, mailbox MailboxKind, accountID strin
 	return cmd
 }
 
+func (o *SearchOverlay) updateName(msg tea.KeyPressMsg) tea.Cmd {
+	if msg.String() != keyEnter {
+		var cmd tea.Cmd
+		o.nameInput, cmd = o.nameInput.Update(msg)
+		return cmd
+	}
+	name := strings.TrimSpace(o.nameInput.Value())
+	if name == "" {
+		return nil
+	}
+	o.cancelNaming()
+	o.saved = name
+	query := o.query.Raw
+	return func() tea.Msg { return SaveSearchMsg{Name: name, Query: query} }
+}
+
+// cancelNaming leaves the name prompt and reports whether it was open.
+func (o *SearchOverlay) cancelNaming() bool {
+	if !o.naming {
+		return false
+	}
+	o.naming = false
+	o.nameInput.Blur()
+	o.input.Focus()
+	return true
+}
+
 func (o *SearchOverlay) View() string {
 	boxWidth := o.width - 4
 	if boxWidth < 40 {
@@ -84,14 +150,21 @@ func (o *SearchOverlay) View() string {
 	style := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).
 		BorderForeground(theme.ActiveTheme.Accent).Padding(1, 2).Width(boxWidth)
 	content := "Search mail\n\n" + o.input.View()
-	if o.loading {
+	if o.loading && o.done {
+		content += "\n\nSearching server..."
+	} else if o.loading {
 		content += "\n\nSearching..."
 	}
 	if o.err != "" {
 		content += "\n\n" + lipgloss.NewStyle().Foreground(theme.ActiveTheme.Danger).Render(o.err)
 	}
+	if o.naming {
+		content += "\n\n" + o.nameInput.View() + "\nPress Enter to save, Esc to cancel."
+	} else if o.saved != "" {
+		content += "\n\nSaved as " + o.saved + "."
+	}
 	if o.done {
-		content += fmt.Sprintf("\n\n%d result(s). Press Enter to apply, Esc to dismiss.\n", len(o.results))
+		content += fmt.Sprintf("\n\n%d result(s). Press Enter to apply, %s to save the search, Esc to dismiss.\n", len(o.results), saveSearchKey())
 		content += o.resultsView()
 	}
 	return style.Render(content)
@@ -3,6 +3,7 @@ package tui
 import (
 	"strings"
 
+	"charm.land/bubbles/v2/textarea"
 	"charm.land/bubbles/v2/textinput"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
@@ -39,6 +40,7 @@ const (
 	CategoryMailingLists
 	CategoryEncryption
 	CategoryPlugins
+	CategoryFilters
 )
 
 type Settings struct {
@@ -89,6 +91,22 @@ type Settings struct {
 	pluginEditingKey    string
 	pluginEditingType   plugin.SettingType
 	pluginInput         textinput.Model
+
+	// Sieve filters state
+	filtersCursor     int
+	sieveAccountID    string // account whose script is open ("" = account list)
+	sieveScriptName   string
+	sieveLoading      bool
+	sieveLoaded       bool
+	sieveSaving       bool
+	sieveError        string
+	sieveStatus       string
+	sieveFocus        int
+	sieveVacation     bool
+	sieveSubjectInput textinput.Model
+	sieveDaysInput    textinput.Model
+	sieveMessageInput textarea.Model
+	sieveScriptInput  textarea.Model
 }
 
 type SettingsState struct {
@@ -136,6 +154,10 @@ func NewSettings(cfg *config.Config) *Settings {
 		encConfirmInput:    newInput("Confirm Password", "> ", true),
 		passwordMeter:      passwordstrength.NewLibMeter(),
 		pluginInput:        newInput("", "> ", false),
+		sieveSubjectInput:  newInput("Out of office", "> ", false),
+		sieveDaysInput:     newInput("7", "> ", false),
+		sieveMessageInput:  newFilterTextArea("I'm away until...", 4),
+		sieveScriptInput:   newFilterTextArea("require \"fileinto\";", 10),
 	}
 }
 
@@ -191,6 +213,10 @@ func (m *Settings) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.pgpPrivateKeyInput.SetWidth(inputWidth)
 		m.pgpPINInput.SetWidth(inputWidth)
 		m.pluginInput.SetWidth(inputWidth)
+		m.sieveSubjectInput.SetWidth(inputWidth)
+		m.sieveDaysInput.SetWidth(inputWidth)
+		m.sieveMessageInput.SetWidth(inputWidth)
+		m.sieveScriptInput.SetWidth(inputWidth)
 		return m, nil
 
 	case tea.KeyPressMsg:
@@ -213,6 +239,14 @@ func (m *Settings) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.confirmingDisable = false
 		m.activePane = PaneMenu
 		return m, nil
+
+	case SieveLoadedMsg:
+		m.applySieveLoaded(msg)
+		return m, nil
+
+	case SieveSavedMsg:
+		m.applySieveSaved(msg)
+		return m, nil
 	}
 
 	// Update text inputs if active
@@ -237,6 +271,8 @@ func (m *Settings) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case m.activeCategory == CategoryPlugins && m.pluginEditing:
 			m.pluginInput, cmd = m.pluginInput.Update(msg)
 			cmds = append(cmds, cmd)
+		case m.activeCategory == CategoryFilters && m.sieveLoaded:
+			cmds = append(cmds, m.updateFocusedFilterInput(msg))
 		}
 	}
 
@@ -249,7 +285,8 @@ func (m *Settings) updateKeyPress(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
 		// unless we are in crypto config or encryption editing which have their own esc logic
 		if (m.activeCategory != CategoryAccounts || !m.isCryptoConfig) &&
 			(m.activeCategory != CategoryEncryption || m.encFocusIndex <= -1) &&
-			(m.activeCategory != CategoryPlugins || (!m.pluginEditing && m.pluginSelected == "")) {
+			(m.activeCategory != CategoryPlugins || (!m.pluginEditing && m.pluginSelected == "")) &&
+			(m.activeCategory != CategoryFilters || m.sieveAccountID == "") {
 			m.activePane = PaneMenu
 			return m, nil
 		}
@@ -276,6 +313,8 @@ func (m *Settings) updateKeyPress(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
 		return m.updateEncryption(msg)
 	case CategoryPlugins:
 		return m.updatePlugins(msg)
+	case CategoryFilters:
+		return m.updateFilters(msg)
 	}
 
 	return m, nil
@@ -289,6 +328,8 @@ func (m *Settings) canFocusSettingsMenuWithLeft() bool {
 		return config.IsSecureModeEnabled() && !m.confirmingDisable
 	case CategoryPlugins:
 		return !m.pluginEditing && m.pluginSelected == ""
+	case CategoryFilters:
+		return m.sieveAccountID == ""
 	case CategoryGeneral, CategoryTheme, CategoryMailingLists:
 		return true
 	default:
@@ -318,7 +359,7 @@ func (m *Settings) contentFocusStyle() lipgloss.Style {
 }
 
 func (m *Settings) updateMenu(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
-	categoryCount := int(CategoryPlugins) + 1
+	categoryCount := int(CategoryFilters) + 1
 
 	switch msg.String() {
 	case "up", "k":
@@ -374,6 +415,7 @@ func (m *Settings) View() tea.View {
 		t("settings.category_mailing_lists"),
 		t("settings.category_encryption"),
 		t("settings.category_plugins"),
+		t("settings.category_filters"),
 	}
 	for i, c := range categories {
 		cursor := "  "
@@ -419,6 +461,8 @@ func (m *Settings) View() tea.View {
 		right = m.viewEncryption()
 	case CategoryPlugins:
 		right = m.viewPlugins()
+	case CategoryFilters:
+		right = m.viewFilters()
 	}
 
 	rightPanel := lipgloss.NewStyle().
@@ -0,0 +1,349 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"charm.land/bubbles/v2/textarea"
+	tea "charm.land/bubbletea/v2"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/sieve"
+)
+
+// Fields of the filters editor, in focus order.
+const (
+	filterFieldVacation = iota
+	filterFieldSubject
+	filterFieldDays
+	filterFieldMessage
+	filterFieldScript
+	filterFieldSave
+	filterFieldCount
+)
+
+func newFilterTextArea(placeholder string, height int) textarea.Model {
+	ta := textarea.New()
+	ta.Placeholder = placeholder
+	ta.ShowLineNumbers = false
+	ta.SetHeight(height)
+	ta.SetStyles(ThemedTextAreaStyles())
+	return ta
+}
+
+// updateFilters handles input for the filters settings category. The view
+// has two states:
+//
+//  1. Account list (m.sieveAccountID == ""): pick an account; its active
+//     Sieve script is fetched over ManageSieve.
+//  2. Editor: toggle and edit the vacation auto-reply and edit the rest of
+//     the script. Saving uploads the script and makes it active.
+func (m *Settings) updateFilters(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
+	if m.sieveAccountID == "" {
+		return m.updateFilterAccounts(msg)
+	}
+	return m.updateFilterEditor(msg)
+}
+
+func (m *Settings) updateFilterAccounts(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
+	count := len(m.cfg.Accounts)
+	if count == 0 {
+		return m, nil
+	}
+	switch msg.String() {
+	case "up", "k":
+		m.filtersCursor = (m.filtersCursor - 1 + count) % count
+	case keyDown, "j":
+		m.filtersCursor = (m.filtersCursor + 1) % count
+	case keyEnter, keyRight, "l":
+		if m.filtersCursor < count {
+			return m, m.loadSieve(&m.cfg.Accounts[m.filtersCursor])
+		}
+	}
+	return m, nil
+}
+
+// loadSieve opens the editor for an account and fetches its active script.
+func (m *Settings) loadSieve(acct *config.Account) tea.Cmd {
+	m.sieveAccountID = acct.ID
+	m.sieveLoading = true
+	m.sieveLoaded = false
+	m.sieveSaving = false
+	m.sieveError = ""
+	m.sieveStatus = ""
+	m.sieveFocus = filterFieldVacation
+	m.blurFilterInputs()
+
+	account := *acct
+	return func() tea.Msg {
+		c, err := sieve.Connect(&account, "")
+		if err != nil {
+			return SieveLoadedMsg{AccountID: account.ID, Err: err}
+		}
+		defer c.Logout() //nolint:errcheck
+		name, script, err := c.ReadActive()
+		return SieveLoadedMsg{AccountID: account.ID, Name: name, Script: script, Err: err}
+	}
+}
+
+func (m *Settings) applySieveLoaded(msg SieveLoadedMsg) {
+	if msg.AccountID != m.sieveAccountID {
+		return
+	}
+	m.sieveLoading = false
+	if msg.Err != nil {
+		m.sieveError = msg.Err.Error()
+		return
+	}
+	v := sieve.ParseVacation(msg.Script)
+	m.sieveScriptName = msg.Name
+	m.sieveVacation = v.Enabled
+	m.sieveSubjectInput.SetValue(v.Subject)
+	m.sieveDaysInput.SetValue("")
+	if v.Days > 0 {
+		m.sieveDaysInput.SetValue(strconv.Itoa(v.Days))
+	}
+	m.sieveMessageInput.SetValue(v.Body)
+	// The vacation block is edited through its own fields, so the script
+	// editor shows everything else.
+	m.sieveScriptInput.SetValue(strings.TrimRight(sieve.SetVacation(msg.Script, sieve.Vacation{}), "\n"))
+	m.sieveLoaded = true
+}
+
+func (m *Settings) applySieveSaved(msg SieveSavedMsg) {
+	if msg.AccountID != m.sieveAccountID {
+		return
+	}
+	m.sieveSaving = false
+	if msg.Err != nil {
+		m.sieveError = msg.Err.Error()
+		return
+	}
+	m.sieveError = ""
+	m.sieveStatus = t("settings_filters.saved")
+}
+
+func (m *Settings) updateFilterEditor(msg tea.KeyPressMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key == "esc" {
+		m.sieveAccountID = ""
+		m.sieveLoaded = false
+		m.blurFilterInputs()
+		return m, nil
+	}
+	if m.sieveLoading || !m.sieveLoaded {
+		return m, nil
+	}
+
+	inTextArea := m.sieveFocus == filterFieldMessage || m.sieveFocus == filterFieldScript
+	switch {
+	case key == "ctrl+s":
+		return m, m.saveSieve()
+	case key == "tab" || (key == keyDown && !inTextArea):
+		return m, m.focusFilterField((m.sieveFocus + 1) % filterFieldCount)
+	case key == "shift+tab" || (key == "up" && !inTextArea):
+		return m, m.focusFilterField((m.sieveFocus - 1 + filterFieldCount) % filterFieldCount)
+	}
+
+	switch m.sieveFocus {
+	case filterFieldVacation:
+		if key == keyEnter || key == "space" {
+			m.sieveVacation = !m.sieveVacation
+			m.sieveStatus = ""
+		}
+		return m, nil
+	case filterFieldSave:
+		if key == keyEnter {
+			return m, m.saveSieve()
+		}
+		return m, nil
+	case filterFieldSubject, filterFieldDays:
+		if key == keyEnter {
+			return m, m.focusFilterField(m.sieveFocus + 1)
+		}
+	}
+
+	var cmd tea.Cmd
+	switch m.sieveFocus {
+	case filterFieldSubject:
+		m.sieveSubjectInput, cmd = m.sieveSubjectInput.Update(msg)
+	case filterFieldDays:
+		m.sieveDaysInput, cmd = m.sieveDaysInput.Update(msg)
+	case filterFieldMessage:
+		m.sieveMessageInput, cmd = m.sieveMessageInput.Update(msg)
+	case filterFieldScript:
+		m.sieveScriptInput, cmd = m.sieveScriptInput.Update(msg)
+	}
+	m.sieveStatus = ""
+	return m, cmd
+}
+
+// updateFocusedFilterInput forwards non-key messages, such as cursor blinks,
+// to the focused input.
+func (m *Settings) updateFocusedFilterInput(msg tea.Msg) tea.Cmd {
+	var cmd tea.Cmd
+	switch m.sieveFocus {
+	case filterFieldSubject:
+		m.sieveSubjectInput, cmd = m.sieveSubjectInput.Update(msg)
+	case filterFieldDays:
+		m.sieveDaysInput, cmd = m.sieveDaysInput.Update(msg)
+	case filterFieldMessage:
+		m.sieveMessageInput, cmd = m.sieveMessageInput.Update(msg)
+	case filterFieldScript:
+		m.sieveScriptInput, cmd = m.sieveScriptInput.Update(msg)
+	}
+	return cmd
+}
+
+func (m *Settings) focusFilterField(field int) tea.Cmd {
+	m.blurFilterInputs()
+	m.sieveFocus = field
+	switch field {
+	case filterFieldSubject:
+		return m.sieveSubjectInput.Focus()
+	case filterFieldDays:
+		return m.sieveDaysInput.Focus()
+	case filterFieldMessage:
+		return m.sieveMessageInput.Focus()
+	case filterFieldScript:
+		return m.sieveScriptInput.Focus()
+	}
+	return nil
+}
+
+func (m *Settings) blurFilterInputs() {
+	m.sieveSubjectInput.Blur()
+	m.sieveDaysInput.Blur()
+	m.sieveMessageInput.Blur()
+	m.sieveScriptInput.Blur()
+}
+
+// saveSieve validates the editor and uploads the script with the vacation
+// block applied.
+func (m *Settings) saveSieve() tea.Cmd {
+	if m.sieveSaving {
+		return nil
+	}
+	v := sieve.Vacation{
+		Enabled: m.sieveVacation,
+		Subject: strings.TrimSpace(m.sieveSubjectInput.Value()),
+		Body:    strings.TrimSpace(m.sieveMessageInput.Value()),
+	}
+	if days := strings.TrimSpace(m.sieveDaysInput.Value()); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			m.sieveError = t("settings_filters.error_days")
+			return nil
+		}
+		v.Days = n
+	}
+	if v.Enabled && v.Body == "" {
+		m.sieveError = t("settings_filters.error_message")
+		return nil
+	}
+
+	var acct *config.Account
+	for i := range m.cfg.Accounts {
+		if m.cfg.Accounts[i].ID == m.sieveAccountID {
+			acct = &m.cfg.Accounts[i]
+		}
+	}
+	if acct == nil {
+		return nil
+	}
+
+	m.sieveSaving = true
+	m.sieveError = ""
+	m.sieveStatus = ""
+	account := *acct
+	name := m.sieveScriptName
+	script := sieve.SetVacation(m.sieveScriptInput.Value(), v)
+	return func() tea.Msg {
+		c, err := sieve.Connect(&account, "")
+		if err != nil {
+			return SieveSavedMsg{AccountID: account.ID, Err: err}
+		}
+		defer c.Logout() //nolint:errcheck
+		return SieveSavedMsg{AccountID: account.ID, Err: c.WriteActive(name, script)}
+	}
+}
+
+func (m *Settings) viewFilters() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(t("settings_filters.title")) + "\n\n")
+
+	if m.sieveAccountID == "" {
+		if len(m.cfg.Accounts) == 0 {
+			b.WriteString(accountEmailStyle.Render("  "+t("settings_filters.no_accounts")) + "\n")
+			return b.String()
+		}
+		for i, acc := range m.cfg.Accounts {
+			selected := m.filtersCursor == i
+			style := m.contentItemStyle(selected)
+			line := fmt.Sprintf("%s%s %s", m.contentCursor(selected), acc.Name, accountEmailStyle.Render("<"+acc.Email+">"))
+			b.WriteString(style.Render(line) + "\n")
+		}
+		b.WriteString("\n")
+		b.WriteString(helpStyle.Render(t("settings_filters.help_accounts")))
+		return b.String()
+	}
+
+	for _, acc := range m.cfg.Accounts {
+		if acc.ID == m.sieveAccountID {
+			b.WriteString(accountEmailStyle.Render(acc.Email))
+		}
+	}
+	if m.sieveScriptName != "" && m.sieveLoaded {
+		b.WriteString(accountEmailStyle.Render(" • " + t("settings_filters.script") + ": " + m.sieveScriptName))
+	}
+	b.WriteString("\n\n")
+
+	switch {
+	case m.sieveLoading:
+		b.WriteString(accountEmailStyle.Render("  "+t("settings_filters.loading")) + "\n")
+		return b.String()
+	case !m.sieveLoaded:
+		b.WriteString(dangerStyle.Render("  "+m.sieveError) + "\n\n")
+		b.WriteString(helpStyle.Render(t("settings_filters.help_back")))
+		return b.String()
+	}
+
+	toggle := "[ ] " + t("settings_general.off")
+	if m.sieveVacation {
+		toggle = "[x] " + t("settings_general.on")
+	}
+	selected := m.sieveFocus == filterFieldVacation
+	b.WriteString(m.contentItemStyle(selected).Render(m.contentCursor(selected)+t("settings_filters.vacation")+": "+toggle) + "\n\n")
+
+	label := func(field int, text string) string {
+		if m.sieveFocus == field {
+			return m.contentFocusStyle().Render(text)
+		}
+		return settingsBlurredStyle.Render(text)
+	}
+	b.WriteString(label(filterFieldSubject, t("settings_filters.subject")) + "\n")
+	b.WriteString(m.sieveSubjectInput.View() + "\n")
+	b.WriteString(label(filterFieldDays, t("settings_filters.days")) + "\n")
+	b.WriteString(m.sieveDaysInput.View() + "\n")
+	b.WriteString(label(filterFieldMessage, t("settings_filters.message")) + "\n")
+	b.WriteString(m.sieveMessageInput.View() + "\n\n")
+	b.WriteString(label(filterFieldScript, t("settings_filters.script")) + "\n")
+	b.WriteString(m.sieveScriptInput.View() + "\n\n")
+
+	selected = m.sieveFocus == filterFieldSave
+	save := t("settings_filters.save")
+	if m.sieveSaving {
+		save = t("settings_filters.saving")
+	}
+	b.WriteString(m.contentItemStyle(selected).Render(m.contentCursor(selected)+save) + "\n")
+
+	switch {
+	case m.sieveError != "":
+		b.WriteString("\n" + dangerStyle.Render(m.sieveError) + "\n")
+	case m.sieveStatus != "":
+		b.WriteString("\n" + successStyle.Render(m.sieveStatus) + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render(t("settings_filters.help_editor")))
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/floatpane/matcha/config"
+	"github.com/floatpane/matcha/sieve"
+	"github.com/floatpane/matcha/sieve/sievetest"
+)
+
+func TestSettingsFiltersEditsVacation(t *testing.T) {
+	srv := sievetest.NewServer(t)
+	rules := "require \"fileinto\";\nfileinto \"Lists\";"
+	srv.SetScript("main", rules+"\n", true)
+
+	settings := NewSettings(&config.Config{Accounts: []config.Account{{
+		ID:          "work",
+		Email:       sievetest.Username,
+		Password:    sievetest.Password,
+		Insecure:    true,
+		SieveServer: srv.Addr(),
+	}}})
+	settings.activeCategory = CategoryFilters
+	settings.activePane = PaneContent
+
+	send := func(msg tea.Msg) []tea.Msg {
+		t.Helper()
+		_, cmd := settings.Update(msg)
+		return collectMsgs(cmd)
+	}
+	deliver := func(msgs []tea.Msg) {
+		t.Helper()
+		for _, msg := range msgs {
+			switch msg.(type) {
+			case SieveLoadedMsg, SieveSavedMsg:
+				send(msg)
+			}
+		}
+	}
+
+	deliver(send(tea.KeyPressMsg{Code: tea.KeyEnter}))
+	if !settings.sieveLoaded || settings.sieveError != "" {
+		t.Fatalf("script not loaded: %q", settings.sieveError)
+	}
+	if settings.sieveScriptName != "main" || settings.sieveScriptInput.Value() != rules {
+		t.Fatalf("loaded %q = %q", settings.sieveScriptName, settings.sieveScriptInput.Value())
+	}
+	if settings.sieveVacation {
+		t.Fatal("vacation reported on for a script without one")
+	}
+
+	// Turning the vacation on without a message is refused.
+	send(tea.KeyPressMsg{Code: tea.KeyEnter})
+	if msgs := send(tea.KeyPressMsg{Code: 's', Mod: tea.ModCtrl}); len(msgs) != 0 || settings.sieveError == "" {
+		t.Fatalf("saved a vacation with no message: %v", msgs)
+	}
+
+	settings.sieveSubjectInput.SetValue("Away")
+	settings.sieveDaysInput.SetValue("3")
+	settings.sieveMessageInput.SetValue("Back on Monday.")
+	deliver(send(tea.KeyPressMsg{Code: 's', Mod: tea.ModCtrl}))
+	if settings.sieveError != "" || settings.sieveStatus == "" {
+		t.Fatalf("save failed: %q", settings.sieveError)
+	}
+
+	saved, _ := srv.Script("main")
+	want := sieve.Vacation{Enabled: true, Subject: "Away", Body: "Back on Monday.", Days: 3}
+	if got := sieve.ParseVacation(saved); got != want {
+		t.Errorf("saved vacation = %+v, want %+v", got, want)
+	}
+	if !strings.Contains(saved, `fileinto "Lists";`) {
+		t.Errorf("saved script lost the existing rules:\n%s", saved)
+	}
+
+	// Esc returns to the account list, then to the menu.
+	send(tea.KeyPressMsg{Code: tea.KeyEscape})
+	if settings.sieveAccountID != "" || settings.activePane != PaneContent {
+		t.Fatal("esc did not return to the account list")
+	}
+	send(tea.KeyPressMsg{Code: tea.KeyEscape})
+	if settings.activePane != PaneMenu {
+		t.Fatal("esc did not return to the menu")
+	}
+}
@@ -72,6 +72,10 @@ func (m *Settings) updatePluginSettings(msg tea.KeyPressMsg) (tea.Model, tea.Cmd
 		m.pluginSettingCursor = (m.pluginSettingCursor - 1 + len(defs)) % len(defs)
 	case keyDown, kb.NavDown:
 		m.pluginSettingCursor = (m.pluginSettingCursor + 1) % len(defs)
+	case "e":
+		if m.plugins.DisabledReason(m.pluginSelected) != "" {
+			m.plugins.Enable(m.pluginSelected)
+		}
 	case keyEnter, "space", keyRight, "l":
 		def := defs[m.pluginSettingCursor]
 		switch def.Type {
@@ -150,6 +154,7 @@ func (m *Settings) viewPlugins() string {
 		schemas := m.plugins.Schemas()
 		if len(schemas) == 0 {
 			b.WriteString(accountEmailStyle.Render("  No plugins declare configurable settings.\n"))
+			b.WriteString(m.viewDisabledPlugins())
 			b.WriteString("\n")
 			b.WriteString(helpStyle.Render("Plugins use matcha.settings(...) to expose options."))
 			return b.String()
@@ -160,8 +165,12 @@ func (m *Settings) viewPlugins() string {
 			cursor := m.contentCursor(selected)
 			style := m.contentItemStyle(selected)
 			line := fmt.Sprintf("%s (%d %s)", s.Plugin, len(s.Defs), pluralSettings(len(s.Defs)))
+			if m.plugins.DisabledReason(s.Plugin) != "" {
+				line += " " + dangerStyle.Render("disabled")
+			}
 			b.WriteString(style.Render(cursor+line) + "\n")
 		}
+		b.WriteString(m.viewDisabledPlugins())
 		b.WriteString("\n")
 		b.WriteString(helpStyle.Render("↑/↓ navigate • enter open • esc back"))
 		return b.String()
@@ -169,6 +178,10 @@ func (m *Settings) viewPlugins() string {
 
 	defs := m.plugins.Schema(m.pluginSelected)
 	b.WriteString(accountEmailStyle.Render(m.pluginSelected) + "\n\n")
+	disabled := m.plugins.DisabledReason(m.pluginSelected)
+	if disabled != "" {
+		b.WriteString(dangerStyle.Render("  Disabled: "+disabled) + "\n\n")
+	}
 
 	for i, def := range defs {
 		selected := m.pluginSettingCursor == i
@@ -200,12 +213,32 @@ func (m *Settings) viewPlugins() string {
 			}
 		}
 		b.WriteString("\n\n")
-		b.WriteString(helpStyle.Render("↑/↓ navigate • enter toggle/edit • esc back"))
+		help := "↑/↓ navigate • enter toggle/edit • esc back"
+		if disabled != "" {
+			help = "↑/↓ navigate • enter toggle/edit • e re-enable • esc back"
+		}
+		b.WriteString(helpStyle.Render(help))
 	}
 
 	return b.String()
 }
 
+// viewDisabledPlugins lists the plugins that were switched off for running
+// past their time budget, with the reason.
+func (m *Settings) viewDisabledPlugins() string {
+	disabled := m.plugins.Disabled()
+	if len(disabled) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n" + m.contentFocusStyle().Render("Disabled plugins") + "\n")
+	for _, d := range disabled {
+		b.WriteString(dangerStyle.Render(fmt.Sprintf("  %s: %s", d.Name, d.Reason)) + "\n")
+	}
+	b.WriteString(helpStyle.Render("Disabled until matcha restarts; plugins with settings can be re-enabled from their page.") + "\n")
+	return b.String()
+}
+
 func formatSettingValue(v interface{}) string {
 	switch x := v.(type) {
 	case bool:
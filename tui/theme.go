@@ -70,6 +70,7 @@ func RebuildStyles() {
 	tabBarStyle = lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder()).BorderBottom(true).PaddingBottom(1).MarginBottom(1)
 	unreadEmailStyle = lipgloss.NewStyle().Foreground(t.Accent).Bold(true)
 	readEmailStyle = lipgloss.NewStyle().Foreground(t.Secondary)
+	flaggedEmailStyle = lipgloss.NewStyle().Foreground(t.Warning)
 	visualSelectedStyle = lipgloss.NewStyle().Background(t.AccentDark).Foreground(t.AccentText).PaddingLeft(2)
 	selectedDateStyle = lipgloss.NewStyle().Foreground(t.Accent)
 